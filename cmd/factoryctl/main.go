@@ -0,0 +1,11 @@
+package main
+
+import (
+	"industrial-4.0-demo/internal/cli"
+	"os"
+)
+
+// main 是命令行客户端 factoryctl 的入口
+func main() {
+	os.Exit(cli.Run(os.Args[1:], os.Stdout, os.Stderr))
+}
@@ -2,162 +2,727 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"industrial-4.0-demo/internal/anomaly"
+	"industrial-4.0-demo/internal/api"
+	"industrial-4.0-demo/internal/audit"
+	"industrial-4.0-demo/internal/auth"
+	"industrial-4.0-demo/internal/b2mml"
+	"industrial-4.0-demo/internal/buildinfo"
+	"industrial-4.0-demo/internal/calendar"
+	"industrial-4.0-demo/internal/chaos"
+	"industrial-4.0-demo/internal/cluster"
 	"industrial-4.0-demo/internal/config"
+	"industrial-4.0-demo/internal/costing"
+	"industrial-4.0-demo/internal/defect"
 	"industrial-4.0-demo/internal/engine"
+	"industrial-4.0-demo/internal/erp"
 	"industrial-4.0-demo/internal/event"
+	"industrial-4.0-demo/internal/features"
+	"industrial-4.0-demo/internal/grpcapi"
 	"industrial-4.0-demo/internal/handlers"
+	"industrial-4.0-demo/internal/health"
+	"industrial-4.0-demo/internal/history"
+	"industrial-4.0-demo/internal/logging"
+	"industrial-4.0-demo/internal/lot"
+	"industrial-4.0-demo/internal/maintenance"
+	"industrial-4.0-demo/internal/metrics"
+	"industrial-4.0-demo/internal/notify"
+	"industrial-4.0-demo/internal/oee"
+	"industrial-4.0-demo/internal/opcua"
 	"industrial-4.0-demo/internal/persistence"
+	"industrial-4.0-demo/internal/quality"
+	"industrial-4.0-demo/internal/ratelimit"
+	"industrial-4.0-demo/internal/reliability"
+	"industrial-4.0-demo/internal/reload"
+	"industrial-4.0-demo/internal/replay"
+	"industrial-4.0-demo/internal/serial"
+	"industrial-4.0-demo/internal/simulator"
+	"industrial-4.0-demo/internal/sla"
+	"industrial-4.0-demo/internal/sparkplug"
 	"industrial-4.0-demo/internal/station"
+	"industrial-4.0-demo/internal/throughput"
 	"industrial-4.0-demo/internal/types"
 	"industrial-4.0-demo/internal/web"
+	"industrial-4.0-demo/internal/whatif"
+	"industrial-4.0-demo/internal/workqueue"
+	"industrial-4.0-demo/internal/yield"
+	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
 )
 
-const walPath = "tasks.wal"
-
 // main 是应用程序的主入口
 func main() {
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	// 命令行参数优先于环境变量和配置文件，未指定的参数不覆盖
+	configPath := flag.String("config", "", "配置文件路径，默认使用 "+config.PathEnv+" 环境变量或工作目录下的 config.yaml")
+	flag.String("profile", "", "配置集: "+strings.Join(config.Profiles(), " / ")+" (profile)")
+	flag.String("addr", "", "HTTP 监听地址 (server.addr)")
+	flag.String("grpc-addr", "", "gRPC 监听地址，为空时不启动 gRPC 服务 (server.grpc_addr)")
+	flag.String("opcua-addr", "", "OPC UA 监听地址，为空时不启动 OPC UA 服务 (server.opcua_addr)")
+	flag.String("wal", "", "WAL 文件路径 (wal.path)")
+	flag.Int("workers", 0, "工作线程数 (max_workers)")
+	flag.Bool("sim", false, "启动时自动运行订单模拟器 (simulation.autostart)")
+	flag.String("log-format", "", "日志格式: json / text (logging.format)")
+	flag.String("log-level", "", "日志级别: debug / info / warn / error (logging.level)")
+	flag.String("record", "", "将提交、取消和工站结果录制到回放文件 (replay.record)")
+	flag.String("replay", "", "按回放文件重放一次生产，工站返回录制的结果 (replay.file)")
+	flag.Parse()
+
+	cfg, err := config.LoadConfig(*configPath, flagOverrides())
+	if err != nil {
+		slog.Error("加载配置失败", "error", err)
+		os.Exit(1)
+	}
+	// 配置中的问题一次性列出，避免运行到一半才暴露
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// 非零退出码在其他 defer (关闭 WAL、日志文件等) 全部执行后才退出进程
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
+
+	var logOutput io.Writer = os.Stdout
+	if file := cfg.Logging.File; file.Path != "" {
+		logFile, err := logging.OpenRotatingFile(file.Path, int64(file.MaxSizeMB)<<20, time.Duration(file.MaxAgeHours)*time.Hour, file.MaxBackups)
+		if err != nil {
+			slog.Error("无法打开日志文件", "error", err, "path", file.Path)
+			os.Exit(1)
+		}
+		defer logFile.Close()
+		logOutput = io.MultiWriter(os.Stdout, logFile)
+	}
+	var handler slog.Handler = slog.NewJSONHandler(logOutput, nil)
+	if cfg.Logging.Format == config.LogFormatText {
+		handler = slog.NewTextHandler(logOutput, nil)
+	}
+	logLevels := logging.New(handler, slog.LevelInfo)
+	logger := logLevels.Logger("")
 	slog.SetDefault(logger)
+	if err := logLevels.Update(cfg.Logging.Level, cfg.Logging.Components); err != nil {
+		logger.Error("日志级别配置无效", "error", err)
+		os.Exit(1)
+	}
+	logger.Info("配置已加载", "profile", cfg.Profile, "file", cfg.File())
 
-	hub := web.NewHub()
+	// 所有指标注册在进程自己的注册表上，/metrics 和 Pushgateway 推送都从这里读取
+	m := metrics.New(metrics.NewRegistry())
+
+	hub := web.NewHub(m)
 	go hub.Run()
 	stateTracker := web.NewStateTracker(hub)
 
 	eventBus := event.NewBus()
+	historyStore := history.NewStore()
 
-	wal, err := persistence.NewWAL(walPath)
+	// 按命名空间拆分时每条产线写入单独的日志文件，默认命名空间仍使用 wal.path
+	var wal persistence.Log
+	if cfg.WAL.PerNamespace {
+		wal, err = persistence.NewNamespacedWAL(cfg.WAL.Path)
+	} else {
+		wal, err = persistence.NewWAL(cfg.WAL.Path)
+	}
 	if err != nil {
-		logger.Error("无法初始化 WAL", "error", err)
+		logger.Error("无法初始化 WAL", "error", err, "path", cfg.WAL.Path)
 		os.Exit(1)
 	}
 	defer wal.Close()
+	wal.SetSyncOnWrite(cfg.WAL.Sync)
 
-	cfg, err := config.LoadConfig()
+	buildinfo.SetConfigHash(cfg.Hash())
+	buildinfo.Observe(m)
+	engineLogger := logLevels.Logger(logging.ComponentEngine)
+	webLogger := logLevels.Logger(logging.ComponentWeb)
+
+	handlers.RegisterEventHandlers(eventBus, stateTracker, historyStore, m, engineLogger)
+	stateTracker.SetQueueAlertThreshold(cfg.Alerts.QueueThreshold)
+	oeeTracker := newOEETracker(cfg, m)
+	oeeTracker.Register(eventBus)
+	throughputTracker := throughput.NewTracker(time.Duration(cfg.Throughput.MaxWindowHours)*time.Hour, m)
+	throughputTracker.Register(eventBus)
+	lotTracker := lot.NewTracker(engineLogger)
+	lotTracker.Register(eventBus)
+	qualityTracker := quality.NewTracker(m)
+	qualityTracker.Register(eventBus)
+	defectTracker := defect.NewTracker(time.Duration(cfg.Defects.MaxWindowHours)*time.Hour, m)
+	defectTracker.Register(eventBus)
+	reliabilityTracker := reliability.NewTracker(time.Duration(cfg.Reliability.MaxWindowHours)*time.Hour, m)
+	reliabilityTracker.Register(eventBus)
+	yieldTracker := yield.NewTracker(cfg.Yield.MaxRework, yield.Costs{Unit: cfg.Yield.UnitCost, Station: cfg.Yield.StationCost},
+		time.Duration(cfg.Yield.MaxWindowHours)*time.Hour, m)
+	yieldTracker.Register(eventBus)
+	if cfg.Anomaly.ZScore > 0 {
+		anomaly.NewDetector(cfg.Anomaly.Alpha, cfg.Anomaly.ZScore, cfg.Anomaly.WarmupSamples, m).Register(eventBus)
+	}
+
+	wf := engine.NewWorkflowEngine(cfg.Workflows, cfg.ResourcePools, cfg.Lifecycles, engineLogger, eventBus, cfg.StepDelayMs)
+	if err := wf.Workflows().SetFallback(cfg.DefaultWorkflow); err != nil {
+		logger.Error("无法设置默认工作流", "error", err)
+		os.Exit(1)
+	}
+	wf.Workflows().SetStrict(cfg.StrictProductTypes)
+	// 按工作流的剩余步骤和工站的历史耗时预测完工时间，跟踪有交期的工件
+	slaTracker := sla.NewTracker(wf.Workflows().Route, sla.Estimates{
+		Step: time.Duration(cfg.StationDelayMs) * time.Millisecond,
+		Move: time.Duration(cfg.StepDelayMs) * time.Millisecond,
+		Due:  slaDue(cfg.SLA.DueSeconds),
+	}, time.Duration(cfg.SLA.MaxWindowHours)*time.Hour, m)
+	slaTracker.Register(eventBus)
+	// 班次之外、休息和计划停机期间不向工站派发工件，OEE 将这些时间计为计划停机
+	cal, err := calendar.New(cfg.Calendar)
 	if err != nil {
-		logger.Error("加载配置失败", "error", err)
+		logger.Error("无法解析日历", "error", err)
 		os.Exit(1)
 	}
+	wf.Stations().SetCalendar(cal)
+	oeeTracker.SetCalendar(cal)
+	// 需要认证操作员的工站在加工前按技能占用一名在班的操作员
+	if len(cfg.Operators.Roster) > 0 {
+		operators := engine.NewOperatorPool(reload.Operators(cfg), cfg.Operators.Skills, eventBus)
+		operators.SetCalendar(cal)
+		wf.SetOperators(operators)
+	}
+	// 开始生产时按配置的格式分配序列号
+	serials, err := serial.New(cfg.Serial)
+	if err != nil {
+		logger.Error("无法解析序列号格式", "error", err)
+		os.Exit(1)
+	}
+	wf.SetSerials(serials)
+	// 每次加工按能耗、物料和操作员工时计算成本，写入加工履历
+	costModel, err := costing.New(cfg.Costing)
+	if err != nil {
+		logger.Error("无法解析成本参数", "error", err)
+		os.Exit(1)
+	}
+	wf.SetCosting(costModel)
+	// 拉动式生产：下游工站的在制品达到上限时工件停留在上游，工站注册时按此设置看板数
+	wf.Stations().SetWIPLimits(cfg.WIPLimits)
+	maintenanceTracker := maintenance.NewTracker(reload.MaintenanceRules(cfg), wf.Stations(), m, engineLogger)
+	maintenanceTracker.Register(eventBus)
+	stationLogger := logLevels.Logger(logging.ComponentStation)
+	// 回放模式下工站返回录制的结果，不连接远程工站，也不注入故障和自动运行模拟器
+	var replayer *replay.Replayer
+	if file := cfg.Replay.File; file != "" {
+		entries, err := replay.Load(file)
+		if err != nil {
+			logger.Error("无法读取回放文件", "error", err, "file", file)
+			os.Exit(1)
+		}
+		replayer = replay.New(file, entries, cfg.Replay.Speed, stationLogger)
+	}
+	remotes, err := registerStations(wf, stationLogger, cfg, replayer)
+	if err != nil {
+		logger.Error("无法注册远程工站", "error", err)
+		os.Exit(1)
+	}
+	// 故障注入：按需演示重试、健康检查和 Saga 补偿，配置中的故障从启动开始生效
+	var injector *chaos.Injector
+	if cfg.Chaos.Enabled && replayer == nil {
+		injector = chaos.NewInjector(stationLogger, m)
+		for _, spec := range cfg.Chaos.Faults {
+			if _, err := injector.Inject(spec, time.Now()); err != nil {
+				logger.Error("无法注入故障", "error", err)
+				os.Exit(1)
+			}
+		}
+		wf.Stations().SetChaos(injector)
+	}
 
-	handlers.RegisterEventHandlers(eventBus, stateTracker, logger)
-
-	wf := engine.NewWorkflowEngine(cfg.Workflows, cfg.ResourcePools, logger, eventBus, cfg.StepDelayMs)
-	registerStations(wf, logger, cfg.StationDelayMs)
-
-	scheduler := engine.NewScheduler(wf, cfg.MaxWorkers, wal, stateTracker, logger)
+	scheduler := engine.NewScheduler(wf, cfg.MaxWorkers, wal, stateTracker, m, logLevels.Logger(logging.ComponentScheduler))
+	// 启用优先级策略后由配置统一决定任务的优先级
+	policy, err := reload.PriorityPolicy(cfg)
+	if err != nil {
+		logger.Error("无法初始化优先级策略", "error", err)
+		os.Exit(1)
+	}
+	scheduler.SetPriorityPolicy(policy)
+	if err := scheduler.SetNamespaceQuotas(cfg.NamespaceQuotas); err != nil {
+		logger.Error("命名空间配额无效", "error", err)
+		os.Exit(1)
+	}
+	scheduler.SetPlanning(reload.Planning(cfg))
+	if path := cfg.Replay.Record; path != "" {
+		recorder, err := replay.Create(path, logger)
+		if err != nil {
+			logger.Error("无法创建回放文件", "error", err, "file", path)
+			os.Exit(1)
+		}
+		defer recorder.Close()
+		recorder.Register(eventBus)
+		scheduler.SetRecorder(recorder)
+	}
+	// 共享工作队列：调度器只负责出队派发，任务由 worker 进程拉取执行，worker 确认后才在 WAL 中标记结束
+	// backend 为 redis 时任务和投递保存在 Redis Streams 中，worker 直接访问 Redis
+	var workQueue *workqueue.Queue
+	var streamQueue *workqueue.StreamQueue
+	switch {
+	case cfg.Queue.Enabled && cfg.Queue.Backend == workqueue.BackendRedis:
+		streamQueue = workqueue.NewStream(cfg.Queue, eventBus, stateTracker, serials, m, logger)
+		defer streamQueue.Close()
+		scheduler.SetExecutor(streamQueue)
+	case cfg.Queue.Enabled:
+		workQueue = workqueue.New(cfg.Queue, eventBus, stateTracker, serials, m, logger)
+		scheduler.SetExecutor(workQueue)
+	}
 
-	if err := scheduler.RecoverTasks(); err != nil {
-		logger.Warn("从 WAL 恢复任务失败", "error", err)
+	// 集群中的节点以跟随者启动，成为领导者后再恢复 WAL 中的任务并开始出队
+	var elector *cluster.Elector
+	if cfg.Cluster.Enabled {
+		elector = cluster.New(cfg.Cluster, m, logger)
+		scheduler.SetStandby(true)
+	}
+	// 回放从空队列开始，不恢复 WAL 中的任务
+	if replayer == nil && elector == nil {
+		if err := scheduler.RecoverTasks(); err != nil {
+			logger.Warn("从 WAL 恢复任务失败", "error", err)
+		}
 	}
 
-	logger.Info("=== PCB 智能工厂调度系统启动 ===")
+	info := buildinfo.Get()
+	logger.Info("=== PCB 智能工厂调度系统启动 ===", "version", info.Version, "commit", info.Commit, "config_hash", info.ConfigHash)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	go scheduler.Start(ctx)
-	go startAPIServer(scheduler, hub, stateTracker, logger)
-	go simulateTasks(ctx, scheduler)
+	if workQueue != nil {
+		go workQueue.Run(ctx)
+	}
+	if replayer != nil {
+		go replayer.Run(ctx, scheduler)
+	}
+	go oeeTracker.Run(ctx, seconds(cfg.OEE.GaugeWindowSeconds))
+	go throughputTracker.Run(ctx, seconds(cfg.Throughput.GaugeWindowSeconds))
+	go reliabilityTracker.Run(ctx, seconds(cfg.Reliability.GaugeWindowSeconds))
+	go yieldTracker.Run(ctx, seconds(cfg.Yield.GaugeWindowSeconds))
+	go slaTracker.Run(ctx, seconds(cfg.SLA.CheckIntervalSeconds), seconds(cfg.SLA.GaugeWindowSeconds))
+	if hc := cfg.HealthCheck; hc.IntervalSeconds > 0 {
+		checker := health.NewChecker(seconds(hc.TimeoutSeconds), seconds(hc.StaleAfterSeconds), m, stationLogger)
+		for _, remote := range remotes {
+			checker.Watch(remote.GetID(), injector.Probe(remote.GetID(), remote.Ping))
+		}
+		go checker.Run(ctx, seconds(hc.IntervalSeconds))
+	}
+	if push := cfg.Metrics.Push; push.URL != "" {
+		instance := push.Instance
+		if instance == "" {
+			instance, _ = os.Hostname()
+		}
+		logger.Info("启用指标推送", "url", push.URL, "job", push.Job, "instance", instance)
+		go m.NewPusher(push.URL, push.Job, instance, logger).Run(ctx, seconds(push.IntervalSeconds))
+	}
+	if cfg.Sparkplug.Broker != "" {
+		publisher := sparkplug.New(cfg.Sparkplug, stateTracker, m, logger)
+		publisher.Register(eventBus)
+		go publisher.Run(ctx)
+	}
+	importer := b2mml.New(cfg.B2MML, scheduler, stateTracker, lotTracker, m, logger)
+	var erpAdapter *erp.Adapter
+	if cfg.ERP.Enabled() {
+		erpAdapter, err = erp.New(cfg.ERP, scheduler, stateTracker, lotTracker, m, logger)
+		if err != nil {
+			logger.Error("无法初始化 ERP 订单适配器", "error", err)
+			os.Exit(1)
+		}
+	}
+	var notifier *notify.Notifier
+	if cfg.Notifications.Enabled() {
+		notifier, err = notify.New(cfg.Notifications, m, logger)
+		if err != nil {
+			logger.Error("无法初始化通知", "error", err)
+			os.Exit(1)
+		}
+		notifier.Register(eventBus)
+		go notifier.Run(ctx)
+	}
+	if ttl := time.Duration(cfg.Retention.FinishedTTLSeconds) * time.Second; ttl > 0 {
+		scheduler.SetFinishedTTL(ttl)
+		go stateTracker.RunRetention(ctx, ttl, func(p web.ProductState) {
+			historyStore.Archive(&types.Product{ID: p.ID, Type: p.Type, Priority: p.Priority, Attrs: p.Attrs, RetryOf: p.RetryOf, Namespace: p.Namespace}, p.Status, p.FinishedAt)
+		})
+	}
+	var limiter *ratelimit.Limiter
+	if cfg.RateLimit.Enabled {
+		limiter = ratelimit.NewLimiter(cfg.RateLimit.RequestsPerSecond, cfg.RateLimit.Burst)
+	}
+	authenticator := auth.New(cfg.Auth)
+	apiServer := api.NewServer(scheduler, hub, stateTracker, historyStore, cfg.Server.StaticDir, authenticator, limiter, m, webLogger)
+	apiServer.SetMaxBodyBytes(cfg.Server.MaxBodyBytes)
+	if authenticator != nil {
+		// 启用认证时 WebSocket 只接受短期令牌，避免长期有效的凭证出现在连接 URL 中
+		wsTokens, err := auth.NewWSTokenIssuer(cfg.Auth.WSToken)
+		if err != nil {
+			logger.Error("初始化 WebSocket 令牌失败", "error", err)
+			os.Exit(1)
+		}
+		apiServer.SetWSTokens(wsTokens)
+	}
+	sim := simulator.New(scheduler, simulator.Settings{
+		Scenario: cfg.Simulation.Scenario,
+		Rate:     cfg.Simulation.Rate,
+		Mix:      cfg.Simulation.Mix,
+		Limit:    cfg.Simulation.Limit,
+	}, logger)
+	sim.SetScriptsDir(cfg.ScenariosPath())
+	sim.Register(eventBus)
+	apiServer.SetSimulator(sim)
+	flags, err := features.New(cfg.Features, m)
+	if err != nil {
+		logger.Error("无法初始化功能开关", "error", err)
+		os.Exit(1)
+	}
+	// 收到 SIGHUP 或配置文件被修改时重新加载配置
+	reloader := reload.New(cfg, scheduler, sim, logLevels, flags, logger)
+	reloader.SetOEE(oeeTracker)
+	reloader.SetMaintenance(maintenanceTracker)
+	go reloader.Run(ctx)
+	apiServer.SetOEE(oeeTracker)
+	apiServer.SetThroughput(throughputTracker)
+	apiServer.SetLots(lotTracker)
+	apiServer.SetB2MML(importer)
+	if erpAdapter != nil {
+		apiServer.SetERP(erpAdapter)
+	}
+	if notifier != nil {
+		apiServer.SetNotifier(notifier)
+	}
+	if elector != nil {
+		apiServer.SetCluster(elector)
+	}
+	if workQueue != nil {
+		apiServer.SetWorkQueue(workQueue)
+	}
+	if streamQueue != nil {
+		apiServer.SetStreamQueue(streamQueue)
+	}
+	apiServer.SetQuality(qualityTracker)
+	apiServer.SetDefects(defectTracker)
+	apiServer.SetMaintenance(maintenanceTracker)
+	apiServer.SetReliability(reliabilityTracker)
+	apiServer.SetYield(yieldTracker)
+	apiServer.SetSLA(slaTracker)
+	apiServer.SetWhatIf(whatIfBaseline(cfg))
+	if injector != nil {
+		apiServer.SetChaos(injector)
+	}
+	if replayer != nil {
+		apiServer.SetReplay(replayer)
+	}
+	apiServer.SetLogLevels(logLevels)
+	apiServer.SetReloader(reloader)
+	apiServer.SetFeatures(flags)
+	if cfg.Audit.Path != "" {
+		auditLog, err := audit.Open(cfg.Audit.Path)
+		if err != nil {
+			logger.Error("无法打开审计日志", "error", err, "path", cfg.Audit.Path)
+			os.Exit(1)
+		}
+		defer auditLog.Close()
+		apiServer.SetAuditLog(auditLog)
+	}
+	httpServer := &http.Server{
+		Addr:         cfg.Server.Addr,
+		Handler:      apiServer.Handler(),
+		ReadTimeout:  seconds(cfg.Server.ReadTimeoutSeconds),
+		WriteTimeout: seconds(cfg.Server.WriteTimeoutSeconds),
+		IdleTimeout:  seconds(cfg.Server.IdleTimeoutSeconds),
+	}
+	// WebSocket 连接已被劫持，Shutdown 不会等待它们，需要由 Hub 主动关闭
+	httpServer.RegisterOnShutdown(hub.Close)
+	go startAPIServer(httpServer, logger)
+
+	var grpcServer *grpc.Server
+	if cfg.Server.GRPCAddr != "" {
+		grpcAPI := grpcapi.NewServer(scheduler, hub, stateTracker, historyStore, authenticator, limiter, m, webLogger)
+		if elector != nil {
+			grpcAPI.SetCluster(elector)
+		}
+		grpcServer = grpcAPI.GRPCServer()
+		go startGRPCServer(grpcServer, cfg.Server.GRPCAddr, logger)
+	}
+	if cfg.Server.OPCUAAddr != "" {
+		uaServer := opcua.NewServer(cfg.Server.OPCUAAddr, stateTracker, logger)
+		uaServer.SetOEE(oeeTracker, seconds(cfg.OEE.GaugeWindowSeconds))
+		uaServer.SetThroughput(throughputTracker, seconds(cfg.Throughput.GaugeWindowSeconds))
+		// OPC UA 服务随 ctx 结束关闭，启动失败不影响编排器的其他功能
+		if err := uaServer.Start(ctx); err != nil {
+			logger.Error("OPC UA 服务启动失败", "error", err, "addr", cfg.Server.OPCUAAddr)
+		}
+	}
+	// 向调度器提交订单的后台任务，集群中只在领导者上运行
+	startSources := func() {
+		if cfg.B2MML.Dir != "" {
+			go importer.Watch(ctx, cfg.B2MML.Dir, cfg.B2MML.Namespace, time.Duration(cfg.B2MML.PollMs)*time.Millisecond)
+		}
+		if erpAdapter != nil {
+			go erpAdapter.Run(ctx)
+		}
+		if cfg.Simulation.Autostart && replayer == nil {
+			if _, err := sim.Start(simulator.Settings{}); err != nil {
+				logger.Warn("模拟器启动失败", "error", err)
+			}
+		}
+	}
+	clusterCtx, stopCluster := context.WithCancel(context.Background())
+	var leadershipLost atomic.Bool
+	clusterDone := make(chan struct{})
+	if elector == nil {
+		if streamQueue != nil {
+			go streamQueue.Run(ctx)
+		}
+		startSources()
+		close(clusterDone)
+	} else {
+		go func() {
+			defer close(clusterDone)
+			elector.Run(clusterCtx, func() {
+				// 上一任领导者可能在本节点打开 WAL 之后压缩或追加了日志，重新打开后恢复它未完成的任务
+				if err := wal.Reopen(); err != nil {
+					logger.Error("重新打开 WAL 失败", "error", err)
+					os.Exit(1)
+				}
+				if err := scheduler.RecoverTasks(); err != nil {
+					logger.Warn("从 WAL 恢复任务失败", "error", err)
+				}
+				scheduler.SetStandby(false)
+				// 只有领导者读取 Redis 中 worker 写入的事件流
+				if streamQueue != nil {
+					go streamQueue.Run(ctx)
+				}
+				startSources()
+			}, func() {
+				// 其他节点可能已经接管，立即停止派发避免两个节点同时派发任务，
+				// 按正常流程停机后以非零退出码退出，由进程管理器重启为跟随者
+				logger.Error("失去集群领导权，停机后退出进程")
+				scheduler.SetStandby(true)
+				leadershipLost.Store(true)
+				stopCluster()
+				cancel()
+			})
+		}()
+	}
+	// 停机时先停止模拟器，不再向正在停止的调度器提交订单
+	go func() {
+		<-ctx.Done()
+		sim.Stop()
+	}()
 
-	waitForShutdown(logger, cancel, scheduler)
+	waitForShutdown(ctx, logger, cancel, scheduler, httpServer, grpcServer, seconds(cfg.Server.ShutdownTimeoutSeconds))
+	// 在途任务结束后才释放租约，新的领导者不会重复派发它们
+	stopCluster()
+	<-clusterDone
+	if leadershipLost.Load() {
+		exitCode = 1
+	}
 }
 
-// registerStations 注册所有可用的工站
-func registerStations(wf *engine.WorkflowEngine, logger *slog.Logger, delayMs int) {
-	wf.RegisterStation(station.NewStation(types.StationCAM, logger, delayMs))
-	wf.RegisterStation(station.NewStation(types.StationDrill, logger, delayMs))
-	wf.RegisterStation(station.NewStation(types.StationLami, logger, delayMs))
-	wf.RegisterStation(station.NewStation(types.StationEtch, logger, delayMs))
-	wf.RegisterStation(station.NewStation(types.StationMask, logger, delayMs))
-	wf.RegisterStation(station.NewStation(types.StationSilk, logger, delayMs))
-	wf.RegisterStation(station.NewStation(types.StationETest, logger, delayMs))
-	wf.RegisterStation(station.NewStation(types.StationPack, logger, delayMs))
-
-	remoteAddr := os.Getenv("REMOTE_STATION_ADDR")
-	if remoteAddr == "" {
-		remoteAddr = "http://localhost:9090"
-	}
-	wf.RegisterStation(station.NewRemoteStation(types.StationAOI, remoteAddr, logger))
+// seconds 将配置中的秒数转换为 time.Duration
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
 }
 
-// simulateTasks 模拟提交初始订单
-func simulateTasks(ctx context.Context, scheduler *engine.Scheduler) {
-	info, _ := os.Stat(walPath)
-	if info != nil && info.Size() > 100 {
-		return
+// slaDue 将各产品类型的默认交期从秒数转换为时长
+func slaDue(dueSeconds map[string]int) map[string]time.Duration {
+	due := make(map[string]time.Duration, len(dueSeconds))
+	for productType, n := range dueSeconds {
+		due[productType] = seconds(n)
 	}
+	return due
+}
 
-	tasks := []types.Product{
-		{ID: "PCB_Double_001", Type: "PCB_DOUBLE_LAYER", Priority: 0, Attrs: map[string]interface{}{"layers": 2}},
-		{ID: "PCB_Multi_4L_001", Type: "PCB_MULTILAYER", Priority: 1, Attrs: map[string]interface{}{"layers": 4}},
-		{ID: "PCB_Proto_Fast", Type: "PCB_PROTOTYPE", Priority: 2, Attrs: map[string]interface{}{"layers": 2}},
-		{ID: "PCB_Double_002", Type: "PCB_DOUBLE_LAYER", Priority: 0, Attrs: map[string]interface{}{"layers": 2}},
-		{ID: "PCB_Multi_8L_001", Type: "PCB_MULTILAYER", Priority: 1, Attrs: map[string]interface{}{"layers": 8}},
-		{ID: "PCB_Double_003", Type: "PCB_DOUBLE_LAYER", Priority: 0, Attrs: map[string]interface{}{"layers": 2}},
-	}
+// newOEETracker 按配置创建 OEE 追踪器，未单独配置理想节拍的工站使用工站的处理延时
+func newOEETracker(cfg *config.Config, m *metrics.Metrics) *oee.Tracker {
+	idealCycle := time.Duration(cfg.StationDelayMs) * time.Millisecond
+	return oee.NewTracker(idealCycle, reload.IdealCycles(cfg), time.Duration(cfg.OEE.MaxWindowHours)*time.Hour, m)
+}
 
-	for _, task := range tasks {
-		select {
-		case <-ctx.Done():
-			return
-		case <-time.After(10 * time.Second):
-			scheduler.SubmitTask(&task)
+// whatIfBaseline 按配置生成 what-if 仿真的静态基线：加工时间取理想节拍，失败率取本地工站注入的失败概率
+func whatIfBaseline(cfg *config.Config) whatif.Baseline {
+	failureRates := make(map[types.StationID]float64, len(cfg.Stations))
+	for id, sc := range cfg.Stations {
+		if sc.Endpoint == "" && sc.FailureRate > 0 {
+			failureRates[id] = sc.FailureRate
 		}
 	}
+	return whatif.Baseline{
+		Cycles:       reload.IdealCycles(cfg),
+		DefaultCycle: time.Duration(cfg.StationDelayMs) * time.Millisecond,
+		Move:         time.Duration(cfg.StepDelayMs) * time.Millisecond,
+		FailureRates: failureRates,
+	}
 }
 
-// startAPIServer 启动 API 和 Web 服务器
-func startAPIServer(scheduler *engine.Scheduler, hub *web.Hub, st *web.StateTracker, logger *slog.Logger) {
-	mux := http.NewServeMux()
-	mux.Handle("/metrics", promhttp.Handler())
-	mux.HandleFunc("/ws", hub.ServeWs)
-	mux.HandleFunc("/api/state", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(st.GetStateSnapshot())
-	})
-	mux.HandleFunc("/api/tasks", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-		var p types.Product
-		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
-			logger.Warn("解析任务请求失败", "error", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		if p.ID == "" {
-			p.ID = "API_ORDER_" + time.Now().Format("150405.000")
-		}
-		scheduler.SubmitTask(&p)
-		w.WriteHeader(http.StatusAccepted)
-		json.NewEncoder(w).Encode(map[string]string{"status": "accepted", "id": p.ID})
+// flagKeys 是命令行参数对应的配置项
+var flagKeys = map[string]string{
+	"profile":    "profile",
+	"addr":       "server.addr",
+	"grpc-addr":  "server.grpc_addr",
+	"opcua-addr": "server.opcua_addr",
+	"wal":        "wal.path",
+	"workers":    "max_workers",
+	"sim":        "simulation.autostart",
+	"log-format": "logging.format",
+	"log-level":  "logging.level",
+	"record":     "replay.record",
+	"replay":     "replay.file",
+}
+
+// flagOverrides 返回命令行中显式指定的参数对应的配置项
+func flagOverrides() config.Overrides {
+	overrides := config.Overrides{}
+	flag.Visit(func(f *flag.Flag) {
+		if key, ok := flagKeys[f.Name]; ok {
+			overrides[key] = f.Value.(flag.Getter).Get()
+		}
 	})
+	return overrides
+}
+
+// registerStations 按配置注册内置工站以及 stations 中配置了远程地址的其他工站，返回需要做健康检查的远程工站
+// replayer 不为 nil 时所有工站都返回录制的结果，没有需要做健康检查的远程工站
+func registerStations(wf *engine.WorkflowEngine, logger *slog.Logger, cfg *config.Config, replayer *replay.Replayer) ([]station.Remote, error) {
+	var extra []types.StationID
+	for id, sc := range cfg.Stations {
+		if sc.Endpoint != "" && !slices.Contains(types.BuiltinStations, id) {
+			extra = append(extra, id)
+		}
+	}
+	slices.Sort(extra)
+	ids := append(slices.Clone(types.BuiltinStations), extra...)
+
+	var remotes []station.Remote
+	for _, id := range ids {
+		if replayer != nil {
+			wf.RegisterStation(replayer.Station(id))
+			continue
+		}
+		sc := cfg.Stations[id]
+		if sc.Endpoint != "" {
+			opts, err := remoteOptions(sc)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", id, err)
+			}
+			remote, err := station.NewRemote(id, sc.Endpoint, opts, logger)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", id, err)
+			}
+			remote.SetProvenance(provenance(sc))
+			wf.RegisterStation(remote)
+			remotes = append(remotes, remote)
+			continue
+		}
+		delayMs := cfg.StationDelayMs
+		if sc.DelayMs > 0 {
+			delayMs = sc.DelayMs
+		}
+		local := station.NewStation(id, logger, delayMs, sc.FailureRate)
+		local.SetMeasurements(sc.Measurements)
+		local.SetProvenance(provenance(sc))
+		wf.RegisterStation(local)
+	}
+	return remotes, nil
+}
 
-	fs := http.FileServer(http.Dir("./web/static"))
-	mux.Handle("/", fs)
+// provenance 返回工站配置中声明的追溯信息
+func provenance(sc config.StationConfig) types.Provenance {
+	return types.Provenance{Machine: sc.Machine, Firmware: sc.Firmware, Materials: sc.Materials}
+}
+
+// remoteOptions 将工站配置转换为远程工站的连接参数
+func remoteOptions(sc config.StationConfig) (station.RemoteOptions, error) {
+	opts := station.RemoteOptions{
+		Timeout:      time.Duration(sc.TimeoutMs) * time.Millisecond,
+		MaxAttempts:  sc.Retry.MaxAttempts,
+		Backoff:      time.Duration(sc.Retry.BackoffMs) * time.Millisecond,
+		BearerToken:  sc.Auth.BearerToken,
+		Username:     sc.Auth.Username,
+		Password:     sc.Auth.Password,
+		Async:        sc.Async,
+		PollInterval: time.Duration(sc.PollIntervalMs) * time.Millisecond,
+	}
+	if sc.TLS.Enabled() {
+		tlsConfig, err := sc.TLS.Load()
+		if err != nil {
+			return station.RemoteOptions{}, err
+		}
+		opts.TLS = tlsConfig
+	}
+	return opts, nil
+}
 
-	logger.Info("API 和前端服务器启动在 :8080")
-	if err := http.ListenAndServe(":8080", mux); err != nil {
+// startAPIServer 启动 API 和 Web 服务器
+func startAPIServer(server *http.Server, logger *slog.Logger) {
+	logger.Info("API 和前端服务器启动", "addr", server.Addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		logger.Error("API 服务器启动失败", "error", err)
 	}
 }
 
-// waitForShutdown 等待系统信号以实现优雅停机
-func waitForShutdown(logger *slog.Logger, cancel context.CancelFunc, scheduler *engine.Scheduler) {
+// startGRPCServer 启动 gRPC 服务
+func startGRPCServer(server *grpc.Server, addr string, logger *slog.Logger) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		logger.Error("gRPC 服务监听失败", "addr", addr, "error", err)
+		return
+	}
+	logger.Info("gRPC 服务启动", "addr", addr)
+	if err := server.Serve(lis); err != nil {
+		logger.Error("gRPC 服务异常退出", "error", err)
+	}
+}
+
+// waitForShutdown 等待系统信号或 ctx 被取消 (例如失去集群领导权) 以实现优雅停机
+// 先停止调度，再停止接收新请求并等待进行中的请求完成，最后等待在途任务结束
+// HTTP 停机时 Hub 随之关闭，gRPC 的状态订阅流因此结束，不会阻塞 gRPC 的优雅停机
+func waitForShutdown(ctx context.Context, logger *slog.Logger, cancel context.CancelFunc, scheduler *engine.Scheduler, server *http.Server, grpcServer *grpc.Server, shutdownTimeout time.Duration) {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
-	logger.Info("接收到停机信号，正在优雅关闭...")
+	select {
+	case <-sigChan:
+		logger.Info("接收到停机信号，正在优雅关闭...")
+	case <-ctx.Done():
+		logger.Info("正在优雅关闭...")
+	}
 	cancel()
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("API 服务器未能在超时内完成关闭", "error", err)
+	}
+	if grpcServer != nil {
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-shutdownCtx.Done():
+			logger.Warn("gRPC 服务未能在超时内完成关闭，强制断开连接")
+			grpcServer.Stop()
+		}
+	}
+
 	scheduler.WaitForCompletion()
 	logger.Info("生产演示结束，系统已安全退出。")
 }
@@ -1,93 +1,193 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"industrial-4.0-demo/internal/config"
+	"industrial-4.0-demo/internal/stationsim"
 	"log/slog"
-	"math/rand"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
-// Request 定义了远程服务接收的请求体
-type Request struct {
-	ID string `json:"id"`
-}
+// main 是远程工站模拟服务的入口，模拟的工站及其耗时、失败率等行为在配置文件的 station_server 段中定义
+func main() {
+	// 命令行参数优先于环境变量和配置文件
+	configPath := flag.String("config", "", "配置文件路径，默认使用 "+config.PathEnv+" 环境变量或工作目录下的 config.yaml")
+	profile := flag.String("profile", "", "配置集: "+strings.Join(config.Profiles(), " / ")+" (profile)")
+	addr := flag.String("addr", os.Getenv("LISTEN_ADDR"), "监听地址 (station_server.addr，兼容 LISTEN_ADDR)")
+	grpcAddr := flag.String("grpc-addr", os.Getenv("GRPC_LISTEN_ADDR"), "gRPC 监听地址，为空时不提供 gRPC 协议 (station_server.grpc_addr，兼容 GRPC_LISTEN_ADDR)")
+	logFormat := flag.String("log-format", os.Getenv("LOG_FORMAT"), "日志格式: json / text (logging.format，兼容 LOG_FORMAT)")
+	// 同时指定证书和私钥时以 HTTPS 提供服务
+	certFile := flag.String("tls-cert", os.Getenv("TLS_CERT_FILE"), "TLS 证书文件 (TLS_CERT_FILE)")
+	keyFile := flag.String("tls-key", os.Getenv("TLS_KEY_FILE"), "TLS 私钥文件 (TLS_KEY_FILE)")
+	hostname, _ := os.Hostname()
+	machine := flag.String("machine", envOr("MACHINE_ID", hostname), "没有配置 machine 的工站使用的设备实例 (资产编号)，默认为主机名 (MACHINE_ID)")
+	flag.Parse()
 
-// Response 定义了远程服务返回的响应体
-type Response struct {
-	ProductID string `json:"product_id"`
-	Success   bool   `json:"success"`
-	Error     string `json:"error,omitempty"`
-}
+	overrides := config.Overrides{}
+	if *profile != "" {
+		overrides["profile"] = *profile
+	}
+	if *addr != "" {
+		overrides["station_server.addr"] = *addr
+	}
+	if *grpcAddr != "" {
+		overrides["station_server.grpc_addr"] = *grpcAddr
+	}
+	if *logFormat != "" {
+		overrides["logging.format"] = *logFormat
+	}
+	cfg, err := config.LoadConfig(*configPath, overrides)
+	if err != nil {
+		slog.Error("加载配置失败", "error", err)
+		os.Exit(1)
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
-// main 是远程工站服务的入口
-func main() {
-	port := ":9090"
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil)).With("service", "remote-station")
+	var handler slog.Handler = slog.NewJSONHandler(os.Stdout, nil)
+	if cfg.Logging.Format == config.LogFormatText {
+		handler = slog.NewTextHandler(os.Stdout, nil)
+	}
+	logger := slog.New(handler).With("service", "remote-station")
 	slog.SetDefault(logger)
 
-	logger.Info("=== 远程工站服务 (AOI) 启动 ===", "port", port)
+	opts := cfg.StationServer
+	if len(opts.Stations) == 0 {
+		fmt.Fprintln(os.Stderr, "station_server.stations 中没有需要模拟的工站")
+		os.Exit(2)
+	}
+	// 设置 AUTH_TOKEN 后加工和补偿请求需要携带 Authorization: Bearer <AUTH_TOKEN>，令牌不通过命令行传入，避免出现在进程列表中
+	token := os.Getenv("AUTH_TOKEN")
+	server := stationsim.New(opts, *machine, token, logger)
+	// 恢复上次停机前保存的作业，编排器可以继续查询，未完成的作业重新加工
+	restored, err := server.Restore()
+	if err != nil {
+		logger.Error("恢复作业失败", "path", opts.StateFile, "error", err)
+		os.Exit(1)
+	}
+	if restored.Jobs > 0 {
+		logger.Info("已恢复作业", "path", opts.StateFile, "jobs", restored.Jobs, "resumed", restored.Resumed, "callbacks", restored.Callbacks)
+	}
 
-	// 注册 HTTP 处理函数
-	http.HandleFunc("/execute", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-		var req Request
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			logger.Warn("解析请求失败", "error", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
+	ids := make([]string, 0, len(opts.Stations))
+	for _, info := range server.Stations() {
+		ids = append(ids, string(info.ID))
+	}
+	logger.Info("=== 远程工站模拟服务启动 ===", "addr", opts.Addr, "grpc_addr", opts.GRPCAddr, "stations", ids, "default_station", opts.DefaultStation,
+		"auth", token != "", "tls", *certFile != "")
 
-		// 从 HTTP Header 中提取 Trace ID，用于链路追踪
-		traceID := r.Header.Get("X-Trace-ID")
-		taskLogger := logger.With("product_id", req.ID)
-		if traceID != "" {
-			taskLogger = taskLogger.With("trace_id", traceID)
+	// 每个监听地址一个 HTTP 服务，任意一个异常退出时整个进程退出
+	errs := make(chan error, len(opts.Stations)+2)
+	var servers []*http.Server
+	serve := func(addr string, h http.Handler) {
+		srv := &http.Server{Addr: addr, Handler: h}
+		servers = append(servers, srv)
+		go func() {
+			var err error
+			if *certFile != "" && *keyFile != "" {
+				err = srv.ListenAndServeTLS(*certFile, *keyFile)
+			} else {
+				err = srv.ListenAndServe()
+			}
+			if !errors.Is(err, http.ErrServerClosed) {
+				errs <- fmt.Errorf("%s: %w", addr, err)
+			}
+		}()
+	}
+	serve(opts.Addr, server.Handler())
+	for _, info := range server.Stations() {
+		if info.Profile.Addr != "" {
+			logger.Info("工站单独监听", "station_id", info.ID, "addr", info.Profile.Addr)
+			serve(info.Profile.Addr, server.StationHandler(info.ID))
 		}
+	}
 
-		taskLogger.Info("接收到任务")
-
-		// 模拟远程处理耗时：大幅增加到 12-18 秒
-		processTime := time.Duration(rand.Intn(5000)+1000) * time.Millisecond
-		time.Sleep(processTime)
-
-		// 模拟随机失败
-		success := true
-		errMsg := ""
-		if rand.Float32() < 0.1 { // 10% 概率失败
-			success = false
-			errMsg = "远程设备故障 (AOI 检测发现缺陷)"
-			taskLogger.Warn("任务失败", "error", errMsg)
-		} else {
-			taskLogger.Info("任务完成", "duration", processTime.Seconds())
+	// 配置了 gRPC 监听地址时以 gRPC 协议提供所有工站，与 HTTP 使用相同的证书
+	var grpcServer *grpc.Server
+	if opts.GRPCAddr != "" {
+		var grpcOpts []grpc.ServerOption
+		if *certFile != "" && *keyFile != "" {
+			creds, err := credentials.NewServerTLSFromFile(*certFile, *keyFile)
+			if err != nil {
+				logger.Error("加载 TLS 证书失败", "error", err)
+				os.Exit(1)
+			}
+			grpcOpts = append(grpcOpts, grpc.Creds(creds))
 		}
-
-		resp := Response{ProductID: req.ID, Success: success, Error: errMsg}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(resp)
-	})
-
-	http.HandleFunc("/compensate", func(w http.ResponseWriter, r *http.Request) {
-		var req Request
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			return
+		grpcServer = grpc.NewServer(grpcOpts...)
+		server.RegisterGRPC(grpcServer)
+		lis, err := net.Listen("tcp", opts.GRPCAddr)
+		if err != nil {
+			logger.Error("gRPC 服务监听失败", "addr", opts.GRPCAddr, "error", err)
+			os.Exit(1)
 		}
+		go func() {
+			if err := grpcServer.Serve(lis); err != nil {
+				errs <- fmt.Errorf("%s: %w", opts.GRPCAddr, err)
+			}
+		}()
+	}
 
-		traceID := r.Header.Get("X-Trace-ID")
-		compLogger := logger.With("product_id", req.ID)
-		if traceID != "" {
-			compLogger = compLogger.With("trace_id", traceID)
-		}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	select {
+	case err := <-errs:
+		logger.Error("服务启动失败", "error", err)
+		os.Exit(1)
+	case <-ctx.Done():
+	}
 
-		compLogger.Warn("执行补偿")
-		time.Sleep(3000 * time.Millisecond) // 补偿延时增加到 3 秒
-	})
+	// 停机：拒绝新的加工请求，等待进行中的加工和回调结束，超时的作业保存为进行中，重启后恢复；
+	// 等待期间继续提供作业查询，最后关闭 HTTP 和 gRPC 服务
+	logger.Info("接收到停机信号，等待进行中的作业结束", "timeout_seconds", opts.ShutdownTimeoutSeconds)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(opts.ShutdownTimeoutSeconds)*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("停机超时，未完成的作业已保存", "path", opts.StateFile, "error", err)
+	}
+	httpCtx, cancelHTTP := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelHTTP()
+	for _, srv := range servers {
+		srv.Shutdown(httpCtx)
+	}
+	if grpcServer != nil {
+		stopGRPC(httpCtx, grpcServer)
+	}
+	logger.Info("远程工站模拟服务已退出")
+}
 
-	if err := http.ListenAndServe(port, nil); err != nil {
-		logger.Error("服务启动失败", "error", err)
+// stopGRPC 优雅停止 gRPC 服务，ctx 结束时强制关闭仍未结束的调用
+func stopGRPC(ctx context.Context, server *grpc.Server) {
+	done := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		server.Stop()
+	}
+}
+
+// envOr 返回环境变量的值，未设置时返回 fallback
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
 	}
+	return fallback
 }
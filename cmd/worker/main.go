@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"industrial-4.0-demo/internal/calendar"
+	"industrial-4.0-demo/internal/config"
+	"industrial-4.0-demo/internal/costing"
+	"industrial-4.0-demo/internal/engine"
+	"industrial-4.0-demo/internal/event"
+	"industrial-4.0-demo/internal/logging"
+	"industrial-4.0-demo/internal/reload"
+	"industrial-4.0-demo/internal/station"
+	"industrial-4.0-demo/internal/types"
+	"industrial-4.0-demo/internal/workqueue"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// flagKeys 是命令行参数对应的配置项
+var flagKeys = map[string]string{
+	"profile":     "profile",
+	"url":         "queue.url",
+	"id":          "queue.worker_id",
+	"concurrency": "queue.concurrency",
+	"log-format":  "logging.format",
+	"log-level":   "logging.level",
+}
+
+// main 是 worker 进程的入口：从共享工作队列 (编排器的 HTTP API 或 Redis Streams) 拉取任务，用与编排器相同的工作流和工站配置执行
+func main() {
+	configPath := flag.String("config", "", "配置文件路径，默认使用 "+config.PathEnv+" 环境变量或工作目录下的 config.yaml")
+	flag.String("profile", "", "配置集: "+strings.Join(config.Profiles(), " / ")+" (profile)")
+	flag.String("url", "", "编排器地址 (queue.url)")
+	flag.String("id", "", "worker ID，默认为主机名和进程号 (queue.worker_id)")
+	flag.Int("concurrency", 0, "同时执行的任务数 (queue.concurrency)")
+	flag.String("log-format", "", "日志格式: json / text (logging.format)")
+	flag.String("log-level", "", "日志级别: debug / info / warn / error (logging.level)")
+	flag.Parse()
+
+	overrides := flagOverrides()
+	// worker 总是工作在队列模式，按队列模式校验 queue 配置
+	overrides["queue.enabled"] = true
+	cfg, err := config.LoadConfig(*configPath, overrides)
+	if err != nil {
+		slog.Error("加载配置失败", "error", err)
+		os.Exit(1)
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	var handler slog.Handler = slog.NewJSONHandler(os.Stdout, nil)
+	if cfg.Logging.Format == config.LogFormatText {
+		handler = slog.NewTextHandler(os.Stdout, nil)
+	}
+	logLevels := logging.New(handler, slog.LevelInfo)
+	logger := logLevels.Logger("")
+	slog.SetDefault(logger)
+	if err := logLevels.Update(cfg.Logging.Level, cfg.Logging.Components); err != nil {
+		logger.Error("日志级别配置无效", "error", err)
+		os.Exit(1)
+	}
+	logger.Info("配置已加载", "profile", cfg.Profile, "file", cfg.File())
+
+	// 事件只转发给编排器，由编排器更新看板、指标和履历
+	eventBus := event.NewBus()
+	wf := engine.NewWorkflowEngine(cfg.Workflows, cfg.ResourcePools, cfg.Lifecycles, logLevels.Logger(logging.ComponentEngine), eventBus, cfg.StepDelayMs)
+	if err := wf.Workflows().SetFallback(cfg.DefaultWorkflow); err != nil {
+		logger.Error("无法设置默认工作流", "error", err)
+		os.Exit(1)
+	}
+	wf.Workflows().SetStrict(cfg.StrictProductTypes)
+	cal, err := calendar.New(cfg.Calendar)
+	if err != nil {
+		logger.Error("无法解析日历", "error", err)
+		os.Exit(1)
+	}
+	wf.Stations().SetCalendar(cal)
+	if len(cfg.Operators.Roster) > 0 {
+		operators := engine.NewOperatorPool(reload.Operators(cfg), cfg.Operators.Skills, eventBus)
+		operators.SetCalendar(cal)
+		wf.SetOperators(operators)
+	}
+	// 序列号由编排器在发布任务时分配，worker 不再分配
+	costModel, err := costing.New(cfg.Costing)
+	if err != nil {
+		logger.Error("无法解析成本参数", "error", err)
+		os.Exit(1)
+	}
+	wf.SetCosting(costModel)
+	wf.Stations().SetWIPLimits(cfg.WIPLimits)
+	if err := registerStations(wf, logLevels.Logger(logging.ComponentStation), cfg); err != nil {
+		logger.Error("无法注册远程工站", "error", err)
+		os.Exit(1)
+	}
+
+	id := cfg.Queue.WorkerID
+	if id == "" {
+		host, _ := os.Hostname()
+		id = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	var client workqueue.Broker
+	if cfg.Queue.Backend == workqueue.BackendRedis {
+		streams := workqueue.NewStreamClient(cfg.Queue, id)
+		defer streams.Close()
+		client = streams
+	} else {
+		client = workqueue.NewClient(cfg.Queue.URL, cfg.Queue.APIKey, id)
+	}
+	worker := workqueue.NewWorker(client, wf, eventBus, cfg.Queue.Concurrency, logger)
+
+	// 收到停机信号后不再拉取新任务，执行中的任务结束并确认后退出；
+	// 超过确认期限仍未结束的任务由编排器重新投递给其他 worker
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	worker.Run(ctx)
+}
+
+// flagOverrides 返回命令行中显式指定的参数对应的配置项
+func flagOverrides() config.Overrides {
+	overrides := config.Overrides{}
+	flag.Visit(func(f *flag.Flag) {
+		if key, ok := flagKeys[f.Name]; ok {
+			overrides[key] = f.Value.(flag.Getter).Get()
+		}
+	})
+	return overrides
+}
+
+// registerStations 按配置注册内置工站以及 stations 中配置了远程地址的其他工站，与编排器的工站一致
+func registerStations(wf *engine.WorkflowEngine, logger *slog.Logger, cfg *config.Config) error {
+	var extra []types.StationID
+	for id, sc := range cfg.Stations {
+		if sc.Endpoint != "" && !slices.Contains(types.BuiltinStations, id) {
+			extra = append(extra, id)
+		}
+	}
+	slices.Sort(extra)
+	for _, id := range append(slices.Clone(types.BuiltinStations), extra...) {
+		sc := cfg.Stations[id]
+		provenance := types.Provenance{Machine: sc.Machine, Firmware: sc.Firmware, Materials: sc.Materials}
+		if sc.Endpoint != "" {
+			opts := station.RemoteOptions{
+				Timeout:      time.Duration(sc.TimeoutMs) * time.Millisecond,
+				MaxAttempts:  sc.Retry.MaxAttempts,
+				Backoff:      time.Duration(sc.Retry.BackoffMs) * time.Millisecond,
+				BearerToken:  sc.Auth.BearerToken,
+				Username:     sc.Auth.Username,
+				Password:     sc.Auth.Password,
+				Async:        sc.Async,
+				PollInterval: time.Duration(sc.PollIntervalMs) * time.Millisecond,
+			}
+			if sc.TLS.Enabled() {
+				tlsConfig, err := sc.TLS.Load()
+				if err != nil {
+					return fmt.Errorf("%s: %w", id, err)
+				}
+				opts.TLS = tlsConfig
+			}
+			remote, err := station.NewRemote(id, sc.Endpoint, opts, logger)
+			if err != nil {
+				return fmt.Errorf("%s: %w", id, err)
+			}
+			remote.SetProvenance(provenance)
+			wf.RegisterStation(remote)
+			continue
+		}
+		delayMs := cfg.StationDelayMs
+		if sc.DelayMs > 0 {
+			delayMs = sc.DelayMs
+		}
+		local := station.NewStation(id, logger, delayMs, sc.FailureRate)
+		local.SetMeasurements(sc.Measurements)
+		local.SetProvenance(provenance)
+		wf.RegisterStation(local)
+	}
+	return nil
+}
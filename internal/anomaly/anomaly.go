@@ -0,0 +1,96 @@
+// Package anomaly 按工站维护步骤耗时的指数加权均值和方差 (EWMA)，耗时偏离基线超过设定的 z-score 时发布 StationAnomaly 事件
+// 钻孔等工站的节拍逐渐变慢是预测性维护的典型信号：基线随样本缓慢更新，突变或持续漂移的初期会被标记
+package anomaly
+
+import (
+	"industrial-4.0-demo/internal/event"
+	"industrial-4.0-demo/internal/metrics"
+	"industrial-4.0-demo/internal/types"
+	"math"
+	"sync"
+)
+
+// baseline 是一个工站步骤耗时的 EWMA 基线
+type baseline struct {
+	samples  int
+	mean     float64
+	variance float64
+}
+
+// Detector 订阅步骤完成事件，按工站检测耗时异常
+type Detector struct {
+	mu        sync.Mutex
+	alpha     float64 // EWMA 的平滑系数，越大基线跟随新样本越快
+	threshold float64 // 判定异常的 z-score 绝对值
+	warmup    int     // 基线积累的样本数达到该值后才开始检测
+	stations  map[types.StationID]*baseline
+	metrics   *metrics.Metrics
+}
+
+// NewDetector 创建一个异常检测器
+// alpha 是 EWMA 的平滑系数 (0 ~ 1)；threshold 是判定异常的 z-score；warmup 是开始检测前每个工站需要积累的样本数
+func NewDetector(alpha, threshold float64, warmup int, m *metrics.Metrics) *Detector {
+	return &Detector{
+		alpha:     alpha,
+		threshold: threshold,
+		warmup:    warmup,
+		stations:  make(map[types.StationID]*baseline),
+		metrics:   m,
+	}
+}
+
+// Register 订阅步骤完成事件，检测到异常时在同一事件总线上发布 StationAnomaly 事件
+// 只使用加工成功的步骤，失败步骤的耗时 (例如远程调用超时) 不代表工站的节拍
+func (d *Detector) Register(bus *event.Bus) {
+	bus.Subscribe(event.StepCompleted, func(e event.Event) {
+		duration, ok := e.Product.Attrs["duration"].(float64)
+		if !ok || e.Error != nil {
+			return
+		}
+		if a := d.observe(e.StationID, duration); a != nil {
+			bus.Publish(event.Event{
+				Type:      event.StationAnomaly,
+				ProductID: e.ProductID,
+				Product:   e.Product,
+				StationID: e.StationID,
+				Step:      e.Step,
+				TraceID:   e.TraceID,
+				Timestamp: e.Timestamp,
+				Anomaly:   a,
+			})
+		}
+	})
+}
+
+// observe 用一个样本检测并更新工站的基线，偏离超过阈值时返回异常，否则返回 nil
+// 异常样本同样计入基线，持续的漂移会逐渐成为新的基线
+func (d *Detector) observe(id types.StationID, duration float64) *event.Anomaly {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	b, ok := d.stations[id]
+	if !ok {
+		b = &baseline{mean: duration}
+		d.stations[id] = b
+	}
+
+	var anomaly *event.Anomaly
+	if stddev := math.Sqrt(b.variance); b.samples >= d.warmup && stddev > 0 {
+		z := (duration - b.mean) / stddev
+		d.metrics.StationStepDurationZScore.WithLabelValues(string(id)).Set(z)
+		if math.Abs(z) >= d.threshold {
+			anomaly = &event.Anomaly{DurationSeconds: duration, MeanSeconds: b.mean, StdDevSeconds: stddev, ZScore: z}
+			direction := "slow"
+			if z < 0 {
+				direction = "fast"
+			}
+			d.metrics.StationAnomaliesTotal.WithLabelValues(string(id), direction).Inc()
+		}
+	}
+
+	diff := duration - b.mean
+	incr := d.alpha * diff
+	b.mean += incr
+	b.variance = (1 - d.alpha) * (b.variance + diff*incr)
+	b.samples++
+	return anomaly
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"industrial-4.0-demo/internal/audit"
+	"industrial-4.0-demo/internal/engine"
+	"industrial-4.0-demo/internal/planner"
+	"net/http"
+	"time"
+)
+
+// defaultDrainTimeout 是排空接口默认的最长等待时间
+const defaultDrainTimeout = 30 * time.Second
+
+// workersRequest 是调整 worker 数量接口的请求体
+type workersRequest struct {
+	MaxWorkers int `json:"max_workers"`
+}
+
+// handleSchedulerState 返回调度器的运行状态、队列和 worker 占用
+func (s *Server) handleSchedulerState(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.scheduler.State().Scoped(scopeOf(r)))
+}
+
+// handlePauseScheduler 暂停出队
+func (s *Server) handlePauseScheduler(w http.ResponseWriter, r *http.Request) {
+	before := s.scheduler.State()
+	s.scheduler.Pause()
+	after := s.scheduler.State()
+	s.audit(r, audit.ActionSchedulerPause, "scheduler", "", schedulerSnapshot(before), schedulerSnapshot(after))
+	writeJSON(w, http.StatusOK, after)
+}
+
+// handleResumeScheduler 恢复出队
+func (s *Server) handleResumeScheduler(w http.ResponseWriter, r *http.Request) {
+	before := s.scheduler.State()
+	s.scheduler.Resume()
+	after := s.scheduler.State()
+	s.audit(r, audit.ActionSchedulerResume, "scheduler", "", schedulerSnapshot(before), schedulerSnapshot(after))
+	writeJSON(w, http.StatusOK, after)
+}
+
+// handleDrainScheduler 暂停出队并等待执行中的任务结束，可通过 ?timeout= 指定最长等待时间
+// 超时返回 202，调度器继续排空
+func (s *Server) handleDrainScheduler(w http.ResponseWriter, r *http.Request) {
+	timeout := defaultDrainTimeout
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "invalid timeout", http.StatusBadRequest)
+			return
+		}
+		timeout = d
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	before := s.scheduler.State()
+	status := http.StatusOK
+	if err := s.scheduler.Drain(ctx); err != nil {
+		status = http.StatusAccepted
+	}
+	after := s.scheduler.State()
+	s.audit(r, audit.ActionSchedulerDrain, "scheduler", "", schedulerSnapshot(before), schedulerSnapshot(after))
+	writeJSON(w, status, after)
+}
+
+// handleSetWorkers 调整 worker 池大小
+func (s *Server) handleSetWorkers(w http.ResponseWriter, r *http.Request) {
+	var req workersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	before := s.scheduler.State()
+	if err := s.scheduler.SetMaxWorkers(req.MaxWorkers); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	after := s.scheduler.State()
+	s.audit(r, audit.ActionSchedulerWorkers, "scheduler", "", schedulerSnapshot(before), schedulerSnapshot(after))
+	writeJSON(w, http.StatusOK, after)
+}
+
+// planResponse 是生成派工计划接口的响应
+type planResponse struct {
+	planner.Plan
+	DryRun  bool `json:"dry_run"` // 只生成计划，未切换出队方式
+	Applied int  `json:"applied"` // 按计划出队的任务数
+}
+
+// handleGetPlan 返回正在执行的派工计划
+func (s *Server) handleGetPlan(w http.ResponseWriter, r *http.Request) {
+	plan, err := s.scheduler.CurrentPlan()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, plan)
+}
+
+// handleCreatePlan 按当前队列生成派工计划并切换为按计划出队，?dry_run=true 时只返回计划
+func (s *Server) handleCreatePlan(w http.ResponseWriter, r *http.Request) {
+	resp := planResponse{Plan: s.scheduler.Plan(), DryRun: r.URL.Query().Get("dry_run") == "true"}
+	if !resp.DryRun {
+		before := s.scheduler.State()
+		resp.Applied = s.scheduler.ApplyPlan(resp.Plan)
+		after := s.scheduler.State()
+		s.audit(r, audit.ActionSchedulerPlan, "scheduler", "", schedulerSnapshot(before), schedulerSnapshot(after))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleClearPlan 放弃正在执行的派工计划，恢复按优先级出队
+func (s *Server) handleClearPlan(w http.ResponseWriter, r *http.Request) {
+	before := s.scheduler.State()
+	s.scheduler.ClearPlan()
+	after := s.scheduler.State()
+	s.audit(r, audit.ActionSchedulerPlan, "scheduler", "", schedulerSnapshot(before), schedulerSnapshot(after))
+	writeJSON(w, http.StatusOK, after)
+}
+
+// handleFlushWAL 将 WAL 刷新到磁盘
+func (s *Server) handleFlushWAL(w http.ResponseWriter, r *http.Request) {
+	if err := s.scheduler.FlushWAL(); err != nil {
+		writeWALError(w, err)
+		return
+	}
+	s.audit(r, audit.ActionWALFlush, "wal", "", nil, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleCompactWAL 压缩 WAL，只保留尚未结束的任务
+func (s *Server) handleCompactWAL(w http.ResponseWriter, r *http.Request) {
+	result, err := s.scheduler.CompactWAL()
+	if err != nil {
+		writeWALError(w, err)
+		return
+	}
+	s.audit(r, audit.ActionWALCompact, "wal", "", nil, result)
+	writeJSON(w, http.StatusOK, result)
+}
+
+// writeWALError 将 WAL 操作的错误映射为 HTTP 状态码
+func writeWALError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, engine.ErrWALDisabled) {
+		status = http.StatusConflict
+	}
+	http.Error(w, err.Error(), status)
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"industrial-4.0-demo/internal/audit"
+	"industrial-4.0-demo/internal/auth"
+	"industrial-4.0-demo/internal/fsm"
+	"industrial-4.0-demo/internal/web"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// assignAlertRequest 是指派告警的请求体
+type assignAlertRequest struct {
+	Assignee string `json:"assignee"` // 为空时指派给调用方自己
+}
+
+// resolveAlertRequest 是解决告警的请求体，可以省略
+type resolveAlertRequest struct {
+	Resolution string `json:"resolution"`
+}
+
+// visibleAlert 判断调用方能否看到告警：工站和队列告警属于整个车间，工件告警按工件的命名空间判断
+func visibleAlert(r *http.Request, a web.Alert) bool {
+	return a.Namespace == "" || canAccess(r, a.Namespace)
+}
+
+// caller 返回调用方的名称，未启用认证时为空
+func caller(r *http.Request) string {
+	if p, ok := auth.PrincipalFromContext(r.Context()); ok {
+		return p.Subject
+	}
+	return ""
+}
+
+// handleListAlerts 返回安灯板上保留的告警，最新的在前
+// ?unacked=true 时只返回未确认的告警，?state= 按处理状态过滤，?assignee= 按负责人过滤
+func (s *Server) handleListAlerts(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	unacked := q.Get("unacked") == "true"
+	state := fsm.AlertState(strings.ToUpper(q.Get("state")))
+	switch state {
+	case "", fsm.AlertOpen, fsm.AlertAcknowledged, fsm.AlertResolved:
+	default:
+		http.Error(w, "invalid state", http.StatusBadRequest)
+		return
+	}
+	assignee := q.Get("assignee")
+	alerts := []web.Alert{}
+	for _, a := range s.stateTracker.Alerts() {
+		switch {
+		case !visibleAlert(r, a), unacked && a.Acked(), state != "" && a.State != state, assignee != "" && a.Assignee != assignee:
+			continue
+		}
+		alerts = append(alerts, a)
+	}
+	writeJSON(w, http.StatusOK, alerts)
+}
+
+// writeAlertError 将告警操作的错误写入响应：不存在返回 404，状态不允许返回 409
+func writeAlertError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, web.ErrAlertNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, web.ErrAlertTransition):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleAckAlert 确认一条告警，确认结果推送给所有看板；重复确认返回第一次确认的结果
+func (s *Server) handleAckAlert(w http.ResponseWriter, r *http.Request) {
+	by := caller(r)
+	alert, err := s.stateTracker.AckAlert(r.PathValue("id"), by, func(a web.Alert) bool { return visibleAlert(r, a) })
+	if err != nil {
+		writeAlertError(w, err)
+		return
+	}
+	s.logger.Info("告警已确认", "alert_id", alert.ID, "kind", alert.Kind, "acked_by", by)
+	s.audit(r, audit.ActionAlertAck, alert.ID, alert.Namespace, nil, alert)
+	writeJSON(w, http.StatusOK, alert)
+}
+
+// handleAssignAlert 将未解决的告警指派给负责人，已解决的告警返回 409
+func (s *Server) handleAssignAlert(w http.ResponseWriter, r *http.Request) {
+	var req assignAlertRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeDecodeError(w, err)
+		return
+	}
+	assignee := strings.TrimSpace(req.Assignee)
+	if assignee == "" {
+		assignee = caller(r)
+	}
+	if assignee == "" {
+		http.Error(w, "assignee is required", http.StatusBadRequest)
+		return
+	}
+	alert, err := s.stateTracker.AssignAlert(r.PathValue("id"), assignee, func(a web.Alert) bool { return visibleAlert(r, a) })
+	if err != nil {
+		writeAlertError(w, err)
+		return
+	}
+	s.logger.Info("告警已指派", "alert_id", alert.ID, "kind", alert.Kind, "assignee", assignee)
+	s.audit(r, audit.ActionAlertAssign, alert.ID, alert.Namespace, nil, alert)
+	writeJSON(w, http.StatusOK, alert)
+}
+
+// handleResolveAlert 解决一条告警，未确认的告警也可以直接解决；重复解决返回第一次解决的结果
+func (s *Server) handleResolveAlert(w http.ResponseWriter, r *http.Request) {
+	var req resolveAlertRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeDecodeError(w, err)
+		return
+	}
+	by := caller(r)
+	alert, err := s.stateTracker.ResolveAlert(r.PathValue("id"), by, strings.TrimSpace(req.Resolution), func(a web.Alert) bool { return visibleAlert(r, a) })
+	if err != nil {
+		writeAlertError(w, err)
+		return
+	}
+	s.logger.Info("告警已解决", "alert_id", alert.ID, "kind", alert.Kind, "resolved_by", by)
+	s.audit(r, audit.ActionAlertResolve, alert.ID, alert.Namespace, nil, alert)
+	writeJSON(w, http.StatusOK, alert)
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"errors"
+	"industrial-4.0-demo/internal/audit"
+	"industrial-4.0-demo/internal/b2mml"
+	"net/http"
+)
+
+// SetB2MML 设置 B2MML 排产计划导入器，设置后注册 POST /api/v1/tasks/b2mml
+func (s *Server) SetB2MML(importer *b2mml.Importer) {
+	s.b2mml = importer
+}
+
+// handleImportB2MML 导入 B2MML ProductionSchedule (XML)，请求体或 multipart/form-data 的 file 字段为排产计划
+// 每个段需求转换为一个工件，数量大于 1 时拆分为批次；至少一个段需求通过校验时返回 202，否则返回 422
+// ?dry_run=true 时只校验不提交，?namespace= 指定命名空间
+func (s *Server) handleImportB2MML(w http.ResponseWriter, r *http.Request) {
+	namespace, err := resolveNamespace(r, r.URL.Query().Get("namespace"))
+	if err != nil {
+		writeNamespaceError(w, err)
+		return
+	}
+	data, _, _, err := readUpload(r)
+	if err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+	result, err := s.b2mml.Import(data, namespace, b2mml.SourceHTTP, dryRun)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, b2mml.ErrNotSchedule) {
+			status = http.StatusUnprocessableEntity
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if len(result.Accepted) == 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, result)
+		return
+	}
+	if !dryRun {
+		s.audit(r, audit.ActionTaskImport, result.ScheduleID, namespace, nil, result)
+	}
+	writeJSON(w, http.StatusAccepted, result)
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"industrial-4.0-demo/internal/audit"
+	"industrial-4.0-demo/internal/chaos"
+	"net/http"
+	"time"
+)
+
+// SetChaos 设置故障注入器，设置后注册 /api/v1/chaos 接口
+func (s *Server) SetChaos(injector *chaos.Injector) {
+	s.chaos = injector
+}
+
+// handleListChaos 返回生效中的故障及其生效次数
+func (s *Server) handleListChaos(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.chaos.List())
+}
+
+// handleInjectChaos 注入一个限时的故障，返回 201 和故障；参数无效或工站不存在返回 400
+func (s *Server) handleInjectChaos(w http.ResponseWriter, r *http.Request) {
+	var spec chaos.Spec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	if err := spec.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, ok := s.scheduler.Engine().Stations().Get(spec.StationID); !ok {
+		http.Error(w, "unknown station: "+string(spec.StationID), http.StatusBadRequest)
+		return
+	}
+	fault, err := s.chaos.Inject(spec, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.audit(r, audit.ActionChaosInject, fault.ID, "", nil, fault)
+	writeJSON(w, http.StatusCreated, fault)
+}
+
+// handleRemoveChaos 提前结束一个故障；不存在或已到期返回 404
+func (s *Server) handleRemoveChaos(w http.ResponseWriter, r *http.Request) {
+	fault, err := s.chaos.Remove(r.PathValue("id"))
+	if errors.Is(err, chaos.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	s.audit(r, audit.ActionChaosRemove, fault.ID, "", fault, nil)
+	writeJSON(w, http.StatusOK, fault)
+}
+
+// handleClearChaos 结束所有故障，返回结束的故障
+func (s *Server) handleClearChaos(w http.ResponseWriter, r *http.Request) {
+	cleared := s.chaos.Clear()
+	s.audit(r, audit.ActionChaosRemove, "", "", cleared, nil)
+	writeJSON(w, http.StatusOK, cleared)
+}
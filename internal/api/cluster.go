@@ -0,0 +1,44 @@
+package api
+
+import (
+	"industrial-4.0-demo/internal/cluster"
+	"net/http"
+	"strings"
+)
+
+// SetCluster 设置集群选举者，设置后注册 GET /api/v1/cluster，跟随者把写请求重定向到领导者
+func (s *Server) SetCluster(elector *cluster.Elector) {
+	s.cluster = elector
+}
+
+// followerLocal 是跟随者自己处理的非只读方法的请求：只读的查询和仿真，以及只影响本节点的日志级别
+var followerLocal = map[string]bool{
+	"POST /api/v1/graphql":       true,
+	"POST /api/v1/whatif":        true,
+	"PUT /api/v1/admin/loglevel": true,
+}
+
+// handleClusterStatus 返回本节点的角色和当前领导者
+func (s *Server) handleClusterStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.cluster.Status())
+}
+
+// leaderOnly 在本节点是跟随者时以 307 把写请求重定向到领导者的 advertise_url，
+// 领导者未知 (选举中或没有配置 advertise_url) 时返回 503
+func (s *Server) leaderOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.cluster == nil || s.cluster.IsLeader() || r.Method == http.MethodGet || r.Method == http.MethodHead ||
+			r.Method == http.MethodOptions || followerLocal[r.Method+" "+r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		status := s.cluster.Status()
+		w.Header().Set("X-Cluster-Leader", status.Leader)
+		if status.LeaderURL == "" {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "this node is a cluster follower and the leader is unknown", http.StatusServiceUnavailable)
+			return
+		}
+		http.Redirect(w, r, strings.TrimSuffix(status.LeaderURL, "/")+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+	})
+}
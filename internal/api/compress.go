@@ -0,0 +1,157 @@
+package api
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// gzipMinSize 是启用压缩的最小响应大小，更小的响应压缩后收益有限
+const gzipMinSize = 1024
+
+// gzipWriterPool 复用 gzip.Writer，避免每个请求重新分配压缩缓冲区
+var gzipWriterPool = sync.Pool{
+	New: func() interface{} { return gzip.NewWriter(nil) },
+}
+
+// compress 对 JSON 和文本响应进行 gzip 压缩
+// WebSocket 升级请求直接透传；SSE 等流式响应、已编码的响应和小于 gzipMinSize 的响应不压缩
+func compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if r.Header.Get("Upgrade") != "" || !acceptsGzip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		defer gw.Close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip 判断客户端是否接受 gzip 编码
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, q, _ := strings.Cut(strings.TrimSpace(enc), ";")
+		if strings.EqualFold(strings.TrimSpace(name), "gzip") && strings.TrimSpace(q) != "q=0" {
+			return true
+		}
+	}
+	return false
+}
+
+// compressible 判断响应的内容类型是否值得压缩
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case mediaType == "text/event-stream":
+		// 流式响应需要逐条刷新，压缩会把消息缓冲在压缩器中
+		return false
+	case strings.HasPrefix(mediaType, "text/"), mediaType == "application/json", mediaType == "application/javascript":
+		return true
+	}
+	return false
+}
+
+// gzipResponseWriter 先缓冲响应的开头部分，确定内容类型和大小后再决定是否压缩
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	status  int
+	buf     []byte
+	decided bool         // 是否已经决定了是否压缩并写出了响应头
+	gz      *gzip.Writer // 为 nil 时表示不压缩
+}
+
+// WriteHeader 记录状态码，响应头在决定是否压缩后才写出
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if !w.decided {
+		w.status = status
+	}
+}
+
+// Write 缓冲响应体，直到足够判断是否压缩
+func (w *gzipResponseWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		h := w.Header()
+		if h.Get("Content-Type") == "" {
+			h.Set("Content-Type", http.DetectContentType(append(w.buf, p...)))
+		}
+		if !w.shouldCompress() {
+			w.decide(false)
+		} else {
+			w.buf = append(w.buf, p...)
+			if len(w.buf) < gzipMinSize {
+				return len(p), nil
+			}
+			w.decide(true)
+			return len(p), nil
+		}
+	}
+	if w.gz != nil {
+		return w.gz.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// shouldCompress 根据状态码和已设置的响应头判断是否可以压缩
+func (w *gzipResponseWriter) shouldCompress() bool {
+	h := w.Header()
+	if w.status < http.StatusOK || w.status == http.StatusNoContent || w.status == http.StatusNotModified || w.status == http.StatusPartialContent {
+		return false
+	}
+	return h.Get("Content-Encoding") == "" && h.Get("Content-Range") == "" && compressible(h.Get("Content-Type"))
+}
+
+// decide 写出响应头和已缓冲的内容，此后的写入直接进入压缩器或底层连接
+func (w *gzipResponseWriter) decide(useGzip bool) {
+	w.decided = true
+	if useGzip {
+		h := w.Header()
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		w.gz = gzipWriterPool.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	if len(w.buf) > 0 {
+		if w.gz != nil {
+			w.gz.Write(w.buf)
+		} else {
+			w.ResponseWriter.Write(w.buf)
+		}
+	}
+	w.buf = nil
+}
+
+// Flush 刷新已缓冲的内容，流式响应在第一次刷新时确定不压缩
+func (w *gzipResponseWriter) Flush() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap 返回底层的 ResponseWriter，供 http.ResponseController 设置写超时等操作
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Close 结束响应：未达到压缩阈值的响应原样写出，压缩器归还到池中
+func (w *gzipResponseWriter) Close() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.gz != nil {
+		w.gz.Close()
+		gzipWriterPool.Put(w.gz)
+		w.gz = nil
+	}
+}
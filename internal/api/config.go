@@ -0,0 +1,47 @@
+package api
+
+import (
+	"encoding/json"
+	"industrial-4.0-demo/internal/audit"
+	"industrial-4.0-demo/internal/reload"
+	"net/http"
+)
+
+// configPatchResponse 是修改配置接口的响应体
+type configPatchResponse struct {
+	Changes []reload.Change        `json:"changes"` // 实际发生变化的配置项
+	Config  map[string]interface{} `json:"config"`  // 修改后生效的配置 (已脱敏)
+}
+
+// SetReloader 设置配置重新加载器，设置后注册 /api/v1/admin/config
+func (s *Server) SetReloader(reloader *reload.Reloader) {
+	s.reloader = reloader
+}
+
+// handleGetConfig 返回当前生效的配置，密钥、令牌和密码已脱敏
+func (s *Server) handleGetConfig(w http.ResponseWriter, r *http.Request) {
+	cfg := s.reloader.Effective()
+	writeJSON(w, http.StatusOK, cfg.Redact())
+}
+
+// handlePatchConfig 修改模拟器参数、资源池容量和日志级别，立即生效，每个发生变化的配置项记录一条审计
+// 请求中包含其他配置项、或修改后的配置无效时返回 400 且不做任何修改
+func (s *Server) handlePatchConfig(w http.ResponseWriter, r *http.Request) {
+	var req reload.Patch
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	changes, err := s.reloader.Patch(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, c := range changes {
+		s.audit(r, audit.ActionConfigPatch, c.Key, "", c.Before, c.After)
+	}
+	cfg := s.reloader.Effective()
+	writeJSON(w, http.StatusOK, configPatchResponse{Changes: changes, Config: cfg.Redact()})
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"errors"
+	"industrial-4.0-demo/internal/defect"
+	"industrial-4.0-demo/internal/types"
+	"industrial-4.0-demo/internal/windowed"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SetDefects 设置缺陷追踪器，设置后注册 GET /api/v1/defects/summary
+func (s *Server) SetDefects(tracker *defect.Tracker) {
+	s.defects = tracker
+}
+
+// handleDefectSummary 返回统计窗口内按缺陷代码和类别排列的帕累托数据，可通过 ?window= 指定窗口 (默认 1 小时)，?station= 只统计该工站
+func (s *Server) handleDefectSummary(w http.ResponseWriter, r *http.Request) {
+	window, ok := reportWindow(r)
+	if !ok {
+		http.Error(w, "invalid window", http.StatusBadRequest)
+		return
+	}
+	station := types.StationID(strings.ToUpper(r.URL.Query().Get("station")))
+	summary, err := s.defects.Summary(window, time.Now(), station)
+	if errors.Is(err, windowed.ErrTooLarge) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, summary)
+}
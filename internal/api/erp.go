@@ -0,0 +1,33 @@
+package api
+
+import (
+	"industrial-4.0-demo/internal/audit"
+	"industrial-4.0-demo/internal/erp"
+	"net/http"
+)
+
+// SetERP 设置 ERP 订单适配器，设置后注册 GET /api/v1/integrations/erp 和 POST /api/v1/integrations/erp/poll
+func (s *Server) SetERP(adapter *erp.Adapter) {
+	s.erp = adapter
+}
+
+// handleERPStatus 返回 ERP 订单适配器的导入状态
+func (s *Server) handleERPStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.erp.Status())
+}
+
+// handleERPPoll 立即轮询一次 ERP 订单来源并返回导入状态，无法读取或解析订单时返回 502
+func (s *Server) handleERPPoll(w http.ResponseWriter, r *http.Request) {
+	before := s.erp.Status()
+	err := s.erp.Poll(r.Context())
+	status := s.erp.Status()
+	s.audit(r, audit.ActionERPPoll, status.Source, "", nil, map[string]int{
+		"submitted": status.Submitted - before.Submitted,
+		"rejected":  status.Rejected - before.Rejected,
+	})
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, status)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"industrial-4.0-demo/internal/audit"
+	"industrial-4.0-demo/internal/features"
+	"net/http"
+)
+
+// featureRequest 是切换功能开关接口的请求体
+type featureRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// SetFeatures 设置功能开关，设置后注册 /api/v1/admin/features
+func (s *Server) SetFeatures(flags *features.Flags) {
+	s.features = flags
+}
+
+// handleListFeatures 返回所有功能开关的当前状态
+func (s *Server) handleListFeatures(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.features.List())
+}
+
+// handleSetFeature 打开或关闭一个功能开关，立即生效，开关不存在时返回 404
+func (s *Server) handleSetFeature(w http.ResponseWriter, r *http.Request) {
+	var req featureRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	if req.Enabled == nil {
+		http.Error(w, "enabled is required", http.StatusBadRequest)
+		return
+	}
+	name := r.PathValue("name")
+	before := s.features.Enabled(name)
+	flag, err := s.features.Set(name, *req.Enabled)
+	if errors.Is(err, features.ErrUnknownFlag) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	s.logger.Info("已切换功能开关", "flag", flag.Name, "enabled", flag.Enabled)
+	s.audit(r, audit.ActionFeatureToggle, flag.Name, "", before, flag.Enabled)
+	writeJSON(w, http.StatusOK, flag)
+}
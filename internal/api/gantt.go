@@ -0,0 +1,28 @@
+package api
+
+import (
+	"industrial-4.0-demo/internal/gantt"
+	"net/http"
+	"time"
+)
+
+// handleGantt 返回以当前时间为中心、前后各一个统计窗口的甘特图，可通过 ?window= 指定窗口 (例如 8h)，默认 1 小时
+// 计划条取自正在执行的派工计划，没有计划时按当前出队顺序估算；实际条取自加工履历；只包含调用方可以访问的命名空间
+func (s *Server) handleGantt(w http.ResponseWriter, r *http.Request) {
+	window, ok := reportWindow(r)
+	if !ok {
+		http.Error(w, "invalid window", http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	plan, planned := s.scheduler.Forecast()
+	source := gantt.SourceForecast
+	if planned {
+		source = gantt.SourcePlan
+	}
+	records := s.history.Between(now.Add(-window), now)
+	chart := gantt.Build(plan, source, records, window, now, func(namespace string) bool {
+		return canAccess(r, namespace)
+	})
+	writeJSON(w, http.StatusOK, chart)
+}
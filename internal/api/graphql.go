@@ -0,0 +1,753 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"industrial-4.0-demo/internal/engine"
+	"industrial-4.0-demo/internal/fsm"
+	"industrial-4.0-demo/internal/history"
+	"industrial-4.0-demo/internal/types"
+	"industrial-4.0-demo/internal/web"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+// graphqlMaxDepth 限制查询的嵌套深度，避免 工站 → 工件 → 工站 ... 的循环查询拖垮服务
+const graphqlMaxDepth = 10
+
+// graphqlSchema 描述了 GraphQL 接口可以查询的工厂状态
+// 工件、工站、工作流之间可以互相嵌套查询，例如 工站 → 正在加工的工件 → 履历 → 步骤所在的工站
+const graphqlSchema = `
+schema {
+	query: Query
+}
+
+scalar Time
+
+type Query {
+	# 实时状态中的工件，可按状态、产品类型、所在工站和命名空间过滤
+	products(status: String, type: String, station: ID, namespace: String): [Product!]!
+	# 单个工件，已从实时状态中清理的工件从履历中还原
+	product(id: ID!): Product
+	stations: [Station!]!
+	station(id: ID!): Station
+	workflows: [Workflow!]!
+	# 工作流的当前版本，指定 version 时返回历史版本
+	workflow(name: String!, version: Int): Workflow
+	# 工件按时间排序的事件
+	events(productId: ID!): [TimelineEvent!]!
+	# 调度器尚未上报状态时为空，调用方绑定了命名空间时只包含这些命名空间的任务
+	scheduler: Scheduler
+	metrics: Metrics!
+}
+
+type Product {
+	id: ID!
+	type: String!
+	priority: Int!
+	status: String!
+	station: Station
+	lifecycle: String
+	retryOf: String
+	namespace: String!
+	# JSON 编码的动态属性
+	attrs: String
+	history: History
+	events: [TimelineEvent!]!
+	workflow: Workflow
+}
+
+type History {
+	traceId: String
+	queuedAt: Time
+	dispatchedAt: Time
+	worker: Int
+	startedAt: Time
+	failedAt: Time
+	finishedAt: Time
+	outcome: String
+	failure: String
+	steps: [Step!]!
+	compensations: [Compensation!]!
+}
+
+type Step {
+	step: Int!
+	stationId: ID!
+	station: Station
+	queuedAt: Time
+	startedAt: Time
+	finishedAt: Time
+	durationSeconds: Float!
+	success: Boolean!
+	error: String
+}
+
+type Compensation {
+	stationId: ID!
+	station: Station
+	at: Time!
+}
+
+type TimelineEvent {
+	at: Time!
+	kind: String!
+	step: Int
+	stationId: ID
+	station: Station
+	worker: Int
+	durationSeconds: Float!
+	outcome: String
+	error: String
+}
+
+type Station {
+	id: ID!
+	driver: String!
+	endpoint: String
+	status: String!
+	enabled: Boolean!
+	poolSize: Int!
+	poolUsed: Int!
+	# 等待资源凭证的工件数
+	poolWaiting: Int!
+	queueLength: Int!
+	utilization: Float!
+	health: String
+	# 正在该工站上加工的工件
+	products: [Product!]!
+}
+
+type Workflow {
+	name: String!
+	version: Int!
+	updatedAt: Time!
+	steps: [WorkflowStep!]!
+}
+
+type WorkflowStep {
+	index: Int!
+	stations: [Station!]!
+	rule: String
+}
+
+type Scheduler {
+	status: String!
+	workers: Int!
+	busyWorkers: Int!
+	occupancy: Float!
+	queue: [QueueEntry!]!
+	inFlight: [Worker!]!
+}
+
+type QueueEntry {
+	position: Int!
+	productId: ID!
+	priority: Int!
+	product: Product
+}
+
+type Worker {
+	worker: Int!
+	product: Product
+	startedAt: Time
+}
+
+type Metrics {
+	products: Int!
+	active: Int!
+	byStatus: [StatusCount!]!
+	queueLength: Int!
+	busyWorkers: Int!
+	occupancy: Float!
+	busyStations: Int!
+	averageUtilization: Float!
+}
+
+type StatusCount {
+	status: String!
+	count: Int!
+}
+`
+
+// graphqlRequest 是 GraphQL 请求体
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// graphqlHandler 返回 GraphQL 接口的处理函数，支持 POST JSON 请求体和 GET 查询参数两种形式
+func (s *Server) graphqlHandler() http.Handler {
+	schema := graphql.MustParseSchema(graphqlSchema, &graphqlRoot{}, graphql.MaxDepth(graphqlMaxDepth))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req graphqlRequest
+		if r.Method == http.MethodGet {
+			q := r.URL.Query()
+			req.Query = q.Get("query")
+			req.OperationName = q.Get("operationName")
+			if vars := q.Get("variables"); vars != "" {
+				if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+					http.Error(w, "invalid variables: "+err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+		} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeDecodeError(w, err)
+			return
+		}
+		if req.Query == "" {
+			http.Error(w, "query is required", http.StatusBadRequest)
+			return
+		}
+
+		// 一次查询内的所有解析器共享同一份状态快照，嵌套查询看到的数据保持一致
+		// 调用方绑定了命名空间时，快照只包含这些命名空间中的工件
+		view := &graphqlView{
+			s:        s,
+			state:    web.Filter{}.Restrict(scopeOf(r)).Apply(s.stateTracker.GetNamespaceSnapshot(scopeOf(r))),
+			stations: make(map[types.StationID]engine.StationInfo),
+			canRead:  func(namespace string) bool { return canAccess(r, namespace) },
+		}
+		for _, info := range s.scheduler.Engine().Stations().List() {
+			view.stations[info.ID] = info
+			view.stationIDs = append(view.stationIDs, info.ID)
+		}
+		ctx := context.WithValue(r.Context(), graphqlViewKey{}, view)
+		writeJSON(w, http.StatusOK, schema.Exec(ctx, req.Query, req.OperationName, req.Variables))
+	})
+}
+
+// graphqlViewKey 是请求上下文中状态快照的键
+type graphqlViewKey struct{}
+
+// graphqlView 是一次 GraphQL 查询使用的状态快照
+type graphqlView struct {
+	s          *Server
+	state      web.GlobalState
+	stations   map[types.StationID]engine.StationInfo
+	stationIDs []types.StationID           // 按 ID 排序
+	canRead    func(namespace string) bool // 调用方是否可以访问指定命名空间中的工件
+}
+
+// viewOf 取出请求上下文中的状态快照
+func viewOf(ctx context.Context) *graphqlView {
+	return ctx.Value(graphqlViewKey{}).(*graphqlView)
+}
+
+// product 返回工件的解析器，实时状态中没有时从履历中还原，都不存在时返回 nil
+func (v *graphqlView) product(id string) *productResolver {
+	if state, ok := v.state.Products[id]; ok {
+		return &productResolver{v: v, p: state}
+	}
+	record, ok := v.s.history.Get(id)
+	if !ok || !v.canRead(record.Namespace) {
+		return nil
+	}
+	return &productResolver{v: v, p: web.ProductState{
+		ID:        record.ProductID,
+		Type:      record.Type,
+		Priority:  record.Priority,
+		Status:    record.Outcome,
+		RetryOf:   record.RetryOf,
+		Namespace: record.Namespace,
+		Attrs:     record.Attrs,
+	}, record: &record}
+}
+
+// station 返回工站的解析器，工站未注册时返回 nil
+func (v *graphqlView) station(id types.StationID) *stationResolver {
+	info, ok := v.stations[id]
+	if !ok {
+		return nil
+	}
+	return &stationResolver{v: v, d: stationDetail(info, v.state.Stations[id])}
+}
+
+// graphqlRoot 是 Query 类型的解析器
+type graphqlRoot struct{}
+
+// Products 返回实时状态中的工件，按 ID 排序
+func (*graphqlRoot) Products(ctx context.Context, args struct {
+	Status    *string
+	Type      *string
+	Station   *graphql.ID
+	Namespace *string
+}) []*productResolver {
+	v := viewOf(ctx)
+	products := make([]*productResolver, 0, len(v.state.Products))
+	for _, p := range v.state.Products {
+		if args.Status != nil && !strings.EqualFold(p.Status, *args.Status) {
+			continue
+		}
+		if args.Type != nil && !strings.EqualFold(p.Type, *args.Type) {
+			continue
+		}
+		if args.Station != nil && string(p.Station) != string(*args.Station) {
+			continue
+		}
+		if args.Namespace != nil && p.Namespace != *args.Namespace {
+			continue
+		}
+		products = append(products, &productResolver{v: v, p: p})
+	}
+	sort.Slice(products, func(i, j int) bool { return products[i].p.ID < products[j].p.ID })
+	return products
+}
+
+func (*graphqlRoot) Product(ctx context.Context, args struct{ ID graphql.ID }) *productResolver {
+	return viewOf(ctx).product(string(args.ID))
+}
+
+func (*graphqlRoot) Stations(ctx context.Context) []*stationResolver {
+	v := viewOf(ctx)
+	stations := make([]*stationResolver, 0, len(v.stationIDs))
+	for _, id := range v.stationIDs {
+		stations = append(stations, v.station(id))
+	}
+	return stations
+}
+
+func (*graphqlRoot) Station(ctx context.Context, args struct{ ID graphql.ID }) *stationResolver {
+	return viewOf(ctx).station(types.StationID(args.ID))
+}
+
+func (*graphqlRoot) Workflows(ctx context.Context) []*workflowResolver {
+	v := viewOf(ctx)
+	defs := v.s.scheduler.Engine().Workflows().List()
+	workflows := make([]*workflowResolver, 0, len(defs))
+	for _, def := range defs {
+		workflows = append(workflows, &workflowResolver{v: v, def: def})
+	}
+	return workflows
+}
+
+func (*graphqlRoot) Workflow(ctx context.Context, args struct {
+	Name    string
+	Version *int32
+}) *workflowResolver {
+	v := viewOf(ctx)
+	store := v.s.scheduler.Engine().Workflows()
+	var (
+		def engine.WorkflowDefinition
+		ok  bool
+	)
+	if args.Version != nil {
+		def, ok = store.Version(args.Name, int(*args.Version))
+	} else {
+		def, ok = store.Current(args.Name)
+	}
+	if !ok {
+		return nil
+	}
+	return &workflowResolver{v: v, def: def}
+}
+
+func (*graphqlRoot) Events(ctx context.Context, args struct{ ProductID graphql.ID }) []*timelineEventResolver {
+	v := viewOf(ctx)
+	record, _ := v.s.history.Get(string(args.ProductID))
+	return v.timeline(record)
+}
+
+func (*graphqlRoot) Scheduler(ctx context.Context) *schedulerResolver {
+	v := viewOf(ctx)
+	if v.state.Scheduler == nil {
+		return nil
+	}
+	return &schedulerResolver{v: v, s: *v.state.Scheduler}
+}
+
+// Metrics 汇总实时状态中的工件、调度器和工站指标
+func (*graphqlRoot) Metrics(ctx context.Context) *metricsResolver {
+	v := viewOf(ctx)
+	m := &metricsResolver{counts: make(map[string]int32)}
+	for _, p := range v.state.Products {
+		m.products++
+		m.counts[p.Status]++
+		switch fsm.State(p.Status) {
+		case fsm.StateCompleted, fsm.StateCompensated, fsm.StateCancelled:
+		default:
+			m.active++
+		}
+	}
+	if sched := v.state.Scheduler; sched != nil {
+		m.queueLength = int32(len(sched.Queue))
+		m.busyWorkers = int32(sched.BusyWorkers)
+		m.occupancy = sched.Occupancy
+	}
+	for _, station := range v.state.Stations {
+		if station.Status == string(fsm.StationBusy) {
+			m.busyStations++
+		}
+		m.averageUtilization += station.Utilization
+	}
+	if len(v.state.Stations) > 0 {
+		m.averageUtilization /= float64(len(v.state.Stations))
+	}
+	return m
+}
+
+// timeline 将履历展开为事件解析器列表
+func (v *graphqlView) timeline(record history.Record) []*timelineEventResolver {
+	events := record.Timeline()
+	resolvers := make([]*timelineEventResolver, 0, len(events))
+	for _, e := range events {
+		resolvers = append(resolvers, &timelineEventResolver{v: v, e: e})
+	}
+	return resolvers
+}
+
+// productResolver 解析 Product 类型
+type productResolver struct {
+	v      *graphqlView
+	p      web.ProductState
+	record *history.Record // 已加载的履历，为 nil 时按需查询
+	once   sync.Once       // 同一工件的多个字段会并发解析，履历只查询一次
+}
+
+func (r *productResolver) ID() graphql.ID  { return graphql.ID(r.p.ID) }
+func (r *productResolver) Type() string    { return r.p.Type }
+func (r *productResolver) Priority() int32 { return int32(r.p.Priority) }
+func (r *productResolver) Status() string  { return r.p.Status }
+
+func (r *productResolver) Station() *stationResolver {
+	if r.p.Station == "" {
+		return nil
+	}
+	return r.v.station(r.p.Station)
+}
+
+func (r *productResolver) Lifecycle() *string { return optionalString(r.p.Lifecycle) }
+func (r *productResolver) RetryOf() *string   { return optionalString(r.p.RetryOf) }
+func (r *productResolver) Namespace() string  { return r.p.Namespace }
+
+func (r *productResolver) Attrs() *string {
+	if len(r.p.Attrs) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(r.p.Attrs)
+	if err != nil {
+		return nil
+	}
+	attrs := string(data)
+	return &attrs
+}
+
+// loadRecord 返回工件的履历，不存在时返回 nil
+func (r *productResolver) loadRecord() *history.Record {
+	r.once.Do(func() {
+		if r.record != nil {
+			return
+		}
+		if record, ok := r.v.s.history.Get(r.p.ID); ok {
+			r.record = &record
+		}
+	})
+	return r.record
+}
+
+func (r *productResolver) History() *historyResolver {
+	record := r.loadRecord()
+	if record == nil {
+		return nil
+	}
+	return &historyResolver{v: r.v, r: record}
+}
+
+func (r *productResolver) Events() []*timelineEventResolver {
+	record := r.loadRecord()
+	if record == nil {
+		return []*timelineEventResolver{}
+	}
+	return r.v.timeline(*record)
+}
+
+// Workflow 返回产品类型对应的当前工作流
+func (r *productResolver) Workflow() *workflowResolver {
+	def, ok := r.v.s.scheduler.Engine().Workflows().Current(r.p.Type)
+	if !ok {
+		return nil
+	}
+	return &workflowResolver{v: r.v, def: def}
+}
+
+// historyResolver 解析 History 类型
+type historyResolver struct {
+	v *graphqlView
+	r *history.Record
+}
+
+func (r *historyResolver) TraceID() *string        { return optionalString(r.r.TraceID) }
+func (r *historyResolver) QueuedAt() *graphql.Time { return optionalTime(r.r.QueuedAt) }
+func (r *historyResolver) DispatchedAt() *graphql.Time {
+	return optionalTime(r.r.DispatchedAt)
+}
+func (r *historyResolver) Worker() *int32            { return optionalInt(r.r.Worker) }
+func (r *historyResolver) StartedAt() *graphql.Time  { return optionalTime(r.r.StartedAt) }
+func (r *historyResolver) FailedAt() *graphql.Time   { return optionalTime(r.r.FailedAt) }
+func (r *historyResolver) FinishedAt() *graphql.Time { return optionalTime(r.r.FinishedAt) }
+func (r *historyResolver) Outcome() *string          { return optionalString(r.r.Outcome) }
+func (r *historyResolver) Failure() *string          { return optionalString(r.r.Failure) }
+
+func (r *historyResolver) Steps() []*stepResolver {
+	steps := make([]*stepResolver, 0, len(r.r.Steps))
+	for _, s := range r.r.Steps {
+		steps = append(steps, &stepResolver{v: r.v, s: s})
+	}
+	return steps
+}
+
+func (r *historyResolver) Compensations() []*compensationResolver {
+	compensations := make([]*compensationResolver, 0, len(r.r.Compensations))
+	for _, c := range r.r.Compensations {
+		compensations = append(compensations, &compensationResolver{v: r.v, c: c})
+	}
+	return compensations
+}
+
+// stepResolver 解析 Step 类型
+type stepResolver struct {
+	v *graphqlView
+	s history.StepRecord
+}
+
+func (r *stepResolver) Step() int32               { return int32(r.s.Step) }
+func (r *stepResolver) StationID() graphql.ID     { return graphql.ID(r.s.StationID) }
+func (r *stepResolver) Station() *stationResolver { return r.v.station(r.s.StationID) }
+func (r *stepResolver) QueuedAt() *graphql.Time   { return optionalTime(r.s.QueuedAt) }
+func (r *stepResolver) StartedAt() *graphql.Time  { return optionalTime(r.s.StartedAt) }
+func (r *stepResolver) FinishedAt() *graphql.Time { return optionalTime(r.s.FinishedAt) }
+func (r *stepResolver) DurationSeconds() float64  { return r.s.DurationSeconds }
+func (r *stepResolver) Success() bool             { return r.s.Success }
+func (r *stepResolver) Error() *string            { return optionalString(r.s.Error) }
+
+// compensationResolver 解析 Compensation 类型
+type compensationResolver struct {
+	v *graphqlView
+	c history.CompensationRecord
+}
+
+func (r *compensationResolver) StationID() graphql.ID     { return graphql.ID(r.c.StationID) }
+func (r *compensationResolver) Station() *stationResolver { return r.v.station(r.c.StationID) }
+func (r *compensationResolver) At() graphql.Time          { return graphql.Time{Time: r.c.At} }
+
+// timelineEventResolver 解析 TimelineEvent 类型
+type timelineEventResolver struct {
+	v *graphqlView
+	e history.TimelineEvent
+}
+
+func (r *timelineEventResolver) At() graphql.Time { return graphql.Time{Time: r.e.At} }
+func (r *timelineEventResolver) Kind() string     { return r.e.Kind }
+func (r *timelineEventResolver) Step() *int32     { return optionalInt(r.e.Step) }
+
+func (r *timelineEventResolver) StationID() *graphql.ID {
+	if r.e.StationID == "" {
+		return nil
+	}
+	id := graphql.ID(r.e.StationID)
+	return &id
+}
+
+func (r *timelineEventResolver) Station() *stationResolver {
+	if r.e.StationID == "" {
+		return nil
+	}
+	return r.v.station(r.e.StationID)
+}
+
+func (r *timelineEventResolver) Worker() *int32           { return optionalInt(r.e.Worker) }
+func (r *timelineEventResolver) DurationSeconds() float64 { return r.e.DurationSeconds }
+func (r *timelineEventResolver) Outcome() *string         { return optionalString(r.e.Outcome) }
+func (r *timelineEventResolver) Error() *string           { return optionalString(r.e.Error) }
+
+// stationResolver 解析 Station 类型
+type stationResolver struct {
+	v *graphqlView
+	d StationDetail
+}
+
+func (r *stationResolver) ID() graphql.ID       { return graphql.ID(r.d.ID) }
+func (r *stationResolver) Driver() string       { return r.d.Driver }
+func (r *stationResolver) Endpoint() *string    { return optionalString(r.d.Endpoint) }
+func (r *stationResolver) Status() string       { return r.d.Status }
+func (r *stationResolver) Enabled() bool        { return r.d.Enabled }
+func (r *stationResolver) PoolSize() int32      { return int32(r.d.PoolSize) }
+func (r *stationResolver) PoolUsed() int32      { return int32(r.d.PoolUsed) }
+func (r *stationResolver) PoolWaiting() int32   { return int32(r.d.PoolWait) }
+func (r *stationResolver) QueueLength() int32   { return int32(r.d.QueueLength) }
+func (r *stationResolver) Utilization() float64 { return r.d.Utilization }
+func (r *stationResolver) Health() *string      { return optionalString(r.d.Health) }
+
+func (r *stationResolver) Products() []*productResolver {
+	view := r.v.state.Stations[r.d.ID]
+	products := make([]*productResolver, 0, len(view.Products))
+	for _, id := range view.Products {
+		if p := r.v.product(id); p != nil {
+			products = append(products, p)
+		}
+	}
+	return products
+}
+
+// workflowResolver 解析 Workflow 类型
+type workflowResolver struct {
+	v   *graphqlView
+	def engine.WorkflowDefinition
+}
+
+func (r *workflowResolver) Name() string            { return r.def.Name }
+func (r *workflowResolver) Version() int32          { return int32(r.def.Version) }
+func (r *workflowResolver) UpdatedAt() graphql.Time { return graphql.Time{Time: r.def.UpdatedAt} }
+
+func (r *workflowResolver) Steps() []*workflowStepResolver {
+	steps := make([]*workflowStepResolver, 0, len(r.def.Steps))
+	for i, step := range r.def.Steps {
+		steps = append(steps, &workflowStepResolver{v: r.v, index: i, step: step})
+	}
+	return steps
+}
+
+// workflowStepResolver 解析 WorkflowStep 类型
+type workflowStepResolver struct {
+	v     *graphqlView
+	index int
+	step  types.WorkflowStep
+}
+
+func (r *workflowStepResolver) Index() int32  { return int32(r.index) }
+func (r *workflowStepResolver) Rule() *string { return optionalString(r.step.Rule) }
+
+func (r *workflowStepResolver) Stations() []*stationResolver {
+	stations := make([]*stationResolver, 0, len(r.step.StationIDs))
+	for _, id := range r.step.StationIDs {
+		if station := r.v.station(id); station != nil {
+			stations = append(stations, station)
+		}
+	}
+	return stations
+}
+
+// schedulerResolver 解析 Scheduler 类型
+type schedulerResolver struct {
+	v *graphqlView
+	s web.SchedulerState
+}
+
+func (r *schedulerResolver) Status() string     { return r.s.Status }
+func (r *schedulerResolver) Workers() int32     { return int32(r.s.Workers) }
+func (r *schedulerResolver) BusyWorkers() int32 { return int32(r.s.BusyWorkers) }
+func (r *schedulerResolver) Occupancy() float64 { return r.s.Occupancy }
+
+func (r *schedulerResolver) Queue() []*queueEntryResolver {
+	queue := make([]*queueEntryResolver, 0, len(r.s.Queue))
+	for _, e := range r.s.Queue {
+		queue = append(queue, &queueEntryResolver{v: r.v, e: e})
+	}
+	return queue
+}
+
+func (r *schedulerResolver) InFlight() []*workerResolver {
+	workers := make([]*workerResolver, 0, len(r.s.InFlight))
+	for _, w := range r.s.InFlight {
+		workers = append(workers, &workerResolver{v: r.v, w: w})
+	}
+	return workers
+}
+
+// queueEntryResolver 解析 QueueEntry 类型
+type queueEntryResolver struct {
+	v *graphqlView
+	e web.QueueEntry
+}
+
+func (r *queueEntryResolver) Position() int32           { return int32(r.e.Position) }
+func (r *queueEntryResolver) ProductID() graphql.ID     { return graphql.ID(r.e.ProductID) }
+func (r *queueEntryResolver) Priority() int32           { return int32(r.e.Priority) }
+func (r *queueEntryResolver) Product() *productResolver { return r.v.product(r.e.ProductID) }
+
+// workerResolver 解析 Worker 类型
+type workerResolver struct {
+	v *graphqlView
+	w web.WorkerState
+}
+
+func (r *workerResolver) Worker() int32 { return int32(r.w.Worker) }
+
+func (r *workerResolver) Product() *productResolver {
+	if r.w.ProductID == "" {
+		return nil
+	}
+	return r.v.product(r.w.ProductID)
+}
+
+func (r *workerResolver) StartedAt() *graphql.Time { return optionalTime(r.w.StartedAt) }
+
+// metricsResolver 解析 Metrics 类型
+type metricsResolver struct {
+	products           int32
+	active             int32
+	counts             map[string]int32
+	queueLength        int32
+	busyWorkers        int32
+	occupancy          float64
+	busyStations       int32
+	averageUtilization float64
+}
+
+func (r *metricsResolver) Products() int32             { return r.products }
+func (r *metricsResolver) Active() int32               { return r.active }
+func (r *metricsResolver) QueueLength() int32          { return r.queueLength }
+func (r *metricsResolver) BusyWorkers() int32          { return r.busyWorkers }
+func (r *metricsResolver) Occupancy() float64          { return r.occupancy }
+func (r *metricsResolver) BusyStations() int32         { return r.busyStations }
+func (r *metricsResolver) AverageUtilization() float64 { return r.averageUtilization }
+
+// ByStatus 返回按状态名排序的工件数量
+func (r *metricsResolver) ByStatus() []*statusCountResolver {
+	counts := make([]*statusCountResolver, 0, len(r.counts))
+	for status, n := range r.counts {
+		counts = append(counts, &statusCountResolver{status: status, count: n})
+	}
+	sort.Slice(counts, func(i, j int) bool { return counts[i].status < counts[j].status })
+	return counts
+}
+
+// statusCountResolver 解析 StatusCount 类型
+type statusCountResolver struct {
+	status string
+	count  int32
+}
+
+func (r *statusCountResolver) Status() string { return r.status }
+func (r *statusCountResolver) Count() int32   { return r.count }
+
+// optionalString 将空字符串转换为 GraphQL 的 null
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// optionalTime 将零值时间转换为 GraphQL 的 null
+func optionalTime(t time.Time) *graphql.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &graphql.Time{Time: t}
+}
+
+// optionalInt 将可选的整数转换为 GraphQL 的 Int
+func optionalInt(n *int) *int32 {
+	if n == nil {
+		return nil
+	}
+	v := int32(*n)
+	return &v
+}
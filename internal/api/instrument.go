@@ -0,0 +1,88 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// routeKey 是请求上下文中记录匹配路由的键
+type routeKey struct{}
+
+// routeRecorder 保存内层路由匹配到的模式，认证和请求体限制中间件会复制请求，外层无法直接读取 r.Pattern
+type routeRecorder struct {
+	pattern string
+}
+
+// instrument 记录每个请求的次数和耗时，按路由模式和状态码分类
+// 路由取最内层匹配到的模式 (例如 GET /api/v1/tasks/{id})，避免工件 ID 等路径参数撑大标签基数；未匹配的请求记为 unmatched
+func (s *Server) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		route := &routeRecorder{}
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		r = r.WithContext(context.WithValue(r.Context(), routeKey{}, route))
+		next.ServeHTTP(rec, r)
+
+		// 内层路由没有匹配 (例如认证失败或开放路由) 时使用外层匹配到的模式
+		pattern := route.pattern
+		if pattern == "" {
+			pattern = r.Pattern
+		}
+		if pattern == "" {
+			pattern = "unmatched"
+		}
+		s.metrics.APIRequestsTotal.WithLabelValues(pattern, strconv.Itoa(rec.status)).Inc()
+		s.metrics.APIRequestDuration.WithLabelValues(pattern).Observe(time.Since(start).Seconds())
+	})
+}
+
+// recordRoute 在内层路由处理完请求后，将匹配到的模式记录到 instrument 放入上下文的记录器中
+func recordRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		if route, ok := r.Context().Value(routeKey{}).(*routeRecorder); ok && r.Pattern != "" {
+			route.pattern = r.Pattern
+		}
+	})
+}
+
+// statusRecorder 记录响应的状态码
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+// WriteHeader 记录第一次写出的状态码
+func (w *statusRecorder) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write 写出响应体，未显式写出状态码时为 200
+func (w *statusRecorder) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(p)
+}
+
+// Hijack 接管底层连接，WebSocket 升级依赖该接口，接管成功的请求记为 101
+func (w *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil {
+		w.status = http.StatusSwitchingProtocols
+		w.wroteHeader = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap 返回底层的 ResponseWriter，供 http.ResponseController 刷新响应和设置写超时
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
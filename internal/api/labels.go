@@ -0,0 +1,37 @@
+package api
+
+import (
+	"fmt"
+	"industrial-4.0-demo/internal/serial"
+	"net/http"
+)
+
+// handleTaskLabel 返回工件标签的序列号、条码和二维码内容，?format=svg 时返回 Code 128 条码图片
+// 工件开始生产时才分配序列号，尚未分配时返回 409
+func (s *Server) handleTaskLabel(w http.ResponseWriter, r *http.Request) {
+	record, ok := s.history.Get(r.PathValue("id"))
+	if !ok || !canAccess(r, record.Namespace) {
+		http.Error(w, "task not found", http.StatusNotFound)
+		return
+	}
+	if record.Serial == "" {
+		http.Error(w, "serial number not assigned, task has not started", http.StatusConflict)
+		return
+	}
+	label := serial.NewLabel(record.ProductID, record.Serial, record.Type, record.Lot)
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		writeJSON(w, http.StatusOK, label)
+	case "svg":
+		svg, err := serial.Code128SVG(label.Barcode.Data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Write([]byte(svg))
+	default:
+		http.Error(w, fmt.Sprintf("unknown format %q, expected json / svg", format), http.StatusBadRequest)
+	}
+}
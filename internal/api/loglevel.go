@@ -0,0 +1,43 @@
+package api
+
+import (
+	"encoding/json"
+	"industrial-4.0-demo/internal/audit"
+	"industrial-4.0-demo/internal/logging"
+	"net/http"
+)
+
+// logLevelRequest 是修改日志级别接口的请求体
+// Level 为空时保持整体级别不变，Components 中级别为空的组件取消覆盖
+type logLevelRequest struct {
+	Level      string            `json:"level"`
+	Components map[string]string `json:"components"`
+}
+
+// SetLogLevels 设置日志级别控制，设置后注册 /api/v1/admin/loglevel
+func (s *Server) SetLogLevels(levels *logging.Levels) {
+	s.logLevels = levels
+}
+
+// handleGetLogLevel 返回整体日志级别和被覆盖的组件级别
+func (s *Server) handleGetLogLevel(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.logLevels.State())
+}
+
+// handleSetLogLevel 修改整体日志级别或组件的覆盖级别，立即生效，级别或组件无效时返回 400 且不做任何修改
+func (s *Server) handleSetLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req logLevelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	before := s.logLevels.State()
+	if err := s.logLevels.Update(req.Level, req.Components); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	after := s.logLevels.State()
+	s.logger.Info("已修改日志级别", "level", after.Level, "components", after.Components)
+	s.audit(r, audit.ActionLogLevel, "loglevel", "", before, after)
+	writeJSON(w, http.StatusOK, after)
+}
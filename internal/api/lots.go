@@ -0,0 +1,21 @@
+package api
+
+import (
+	"industrial-4.0-demo/internal/lot"
+	"net/http"
+)
+
+// SetLots 设置批次追踪器，设置后提交任务时可以指定 quantity 按拼板拆分，并注册 GET /api/v1/lots/{id}
+func (s *Server) SetLots(tracker *lot.Tracker) {
+	s.lots = tracker
+}
+
+// handleGetLot 返回批次的进度，其他命名空间的批次视同不存在
+func (s *Server) handleGetLot(w http.ResponseWriter, r *http.Request) {
+	progress, ok := s.lots.Get(r.PathValue("id"))
+	if !ok || !canAccess(r, progress.Namespace) {
+		http.Error(w, "lot not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, progress)
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"industrial-4.0-demo/internal/audit"
+	"industrial-4.0-demo/internal/auth"
+	"industrial-4.0-demo/internal/maintenance"
+	"io"
+	"net/http"
+)
+
+// closeWorkOrderRequest 是关闭维护工单的请求体，可以为空
+type closeWorkOrderRequest struct {
+	Note string `json:"note"`
+}
+
+// SetMaintenance 设置维护追踪器，设置后注册 /api/v1/maintenance/work-orders 接口
+func (s *Server) SetMaintenance(tracker *maintenance.Tracker) {
+	s.maintenance = tracker
+}
+
+// handleListWorkOrders 返回所有维护工单，按创建时间排序；?status=open 时只返回未关闭的工单
+func (s *Server) handleListWorkOrders(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.maintenance.List(r.URL.Query().Get("status")))
+}
+
+// handleGetWorkOrder 返回单张维护工单及触发时的证据
+func (s *Server) handleGetWorkOrder(w http.ResponseWriter, r *http.Request) {
+	order, ok := s.maintenance.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, maintenance.ErrNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, order)
+}
+
+// handleCloseWorkOrder 关闭维护工单，工单让工站进入了维护模式时重新启用工站；已关闭的工单返回 409
+func (s *Server) handleCloseWorkOrder(w http.ResponseWriter, r *http.Request) {
+	var req closeWorkOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeDecodeError(w, err)
+		return
+	}
+	var by string
+	if p, ok := auth.PrincipalFromContext(r.Context()); ok {
+		by = p.Subject
+	}
+	order, err := s.maintenance.Close(r.PathValue("id"), by, req.Note)
+	switch {
+	case errors.Is(err, maintenance.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, maintenance.ErrClosed):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	s.audit(r, audit.ActionWorkOrderClose, order.ID, "", maintenance.StatusOpen, order)
+	writeJSON(w, http.StatusOK, order)
+}
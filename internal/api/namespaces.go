@@ -0,0 +1,41 @@
+package api
+
+import (
+	"errors"
+	"industrial-4.0-demo/internal/auth"
+	"industrial-4.0-demo/internal/web"
+	"net/http"
+)
+
+// scopeOf 返回调用方可以访问的命名空间，未启用认证或调用方不受限制时为空
+func scopeOf(r *http.Request) []string {
+	return auth.ScopeFromContext(r.Context())
+}
+
+// canAccess 判断调用方是否可以访问指定命名空间中的工件
+func canAccess(r *http.Request, namespace string) bool {
+	p, _ := auth.PrincipalFromContext(r.Context())
+	return p.CanAccess(namespace)
+}
+
+// resolveNamespace 确定调用方提交的任务所属的命名空间
+func resolveNamespace(r *http.Request, requested string) (string, error) {
+	p, _ := auth.PrincipalFromContext(r.Context())
+	return auth.ResolveNamespace(p, requested)
+}
+
+// writeNamespaceError 输出命名空间校验失败的响应：无权访问返回 403，名称不合法返回 400
+func writeNamespaceError(w http.ResponseWriter, err error) {
+	if errors.Is(err, auth.ErrForbidden) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
+// scoped 将调用方可以访问的命名空间传给 Hub，推送的订阅条件被限制在其中
+func scoped(h http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h(w, r.WithContext(web.WithScope(r.Context(), scopeOf(r))))
+	})
+}
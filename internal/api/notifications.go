@@ -0,0 +1,30 @@
+package api
+
+import (
+	"industrial-4.0-demo/internal/audit"
+	"industrial-4.0-demo/internal/notify"
+	"net/http"
+)
+
+// SetNotifier 设置通知器，设置后注册 GET /api/v1/notifications 和 POST /api/v1/notifications/test
+func (s *Server) SetNotifier(n *notify.Notifier) {
+	s.notifier = n
+}
+
+// handleNotifications 返回各通道的投递统计和最近的投递记录
+func (s *Server) handleNotifications(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.notifier.Status())
+}
+
+// handleNotifyTest 向所有通道同步发送一条测试通知并返回投递结果，任一通道投递失败时返回 502
+func (s *Server) handleNotifyTest(w http.ResponseWriter, r *http.Request) {
+	deliveries := s.notifier.Test(r.Context())
+	s.audit(r, audit.ActionNotifyTest, "notifications", "", nil, deliveries)
+	for _, d := range deliveries {
+		if d.Result != notify.ResultSent {
+			writeJSON(w, http.StatusBadGateway, deliveries)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, deliveries)
+}
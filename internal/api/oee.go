@@ -0,0 +1,45 @@
+package api
+
+import (
+	"errors"
+	"industrial-4.0-demo/internal/oee"
+	"industrial-4.0-demo/internal/windowed"
+	"net/http"
+	"time"
+)
+
+// defaultReportWindow 是未指定 window 时 OEE、产出和可靠性报告的统计窗口
+const defaultReportWindow = time.Hour
+
+// reportWindow 解析 ?window= 查询参数 (例如 30m、8h)，未指定时返回 defaultReportWindow
+func reportWindow(r *http.Request) (time.Duration, bool) {
+	v := r.URL.Query().Get("window")
+	if v == "" {
+		return defaultReportWindow, true
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, false
+	}
+	return d, true
+}
+
+// SetOEE 设置 OEE 追踪器，设置后注册 GET /api/v1/oee
+func (s *Server) SetOEE(tracker *oee.Tracker) {
+	s.oee = tracker
+}
+
+// handleOEE 返回各工站在统计窗口内的 OEE，可通过 ?window= 指定窗口 (例如 30m、8h)，默认 1 小时
+func (s *Server) handleOEE(w http.ResponseWriter, r *http.Request) {
+	window, ok := reportWindow(r)
+	if !ok {
+		http.Error(w, "invalid window", http.StatusBadRequest)
+		return
+	}
+	report, err := s.oee.Report(window, time.Now())
+	if errors.Is(err, windowed.ErrTooLarge) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,8 @@
+package api
+
+import "net/http"
+
+// handleListOperators 返回所有操作员的技能、班次和当前分配，未配置操作员时返回空列表
+func (s *Server) handleListOperators(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.scheduler.Engine().Operators().List())
+}
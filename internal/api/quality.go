@@ -0,0 +1,29 @@
+package api
+
+import (
+	"industrial-4.0-demo/internal/quality"
+	"industrial-4.0-demo/internal/types"
+	"net/http"
+	"strings"
+)
+
+// SetQuality 设置质量追踪器，设置后注册 GET /api/v1/quality 和 GET /api/v1/quality/{productID}
+func (s *Server) SetQuality(tracker *quality.Tracker) {
+	s.quality = tracker
+}
+
+// handleQualityStats 返回各工站各测量项的 SPC 统计量，?station= 时只返回该工站
+func (s *Server) handleQualityStats(w http.ResponseWriter, r *http.Request) {
+	station := types.StationID(strings.ToUpper(r.URL.Query().Get("station")))
+	writeJSON(w, http.StatusOK, s.quality.Stats(station))
+}
+
+// handleProductQuality 返回工件在各步骤采集的测量值，其他命名空间的工件视同不存在
+func (s *Server) handleProductQuality(w http.ResponseWriter, r *http.Request) {
+	record, ok := s.history.Get(r.PathValue("productID"))
+	if !ok || !canAccess(r, record.Namespace) {
+		http.Error(w, "task not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, quality.ForProduct(record))
+}
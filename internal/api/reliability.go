@@ -0,0 +1,29 @@
+package api
+
+import (
+	"errors"
+	"industrial-4.0-demo/internal/reliability"
+	"industrial-4.0-demo/internal/windowed"
+	"net/http"
+	"time"
+)
+
+// SetReliability 设置可靠性追踪器，设置后注册 GET /api/v1/reliability
+func (s *Server) SetReliability(tracker *reliability.Tracker) {
+	s.reliability = tracker
+}
+
+// handleReliability 返回各工站在统计窗口内的步骤失败率、MTBF 和 MTTR，可通过 ?window= 指定窗口，默认 1 小时
+func (s *Server) handleReliability(w http.ResponseWriter, r *http.Request) {
+	window, ok := reportWindow(r)
+	if !ok {
+		http.Error(w, "invalid window", http.StatusBadRequest)
+		return
+	}
+	report, err := s.reliability.Report(window, time.Now())
+	if errors.Is(err, windowed.ErrTooLarge) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,16 @@
+package api
+
+import (
+	"industrial-4.0-demo/internal/replay"
+	"net/http"
+)
+
+// SetReplay 设置回放器，设置后注册 /api/v1/replay 接口
+func (s *Server) SetReplay(replayer *replay.Replayer) {
+	s.replay = replayer
+}
+
+// handleReplayStatus 返回回放的进度和与录制不一致的地方
+func (s *Server) handleReplayStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.replay.Status())
+}
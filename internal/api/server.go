@@ -0,0 +1,370 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"industrial-4.0-demo/internal/audit"
+	"industrial-4.0-demo/internal/auth"
+	"industrial-4.0-demo/internal/b2mml"
+	"industrial-4.0-demo/internal/chaos"
+	"industrial-4.0-demo/internal/cluster"
+	"industrial-4.0-demo/internal/defect"
+	"industrial-4.0-demo/internal/engine"
+	"industrial-4.0-demo/internal/erp"
+	"industrial-4.0-demo/internal/features"
+	"industrial-4.0-demo/internal/history"
+	"industrial-4.0-demo/internal/logging"
+	"industrial-4.0-demo/internal/lot"
+	"industrial-4.0-demo/internal/maintenance"
+	"industrial-4.0-demo/internal/metrics"
+	"industrial-4.0-demo/internal/notify"
+	"industrial-4.0-demo/internal/oee"
+	"industrial-4.0-demo/internal/quality"
+	"industrial-4.0-demo/internal/ratelimit"
+	"industrial-4.0-demo/internal/reliability"
+	"industrial-4.0-demo/internal/reload"
+	"industrial-4.0-demo/internal/replay"
+	"industrial-4.0-demo/internal/simulator"
+	"industrial-4.0-demo/internal/sla"
+	"industrial-4.0-demo/internal/throughput"
+	"industrial-4.0-demo/internal/types"
+	"industrial-4.0-demo/internal/web"
+	"industrial-4.0-demo/internal/whatif"
+	"industrial-4.0-demo/internal/workqueue"
+	"industrial-4.0-demo/internal/yield"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Server 汇总了 HTTP API 所需的所有依赖，并负责注册路由
+type Server struct {
+	scheduler    *engine.Scheduler      // 调度器，用于提交任务
+	hub          *web.Hub               // WebSocket Hub
+	stateTracker *web.StateTracker      // 实时状态追踪器
+	history      *history.Store         // 工件加工履历
+	staticDir    string                 // 前端静态资源目录，为空时使用编译进二进制的资源
+	auth         auth.Authenticator     // 认证器，为 nil 时不启用认证
+	limiter      *ratelimit.Limiter     // 任务提交限流器，为 nil 时不启用限流
+	simulator    *simulator.Simulator   // 订单模拟器，为 nil 时不提供模拟控制接口
+	oee          *oee.Tracker           // OEE 追踪器，为 nil 时不提供 OEE 报告接口
+	throughput   *throughput.Tracker    // 产出追踪器，为 nil 时不提供产出报告接口
+	lots         *lot.Tracker           // 批次追踪器，为 nil 时不支持按数量拆分订单
+	b2mml        *b2mml.Importer        // B2MML 排产计划导入器，为 nil 时不提供导入接口
+	erp          *erp.Adapter           // ERP 订单适配器，为 nil 时不提供导入状态接口
+	notifier     *notify.Notifier       // 通知器，为 nil 时不提供通知状态接口
+	cluster      *cluster.Elector       // 集群选举者，为 nil 时单实例运行，不重定向写请求
+	workQueue    *workqueue.Queue       // 共享工作队列，为 nil 时任务在本进程执行，不提供 worker 接口
+	streamQueue  *workqueue.StreamQueue // Redis Streams 工作队列，worker 直接访问 Redis，只提供队列状态接口
+	maintenance  *maintenance.Tracker   // 维护追踪器，为 nil 时不提供维护工单接口
+	quality      *quality.Tracker       // 质量追踪器，为 nil 时不提供质量测量接口
+	defects      *defect.Tracker        // 缺陷追踪器，为 nil 时不提供缺陷帕累托接口
+	reliability  *reliability.Tracker   // 可靠性追踪器，为 nil 时不提供可靠性报告接口
+	yield        *yield.Tracker         // 良率追踪器，为 nil 时不提供良率和报废报告接口
+	sla          *sla.Tracker           // 交期追踪器，为 nil 时不提供准时交付报告接口
+	whatIf       *whatif.Baseline       // what-if 仿真的静态基线 (加工时间、失败率)，为 nil 时不提供仿真接口
+	chaos        *chaos.Injector        // 故障注入器，为 nil 时不提供故障注入接口
+	replay       *replay.Replayer       // 回放器，为 nil 时不在回放模式，不提供回放进度接口
+	auditLog     *audit.Log             // 审计日志，为 nil 时不记录操作，也不提供审计查询接口
+	logLevels    *logging.Levels        // 日志级别控制，为 nil 时不提供修改日志级别的接口
+	reloader     *reload.Reloader       // 配置重新加载器，为 nil 时不提供查看和修改配置的接口
+	features     *features.Flags        // 功能开关，为 nil 时不提供查看和切换功能开关的接口
+	wsTokens     *auth.WSTokenIssuer    // WebSocket 令牌签发器，为 nil 时 /ws 使用与 API 相同的认证
+	maxBodyBytes int64                  // API 请求体的最大字节数
+	metrics      *metrics.Metrics       // 请求、认证失败和限流指标，/metrics 输出它所在的注册表
+	logger       *slog.Logger           // 结构化日志记录器
+}
+
+// NewServer 创建一个新的 API Server 实例
+func NewServer(scheduler *engine.Scheduler, hub *web.Hub, st *web.StateTracker, hist *history.Store, staticDir string, authenticator auth.Authenticator, limiter *ratelimit.Limiter, m *metrics.Metrics, logger *slog.Logger) *Server {
+	return &Server{
+		scheduler:    scheduler,
+		hub:          hub,
+		stateTracker: st,
+		history:      hist,
+		staticDir:    staticDir,
+		auth:         authenticator,
+		limiter:      limiter,
+		maxBodyBytes: defaultMaxBodyBytes,
+		metrics:      m,
+		logger:       logger.With("component", "api"),
+	}
+}
+
+// defaultMaxBodyBytes 是未配置时 API 请求体的最大字节数
+const defaultMaxBodyBytes = 1 << 20
+
+// SetMaxBodyBytes 设置 API 请求体的最大字节数，n <= 0 时使用默认值
+func (s *Server) SetMaxBodyBytes(n int64) {
+	if n <= 0 {
+		n = defaultMaxBodyBytes
+	}
+	s.maxBodyBytes = n
+}
+
+// Handler 返回注册了所有路由的 HTTP Handler
+// API 位于 /api/v1/ 下，未带版本号的 /api/* 旧路径转发到当前版本；GET /api/versions 用于版本协商
+// /api/* 和 /ws 需要通过认证，设置了 WebSocket 令牌签发器时 /ws 由 Hub 在升级前校验令牌；/metrics、版本协商和前端静态资源保持开放；API 和静态资源的响应按需 gzip 压缩；集群跟随者把写请求重定向到领导者；所有请求按路由和状态码记录指标
+func (s *Server) Handler() http.Handler {
+	protected := http.NewServeMux()
+	if s.wsTokens == nil {
+		protected.Handle("/ws", s.require(auth.RoleViewer, scoped(s.hub.ServeWs)))
+	} else {
+		protected.Handle("GET /api/v1/ws-token", s.require(auth.RoleViewer, http.HandlerFunc(s.handleWSToken)))
+	}
+	protected.Handle("/api/v1/state", s.require(auth.RoleViewer, http.HandlerFunc(s.handleState)))
+	protected.Handle("GET /api/v1/state/stream", s.require(auth.RoleViewer, scoped(s.hub.ServeSSE)))
+	protected.Handle("/api/v1/tasks", s.require(auth.RoleOperator, s.limit("/api/v1/tasks", s.handleSubmitTask)))
+	protected.Handle("POST /api/v1/tasks/upload", s.require(auth.RoleOperator, s.limit("/api/v1/tasks/upload", s.handleUploadTasks)))
+	protected.Handle("GET /api/v1/tasks/{id}", s.require(auth.RoleViewer, http.HandlerFunc(s.handleGetTask)))
+	protected.Handle("GET /api/v1/tasks/{id}/timeline", s.require(auth.RoleViewer, http.HandlerFunc(s.handleGetTaskTimeline)))
+	protected.Handle("GET /api/v1/tasks/{id}/traceability", s.require(auth.RoleViewer, http.HandlerFunc(s.handleTaskTraceability)))
+	protected.Handle("GET /api/v1/tasks/{id}/label", s.require(auth.RoleViewer, http.HandlerFunc(s.handleTaskLabel)))
+	protected.Handle("DELETE /api/v1/tasks/{id}", s.require(auth.RoleOperator, http.HandlerFunc(s.handleCancelTask)))
+	protected.Handle("POST /api/v1/tasks/{id}/retry", s.require(auth.RoleOperator, s.limit("/api/v1/tasks/{id}/retry", s.handleRetryTask)))
+	protected.Handle("GET /api/v1/admin/scheduler", s.require(auth.RoleAdmin, http.HandlerFunc(s.handleSchedulerState)))
+	protected.Handle("POST /api/v1/admin/scheduler/pause", s.require(auth.RoleAdmin, http.HandlerFunc(s.handlePauseScheduler)))
+	protected.Handle("POST /api/v1/admin/scheduler/resume", s.require(auth.RoleAdmin, http.HandlerFunc(s.handleResumeScheduler)))
+	// 暂停和恢复出队的简短别名，与 /admin 下的接口相同，同样需要管理员角色
+	protected.Handle("POST /api/v1/scheduler/pause", s.require(auth.RoleAdmin, http.HandlerFunc(s.handlePauseScheduler)))
+	protected.Handle("POST /api/v1/scheduler/resume", s.require(auth.RoleAdmin, http.HandlerFunc(s.handleResumeScheduler)))
+	protected.Handle("POST /api/v1/admin/scheduler/drain", s.require(auth.RoleAdmin, http.HandlerFunc(s.handleDrainScheduler)))
+	protected.Handle("PUT /api/v1/admin/scheduler/workers", s.require(auth.RoleAdmin, http.HandlerFunc(s.handleSetWorkers)))
+	protected.Handle("GET /api/v1/admin/scheduler/plan", s.require(auth.RoleAdmin, http.HandlerFunc(s.handleGetPlan)))
+	protected.Handle("POST /api/v1/admin/scheduler/plan", s.require(auth.RoleAdmin, http.HandlerFunc(s.handleCreatePlan)))
+	protected.Handle("DELETE /api/v1/admin/scheduler/plan", s.require(auth.RoleAdmin, http.HandlerFunc(s.handleClearPlan)))
+	protected.Handle("POST /api/v1/admin/scheduler/wal/flush", s.require(auth.RoleAdmin, http.HandlerFunc(s.handleFlushWAL)))
+	protected.Handle("POST /api/v1/admin/scheduler/wal/compact", s.require(auth.RoleAdmin, http.HandlerFunc(s.handleCompactWAL)))
+	protected.Handle("GET /api/v1/schedule/gantt", s.require(auth.RoleViewer, http.HandlerFunc(s.handleGantt)))
+	protected.Handle("GET /api/v1/stations", s.require(auth.RoleViewer, http.HandlerFunc(s.handleListStations)))
+	protected.Handle("POST /api/v1/stations/{id}/disable", s.require(auth.RoleAdmin, http.HandlerFunc(s.handleDisableStation)))
+	protected.Handle("POST /api/v1/stations/{id}/enable", s.require(auth.RoleAdmin, http.HandlerFunc(s.handleEnableStation)))
+	protected.Handle("GET /api/v1/operators", s.require(auth.RoleViewer, http.HandlerFunc(s.handleListOperators)))
+	protected.Handle("GET /api/v1/alerts", s.require(auth.RoleViewer, http.HandlerFunc(s.handleListAlerts)))
+	protected.Handle("POST /api/v1/alerts/{id}/ack", s.require(auth.RoleOperator, http.HandlerFunc(s.handleAckAlert)))
+	protected.Handle("POST /api/v1/alerts/{id}/assign", s.require(auth.RoleOperator, http.HandlerFunc(s.handleAssignAlert)))
+	protected.Handle("POST /api/v1/alerts/{id}/resolve", s.require(auth.RoleOperator, http.HandlerFunc(s.handleResolveAlert)))
+	protected.Handle("GET /api/v1/workflows", s.require(auth.RoleViewer, http.HandlerFunc(s.handleListWorkflows)))
+	protected.Handle("GET /api/v1/workflows/{name}", s.require(auth.RoleViewer, http.HandlerFunc(s.handleGetWorkflow)))
+	protected.Handle("POST /api/v1/workflows", s.require(auth.RoleAdmin, http.HandlerFunc(s.handleCreateWorkflow)))
+	protected.Handle("PUT /api/v1/workflows/{name}", s.require(auth.RoleAdmin, http.HandlerFunc(s.handleUpdateWorkflow)))
+	protected.Handle("DELETE /api/v1/workflows/{name}", s.require(auth.RoleAdmin, http.HandlerFunc(s.handleDeleteWorkflow)))
+	protected.Handle("GET /api/v1/version", s.require(auth.RoleViewer, http.HandlerFunc(s.handleVersion)))
+	graphqlHandler := s.require(auth.RoleViewer, s.graphqlHandler())
+	protected.Handle("GET /api/v1/graphql", graphqlHandler)
+	protected.Handle("POST /api/v1/graphql", graphqlHandler)
+	if s.simulator != nil {
+		protected.Handle("GET /api/v1/sim", s.require(auth.RoleViewer, http.HandlerFunc(s.handleSimStatus)))
+		protected.Handle("PUT /api/v1/sim", s.require(auth.RoleOperator, http.HandlerFunc(s.handleSimUpdate)))
+		protected.Handle("POST /api/v1/sim/start", s.require(auth.RoleOperator, http.HandlerFunc(s.handleSimStart)))
+		protected.Handle("POST /api/v1/sim/stop", s.require(auth.RoleOperator, http.HandlerFunc(s.handleSimStop)))
+		protected.Handle("GET /api/v1/sim/scenarios", s.require(auth.RoleViewer, http.HandlerFunc(s.handleListScripts)))
+		protected.Handle("GET /api/v1/sim/run", s.require(auth.RoleViewer, http.HandlerFunc(s.handleLastRun)))
+		protected.Handle("DELETE /api/v1/sim/run", s.require(auth.RoleOperator, http.HandlerFunc(s.handleStopRun)))
+		protected.Handle("POST /api/v1/sim/run/{scenario}", s.require(auth.RoleOperator, http.HandlerFunc(s.handleRunScript)))
+	}
+	if s.oee != nil {
+		protected.Handle("GET /api/v1/oee", s.require(auth.RoleViewer, http.HandlerFunc(s.handleOEE)))
+	}
+	if s.auditLog != nil {
+		protected.Handle("GET /api/v1/audit", s.require(auth.RoleAdmin, http.HandlerFunc(s.handleListAudit)))
+	}
+	if s.logLevels != nil {
+		protected.Handle("GET /api/v1/admin/loglevel", s.require(auth.RoleAdmin, http.HandlerFunc(s.handleGetLogLevel)))
+		protected.Handle("PUT /api/v1/admin/loglevel", s.require(auth.RoleAdmin, http.HandlerFunc(s.handleSetLogLevel)))
+	}
+	if s.reloader != nil {
+		protected.Handle("GET /api/v1/admin/config", s.require(auth.RoleAdmin, http.HandlerFunc(s.handleGetConfig)))
+		protected.Handle("PATCH /api/v1/admin/config", s.require(auth.RoleAdmin, http.HandlerFunc(s.handlePatchConfig)))
+	}
+	if s.features != nil {
+		protected.Handle("GET /api/v1/admin/features", s.require(auth.RoleViewer, http.HandlerFunc(s.handleListFeatures)))
+		protected.Handle("PUT /api/v1/admin/features/{name}", s.require(auth.RoleAdmin, http.HandlerFunc(s.handleSetFeature)))
+	}
+	if s.maintenance != nil {
+		protected.Handle("GET /api/v1/maintenance/work-orders", s.require(auth.RoleViewer, http.HandlerFunc(s.handleListWorkOrders)))
+		protected.Handle("GET /api/v1/maintenance/work-orders/{id}", s.require(auth.RoleViewer, http.HandlerFunc(s.handleGetWorkOrder)))
+		protected.Handle("POST /api/v1/maintenance/work-orders/{id}/close", s.require(auth.RoleOperator, http.HandlerFunc(s.handleCloseWorkOrder)))
+	}
+	if s.quality != nil {
+		protected.Handle("GET /api/v1/quality", s.require(auth.RoleViewer, http.HandlerFunc(s.handleQualityStats)))
+		protected.Handle("GET /api/v1/quality/{productID}", s.require(auth.RoleViewer, http.HandlerFunc(s.handleProductQuality)))
+	}
+	if s.defects != nil {
+		protected.Handle("GET /api/v1/defects/summary", s.require(auth.RoleViewer, http.HandlerFunc(s.handleDefectSummary)))
+	}
+	if s.lots != nil {
+		protected.Handle("GET /api/v1/lots/{id}", s.require(auth.RoleViewer, http.HandlerFunc(s.handleGetLot)))
+	}
+	if s.b2mml != nil {
+		protected.Handle("POST /api/v1/tasks/b2mml", s.require(auth.RoleOperator, s.limit("/api/v1/tasks/b2mml", s.handleImportB2MML)))
+	}
+	if s.erp != nil {
+		protected.Handle("GET /api/v1/integrations/erp", s.require(auth.RoleViewer, http.HandlerFunc(s.handleERPStatus)))
+		protected.Handle("POST /api/v1/integrations/erp/poll", s.require(auth.RoleOperator, s.limit("/api/v1/integrations/erp/poll", s.handleERPPoll)))
+	}
+	if s.notifier != nil {
+		protected.Handle("GET /api/v1/notifications", s.require(auth.RoleViewer, http.HandlerFunc(s.handleNotifications)))
+		protected.Handle("POST /api/v1/notifications/test", s.require(auth.RoleAdmin, s.limit("/api/v1/notifications/test", s.handleNotifyTest)))
+	}
+	if s.cluster != nil {
+		protected.Handle("GET /api/v1/cluster", s.require(auth.RoleViewer, http.HandlerFunc(s.handleClusterStatus)))
+	}
+	if s.streamQueue != nil {
+		protected.Handle("GET /api/v1/queue", s.require(auth.RoleViewer, http.HandlerFunc(s.handleQueueStatus)))
+	}
+	if s.workQueue != nil {
+		protected.Handle("GET /api/v1/queue", s.require(auth.RoleViewer, http.HandlerFunc(s.handleQueueStatus)))
+		protected.Handle("POST /api/v1/queue/fetch", s.require(auth.RoleWorker, http.HandlerFunc(s.handleQueueFetch)))
+		protected.Handle("POST /api/v1/queue/deliveries/{id}/extend", s.require(auth.RoleWorker, http.HandlerFunc(s.handleQueueExtend)))
+		protected.Handle("POST /api/v1/queue/deliveries/{id}/ack", s.require(auth.RoleWorker, http.HandlerFunc(s.handleQueueAck)))
+		protected.Handle("POST /api/v1/queue/events", s.require(auth.RoleWorker, http.HandlerFunc(s.handleQueueEvents)))
+	}
+	if s.throughput != nil {
+		protected.Handle("GET /api/v1/throughput", s.require(auth.RoleViewer, http.HandlerFunc(s.handleThroughput)))
+	}
+	if s.reliability != nil {
+		protected.Handle("GET /api/v1/reliability", s.require(auth.RoleViewer, http.HandlerFunc(s.handleReliability)))
+	}
+	if s.yield != nil {
+		protected.Handle("GET /api/v1/yield", s.require(auth.RoleViewer, http.HandlerFunc(s.handleYield)))
+	}
+	if s.sla != nil {
+		protected.Handle("GET /api/v1/sla", s.require(auth.RoleViewer, http.HandlerFunc(s.handleSLA)))
+	}
+	if s.whatIf != nil {
+		protected.Handle("POST /api/v1/whatif", s.require(auth.RoleOperator, http.HandlerFunc(s.handleWhatIf)))
+	}
+	if s.chaos != nil {
+		protected.Handle("GET /api/v1/chaos", s.require(auth.RoleViewer, http.HandlerFunc(s.handleListChaos)))
+		protected.Handle("POST /api/v1/chaos", s.require(auth.RoleAdmin, http.HandlerFunc(s.handleInjectChaos)))
+		protected.Handle("DELETE /api/v1/chaos", s.require(auth.RoleAdmin, http.HandlerFunc(s.handleClearChaos)))
+		protected.Handle("DELETE /api/v1/chaos/{id}", s.require(auth.RoleAdmin, http.HandlerFunc(s.handleRemoveChaos)))
+	}
+	if s.replay != nil {
+		protected.Handle("GET /api/v1/replay", s.require(auth.RoleViewer, http.HandlerFunc(s.handleReplayStatus)))
+	}
+	authenticated := auth.Middleware(s.auth, s.metrics, s.logger)(http.MaxBytesHandler(recordRoute(s.leaderOnly(protected)), s.maxBodyBytes))
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", s.metricsHandler())
+	if s.wsTokens == nil {
+		mux.Handle("/ws", authenticated)
+	} else {
+		mux.HandleFunc("/ws", s.hub.ServeWs)
+	}
+	mux.HandleFunc("GET /api/versions", s.handleVersions)
+	mux.Handle(apiPrefix+"/", compress(authenticated))
+	mux.Handle("/api/", compress(legacyAPI(authenticated)))
+	mux.Handle("/", compress(staticHandler(staticFS(s.staticDir))))
+	return s.instrument(mux)
+}
+
+// metricsHandler 返回 Prometheus 指标接口，抓取方协商 OpenMetrics 格式时输出直方图的 exemplar (Trace ID)
+func (s *Server) metricsHandler() http.Handler {
+	reg := s.metrics.Registry()
+	return promhttp.InstrumentMetricHandler(reg, promhttp.HandlerFor(reg, promhttp.HandlerOpts{EnableOpenMetrics: true}))
+}
+
+// require 为处理函数加上角色校验
+func (s *Server) require(role auth.Role, h http.Handler) http.Handler {
+	return auth.RequireRole(role, s.metrics, s.logger)(h)
+}
+
+// limit 为会向调度器提交任务的处理函数加上限流，所有提交类接口共享同一个调用方配额
+func (s *Server) limit(route string, h http.HandlerFunc) http.Handler {
+	return ratelimit.Middleware(s.limiter, route, s.metrics, s.logger)(h)
+}
+
+// writeDecodeError 输出请求体解析失败的响应，请求体超过大小限制时返回 413
+func writeDecodeError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
+// writeJSON 以指定状态码输出 JSON 响应
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// handleState 返回当前全局状态快照，可以用 ids、types、stations、namespaces 查询参数过滤
+// 调用方绑定了命名空间时只返回这些命名空间中的工件
+func (s *Server) handleState(w http.ResponseWriter, r *http.Request) {
+	filter := web.FilterFromQuery(r.URL.Query()).Restrict(scopeOf(r))
+	writeJSON(w, http.StatusOK, filter.Apply(s.stateTracker.GetNamespaceSnapshot(filter.Namespaces)))
+}
+
+// submitRequest 是提交任务的请求体，Quantity 大于 0 时按拼板拆分为批次
+type submitRequest struct {
+	types.Product
+	Quantity int `json:"quantity"`
+}
+
+// handleSubmitTask 接收新的生产任务
+// 指定 quantity 时订单 ID 作为批次 ID，拆分为 quantity 块拼板分别提交
+func (s *Server) handleSubmitTask(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req submitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.logger.Warn("解析任务请求失败", "error", err)
+		writeDecodeError(w, err)
+		return
+	}
+	// 批次只能通过 quantity 拆分创建
+	p := req.Product
+	p.Lot = ""
+	namespace, err := resolveNamespace(r, p.Namespace)
+	if err != nil {
+		writeNamespaceError(w, err)
+		return
+	}
+	p.Namespace = namespace
+	if err := s.scheduler.Engine().Workflows().CheckProductType(p.Type); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if p.ID == "" {
+		p.ID = "API_ORDER_" + time.Now().Format("150405.000")
+	}
+	if req.Quantity != 0 {
+		s.submitLot(w, r, p, req.Quantity)
+		return
+	}
+	// 提交后引擎会并发修改工件，审计只记录提交前的快照
+	submitted := p.Snapshot()
+	s.scheduler.SubmitTask(&p)
+	s.audit(r, audit.ActionTaskSubmit, p.ID, p.Namespace, nil, submitted)
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "accepted", "id": p.ID, "namespace": p.Namespace})
+}
+
+// submitLot 将订单拆分为拼板并逐块提交，批次 ID 已存在或数量超出范围时返回 400
+func (s *Server) submitLot(w http.ResponseWriter, r *http.Request, order types.Product, quantity int) {
+	if s.lots == nil {
+		http.Error(w, "lots are not enabled", http.StatusBadRequest)
+		return
+	}
+	panels, err := s.lots.Split(order, quantity)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ids := make([]string, len(panels))
+	for i, p := range panels {
+		s.scheduler.SubmitTask(p)
+		ids[i] = p.ID
+	}
+	progress, _ := s.lots.Get(order.ID)
+	s.audit(r, audit.ActionLotSubmit, order.ID, order.Namespace, nil, progress)
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{"status": "accepted", "id": order.ID, "namespace": order.Namespace, "panels": ids})
+}
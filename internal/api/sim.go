@@ -0,0 +1,134 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"industrial-4.0-demo/internal/audit"
+	"industrial-4.0-demo/internal/simulator"
+	"io"
+	"net/http"
+)
+
+// SetSimulator 设置订单模拟器，设置后注册 /api/v1/sim 下的模拟控制接口
+func (s *Server) SetSimulator(sim *simulator.Simulator) {
+	s.simulator = sim
+}
+
+// decodeSimSettings 解析可选的模拟参数请求体，空请求体返回零值
+func decodeSimSettings(w http.ResponseWriter, r *http.Request) (simulator.Settings, bool) {
+	var settings simulator.Settings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil && !errors.Is(err, io.EOF) {
+		writeDecodeError(w, err)
+		return settings, false
+	}
+	return settings, true
+}
+
+// writeSimError 将模拟器返回的错误映射为 HTTP 状态码
+func writeSimError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, simulator.ErrRunning), errors.Is(err, simulator.ErrNotRunning):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, simulator.ErrUnknownScenario), errors.Is(err, simulator.ErrInvalidSettings), errors.Is(err, simulator.ErrInvalidScript):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, simulator.ErrScriptNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleSimStatus 返回模拟器的运行状态、当前参数和可选的场景
+func (s *Server) handleSimStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.simulator.Status())
+}
+
+// handleSimStart 按请求体中的参数启动模拟器，请求体为空时使用配置文件中的默认参数
+// 模拟器已在运行时返回 409
+func (s *Server) handleSimStart(w http.ResponseWriter, r *http.Request) {
+	settings, ok := decodeSimSettings(w, r)
+	if !ok {
+		return
+	}
+	before := s.simulator.Status()
+	status, err := s.simulator.Start(settings)
+	if err != nil {
+		writeSimError(w, err)
+		return
+	}
+	s.audit(r, audit.ActionSimStart, "simulator", "", simSnapshot(before), simSnapshot(status))
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handleSimStop 停止模拟器，已停止时同样返回 200
+func (s *Server) handleSimStop(w http.ResponseWriter, r *http.Request) {
+	before := s.simulator.Status()
+	status := s.simulator.Stop()
+	s.audit(r, audit.ActionSimStop, "simulator", "", simSnapshot(before), simSnapshot(status))
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handleSimUpdate 调整运行中模拟器的提交速率、产品配比和提交上限
+func (s *Server) handleSimUpdate(w http.ResponseWriter, r *http.Request) {
+	settings, ok := decodeSimSettings(w, r)
+	if !ok {
+		return
+	}
+	before := s.simulator.Status()
+	status, err := s.simulator.Update(settings)
+	if err != nil {
+		writeSimError(w, err)
+		return
+	}
+	s.audit(r, audit.ActionSimUpdate, "simulator", "", simSnapshot(before), simSnapshot(status))
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handleListScripts 返回场景目录中的所有场景文件
+func (s *Server) handleListScripts(w http.ResponseWriter, r *http.Request) {
+	scripts, err := s.simulator.Scripts()
+	if err != nil {
+		writeSimError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, scripts)
+}
+
+// handleRunScript 按名称运行场景文件，立即返回 202 和运行报告
+// wait=true 时等待运行结束 (或请求被取消) 后返回 200 和最终报告；上一次运行尚未结束时返回 409
+func (s *Server) handleRunScript(w http.ResponseWriter, r *http.Request) {
+	run, err := s.simulator.RunScript(r.PathValue("scenario"))
+	if err != nil {
+		writeSimError(w, err)
+		return
+	}
+	s.audit(r, audit.ActionSimRun, run.Scenario, "", nil, run)
+	if r.URL.Query().Get("wait") != "true" {
+		writeJSON(w, http.StatusAccepted, run)
+		return
+	}
+	run, _ = s.simulator.WaitRun(r.Context())
+	writeJSON(w, http.StatusOK, run)
+}
+
+// handleLastRun 返回最近一次场景运行的报告，从未运行时返回 404
+func (s *Server) handleLastRun(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.simulator.LastRun()
+	if !ok {
+		http.Error(w, "no scenario run", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, run)
+}
+
+// handleStopRun 停止正在进行的场景运行，已提交的工件不受影响，已结束时同样返回 200
+func (s *Server) handleStopRun(w http.ResponseWriter, r *http.Request) {
+	before, ok := s.simulator.LastRun()
+	if !ok {
+		http.Error(w, "no scenario run", http.StatusNotFound)
+		return
+	}
+	run, _ := s.simulator.StopScript()
+	s.audit(r, audit.ActionSimStop, run.Scenario, "", before.Status, run.Status)
+	writeJSON(w, http.StatusOK, run)
+}
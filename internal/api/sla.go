@@ -0,0 +1,37 @@
+package api
+
+import (
+	"errors"
+	"industrial-4.0-demo/internal/sla"
+	"industrial-4.0-demo/internal/windowed"
+	"net/http"
+	"time"
+)
+
+// SetSLA 设置交期追踪器，设置后注册 GET /api/v1/sla
+func (s *Server) SetSLA(tracker *sla.Tracker) {
+	s.sla = tracker
+}
+
+// handleSLA 返回统计窗口内各产品类型的准时交付率，以及当前预测会延期或已超过交期的工件，可通过 ?window= 指定窗口，默认 1 小时
+// 预测会延期的工件只包含调用方可以访问的命名空间
+func (s *Server) handleSLA(w http.ResponseWriter, r *http.Request) {
+	window, ok := reportWindow(r)
+	if !ok {
+		http.Error(w, "invalid window", http.StatusBadRequest)
+		return
+	}
+	report, err := s.sla.Report(window, time.Now())
+	if errors.Is(err, windowed.ErrTooLarge) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	visible := report.AtRisk[:0]
+	for _, o := range report.AtRisk {
+		if canAccess(r, o.Namespace) {
+			visible = append(visible, o)
+		}
+	}
+	report.AtRisk = visible
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"crypto/sha256"
+	"fmt"
+	webassets "industrial-4.0-demo/web"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// staticMaxAge 是非 HTML 静态资源的浏览器缓存时间 (秒)
+const staticMaxAge = 3600
+
+// staticFS 返回前端静态资源：dir 为空时使用编译进二进制的资源，否则直接读取磁盘目录 (便于开发时修改页面后立即生效)
+func staticFS(dir string) fs.FS {
+	if dir == "" {
+		return webassets.Static()
+	}
+	return os.DirFS(dir)
+}
+
+// staticHandler 提供前端静态资源，并为其加上缓存相关的响应头：
+// ETag 使 If-None-Match 请求可以直接返回 304，磁盘文件基于大小和修改时间生成，内嵌资源没有修改时间，基于内容摘要生成；
+// HTML 页面每次都需要重新验证，保证看板升级后立即生效，其他资源缓存 staticMaxAge 秒
+func staticHandler(fsys fs.FS) http.Handler {
+	fileServer := http.FileServer(http.FS(fsys))
+	var digests sync.Map // 内嵌资源的内容摘要，资源不会变化，按文件名缓存
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		if name == "" {
+			name = "index.html"
+		}
+		if f, err := fsys.Open(name); err == nil {
+			if info, err := f.Stat(); err == nil && !info.IsDir() {
+				etag := fmt.Sprintf(`W/"%x-%x"`, info.Size(), info.ModTime().UnixNano())
+				if info.ModTime().IsZero() {
+					if cached, ok := digests.Load(name); ok {
+						etag = cached.(string)
+					} else {
+						h := sha256.New()
+						if _, err := io.Copy(h, f); err == nil {
+							etag = fmt.Sprintf(`"%x"`, h.Sum(nil)[:16])
+							digests.Store(name, etag)
+						}
+					}
+				}
+				w.Header().Set("ETag", etag)
+				if strings.HasSuffix(name, ".html") {
+					w.Header().Set("Cache-Control", "no-cache")
+				} else {
+					w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", staticMaxAge))
+				}
+			}
+			f.Close()
+		}
+		fileServer.ServeHTTP(w, r)
+	})
+}
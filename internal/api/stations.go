@@ -0,0 +1,79 @@
+package api
+
+import (
+	"errors"
+	"industrial-4.0-demo/internal/audit"
+	"industrial-4.0-demo/internal/engine"
+	"industrial-4.0-demo/internal/types"
+	"industrial-4.0-demo/internal/web"
+	"net/http"
+)
+
+// StationDetail 是工站接口的响应体
+// 合并了注册表中的驱动与资源池信息，以及实时状态中的排队数和健康状态
+type StationDetail struct {
+	engine.StationInfo
+	QueueLength int     `json:"queue_length"`
+	Utilization float64 `json:"utilization"`
+	Health      string  `json:"health,omitempty"`
+}
+
+// handleListStations 返回所有已注册的工站
+func (s *Server) handleListStations(w http.ResponseWriter, r *http.Request) {
+	views := s.stateTracker.GetStateSnapshot().Stations
+	infos := s.scheduler.Engine().Stations().List()
+	details := make([]StationDetail, 0, len(infos))
+	for _, info := range infos {
+		details = append(details, stationDetail(info, views[info.ID]))
+	}
+	writeJSON(w, http.StatusOK, details)
+}
+
+// handleDisableStation 停用工站，之后到达该工站的工件直接失败并触发补偿
+func (s *Server) handleDisableStation(w http.ResponseWriter, r *http.Request) {
+	s.setStationEnabled(w, r, types.StationID(r.PathValue("id")), false)
+}
+
+// handleEnableStation 重新启用工站
+func (s *Server) handleEnableStation(w http.ResponseWriter, r *http.Request) {
+	s.setStationEnabled(w, r, types.StationID(r.PathValue("id")), true)
+}
+
+// setStationEnabled 切换工站的启用状态并返回最新的工站信息
+func (s *Server) setStationEnabled(w http.ResponseWriter, r *http.Request, id types.StationID, enabled bool) {
+	registry := s.scheduler.Engine().Stations()
+	var before *engine.StationInfo
+	for _, info := range registry.List() {
+		if info.ID == id {
+			before = &info
+		}
+	}
+	var (
+		info   engine.StationInfo
+		err    error
+		action = audit.ActionStationDisable
+	)
+	if enabled {
+		info, err = registry.Enable(id)
+		action = audit.ActionStationEnable
+	} else {
+		info, err = registry.Disable(id)
+	}
+	if errors.Is(err, engine.ErrStationNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	s.logger.Info("已切换工站启用状态", "station_id", id, "enabled", enabled)
+	s.audit(r, action, string(id), "", before, info)
+	writeJSON(w, http.StatusOK, stationDetail(info, s.stateTracker.GetStateSnapshot().Stations[id]))
+}
+
+// stationDetail 合并工站的注册信息与实时状态
+func stationDetail(info engine.StationInfo, view web.StationStatus) StationDetail {
+	return StationDetail{
+		StationInfo: info,
+		QueueLength: view.QueueLength,
+		Utilization: view.Utilization,
+		Health:      view.Health,
+	}
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"industrial-4.0-demo/internal/audit"
+	"industrial-4.0-demo/internal/engine"
+	"industrial-4.0-demo/internal/fsm"
+	"industrial-4.0-demo/internal/history"
+	"industrial-4.0-demo/internal/types"
+	"io"
+	"net/http"
+	"time"
+)
+
+// TaskDetail 是任务详情接口的响应体
+// 合并了实时状态 (当前工站、状态) 和加工履历 (步骤、失败与补偿详情)
+type TaskDetail struct {
+	ID        string                 `json:"id"`
+	Type      string                 `json:"type"`
+	Priority  int                    `json:"priority"`
+	Attrs     map[string]interface{} `json:"attrs,omitempty"`
+	Station   types.StationID        `json:"station"`
+	Status    string                 `json:"status"`
+	Lifecycle string                 `json:"lifecycle,omitempty"`
+	TraceID   string                 `json:"trace_id,omitempty"`
+	RetryOf   string                 `json:"retry_of,omitempty"`
+	Namespace string                 `json:"namespace,omitempty"`
+	Cost      *types.Cost            `json:"cost,omitempty"`    // 已完成步骤的加工成本汇总，未配置成本模型时为空
+	History   *history.Record        `json:"history,omitempty"` // 履历由事件异步写入，刚提交的任务可能还没有履历
+}
+
+// visibleTask 判断任务是否存在且调用方可以访问它所属的命名空间
+// 其他命名空间的任务对调用方视同不存在，不泄露任务 ID
+func (s *Server) visibleTask(r *http.Request, id string) bool {
+	if state, ok := s.stateTracker.GetProduct(id); ok {
+		return canAccess(r, state.Namespace)
+	}
+	if record, ok := s.history.Get(id); ok {
+		return canAccess(r, record.Namespace)
+	}
+	return false
+}
+
+// handleGetTask 返回单个任务的详情
+func (s *Server) handleGetTask(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	state, hasState := s.stateTracker.GetProduct(id)
+	record, hasRecord := s.history.Get(id)
+	if !s.visibleTask(r, id) {
+		http.Error(w, "task not found", http.StatusNotFound)
+		return
+	}
+
+	detail := TaskDetail{
+		ID:        id,
+		Type:      state.Type,
+		Priority:  state.Priority,
+		Attrs:     state.Attrs,
+		Station:   state.Station,
+		Status:    state.Status,
+		Lifecycle: state.Lifecycle,
+		Namespace: state.Namespace,
+	}
+	if hasRecord {
+		// 实时状态可能已被清理，此时使用履历中的工件信息
+		if !hasState {
+			detail.Type = record.Type
+			detail.Priority = record.Priority
+			detail.Attrs = record.Attrs
+			detail.Status = record.Outcome
+			detail.Namespace = record.Namespace
+		}
+		detail.TraceID = record.TraceID
+		detail.RetryOf = record.RetryOf
+		detail.Cost = record.Cost
+		detail.History = &record
+	}
+	writeJSON(w, http.StatusOK, detail)
+}
+
+// TaskTimeline 是任务时间线接口的响应体
+type TaskTimeline struct {
+	ID      string                  `json:"id"`
+	Status  string                  `json:"status"`
+	TraceID string                  `json:"trace_id,omitempty"`
+	Events  []history.TimelineEvent `json:"events"`
+}
+
+// handleGetTaskTimeline 返回任务按时间排序的事件列表：入队、派发、各步骤的排队/开始/结束、失败与补偿
+func (s *Server) handleGetTaskTimeline(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	state, hasState := s.stateTracker.GetProduct(id)
+	record, _ := s.history.Get(id)
+	if !s.visibleTask(r, id) {
+		http.Error(w, "task not found", http.StatusNotFound)
+		return
+	}
+
+	timeline := TaskTimeline{ID: id, Status: state.Status, TraceID: record.TraceID, Events: record.Timeline()}
+	if !hasState {
+		timeline.Status = record.Outcome
+	}
+	if timeline.Events == nil {
+		timeline.Events = []history.TimelineEvent{}
+	}
+	writeJSON(w, http.StatusOK, timeline)
+}
+
+// handleCancelTask 取消一个排队中或执行中的任务
+func (s *Server) handleCancelTask(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !s.visibleTask(r, id) {
+		http.Error(w, "task not found", http.StatusNotFound)
+		return
+	}
+
+	before, _ := s.stateTracker.GetProduct(id)
+	err := s.scheduler.Cancel(id)
+	switch {
+	case errors.Is(err, engine.ErrTaskNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, engine.ErrTaskFinished):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		after, _ := s.stateTracker.GetProduct(id)
+		s.audit(r, audit.ActionTaskCancel, id, before.Namespace, before, after)
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "cancelling", "id": id})
+	}
+}
+
+// retryRequest 是重试接口的可选请求体
+type retryRequest struct {
+	Priority *int                   `json:"priority,omitempty"` // 覆盖原任务的优先级
+	Attrs    map[string]interface{} `json:"attrs,omitempty"`    // 覆盖或追加原任务的属性
+}
+
+// handleRetryTask 基于一个失败或已补偿的任务创建新的生产任务
+// 新任务通过 retry_of 字段关联到原任务
+func (s *Server) handleRetryTask(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	record, ok := s.history.Get(id)
+	if !ok || !canAccess(r, record.Namespace) {
+		http.Error(w, "task not found", http.StatusNotFound)
+		return
+	}
+	if record.Outcome != string(fsm.StateFailed) && record.Outcome != string(fsm.StateCompensated) {
+		http.Error(w, "only FAILED or COMPENSATED tasks can be retried", http.StatusConflict)
+		return
+	}
+
+	var req retryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeDecodeError(w, err)
+		return
+	}
+
+	p := &types.Product{
+		ID:        id + "_RETRY_" + time.Now().Format("150405.000"),
+		Type:      record.Type,
+		Priority:  record.Priority,
+		Attrs:     make(map[string]interface{}, len(record.Attrs)+len(req.Attrs)),
+		RetryOf:   id,
+		Namespace: record.Namespace,
+		DueAt:     record.DueAt,
+	}
+	for k, v := range record.Attrs {
+		p.Attrs[k] = v
+	}
+	for k, v := range req.Attrs {
+		p.Attrs[k] = v
+	}
+	if req.Priority != nil {
+		p.Priority = *req.Priority
+	}
+	if err := s.scheduler.Engine().Workflows().CheckProductType(p.Type); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	submitted := p.Snapshot()
+	s.scheduler.SubmitTask(p)
+	s.audit(r, audit.ActionTaskRetry, p.ID, p.Namespace, nil, submitted)
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "accepted", "id": p.ID, "retry_of": id})
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"errors"
+	"industrial-4.0-demo/internal/throughput"
+	"industrial-4.0-demo/internal/windowed"
+	"net/http"
+	"time"
+)
+
+// SetThroughput 设置产出追踪器，设置后注册 GET /api/v1/throughput
+func (s *Server) SetThroughput(tracker *throughput.Tracker) {
+	s.throughput = tracker
+}
+
+// handleThroughput 返回统计窗口内的产出速率、滚动节拍和瓶颈工站，可通过 ?window= 指定窗口，默认 1 小时
+func (s *Server) handleThroughput(w http.ResponseWriter, r *http.Request) {
+	window, ok := reportWindow(r)
+	if !ok {
+		http.Error(w, "invalid window", http.StatusBadRequest)
+		return
+	}
+	report, err := s.throughput.Report(window, time.Now())
+	if errors.Is(err, windowed.ErrTooLarge) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"fmt"
+	"industrial-4.0-demo/internal/traceability"
+	"net/http"
+	"time"
+)
+
+// handleTaskTraceability 返回工件的追溯文档，?format= 选择 json (默认) / csv / pdf，其他命名空间的工件视同不存在
+func (s *Server) handleTaskTraceability(w http.ResponseWriter, r *http.Request) {
+	record, ok := s.history.Get(r.PathValue("id"))
+	if !ok || !canAccess(r, record.Namespace) {
+		http.Error(w, "task not found", http.StatusNotFound)
+		return
+	}
+	doc := traceability.Build(record, s.history.Get, time.Now())
+
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "", "json":
+		writeJSON(w, http.StatusOK, doc)
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", record.ProductID+"-traceability.csv"))
+		if err := traceability.WriteCSV(w, doc); err != nil {
+			s.logger.Warn("导出追溯文档失败", "product_id", record.ProductID, "format", format, "error", err)
+		}
+	case "pdf":
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", record.ProductID+"-traceability.pdf"))
+		if err := traceability.WritePDF(w, doc); err != nil {
+			s.logger.Warn("导出追溯文档失败", "product_id", record.ProductID, "format", format, "error", err)
+		}
+	default:
+		http.Error(w, fmt.Sprintf("unknown format %q, expected json / csv / pdf", format), http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"industrial-4.0-demo/internal/audit"
+	"industrial-4.0-demo/internal/importer"
+	"industrial-4.0-demo/internal/types"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// UploadResult 是批量上传订单接口的响应体
+type UploadResult struct {
+	LotID     string              `json:"lot_id"`    // 本批订单的批次号，写入每个订单的 attrs.lot_id
+	Namespace string              `json:"namespace"` // 本批订单所属的命名空间
+	DryRun    bool                `json:"dry_run"`   // 只校验、未提交
+	Accepted  []UploadedOrder     `json:"accepted"`  // 通过校验并已提交 (dry_run 时为将要提交) 的订单
+	Errors    []importer.RowError `json:"errors"`    // 逐行的校验错误，出错的行不会提交
+}
+
+// UploadedOrder 是一个通过校验的订单
+type UploadedOrder struct {
+	Row int    `json:"row"` // 在文件中的行号，表头为第 1 行
+	ID  string `json:"id"`
+}
+
+// readUpload 读取上传的文件：multipart/form-data 中的 file 字段，或直接作为请求体上传的文件
+func readUpload(r *http.Request) (data []byte, filename, contentType string, err error) {
+	contentType = r.Header.Get("Content-Type")
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "multipart/form-data" {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			return nil, "", "", fmt.Errorf("multipart field \"file\": %w", err)
+		}
+		defer file.Close()
+		data, err = io.ReadAll(file)
+		return data, header.Filename, header.Header.Get("Content-Type"), err
+	}
+	data, err = io.ReadAll(r.Body)
+	return data, "", contentType, err
+}
+
+// handleUploadTasks 批量上传订单清单 (CSV 或 XLSX)，逐行校验后将通过校验的订单作为一个批次提交
+// 列: id (为空时按批次号和行号生成)、type (必填)、priority、layers、due_date
+// 至少一行通过校验时返回 202，否则返回 422；?dry_run=true 时只校验不提交，?lot= 指定批次号，?namespace= 指定命名空间
+func (s *Server) handleUploadTasks(w http.ResponseWriter, r *http.Request) {
+	namespace, err := resolveNamespace(r, r.URL.Query().Get("namespace"))
+	if err != nil {
+		writeNamespaceError(w, err)
+		return
+	}
+	data, filename, contentType, err := readUpload(r)
+	if err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	format := importer.DetectFormat(filename, contentType, data)
+	orders, rowErrs, err := importer.Parse(data, format)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, importer.ErrMissingColumn) {
+			status = http.StatusUnprocessableEntity
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	result := UploadResult{
+		LotID:     r.URL.Query().Get("lot"),
+		Namespace: namespace,
+		DryRun:    r.URL.Query().Get("dry_run") == "true",
+		Accepted:  []UploadedOrder{},
+		Errors:    rowErrs,
+	}
+	if result.LotID == "" {
+		result.LotID = "LOT_" + time.Now().Format("20060102_150405.000")
+	}
+
+	// 产品类型必须有对应的工作流，订单 ID 不能与实时状态中的任务重复
+	workflows := s.scheduler.Engine().Workflows()
+	products := make([]*types.Product, 0, len(orders))
+	for _, order := range orders {
+		if _, ok := workflows.Current(order.Type); !ok {
+			result.Errors = append(result.Errors, importer.RowError{Row: order.Row, Column: "type", Message: fmt.Sprintf("unknown product type %q", order.Type)})
+			continue
+		}
+		if order.ID == "" {
+			order.ID = fmt.Sprintf("%s_%03d", result.LotID, order.Row)
+		}
+		if _, exists := s.stateTracker.GetProduct(order.ID); exists {
+			result.Errors = append(result.Errors, importer.RowError{Row: order.Row, Column: "id", Message: fmt.Sprintf("order id %q already exists", order.ID)})
+			continue
+		}
+		p := &types.Product{ID: order.ID, Type: order.Type, Priority: order.Priority, Namespace: namespace, Attrs: map[string]interface{}{"lot_id": result.LotID}}
+		if order.Layers > 0 {
+			p.Attrs["layers"] = order.Layers
+		}
+		if !order.DueDate.IsZero() {
+			p.DueAt = order.DueDate
+			p.Attrs["due_date"] = order.DueDate.Format(time.RFC3339)
+		}
+		products = append(products, p)
+		result.Accepted = append(result.Accepted, UploadedOrder{Row: order.Row, ID: order.ID})
+	}
+	if result.Errors == nil {
+		result.Errors = []importer.RowError{}
+	}
+
+	if len(products) == 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, result)
+		return
+	}
+	if !result.DryRun {
+		for _, p := range products {
+			s.scheduler.SubmitTask(p)
+		}
+		s.logger.Info("批量订单已提交", "lot_id", result.LotID, "accepted", len(products), "rejected_rows", len(result.Errors), "format", format, "namespace", namespace)
+		s.audit(r, audit.ActionTaskUpload, result.LotID, namespace, nil, result)
+	}
+	writeJSON(w, http.StatusAccepted, result)
+}
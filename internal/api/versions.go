@@ -0,0 +1,48 @@
+package api
+
+import (
+	"industrial-4.0-demo/internal/buildinfo"
+	"net/http"
+	"strings"
+)
+
+// API 版本
+const (
+	apiVersion = "v1"                 // 当前版本
+	apiPrefix  = "/api/" + apiVersion // 当前版本的路由前缀
+)
+
+// VersionInfo 是版本协商接口的响应体
+type VersionInfo struct {
+	Current  string   `json:"current"`  // 当前推荐使用的版本
+	Versions []string `json:"versions"` // 所有可用的版本
+	Prefix   string   `json:"prefix"`   // 当前版本的路由前缀
+}
+
+// handleVersions 返回可用的 API 版本，客户端据此选择路由前缀
+func (s *Server) handleVersions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, VersionInfo{Current: apiVersion, Versions: []string{apiVersion}, Prefix: apiPrefix})
+}
+
+// handleVersion 返回二进制的版本、提交、Go 版本、运行时长和加载的配置摘要
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, buildinfo.Get())
+}
+
+// legacyAPI 将未带版本号的旧路径 /api/... 转发到当前版本 /api/v1/...，
+// 并通过 Deprecation 和 Link 响应头提示客户端迁移
+func legacyAPI(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		successor := apiPrefix + strings.TrimPrefix(r.URL.Path, "/api")
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+
+		r2 := new(http.Request)
+		*r2 = *r
+		u := *r.URL
+		u.Path = successor
+		u.RawPath = ""
+		r2.URL = &u
+		next.ServeHTTP(w, r2)
+	})
+}
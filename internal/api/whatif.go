@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"industrial-4.0-demo/internal/types"
+	"industrial-4.0-demo/internal/whatif"
+	"net/http"
+)
+
+// whatIfRequest 是 what-if 仿真接口的请求体
+type whatIfRequest struct {
+	Scenarios []whatif.Scenario `json:"scenarios"`
+}
+
+// whatIfResponse 是 what-if 仿真接口的响应，结果与请求中的场景一一对应
+type whatIfResponse struct {
+	Results []whatif.Result `json:"results"`
+}
+
+// SetWhatIf 设置 what-if 仿真的静态基线 (各工站的加工时间、失败率和步骤间的移动时间)，设置后注册 POST /api/v1/whatif
+// worker 数、资源池容量和工作流在每次仿真时取当前的运行值
+func (s *Server) SetWhatIf(base whatif.Baseline) {
+	s.whatIf = &base
+}
+
+// handleWhatIf 在虚拟时钟上依次仿真请求中的场景，返回每个场景的交付周期、吞吐量、利用率和队列统计
+func (s *Server) handleWhatIf(w http.ResponseWriter, r *http.Request) {
+	var req whatIfRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	if len(req.Scenarios) == 0 || len(req.Scenarios) > whatif.MaxScenarios {
+		http.Error(w, fmt.Sprintf("scenarios must contain 1 to %d entries", whatif.MaxScenarios), http.StatusBadRequest)
+		return
+	}
+
+	base := *s.whatIf
+	base.Workers = s.scheduler.State().Workers
+	base.Machines = make(map[types.StationID]int)
+	for _, info := range s.scheduler.Engine().Stations().List() {
+		base.Machines[info.ID] = info.PoolSize
+	}
+	base.Routes = s.scheduler.Engine().Workflows().Route
+
+	resp := whatIfResponse{Results: make([]whatif.Result, 0, len(req.Scenarios))}
+	for i, sc := range req.Scenarios {
+		if sc.Name == "" {
+			sc.Name = fmt.Sprintf("scenario-%d", i+1)
+		}
+		result, err := whatif.Run(base, sc)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("scenarios[%d]: %v", i, err), http.StatusBadRequest)
+			return
+		}
+		resp.Results = append(resp.Results, result)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
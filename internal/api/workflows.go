@@ -0,0 +1,110 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"industrial-4.0-demo/internal/audit"
+	"industrial-4.0-demo/internal/engine"
+	"industrial-4.0-demo/internal/types"
+	"net/http"
+	"strconv"
+)
+
+// workflowRequest 是创建和更新工作流接口的请求体
+type workflowRequest struct {
+	Name  string               `json:"name"` // 仅创建时使用，更新时以路径中的名称为准
+	Steps []types.WorkflowStep `json:"steps"`
+}
+
+// handleListWorkflows 返回所有工作流的当前版本
+func (s *Server) handleListWorkflows(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.scheduler.Engine().Workflows().List())
+}
+
+// handleGetWorkflow 返回工作流的当前版本，可通过 ?version= 查询历史版本
+func (s *Server) handleGetWorkflow(w http.ResponseWriter, r *http.Request) {
+	store := s.scheduler.Engine().Workflows()
+	name := r.PathValue("name")
+
+	var (
+		def engine.WorkflowDefinition
+		ok  bool
+	)
+	if v := r.URL.Query().Get("version"); v != "" {
+		version, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "invalid version", http.StatusBadRequest)
+			return
+		}
+		def, ok = store.Version(name, version)
+	} else {
+		def, ok = store.Current(name)
+	}
+	if !ok {
+		http.Error(w, engine.ErrWorkflowNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, def)
+}
+
+// handleCreateWorkflow 校验并创建一个新的工作流
+func (s *Server) handleCreateWorkflow(w http.ResponseWriter, r *http.Request) {
+	var req workflowRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	def, err := s.scheduler.Engine().CreateWorkflow(req.Name, req.Steps)
+	if err != nil {
+		writeWorkflowError(w, err)
+		return
+	}
+	s.logger.Info("已创建工作流", "workflow", def.Name, "version", def.Version)
+	s.audit(r, audit.ActionWorkflowCreate, def.Name, "", nil, def)
+	writeJSON(w, http.StatusCreated, def)
+}
+
+// handleUpdateWorkflow 校验并发布工作流的新版本
+func (s *Server) handleUpdateWorkflow(w http.ResponseWriter, r *http.Request) {
+	var req workflowRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	before, _ := s.scheduler.Engine().Workflows().Current(r.PathValue("name"))
+	def, err := s.scheduler.Engine().UpdateWorkflow(r.PathValue("name"), req.Steps)
+	if err != nil {
+		writeWorkflowError(w, err)
+		return
+	}
+	s.logger.Info("已更新工作流", "workflow", def.Name, "version", def.Version)
+	s.audit(r, audit.ActionWorkflowUpdate, def.Name, "", before, def)
+	writeJSON(w, http.StatusOK, def)
+}
+
+// handleDeleteWorkflow 删除一个工作流，之后该类型的工件使用默认工作流
+func (s *Server) handleDeleteWorkflow(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	before, _ := s.scheduler.Engine().Workflows().Current(name)
+	if err := s.scheduler.Engine().Workflows().Delete(name); err != nil {
+		writeWorkflowError(w, err)
+		return
+	}
+	s.logger.Info("已删除工作流", "workflow", name)
+	s.audit(r, audit.ActionWorkflowDelete, name, "", before, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeWorkflowError 将工作流管理的错误映射为 HTTP 状态码
+func writeWorkflowError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, engine.ErrInvalidWorkflow):
+		status = http.StatusUnprocessableEntity
+	case errors.Is(err, engine.ErrWorkflowNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, engine.ErrWorkflowExists), errors.Is(err, engine.ErrWorkflowProtected):
+		status = http.StatusConflict
+	}
+	http.Error(w, err.Error(), status)
+}
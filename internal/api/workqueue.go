@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"industrial-4.0-demo/internal/auth"
+	"industrial-4.0-demo/internal/types"
+	"industrial-4.0-demo/internal/workqueue"
+	"net/http"
+	"time"
+)
+
+// maxFetchWait 是 worker 长轮询拉取任务的最长等待时间，需要小于 server.write_timeout_seconds
+const maxFetchWait = 30 * time.Second
+
+// SetWorkQueue 设置共享工作队列，设置后注册 /api/v1/queue 下供 worker 进程拉取、续期、确认任务和转发事件的接口
+func (s *Server) SetWorkQueue(q *workqueue.Queue) {
+	s.workQueue = q
+}
+
+// SetStreamQueue 设置 Redis Streams 工作队列，设置后注册 GET /api/v1/queue；worker 直接访问 Redis，不注册 worker 接口
+func (s *Server) SetStreamQueue(q *workqueue.StreamQueue) {
+	s.streamQueue = q
+}
+
+// deliveryRequest 是续期和确认的请求体
+type deliveryRequest struct {
+	Worker     string            `json:"worker"`
+	Product    *types.Product    `json:"product"`    // 执行后的工件 (仅确认)
+	Checkpoint *types.Checkpoint `json:"checkpoint"` // worker 最近完成的步骤 (仅续期)
+}
+
+// eventsRequest 是转发事件的请求体
+type eventsRequest struct {
+	Worker string            `json:"worker"`
+	Events []workqueue.Event `json:"events"`
+}
+
+// workerOf 返回请求的 worker 标识：启用认证时加上调用方标识作为前缀，
+// 不同凭据的 worker 即使名称相同也互不影响，无法续期、确认其他凭据的投递或替其转发事件
+func workerOf(r *http.Request, worker string) string {
+	if p, ok := auth.PrincipalFromContext(r.Context()); ok {
+		return p.Subject + "/" + worker
+	}
+	return worker
+}
+
+// handleQueueStatus 返回工作队列中等待和执行中的任务
+func (s *Server) handleQueueStatus(w http.ResponseWriter, r *http.Request) {
+	if s.streamQueue != nil {
+		writeJSON(w, http.StatusOK, s.streamQueue.Status())
+		return
+	}
+	writeJSON(w, http.StatusOK, s.workQueue.Status())
+}
+
+// handleQueueFetch 为 worker 拉取一个调用方可以访问的命名空间中的任务，队列为空时最多等待 wait (默认 0，最长 30s)，期间没有任务返回 204
+func (s *Server) handleQueueFetch(w http.ResponseWriter, r *http.Request) {
+	worker := r.URL.Query().Get("worker")
+	if worker == "" {
+		http.Error(w, "worker is required", http.StatusBadRequest)
+		return
+	}
+	var wait time.Duration
+	if raw := r.URL.Query().Get("wait"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 {
+			http.Error(w, "invalid wait: "+raw, http.StatusBadRequest)
+			return
+		}
+		wait = min(d, maxFetchWait)
+	}
+	msg, ok := s.workQueue.Fetch(r.Context(), workerOf(r, worker), scopeOf(r), wait)
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, msg)
+}
+
+// handleQueueExtend 延长投递的确认期限并记录 worker 上报的检查点，返回投递；投递已失效返回 404
+func (s *Server) handleQueueExtend(w http.ResponseWriter, r *http.Request) {
+	var req deliveryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	msg, err := s.workQueue.Extend(r.PathValue("id"), workerOf(r, req.Worker), req.Checkpoint)
+	if errors.Is(err, workqueue.ErrUnknownDelivery) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, msg)
+}
+
+// handleQueueAck 确认投递执行结束，返回 204；缺少工件返回 400，投递已失效返回 404
+func (s *Server) handleQueueAck(w http.ResponseWriter, r *http.Request) {
+	var req deliveryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	if req.Product == nil {
+		http.Error(w, "product is required", http.StatusBadRequest)
+		return
+	}
+	if err := s.workQueue.Ack(r.PathValue("id"), workerOf(r, req.Worker), *req.Product); errors.Is(err, workqueue.ErrUnknownDelivery) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleQueueEvents 将 worker 转发的事件发布到编排器的事件总线，返回 204
+func (s *Server) handleQueueEvents(w http.ResponseWriter, r *http.Request) {
+	var req eventsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	s.workQueue.Publish(workerOf(r, req.Worker), req.Events)
+	w.WriteHeader(http.StatusNoContent)
+}
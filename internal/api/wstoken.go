@@ -0,0 +1,37 @@
+package api
+
+import (
+	"industrial-4.0-demo/internal/auth"
+	"net/http"
+	"time"
+)
+
+// WSToken 是 GET /api/v1/ws-token 的响应体
+type WSToken struct {
+	Token     string    `json:"token"`      // 以 /ws?token= 传入的连接令牌
+	ExpiresAt time.Time `json:"expires_at"` // 令牌的过期时间，过期后需重新获取
+}
+
+// SetWSTokens 设置 WebSocket 令牌签发器，设置后 /ws 只接受通过 GET /api/v1/ws-token 换取的短期令牌
+func (s *Server) SetWSTokens(issuer *auth.WSTokenIssuer) {
+	s.wsTokens = issuer
+	s.hub.SetTokenVerifier(func(token string) ([]string, error) {
+		p, err := issuer.Verify(token)
+		if err != nil {
+			return nil, err
+		}
+		return p.Namespaces, nil
+	})
+}
+
+// handleWSToken 为当前调用方签发一个短期有效的 WebSocket 连接令牌
+func (s *Server) handleWSToken(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	token, expiresAt, err := s.wsTokens.Issue(principal)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, WSToken{Token: token, ExpiresAt: expiresAt})
+}
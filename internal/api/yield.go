@@ -0,0 +1,29 @@
+package api
+
+import (
+	"errors"
+	"industrial-4.0-demo/internal/windowed"
+	"industrial-4.0-demo/internal/yield"
+	"net/http"
+	"time"
+)
+
+// SetYield 设置良率追踪器，设置后注册 GET /api/v1/yield
+func (s *Server) SetYield(tracker *yield.Tracker) {
+	s.yield = tracker
+}
+
+// handleYield 返回统计窗口内各产品类型的最终良率、各工站的良率和报废成本归因，可通过 ?window= 指定窗口，默认 1 小时
+func (s *Server) handleYield(w http.ResponseWriter, r *http.Request) {
+	window, ok := reportWindow(r)
+	if !ok {
+		http.Error(w, "invalid window", http.StatusBadRequest)
+		return
+	}
+	report, err := s.yield.Report(window, time.Now())
+	if errors.Is(err, windowed.ErrTooLarge) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
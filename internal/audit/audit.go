@@ -0,0 +1,175 @@
+// Package audit 将由调用方触发的操作 (提交/取消任务、修改工作流、控制调度器、停用工站等) 追加写入独立的 JSONL 审计日志
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 审计的操作，按 "对象.动作" 命名，查询时可以按前缀过滤 (例如 workflow)
+const (
+	ActionTaskSubmit       = "task.submit"
+	ActionTaskUpload       = "task.upload"
+	ActionTaskImport       = "task.import"
+	ActionTaskCancel       = "task.cancel"
+	ActionTaskRetry        = "task.retry"
+	ActionLotSubmit        = "lot.submit"
+	ActionWorkflowCreate   = "workflow.create"
+	ActionWorkflowUpdate   = "workflow.update"
+	ActionWorkflowDelete   = "workflow.delete"
+	ActionSchedulerPause   = "scheduler.pause"
+	ActionSchedulerResume  = "scheduler.resume"
+	ActionSchedulerDrain   = "scheduler.drain"
+	ActionSchedulerWorkers = "scheduler.workers"
+	ActionSchedulerPlan    = "scheduler.plan"
+	ActionWALFlush         = "scheduler.wal_flush"
+	ActionWALCompact       = "scheduler.wal_compact"
+	ActionStationDisable   = "station.disable"
+	ActionStationEnable    = "station.enable"
+	ActionAlertAck         = "alert.ack"
+	ActionAlertAssign      = "alert.assign"
+	ActionAlertResolve     = "alert.resolve"
+	ActionWorkOrderClose   = "maintenance.close"
+	ActionSimStart         = "sim.start"
+	ActionSimUpdate        = "sim.update"
+	ActionSimStop          = "sim.stop"
+	ActionSimRun           = "sim.run"
+	ActionLogLevel         = "logging.level"
+	ActionConfigPatch      = "config.patch"
+	ActionFeatureToggle    = "feature.toggle"
+	ActionChaosInject      = "chaos.inject"
+	ActionChaosRemove      = "chaos.remove"
+	ActionERPPoll          = "erp.poll"
+	ActionNotifyTest       = "notifications.test"
+)
+
+// Anonymous 是未启用认证时记录的调用方
+const Anonymous = "anonymous"
+
+// Entry 是审计日志中的一条记录
+type Entry struct {
+	Time       time.Time       `json:"time"`
+	Actor      string          `json:"actor"`                 // 调用方标识 (API Key 名称或 JWT 的 sub)，未启用认证时为 anonymous
+	AuthMethod string          `json:"auth_method,omitempty"` // 认证方式: api_key / jwt
+	RemoteAddr string          `json:"remote_addr,omitempty"`
+	Source     string          `json:"source"` // 操作的入口: http / grpc
+	Action     string          `json:"action"`
+	Target     string          `json:"target,omitempty"`    // 操作对象: 任务 ID、工作流名称、工站 ID 等
+	Namespace  string          `json:"namespace,omitempty"` // 操作对象所属的命名空间，调度器和工站等车间级对象为空
+	Before     json.RawMessage `json:"before,omitempty"`    // 操作前的快照
+	After      json.RawMessage `json:"after,omitempty"`     // 操作后的快照
+}
+
+// Snapshot 将对象序列化为审计快照，v 为 nil 或无法序列化时返回 nil
+func Snapshot(v interface{}) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// Query 是查询审计日志的条件，零值字段不参与过滤
+type Query struct {
+	Action  string           // 操作前缀，例如 workflow 或 task.cancel
+	Actor   string           // 调用方
+	Target  string           // 操作对象
+	Since   time.Time        // 只返回该时间之后的记录
+	Limit   int              // 最多返回的记录数，<= 0 时不限制
+	Visible func(Entry) bool // 判断调用方能否看到记录，为 nil 时全部可见
+}
+
+// matches 判断记录是否符合查询条件
+func (q Query) matches(e Entry) bool {
+	switch {
+	case q.Action != "" && !strings.HasPrefix(e.Action, q.Action):
+		return false
+	case q.Actor != "" && e.Actor != q.Actor:
+		return false
+	case q.Target != "" && e.Target != q.Target:
+		return false
+	case !q.Since.IsZero() && e.Time.Before(q.Since):
+		return false
+	case q.Visible != nil && !q.Visible(e):
+		return false
+	}
+	return true
+}
+
+// Log 是只追加的审计日志文件，每条记录占一行 JSON
+type Log struct {
+	path string
+	file *os.File
+	mu   sync.Mutex // 保证每条记录完整地写入一行
+}
+
+// Open 创建或打开审计日志文件，已有的记录保留
+func Open(path string) (*Log, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &Log{path: path, file: file}, nil
+}
+
+// Record 追加一条记录并刷新到磁盘，未设置时间时使用当前时间
+func (l *Log) Record(e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return l.file.Sync()
+}
+
+// Query 从文件中读取符合条件的记录，最新的在前；无法解析的行 (例如写入中断留下的半行) 被跳过
+func (l *Log) Query(q Query) ([]Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	file, err := os.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := []Entry{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if q.matches(e) {
+			entries = append(entries, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	slices.Reverse(entries)
+	if q.Limit > 0 && len(entries) > q.Limit {
+		entries = entries[:q.Limit]
+	}
+	return entries, nil
+}
+
+// Close 关闭审计日志文件
+func (l *Log) Close() error {
+	return l.file.Close()
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"industrial-4.0-demo/internal/config"
+	"net/http"
+	"strings"
+)
+
+// 认证过程中可能返回的错误
+var (
+	ErrNoCredentials      = errors.New("no credentials provided")       // 请求未携带凭证 (401)
+	ErrInvalidCredentials = errors.New("invalid credentials")           // 凭证无效或已过期 (401)
+	ErrForbidden          = errors.New("credentials not accepted here") // 凭证有效但不允许访问 (403)
+)
+
+// Principal 表示通过认证的调用方
+type Principal struct {
+	Subject    string   // 调用方标识 (API Key 名称或 JWT 的 sub)
+	Method     string   // 认证方式: "api_key" 或 "jwt"
+	Roles      []Role   // 调用方拥有的角色
+	Namespaces []string // 调用方可以访问的命名空间 (产线)，为空时不限制
+}
+
+// Authenticator 定义了可插拔的认证器接口
+// 请求未携带该认证器能识别的凭证时应返回 ErrNoCredentials，以便链上的其他认证器继续尝试
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// Chain 按顺序尝试多个认证器，第一个识别出凭证的认证器决定认证结果
+type Chain []Authenticator
+
+// Authenticate 实现 Authenticator 接口
+func (c Chain) Authenticate(r *http.Request) (*Principal, error) {
+	for _, a := range c {
+		p, err := a.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return p, err
+	}
+	return nil, ErrNoCredentials
+}
+
+// New 根据配置创建认证器，认证未启用时返回 nil
+func New(cfg config.AuthConfig) Authenticator {
+	if !cfg.Enabled {
+		return nil
+	}
+	var chain Chain
+	if len(cfg.APIKeys) > 0 {
+		chain = append(chain, NewAPIKeyAuthenticator(cfg.APIKeys))
+	}
+	if cfg.JWT.Secret != "" {
+		chain = append(chain, NewJWTAuthenticator(cfg.JWT, cfg.Roles))
+	}
+	return chain
+}
+
+// APIKeyAuthenticator 使用静态 API Key 进行认证
+// Key 从 X-API-Key 请求头读取，WebSocket 连接可使用 api_key 查询参数
+type APIKeyAuthenticator struct {
+	keys []config.APIKeyConfig
+}
+
+// NewAPIKeyAuthenticator 创建一个新的 API Key 认证器
+func NewAPIKeyAuthenticator(keys []config.APIKeyConfig) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{keys: keys}
+}
+
+// Authenticate 实现 Authenticator 接口
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		key = r.URL.Query().Get("api_key")
+	}
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	for _, k := range a.keys {
+		// 使用常量时间比较，避免基于时间的侧信道攻击
+		if subtle.ConstantTimeCompare([]byte(k.Key), []byte(key)) == 1 {
+			return &Principal{Subject: k.Name, Method: "api_key", Roles: parseRoles(k.Roles), Namespaces: k.Namespaces}, nil
+		}
+	}
+	return nil, ErrInvalidCredentials
+}
+
+// bearerToken 从 Authorization 请求头或 access_token 查询参数中提取 Bearer Token
+func bearerToken(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); h != "" {
+		if token, ok := strings.CutPrefix(h, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+	}
+	return r.URL.Query().Get("access_token")
+}
+
+// contextKey 是一个私有类型，用于避免 context key 的冲突
+type contextKey string
+
+const principalKey contextKey = "principal"
+
+// ContextWithPrincipal 将调用方信息注入到 Context 中
+func ContextWithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey, p)
+}
+
+// PrincipalFromContext 从 Context 中提取调用方信息
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey).(*Principal)
+	return p, ok
+}
@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"industrial-4.0-demo/internal/config"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Claims 定义了本系统使用的 JWT 声明
+type Claims struct {
+	Subject    string   `json:"sub"`
+	Issuer     string   `json:"iss,omitempty"`
+	Audience   Audience `json:"aud,omitempty"`
+	ExpiresAt  int64    `json:"exp,omitempty"`
+	NotBefore  int64    `json:"nbf,omitempty"`
+	IssuedAt   int64    `json:"iat,omitempty"`
+	Roles      []string `json:"roles,omitempty"`      // 调用方角色 (viewer/operator/admin/worker)
+	Namespaces []string `json:"namespaces,omitempty"` // 调用方可以访问的命名空间，为空时不限制
+}
+
+// Audience 兼容 JWT 中 aud 为字符串或字符串数组两种写法
+type Audience []string
+
+// UnmarshalJSON 实现 json.Unmarshaler 接口
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var multi []string
+	if err := json.Unmarshal(data, &multi); err != nil {
+		return err
+	}
+	*a = multi
+	return nil
+}
+
+// contains 判断受众列表中是否包含指定值
+func (a Audience) contains(v string) bool {
+	for _, aud := range a {
+		if aud == v {
+			return true
+		}
+	}
+	return false
+}
+
+// JWTAuthenticator 使用 HS256 签名的 JWT Bearer Token 进行认证
+type JWTAuthenticator struct {
+	cfg          config.JWTConfig
+	subjectRoles map[string][]string // 按 sub 在配置中额外分配的角色
+	now          func() time.Time    // 当前时间，测试时可替换
+}
+
+// NewJWTAuthenticator 创建一个新的 JWT 认证器
+// subjectRoles 中为某个 sub 配置的角色会与 Token 中 roles 声明的角色合并
+func NewJWTAuthenticator(cfg config.JWTConfig, subjectRoles map[string][]string) *JWTAuthenticator {
+	return &JWTAuthenticator{cfg: cfg, subjectRoles: subjectRoles, now: time.Now}
+}
+
+// Authenticate 实现 Authenticator 接口
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	token := bearerToken(r)
+	if token == "" {
+		return nil, ErrNoCredentials
+	}
+	claims, err := a.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	// 注意：Viper 会将配置中的 map key 转换为小写，查找时同样使用小写
+	roles := append(append([]string(nil), claims.Roles...), a.subjectRoles[strings.ToLower(claims.Subject)]...)
+	return &Principal{Subject: claims.Subject, Method: "jwt", Roles: parseRoles(roles), Namespaces: claims.Namespaces}, nil
+}
+
+// Verify 校验 Token 的签名和声明，返回解析后的声明
+func (a *JWTAuthenticator) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidCredentials)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return nil, fmt.Errorf("%w: unsupported token header", ErrInvalidCredentials)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, a.sign(parts[0]+"."+parts[1])) {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidCredentials)
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims", ErrInvalidCredentials)
+	}
+
+	// 没有 exp 的 Token 永不过期，泄露后无法失效，一律拒绝
+	now := a.now().Unix()
+	if claims.ExpiresAt == 0 {
+		return nil, fmt.Errorf("%w: token has no expiry", ErrInvalidCredentials)
+	}
+	if now >= claims.ExpiresAt {
+		return nil, fmt.Errorf("%w: token expired", ErrInvalidCredentials)
+	}
+	if claims.NotBefore != 0 && now < claims.NotBefore {
+		return nil, fmt.Errorf("%w: token not yet valid", ErrInvalidCredentials)
+	}
+	// 签名有效但签发者或受众不匹配：Token 是真实的，只是不是签发给本服务的
+	if a.cfg.Issuer != "" && claims.Issuer != a.cfg.Issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer", ErrForbidden)
+	}
+	if a.cfg.Audience != "" && !claims.Audience.contains(a.cfg.Audience) {
+		return nil, fmt.Errorf("%w: unexpected audience", ErrForbidden)
+	}
+	return &claims, nil
+}
+
+// Sign 使用配置的密钥签发一个 HS256 Token
+func (a *JWTAuthenticator) Sign(claims Claims) (string, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(a.sign(signingInput)), nil
+}
+
+// sign 计算签名输入的 HMAC-SHA256
+func (a *JWTAuthenticator) sign(input string) []byte {
+	mac := hmac.New(sha256.New, []byte(a.cfg.Secret))
+	mac.Write([]byte(input))
+	return mac.Sum(nil)
+}
+
+// decodeSegment 解码 Token 中的一段 base64url JSON
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
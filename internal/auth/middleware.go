@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"errors"
+	"industrial-4.0-demo/internal/metrics"
+	"log/slog"
+	"net/http"
+)
+
+// Middleware 返回一个认证中间件
+// 认证失败时返回 401 (缺少或无效凭证) 或 403 (凭证有效但不被接受)，并记录认证失败指标
+// authenticator 为 nil 时表示未启用认证，请求直接放行
+func Middleware(authenticator Authenticator, m *metrics.Metrics, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if authenticator == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, err := authenticator.Authenticate(r)
+			if err != nil {
+				status, reason := http.StatusUnauthorized, "invalid"
+				switch {
+				case errors.Is(err, ErrNoCredentials):
+					reason = "missing"
+				case errors.Is(err, ErrForbidden):
+					status, reason = http.StatusForbidden, "forbidden"
+				}
+				m.AuthFailuresTotal.WithLabelValues(reason).Inc()
+				logger.Warn("API 认证失败", "error", err, "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+				if status == http.StatusUnauthorized {
+					w.Header().Set("WWW-Authenticate", `Bearer realm="factory"`)
+				}
+				http.Error(w, http.StatusText(status), status)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(ContextWithPrincipal(r.Context(), principal)))
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"industrial-4.0-demo/internal/types"
+	"slices"
+)
+
+// ErrInvalidNamespace 表示命名空间名称不合法
+var ErrInvalidNamespace = errors.New("invalid namespace")
+
+// CanAccess 判断调用方是否可以访问指定命名空间中的工件
+// p 为 nil (未启用认证) 或调用方未绑定命名空间时不受限制
+func (p *Principal) CanAccess(namespace string) bool {
+	return p == nil || len(p.Namespaces) == 0 || slices.Contains(p.Namespaces, namespace)
+}
+
+// ScopeFromContext 返回 Context 中调用方可以访问的命名空间，未启用认证或调用方不受限制时为空
+func ScopeFromContext(ctx context.Context) []string {
+	if p, ok := PrincipalFromContext(ctx); ok {
+		return p.Namespaces
+	}
+	return nil
+}
+
+// ResolveNamespace 确定调用方提交的任务所属的命名空间，p 为 nil 表示未启用认证
+// 未指定时使用调用方绑定的第一个命名空间，调用方不受限制时使用默认命名空间
+// 名称不合法时返回 ErrInvalidNamespace，调用方无权访问时返回 ErrForbidden
+func ResolveNamespace(p *Principal, requested string) (string, error) {
+	if requested == "" {
+		if p != nil && len(p.Namespaces) > 0 {
+			return p.Namespaces[0], nil
+		}
+		return types.DefaultNamespace, nil
+	}
+	if !types.IsValidNamespace(requested) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidNamespace, requested)
+	}
+	if !p.CanAccess(requested) {
+		return "", fmt.Errorf("%w: namespace %s", ErrForbidden, requested)
+	}
+	return requested, nil
+}
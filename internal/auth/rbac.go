@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"industrial-4.0-demo/internal/metrics"
+	"log/slog"
+	"net/http"
+)
+
+// Role 定义 API 调用方的角色
+type Role string
+
+// 定义所有角色，除 worker 外权限依次递增：高级角色拥有低级角色的全部权限
+const (
+	RoleViewer   Role = "viewer"   // 查看者：只读访问状态和任务
+	RoleOperator Role = "operator" // 操作员：提交、取消、重试任务
+	RoleAdmin    Role = "admin"    // 管理员：控制调度器、管理工站
+	RoleWorker   Role = "worker"   // worker 进程：从工作队列拉取、续期、确认任务并转发事件，不在权限层级中
+)
+
+// roleLevels 定义角色的权限级别，0 表示不在权限层级中，只有拥有该角色本身才满足要求
+var roleLevels = map[Role]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+	RoleWorker:   0,
+}
+
+// IsValid 判断角色名称是否受支持
+func (r Role) IsValid() bool {
+	_, ok := roleLevels[r]
+	return ok
+}
+
+// HasRole 判断调用方是否拥有指定角色 (或更高级的角色)
+func (p *Principal) HasRole(required Role) bool {
+	for _, r := range p.Roles {
+		if r == required || roleLevels[required] > 0 && roleLevels[r] >= roleLevels[required] {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRoles 将字符串列表转换为角色列表，忽略未知角色
+func parseRoles(names []string) []Role {
+	var roles []Role
+	for _, name := range names {
+		if r := Role(name); r.IsValid() {
+			roles = append(roles, r)
+		}
+	}
+	return roles
+}
+
+// RequireRole 返回一个要求调用方拥有指定角色的中间件，权限不足时返回 403
+// 必须挂载在认证中间件之后；Context 中没有调用方信息说明未启用认证，此时直接放行
+func RequireRole(required Role, m *metrics.Metrics, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := PrincipalFromContext(r.Context())
+			if ok && !principal.HasRole(required) {
+				m.AuthFailuresTotal.WithLabelValues("forbidden").Inc()
+				logger.Warn("API 权限不足", "subject", principal.Subject, "roles", principal.Roles, "required", required, "path", r.URL.Path)
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
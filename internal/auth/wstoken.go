@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"industrial-4.0-demo/internal/config"
+	"time"
+)
+
+// wsTokenAudience 是 WebSocket 令牌的受众，使令牌无法被当作 API 的 JWT 使用
+const wsTokenAudience = "factory-ws"
+
+// defaultWSTokenTTL 是 WebSocket 令牌的默认有效期，只需覆盖从获取令牌到发起连接的时间
+const defaultWSTokenTTL = 30 * time.Second
+
+// WSTokenIssuer 为已认证的调用方签发短期有效的 WebSocket 连接令牌
+// 浏览器无法为 WebSocket 握手设置请求头，令牌通过 token 查询参数传递，避免将长期有效的 API Key 写入 URL
+type WSTokenIssuer struct {
+	signer *JWTAuthenticator
+	ttl    time.Duration
+}
+
+// NewWSTokenIssuer 创建一个 WebSocket 令牌签发器
+// 未配置密钥时在启动时随机生成，此时令牌只能由签发它的实例校验
+func NewWSTokenIssuer(cfg config.WSTokenConfig) (*WSTokenIssuer, error) {
+	secret := cfg.Secret
+	if secret == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, fmt.Errorf("generate ws token secret: %w", err)
+		}
+		secret = hex.EncodeToString(buf)
+	}
+	ttl := time.Duration(cfg.TTLSeconds) * time.Second
+	if ttl <= 0 {
+		ttl = defaultWSTokenTTL
+	}
+	return &WSTokenIssuer{
+		signer: NewJWTAuthenticator(config.JWTConfig{Secret: secret, Audience: wsTokenAudience}, nil),
+		ttl:    ttl,
+	}, nil
+}
+
+// Issue 为调用方签发一个令牌，令牌携带调用方的标识、角色和可以访问的命名空间
+func (i *WSTokenIssuer) Issue(p *Principal) (token string, expiresAt time.Time, err error) {
+	if p == nil {
+		return "", time.Time{}, errors.New("no principal to issue ws token for")
+	}
+	now := i.signer.now()
+	expiresAt = now.Add(i.ttl)
+	roles := make([]string, len(p.Roles))
+	for n, r := range p.Roles {
+		roles[n] = string(r)
+	}
+	token, err = i.signer.Sign(Claims{
+		Subject:    p.Subject,
+		Audience:   Audience{wsTokenAudience},
+		IssuedAt:   now.Unix(),
+		ExpiresAt:  expiresAt.Unix(),
+		Roles:      roles,
+		Namespaces: p.Namespaces,
+	})
+	return token, expiresAt, err
+}
+
+// Verify 校验令牌的签名、有效期和受众，并要求调用方至少拥有 viewer 角色
+func (i *WSTokenIssuer) Verify(token string) (*Principal, error) {
+	if token == "" {
+		return nil, ErrNoCredentials
+	}
+	claims, err := i.signer.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	if claims.ExpiresAt == 0 {
+		return nil, fmt.Errorf("%w: ws token without expiry", ErrInvalidCredentials)
+	}
+	p := &Principal{Subject: claims.Subject, Method: "ws_token", Roles: parseRoles(claims.Roles), Namespaces: claims.Namespaces}
+	if !p.HasRole(RoleViewer) {
+		return nil, fmt.Errorf("%w: ws token lacks viewer role", ErrForbidden)
+	}
+	return p, nil
+}
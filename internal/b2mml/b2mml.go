@@ -0,0 +1,270 @@
+// Package b2mml 导入 ISA-95 B2MML 格式的排产计划 (ProductionSchedule)，将段需求转换为工件或批次提交给调度器
+//
+// 每个段需求 (SegmentRequirement) 按工艺段映射到一个产品类型 (工作流)：优先使用 segment_types 中配置的映射，
+// 未配置时工艺段 ID 本身必须是已定义的工作流；数量大于 1 的段需求按拼板拆分为批次。
+// 排产计划可以通过 API 上传，也可以放入监视的目录，由 Watch 定期导入
+package b2mml
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"industrial-4.0-demo/internal/engine"
+	"industrial-4.0-demo/internal/lot"
+	"industrial-4.0-demo/internal/metrics"
+	"industrial-4.0-demo/internal/types"
+	"industrial-4.0-demo/internal/web"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// 导入的来源，用于 b2mml_segment_requirements_total 指标
+const (
+	SourceHTTP = "http"
+	SourceDir  = "dir"
+)
+
+// 监视目录中存放已导入文件的子目录
+const (
+	ProcessedDir = "processed" // 至少一个段需求已提交
+	FailedDir    = "failed"    // 无法解析或没有可提交的段需求
+)
+
+// Options 定义段需求到产品类型的映射和监视的目录
+type Options struct {
+	Dir          string            `mapstructure:"dir"`           // 监视的目录，为空时只能通过 API 导入
+	PollMs       int               `mapstructure:"poll_ms"`       // 扫描目录的间隔
+	Namespace    string            `mapstructure:"namespace"`     // 从目录导入的工件所属的命名空间，为空时使用默认命名空间
+	SegmentTypes map[string]string `mapstructure:"segment_types"` // 工艺段 ID 到产品类型的映射，不区分大小写
+}
+
+// Order 是一个已提交 (dry_run 时为将要提交) 的段需求
+type Order struct {
+	ID        string   `json:"id"`
+	RequestID string   `json:"request_id"`
+	SegmentID string   `json:"segment_id"`
+	Segment   string   `json:"segment"`
+	Type      string   `json:"type"`
+	Quantity  int      `json:"quantity"`
+	Panels    []string `json:"panels,omitempty"` // 数量大于 1 时拆分出的拼板
+}
+
+// Result 是一次导入的结果
+type Result struct {
+	ScheduleID string  `json:"schedule_id,omitempty"`
+	Namespace  string  `json:"namespace"`
+	DryRun     bool    `json:"dry_run"`  // 只校验、未提交
+	Accepted   []Order `json:"accepted"` // 通过校验并已提交的段需求
+	Errors     []Issue `json:"errors"`   // 校验错误，出错的段需求不会提交
+}
+
+// Importer 将排产计划转换为工件提交给调度器
+type Importer struct {
+	scheduler    *engine.Scheduler
+	stateTracker *web.StateTracker
+	lots         *lot.Tracker // 为 nil 时数量大于 1 的段需求被拒绝
+	segmentTypes map[string]string
+	metrics      *metrics.Metrics
+	logger       *slog.Logger
+}
+
+// New 创建一个导入器
+func New(opts Options, scheduler *engine.Scheduler, st *web.StateTracker, lots *lot.Tracker, m *metrics.Metrics, logger *slog.Logger) *Importer {
+	segmentTypes := make(map[string]string, len(opts.SegmentTypes))
+	for segment, productType := range opts.SegmentTypes {
+		segmentTypes[strings.ToUpper(segment)] = strings.ToUpper(productType)
+	}
+	return &Importer{
+		scheduler:    scheduler,
+		stateTracker: st,
+		lots:         lots,
+		segmentTypes: segmentTypes,
+		metrics:      m,
+		logger:       logger.With("component", "b2mml"),
+	}
+}
+
+// Import 解析排产计划并提交通过校验的段需求，dryRun 时只校验不提交
+// 文件不是合法的 ProductionSchedule 时返回 error，校验错误记录在 Result.Errors 中
+func (i *Importer) Import(data []byte, namespace, source string, dryRun bool) (Result, error) {
+	schedule, issues, err := Parse(data)
+	if err != nil {
+		return Result{}, err
+	}
+	result := Result{
+		ScheduleID: schedule.ID,
+		Namespace:  namespace,
+		DryRun:     dryRun,
+		Accepted:   []Order{},
+		Errors:     issues,
+	}
+
+	workflows := i.scheduler.Engine().Workflows()
+	products := make([]*types.Product, 0, len(schedule.Requirements))
+	for _, r := range schedule.Requirements {
+		issue := func(field, format string, args ...any) {
+			result.Errors = append(result.Errors, Issue{Request: r.RequestID, Segment: r.SegmentID, Field: field, Message: fmt.Sprintf(format, args...)})
+		}
+		productType, ok := i.productType(r.Segment)
+		if _, defined := workflows.Current(productType); !ok || !defined {
+			issue("ProcessSegmentID", "segment %q is not mapped to a workflow", r.Segment)
+			continue
+		}
+		if _, exists := i.stateTracker.GetProduct(r.ID); exists {
+			issue("ID", "order id %q already exists", r.ID)
+			continue
+		}
+		if r.Quantity > 1 {
+			if i.lots == nil {
+				issue("Quantity", "lots are not enabled")
+				continue
+			}
+			if _, exists := i.lots.Get(r.ID); exists {
+				issue("ID", "lot %q already exists", r.ID)
+				continue
+			}
+		}
+
+		p := &types.Product{
+			ID:        r.ID,
+			Type:      productType,
+			Priority:  r.Priority,
+			Namespace: namespace,
+			DueAt:     r.DueDate,
+			Attrs: map[string]interface{}{
+				"production_request": r.RequestID,
+				"segment":            r.Segment,
+			},
+		}
+		if schedule.ID != "" {
+			p.Attrs["schedule_id"] = schedule.ID
+		}
+		if r.Material != "" {
+			p.Attrs["material"] = r.Material
+		}
+		if !r.DueDate.IsZero() {
+			p.Attrs["due_date"] = r.DueDate.Format(time.RFC3339)
+		}
+		products = append(products, p)
+		result.Accepted = append(result.Accepted, Order{ID: r.ID, RequestID: r.RequestID, SegmentID: r.SegmentID, Segment: r.Segment, Type: productType, Quantity: r.Quantity})
+	}
+
+	if !dryRun {
+		for n, p := range products {
+			if result.Accepted[n].Quantity == 1 {
+				i.scheduler.SubmitTask(p)
+				continue
+			}
+			panels, err := i.lots.Split(*p, result.Accepted[n].Quantity)
+			if err != nil {
+				// 校验之后批次 ID 被并发占用
+				result.Errors = append(result.Errors, Issue{Request: result.Accepted[n].RequestID, Segment: result.Accepted[n].SegmentID, Field: "ID", Message: err.Error()})
+				result.Accepted[n].ID = ""
+				continue
+			}
+			for _, panel := range panels {
+				i.scheduler.SubmitTask(panel)
+				result.Accepted[n].Panels = append(result.Accepted[n].Panels, panel.ID)
+			}
+		}
+		result.Accepted = slices.DeleteFunc(result.Accepted, func(o Order) bool { return o.ID == "" })
+		i.metrics.B2MMLSegmentRequirementsTotal.WithLabelValues(source, "accepted").Add(float64(len(result.Accepted)))
+		i.metrics.B2MMLSegmentRequirementsTotal.WithLabelValues(source, "rejected").Add(float64(len(result.Errors)))
+		i.logger.Info("排产计划已导入", "schedule_id", schedule.ID, "source", source, "accepted", len(result.Accepted),
+			"errors", len(result.Errors), "namespace", namespace)
+	}
+	if result.Errors == nil {
+		result.Errors = []Issue{}
+	}
+	return result, nil
+}
+
+// productType 返回工艺段对应的产品类型，未配置映射时工艺段 ID 本身作为产品类型
+func (i *Importer) productType(segment string) (string, bool) {
+	segment = strings.ToUpper(segment)
+	if productType, ok := i.segmentTypes[segment]; ok {
+		return productType, true
+	}
+	return segment, segment != ""
+}
+
+// Watch 每隔 interval 扫描目录中的 .xml 文件并按文件名顺序导入，直到 ctx 结束
+// 导入后文件连同结果 (<文件名>.result.json) 移入 processed 或 failed 子目录；
+// 写入方应先写入其他扩展名的临时文件再重命名，避免读到不完整的文件
+func (i *Importer) Watch(ctx context.Context, dir, namespace string, interval time.Duration) {
+	if namespace == "" {
+		namespace = types.DefaultNamespace
+	}
+	for _, sub := range []string{ProcessedDir, FailedDir} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			i.logger.Error("创建排产计划目录失败", "dir", dir, "error", err)
+			return
+		}
+	}
+	i.logger.Info("开始监视排产计划目录", "dir", dir, "interval", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		i.scan(dir, namespace)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// scan 导入目录中的所有 .xml 文件
+func (i *Importer) scan(dir, namespace string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		i.logger.Warn("读取排产计划目录失败", "dir", dir, "error", err)
+		return
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !strings.EqualFold(filepath.Ext(entry.Name()), ".xml") {
+			continue
+		}
+		i.importFile(dir, entry.Name(), namespace)
+	}
+}
+
+// importFile 导入一个文件，并将文件和导入结果移入 processed 或 failed 子目录
+func (i *Importer) importFile(dir, name, namespace string) {
+	path := filepath.Join(dir, name)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		i.logger.Warn("读取排产计划失败", "file", path, "error", err)
+		return
+	}
+	result, err := i.Import(data, namespace, SourceDir, false)
+	var report any = result
+	dest := ProcessedDir
+	switch {
+	case err != nil:
+		i.logger.Warn("排产计划无法解析", "file", path, "error", err)
+		report = map[string]string{"error": err.Error()}
+		dest = FailedDir
+	case len(result.Accepted) == 0:
+		dest = FailedDir
+	}
+
+	target := filepath.Join(dir, dest, name)
+	if err := os.Rename(path, target); err != nil {
+		// 文件无法移走时删除，避免下次扫描重复导入
+		i.logger.Error("移动排产计划失败", "file", path, "error", err)
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			i.logger.Error("删除排产计划失败", "file", path, "error", err)
+		}
+		return
+	}
+	out, _ := json.MarshalIndent(report, "", "  ")
+	if err := os.WriteFile(target+".result.json", out, 0o644); err != nil {
+		i.logger.Warn("写入导入结果失败", "file", target, "error", err)
+	}
+}
@@ -0,0 +1,226 @@
+package b2mml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"industrial-4.0-demo/internal/lot"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotSchedule 表示文件不是 B2MML ProductionSchedule 文档
+var ErrNotSchedule = errors.New("not a B2MML ProductionSchedule document")
+
+// 以下结构只包含本包使用的 B2MML 元素，元素按本地名称匹配，不校验命名空间和版本
+type (
+	xmlSchedule struct {
+		XMLName  xml.Name     `xml:"ProductionSchedule"`
+		ID       string       `xml:"ID"`
+		Requests []xmlRequest `xml:"ProductionRequest"`
+	}
+	xmlRequest struct {
+		ID       string       `xml:"ID"`
+		Priority string       `xml:"Priority"`
+		EndTime  string       `xml:"EndTime"`
+		Segments []xmlSegment `xml:"SegmentRequirement"`
+	}
+	xmlSegment struct {
+		ID               string        `xml:"ID"`
+		ProcessSegmentID string        `xml:"ProcessSegmentID"`
+		ProductSegmentID string        `xml:"ProductSegmentID"`
+		LatestEndTime    string        `xml:"LatestEndTime"`
+		Materials        []xmlMaterial `xml:"MaterialProducedRequirement"`
+	}
+	xmlMaterial struct {
+		MaterialDefinitionID string        `xml:"MaterialDefinitionID"`
+		Quantity             []xmlQuantity `xml:"Quantity"`
+	}
+	xmlQuantity struct {
+		QuantityString string `xml:"QuantityString"`
+		UnitOfMeasure  string `xml:"UnitOfMeasure"`
+	}
+)
+
+// Requirement 是排产计划中的一个段需求，数量为 1 时转换为一个工件，否则拆分为一个批次
+type Requirement struct {
+	ID        string    // 工件或批次的 ID：生产请求只有一个段需求时为请求 ID，否则为请求 ID 加上 _段需求 ID
+	RequestID string    // 生产请求 ID
+	SegmentID string    // 段需求 ID
+	Segment   string    // 工艺段 ID (ProcessSegmentID)，缺省时为产品段 ID (ProductSegmentID)
+	Material  string    // 产出物料的定义 ID
+	Quantity  int       // 产出数量，多个产出物料的数量累加，未填写时为 1
+	Priority  int       // 生产请求的优先级，未填写时为 0
+	DueDate   time.Time // 段需求的最晚结束时间，缺省时为生产请求的结束时间
+}
+
+// Issue 是某个生产请求或段需求的校验错误，出错的段需求不会提交
+type Issue struct {
+	Request string `json:"request"`           // 生产请求 ID
+	Segment string `json:"segment,omitempty"` // 段需求 ID，整个生产请求出错时为空
+	Field   string `json:"field,omitempty"`   // 出错的元素
+	Message string `json:"message"`
+}
+
+func (e Issue) Error() string {
+	target := "request " + e.Request
+	if e.Segment != "" {
+		target += ", segment " + e.Segment
+	}
+	if e.Field != "" {
+		target += ", " + e.Field
+	}
+	return target + ": " + e.Message
+}
+
+// Schedule 是解析后的排产计划
+type Schedule struct {
+	ID           string
+	Requirements []Requirement
+}
+
+// timeLayouts 是 xs:dateTime 支持的格式，不带时区时按本地时间解析
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"}
+
+// Parse 解析 B2MML ProductionSchedule，支持的子集：生产请求的 ID、优先级和结束时间，
+// 段需求的工艺段、最晚结束时间和产出物料的数量
+// 返回通过校验的段需求和逐项的校验错误；文件不是合法的 XML 或根元素不是 ProductionSchedule 时返回 error
+func Parse(data []byte) (Schedule, []Issue, error) {
+	var doc xmlSchedule
+	if err := xml.NewDecoder(bytes.NewReader(data)).Decode(&doc); err != nil {
+		var unexpected xml.UnmarshalError
+		if errors.As(err, &unexpected) {
+			return Schedule{}, nil, fmt.Errorf("%w: %v", ErrNotSchedule, err)
+		}
+		return Schedule{}, nil, fmt.Errorf("read xml: %w", err)
+	}
+
+	schedule := Schedule{ID: strings.TrimSpace(doc.ID)}
+	var issues []Issue
+	seen := make(map[string]bool) // 已出现的生产请求 ID
+	for n, req := range doc.Requests {
+		id := strings.TrimSpace(req.ID)
+		if id == "" {
+			issues = append(issues, Issue{Request: fmt.Sprintf("#%d", n+1), Field: "ID", Message: "production request id is required"})
+			continue
+		}
+		if seen[id] {
+			issues = append(issues, Issue{Request: id, Field: "ID", Message: "duplicate production request id"})
+			continue
+		}
+		seen[id] = true
+		if len(req.Segments) == 0 {
+			issues = append(issues, Issue{Request: id, Field: "SegmentRequirement", Message: "no segment requirement"})
+			continue
+		}
+
+		var requestIssues []Issue
+		priority := 0
+		if v := strings.TrimSpace(req.Priority); v != "" {
+			p, err := strconv.Atoi(v)
+			if err != nil || p < 0 {
+				requestIssues = append(requestIssues, Issue{Request: id, Field: "Priority", Message: fmt.Sprintf("invalid priority %q", v)})
+			}
+			priority = p
+		}
+		due, err := parseTime(req.EndTime)
+		if err != nil {
+			requestIssues = append(requestIssues, Issue{Request: id, Field: "EndTime", Message: err.Error()})
+		}
+		if len(requestIssues) > 0 {
+			issues = append(issues, requestIssues...)
+			continue
+		}
+
+		segmentIDs := make(map[string]bool)
+		for k, seg := range req.Segments {
+			r := Requirement{
+				ID:        id,
+				RequestID: id,
+				SegmentID: strings.TrimSpace(seg.ID),
+				Segment:   strings.TrimSpace(seg.ProcessSegmentID),
+				Priority:  priority,
+				DueDate:   due,
+			}
+			if r.SegmentID == "" {
+				r.SegmentID = fmt.Sprintf("SEG%02d", k+1)
+			}
+			if len(req.Segments) > 1 {
+				r.ID = id + "_" + r.SegmentID
+			}
+			if r.Segment == "" {
+				r.Segment = strings.TrimSpace(seg.ProductSegmentID)
+			}
+			if segIssues := r.fill(seg, segmentIDs); len(segIssues) > 0 {
+				issues = append(issues, segIssues...)
+				continue
+			}
+			schedule.Requirements = append(schedule.Requirements, r)
+		}
+	}
+	return schedule, issues, nil
+}
+
+// fill 校验段需求并填写工艺段之外的字段，返回校验错误
+func (r *Requirement) fill(seg xmlSegment, seen map[string]bool) []Issue {
+	var issues []Issue
+	issue := func(field, format string, args ...any) {
+		issues = append(issues, Issue{Request: r.RequestID, Segment: r.SegmentID, Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+	if seen[r.SegmentID] {
+		issue("ID", "duplicate segment requirement id")
+	}
+	seen[r.SegmentID] = true
+	if r.Segment == "" {
+		issue("ProcessSegmentID", "process or product segment id is required")
+	}
+	if v := strings.TrimSpace(seg.LatestEndTime); v != "" {
+		due, err := parseTime(v)
+		if err != nil {
+			issue("LatestEndTime", "%v", err)
+		}
+		r.DueDate = due
+	}
+
+	total := 0.0
+	for _, m := range seg.Materials {
+		if r.Material == "" {
+			r.Material = strings.TrimSpace(m.MaterialDefinitionID)
+		}
+		for _, q := range m.Quantity {
+			v := strings.TrimSpace(q.QuantityString)
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil || n <= 0 || n != math.Trunc(n) {
+				issue("Quantity", "invalid quantity %q", v)
+				continue
+			}
+			total += n
+		}
+	}
+	switch {
+	case total == 0:
+		r.Quantity = 1
+	case total > lot.MaxQuantity:
+		issue("Quantity", "quantity %v exceeds %d", total, lot.MaxQuantity)
+	default:
+		r.Quantity = int(total)
+	}
+	return issues
+}
+
+// parseTime 解析 xs:dateTime，空字符串返回零值
+func parseTime(v string) (time.Time, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date time %q", v)
+}
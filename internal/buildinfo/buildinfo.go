@@ -0,0 +1,92 @@
+// Package buildinfo 记录二进制的版本、提交和 Go 版本，以及进程启动时间和加载的配置摘要，供看板核对数据由哪个版本和配置产生
+package buildinfo
+
+import (
+	"cmp"
+	"industrial-4.0-demo/internal/metrics"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// 构建时通过 -ldflags "-X industrial-4.0-demo/internal/buildinfo.Version=... -X industrial-4.0-demo/internal/buildinfo.Commit=..." 注入
+// 未注入时从 Go 模块的构建信息中读取 (go build 会记录 VCS 提交)
+var (
+	Version = "dev"
+	Commit  = ""
+)
+
+// started 是进程启动时间
+var started = time.Now()
+
+var (
+	mu         sync.Mutex
+	configHash string
+)
+
+// Info 是版本接口的响应体
+type Info struct {
+	Version       string    `json:"version"`
+	Commit        string    `json:"commit"`
+	GoVersion     string    `json:"go_version"`
+	StartedAt     time.Time `json:"started_at"`
+	UptimeSeconds float64   `json:"uptime_seconds"`
+	ConfigHash    string    `json:"config_hash,omitempty"` // 加载的配置的摘要，配置相同的实例摘要相同
+}
+
+// Get 返回当前的构建信息和运行时长
+func Get() Info {
+	mu.Lock()
+	hash := configHash
+	mu.Unlock()
+	version, commit := resolve()
+	return Info{
+		Version:       version,
+		Commit:        commit,
+		GoVersion:     runtime.Version(),
+		StartedAt:     started,
+		UptimeSeconds: time.Since(started).Seconds(),
+		ConfigHash:    hash,
+	}
+}
+
+// SetConfigHash 记录加载的配置的摘要
+func SetConfigHash(hash string) {
+	mu.Lock()
+	defer mu.Unlock()
+	configHash = hash
+}
+
+// Observe 将构建信息和配置摘要写入 m 的 build_info、config_info 和 process_uptime_seconds 指标，应在 SetConfigHash 之后调用
+func Observe(m *metrics.Metrics) {
+	info := Get()
+	m.ObserveBuild(info.Version, info.Commit, info.GoVersion, info.ConfigHash, started)
+}
+
+// resolve 返回版本和提交，未通过 -ldflags 注入时使用模块版本和 VCS 提交，工作区有未提交的修改时提交带 -dirty 后缀
+func resolve() (version, commit string) {
+	version, commit = Version, Commit
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return version, cmp.Or(commit, "unknown")
+	}
+	if version == "dev" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+		version = bi.Main.Version
+	}
+	if commit == "" {
+		var modified bool
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				commit = s.Value
+			case "vcs.modified":
+				modified = s.Value == "true"
+			}
+		}
+		if commit != "" && modified {
+			commit += "-dirty"
+		}
+	}
+	return version, cmp.Or(commit, "unknown")
+}
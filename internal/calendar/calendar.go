@@ -0,0 +1,312 @@
+// Package calendar 描述工站的班次、休息和计划停机：班次之外、休息期间和计划停机窗口内工站离线
+// 引擎不向离线的工站派发工件，OEE 将离线时间计为计划停机，不计入计划生产时间
+package calendar
+
+import (
+	"errors"
+	"fmt"
+	"industrial-4.0-demo/internal/types"
+	"slices"
+	"strings"
+	"time"
+)
+
+// horizon 是查询工站何时恢复在线时向后查找的最长时间，超过后调用方需要再次查询
+const horizon = 8 * 24 * time.Hour
+
+// 离线的原因
+const (
+	ReasonOffShift = "off_shift" // 不在任何班次内
+	ReasonBreak    = "break"     // 班次内的休息
+	ReasonDowntime = "downtime"  // 计划停机
+)
+
+// weekdays 是 days 中可以使用的星期名称
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Spec 是配置文件中的日历，为空时所有工站全天在线
+type Spec struct {
+	Timezone string     `mapstructure:"timezone"` // 班次和休息使用的时区，为空时使用本地时区
+	Shifts   []Period   `mapstructure:"shifts"`   // 班次，工站不适用任何班次时全天工作
+	Breaks   []Period   `mapstructure:"breaks"`   // 班次内的休息
+	Downtime []Downtime `mapstructure:"downtime"` // 计划停机窗口
+}
+
+// Period 是每天重复的时间段，例如班次或休息
+type Period struct {
+	Name     string            `mapstructure:"name"`
+	Start    string            `mapstructure:"start"`    // HH:MM
+	End      string            `mapstructure:"end"`      // HH:MM，不晚于 start 时跨越午夜
+	Days     []string          `mapstructure:"days"`     // 开始的星期 (mon ~ sun)，为空时每天
+	Stations []types.StationID `mapstructure:"stations"` // 适用的工站，为空时适用于所有工站
+}
+
+// Downtime 是一次计划停机
+type Downtime struct {
+	Name     string            `mapstructure:"name"`
+	From     string            `mapstructure:"from"` // RFC 3339 时间
+	To       string            `mapstructure:"to"`
+	Stations []types.StationID `mapstructure:"stations"` // 停机的工站，为空时所有工站停机
+}
+
+// Window 是一段离线时间
+type Window struct {
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	Reason string    `json:"reason"`         // off_shift / break / downtime
+	Name   string    `json:"name,omitempty"` // 休息或计划停机的名称
+}
+
+// period 是解析后的每天重复的时间段
+type period struct {
+	name     string
+	start    time.Duration // 距午夜的时长
+	length   time.Duration
+	days     []time.Weekday
+	stations []types.StationID
+}
+
+// Calendar 是解析后的日历，nil 的 *Calendar 表示所有工站全天在线
+type Calendar struct {
+	loc      *time.Location
+	shifts   []period
+	breaks   []period
+	downtime []Window
+	stations [][]types.StationID // 与 downtime 一一对应
+}
+
+// New 解析日历，返回的错误逐行列出所有问题，以出错的配置项开头 (例如 shifts[0].start)
+// 日历为空时返回 nil
+func New(spec Spec) (*Calendar, error) {
+	if len(spec.Shifts) == 0 && len(spec.Breaks) == 0 && len(spec.Downtime) == 0 {
+		return nil, nil
+	}
+	var errs []error
+	c := &Calendar{loc: time.Local}
+	if spec.Timezone != "" {
+		loc, err := time.LoadLocation(spec.Timezone)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("timezone: 未知的时区 %q", spec.Timezone))
+		}
+		c.loc = loc
+	}
+	for i, s := range spec.Shifts {
+		p, err := parsePeriod(s)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("shifts[%d].%w", i, err))
+		}
+		c.shifts = append(c.shifts, p)
+	}
+	for i, b := range spec.Breaks {
+		p, err := parsePeriod(b)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("breaks[%d].%w", i, err))
+		}
+		c.breaks = append(c.breaks, p)
+	}
+	for i, d := range spec.Downtime {
+		from, err := time.Parse(time.RFC3339, d.From)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("downtime[%d].from: %q 不是 RFC 3339 时间", i, d.From))
+		}
+		to, err := time.Parse(time.RFC3339, d.To)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("downtime[%d].to: %q 不是 RFC 3339 时间", i, d.To))
+		} else if !to.After(from) {
+			errs = append(errs, fmt.Errorf("downtime[%d].to: 必须晚于 from", i))
+		}
+		c.downtime = append(c.downtime, Window{From: from, To: to, Reason: ReasonDowntime, Name: d.Name})
+		c.stations = append(c.stations, normalize(d.Stations))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// parsePeriod 解析每天重复的时间段，错误以出错的字段开头
+func parsePeriod(s Period) (period, error) {
+	p := period{name: s.Name, stations: normalize(s.Stations)}
+	start, err := parseClock(s.Start)
+	if err != nil {
+		return p, fmt.Errorf("start: %w", err)
+	}
+	end, err := parseClock(s.End)
+	if err != nil {
+		return p, fmt.Errorf("end: %w", err)
+	}
+	p.start, p.length = start, end-start
+	if p.length <= 0 {
+		p.length += 24 * time.Hour
+	}
+	for _, day := range s.Days {
+		d, ok := weekdays[strings.ToLower(day)]
+		if !ok {
+			return p, fmt.Errorf("days: 未知的星期 %q，可选 mon / tue / wed / thu / fri / sat / sun", day)
+		}
+		p.days = append(p.days, d)
+	}
+	return p, nil
+}
+
+// parseClock 解析 HH:MM，返回距午夜的时长
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%q 不是 HH:MM 格式的时间", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// normalize 将工站 ID 统一为大写
+func normalize(ids []types.StationID) []types.StationID {
+	out := make([]types.StationID, 0, len(ids))
+	for _, id := range ids {
+		out = append(out, types.StationID(strings.ToUpper(string(id))))
+	}
+	return out
+}
+
+// Stations 返回日历中引用的所有工站 ID (大写)，用于检查工站是否存在
+func (c *Calendar) Stations() []types.StationID {
+	if c == nil {
+		return nil
+	}
+	var ids []types.StationID
+	for _, p := range slices.Concat(c.shifts, c.breaks) {
+		ids = append(ids, p.stations...)
+	}
+	for _, s := range c.stations {
+		ids = append(ids, s...)
+	}
+	slices.Sort(ids)
+	return slices.Compact(ids)
+}
+
+// applies 判断时间段是否适用于工站
+func applies(stations []types.StationID, id types.StationID) bool {
+	return len(stations) == 0 || slices.Contains(stations, id)
+}
+
+// occurrences 返回适用于工站的时间段在 [from, to) 内的所有出现，时间段按开始的日期匹配星期
+func (c *Calendar) occurrences(periods []period, id types.StationID, reason string, from, to time.Time) []Window {
+	var out []Window
+	// 从前一天开始，包含跨越午夜进入 from 的时间段
+	day := from.In(c.loc).AddDate(0, 0, -1)
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, c.loc)
+	for ; day.Before(to); day = day.AddDate(0, 0, 1) {
+		for _, p := range periods {
+			if !applies(p.stations, id) || (len(p.days) > 0 && !slices.Contains(p.days, day.Weekday())) {
+				continue
+			}
+			start := day.Add(p.start)
+			if w, ok := clip(Window{From: start, To: start.Add(p.length), Reason: reason, Name: p.name}, from, to); ok {
+				out = append(out, w)
+			}
+		}
+	}
+	return out
+}
+
+// clip 将离线时间截取到 [from, to) 内，没有重叠时返回 false
+func clip(w Window, from, to time.Time) (Window, bool) {
+	if w.From.Before(from) {
+		w.From = from
+	}
+	if w.To.After(to) {
+		w.To = to
+	}
+	return w, w.To.After(w.From)
+}
+
+// windows 返回工站在 [from, to) 内的离线时间，按开始时间排序，可能相互重叠
+func (c *Calendar) windows(id types.StationID, from, to time.Time) []Window {
+	id = types.StationID(strings.ToUpper(string(id)))
+	var out []Window
+	if slices.ContainsFunc(c.shifts, func(p period) bool { return applies(p.stations, id) }) {
+		// 班次之外的时间离线
+		cursor := from
+		working := merge(c.occurrences(c.shifts, id, "", from, to))
+		for _, w := range working {
+			if w.From.After(cursor) {
+				out = append(out, Window{From: cursor, To: w.From, Reason: ReasonOffShift})
+			}
+			cursor = w.To
+		}
+		if to.After(cursor) {
+			out = append(out, Window{From: cursor, To: to, Reason: ReasonOffShift})
+		}
+	}
+	out = append(out, c.occurrences(c.breaks, id, ReasonBreak, from, to)...)
+	for i, d := range c.downtime {
+		if w, ok := clip(d, from, to); ok && applies(c.stations[i], id) {
+			out = append(out, w)
+		}
+	}
+	slices.SortStableFunc(out, func(a, b Window) int { return a.From.Compare(b.From) })
+	return out
+}
+
+// merge 合并按开始时间排序的重叠或相邻的时间段，合并后的时间段沿用第一个时间段的原因
+func merge(ws []Window) []Window {
+	slices.SortStableFunc(ws, func(a, b Window) int { return a.From.Compare(b.From) })
+	var out []Window
+	for _, w := range ws {
+		if n := len(out); n > 0 && !w.From.After(out[n-1].To) {
+			if w.To.After(out[n-1].To) {
+				out[n-1].To = w.To
+			}
+			continue
+		}
+		out = append(out, w)
+	}
+	return out
+}
+
+// OnShift 判断名称为 name 的班次在 at 时刻是否在进行中，不考虑班次适用的工站，用于判断操作员是否在岗
+// 日历为 nil 或 name 为空时返回 true
+func (c *Calendar) OnShift(name string, at time.Time) bool {
+	if c == nil || name == "" {
+		return true
+	}
+	var shifts []period
+	for _, p := range c.shifts {
+		if strings.EqualFold(p.name, name) {
+			p.stations = nil
+			shifts = append(shifts, p)
+		}
+	}
+	return len(c.occurrences(shifts, "", "", at, at.Add(time.Nanosecond))) > 0
+}
+
+// HasShift 判断日历中是否有名称为 name 的班次
+func (c *Calendar) HasShift(name string) bool {
+	return c != nil && slices.ContainsFunc(c.shifts, func(p period) bool { return strings.EqualFold(p.name, name) })
+}
+
+// Offline 返回工站在 [from, to) 内合并后的离线时间
+func (c *Calendar) Offline(id types.StationID, from, to time.Time) []Window {
+	if c == nil || !to.After(from) {
+		return nil
+	}
+	return merge(c.windows(id, from, to))
+}
+
+// Status 判断工站在 at 时刻是否离线，离线时返回所在的离线时间 (原因取自 at 时刻生效的第一个原因)
+// 恢复在线的时间超过 at 之后 8 天时，返回的离线时间在 8 天处结束
+func (c *Calendar) Status(id types.StationID, at time.Time) (Window, bool) {
+	if c == nil {
+		return Window{}, false
+	}
+	ws := c.windows(id, at, at.Add(horizon))
+	i := slices.IndexFunc(ws, func(w Window) bool { return !w.From.After(at) })
+	if i < 0 {
+		return Window{}, false
+	}
+	current := ws[i]
+	current.To = merge(ws)[0].To
+	return current, true
+}
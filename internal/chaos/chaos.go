@@ -0,0 +1,263 @@
+// Package chaos 按工站注入限时的故障：按比例让加工失败、增加加工延迟、丢弃补偿或模拟远程工站宕机，
+// 用于按需演示重试、健康检查和 Saga 补偿等容错机制；故障到期后自动失效
+package chaos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"industrial-4.0-demo/internal/metrics"
+	"industrial-4.0-demo/internal/types"
+	"log/slog"
+	"math/rand"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 注入的故障种类，用于 chaos_faults_injected_total 指标
+const (
+	KindFailure        = "failure"           // 加工失败
+	KindLatency        = "latency"           // 加工延迟
+	KindDropCompensate = "drop_compensation" // 补偿被丢弃
+	KindCrash          = "crash"             // 远程工站宕机
+)
+
+// 注入故障时可能返回的错误
+var (
+	ErrNotFound     = errors.New("fault not found")
+	ErrInvalidFault = errors.New("invalid fault")
+	ErrCrashed      = errors.New("injected crash: station unreachable")
+	ErrDropped      = errors.New("injected fault: compensation dropped")
+)
+
+// Spec 描述要注入的故障，至少设置一种效果
+type Spec struct {
+	StationID         types.StationID `json:"station_id" mapstructure:"station_id"`
+	FailureRate       float64         `json:"failure_rate,omitempty" mapstructure:"failure_rate"`             // 加工失败的比例 (0 ~ 1)
+	LatencyMs         int             `json:"latency_ms,omitempty" mapstructure:"latency_ms"`                 // 每次加工前增加的延迟
+	DropCompensations bool            `json:"drop_compensations,omitempty" mapstructure:"drop_compensations"` // 补偿请求被丢弃，补偿失败
+	Crash             bool            `json:"crash,omitempty" mapstructure:"crash"`                           // 模拟宕机：加工和补偿都因通信失败而失败，健康检查探测失败
+	DurationSeconds   int             `json:"duration_seconds" mapstructure:"duration_seconds"`               // 故障持续的时长
+}
+
+// Validate 检查故障描述，工站 ID 统一转为大写
+func (s *Spec) Validate() error {
+	s.StationID = types.StationID(strings.ToUpper(string(s.StationID)))
+	switch {
+	case s.StationID == "":
+		return fmt.Errorf("%w: station_id is required", ErrInvalidFault)
+	case s.FailureRate < 0 || s.FailureRate > 1:
+		return fmt.Errorf("%w: failure_rate must be between 0 and 1", ErrInvalidFault)
+	case s.LatencyMs < 0:
+		return fmt.Errorf("%w: latency_ms must not be negative", ErrInvalidFault)
+	case s.DurationSeconds <= 0:
+		return fmt.Errorf("%w: duration_seconds must be positive", ErrInvalidFault)
+	case s.FailureRate == 0 && s.LatencyMs == 0 && !s.DropCompensations && !s.Crash:
+		return fmt.Errorf("%w: one of failure_rate, latency_ms, drop_compensations and crash is required", ErrInvalidFault)
+	}
+	return nil
+}
+
+// Counts 是故障生效的次数
+type Counts struct {
+	Executions    int `json:"executions"`    // 故障生效期间工站的加工次数
+	Failures      int `json:"failures"`      // 注入失败 (含宕机) 的加工次数
+	Delays        int `json:"delays"`        // 注入延迟的加工次数
+	Compensations int `json:"compensations"` // 丢弃 (含宕机) 的补偿次数
+}
+
+// Fault 是一个已注入的故障
+type Fault struct {
+	ID string `json:"id"`
+	Spec
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Counts    Counts    `json:"counts"`
+}
+
+// Outcome 是故障对一次加工的影响
+type Outcome struct {
+	Latency time.Duration // 加工前等待的时长
+	Err     error         // 不为 nil 时本次加工直接失败 (不调用工站)
+	Crash   bool          // 失败的原因是宕机
+}
+
+// Injector 保存生效中的故障，可以被并发访问
+// nil 的 *Injector 视为没有故障，未接入故障注入的组件不需要判空
+type Injector struct {
+	mu      sync.Mutex
+	faults  []*Fault // 按注入顺序排列
+	nextID  int
+	logger  *slog.Logger
+	metrics *metrics.Metrics
+}
+
+// NewInjector 创建一个没有故障的注入器
+func NewInjector(logger *slog.Logger, m *metrics.Metrics) *Injector {
+	return &Injector{logger: logger, metrics: m}
+}
+
+// Inject 注入一个故障，从 now 开始生效 DurationSeconds 秒
+func (i *Injector) Inject(spec Spec, now time.Time) (Fault, error) {
+	if err := spec.Validate(); err != nil {
+		return Fault{}, err
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.nextID++
+	f := &Fault{
+		ID:        fmt.Sprintf("CH-%04d", i.nextID),
+		Spec:      spec,
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Duration(spec.DurationSeconds) * time.Second),
+	}
+	i.faults = append(i.faults, f)
+	i.logger.Warn("已注入故障", "fault_id", f.ID, "station_id", spec.StationID, "failure_rate", spec.FailureRate,
+		"latency_ms", spec.LatencyMs, "drop_compensations", spec.DropCompensations, "crash", spec.Crash, "expires_at", f.ExpiresAt)
+	return *f, nil
+}
+
+// List 返回生效中的故障，按注入顺序排列
+func (i *Injector) List() []Fault {
+	if i == nil {
+		return []Fault{}
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.pruneLocked(time.Now())
+	faults := make([]Fault, 0, len(i.faults))
+	for _, f := range i.faults {
+		faults = append(faults, *f)
+	}
+	return faults
+}
+
+// Remove 提前结束一个故障，返回结束前的快照；故障不存在或已到期时返回 ErrNotFound
+func (i *Injector) Remove(id string) (Fault, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.pruneLocked(time.Now())
+	for n, f := range i.faults {
+		if f.ID == id {
+			i.faults = slices.Delete(i.faults, n, n+1)
+			i.logger.Info("已结束故障注入", "fault_id", id, "station_id", f.StationID)
+			return *f, nil
+		}
+	}
+	return Fault{}, ErrNotFound
+}
+
+// Clear 结束所有故障，返回结束前的快照
+func (i *Injector) Clear() []Fault {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.pruneLocked(time.Now())
+	cleared := make([]Fault, 0, len(i.faults))
+	for _, f := range i.faults {
+		cleared = append(cleared, *f)
+	}
+	i.faults = nil
+	if len(cleared) > 0 {
+		i.logger.Info("已结束所有故障注入", "count", len(cleared))
+	}
+	return cleared
+}
+
+// Execution 计算故障对工站一次加工的影响：生效中的故障的延迟累加，任意一个故障宕机或按比例判定失败时本次加工失败
+func (i *Injector) Execution(id types.StationID) Outcome {
+	var out Outcome
+	if i == nil {
+		return out
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.pruneLocked(time.Now())
+	for _, f := range i.faults {
+		if f.StationID != id {
+			continue
+		}
+		f.Counts.Executions++
+		if f.LatencyMs > 0 {
+			out.Latency += time.Duration(f.LatencyMs) * time.Millisecond
+			f.Counts.Delays++
+			i.observe(id, KindLatency)
+		}
+		switch {
+		case out.Err != nil:
+		case f.Crash:
+			out.Err, out.Crash = ErrCrashed, true
+			f.Counts.Failures++
+			i.observe(id, KindCrash)
+		case f.FailureRate > 0 && rand.Float64() < f.FailureRate:
+			out.Err = fmt.Errorf("injected fault %s", f.ID)
+			f.Counts.Failures++
+			i.observe(id, KindFailure)
+		}
+	}
+	return out
+}
+
+// Compensation 判断工站的一次补偿是否被故障丢弃，被丢弃时返回错误
+func (i *Injector) Compensation(id types.StationID) error {
+	if i == nil {
+		return nil
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.pruneLocked(time.Now())
+	for _, f := range i.faults {
+		if f.StationID != id || (!f.Crash && !f.DropCompensations) {
+			continue
+		}
+		f.Counts.Compensations++
+		if f.Crash {
+			i.observe(id, KindCrash)
+			return ErrCrashed
+		}
+		i.observe(id, KindDropCompensate)
+		return ErrDropped
+	}
+	return nil
+}
+
+// Probe 包装工站的健康检查探测，工站处于注入的宕机状态时探测直接失败
+func (i *Injector) Probe(id types.StationID, probe func(ctx context.Context) error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if i.crashed(id) {
+			return ErrCrashed
+		}
+		return probe(ctx)
+	}
+}
+
+// crashed 判断工站是否处于注入的宕机状态
+func (i *Injector) crashed(id types.StationID) bool {
+	if i == nil {
+		return false
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.pruneLocked(time.Now())
+	return slices.ContainsFunc(i.faults, func(f *Fault) bool { return f.StationID == id && f.Crash })
+}
+
+// pruneLocked 移除已到期的故障，调用方必须持有 i.mu
+func (i *Injector) pruneLocked(now time.Time) {
+	i.faults = slices.DeleteFunc(i.faults, func(f *Fault) bool {
+		if now.Before(f.ExpiresAt) {
+			return false
+		}
+		i.logger.Info("故障注入已到期", "fault_id", f.ID, "station_id", f.StationID, "failures", f.Counts.Failures,
+			"delays", f.Counts.Delays, "compensations", f.Counts.Compensations)
+		return true
+	})
+}
+
+// observe 记录一次生效的故障
+func (i *Injector) observe(id types.StationID, kind string) {
+	if i.metrics != nil {
+		i.metrics.ChaosFaultsInjectedTotal.WithLabelValues(string(id), kind).Inc()
+	}
+}
@@ -0,0 +1,163 @@
+package cli
+
+import (
+	"fmt"
+	"industrial-4.0-demo/internal/api"
+	"industrial-4.0-demo/internal/web"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// runStationsList 列出所有工站
+func runStationsList(cmd *command, args []string) error {
+	if _, err := cmd.parse(args); err != nil {
+		return err
+	}
+	var stations []api.StationDetail
+	if _, err := cmd.client().do(http.MethodGet, "/stations", nil, &stations); err != nil {
+		return err
+	}
+	return printStations(cmd, stations)
+}
+
+// runStationsToggle 停用或启用工站
+func runStationsToggle(cmd *command, enable bool, args []string) error {
+	args, err := cmd.parse(args)
+	if err != nil {
+		return err
+	}
+	if err := exactArgs(args, 1, "<station_id>"); err != nil {
+		return err
+	}
+	action := "disable"
+	if enable {
+		action = "enable"
+	}
+	var station api.StationDetail
+	if _, err := cmd.client().do(http.MethodPost, "/stations/"+url.PathEscape(args[0])+"/"+action, nil, &station); err != nil {
+		return err
+	}
+	return printStations(cmd, []api.StationDetail{station})
+}
+
+// printStations 输出工站列表
+func printStations(cmd *command, stations []api.StationDetail) error {
+	if cmd.opts.output == outputJSON {
+		return printJSON(cmd.stdout, stations)
+	}
+	t := newTable(cmd.stdout, "ID", "DRIVER", "STATUS", "ENABLED", "POOL", "QUEUE", "UTILIZATION", "HEALTH")
+	for _, s := range stations {
+		pool := "-"
+		if s.PoolSize > 0 {
+			pool = fmt.Sprintf("%d/%d", s.PoolUsed, s.PoolSize)
+			if s.PoolWait > 0 {
+				pool += fmt.Sprintf(" (+%d)", s.PoolWait)
+			}
+		}
+		t.row(s.ID, s.Driver, s.Status, s.Enabled, pool, s.QueueLength, fmt.Sprintf("%.1f%%", s.Utilization), orDash(s.Health))
+	}
+	return t.flush()
+}
+
+// runSchedulerStatus 输出调度器状态和队列
+func runSchedulerStatus(cmd *command, args []string) error {
+	if _, err := cmd.parse(args); err != nil {
+		return err
+	}
+	var state web.SchedulerState
+	if _, err := cmd.client().do(http.MethodGet, "/admin/scheduler", nil, &state); err != nil {
+		return err
+	}
+	return printScheduler(cmd, state)
+}
+
+// runSchedulerAction 暂停或恢复出队
+func runSchedulerAction(cmd *command, action string, args []string) error {
+	if _, err := cmd.parse(args); err != nil {
+		return err
+	}
+	var state web.SchedulerState
+	if _, err := cmd.client().do(http.MethodPost, "/admin/scheduler/"+action, nil, &state); err != nil {
+		return err
+	}
+	return printScheduler(cmd, state)
+}
+
+// runSchedulerDrain 暂停出队并等待执行中的任务结束，超时后调度器继续排空
+func runSchedulerDrain(cmd *command, args []string) error {
+	var timeout time.Duration
+	cmd.flags.DurationVar(&timeout, "timeout", 30*time.Second, "最长等待时间")
+	if _, err := cmd.parse(args); err != nil {
+		return err
+	}
+	// 请求本身要等待排空完成，超时时间需要覆盖排空的等待时间
+	if cmd.opts.timeout < timeout+10*time.Second {
+		cmd.opts.timeout = timeout + 10*time.Second
+	}
+	var state web.SchedulerState
+	status, err := cmd.client().do(http.MethodPost, "/admin/scheduler/drain?timeout="+url.QueryEscape(timeout.String()), nil, &state)
+	if err != nil {
+		return err
+	}
+	if err := printScheduler(cmd, state); err != nil {
+		return err
+	}
+	if status == http.StatusAccepted {
+		return fmt.Errorf("排空未在 %s 内完成，调度器仍在排空", timeout)
+	}
+	return nil
+}
+
+// runSchedulerWorkers 调整 worker 池大小
+func runSchedulerWorkers(cmd *command, args []string) error {
+	args, err := cmd.parse(args)
+	if err != nil {
+		return err
+	}
+	if err := exactArgs(args, 1, "<n>"); err != nil {
+		return err
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n <= 0 {
+		return fmt.Errorf("%w: worker 数必须是正整数", errUsage)
+	}
+	var state web.SchedulerState
+	if _, err := cmd.client().do(http.MethodPut, "/admin/scheduler/workers", map[string]int{"max_workers": n}, &state); err != nil {
+		return err
+	}
+	return printScheduler(cmd, state)
+}
+
+// printScheduler 输出调度器概况，以及队列和执行中的任务
+func printScheduler(cmd *command, state web.SchedulerState) error {
+	if cmd.opts.output == outputJSON {
+		return printJSON(cmd.stdout, state)
+	}
+	t := newTable(cmd.stdout, "STATUS", "WORKERS", "BUSY", "OCCUPANCY", "QUEUED")
+	t.row(state.Status, state.Workers, state.BusyWorkers, fmt.Sprintf("%.1f%%", state.Occupancy), len(state.Queue))
+	if err := t.flush(); err != nil {
+		return err
+	}
+
+	if len(state.InFlight) > 0 {
+		fmt.Fprintln(cmd.stdout)
+		workers := newTable(cmd.stdout, "WORKER", "PRODUCT", "STARTED")
+		for _, w := range state.InFlight {
+			workers.row(w.Worker, orDash(w.ProductID), formatTime(w.StartedAt))
+		}
+		if err := workers.flush(); err != nil {
+			return err
+		}
+	}
+	if len(state.Queue) > 0 {
+		fmt.Fprintln(cmd.stdout)
+		queue := newTable(cmd.stdout, "POSITION", "PRODUCT", "TYPE", "PRIORITY")
+		for _, e := range state.Queue {
+			queue.row(e.Position, e.ProductID, e.Type, e.Priority)
+		}
+		return queue.flush()
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+// Package cli 实现了命令行客户端 factoryctl，通过 HTTP API 提交任务、查询和观察任务、管理工站与调度器、控制订单模拟器
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// 退出码
+const (
+	exitOK    = 0 // 成功
+	exitError = 1 // 请求失败或服务端返回错误
+	exitUsage = 2 // 命令或参数错误
+)
+
+// 输出格式
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// errUsage 表示命令或参数错误，输出用法说明后以 exitUsage 退出
+var errUsage = errors.New("用法错误")
+
+const usage = `factoryctl 是 PCB 智能工厂编排器的命令行客户端
+
+用法:
+  factoryctl <命令> [参数]
+
+命令:
+  submit -f order.json                提交任务，文件可以是单个任务或任务数组，- 表示标准输入
+  tasks list [--status S] [--type T]  列出实时状态中的任务，另可按 --namespace N 过滤
+  tasks get <id>                      查看任务详情和步骤履历
+  tasks watch <id>                    持续输出任务的状态变化，直到任务结束
+  tasks cancel <id>                   取消任务
+  tasks retry <id> [--priority N]     重试失败或已补偿的任务
+  stations [list]                     列出工站
+  stations disable|enable <id>        停用或启用工站
+  scheduler [status]                  查看调度器状态和队列
+  scheduler pause|resume              暂停或恢复出队
+  scheduler drain [--timeout 30s]     暂停出队并等待执行中的任务结束
+  scheduler workers <n>               调整 worker 池大小
+  sim [status]                        查看订单模拟器状态和可选场景
+  sim start [--scenario S] [--rate N] 启动模拟器，另可指定 --mix T=w,... 和 --limit N
+  sim update [--rate N] [--mix ...]   调整运行中模拟器的速率、配比和提交上限
+  sim stop                            停止模拟器
+
+通用参数:
+  --server           API 地址 (环境变量 FACTORY_SERVER，默认 http://localhost:8080)
+  --api-key          API Key (环境变量 FACTORY_API_KEY)
+  --token            JWT (环境变量 FACTORY_TOKEN)
+  -o                 输出格式: table 或 json (默认 table)
+  --request-timeout  单个请求的超时时间 (默认 30s)
+`
+
+// options 是所有子命令共用的参数
+type options struct {
+	server  string
+	apiKey  string
+	token   string
+	output  string
+	timeout time.Duration
+}
+
+// env 返回环境变量的值，未设置时返回默认值
+func env(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// command 是一次命令执行的上下文
+type command struct {
+	opts   options
+	flags  *flag.FlagSet
+	stdout io.Writer
+}
+
+// newCommand 创建带通用参数的子命令，name 用于错误提示
+func newCommand(name string, stdout io.Writer) *command {
+	c := &command{stdout: stdout}
+	fs := flag.NewFlagSet("factoryctl "+name, flag.ContinueOnError)
+	// 解析错误和帮助由 Run 统一输出
+	fs.SetOutput(io.Discard)
+	fs.Usage = func() {}
+	fs.StringVar(&c.opts.server, "server", env("FACTORY_SERVER", "http://localhost:8080"), "API 地址")
+	fs.StringVar(&c.opts.apiKey, "api-key", os.Getenv("FACTORY_API_KEY"), "API Key")
+	fs.StringVar(&c.opts.token, "token", os.Getenv("FACTORY_TOKEN"), "JWT")
+	fs.StringVar(&c.opts.output, "o", outputTable, "输出格式: table 或 json")
+	fs.DurationVar(&c.opts.timeout, "request-timeout", 30*time.Second, "单个请求的超时时间")
+	c.flags = fs
+	return c
+}
+
+// parse 解析参数，返回位置参数；参数可以写在位置参数之前或之后
+func (c *command) parse(args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := c.flags.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%w: %v", errUsage, err)
+		}
+		args = c.flags.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional, args = append(positional, args[0]), args[1:]
+	}
+	if c.opts.output != outputTable && c.opts.output != outputJSON {
+		return nil, fmt.Errorf("%w: 不支持的输出格式 %q", errUsage, c.opts.output)
+	}
+	return positional, nil
+}
+
+// client 根据通用参数创建 API 客户端
+func (c *command) client() *client {
+	return newClient(c.opts.server, c.opts.apiKey, c.opts.token, c.opts.timeout)
+}
+
+// Run 执行 factoryctl 命令，返回进程退出码
+func Run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	}
+
+	err := dispatch(args, stdout)
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, flag.ErrHelp):
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	case errors.Is(err, errUsage):
+		fmt.Fprintln(stderr, "错误:", err)
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	default:
+		fmt.Fprintln(stderr, "错误:", err)
+		return exitError
+	}
+}
+
+// dispatch 根据命令和子命令分发到具体的实现，省略子命令时使用默认的查看操作
+func dispatch(args []string, stdout io.Writer) error {
+	name, rest := args[0], args[1:]
+	sub := ""
+	if len(rest) > 0 && len(rest[0]) > 0 && rest[0][0] != '-' {
+		sub, rest = rest[0], rest[1:]
+	}
+
+	switch name {
+	case "submit":
+		if sub != "" {
+			rest = append([]string{sub}, rest...)
+		}
+		return runSubmit(newCommand(name, stdout), rest)
+	case "tasks":
+		cmd := newCommand(name+" "+sub, stdout)
+		switch sub {
+		case "list", "":
+			return runTasksList(cmd, rest)
+		case "get":
+			return runTasksGet(cmd, rest)
+		case "watch":
+			return runTasksWatch(cmd, rest)
+		case "cancel":
+			return runTasksCancel(cmd, rest)
+		case "retry":
+			return runTasksRetry(cmd, rest)
+		}
+	case "stations":
+		cmd := newCommand(name+" "+sub, stdout)
+		switch sub {
+		case "list", "":
+			return runStationsList(cmd, rest)
+		case "disable", "enable":
+			return runStationsToggle(cmd, sub == "enable", rest)
+		}
+	case "scheduler":
+		cmd := newCommand(name+" "+sub, stdout)
+		switch sub {
+		case "status", "":
+			return runSchedulerStatus(cmd, rest)
+		case "pause", "resume":
+			return runSchedulerAction(cmd, sub, rest)
+		case "drain":
+			return runSchedulerDrain(cmd, rest)
+		case "workers":
+			return runSchedulerWorkers(cmd, rest)
+		}
+	}
+	return fmt.Errorf("%w: 未知命令 %q", errUsage, name+" "+sub)
+}
+
+// exactArgs 校验位置参数的数量
+func exactArgs(args []string, n int, what string) error {
+	if len(args) != n {
+		return fmt.Errorf("%w: 需要参数 %s", errUsage, what)
+	}
+	return nil
+}
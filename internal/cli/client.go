@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// APIError 是 API 返回的非 2xx 响应
+type APIError struct {
+	Status  int    // HTTP 状态码
+	Message string // 响应体中的错误信息
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%d %s", e.Status, http.StatusText(e.Status))
+	}
+	return fmt.Sprintf("%d %s: %s", e.Status, http.StatusText(e.Status), e.Message)
+}
+
+// client 是编排器 HTTP API 的客户端
+type client struct {
+	server string       // API 地址，例如 http://localhost:8080
+	apiKey string       // 通过 X-API-Key 传递的 API Key
+	token  string       // 通过 Authorization: Bearer 传递的 JWT
+	http   *http.Client // 普通请求使用的客户端，流式请求不设超时
+}
+
+// newClient 创建 API 客户端
+func newClient(server, apiKey, token string, timeout time.Duration) *client {
+	return &client{
+		server: strings.TrimRight(server, "/"),
+		apiKey: apiKey,
+		token:  token,
+		http:   &http.Client{Timeout: timeout},
+	}
+}
+
+// newRequest 创建带认证信息的请求，path 相对于 /api/v1
+func (c *client) newRequest(method, path string, body interface{}) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.server+"/api/v1"+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return req, nil
+}
+
+// do 发送请求并将 JSON 响应解析到 out，out 为 nil 时忽略响应体
+// 返回响应的状态码，非 2xx 响应返回 *APIError
+func (c *client) do(method, path string, body, out interface{}) (int, error) {
+	req, err := c.newRequest(method, path, body)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return resp.StatusCode, &APIError{Status: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+	if out != nil && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, fmt.Errorf("解析响应失败: %w", err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// stream 订阅 SSE 状态推送，对每条消息调用 fn，fn 返回 false 时结束订阅
+func (c *client) stream(query string, fn func(data []byte) bool) error {
+	req, err := c.newRequest(http.MethodGet, "/state/stream?"+query, nil)
+	if err != nil {
+		return err
+	}
+	// 推送是长连接，不能使用普通请求的超时
+	resp, err := (&http.Client{Transport: c.http.Transport}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &APIError{Status: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+
+	return readEvents(resp.Body, fn)
+}
+
+// readEvents 逐条读取 SSE 事件的 data 字段，忽略心跳注释
+func readEvents(r io.Reader, fn func(data []byte) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20) // 快照可能很大
+	var data []byte
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if len(data) > 0 && !fn(data) {
+				return nil
+			}
+			data = nil
+		case strings.HasPrefix(line, "data: "):
+			data = append(data, line[len("data: "):]...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("服务端关闭了推送连接")
+}
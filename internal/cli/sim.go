@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"fmt"
+	"industrial-4.0-demo/internal/simulator"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// simFlags 注册模拟参数相关的参数，返回解析后生成请求体的函数
+func simFlags(cmd *command) func() (simulator.Settings, error) {
+	var settings simulator.Settings
+	var mix string
+	cmd.flags.StringVar(&settings.Scenario, "scenario", "", "场景: demo / steady / bottleneck / rush")
+	cmd.flags.Float64Var(&settings.Rate, "rate", 0, "每分钟提交的订单数")
+	cmd.flags.IntVar(&settings.Limit, "limit", 0, "最多提交的订单数")
+	cmd.flags.StringVar(&mix, "mix", "", "产品配比，例如 PCB_MULTILAYER=3,PCB_DOUBLE_LAYER=1")
+	return func() (simulator.Settings, error) {
+		if mix == "" {
+			return settings, nil
+		}
+		settings.Mix = make(map[string]int)
+		for _, part := range strings.Split(mix, ",") {
+			productType, weight, ok := strings.Cut(strings.TrimSpace(part), "=")
+			n, err := strconv.Atoi(weight)
+			if !ok || err != nil {
+				return settings, fmt.Errorf("%w: 无效的产品配比 %q", errUsage, part)
+			}
+			settings.Mix[productType] = n
+		}
+		return settings, nil
+	}
+}
+
+// runSimStatus 输出模拟器状态
+func runSimStatus(cmd *command, args []string) error {
+	if _, err := cmd.parse(args); err != nil {
+		return err
+	}
+	var status simulator.Status
+	if _, err := cmd.client().do(http.MethodGet, "/sim", nil, &status); err != nil {
+		return err
+	}
+	return printSim(cmd, status)
+}
+
+// runSimStart 启动模拟器，未指定场景时使用服务端配置的默认参数
+func runSimStart(cmd *command, args []string) error {
+	settings := simFlags(cmd)
+	if _, err := cmd.parse(args); err != nil {
+		return err
+	}
+	body, err := settings()
+	if err != nil {
+		return err
+	}
+	var status simulator.Status
+	if _, err := cmd.client().do(http.MethodPost, "/sim/start", body, &status); err != nil {
+		return err
+	}
+	return printSim(cmd, status)
+}
+
+// runSimUpdate 调整运行中模拟器的速率、配比和提交上限
+func runSimUpdate(cmd *command, args []string) error {
+	settings := simFlags(cmd)
+	if _, err := cmd.parse(args); err != nil {
+		return err
+	}
+	body, err := settings()
+	if err != nil {
+		return err
+	}
+	var status simulator.Status
+	if _, err := cmd.client().do(http.MethodPut, "/sim", body, &status); err != nil {
+		return err
+	}
+	return printSim(cmd, status)
+}
+
+// runSimStop 停止模拟器
+func runSimStop(cmd *command, args []string) error {
+	if _, err := cmd.parse(args); err != nil {
+		return err
+	}
+	var status simulator.Status
+	if _, err := cmd.client().do(http.MethodPost, "/sim/stop", nil, &status); err != nil {
+		return err
+	}
+	return printSim(cmd, status)
+}
+
+// printSim 输出模拟器状态，产品配比按类型排序
+func printSim(cmd *command, status simulator.Status) error {
+	if cmd.opts.output == outputJSON {
+		return printJSON(cmd.stdout, status)
+	}
+	names := make([]string, 0, len(status.Mix))
+	for productType := range status.Mix {
+		names = append(names, productType)
+	}
+	sort.Strings(names)
+	mix := make([]string, len(names))
+	for i, productType := range names {
+		mix[i] = fmt.Sprintf("%s=%d", productType, status.Mix[productType])
+	}
+	limit := "-"
+	if status.Limit > 0 {
+		limit = strconv.Itoa(status.Limit)
+	}
+	t := newTable(cmd.stdout, "STATUS", "SCENARIO", "RATE/MIN", "MIX", "SUBMITTED", "LIMIT", "STARTED")
+	t.row(status.Status, status.Scenario, status.Rate, orDash(strings.Join(mix, ",")), status.Submitted, limit, formatTime(status.StartedAt))
+	return t.flush()
+}
@@ -0,0 +1,339 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"industrial-4.0-demo/internal/api"
+	"industrial-4.0-demo/internal/fsm"
+	"industrial-4.0-demo/internal/web"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// submitResponse 是提交和重试接口的响应体
+type submitResponse struct {
+	Status    string `json:"status"`
+	ID        string `json:"id"`
+	Namespace string `json:"namespace,omitempty"` // 重试接口不返回，新任务沿用原任务的命名空间
+}
+
+// runSubmit 提交一个或一批任务，任务定义与 POST /api/v1/tasks 的请求体相同
+func runSubmit(cmd *command, args []string) error {
+	var file string
+	cmd.flags.StringVar(&file, "f", "", "任务定义文件，- 表示标准输入")
+	if _, err := cmd.parse(args); err != nil {
+		return err
+	}
+	if file == "" {
+		return fmt.Errorf("%w: 需要 -f 指定任务定义文件", errUsage)
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+	if file == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return err
+	}
+	orders, err := parseOrders(data)
+	if err != nil {
+		return fmt.Errorf("解析任务定义失败: %w", err)
+	}
+
+	c := cmd.client()
+	results := make([]submitResponse, 0, len(orders))
+	for _, order := range orders {
+		var resp submitResponse
+		if _, err := c.do(http.MethodPost, "/tasks", order, &resp); err != nil {
+			return err
+		}
+		results = append(results, resp)
+	}
+
+	if cmd.opts.output == outputJSON {
+		return printJSON(cmd.stdout, results)
+	}
+	t := newTable(cmd.stdout, "ID", "NAMESPACE", "STATUS")
+	for _, r := range results {
+		t.row(r.ID, orDash(r.Namespace), r.Status)
+	}
+	return t.flush()
+}
+
+// parseOrders 解析单个任务或任务数组，原样保留每个任务的 JSON 以便服务端按其规则解析
+func parseOrders(data []byte) ([]json.RawMessage, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var orders []json.RawMessage
+		if err := json.Unmarshal(data, &orders); err != nil {
+			return nil, err
+		}
+		return orders, nil
+	}
+	var order json.RawMessage
+	if err := json.Unmarshal(data, &order); err != nil {
+		return nil, err
+	}
+	return []json.RawMessage{order}, nil
+}
+
+// runTasksList 列出实时状态中的任务，按 ID 排序
+func runTasksList(cmd *command, args []string) error {
+	var status, productType, namespace string
+	cmd.flags.StringVar(&status, "status", "", "只列出该状态的任务，例如 FAILED")
+	cmd.flags.StringVar(&productType, "type", "", "只列出该产品类型的任务")
+	cmd.flags.StringVar(&namespace, "namespace", "", "只列出该命名空间 (产线) 的任务")
+	if _, err := cmd.parse(args); err != nil {
+		return err
+	}
+
+	path := "/state"
+	if namespace != "" {
+		path += "?namespaces=" + url.QueryEscape(namespace)
+	}
+	var state web.GlobalState
+	if _, err := cmd.client().do(http.MethodGet, path, nil, &state); err != nil {
+		return err
+	}
+	products := make([]web.ProductState, 0, len(state.Products))
+	for _, p := range state.Products {
+		if status != "" && !strings.EqualFold(p.Status, status) {
+			continue
+		}
+		if productType != "" && !strings.EqualFold(p.Type, productType) {
+			continue
+		}
+		products = append(products, p)
+	}
+	sort.Slice(products, func(i, j int) bool { return products[i].ID < products[j].ID })
+
+	if cmd.opts.output == outputJSON {
+		return printJSON(cmd.stdout, products)
+	}
+	t := newTable(cmd.stdout, "ID", "NAMESPACE", "TYPE", "PRIORITY", "STATUS", "STATION")
+	for _, p := range products {
+		t.row(p.ID, orDash(p.Namespace), p.Type, p.Priority, p.Status, orDash(string(p.Station)))
+	}
+	return t.flush()
+}
+
+// getTask 查询任务详情
+func getTask(c *client, id string) (api.TaskDetail, error) {
+	var detail api.TaskDetail
+	_, err := c.do(http.MethodGet, "/tasks/"+url.PathEscape(id), nil, &detail)
+	return detail, err
+}
+
+// runTasksGet 输出任务详情和步骤履历
+func runTasksGet(cmd *command, args []string) error {
+	args, err := cmd.parse(args)
+	if err != nil {
+		return err
+	}
+	if err := exactArgs(args, 1, "<id>"); err != nil {
+		return err
+	}
+	detail, err := getTask(cmd.client(), args[0])
+	if err != nil {
+		return err
+	}
+
+	if cmd.opts.output == outputJSON {
+		return printJSON(cmd.stdout, detail)
+	}
+	t := newTable(cmd.stdout, "FIELD", "VALUE")
+	t.row("ID", detail.ID)
+	t.row("TYPE", detail.Type)
+	t.row("PRIORITY", detail.Priority)
+	t.row("NAMESPACE", orDash(detail.Namespace))
+	t.row("STATUS", detail.Status)
+	t.row("STATION", orDash(string(detail.Station)))
+	t.row("LIFECYCLE", orDash(detail.Lifecycle))
+	t.row("TRACE_ID", orDash(detail.TraceID))
+	t.row("RETRY_OF", orDash(detail.RetryOf))
+	if h := detail.History; h != nil {
+		t.row("OUTCOME", orDash(h.Outcome))
+		t.row("FAILURE", orDash(h.Failure))
+	}
+	if err := t.flush(); err != nil {
+		return err
+	}
+	if detail.History == nil || len(detail.History.Steps) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(cmd.stdout)
+	steps := newTable(cmd.stdout, "STEP", "STATION", "STARTED", "FINISHED", "DURATION", "RESULT")
+	for _, s := range detail.History.Steps {
+		result := "ok"
+		switch {
+		case s.FinishedAt.IsZero():
+			result = "running"
+		case !s.Success:
+			result = "failed: " + s.Error
+		}
+		steps.row(s.Step, s.StationID, formatTime(s.StartedAt), formatTime(s.FinishedAt), fmt.Sprintf("%.2fs", s.DurationSeconds), result)
+	}
+	return steps.flush()
+}
+
+// isFinished 判断任务状态是否为结束状态，FAILED 之后还会进入补偿，不算结束
+func isFinished(status string) bool {
+	switch fsm.State(status) {
+	case fsm.StateCompleted, fsm.StateCompensated, fsm.StateCancelled:
+		return true
+	}
+	return false
+}
+
+// runTasksWatch 订阅任务的状态推送，每次状态或工站变化输出一行，任务结束后退出
+// 任务未成功完成时返回错误，便于脚本根据退出码判断结果
+func runTasksWatch(cmd *command, args []string) error {
+	args, err := cmd.parse(args)
+	if err != nil {
+		return err
+	}
+	if err := exactArgs(args, 1, "<id>"); err != nil {
+		return err
+	}
+	id := args[0]
+	c := cmd.client()
+
+	detail, err := getTask(c, id)
+	if err != nil {
+		return err
+	}
+
+	var t *table
+	if cmd.opts.output == outputTable {
+		t = newTable(cmd.stdout, "TIME", "STATUS", "STATION")
+	}
+	last := web.ProductState{ID: id}
+	emit := func(p web.ProductState) error {
+		if p.Status == last.Status && p.Station == last.Station {
+			return nil
+		}
+		last = p
+		if t == nil {
+			// 每次变化输出一行 JSON，便于脚本逐行处理
+			return json.NewEncoder(cmd.stdout).Encode(p)
+		}
+		t.row(time.Now().Format("15:04:05.000"), p.Status, orDash(string(p.Station)))
+		return t.flush()
+	}
+
+	final := detail.Status
+	if !isFinished(detail.Status) {
+		var emitErr error
+		err = c.stream("ids="+url.QueryEscape(id), func(data []byte) bool {
+			var msg web.Message
+			if err := json.Unmarshal(data, &msg); err != nil {
+				emitErr = fmt.Errorf("解析推送消息失败: %w", err)
+				return false
+			}
+			var p *web.ProductState
+			switch msg.Type {
+			case web.MessageSnapshot:
+				if state, ok := msg.State.Products[id]; ok {
+					p = &state
+				}
+			case web.MessagePatch:
+				if msg.Product.ID == id {
+					p = msg.Product
+				}
+			case web.MessageRemove:
+				// 结束的任务超过保留时间被移除，最终状态已在之前的补丁中输出
+				return msg.ProductID != id
+			}
+			if p == nil {
+				return true
+			}
+			if emitErr = emit(*p); emitErr != nil {
+				return false
+			}
+			final = p.Status
+			return !isFinished(p.Status)
+		})
+		if err == nil {
+			err = emitErr
+		}
+		if err != nil {
+			return err
+		}
+	} else if err := emit(web.ProductState{ID: id, Status: detail.Status, Station: detail.Station}); err != nil {
+		return err
+	}
+
+	if final != string(fsm.StateCompleted) {
+		return fmt.Errorf("任务 %s 以 %s 结束", id, final)
+	}
+	return nil
+}
+
+// runTasksCancel 取消任务
+func runTasksCancel(cmd *command, args []string) error {
+	args, err := cmd.parse(args)
+	if err != nil {
+		return err
+	}
+	if err := exactArgs(args, 1, "<id>"); err != nil {
+		return err
+	}
+	var resp submitResponse
+	if _, err := cmd.client().do(http.MethodDelete, "/tasks/"+url.PathEscape(args[0]), nil, &resp); err != nil {
+		return err
+	}
+	if cmd.opts.output == outputJSON {
+		return printJSON(cmd.stdout, resp)
+	}
+	t := newTable(cmd.stdout, "ID", "STATUS")
+	t.row(resp.ID, resp.Status)
+	return t.flush()
+}
+
+// runTasksRetry 重试失败或已补偿的任务，可以覆盖优先级
+func runTasksRetry(cmd *command, args []string) error {
+	priority := -1
+	cmd.flags.IntVar(&priority, "priority", -1, "覆盖原任务的优先级")
+	args, err := cmd.parse(args)
+	if err != nil {
+		return err
+	}
+	if err := exactArgs(args, 1, "<id>"); err != nil {
+		return err
+	}
+
+	body := map[string]interface{}{}
+	cmd.flags.Visit(func(f *flag.Flag) {
+		if f.Name == "priority" {
+			body["priority"] = priority
+		}
+	})
+	var resp submitResponse
+	if _, err := cmd.client().do(http.MethodPost, "/tasks/"+url.PathEscape(args[0])+"/retry", body, &resp); err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.Status == http.StatusConflict {
+			return fmt.Errorf("只能重试 FAILED 或 COMPENSATED 的任务: %w", err)
+		}
+		return err
+	}
+	if cmd.opts.output == outputJSON {
+		return printJSON(cmd.stdout, resp)
+	}
+	t := newTable(cmd.stdout, "ID", "STATUS", "RETRY_OF")
+	t.row(resp.ID, resp.Status, args[0])
+	return t.flush()
+}
@@ -0,0 +1,313 @@
+// Package cluster 通过共享存储上的租约文件在多个编排器实例之间选举领导者
+//
+// 所有实例指向同一个租约文件 (以及同一个 WAL)：持有未过期租约的实例是领导者，负责出队派发任务；
+// 其他实例是跟随者，只提供只读 API，并在租约过期后接管。领导者每隔 TTL 的三分之一续约一次，
+// 无法在租约过期前续约时主动退位，避免出现两个同时派发任务的实例。
+// 读改写租约时用 .lock 文件上的排他 flock 互斥，持锁进程崩溃时锁由内核释放，不需要判断和删除失效的锁
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"industrial-4.0-demo/internal/metrics"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 节点的角色
+const (
+	RoleLeader   = "leader"
+	RoleFollower = "follower"
+)
+
+// ErrLocked 表示租约文件正被其他实例读写
+var ErrLocked = errors.New("lease file is locked")
+
+// lockRetryInterval 是锁文件被其他实例持有时重试的间隔
+const lockRetryInterval = 2 * time.Millisecond
+
+// Options 定义集群节点和租约
+type Options struct {
+	Enabled      bool   `mapstructure:"enabled"`       // 启用后只有领导者派发任务
+	NodeID       string `mapstructure:"node_id"`       // 节点 ID，为空时使用主机名和进程号
+	AdvertiseURL string `mapstructure:"advertise_url"` // 其他节点转发写请求时使用的地址，例如 http://orchestrator-1:8080
+	LeaseFile    string `mapstructure:"lease_file"`    // 租约文件，所有节点必须指向共享存储上的同一个文件
+	LeaseTTLMs   int    `mapstructure:"lease_ttl_ms"`  // 租约有效期，领导者失联超过该时间后由其他节点接管
+}
+
+// Lease 是租约文件的内容
+type Lease struct {
+	Holder     string    `json:"holder"`      // 持有租约的节点 ID
+	URL        string    `json:"url"`         // 持有者的 advertise_url
+	Term       uint64    `json:"term"`        // 任期，每次换届加一
+	AcquiredAt time.Time `json:"acquired_at"` // 本任期开始的时间
+	RenewedAt  time.Time `json:"renewed_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// Status 是节点在集群中的状态，由 GET /api/v1/cluster 返回
+type Status struct {
+	NodeID         string    `json:"node_id"`
+	Role           string    `json:"role"`                 // leader / follower
+	Leader         string    `json:"leader,omitempty"`     // 当前领导者的节点 ID，租约已过期时为空
+	LeaderURL      string    `json:"leader_url,omitempty"` // 当前领导者的 advertise_url
+	Term           uint64    `json:"term"`
+	LeaseExpiresAt time.Time `json:"lease_expires_at,omitzero"`
+	Since          time.Time `json:"since"` // 本节点进入当前角色的时间
+}
+
+// Elector 参与领导者选举
+type Elector struct {
+	id      string
+	url     string
+	path    string
+	ttl     time.Duration
+	metrics *metrics.Metrics
+	logger  *slog.Logger
+
+	mu      sync.Mutex
+	lease   Lease // 最近一次读到的租约
+	leader  bool
+	term    uint64    // 本节点作为领导者的任期
+	expires time.Time // 本节点持有的租约的过期时间
+	since   time.Time
+}
+
+// New 创建一个选举者，在调用 Run 之前节点是跟随者
+func New(opts Options, m *metrics.Metrics, logger *slog.Logger) *Elector {
+	id := opts.NodeID
+	if id == "" {
+		host, _ := os.Hostname()
+		id = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	return &Elector{
+		id:      id,
+		url:     opts.AdvertiseURL,
+		path:    opts.LeaseFile,
+		ttl:     time.Duration(opts.LeaseTTLMs) * time.Millisecond,
+		metrics: m,
+		logger:  logger.With("component", "cluster", "node_id", id),
+		since:   time.Now(),
+	}
+}
+
+// NodeID 返回本节点的 ID
+func (e *Elector) NodeID() string {
+	return e.id
+}
+
+// IsLeader 返回本节点当前是否是领导者
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leader
+}
+
+// Status 返回本节点和当前领导者
+func (e *Elector) Status() Status {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	status := Status{NodeID: e.id, Role: RoleFollower, Term: e.lease.Term, Since: e.since}
+	if e.leader {
+		status.Role = RoleLeader
+	}
+	if e.lease.Holder != "" && time.Now().Before(e.lease.ExpiresAt) {
+		status.Leader = e.lease.Holder
+		status.LeaderURL = e.lease.URL
+		status.LeaseExpiresAt = e.lease.ExpiresAt
+	}
+	return status
+}
+
+// Run 每隔 TTL 的三分之一尝试获取或续约租约，直到 ctx 结束
+// 成为领导者时在新的 goroutine 中调用 onElected，失去领导权时调用 onLost；
+// ctx 结束时释放租约，调用方应在在途任务结束后再结束 ctx，避免新的领导者重复派发它们
+func (e *Elector) Run(ctx context.Context, onElected, onLost func()) {
+	interval := e.ttl / 3
+	e.logger.Info("参与领导者选举", "lease_file", e.path, "ttl", e.ttl)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		e.step(time.Now(), interval, onElected, onLost)
+		select {
+		case <-ctx.Done():
+			e.release()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// step 尝试一次获取或续约，并处理角色的变化
+func (e *Elector) step(now time.Time, margin time.Duration, onElected, onLost func()) {
+	lease, acquired, err := e.tryAcquire(now)
+	if err != nil && !errors.Is(err, ErrLocked) {
+		e.logger.Warn("读写租约失败", "error", err)
+	}
+
+	e.mu.Lock()
+	if err == nil {
+		e.lease = lease
+	}
+	switch {
+	case acquired && !e.leader:
+		e.leader, e.term, e.expires, e.since = true, lease.Term, lease.ExpiresAt, now
+		e.mu.Unlock()
+		e.metrics.ClusterLeader.Set(1)
+		e.metrics.ClusterLeaderChangesTotal.Inc()
+		e.logger.Info("成为领导者", "term", lease.Term)
+		if onElected != nil {
+			go onElected()
+		}
+		return
+	case acquired:
+		e.expires = lease.ExpiresAt
+	case e.leader && (err == nil || !now.Add(margin).Before(e.expires)):
+		// 租约已被其他节点持有，或者无法在过期前续约
+		e.leader, e.since = false, now
+		e.mu.Unlock()
+		e.metrics.ClusterLeader.Set(0)
+		e.logger.Error("失去领导权", "holder", lease.Holder, "error", err)
+		if onLost != nil {
+			onLost()
+		}
+		return
+	}
+	e.mu.Unlock()
+}
+
+// tryAcquire 读取租约，租约空闲、已过期或由本节点持有时写入新的租约
+// 返回读到 (或写入) 的租约和本节点是否持有它
+func (e *Elector) tryAcquire(now time.Time) (Lease, bool, error) {
+	unlock, err := e.lock()
+	if err != nil {
+		return Lease{}, false, err
+	}
+	defer unlock()
+
+	lease, err := readLease(e.path)
+	if err != nil {
+		return Lease{}, false, err
+	}
+	if lease.Holder != e.id && now.Before(lease.ExpiresAt) {
+		return lease, false, nil
+	}
+
+	e.mu.Lock()
+	held := e.leader && lease.Holder == e.id && lease.Term == e.term
+	e.mu.Unlock()
+	next := Lease{Holder: e.id, URL: e.url, Term: lease.Term, AcquiredAt: lease.AcquiredAt, RenewedAt: now, ExpiresAt: now.Add(e.ttl)}
+	if !held {
+		next.Term++
+		next.AcquiredAt = now
+	}
+	if err := writeLease(e.path, next); err != nil {
+		return lease, false, err
+	}
+	return next, true, nil
+}
+
+// release 在本节点是领导者时让租约立即过期，其他节点无需等待 TTL 即可接管
+func (e *Elector) release() {
+	e.mu.Lock()
+	leader, term := e.leader, e.term
+	e.leader, e.since = false, time.Now()
+	e.mu.Unlock()
+	if !leader {
+		return
+	}
+	e.metrics.ClusterLeader.Set(0)
+
+	now := time.Now()
+	unlock, err := e.lock()
+	if err != nil {
+		e.logger.Warn("释放租约失败", "error", err)
+		return
+	}
+	defer unlock()
+	lease, err := readLease(e.path)
+	if err == nil && lease.Holder == e.id && lease.Term == term {
+		lease.ExpiresAt = now
+		err = writeLease(e.path, lease)
+	}
+	if err != nil {
+		e.logger.Warn("释放租约失败", "error", err)
+		return
+	}
+	e.logger.Info("已释放租约", "term", term)
+}
+
+// lock 锁住租约的锁文件，其他实例只在读写租约的瞬间持有锁，因此短暂重试，超过 TTL 的十分之一仍未拿到时返回 ErrLocked
+// 锁文件从不删除：删除后重新创建会让两个实例分别锁住新旧两个文件而同时进入临界区
+func (e *Elector) lock() (func(), error) {
+	f, err := os.OpenFile(e.path+".lock", os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(e.ttl / 10)
+	for {
+		err = lockFile(f)
+		if !errors.Is(err, ErrLocked) || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(lockRetryInterval)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
+
+// readLease 读取租约文件，文件不存在时返回空租约
+func readLease(path string) (Lease, error) {
+	var lease Lease
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return lease, nil
+	}
+	if err != nil {
+		return lease, err
+	}
+	if len(data) == 0 {
+		return lease, nil
+	}
+	if err := json.Unmarshal(data, &lease); err != nil {
+		return lease, fmt.Errorf("parse lease file: %w", err)
+	}
+	return lease, nil
+}
+
+// writeLease 先写入临时文件再重命名，其他节点不会读到不完整的租约
+func writeLease(path string, lease Lease) error {
+	data, err := json.MarshalIndent(lease, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// lockFile 在不支持 flock 的平台上总是失败，集群模式只能运行在 Linux、macOS 和 BSD 上
+func lockFile(f *os.File) error {
+	return fmt.Errorf("%w: lease file locking on %s", errors.ErrUnsupported, runtime.GOOS)
+}
+
+// unlockFile 在不支持 flock 的平台上不做任何事
+func unlockFile(f *os.File) error {
+	return nil
+}
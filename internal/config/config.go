@@ -1,8 +1,31 @@
 package config
 
 import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"industrial-4.0-demo/internal/b2mml"
+	"industrial-4.0-demo/internal/calendar"
+	"industrial-4.0-demo/internal/chaos"
+	"industrial-4.0-demo/internal/cluster"
+	"industrial-4.0-demo/internal/costing"
+	"industrial-4.0-demo/internal/erp"
+	"industrial-4.0-demo/internal/features"
+	"industrial-4.0-demo/internal/fsm"
+	"industrial-4.0-demo/internal/notify"
+	"industrial-4.0-demo/internal/planner"
+	"industrial-4.0-demo/internal/serial"
+	"industrial-4.0-demo/internal/sparkplug"
+	"industrial-4.0-demo/internal/stationsim"
 	"industrial-4.0-demo/internal/types"
+	"industrial-4.0-demo/internal/workqueue"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/spf13/viper"
 )
@@ -10,31 +33,611 @@ import (
 // Config 定义应用程序的配置结构
 // 使用 mapstructure 标签来映射配置文件中的字段
 type Config struct {
-	MaxWorkers     int                             `mapstructure:"max_workers"`
-	StepDelayMs    int                             `mapstructure:"step_delay_ms"`
-	StationDelayMs int                             `mapstructure:"station_delay_ms"` // 新增：工站处理延时
-	Workflows      map[string][]types.WorkflowStep `mapstructure:"workflows"`
-	ResourcePools  map[types.StationID]int         `mapstructure:"resource_pools"`
+	Profile            string                            `mapstructure:"profile"` // 生效的配置集: demo / test / production
+	MaxWorkers         int                               `mapstructure:"max_workers"`
+	NamespaceQuotas    map[string]int                    `mapstructure:"namespace_quotas"` // 各命名空间 (产线) 可以同时占用的 worker 数上限，未配置的命名空间不限制
+	StepDelayMs        int                               `mapstructure:"step_delay_ms"`
+	StationDelayMs     int                               `mapstructure:"station_delay_ms"` // 新增：工站处理延时
+	Workflows          map[string][]types.WorkflowStep   `mapstructure:"workflows"`
+	WorkflowsDir       string                            `mapstructure:"workflows_dir"`        // 工作流定义目录，每个 YAML 文件定义一个或多个工作流，相对路径相对于配置文件所在的目录
+	DefaultWorkflow    string                            `mapstructure:"default_workflow"`     // 产品类型没有对应的工作流时使用的工作流
+	StrictProductTypes bool                              `mapstructure:"strict_product_types"` // 拒绝提交没有对应工作流的产品类型，不使用默认工作流
+	ResourcePools      map[types.StationID]int           `mapstructure:"resource_pools"`
+	WIPLimits          map[types.StationID]int           `mapstructure:"wip_limits"` // 各工站的在制品上限 (看板数)，下游工站达到上限时工件停留在上游，未配置的工站不限制
+	Stations           map[types.StationID]StationConfig `mapstructure:"stations"`   // 按工站覆盖的处理延时和远程地址，键为工站 ID
+	Lifecycles         map[string]fsm.Variant            `mapstructure:"lifecycles"` // 产品类型到生命周期变体的映射，未配置的类型使用标准流程
+	PriorityPolicy     PriorityPolicyConfig              `mapstructure:"priority_policy"`
+	Calendar           calendar.Spec                     `mapstructure:"calendar"` // 工站的班次、休息和计划停机，为空时全天在线
+	Auth               AuthConfig                        `mapstructure:"auth"`
+	RateLimit          RateLimitConfig                   `mapstructure:"rate_limit"`
+	Retention          RetentionConfig                   `mapstructure:"retention"`
+	Server             ServerConfig                      `mapstructure:"server"`
+	Simulation         SimulationConfig                  `mapstructure:"simulation"`
+	Alerts             AlertsConfig                      `mapstructure:"alerts"`
+	OEE                OEEConfig                         `mapstructure:"oee"`
+	Throughput         ThroughputConfig                  `mapstructure:"throughput"`
+	Reliability        ReliabilityConfig                 `mapstructure:"reliability"`
+	Defects            DefectsConfig                     `mapstructure:"defects"`
+	Yield              YieldConfig                       `mapstructure:"yield"`
+	SLA                SLAConfig                         `mapstructure:"sla"`
+	Planner            PlannerConfig                     `mapstructure:"planner"`
+	Chaos              ChaosConfig                       `mapstructure:"chaos"`
+	Replay             ReplayConfig                      `mapstructure:"replay"`
+	Audit              AuditConfig                       `mapstructure:"audit"`
+	Logging            LoggingConfig                     `mapstructure:"logging"`
+	Metrics            MetricsConfig                     `mapstructure:"metrics"`
+	Sparkplug          sparkplug.Options                 `mapstructure:"sparkplug"`      // 以 Sparkplug B 向 MQTT Broker 发布产线状态，broker 为空时不发布
+	B2MML              b2mml.Options                     `mapstructure:"b2mml"`          // B2MML 排产计划的工艺段映射和监视目录
+	ERP                erp.Options                       `mapstructure:"erp"`            // 轮询 ERP 订单的来源和字段映射，url 和 dir 都为空时不轮询
+	Notifications      notify.Options                    `mapstructure:"notifications"`  // 关键结果的通知通道 (webhook / Slack / 邮件)，channels 为空时不通知
+	Cluster            cluster.Options                   `mapstructure:"cluster"`        // 多个实例共享 WAL 时的领导者选举，未启用时单实例运行
+	Queue              workqueue.Options                 `mapstructure:"queue"`          // 共享工作队列，启用后任务由 worker 进程 (cmd/worker) 执行
+	StationServer      stationsim.Options                `mapstructure:"station_server"` // 远程工站模拟服务 (cmd/station-server) 模拟的工站，编排器不使用
+	HealthCheck        HealthCheckConfig                 `mapstructure:"health_check"`
+	Anomaly            AnomalyConfig                     `mapstructure:"anomaly"`
+	Maintenance        MaintenanceConfig                 `mapstructure:"maintenance"`
+	Operators          OperatorsConfig                   `mapstructure:"operators"` // 操作员和工站需要的技能，不配置 skills 时工站不需要操作员
+	Serial             serial.Spec                       `mapstructure:"serial"`    // 工件序列号的格式，format 为空时不分配序列号
+	Costing            costing.Spec                      `mapstructure:"costing"`   // 工站能耗模型、物料单价和人工费率，用于计算每个工件的成本
+	WAL                WALConfig                         `mapstructure:"wal"`
+	Features           map[string]bool                   `mapstructure:"features"` // 功能开关，实验性的子系统默认关闭
+
+	file            string           // 加载的配置文件路径，重新加载时读取同一个文件
+	overrides       Overrides        // 命令行参数指定的配置项，重新加载时同样优先于配置文件
+	workflowSources []workflowSource // 工作流的原始名称和所在文件，用于检查重复名称
+}
+
+// StationConfig 定义单个工站的参数，endpoint 之外的连接参数只对远程工站生效
+type StationConfig struct {
+	Endpoint    string  `mapstructure:"endpoint"`     // 远程工站服务的地址 (http(s):// 或 grpc(s)://)，为空时在进程内模拟该工站
+	DelayMs     int     `mapstructure:"delay_ms"`     // 本地工站的处理延时 (毫秒)，0 表示使用 station_delay_ms
+	FailureRate float64 `mapstructure:"failure_rate"` // 本地工站随机加工失败的概率，0 表示不注入失败
+	TimeoutMs   int     `mapstructure:"timeout_ms"`   // 单次远程调用的超时 (毫秒)，0 表示 20 秒
+	// 以异步作业调用远程工站：提交加工后轮询作业状态直到结束，加工耗时不受 timeout_ms 限制
+	Async          bool               `mapstructure:"async"`
+	PollIntervalMs int                `mapstructure:"poll_interval_ms"` // 异步模式下查询作业状态的间隔 (毫秒)，0 表示 500 毫秒
+	Retry          StationRetryConfig `mapstructure:"retry"`
+	TLS            StationTLSConfig   `mapstructure:"tls"`
+	Auth           StationAuthConfig  `mapstructure:"auth"`
+	// 本地工站每次加工采集的质量测量项，远程工站在响应中自行返回测量值
+	Measurements []types.MeasurementSpec `mapstructure:"measurements"`
+	// 追溯信息：设备实例 (资产编号)、固件版本和每件消耗的物料，远程工站在响应中返回时以响应为准
+	Machine   string                `mapstructure:"machine"`
+	Firmware  string                `mapstructure:"firmware"`
+	Materials []types.MaterialUsage `mapstructure:"materials"`
+}
+
+// StationRetryConfig 定义远程调用的重试策略，只重试网络错误和 429 / 502 / 503 / 504
+type StationRetryConfig struct {
+	MaxAttempts int `mapstructure:"max_attempts"` // 最多尝试的次数 (含第一次)，0 或 1 表示不重试
+	BackoffMs   int `mapstructure:"backoff_ms"`   // 第一次重试前的等待时间 (毫秒)，之后每次翻倍
+}
+
+// StationTLSConfig 定义连接 HTTPS 远程工站的 TLS 参数
+type StationTLSConfig struct {
+	CAFile             string `mapstructure:"ca_file"`              // 校验服务端证书的 CA 证书 (PEM)，为空时使用系统 CA
+	CertFile           string `mapstructure:"cert_file"`            // 双向 TLS 的客户端证书 (PEM)，需要与 key_file 同时配置
+	KeyFile            string `mapstructure:"key_file"`             // 客户端证书的私钥 (PEM)
+	ServerName         string `mapstructure:"server_name"`          // 校验证书时使用的主机名，为空时使用 endpoint 中的主机名
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"` // 跳过服务端证书校验，只用于测试环境
+}
+
+// StationAuthConfig 定义调用远程工站时携带的凭证，bearer_token 与 username 二选一
+type StationAuthConfig struct {
+	BearerToken string `mapstructure:"bearer_token"` // 以 Authorization: Bearer 发送的令牌
+	Username    string `mapstructure:"username"`     // HTTP Basic 认证的用户名
+	Password    string `mapstructure:"password"`     // HTTP Basic 认证的密码
+}
+
+// Enabled 判断是否配置了 TLS 参数
+func (c StationTLSConfig) Enabled() bool {
+	return c != StationTLSConfig{}
+}
+
+// Load 按配置创建 TLS 配置，读取 CA 和客户端证书文件
+func (c StationTLSConfig) Load() (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: c.ServerName, InsecureSkipVerify: c.InsecureSkipVerify}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取 CA 证书失败: %w", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA 证书 %s 中没有有效的 PEM 证书", c.CAFile)
+		}
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取客户端证书失败: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// WALConfig 定义任务预写日志的存放位置
+type WALConfig struct {
+	Path string `mapstructure:"path"` // WAL 文件路径，重启后从该文件恢复未完成的任务
+	Sync bool   `mapstructure:"sync"` // 每条记录写入后刷盘，关闭后进程崩溃时可能丢失最近的记录
+
+	PerNamespace bool `mapstructure:"per_namespace"` // 每个命名空间 (产线) 写入单独的日志文件，文件名在扩展名之前加上命名空间，默认命名空间使用 path
+}
+
+// PriorityPolicyConfig 定义提交任务时统一计算优先级的策略，启用后忽略客户端提交的优先级
+type PriorityPolicyConfig struct {
+	Enabled bool                  `mapstructure:"enabled"`
+	Default int                   `mapstructure:"default"` // 未配置的产品类型的基础优先级
+	Types   map[string]int        `mapstructure:"types"`   // 产品类型到基础优先级的映射，不区分大小写
+	Boosts  []PriorityBoostConfig `mapstructure:"boosts"`  // 加权规则，命中的规则依次累加
+}
+
+// PriorityBoostConfig 是一条加权规则，规则中可以使用 product 和 attrs，例如 attrs.rush == true
+type PriorityBoostConfig struct {
+	Rule  string `mapstructure:"rule"`
+	Boost int    `mapstructure:"boost"`
+}
+
+// AnomalyConfig 定义步骤耗时异常检测的参数
+type AnomalyConfig struct {
+	Alpha         float64 `mapstructure:"alpha"`          // EWMA 的平滑系数 (0 ~ 1)，越大基线跟随新样本越快
+	ZScore        float64 `mapstructure:"z_score"`        // 判定异常的 z-score，0 表示不检测
+	WarmupSamples int     `mapstructure:"warmup_samples"` // 开始检测前每个工站需要积累的样本数
+}
+
+// MaintenanceConfig 定义基于状态的维护规则，工站的耗时异常次数或步骤失败率达到阈值时创建维护工单
+type MaintenanceConfig struct {
+	Rules []MaintenanceRuleConfig `mapstructure:"rules"`
+}
+
+// MaintenanceRuleConfig 是一条维护规则，anomalies 和 failure_rate 至少配置一个，任意一个达到阈值即触发
+type MaintenanceRuleConfig struct {
+	Name             string            `mapstructure:"name"`
+	Stations         []types.StationID `mapstructure:"stations"`          // 适用的工站，为空时适用于所有工站
+	WindowSeconds    int               `mapstructure:"window_seconds"`    // 统计窗口
+	Anomalies        int               `mapstructure:"anomalies"`         // 窗口内耗时异常的次数达到该值时触发，0 表示不检查
+	FailureRate      float64           `mapstructure:"failure_rate"`      // 窗口内的步骤失败率达到该值时触发 (0 ~ 1)，0 表示不检查
+	MinSteps         int               `mapstructure:"min_steps"`         // 计算失败率需要的最少步骤数
+	EnterMaintenance bool              `mapstructure:"enter_maintenance"` // 触发时让工站进入维护模式，工单关闭时重新启用
+}
+
+// OperatorsConfig 定义操作员花名册和各工站需要的技能
+// 需要技能的工站在加工前占用一名持有该技能、在班且空闲的操作员，加工结束后释放
+type OperatorsConfig struct {
+	Skills map[types.StationID]string `mapstructure:"skills"` // 工站需要的技能，键为工站 ID
+	Roster []OperatorConfig           `mapstructure:"roster"`
+}
+
+// OperatorConfig 是一名操作员
+type OperatorConfig struct {
+	ID     string   `mapstructure:"id"`
+	Name   string   `mapstructure:"name"`
+	Skills []string `mapstructure:"skills"` // 持有的认证技能
+	Shift  string   `mapstructure:"shift"`  // calendar.shifts 中的班次名称，为空时全天在岗
+}
+
+// HealthCheckConfig 定义远程工站健康检查的参数
+type HealthCheckConfig struct {
+	IntervalSeconds   int `mapstructure:"interval_seconds"`    // 探测间隔，0 表示不做健康检查
+	TimeoutSeconds    int `mapstructure:"timeout_seconds"`     // 单次探测的超时
+	StaleAfterSeconds int `mapstructure:"stale_after_seconds"` // 超过该时长没有心跳的工站视为离线 (station_up 为 0)
+}
+
+// MetricsConfig 定义指标的导出方式，默认只由 Prometheus 抓取 /metrics
+type MetricsConfig struct {
+	Push MetricsPushConfig `mapstructure:"push"`
 }
 
-// LoadConfig 从 config.yaml 文件加载配置
-func LoadConfig() (*Config, error) {
-	viper.SetConfigName("config")
-	viper.SetConfigType("yaml")
-	viper.AddConfigPath(".")
+// MetricsPushConfig 定义向 Pushgateway 推送指标的参数，用于无法被 Prometheus 抓取的边缘部署
+type MetricsPushConfig struct {
+	URL             string `mapstructure:"url"`              // Pushgateway 地址，为空时不推送
+	Job             string `mapstructure:"job"`              // 推送分组的 job 标签
+	Instance        string `mapstructure:"instance"`         // 推送分组的 instance 标签，为空时使用主机名
+	IntervalSeconds int    `mapstructure:"interval_seconds"` // 推送间隔
+}
+
+// LoggingConfig 定义启动时的日志级别和日志输出，级别在运行中可通过 /api/v1/admin/loglevel 修改
+type LoggingConfig struct {
+	Level      string            `mapstructure:"level"`      // 整体级别: debug / info / warn / error
+	Components map[string]string `mapstructure:"components"` // 按组件 (engine / scheduler / station / web) 覆盖的级别
+	Format     string            `mapstructure:"format"`     // 输出格式: json / text
+	File       LogFileConfig     `mapstructure:"file"`
+}
+
+// 日志的输出格式
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// LogFileConfig 定义日志文件，日志在输出到标准输出的同时写入文件，按大小和时长轮转
+type LogFileConfig struct {
+	Path        string `mapstructure:"path"`          // 日志文件路径，为空时只输出到标准输出
+	MaxSizeMB   int    `mapstructure:"max_size_mb"`   // 文件超过该大小后轮转，0 表示不按大小轮转
+	MaxAgeHours int    `mapstructure:"max_age_hours"` // 文件打开超过该时长后轮转，0 表示不按时长轮转
+	MaxBackups  int    `mapstructure:"max_backups"`   // 保留的轮转文件数，0 表示全部保留
+}
+
+// AuditConfig 定义审计日志的存放位置
+type AuditConfig struct {
+	Path string `mapstructure:"path"` // 审计日志文件 (JSONL，只追加)，为空时不记录审计日志
+}
+
+// ThroughputConfig 定义产出、节拍和瓶颈统计的参数
+type ThroughputConfig struct {
+	GaugeWindowSeconds int `mapstructure:"gauge_window_seconds"` // 产出和瓶颈指标的统计窗口
+	MaxWindowHours     int `mapstructure:"max_window_hours"`     // 事件的保留时长，也是 /api/v1/throughput 可查询的最大窗口
+}
+
+// DefectsConfig 定义缺陷帕累托统计的参数
+type DefectsConfig struct {
+	MaxWindowHours int `mapstructure:"max_window_hours"` // 缺陷记录的保留时长，也是 /api/v1/defects/summary 可查询的最大窗口
+}
+
+// YieldConfig 定义报废判定、报废成本和最终良率的统计参数
+type YieldConfig struct {
+	MaxRework          int                         `mapstructure:"max_rework"`           // 可返工的缺陷允许的最多重试次数，超过后失败的工件报废
+	UnitCost           map[string]float64          `mapstructure:"unit_cost"`            // 各产品类型的物料成本
+	StationCost        map[types.StationID]float64 `mapstructure:"station_cost"`         // 各工站每次加工的成本
+	GaugeWindowSeconds int                         `mapstructure:"gauge_window_seconds"` // product_final_yield 和 station_yield 指标的统计窗口
+	MaxWindowHours     int                         `mapstructure:"max_window_hours"`     // 记录的保留时长，也是 /api/v1/yield 可查询的最大窗口
+}
+
+// SLAConfig 定义交期跟踪和准时交付率的统计参数
+type SLAConfig struct {
+	DueSeconds           map[string]int `mapstructure:"due_seconds"`            // 各产品类型的默认交期 (从提交起的秒数)，提交时没有指定 due_at 且未配置的产品类型不跟踪交期
+	CheckIntervalSeconds int            `mapstructure:"check_interval_seconds"` // 重新预测完工时间的间隔
+	GaugeWindowSeconds   int            `mapstructure:"gauge_window_seconds"`   // sla_on_time_delivery_ratio 指标的统计窗口
+	MaxWindowHours       int            `mapstructure:"max_window_hours"`       // 交付记录的保留时长，也是 /api/v1/sla 可查询的最大窗口
+}
+
+// PlannerConfig 定义派工计划的排产参数，工站的加工时间使用 oee.ideal_cycle_ms 的理想节拍
+type PlannerConfig struct {
+	Changeovers     []planner.Changeover `mapstructure:"changeovers"`      // 换型矩阵，按顺序匹配第一条规则，没有匹配时不需要换型
+	MakespanWeight  float64              `mapstructure:"makespan_weight"`  // 目标函数中完工时间的权重
+	TardinessWeight float64              `mapstructure:"tardiness_weight"` // 目标函数中总拖期的权重
+	MaxIterations   int                  `mapstructure:"max_iterations"`   // 局部搜索最多评估的派工顺序数
+}
+
+// ChaosConfig 定义故障注入，用于演示重试、健康检查和 Saga 补偿等容错机制
+type ChaosConfig struct {
+	Enabled bool         `mapstructure:"enabled"` // 是否提供 /api/v1/chaos 接口并注入 faults 中的故障
+	Faults  []chaos.Spec `mapstructure:"faults"`  // 启动时注入的故障，从启动开始生效 duration_seconds 秒
+}
+
+// ReplayConfig 定义生产过程的录制和回放
+type ReplayConfig struct {
+	Record string  `mapstructure:"record"` // 录制提交、取消、加工和补偿结果的回放文件，为空时不录制
+	File   string  `mapstructure:"file"`   // 不为空时进入回放模式：按该文件重新提交任务，工站返回录制的结果
+	Speed  float64 `mapstructure:"speed"`  // 回放速度的倍数，1 表示按录制时的速度
+}
+
+// ReliabilityConfig 定义工站失败率、MTBF 和 MTTR 的统计参数
+type ReliabilityConfig struct {
+	GaugeWindowSeconds int `mapstructure:"gauge_window_seconds"` // station_step_failure_rate、station_mtbf_seconds 和 station_mttr_seconds 指标的统计窗口
+	MaxWindowHours     int `mapstructure:"max_window_hours"`     // 事件的保留时长，也是 /api/v1/reliability 可查询的最大窗口
+}
+
+// OEEConfig 定义设备综合效率 (OEE) 的统计参数
+type OEEConfig struct {
+	IdealCycleMs       map[types.StationID]int `mapstructure:"ideal_cycle_ms"`       // 各工站的理想节拍 (毫秒)，未配置的工站使用 station_delay_ms
+	GaugeWindowSeconds int                     `mapstructure:"gauge_window_seconds"` // station_oee_* 指标的统计窗口
+	MaxWindowHours     int                     `mapstructure:"max_window_hours"`     // 事件的保留时长，也是 /api/v1/oee 可查询的最大窗口
+}
+
+// AlertsConfig 定义安灯板告警的触发条件
+// 工件失败、补偿失败和工站停机总是告警，队列积压按阈值告警
+type AlertsConfig struct {
+	QueueThreshold int `mapstructure:"queue_threshold"` // 调度队列长度超过该值时告警，回落后再次超过时重新告警，0 表示不检查
+}
+
+// SimulationConfig 定义订单模拟器启动时的默认参数，运行中可通过 /api/v1/sim 接口控制
+type SimulationConfig struct {
+	Autostart bool           `mapstructure:"autostart"` // 编排器启动时是否自动运行模拟器
+	Scenario  string         `mapstructure:"scenario"`  // 默认场景: demo / steady / bottleneck / rush
+	Rate      float64        `mapstructure:"rate"`      // 每分钟提交的订单数，0 表示使用场景的默认值
+	Mix       map[string]int `mapstructure:"mix"`       // 产品类型的权重，为空时使用场景的默认配比
+	Limit     int            `mapstructure:"limit"`     // 每次运行最多提交的订单数，0 表示使用场景的默认值
+
+	ScenariosDir string `mapstructure:"scenarios_dir"` // 场景文件目录，通过 POST /api/v1/sim/run/{scenario} 按名称运行，相对路径相对于配置文件所在的目录
+}
+
+// ServerConfig 定义 HTTP 服务器的监听地址、超时和请求限制，以及 gRPC 和 OPC UA 服务的监听地址
+type ServerConfig struct {
+	Addr                   string `mapstructure:"addr"`                     // 监听地址
+	ReadTimeoutSeconds     int    `mapstructure:"read_timeout_seconds"`     // 读取整个请求 (含请求体) 的超时时间，0 表示不限制
+	WriteTimeoutSeconds    int    `mapstructure:"write_timeout_seconds"`    // 写出响应的超时时间，SSE 和 WebSocket 自行管理写超时，不受此限制
+	IdleTimeoutSeconds     int    `mapstructure:"idle_timeout_seconds"`     // Keep-Alive 连接的空闲超时时间
+	ShutdownTimeoutSeconds int    `mapstructure:"shutdown_timeout_seconds"` // 停机时等待进行中的 HTTP 请求完成的最长时间
+	MaxBodyBytes           int64  `mapstructure:"max_body_bytes"`           // API 请求体的最大字节数，超出返回 413
+	GRPCAddr               string `mapstructure:"grpc_addr"`                // gRPC 服务的监听地址，为空时不启动 gRPC 服务
+	OPCUAAddr              string `mapstructure:"opcua_addr"`               // OPC UA 服务的监听地址 (host:port)，为空时不启动 OPC UA 服务
+	StaticDir              string `mapstructure:"static_dir"`               // 从磁盘提供前端静态资源的目录，为空时使用编译进二进制的资源
+}
+
+// RetentionConfig 定义实时状态中已结束工件的保留策略
+// 过期的工件从实时状态中移除，其信息仍可通过任务详情接口从加工履历中查询
+type RetentionConfig struct {
+	FinishedTTLSeconds int `mapstructure:"finished_ttl_seconds"` // 已结束 (完成/补偿完成/取消) 的工件在实时状态中保留的秒数，0 表示永久保留
+}
+
+// RateLimitConfig 定义任务提交接口的限流配置
+// 已认证的调用方按 API Key / JWT sub 限流，匿名调用方按客户端 IP 限流
+type RateLimitConfig struct {
+	Enabled           bool    `mapstructure:"enabled"`             // 是否启用限流
+	RequestsPerSecond float64 `mapstructure:"requests_per_second"` // 每个调用方每秒允许的平均请求数
+	Burst             int     `mapstructure:"burst"`               // 每个调用方允许的突发请求数
+}
+
+// AuthConfig 定义 HTTP API 与 WebSocket 的认证配置
+type AuthConfig struct {
+	Enabled bool                `mapstructure:"enabled"`  // 是否启用认证，关闭时所有接口对外开放
+	APIKeys []APIKeyConfig      `mapstructure:"api_keys"` // 静态 API Key 列表
+	JWT     JWTConfig           `mapstructure:"jwt"`      // JWT Bearer Token 配置
+	Roles   map[string][]string `mapstructure:"roles"`    // 按 JWT sub 分配的角色，与 Token 中的 roles 声明合并
+	WSToken WSTokenConfig       `mapstructure:"ws_token"` // WebSocket 连接令牌配置
+}
+
+// WSTokenConfig 定义 WebSocket 连接令牌的签名密钥和有效期
+type WSTokenConfig struct {
+	Secret     string `mapstructure:"secret"`      // HMAC 签名密钥，为空时启动时随机生成；多个实例共享看板时需配置相同的密钥
+	TTLSeconds int    `mapstructure:"ttl_seconds"` // 令牌的有效期，只需覆盖获取令牌到发起连接的时间
+}
+
+// APIKeyConfig 定义一个静态 API Key
+type APIKeyConfig struct {
+	Name       string   `mapstructure:"name"`       // Key 的持有者名称，用于日志和审计
+	Key        string   `mapstructure:"key"`        // Key 的值
+	Roles      []string `mapstructure:"roles"`      // Key 拥有的角色: viewer / operator / admin / worker
+	Namespaces []string `mapstructure:"namespaces"` // Key 可以访问的命名空间 (产线)，为空时不限制
+}
+
+// JWTConfig 定义 JWT (HS256) 校验参数
+type JWTConfig struct {
+	Secret   string `mapstructure:"secret"`   // HMAC 签名密钥，为空时不启用 JWT 认证
+	Issuer   string `mapstructure:"issuer"`   // 期望的签发者 (iss)，为空时不校验
+	Audience string `mapstructure:"audience"` // 期望的受众 (aud)，为空时不校验
+}
+
+// EnvPrefix 是覆盖配置项的环境变量前缀，配置项中的 "." 替换为 "_"，例如 FACTORY_MAX_WORKERS、FACTORY_SERVER_ADDR
+const EnvPrefix = "FACTORY"
+
+// PathEnv 是指定配置文件路径的环境变量
+const PathEnv = EnvPrefix + "_CONFIG"
+
+// Overrides 是命令行参数指定的配置项，键为配置项名称 (例如 server.addr)，优先于环境变量和配置文件
+type Overrides map[string]interface{}
+
+// LoadConfig 从配置文件 (YAML，扩展名为 .json 时按 JSON 解析) 加载配置，再依次用环境变量和 overrides 覆盖
+// 配置集由 overrides、FACTORY_PROFILE 或配置文件中的 profile 选择，都未指定时使用 demo；配置文件和环境变量中显式设置的值优先于配置集
+// path 为空时使用 FACTORY_CONFIG 指定的文件，都未指定时读取工作目录下的 config.yaml
+// 环境变量只能覆盖配置文件或默认值中出现过的配置项，例如 FACTORY_RESOURCE_POOLS_STATION_E_TEST 需要配置文件中已有该工站的资源池
+func LoadConfig(path string, overrides Overrides) (*Config, error) {
+	v := viper.New()
+	if path == "" {
+		path = os.Getenv(PathEnv)
+	}
+	if path != "" {
+		v.SetConfigFile(path)
+	} else {
+		v.SetConfigName("config")
+		v.AddConfigPath(".")
+	}
+	v.SetConfigType(fileType(path))
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+	// 兼容旧的部署方式
+	if err := v.BindEnv("stations.station_aoi.endpoint", EnvPrefix+"_STATIONS_STATION_AOI_ENDPOINT", "REMOTE_STATION_ADDR"); err != nil {
+		return nil, err
+	}
 
 	// 设置默认值
-	viper.SetDefault("step_delay_ms", 500)
-	viper.SetDefault("station_delay_ms", 10000) // 默认为 10 秒
+	v.SetDefault("max_workers", 4)
+	v.SetDefault("default_workflow", "PCB_DOUBLE_LAYER")
+	v.SetDefault("step_delay_ms", 500)
+	v.SetDefault("station_delay_ms", 10000) // 默认为 10 秒
+	v.SetDefault("retention.finished_ttl_seconds", 300)
+	v.SetDefault("auth.ws_token.ttl_seconds", 30)
+	v.SetDefault("server.addr", ":8080")
+	v.SetDefault("server.read_timeout_seconds", 15)
+	v.SetDefault("server.write_timeout_seconds", 60)
+	v.SetDefault("server.idle_timeout_seconds", 120)
+	v.SetDefault("server.shutdown_timeout_seconds", 10)
+	v.SetDefault("server.max_body_bytes", 1<<20)
+	v.SetDefault("server.grpc_addr", ":50051")
+	v.SetDefault("server.opcua_addr", ":4840")
+	v.SetDefault("simulation.scenario", "demo")
+	v.SetDefault("simulation.scenarios_dir", "scenarios")
+	v.SetDefault("alerts.queue_threshold", 20)
+	v.SetDefault("oee.gauge_window_seconds", 3600)
+	v.SetDefault("oee.max_window_hours", 24)
+	v.SetDefault("throughput.gauge_window_seconds", 3600)
+	v.SetDefault("throughput.max_window_hours", 24)
+	v.SetDefault("reliability.gauge_window_seconds", 3600)
+	v.SetDefault("reliability.max_window_hours", 24)
+	v.SetDefault("defects.max_window_hours", 24)
+	v.SetDefault("yield.max_rework", 2)
+	v.SetDefault("yield.gauge_window_seconds", 3600)
+	v.SetDefault("yield.max_window_hours", 24)
+	v.SetDefault("sla.check_interval_seconds", 5)
+	v.SetDefault("sla.gauge_window_seconds", 3600)
+	v.SetDefault("sla.max_window_hours", 24)
+	v.SetDefault("planner.makespan_weight", 1)
+	v.SetDefault("planner.tardiness_weight", 1)
+	v.SetDefault("planner.max_iterations", 2000)
+	v.SetDefault("chaos.enabled", true)
+	v.SetDefault("replay.speed", 1)
+	v.SetDefault("serial.format", "{line}-{date:060102}-{seq:5}")
+	v.SetDefault("costing.currency", costing.DefaultCurrency)
+	v.SetDefault("health_check.interval_seconds", 10)
+	v.SetDefault("health_check.timeout_seconds", 2)
+	v.SetDefault("health_check.stale_after_seconds", 30)
+	v.SetDefault("anomaly.alpha", 0.1)
+	v.SetDefault("anomaly.z_score", 3)
+	v.SetDefault("anomaly.warmup_samples", 20)
+	v.SetDefault("audit.path", "audit.jsonl")
+	v.SetDefault("logging.level", "info")
+	v.SetDefault("logging.file.max_size_mb", 100)
+	v.SetDefault("logging.file.max_age_hours", 24)
+	v.SetDefault("logging.file.max_backups", 7)
+	v.SetDefault("metrics.push.job", "orchestrator")
+	v.SetDefault("metrics.push.interval_seconds", 15)
+	v.SetDefault("sparkplug.broker", "")
+	v.SetDefault("sparkplug.client_id", "industrial-4.0-demo")
+	v.SetDefault("sparkplug.group_id", "IndustrialDemo")
+	v.SetDefault("sparkplug.edge_node_id", "Orchestrator")
+	v.SetDefault("sparkplug.interval_ms", 1000)
+	v.SetDefault("b2mml.dir", "")
+	v.SetDefault("b2mml.poll_ms", 2000)
+	v.SetDefault("b2mml.namespace", "")
+	v.SetDefault("erp.url", "")
+	v.SetDefault("erp.dir", "")
+	v.SetDefault("erp.format", "")
+	v.SetDefault("erp.records", "")
+	v.SetDefault("erp.interval_seconds", 30)
+	v.SetDefault("erp.timeout_seconds", 10)
+	v.SetDefault("erp.namespace", "")
+	v.SetDefault("erp.state_file", "")
+	v.SetDefault("erp.fields.key", "id")
+	v.SetDefault("erp.fields.id", "")
+	v.SetDefault("erp.fields.type", "type")
+	v.SetDefault("erp.fields.priority", "priority")
+	v.SetDefault("erp.fields.due_date", "due_date")
+	v.SetDefault("erp.fields.quantity", "quantity")
+	v.SetDefault("notifications.queue_size", 100)
+	v.SetDefault("notifications.timeout_seconds", 10)
+	v.SetDefault("cluster.enabled", false)
+	v.SetDefault("cluster.node_id", "")
+	v.SetDefault("cluster.advertise_url", "")
+	v.SetDefault("cluster.lease_file", "cluster.lease")
+	v.SetDefault("cluster.lease_ttl_ms", 5000)
+
+	v.SetDefault("queue.enabled", false)
+	v.SetDefault("queue.ack_wait_ms", 30000)
+	v.SetDefault("queue.max_deliver", 3)
+	v.SetDefault("queue.worker_idle_ms", 60000)
+	v.SetDefault("queue.backend", "memory")
+	v.SetDefault("queue.redis.addr", "localhost:6379")
+	v.SetDefault("queue.redis.username", "")
+	v.SetDefault("queue.redis.password", "")
+	v.SetDefault("queue.redis.db", 0)
+	v.SetDefault("queue.redis.prefix", "factory:queue")
+	v.SetDefault("queue.url", "http://localhost:8080")
+	v.SetDefault("queue.api_key", "")
+	v.SetDefault("queue.namespaces", []string{})
+	v.SetDefault("queue.worker_id", "")
+	v.SetDefault("queue.concurrency", 2)
+
+	v.SetDefault("station_server.addr", ":9090")
+	v.SetDefault("station_server.default_station", string(types.StationAOI))
+	v.SetDefault("station_server.state_file", "station-jobs.json")
+	v.SetDefault("station_server.shutdown_timeout_seconds", 30)
+	v.SetDefault("station_server.stations.station_aoi.delay_ms", 1000)
+	v.SetDefault("station_server.stations.station_aoi.jitter_ms", 5000)
+	v.SetDefault("station_server.stations.station_aoi.failure_rate", 0.1)
+	v.SetDefault("station_server.stations.station_aoi.compensate_ms", 3000)
+	v.SetDefault("station_server.stations.station_aoi.firmware", "aoi-fw 3.2.0")
+
+	v.SetDefault("stations.station_aoi.endpoint", "http://localhost:9090")
+	v.SetDefault("stations.station_aoi.timeout_ms", 20000)
+	v.SetDefault("stations.station_aoi.retry.max_attempts", 1)
+	v.SetDefault("stations.station_aoi.retry.backoff_ms", 500)
+	v.SetDefault("stations.station_aoi.auth.bearer_token", "")
+	v.SetDefault("wal.path", "tasks.wal")
+	v.SetDefault("wal.per_namespace", false)
+	v.SetDefault("profile", DefaultProfile)
+	v.SetDefault("logging.format", LogFormatJSON)
+	// 功能开关需要出现在默认值中，才能用 FACTORY_FEATURES_<名称> 环境变量打开
+	for _, name := range features.Names() {
+		v.SetDefault("features."+name, false)
+	}
+	for key, value := range overrides {
+		v.Set(key, value)
+	}
 
-	if err := viper.ReadInConfig(); err != nil {
+	if err := v.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("读取配置文件失败: %w", err)
 	}
+	// 配置集的值作为默认值，只覆盖上面的内置默认值
+	values, err := profileDefaults(v.GetString("profile"))
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range values {
+		v.SetDefault(key, value)
+	}
+	v.Set("profile", strings.ToLower(v.GetString("profile")))
 
 	var cfg Config
-	if err := viper.Unmarshal(&cfg); err != nil {
+	if err := v.Unmarshal(&cfg); err != nil {
 		return nil, fmt.Errorf("解析配置文件失败: %w", err)
 	}
+	// viper 的键不区分大小写，读出的工站 ID 为小写
+	stations := make(map[types.StationID]StationConfig, len(cfg.Stations))
+	for id, sc := range cfg.Stations {
+		stations[types.StationID(strings.ToUpper(string(id)))] = sc
+	}
+	cfg.Stations = stations
+	simulated := make(map[types.StationID]stationsim.Profile, len(cfg.StationServer.Stations))
+	for id, profile := range cfg.StationServer.Stations {
+		simulated[types.StationID(strings.ToUpper(string(id)))] = profile
+	}
+	cfg.StationServer.Stations = simulated
+	cfg.StationServer.DefaultStation = types.StationID(strings.ToUpper(string(cfg.StationServer.DefaultStation)))
+	cfg.file = v.ConfigFileUsed()
+	cfg.overrides = maps.Clone(overrides)
+	if cfg.workflowSources, err = readWorkflowNames(cfg.file); err != nil {
+		return nil, fmt.Errorf("解析配置文件失败: %w", err)
+	}
+	if cfg.WorkflowsDir != "" {
+		if err := cfg.loadWorkflowsDir(); err != nil {
+			return nil, fmt.Errorf("加载工作流目录失败: %w", err)
+		}
+	}
 
 	return &cfg, nil
 }
+
+// LoadFromFile 加载并校验配置文件，工作流、资源池、工站和 worker 数等都从文件中读取，新增产品类型无需重新编译
+// 环境变量同样生效；配置有问题时返回 *ValidationError，逐条列出出错的配置项
+func LoadFromFile(path string) (*Config, error) {
+	cfg, err := LoadConfig(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// fileType 按扩展名返回配置文件的格式，.json 按 JSON 解析，其余按 YAML 解析
+func fileType(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return "json"
+	}
+	return "yaml"
+}
+
+// File 返回加载的配置文件路径
+func (c *Config) File() string {
+	return c.file
+}
+
+// Overrides 返回加载时由命令行参数指定的配置项，重新加载时继续生效
+func (c *Config) Overrides() Overrides {
+	return maps.Clone(c.overrides)
+}
+
+// Hash 返回配置内容的摘要 (SHA-256 的前 12 位十六进制)，配置相同的实例摘要相同
+// 摘要按解析后的配置计算，包含默认值，与配置文件的格式和注释无关
+func (c *Config) Hash() string {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:12]
+}
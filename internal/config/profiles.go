@@ -0,0 +1,62 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// 内置的环境配置集，通过 -profile 参数、FACTORY_PROFILE 环境变量或配置文件中的 profile 选择
+const (
+	ProfileDemo       = "demo"       // 演示：接近真实的节拍和随机电测失败，模拟器自动运行
+	ProfileTest       = "test"       // 测试：极短的延时，没有随机失败，WAL 不刷盘
+	ProfileProduction = "production" // 生产：不注入失败，不自动运行模拟器，WAL 每条记录刷盘并启用限流
+)
+
+// DefaultProfile 是未选择配置集时使用的配置集
+const DefaultProfile = ProfileDemo
+
+// profiles 是各配置集的默认值，优先级高于内置默认值，低于配置文件和环境变量中显式设置的值
+var profiles = map[string]map[string]interface{}{
+	ProfileDemo: {
+		"step_delay_ms":                        2000,
+		"station_delay_ms":                     10000,
+		"stations.station_e_test.failure_rate": 0.05,
+		"simulation.autostart":                 true,
+		"wal.sync":                             true,
+	},
+	ProfileTest: {
+		"step_delay_ms":                        1,
+		"station_delay_ms":                     1,
+		"stations.station_e_test.failure_rate": 0,
+		"simulation.autostart":                 false,
+		"wal.sync":                             false,
+		"health_check.interval_seconds":        0,
+		"anomaly.z_score":                      0,
+	},
+	ProfileProduction: {
+		"step_delay_ms":                        2000,
+		"station_delay_ms":                     10000,
+		"stations.station_e_test.failure_rate": 0,
+		"simulation.autostart":                 false,
+		"wal.sync":                             true,
+		"rate_limit.enabled":                   true,
+		"retention.finished_ttl_seconds":       3600,
+		"chaos.enabled":                        false,
+	},
+}
+
+// Profiles 返回所有内置配置集的名称
+func Profiles() []string {
+	return slices.Sorted(maps.Keys(profiles))
+}
+
+// profileDefaults 返回配置集的默认值，配置集不存在时返回错误
+func profileDefaults(name string) (map[string]interface{}, error) {
+	values, ok := profiles[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("未知的配置集 %q，可选 %s", name, strings.Join(Profiles(), " / "))
+	}
+	return values, nil
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Redacted 是脱敏后的密钥、令牌和密码显示的值
+const Redacted = "******"
+
+// secretKeys 是需要脱敏的配置项名称，按 mapstructure 标签的最后一段匹配
+var secretKeys = []string{"secret", "key", "bearer_token", "password"}
+
+// Redact 将配置转换为按配置项名称组织的 map，密钥、令牌和密码替换为 Redacted，用于对外展示生效的配置
+func (c *Config) Redact() map[string]interface{} {
+	return redactStruct(reflect.ValueOf(*c))
+}
+
+// redactStruct 按 mapstructure 标签展开结构体
+func redactStruct(v reflect.Value) map[string]interface{} {
+	out := make(map[string]interface{}, v.NumField())
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		tag, _, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+		if !field.IsExported() || tag == "" {
+			continue
+		}
+		if f := v.Field(i); slices.Contains(secretKeys, tag) && f.Kind() == reflect.String {
+			out[tag] = ""
+			if f.String() != "" {
+				out[tag] = Redacted
+			}
+			continue
+		}
+		out[tag] = redactValue(v.Field(i))
+	}
+	return out
+}
+
+// redactValue 递归处理结构体、map 和切片中的结构体，其余值原样返回
+func redactValue(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Struct:
+		return redactStruct(v)
+	case reflect.Map:
+		out := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out[fmt.Sprint(iter.Key().Interface())] = redactValue(iter.Value())
+		}
+		return out
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Struct {
+			return v.Interface()
+		}
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			out[i] = redactValue(v.Index(i))
+		}
+		return out
+	default:
+		return v.Interface()
+	}
+}
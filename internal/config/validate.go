@@ -0,0 +1,597 @@
+package config
+
+import (
+	"fmt"
+	"industrial-4.0-demo/internal/calendar"
+	"industrial-4.0-demo/internal/costing"
+	"industrial-4.0-demo/internal/erp"
+	"industrial-4.0-demo/internal/features"
+	"industrial-4.0-demo/internal/logging"
+	"industrial-4.0-demo/internal/serial"
+	"industrial-4.0-demo/internal/types"
+	"industrial-4.0-demo/internal/workqueue"
+	"log/slog"
+	"maps"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/antonmedv/expr"
+)
+
+// ValidationError 汇总配置中的所有问题，启动时一次性列出
+type ValidationError struct {
+	Problems []string // 每个问题以出错的配置项开头，例如 workflows.pcb_multilayer[1]
+}
+
+// Error 将问题逐行列出
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "配置无效，共 %d 个问题:", len(e.Problems))
+	for _, p := range e.Problems {
+		b.WriteString("\n  - ")
+		b.WriteString(p)
+	}
+	return b.String()
+}
+
+// Validate 检查加载后的配置，返回 *ValidationError 列出全部问题，配置有效时返回 nil
+// 工作流、资源池和理想节拍中引用的工站必须是内置工站或在 stations 中配置了远程地址的工站
+func (c *Config) Validate() error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if c.MaxWorkers <= 0 {
+		add("max_workers: 工作线程数必须大于 0，当前为 %d", c.MaxWorkers)
+	}
+	if c.StepDelayMs < 0 {
+		add("step_delay_ms: 不能为负数，当前为 %d", c.StepDelayMs)
+	}
+	if c.StationDelayMs < 0 {
+		add("station_delay_ms: 不能为负数，当前为 %d", c.StationDelayMs)
+	}
+	if c.WAL.Path == "" {
+		add("wal.path: 不能为空")
+	}
+	for _, ns := range sortedKeys(c.NamespaceQuotas) {
+		if n := c.NamespaceQuotas[ns]; !types.IsValidNamespace(ns) {
+			add("namespace_quotas.%s: 不是合法的命名空间名称", ns)
+		} else if n < 1 {
+			add("namespace_quotas.%s: worker 配额必须大于 0，当前为 %d", ns, n)
+		}
+	}
+	if c.Server.OPCUAAddr != "" {
+		if _, port, err := net.SplitHostPort(c.Server.OPCUAAddr); err != nil {
+			add("server.opcua_addr: 格式应为 host:port，当前为 %q", c.Server.OPCUAAddr)
+		} else if _, err := strconv.Atoi(port); err != nil {
+			add("server.opcua_addr: 端口必须是数字，当前为 %q", port)
+		}
+	}
+
+	known := slices.Clone(types.BuiltinStations)
+	for _, id := range sortedKeys(c.Stations) {
+		sc := c.Stations[id]
+		builtin := slices.Contains(types.BuiltinStations, id)
+		switch {
+		case sc.Endpoint == "" && !builtin:
+			add("stations.%s: 不是内置工站，必须配置远程工站的 endpoint", id)
+		case sc.Endpoint != "":
+			u, err := url.Parse(sc.Endpoint)
+			switch {
+			case err != nil || u.Host == "" || !slices.Contains([]string{"http", "https", "grpc", "grpcs"}, u.Scheme):
+				add("stations.%s.endpoint: %q 不是有效的 http(s) 或 grpc(s) 地址", id, sc.Endpoint)
+			case u.Scheme == "grpc" || u.Scheme == "grpcs":
+				if strings.Trim(u.Path, "/") != "" {
+					add("stations.%s.endpoint: gRPC 地址不能包含路径，当前为 %q", id, sc.Endpoint)
+				}
+				if sc.Async || sc.PollIntervalMs > 0 {
+					add("stations.%s.async: gRPC 工站只支持同步加工", id)
+				}
+				if sc.Auth.Username != "" {
+					add("stations.%s.auth: gRPC 工站只支持 bearer_token", id)
+				}
+			}
+			if !builtin {
+				known = append(known, id)
+			}
+		}
+		if sc.DelayMs < 0 {
+			add("stations.%s.delay_ms: 不能为负数，当前为 %d", id, sc.DelayMs)
+		}
+		if sc.FailureRate < 0 || sc.FailureRate > 1 {
+			add("stations.%s.failure_rate: 必须在 [0, 1] 之间，当前为 %v", id, sc.FailureRate)
+		}
+		if sc.TimeoutMs < 0 {
+			add("stations.%s.timeout_ms: 不能为负数，当前为 %d", id, sc.TimeoutMs)
+		}
+		if sc.PollIntervalMs < 0 {
+			add("stations.%s.poll_interval_ms: 不能为负数，当前为 %d", id, sc.PollIntervalMs)
+		}
+		if sc.Retry.MaxAttempts < 0 || sc.Retry.BackoffMs < 0 {
+			add("stations.%s.retry: 重试次数和等待时间不能为负数", id)
+		}
+		if sc.TLS.Enabled() {
+			if !strings.HasPrefix(sc.Endpoint, "https://") && !strings.HasPrefix(sc.Endpoint, "grpcs://") {
+				add("stations.%s.tls: 只有 https 或 grpcs 地址才能配置 TLS", id)
+			}
+			if (sc.TLS.CertFile == "") != (sc.TLS.KeyFile == "") {
+				add("stations.%s.tls: cert_file 和 key_file 需要同时配置", id)
+			}
+			for _, f := range []string{sc.TLS.CAFile, sc.TLS.CertFile, sc.TLS.KeyFile} {
+				if _, err := os.Stat(f); f != "" && err != nil {
+					add("stations.%s.tls: 无法读取 %s: %v", id, f, err)
+				}
+			}
+		}
+		var measurementNames []string
+		for i, spec := range sc.Measurements {
+			switch {
+			case spec.Name == "":
+				add("stations.%s.measurements[%d].name: 不能为空", id, i)
+			case slices.Contains(measurementNames, spec.Name):
+				add("stations.%s.measurements[%d].name: 测量项 %q 重复", id, i, spec.Name)
+			}
+			measurementNames = append(measurementNames, spec.Name)
+			if spec.LSL >= spec.USL {
+				add("stations.%s.measurements[%d]: lsl 必须小于 usl", id, i)
+			} else if spec.Nominal < spec.LSL || spec.Nominal > spec.USL {
+				add("stations.%s.measurements[%d].nominal: 必须在 [lsl, usl] 之间，当前为 %v", id, i, spec.Nominal)
+			}
+		}
+		if sc.Endpoint != "" && len(sc.Measurements) > 0 {
+			add("stations.%s.measurements: 远程工站的测量值由远程服务返回，不能配置", id)
+		}
+		for i, m := range sc.Materials {
+			if m.Name == "" {
+				add("stations.%s.materials[%d].name: 不能为空", id, i)
+			}
+			if m.Quantity <= 0 {
+				add("stations.%s.materials[%d].quantity: 必须大于 0，当前为 %v", id, i, m.Quantity)
+			}
+		}
+		if sc.Auth.BearerToken != "" && sc.Auth.Username != "" {
+			add("stations.%s.auth: bearer_token 和 username 只能配置一种", id)
+		}
+	}
+	isKnown := func(id types.StationID) bool {
+		return slices.Contains(known, types.StationID(strings.ToUpper(string(id))))
+	}
+
+	for _, id := range sortedKeys(c.ResourcePools) {
+		if !isKnown(id) {
+			add("resource_pools.%s: 未知工站", id)
+		}
+		if size := c.ResourcePools[id]; size <= 0 {
+			add("resource_pools.%s: 资源池容量必须大于 0，当前为 %d", id, size)
+		}
+	}
+	for _, id := range sortedKeys(c.WIPLimits) {
+		if !isKnown(id) {
+			add("wip_limits.%s: 未知工站", id)
+		}
+		if limit := c.WIPLimits[id]; limit <= 0 {
+			add("wip_limits.%s: 在制品上限必须大于 0，当前为 %d", id, limit)
+		}
+	}
+	for _, id := range sortedKeys(c.OEE.IdealCycleMs) {
+		if !isKnown(id) {
+			add("oee.ideal_cycle_ms.%s: 未知工站", id)
+		}
+	}
+	if c.Yield.MaxRework < 0 {
+		add("yield.max_rework: 不能为负数，当前为 %d", c.Yield.MaxRework)
+	}
+	for _, productType := range sortedKeys(c.Yield.UnitCost) {
+		if cost := c.Yield.UnitCost[productType]; cost < 0 {
+			add("yield.unit_cost.%s: 不能为负数，当前为 %g", productType, cost)
+		}
+	}
+	for _, id := range sortedKeys(c.Yield.StationCost) {
+		if !isKnown(id) {
+			add("yield.station_cost.%s: 未知工站", id)
+		}
+		if cost := c.Yield.StationCost[id]; cost < 0 {
+			add("yield.station_cost.%s: 不能为负数，当前为 %g", id, cost)
+		}
+	}
+	for _, productType := range sortedKeys(c.SLA.DueSeconds) {
+		if due := c.SLA.DueSeconds[productType]; due <= 0 {
+			add("sla.due_seconds.%s: 必须大于 0，当前为 %d", productType, due)
+		}
+	}
+	if c.SLA.CheckIntervalSeconds <= 0 {
+		add("sla.check_interval_seconds: 必须大于 0，当前为 %d", c.SLA.CheckIntervalSeconds)
+	}
+	for i, co := range c.Planner.Changeovers {
+		if co.Seconds < 0 {
+			add("planner.changeovers[%d].seconds: 不能为负数，当前为 %g", i, co.Seconds)
+		}
+		for _, id := range co.Stations {
+			if !isKnown(id) {
+				add("planner.changeovers[%d].stations: 未知工站 %s", i, id)
+			}
+		}
+	}
+	if c.Planner.MakespanWeight < 0 || c.Planner.TardinessWeight < 0 || c.Planner.MakespanWeight+c.Planner.TardinessWeight == 0 {
+		add("planner: makespan_weight 和 tardiness_weight 不能为负数且不能都为 0，当前为 %g 和 %g", c.Planner.MakespanWeight, c.Planner.TardinessWeight)
+	}
+	if c.Planner.MaxIterations <= 0 {
+		add("planner.max_iterations: 必须大于 0，当前为 %d", c.Planner.MaxIterations)
+	}
+	for i, spec := range c.Chaos.Faults {
+		if err := spec.Validate(); err != nil {
+			add("chaos.faults[%d]: %v", i, err)
+		} else if !isKnown(spec.StationID) {
+			add("chaos.faults[%d].station_id: 未知工站 %s", i, spec.StationID)
+		}
+	}
+	if c.Replay.Speed <= 0 {
+		add("replay.speed: 必须大于 0，当前为 %g", c.Replay.Speed)
+	}
+	if c.Replay.Record != "" && c.Replay.Record == c.Replay.File {
+		add("replay.record: 不能与回放的文件相同")
+	}
+	if sp := c.Sparkplug; sp.Broker != "" {
+		if u, err := url.Parse(sp.Broker); err != nil || u.Scheme == "" || u.Host == "" {
+			add("sparkplug.broker: 不是有效的 Broker 地址 (例如 tcp://localhost:1883): %q", sp.Broker)
+		}
+		if sp.ClientID == "" {
+			add("sparkplug.client_id: 不能为空")
+		}
+		for _, f := range []struct{ key, id string }{{"group_id", sp.GroupID}, {"edge_node_id", sp.EdgeNodeID}} {
+			if f.id == "" || strings.ContainsAny(f.id, "/+#") {
+				add("sparkplug.%s: 不能为空，也不能包含 / + #，当前为 %q", f.key, f.id)
+			}
+		}
+		if sp.IntervalMs <= 0 {
+			add("sparkplug.interval_ms: 必须大于 0，当前为 %d", sp.IntervalMs)
+		}
+	}
+	if b := c.B2MML; b.Dir != "" {
+		if b.PollMs <= 0 {
+			add("b2mml.poll_ms: 必须大于 0，当前为 %d", b.PollMs)
+		}
+		if b.Namespace != "" && !types.IsValidNamespace(b.Namespace) {
+			add("b2mml.namespace: 不是合法的命名空间名称: %q", b.Namespace)
+		}
+	}
+	if e := c.ERP; e.Enabled() {
+		if e.URL != "" && e.Dir != "" {
+			add("erp: url 和 dir 只能配置一个")
+		}
+		if e.URL != "" {
+			if u, err := url.Parse(e.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				add("erp.url: 不是有效的 HTTP 地址: %q", e.URL)
+			}
+		}
+		if e.Format != "" && e.Format != erp.FormatJSON && e.Format != erp.FormatCSV {
+			add("erp.format: 必须是 json 或 csv，当前为 %q", e.Format)
+		}
+		if e.IntervalSeconds <= 0 {
+			add("erp.interval_seconds: 必须大于 0，当前为 %d", e.IntervalSeconds)
+		}
+		if e.TimeoutSeconds <= 0 {
+			add("erp.timeout_seconds: 必须大于 0，当前为 %d", e.TimeoutSeconds)
+		}
+		if e.Fields.Key == "" {
+			add("erp.fields.key: 幂等键字段不能为空")
+		}
+		if e.Fields.Type == "" {
+			add("erp.fields.type: 产品类型字段不能为空")
+		}
+		if e.Namespace != "" && !types.IsValidNamespace(e.Namespace) {
+			add("erp.namespace: 不是合法的命名空间名称: %q", e.Namespace)
+		}
+	}
+	if n := c.Notifications; n.Enabled() {
+		names := make(map[string]bool)
+		for i, ch := range n.Channels {
+			if err := ch.Validate(); err != nil {
+				add("notifications.channels[%d]: %v", i, err)
+			}
+			if names[ch.Name] {
+				add("notifications.channels[%d].name: 通道名称重复: %q", i, ch.Name)
+			}
+			names[ch.Name] = true
+		}
+		if n.QueueSize <= 0 {
+			add("notifications.queue_size: 必须大于 0，当前为 %d", n.QueueSize)
+		}
+		if n.TimeoutSeconds <= 0 {
+			add("notifications.timeout_seconds: 必须大于 0，当前为 %d", n.TimeoutSeconds)
+		}
+	}
+	if cl := c.Cluster; cl.Enabled {
+		if cl.LeaseFile == "" {
+			add("cluster.lease_file: 不能为空")
+		}
+		if cl.LeaseTTLMs < 300 {
+			add("cluster.lease_ttl_ms: 不能小于 300，当前为 %d", cl.LeaseTTLMs)
+		}
+		if cl.AdvertiseURL != "" {
+			if u, err := url.Parse(cl.AdvertiseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				add("cluster.advertise_url: 不是有效的 HTTP 地址: %q", cl.AdvertiseURL)
+			}
+		}
+		if c.Replay.File != "" {
+			add("cluster.enabled: 不能与 replay.file 同时使用")
+		}
+	}
+	if q := c.Queue; q.Enabled {
+		if q.AckWaitMs < 300 {
+			add("queue.ack_wait_ms: 不能小于 300，当前为 %d", q.AckWaitMs)
+		}
+		if q.MaxDeliver < 0 {
+			add("queue.max_deliver: 不能为负数，当前为 %d", q.MaxDeliver)
+		}
+		// 空闲等待任务的 worker 每次长轮询最多等待 30s，移除时间需要大于长轮询和确认期限
+		if q.WorkerIdleMs < max(30000, q.AckWaitMs) {
+			add("queue.worker_idle_ms: 不能小于 30000 和 ack_wait_ms，当前为 %d", q.WorkerIdleMs)
+		}
+		if q.Concurrency < 1 {
+			add("queue.concurrency: 必须大于 0，当前为 %d", q.Concurrency)
+		}
+		switch q.Backend {
+		case workqueue.BackendMemory:
+			if u, err := url.Parse(q.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				add("queue.url: 不是有效的 HTTP 地址: %q", q.URL)
+			}
+		case workqueue.BackendRedis:
+			if q.Redis.Addr == "" {
+				add("queue.redis.addr: 不能为空")
+			}
+			if q.Redis.Prefix == "" {
+				add("queue.redis.prefix: 不能为空")
+			}
+			for _, ns := range q.Namespaces {
+				if !types.IsValidNamespace(ns) {
+					add("queue.namespaces: 命名空间 %q 不合法", ns)
+				}
+			}
+		default:
+			add("queue.backend: 不支持 %q，可选 memory / redis", q.Backend)
+		}
+		if c.Replay.File != "" {
+			add("queue.enabled: 不能与 replay.file 同时使用")
+		}
+	}
+	if ss := c.StationServer; len(ss.Stations) > 0 {
+		if _, ok := ss.Stations[ss.DefaultStation]; ss.DefaultStation != "" && !ok {
+			add("station_server.default_station: %s 不在 station_server.stations 中", ss.DefaultStation)
+		}
+		if ss.ShutdownTimeoutSeconds < 0 {
+			add("station_server.shutdown_timeout_seconds: 不能为负数，当前为 %d", ss.ShutdownTimeoutSeconds)
+		}
+		addrs := map[string]string{ss.Addr: "station_server.addr"}
+		if ss.GRPCAddr != "" {
+			if ss.GRPCAddr == ss.Addr {
+				add("station_server.grpc_addr: 与 station_server.addr 相同: %q", ss.GRPCAddr)
+			}
+			addrs[ss.GRPCAddr] = "station_server.grpc_addr"
+		}
+		for _, id := range slices.Sorted(maps.Keys(ss.Stations)) {
+			p := ss.Stations[id]
+			if p.DelayMs < 0 || p.JitterMs < 0 || p.CompensateMs < 0 {
+				add("station_server.stations.%s: delay_ms、jitter_ms 和 compensate_ms 不能为负数", id)
+			}
+			if p.Capacity < 0 {
+				add("station_server.stations.%s.capacity: 不能为负数，当前为 %d", id, p.Capacity)
+			}
+			if p.FailureRate < 0 || p.FailureRate > 1 {
+				add("station_server.stations.%s.failure_rate: 必须在 0 到 1 之间，当前为 %g", id, p.FailureRate)
+			}
+			if p.Addr == "" {
+				continue
+			}
+			if other, ok := addrs[p.Addr]; ok {
+				add("station_server.stations.%s.addr: 与 %s 相同: %q", id, other, p.Addr)
+			}
+			addrs[p.Addr] = "station_server.stations." + string(id) + ".addr"
+		}
+	}
+	for segment, productType := range c.B2MML.SegmentTypes {
+		if productType == "" {
+			add("b2mml.segment_types.%s: 产品类型不能为空", segment)
+		}
+	}
+	if _, err := serial.New(c.Serial); err != nil {
+		add("serial.%s", err)
+	}
+	if _, err := costing.New(c.Costing); err != nil {
+		add("costing.%s", err)
+	}
+	for _, id := range sortedKeys(c.Costing.PowerKW) {
+		if !isKnown(id) {
+			add("costing.power_kw.%s: 未知工站", id)
+		}
+	}
+	if cal, err := calendar.New(c.Calendar); err != nil {
+		for _, problem := range strings.Split(err.Error(), "\n") {
+			add("calendar.%s", problem)
+		}
+	} else {
+		for _, id := range cal.Stations() {
+			if !isKnown(id) {
+				add("calendar: 未知工站 %s", id)
+			}
+		}
+	}
+
+	// 工作流名称不区分大小写，viper 会合并只有大小写不同的名称，因此按配置文件和工作流目录中的原始名称检查
+	sources := c.workflowSources
+	if sources == nil {
+		for _, name := range sortedKeys(c.Workflows) {
+			sources = append(sources, workflowSource{Name: name})
+		}
+	}
+	byName := make(map[string][]workflowSource)
+	for _, src := range sources {
+		normalized := strings.ToLower(strings.TrimSpace(src.Name))
+		byName[normalized] = append(byName[normalized], src)
+	}
+	for _, normalized := range sortedKeys(byName) {
+		dup := byName[normalized]
+		if len(dup) < 2 {
+			continue
+		}
+		// 重复的名称来自不同文件时标出文件
+		sameFile := !slices.ContainsFunc(dup, func(s workflowSource) bool { return s.File != dup[0].File })
+		names := make([]string, len(dup))
+		for i, src := range dup {
+			names[i] = src.Name
+			if !sameFile {
+				names[i] = fmt.Sprintf("%s (%s)", src.Name, src.File)
+			}
+		}
+		add("workflows: 工作流名称重复 (不区分大小写): %s", strings.Join(names, ", "))
+	}
+	if _, ok := c.Workflows[strings.ToLower(c.DefaultWorkflow)]; c.DefaultWorkflow != "" && !ok {
+		add("default_workflow: 工作流 %s 不存在", c.DefaultWorkflow)
+	} else if c.DefaultWorkflow == "" && !c.StrictProductTypes {
+		add("default_workflow: 未启用 strict_product_types 时不能为空")
+	}
+	env := map[string]interface{}{"product": &types.Product{}}
+	for _, name := range sortedKeys(c.Workflows) {
+		steps := c.Workflows[name]
+		if len(steps) == 0 {
+			add("workflows.%s: 至少需要一个步骤", name)
+		}
+		for i, step := range steps {
+			if len(step.StationIDs) == 0 {
+				add("workflows.%s[%d]: 步骤没有工站", name, i)
+			}
+			seen := make(map[types.StationID]bool)
+			for _, id := range step.StationIDs {
+				if !isKnown(id) {
+					add("workflows.%s[%d]: 未知工站 %s", name, i, id)
+				}
+				if seen[id] {
+					add("workflows.%s[%d]: 工站 %s 重复出现", name, i, id)
+				}
+				seen[id] = true
+			}
+			if step.Rule != "" {
+				if _, err := expr.Compile(step.Rule, expr.Env(env), expr.AsBool()); err != nil {
+					add("workflows.%s[%d].rule: 规则 %q 无效: %s", name, i, step.Rule, strings.ReplaceAll(err.Error(), "\n", " "))
+				}
+			}
+		}
+	}
+
+	for _, productType := range sortedKeys(c.Lifecycles) {
+		if variant := c.Lifecycles[productType]; !variant.IsValid() {
+			add("lifecycles.%s: 未知的生命周期变体 %q，可选 standard / prototype / multilayer", productType, variant)
+		}
+	}
+	priorityEnv := map[string]interface{}{"product": &types.Product{}, "attrs": map[string]interface{}{}}
+	for i, b := range c.PriorityPolicy.Boosts {
+		if _, err := expr.Compile(b.Rule, expr.Env(priorityEnv), expr.AsBool()); err != nil {
+			add("priority_policy.boosts[%d].rule: 规则 %q 无效: %s", i, b.Rule, strings.ReplaceAll(err.Error(), "\n", " "))
+		}
+	}
+
+	var ruleNames []string
+	for i, rule := range c.Maintenance.Rules {
+		switch {
+		case rule.Name == "":
+			add("maintenance.rules[%d].name: 不能为空", i)
+		case slices.Contains(ruleNames, rule.Name):
+			add("maintenance.rules[%d].name: 规则 %q 重复", i, rule.Name)
+		}
+		ruleNames = append(ruleNames, rule.Name)
+		for _, id := range rule.Stations {
+			if !isKnown(id) {
+				add("maintenance.rules[%d].stations: 未知工站 %s", i, id)
+			}
+		}
+		if rule.WindowSeconds <= 0 {
+			add("maintenance.rules[%d].window_seconds: 必须大于 0，当前为 %d", i, rule.WindowSeconds)
+		}
+		if rule.Anomalies < 0 || rule.MinSteps < 0 {
+			add("maintenance.rules[%d]: anomalies 和 min_steps 不能为负数", i)
+		}
+		if rule.FailureRate < 0 || rule.FailureRate > 1 {
+			add("maintenance.rules[%d].failure_rate: 必须在 [0, 1] 之间，当前为 %v", i, rule.FailureRate)
+		}
+		if rule.Anomalies == 0 && rule.FailureRate == 0 {
+			add("maintenance.rules[%d]: anomalies 和 failure_rate 至少配置一个", i)
+		}
+	}
+
+	var operatorIDs []string
+	for i, op := range c.Operators.Roster {
+		switch {
+		case op.ID == "":
+			add("operators.roster[%d].id: 不能为空", i)
+		case slices.Contains(operatorIDs, op.ID):
+			add("operators.roster[%d].id: 操作员 %q 重复", i, op.ID)
+		}
+		operatorIDs = append(operatorIDs, op.ID)
+		if len(op.Skills) == 0 {
+			add("operators.roster[%d].skills: 不能为空", i)
+		}
+		if cal, err := calendar.New(c.Calendar); err == nil && op.Shift != "" && !cal.HasShift(op.Shift) {
+			add("operators.roster[%d].shift: calendar.shifts 中没有班次 %q", i, op.Shift)
+		}
+	}
+	for _, id := range sortedKeys(c.Operators.Skills) {
+		if !isKnown(id) {
+			add("operators.skills.%s: 未知工站", id)
+		}
+		skill := c.Operators.Skills[id]
+		if !slices.ContainsFunc(c.Operators.Roster, func(op OperatorConfig) bool { return slices.Contains(op.Skills, skill) }) {
+			add("operators.skills.%s: 没有操作员持有技能 %q", id, skill)
+		}
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Logging.Level)); err != nil {
+		add("logging.level: 未知的日志级别 %q，可选 debug / info / warn / error", c.Logging.Level)
+	}
+	if f := c.Logging.Format; f != LogFormatJSON && f != LogFormatText {
+		add("logging.format: 未知的日志格式 %q，可选 json / text", f)
+	}
+	for _, component := range sortedKeys(c.Logging.Components) {
+		if !slices.Contains(logging.Components, strings.ToLower(component)) {
+			add("logging.components.%s: 未知组件，可选 %s", component, strings.Join(logging.Components, " / "))
+		}
+		if v := c.Logging.Components[component]; v != "" {
+			if err := level.UnmarshalText([]byte(v)); err != nil {
+				add("logging.components.%s: 未知的日志级别 %q", component, v)
+			}
+		}
+	}
+
+	for _, name := range sortedKeys(c.Features) {
+		if err := features.Check(name); err != nil {
+			add("features.%s: 未知的功能开关，可选 %s", name, strings.Join(features.Names(), " / "))
+		}
+	}
+
+	if hc := c.HealthCheck; hc.IntervalSeconds > 0 && hc.TimeoutSeconds <= 0 {
+		add("health_check.timeout_seconds: 启用健康检查时必须大于 0，当前为 %d", hc.TimeoutSeconds)
+	}
+	if a := c.Anomaly; a.ZScore > 0 && (a.Alpha <= 0 || a.Alpha > 1) {
+		add("anomaly.alpha: 启用异常检测时必须在 (0, 1] 之间，当前为 %v", a.Alpha)
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// sortedKeys 返回排序后的键，问题按固定顺序列出
+func sortedKeys[K ~string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"fmt"
+	"industrial-4.0-demo/internal/types"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// workflowSource 是工作流在配置中的原始名称和所在的文件
+type workflowSource struct {
+	Name string
+	File string
+}
+
+// WorkflowsPath 返回工作流定义目录的路径，未配置时返回空字符串
+func (c *Config) WorkflowsPath() string {
+	if c.WorkflowsDir == "" || filepath.IsAbs(c.WorkflowsDir) {
+		return c.WorkflowsDir
+	}
+	return filepath.Join(filepath.Dir(c.file), c.WorkflowsDir)
+}
+
+// ScenariosPath 返回场景文件目录的路径，未配置时返回空字符串
+func (c *Config) ScenariosPath() string {
+	dir := c.Simulation.ScenariosDir
+	if dir == "" || filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(filepath.Dir(c.file), dir)
+}
+
+// IsWorkflowFile 判断文件是否为工作流定义文件 (.yaml / .yml / .json)
+func IsWorkflowFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml" || ext == ".json"
+}
+
+// loadWorkflowsDir 按文件名顺序读取工作流定义目录中的文件，合并到 Workflows 中
+// 每个文件的顶层键为工作流名称，格式与配置文件的 workflows 段相同；与已有工作流重名时保留先出现的定义，由 Validate 报告重复
+func (c *Config) loadWorkflowsDir() error {
+	dir := c.WorkflowsPath()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	if c.Workflows == nil {
+		c.Workflows = make(map[string][]types.WorkflowStep)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !IsWorkflowFile(entry.Name()) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		v := viper.New()
+		v.SetConfigFile(path)
+		v.SetConfigType(fileType(path))
+		if err := v.ReadInConfig(); err != nil {
+			return fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		var workflows map[string][]types.WorkflowStep
+		if err := v.Unmarshal(&workflows); err != nil {
+			return fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		sources, err := readNames(path, false)
+		if err != nil {
+			return fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		c.workflowSources = append(c.workflowSources, sources...)
+		for name, steps := range workflows {
+			if _, exists := c.Workflows[name]; !exists {
+				c.Workflows[name] = steps
+			}
+		}
+	}
+	return nil
+}
+
+// readWorkflowNames 读取配置文件中工作流的原始名称，viper 会将键转为小写并合并只有大小写不同的键
+func readWorkflowNames(path string) ([]workflowSource, error) {
+	return readNames(path, true)
+}
+
+// readNames 读取文件中工作流的原始名称，section 为 true 时读取 workflows 段，否则读取顶层键
+func readNames(path string, section bool) ([]workflowSource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw struct {
+		Workflows map[string]interface{} `yaml:"workflows"`
+	}
+	if section {
+		err = yaml.Unmarshal(data, &raw)
+	} else {
+		err = yaml.Unmarshal(data, &raw.Workflows)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sources := make([]workflowSource, 0, len(raw.Workflows))
+	for name := range raw.Workflows {
+		sources = append(sources, workflowSource{Name: name, File: filepath.Base(path)})
+	}
+	slices.SortFunc(sources, func(a, b workflowSource) int { return strings.Compare(a.Name, b.Name) })
+	return sources, nil
+}
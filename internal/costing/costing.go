@@ -0,0 +1,123 @@
+// Package costing 按工站的能耗模型、物料单价和操作员工时计算每次加工的成本，汇总后得到每个工件的成本
+//   - 电费 = 工站加工功率 (kW) × 加工耗时 (小时) × 电价
+//   - 物料费 = 加工成功时消耗的物料数量 × 物料单价，失败的加工与追溯文档一致不计物料
+//   - 人工费 = 占用操作员的加工耗时 (小时) × 操作员的小时费率
+package costing
+
+import (
+	"fmt"
+	"industrial-4.0-demo/internal/types"
+	"math"
+	"strings"
+	"time"
+)
+
+// DefaultCurrency 是未配置货币时使用的货币
+const DefaultCurrency = "CNY"
+
+// Spec 是配置文件中的成本参数，工站 ID、物料名称和操作员 ID 不区分大小写
+type Spec struct {
+	Currency       string                      `mapstructure:"currency"`        // 金额的货币，仅用于展示
+	EnergyPrice    float64                     `mapstructure:"energy_price"`    // 每 kWh 的电价
+	PowerKW        map[types.StationID]float64 `mapstructure:"power_kw"`        // 各工站加工时的平均功率，未配置的工站不计能耗
+	MaterialPrices []MaterialPrice             `mapstructure:"material_prices"` // 未配置的物料不计物料费
+	LaborRate      float64                     `mapstructure:"labor_rate"`      // 操作员每小时的人工费
+	OperatorRates  map[string]float64          `mapstructure:"operator_rates"`  // 按操作员覆盖的小时费率
+}
+
+// MaterialPrice 是物料每个用量单位的单价
+// 物料名称可能包含 "."，与 Viper 的键分隔符冲突，因此使用列表而不是以名称为键的映射
+type MaterialPrice struct {
+	Name  string  `mapstructure:"name"`
+	Price float64 `mapstructure:"price"`
+}
+
+// Model 是成本模型
+type Model struct {
+	currency      string
+	energyPrice   float64
+	powerKW       map[types.StationID]float64
+	materialPrice map[string]float64
+	laborRate     float64
+	operatorRates map[string]float64
+}
+
+// New 校验成本参数并创建成本模型
+func New(spec Spec) (*Model, error) {
+	m := &Model{
+		currency:      spec.Currency,
+		energyPrice:   spec.EnergyPrice,
+		powerKW:       make(map[types.StationID]float64, len(spec.PowerKW)),
+		materialPrice: make(map[string]float64, len(spec.MaterialPrices)),
+		laborRate:     spec.LaborRate,
+		operatorRates: make(map[string]float64, len(spec.OperatorRates)),
+	}
+	if m.currency == "" {
+		m.currency = DefaultCurrency
+	}
+	if spec.EnergyPrice < 0 {
+		return nil, fmt.Errorf("energy_price: 不能为负数，当前为 %g", spec.EnergyPrice)
+	}
+	if spec.LaborRate < 0 {
+		return nil, fmt.Errorf("labor_rate: 不能为负数，当前为 %g", spec.LaborRate)
+	}
+	for id, kw := range spec.PowerKW {
+		if kw < 0 {
+			return nil, fmt.Errorf("power_kw.%s: 不能为负数，当前为 %g", id, kw)
+		}
+		m.powerKW[types.StationID(strings.ToUpper(string(id)))] = kw
+	}
+	for i, p := range spec.MaterialPrices {
+		if p.Name == "" {
+			return nil, fmt.Errorf("material_prices[%d].name: 不能为空", i)
+		}
+		if p.Price < 0 {
+			return nil, fmt.Errorf("material_prices[%d].price: 不能为负数，当前为 %g", i, p.Price)
+		}
+		m.materialPrice[strings.ToLower(p.Name)] = p.Price
+	}
+	for id, rate := range spec.OperatorRates {
+		if rate < 0 {
+			return nil, fmt.Errorf("operator_rates.%s: 不能为负数，当前为 %g", id, rate)
+		}
+		m.operatorRates[strings.ToLower(id)] = rate
+	}
+	return m, nil
+}
+
+// Step 计算一次加工的成本，provenance 提供操作员和消耗的物料
+func (m *Model) Step(id types.StationID, duration time.Duration, success bool, provenance types.Provenance) types.Cost {
+	hours := duration.Hours()
+	c := types.Cost{Currency: m.currency}
+	c.EnergyKWh = m.powerKW[id] * hours
+	c.Energy = c.EnergyKWh * m.energyPrice
+	if success {
+		for _, u := range provenance.Materials {
+			c.Material += u.Quantity * m.materialPrice[strings.ToLower(u.Name)]
+		}
+	}
+	if provenance.Operator != "" {
+		rate, ok := m.operatorRates[strings.ToLower(provenance.Operator)]
+		if !ok {
+			rate = m.laborRate
+		}
+		c.LaborSeconds = duration.Seconds()
+		c.Labor = hours * rate
+	}
+	c.Total = c.Energy + c.Material + c.Labor
+	return Round(c)
+}
+
+// Round 将成本各项保留 6 位小数，避免浮点累加误差出现在接口响应中
+func Round(c types.Cost) types.Cost {
+	r := func(v float64) float64 { return math.Round(v*1e6) / 1e6 }
+	return types.Cost{
+		Currency:     c.Currency,
+		EnergyKWh:    r(c.EnergyKWh),
+		LaborSeconds: r(c.LaborSeconds),
+		Energy:       r(c.Energy),
+		Material:     r(c.Material),
+		Labor:        r(c.Labor),
+		Total:        r(c.Total),
+	}
+}
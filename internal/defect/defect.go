@@ -0,0 +1,219 @@
+// Package defect 定义各工站的缺陷代码目录，将加工失败归类为结构化的缺陷，并按缺陷代码汇总帕累托 (Pareto) 数据
+package defect
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"industrial-4.0-demo/internal/event"
+	"industrial-4.0-demo/internal/metrics"
+	"industrial-4.0-demo/internal/types"
+	"industrial-4.0-demo/internal/windowed"
+	"math/rand"
+	"slices"
+	"sync"
+	"time"
+)
+
+// 缺陷类别
+const (
+	CategoryEngineering  = "engineering"  // 工程资料
+	CategoryDrilling     = "drilling"     // 钻孔
+	CategoryLamination   = "lamination"   // 层压
+	CategoryEtching      = "etching"      // 蚀刻
+	CategorySolderMask   = "solder_mask"  // 阻焊
+	CategoryLegend       = "legend"       // 字符
+	CategoryPattern      = "pattern"      // 线路图形 (AOI)
+	CategoryElectrical   = "electrical"   // 电气性能 (电测)
+	CategoryPackaging    = "packaging"    // 包装
+	CategoryEquipment    = "equipment"    // 设备故障、通信失败或超时，与工件本身无关
+	CategoryUnclassified = "unclassified" // 工站没有返回缺陷代码的失败
+)
+
+// Catalog 是各内置工站可能判定的缺陷，本地工站加工失败时从中随机选择一个
+var Catalog = map[types.StationID][]types.Defect{
+	types.StationCAM: {
+		{Category: CategoryEngineering, Code: "CAM-DRC", Description: "设计规则检查未通过", Disposition: types.DispositionHold},
+	},
+	types.StationDrill: {
+		{Category: CategoryDrilling, Code: "DR-MISSING", Description: "漏钻孔", Disposition: types.DispositionRework},
+		{Category: CategoryDrilling, Code: "DR-OFFSET", Description: "孔位偏移", Disposition: types.DispositionScrap},
+	},
+	types.StationLami: {
+		{Category: CategoryLamination, Code: "LA-DELAM", Description: "层间分层", Disposition: types.DispositionScrap},
+	},
+	types.StationEtch: {
+		{Category: CategoryEtching, Code: "EC-OVER", Description: "过蚀导致线宽不足", Disposition: types.DispositionScrap},
+		{Category: CategoryEtching, Code: "EC-RESIDUE", Description: "蚀刻残铜", Disposition: types.DispositionRework},
+	},
+	types.StationMask: {
+		{Category: CategorySolderMask, Code: "SM-SKIP", Description: "阻焊漏印", Disposition: types.DispositionRework},
+	},
+	types.StationSilk: {
+		{Category: CategoryLegend, Code: "LG-BLUR", Description: "字符模糊", Disposition: types.DispositionRework},
+	},
+	types.StationAOI: {
+		{Category: CategoryPattern, Code: "AOI-SHORT", Description: "线路短路", Disposition: types.DispositionScrap},
+		{Category: CategoryPattern, Code: "AOI-OPEN", Description: "线路开路", Disposition: types.DispositionScrap},
+	},
+	types.StationETest: {
+		{Category: CategoryElectrical, Code: "ET-OPEN", Description: "电测开路", Disposition: types.DispositionScrap},
+		{Category: CategoryElectrical, Code: "ET-SHORT", Description: "电测短路", Disposition: types.DispositionHold},
+	},
+	types.StationPack: {
+		{Category: CategoryPackaging, Code: "PK-DAMAGE", Description: "包装破损", Disposition: types.DispositionRework},
+	},
+}
+
+// Primary 返回工站目录中的第一个缺陷，工站没有目录时返回通用的加工缺陷
+func Primary(id types.StationID) *types.Defect {
+	if defects := Catalog[id]; len(defects) > 0 {
+		d := defects[0]
+		return &d
+	}
+	return &types.Defect{Category: CategoryUnclassified, Code: "PROC-NG", Description: string(id) + " 加工未通过", Disposition: types.DispositionHold}
+}
+
+// Random 从工站的目录中随机选择一个缺陷，工站没有目录时与 Primary 相同
+func Random(id types.StationID) *types.Defect {
+	defects := Catalog[id]
+	if len(defects) == 0 {
+		return Primary(id)
+	}
+	d := defects[rand.Intn(len(defects))]
+	return &d
+}
+
+// Equipment 返回与工件无关的设备类缺陷，工件可以返工
+func Equipment(code, description string) *types.Defect {
+	return &types.Defect{Category: CategoryEquipment, Code: code, Description: description, Disposition: types.DispositionRework}
+}
+
+// Classify 将加工失败的错误归类为缺陷：错误链中有缺陷时直接使用，超时归为设备缺陷，其余归为未分类
+func Classify(err error) *types.Defect {
+	if err == nil {
+		return nil
+	}
+	var d *types.Defect
+	if errors.As(err, &d) {
+		return d
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return Equipment("EQ-TIMEOUT", "工站响应超时")
+	}
+	return &types.Defect{Category: CategoryUnclassified, Code: "UNCLASSIFIED", Description: err.Error(), Disposition: types.DispositionHold}
+}
+
+// CodeCount 是一个缺陷代码在统计窗口内的次数
+type CodeCount struct {
+	Category    string  `json:"category"`
+	Code        string  `json:"code"`
+	Description string  `json:"description"`
+	Disposition string  `json:"disposition"`
+	Count       int     `json:"count"`
+	Share       float64 `json:"share"`      // 占全部缺陷的比例，0 ~ 1
+	Cumulative  float64 `json:"cumulative"` // 按次数从高到低累计的比例，用于绘制帕累托曲线
+}
+
+// CategoryCount 是一个缺陷类别在统计窗口内的次数
+type CategoryCount struct {
+	Category string  `json:"category"`
+	Count    int     `json:"count"`
+	Share    float64 `json:"share"`
+}
+
+// Summary 是统计窗口内的缺陷帕累托数据，Codes 和 Categories 按次数从高到低排列
+type Summary struct {
+	Window       string          `json:"window"`
+	From         time.Time       `json:"from"`
+	To           time.Time       `json:"to"`
+	StationID    types.StationID `json:"station_id,omitempty"` // 只统计该工站，为空时统计所有工站
+	Total        int             `json:"total"`
+	Dispositions map[string]int  `json:"dispositions"` // 按处置方式统计的次数
+	Categories   []CategoryCount `json:"categories"`
+	Codes        []CodeCount     `json:"codes"`
+}
+
+// record 是一次缺陷
+type record struct {
+	at        time.Time
+	stationID types.StationID
+	defect    types.Defect
+}
+
+// Tracker 订阅步骤完成事件，保留最近 retention 时长内的缺陷并按需汇总
+type Tracker struct {
+	mu        sync.Mutex
+	retention windowed.Retention
+	records   []record
+	metrics   *metrics.Metrics
+}
+
+// NewTracker 创建一个缺陷追踪器，retention 是缺陷记录的保留时长，也是可查询的最大窗口
+func NewTracker(retention time.Duration, m *metrics.Metrics) *Tracker {
+	return &Tracker{retention: windowed.NewRetention(retention), metrics: m}
+}
+
+// Register 订阅步骤完成事件，记录失败步骤的缺陷
+func (t *Tracker) Register(bus *event.Bus) {
+	bus.Subscribe(event.StepCompleted, func(e event.Event) {
+		if e.Defect == nil {
+			return
+		}
+		t.metrics.DefectsTotal.WithLabelValues(string(e.StationID), e.Defect.Category, e.Defect.Disposition, e.Namespace()).Inc()
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.records = append(t.records, record{at: e.Timestamp, stationID: e.StationID, defect: *e.Defect})
+		t.records = windowed.Prune(t.records, t.retention.Cutoff(e.Timestamp), func(r record) time.Time { return r.at })
+	})
+}
+
+// Summary 汇总截至 now 的 window 时长内的缺陷，stationID 不为空时只统计该工站
+func (t *Tracker) Summary(window time.Duration, now time.Time, stationID types.StationID) (Summary, error) {
+	from, err := t.retention.From(window, now)
+	if err != nil {
+		return Summary{}, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := Summary{Window: window.String(), From: from, To: now, StationID: stationID, Dispositions: map[string]int{}, Categories: []CategoryCount{}, Codes: []CodeCount{}}
+	codes := make(map[string]*CodeCount)
+	categories := make(map[string]int)
+	for _, r := range t.records {
+		if r.at.Before(from) || r.at.After(now) || (stationID != "" && r.stationID != stationID) {
+			continue
+		}
+		s.Total++
+		s.Dispositions[r.defect.Disposition]++
+		categories[r.defect.Category]++
+		c, ok := codes[r.defect.Code]
+		if !ok {
+			c = &CodeCount{Category: r.defect.Category, Code: r.defect.Code, Description: r.defect.Description, Disposition: r.defect.Disposition}
+			codes[r.defect.Code] = c
+		}
+		c.Count++
+	}
+	if s.Total == 0 {
+		return s, nil
+	}
+	for category, n := range categories {
+		s.Categories = append(s.Categories, CategoryCount{Category: category, Count: n, Share: float64(n) / float64(s.Total)})
+	}
+	slices.SortFunc(s.Categories, func(a, b CategoryCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Category, b.Category))
+	})
+	for _, c := range codes {
+		s.Codes = append(s.Codes, *c)
+	}
+	slices.SortFunc(s.Codes, func(a, b CodeCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Code, b.Code))
+	})
+	cumulative := 0
+	for i := range s.Codes {
+		cumulative += s.Codes[i].Count
+		s.Codes[i].Share = float64(s.Codes[i].Count) / float64(s.Total)
+		s.Codes[i].Cumulative = float64(cumulative) / float64(s.Total)
+	}
+	return s, nil
+}
@@ -0,0 +1,231 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"industrial-4.0-demo/internal/calendar"
+	"industrial-4.0-demo/internal/event"
+	"industrial-4.0-demo/internal/types"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoOperator 表示没有持有工站所需技能的操作员，工件无法在该工站加工
+var ErrNoOperator = errors.New("no operator holds the required skill")
+
+// operatorRecheck 是所有合格的操作员都不在班时重新检查的间隔
+const operatorRecheck = time.Second
+
+// 操作员的状态
+const (
+	OperatorIdle     = "idle"
+	OperatorBusy     = "busy"
+	OperatorOffShift = "off_shift" // 不在所属的班次内，不接受新的分配
+)
+
+// Operator 是一名操作员，Shift 为日历中的班次名称，为空时全天在岗
+type Operator struct {
+	ID     string
+	Name   string
+	Skills []string
+	Shift  string
+}
+
+// OperatorInfo 是操作员的快照
+type OperatorInfo struct {
+	ID          string          `json:"id"`
+	Name        string          `json:"name"`
+	Skills      []string        `json:"skills"`
+	Shift       string          `json:"shift,omitempty"`
+	Status      string          `json:"status"`               // idle / busy / off_shift
+	StationID   types.StationID `json:"station_id,omitempty"` // 正在操作的工站
+	ProductID   string          `json:"product_id,omitempty"` // 正在加工的工件
+	Since       time.Time       `json:"since,omitzero"`       // 本次分配的开始时间
+	Assignments int             `json:"assignments"`          // 累计分配的加工次数
+	BusySeconds float64         `json:"busy_seconds"`         // 累计加工时长，不含进行中的分配
+}
+
+// operatorRuntime 记录操作员的当前分配和累计负荷
+type operatorRuntime struct {
+	Operator
+	station     types.StationID
+	product     string
+	since       time.Time
+	assignments int
+	busy        time.Duration
+	seq         uint64
+}
+
+// OperatorPool 按技能为工站分配操作员：需要认证操作员的工站在加工前占用一名持有该技能、在班且空闲的操作员，加工结束后释放
+// 多名操作员合格时选择累计分配次数最少的一名；nil 的 *OperatorPool 表示不需要操作员
+type OperatorPool struct {
+	mu        sync.Mutex
+	operators []*operatorRuntime
+	skills    map[types.StationID]string // 工站需要的技能
+	calendar  *calendar.Calendar
+	changed   chan struct{} // 操作员被释放或日历被替换时关闭，唤醒等待的工件
+	bus       *event.Bus
+}
+
+// NewOperatorPool 创建操作员池并发布所有操作员的初始状态，skills 为各工站需要的技能，工站 ID 不区分大小写
+func NewOperatorPool(operators []Operator, skills map[types.StationID]string, bus *event.Bus) *OperatorPool {
+	p := &OperatorPool{
+		skills:  make(map[types.StationID]string, len(skills)),
+		changed: make(chan struct{}),
+		bus:     bus,
+	}
+	for id, skill := range skills {
+		p.skills[types.StationID(strings.ToUpper(string(id)))] = skill
+	}
+	for _, op := range operators {
+		rt := &operatorRuntime{Operator: op}
+		p.operators = append(p.operators, rt)
+		p.publishLocked(rt)
+	}
+	return p
+}
+
+// SetCalendar 设置判断操作员是否在班的日历
+func (p *OperatorPool) SetCalendar(c *calendar.Calendar) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calendar = c
+	p.notifyLocked()
+}
+
+// acquire 为工站上的工件占用一名操作员，工站不需要操作员时返回 nil
+// 没有合格的操作员空闲或在班时等待，ctx 结束时返回 ctx 的错误；没有任何操作员持有所需技能时返回 ErrNoOperator
+func (p *OperatorPool) acquire(ctx context.Context, id types.StationID, productID string, logger *slog.Logger) (*operatorRuntime, error) {
+	if p == nil {
+		return nil, nil
+	}
+	waiting := false
+	for {
+		p.mu.Lock()
+		skill, ok := p.skills[id]
+		if !ok {
+			p.mu.Unlock()
+			return nil, nil
+		}
+		now := time.Now()
+		var best *operatorRuntime
+		qualified := false
+		for _, op := range p.operators {
+			if !slices.Contains(op.Skills, skill) {
+				continue
+			}
+			qualified = true
+			if op.product != "" || !p.calendar.OnShift(op.Shift, now) {
+				continue
+			}
+			if best == nil || op.assignments < best.assignments {
+				best = op
+			}
+		}
+		if !qualified {
+			p.mu.Unlock()
+			return nil, ErrNoOperator
+		}
+		if best != nil {
+			best.station, best.product, best.since = id, productID, now
+			best.assignments++
+			p.publishLocked(best)
+			p.mu.Unlock()
+			logger.Info("分配操作员", "operator_id", best.ID, "skill", skill)
+			return best, nil
+		}
+		changed := p.changed
+		p.mu.Unlock()
+
+		if !waiting {
+			logger.Info("等待操作员", "skill", skill)
+			waiting = true
+		}
+		// 操作员上班没有事件通知，定期重新检查
+		timer := time.NewTimer(operatorRecheck)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-changed:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// release 释放 acquire 占用的操作员
+func (p *OperatorPool) release(op *operatorRuntime, logger *slog.Logger) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	op.busy += time.Since(op.since)
+	op.station, op.product, op.since = "", "", time.Time{}
+	p.publishLocked(op)
+	p.notifyLocked()
+	logger.Info("释放操作员", "operator_id", op.ID)
+}
+
+// notifyLocked 唤醒所有等待操作员的工件，调用方必须持有 p.mu
+func (p *OperatorPool) notifyLocked() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// publishLocked 发布操作员的当前分配和累计负荷，调用方必须持有 p.mu
+// 事件处理器是异步执行的，消费者根据序号丢弃乱序到达的旧状态
+func (p *OperatorPool) publishLocked(op *operatorRuntime) {
+	op.seq++
+	p.bus.Publish(event.Event{
+		Type:      event.OperatorChanged,
+		StationID: op.station,
+		ProductID: op.product,
+		Seq:       op.seq,
+		Operator: &event.OperatorUsage{
+			ID:          op.ID,
+			Name:        op.Name,
+			Busy:        op.product != "",
+			Assignments: op.assignments,
+			BusySeconds: op.busy.Seconds(),
+		},
+	})
+}
+
+// List 返回所有操作员的快照，按 ID 排序
+func (p *OperatorPool) List() []OperatorInfo {
+	list := []OperatorInfo{}
+	if p == nil {
+		return list
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	for _, op := range p.operators {
+		info := OperatorInfo{
+			ID:          op.ID,
+			Name:        op.Name,
+			Skills:      op.Skills,
+			Shift:       op.Shift,
+			Status:      OperatorIdle,
+			StationID:   op.station,
+			ProductID:   op.product,
+			Since:       op.since,
+			Assignments: op.assignments,
+			BusySeconds: op.busy.Seconds(),
+		}
+		switch {
+		case op.product != "":
+			info.Status = OperatorBusy
+		case !p.calendar.OnShift(op.Shift, now):
+			info.Status = OperatorOffShift
+		}
+		list = append(list, info)
+	}
+	slices.SortFunc(list, func(a, b OperatorInfo) int { return strings.Compare(a.ID, b.ID) })
+	return list
+}
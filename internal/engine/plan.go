@@ -0,0 +1,154 @@
+package engine
+
+import (
+	"container/heap"
+	"errors"
+	"industrial-4.0-demo/internal/planner"
+	"industrial-4.0-demo/internal/types"
+	"slices"
+	"time"
+)
+
+// ErrNoPlan 表示调度器当前没有执行派工计划
+var ErrNoPlan = errors.New("no dispatch plan")
+
+// SetPlanning 设置生成派工计划使用的排产参数
+// Workers 和 Capacity 在每次排产时按当前的 worker 数和工站资源池容量填充
+func (s *Scheduler) SetPlanning(opts planner.Options) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.planning = opts
+}
+
+// Plan 按当前队列、工艺路线、工站产能、换型矩阵和交期生成派工计划，不改变出队顺序
+func (s *Scheduler) Plan() planner.Plan {
+	jobs, opts := s.planningInput()
+	return planner.Optimize(jobs, opts, time.Now())
+}
+
+// Forecast 返回正在执行的派工计划；没有计划时按当前出队顺序和排产参数估算队列的预计进度，
+// 最近一次执行完毕的派工计划中的任务保留在估算结果的开头，用于对比计划与实际
+// 第二个返回值表示是否来自正在执行的派工计划
+func (s *Scheduler) Forecast() (planner.Plan, bool) {
+	s.mu.Lock()
+	plan, done := s.plan, s.donePlan
+	s.mu.Unlock()
+	if plan != nil {
+		return *plan, true
+	}
+	jobs, opts := s.planningInput()
+	forecast := planner.Project(jobs, opts, time.Now())
+	if done != nil {
+		forecast.Jobs = append(slices.Clone(done.Jobs), forecast.Jobs...)
+	}
+	return forecast, false
+}
+
+// planningInput 按当前出队顺序生成排产的任务列表，并填充 worker 数和工站资源池容量
+func (s *Scheduler) planningInput() ([]planner.Job, planner.Options) {
+	s.mu.Lock()
+	opts := s.planning
+	opts.Workers = s.maxWorkers
+	items := s.orderedLocked()
+	s.mu.Unlock()
+
+	opts.Capacity = make(map[types.StationID]int)
+	for _, info := range s.engine.stations.List() {
+		opts.Capacity[info.ID] = info.PoolSize
+	}
+	jobs := make([]planner.Job, 0, len(items))
+	for _, item := range items {
+		jobs = append(jobs, planner.Job{
+			ProductID: item.Product.ID,
+			Type:      item.Product.Type,
+			Priority:  item.Product.Priority,
+			Namespace: item.Product.Namespace,
+			DueAt:     item.Product.DueAt,
+			Steps:     s.engine.workflows.Route(item.Product.Type),
+		})
+	}
+	return jobs, opts
+}
+
+// ApplyPlan 切换为按计划出队，返回计划中仍在队列里的任务数
+// 计划生成后已出队或取消的任务被跳过，之后提交的任务排在计划之后按优先级出队；计划内的任务全部出队后恢复按优先级出队
+func (s *Scheduler) ApplyPlan(plan planner.Plan) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, item := range s.queued {
+		item.rank = 0
+	}
+	applied := 0
+	for _, a := range plan.Jobs {
+		if item, ok := s.queued[a.ProductID]; ok && item.rank == 0 {
+			applied++
+			item.rank = applied
+		}
+	}
+	heap.Init(&s.pq)
+	s.plan, s.planLeft, s.donePlan = &plan, applied, nil
+	if applied == 0 {
+		s.plan = nil
+	}
+	s.publishStateLocked()
+	s.cond.Broadcast()
+	s.logger.Info("已应用派工计划", "planned", applied, "makespan_seconds", plan.Makespan, "tardiness_seconds", plan.TotalTardiness)
+	return applied
+}
+
+// CurrentPlan 返回正在执行的派工计划，没有时返回 ErrNoPlan
+func (s *Scheduler) CurrentPlan() (planner.Plan, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.plan == nil {
+		return planner.Plan{}, ErrNoPlan
+	}
+	return *s.plan, nil
+}
+
+// ClearPlan 放弃正在执行的派工计划，恢复按优先级出队
+func (s *Scheduler) ClearPlan() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.plan == nil {
+		return
+	}
+	s.clearPlanLocked()
+	heap.Init(&s.pq)
+	s.publishStateLocked()
+	s.logger.Info("已放弃派工计划，恢复按优先级出队")
+}
+
+// clearPlanLocked 清除计划顺序，调用方必须持有 s.mu 并在之后重建堆
+func (s *Scheduler) clearPlanLocked() {
+	for _, item := range s.queued {
+		item.rank = 0
+	}
+	s.plan, s.planLeft, s.donePlan = nil, 0, nil
+}
+
+// leavePlanLocked 在计划内的任务离开队列时调用，最后一个计划内的任务离开后恢复按优先级出队
+// 调用方必须持有 s.mu
+func (s *Scheduler) leavePlanLocked(item *Item) {
+	if item.rank == 0 || s.plan == nil {
+		return
+	}
+	s.planLeft--
+	if s.planLeft == 0 {
+		s.plan, s.donePlan = nil, s.plan
+		s.logger.Info("派工计划执行完毕，恢复按优先级出队")
+	}
+}
+
+// orderedLocked 返回按出队顺序排列的队列副本，调用方必须持有 s.mu
+// 堆只保证堆顶有序，按出队规则排序后得到完整的出队顺序
+func (s *Scheduler) orderedLocked() []*Item {
+	items := slices.Clone(s.pq)
+	slices.SortFunc(items, func(a, b *Item) int {
+		if before(a, b) {
+			return -1
+		}
+		return 1
+	})
+	return items
+}
@@ -0,0 +1,83 @@
+package engine
+
+import (
+	"fmt"
+	"industrial-4.0-demo/internal/types"
+	"strings"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/vm"
+)
+
+// PriorityBoost 是一条加权规则，规则对工件求值为 true 时优先级加上 Boost
+// 规则中可以使用 product (工件) 和 attrs (工件的动态属性)，例如 attrs.rush == true
+type PriorityBoost struct {
+	Rule  string
+	Boost int
+}
+
+// PriorityPolicy 在提交时按产品类型和加权规则统一计算任务的优先级，忽略客户端提交的优先级
+type PriorityPolicy struct {
+	base   int            // 未配置的产品类型的基础优先级
+	types  map[string]int // 产品类型 (小写) 到基础优先级的映射
+	boosts []compiledBoost
+}
+
+// compiledBoost 是编译后的加权规则
+type compiledBoost struct {
+	rule    string
+	program *vm.Program
+	boost   int
+}
+
+// priorityEnv 返回规则求值的环境，attrs 为空时使用空 map，未设置的属性求值为 nil
+func priorityEnv(p *types.Product) map[string]interface{} {
+	attrs := p.Attrs
+	if attrs == nil {
+		attrs = map[string]interface{}{}
+	}
+	return map[string]interface{}{"product": p, "attrs": attrs}
+}
+
+// CompilePriorityRule 检查加权规则能否编译为布尔表达式
+func CompilePriorityRule(rule string) (*vm.Program, error) {
+	return expr.Compile(rule, expr.Env(priorityEnv(&types.Product{})), expr.AsBool())
+}
+
+// NewPriorityPolicy 创建优先级策略，base 是未配置的产品类型的基础优先级，产品类型不区分大小写
+// 任一加权规则无法编译时返回错误
+func NewPriorityPolicy(base int, byType map[string]int, boosts []PriorityBoost) (*PriorityPolicy, error) {
+	policy := &PriorityPolicy{base: base, types: make(map[string]int, len(byType))}
+	for t, priority := range byType {
+		policy.types[strings.ToLower(t)] = priority
+	}
+	for i, b := range boosts {
+		program, err := CompilePriorityRule(b.Rule)
+		if err != nil {
+			return nil, fmt.Errorf("boost %d rule %q: %w", i, b.Rule, err)
+		}
+		policy.boosts = append(policy.boosts, compiledBoost{rule: b.Rule, program: program, boost: b.Boost})
+	}
+	return policy, nil
+}
+
+// Priority 计算工件的优先级：产品类型的基础优先级加上所有命中的加权
+// 求值出错的规则视为未命中，并通过 errs 返回
+func (pp *PriorityPolicy) Priority(p *types.Product) (priority int, errs []error) {
+	priority = pp.base
+	if v, ok := pp.types[strings.ToLower(p.Type)]; ok {
+		priority = v
+	}
+	env := priorityEnv(p)
+	for _, b := range pp.boosts {
+		result, err := expr.Run(b.program, env)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rule %q: %w", b.rule, err))
+			continue
+		}
+		if hit, _ := result.(bool); hit {
+			priority += b.boost
+		}
+	}
+	return priority, errs
+}
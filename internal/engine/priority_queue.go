@@ -2,12 +2,16 @@ package engine
 
 import (
 	"industrial-4.0-demo/internal/types"
+	"time"
 )
 
 // Item 是优先级队列中的元素，包装了 Product
 type Item struct {
-	Product *types.Product // 实际的工件数据
-	index   int            // 元素在堆中的索引，用于 update 操作（虽然本项目未用到）
+	Product     *types.Product // 实际的工件数据
+	index       int            // 元素在堆中的索引，用于按 ID 取消任务时从堆中移除
+	seq         uint64         // 入队序号，优先级相同时先入队的先出队
+	submittedAt time.Time      // 提交 (或从 WAL 恢复) 的时间，用于统计提交到分派的延迟
+	rank        int            // 在派工计划中的顺序，从 1 开始；0 表示不在计划中
 }
 
 // PriorityQueue 实现了 heap.Interface 接口，是一个基于最小堆的优先级队列
@@ -16,9 +20,21 @@ type PriorityQueue []*Item
 func (pq PriorityQueue) Len() int { return len(pq) }
 
 // Less 定义了元素的排序规则
-// 注意：我们要实现最大堆（高优先级先出），所以这里使用 >
+// 注意：我们要实现最大堆（高优先级先出），所以这里使用 >；优先级相同时按入队顺序 (FIFO)
 func (pq PriorityQueue) Less(i, j int) bool {
-	return pq[i].Product.Priority > pq[j].Product.Priority
+	return before(pq[i], pq[j])
+}
+
+// before 判断 a 是否应先于 b 出队
+// 按计划派工时计划内的任务按计划顺序先出队，计划之后提交的任务再按优先级出队
+func before(a, b *Item) bool {
+	if a.rank != b.rank {
+		return b.rank == 0 || (a.rank != 0 && a.rank < b.rank)
+	}
+	if a.Product.Priority != b.Product.Priority {
+		return a.Product.Priority > b.Product.Priority
+	}
+	return a.seq < b.seq
 }
 
 // Swap 交换两个元素的位置
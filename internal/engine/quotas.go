@@ -0,0 +1,101 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"industrial-4.0-demo/internal/types"
+	"industrial-4.0-demo/internal/web"
+	"maps"
+	"slices"
+)
+
+// ErrInvalidQuota 是命名空间配额不合法时返回的错误
+var ErrInvalidQuota = errors.New("invalid namespace quota")
+
+// SetNamespaceQuotas 设置各命名空间可以同时占用的 worker 数上限，未配置的命名空间不限制，为空时取消所有配额
+// 达到配额的命名空间的任务留在队列中，调度器跳过它们派发其他命名空间的任务；已在执行的任务不受影响
+func (s *Scheduler) SetNamespaceQuotas(quotas map[string]int) error {
+	for ns, n := range quotas {
+		if !types.IsValidNamespace(ns) {
+			return fmt.Errorf("%w: invalid namespace %q", ErrInvalidQuota, ns)
+		}
+		if n < 1 {
+			return fmt.Errorf("%w: %s must be at least 1", ErrInvalidQuota, ns)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.quotas = maps.Clone(quotas)
+	// 取消的配额不再上报
+	s.metrics.NamespaceWorkerQuota.Reset()
+	for ns, n := range s.quotas {
+		s.metrics.NamespaceWorkerQuota.WithLabelValues(ns).Set(float64(n))
+	}
+	s.publishStateLocked()
+	s.cond.Broadcast()
+	s.logger.Info("已设置命名空间的 worker 配额", "quotas", s.quotas)
+	return nil
+}
+
+// NamespaceQuotas 返回当前的命名空间配额
+func (s *Scheduler) NamespaceQuotas() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return maps.Clone(s.quotas)
+}
+
+// atQuotaLocked 判断命名空间已出队的任务数是否达到配额，调用方必须持有 s.mu
+func (s *Scheduler) atQuotaLocked(ns string) bool {
+	quota, ok := s.quotas[ns]
+	return ok && s.active[ns] >= quota
+}
+
+// dispatchableLocked 判断队列中是否有可以出队的任务，调用方必须持有 s.mu
+func (s *Scheduler) dispatchableLocked() bool {
+	if len(s.quotas) == 0 {
+		return s.pq.Len() > 0
+	}
+	return slices.ContainsFunc(s.pq, func(item *Item) bool { return !s.atQuotaLocked(item.Product.Namespace) })
+}
+
+// nextLocked 取出下一个出队的任务：没有配额时取堆顶，否则按出队顺序取第一个所属命名空间未达到配额的任务
+// 调用方必须持有 s.mu，并已通过 dispatchableLocked 确认有可以出队的任务
+func (s *Scheduler) nextLocked() *Item {
+	if len(s.quotas) == 0 {
+		return s.popLocked()
+	}
+	for _, item := range s.orderedLocked() {
+		if !s.atQuotaLocked(item.Product.Namespace) {
+			s.removeLocked(item)
+			return item
+		}
+	}
+	return s.popLocked()
+}
+
+// acquireLocked 记录命名空间出队了一个任务，调用方必须持有 s.mu
+func (s *Scheduler) acquireLocked(ns string) {
+	s.active[ns]++
+	s.metrics.NamespaceActiveTasks.WithLabelValues(ns).Set(float64(s.active[ns]))
+}
+
+// releaseLocked 记录命名空间的一个任务执行结束或放回队列，调用方必须持有 s.mu
+func (s *Scheduler) releaseLocked(ns string) {
+	s.active[ns]--
+	s.metrics.NamespaceActiveTasks.WithLabelValues(ns).Set(float64(s.active[ns]))
+	if s.active[ns] <= 0 {
+		delete(s.active, ns)
+	}
+}
+
+// quotaStatesLocked 生成各命名空间的配额占用，按命名空间名称排序，调用方必须持有 s.mu
+func (s *Scheduler) quotaStatesLocked() []web.NamespaceQuota {
+	if len(s.quotas) == 0 {
+		return nil
+	}
+	states := make([]web.NamespaceQuota, 0, len(s.quotas))
+	for _, ns := range slices.Sorted(maps.Keys(s.quotas)) {
+		states = append(states, web.NamespaceQuota{Namespace: ns, Workers: s.quotas[ns], Active: s.active[ns]})
+	}
+	return states
+}
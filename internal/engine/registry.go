@@ -0,0 +1,506 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"industrial-4.0-demo/internal/calendar"
+	"industrial-4.0-demo/internal/chaos"
+	"industrial-4.0-demo/internal/event"
+	"industrial-4.0-demo/internal/fsm"
+	"industrial-4.0-demo/internal/station"
+	"industrial-4.0-demo/internal/types"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 管理工站时可能返回的错误
+var (
+	ErrStationNotFound = errors.New("station not found") // 工站未注册
+	ErrStationDisabled = errors.New("station disabled")  // 工站已被停用，不再接收新工件
+	ErrInvalidPoolSize = errors.New("invalid pool size") // 资源池容量不能为负数
+	ErrInjectedFailure = errors.New("injected failure")  // 注入的加工失败，用于演示和回归测试
+)
+
+// 工站的驱动类型
+const (
+	DriverLocal  = "local"  // 本地模拟工站
+	DriverRemote = "remote" // 通过 HTTP 调用的远程工站
+)
+
+// StationInfo 是工站注册信息与当前负载的快照
+type StationInfo struct {
+	ID       types.StationID  `json:"id"`
+	Driver   string           `json:"driver"`             // 驱动类型: local / remote
+	Endpoint string           `json:"endpoint,omitempty"` // 远程工站的地址
+	Status   string           `json:"status"`             // 工站状态机的当前状态
+	Enabled  bool             `json:"enabled"`
+	PoolSize int              `json:"pool_size"`         // 资源池容量，0 表示不限制并发
+	PoolUsed int              `json:"pool_used"`         // 已占用的资源凭证数
+	PoolWait int              `json:"pool_waiting"`      // 等待资源凭证的工件数
+	Active   int              `json:"active"`            // 正在加工的工件数
+	WIPLimit int              `json:"wip_limit"`         // 在制品上限，0 表示不限制
+	WIP      int              `json:"wip"`               // 占用看板的工件数 (等待资源、加工中和加工后等待下游的工件)
+	Blocked  int              `json:"wip_blocked"`       // 因在制品达到上限而等待进入工站的工件数
+	Offline  *calendar.Window `json:"offline,omitempty"` // 按日历离线时为当前的离线时间，期间不派发工件
+}
+
+// stationRuntime 记录工站的运行状态
+// 未配置资源池的工站可以同时加工多个工件，有工件在加工时工站为 BUSY，全部完成后回到 IDLE
+// 停用的工站在最后一个工件完成后进入 MAINTENANCE，启用后回到 IDLE
+// 资源池的容量可以在运行中调整，调小后已占用的凭证在释放前不会被收回；启用资源池时已在加工的工件计入已占用的凭证
+type stationRuntime struct {
+	station     station.Station
+	bus         *event.Bus
+	mu          sync.Mutex
+	poolFree    *sync.Cond // 资源凭证释放或资源池扩容时通知等待的工件，与 mu 绑定
+	poolSize    int        // 资源池容量，0 表示不限制并发
+	fsm         *fsm.StationFSM
+	active      int        // 正在加工的工件数
+	disabled    bool       // 是否已被停用
+	poolInUse   int        // 已占用的资源凭证数
+	poolWaiting int        // 等待资源凭证的工件数
+	poolBypass  int        // 未启用资源池时开始加工、没有占用凭证的工件数
+	poolSeq     uint64     // 资源池占用变化的序号
+	injected    int        // 接下来需要注入失败的加工次数
+	wipFree     *sync.Cond // 看板释放或在制品上限调整时通知被阻塞的工件，与 mu 绑定
+	wipLimit    int        // 在制品上限，0 表示不限制
+	wip         int        // 占用看板的工件数
+	wipBlocked  int        // 等待看板的工件数
+	wipSeq      uint64     // 在制品变化的序号
+}
+
+// acquire 记录工站开始加工一个工件，第一个工件开始加工时工站进入 BUSY
+// 工站已停用时返回 ErrStationDisabled
+func (rt *stationRuntime) acquire() error {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if rt.disabled {
+		return ErrStationDisabled
+	}
+	rt.active++
+	if rt.active == 1 && rt.fsm.Can(fsm.StationEventAcquire) {
+		rt.fsm.Fire(fsm.StationEventAcquire)
+	}
+	return nil
+}
+
+// takeInjected 消耗一次注入的失败，返回 true 时本次加工直接失败
+func (rt *stationRuntime) takeInjected() bool {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if rt.injected == 0 {
+		return false
+	}
+	rt.injected--
+	return true
+}
+
+// release 记录工站完成一个工件，最后一个工件完成时工站回到 IDLE，已停用的工站随后进入维护
+func (rt *stationRuntime) release() {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.active--
+	if rt.active == 0 && rt.fsm.Can(fsm.StationEventRelease) {
+		rt.fsm.Fire(fsm.StationEventRelease)
+	}
+	if rt.active == 0 && rt.disabled && rt.fsm.Can(fsm.StationEventStartService) {
+		rt.fsm.Fire(fsm.StationEventStartService)
+	}
+}
+
+// acquirePool 等待并占用一个资源凭证，返回是否占用了凭证；没有返回错误时调用方必须在加工结束后调用 releasePool
+// 未配置资源池 (或等待期间资源池被取消) 时不占用凭证直接返回，但仍记录为加工中，之后启用资源池时计入已占用的凭证
+// ctx 结束时停止等待并返回错误
+func (rt *stationRuntime) acquirePool(ctx context.Context, logger *slog.Logger) (bool, error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if rt.poolSize == 0 {
+		rt.poolBypass++
+		return false, nil
+	}
+	stop := context.AfterFunc(ctx, func() {
+		rt.mu.Lock()
+		defer rt.mu.Unlock()
+		rt.poolFree.Broadcast()
+	})
+	defer stop()
+	logger.Info("等待资源")
+	rt.poolWaiting++
+	rt.publishPoolLocked()
+	for rt.poolSize > 0 && rt.poolInUse >= rt.poolSize && ctx.Err() == nil {
+		rt.poolFree.Wait()
+	}
+	rt.poolWaiting--
+	if err := ctx.Err(); err != nil {
+		rt.publishPoolLocked()
+		rt.poolFree.Signal() // 可能错过了其他等待者应得的唤醒
+		return false, err
+	}
+	if rt.poolSize == 0 {
+		rt.poolBypass++
+		rt.publishPoolLocked()
+		return false, nil
+	}
+	rt.poolInUse++
+	rt.publishPoolLocked()
+	logger.Info("获得资源")
+	return true, nil
+}
+
+// releasePool 结束 acquirePool 记录的加工，held 为 acquirePool 的返回值
+// 没有占用凭证的工件在启用资源池时已经计入已占用的凭证，此时同样释放一个凭证
+func (rt *stationRuntime) releasePool(held bool, logger *slog.Logger) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if !held && rt.poolBypass > 0 {
+		rt.poolBypass--
+		return
+	}
+	rt.poolInUse--
+	rt.publishPoolLocked()
+	rt.poolFree.Signal()
+	logger.Info("释放资源")
+}
+
+// acquireWIP 等待并占用工站的一张看板，返回等待的时长
+// 返回 true 时调用方必须在工件离开工站 (进入下一个工站或结束生产) 时调用 releaseWIP；未设置在制品上限时也占用看板，用于统计在制品
+// 需要等待时先调用 onBlock，ctx 结束时停止等待并返回错误
+func (rt *stationRuntime) acquireWIP(ctx context.Context, onBlock func()) (time.Duration, error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if rt.wipLimit == 0 || rt.wip < rt.wipLimit {
+		rt.wip++
+		rt.publishWIPLocked()
+		return 0, nil
+	}
+	start := time.Now()
+	stop := context.AfterFunc(ctx, func() {
+		rt.mu.Lock()
+		defer rt.mu.Unlock()
+		rt.wipFree.Broadcast()
+	})
+	defer stop()
+	onBlock()
+	rt.wipBlocked++
+	rt.publishWIPLocked()
+	for rt.wipLimit > 0 && rt.wip >= rt.wipLimit && ctx.Err() == nil {
+		rt.wipFree.Wait()
+	}
+	rt.wipBlocked--
+	if err := ctx.Err(); err != nil {
+		rt.publishWIPLocked()
+		return time.Since(start), err
+	}
+	rt.wip++
+	rt.publishWIPLocked()
+	return time.Since(start), nil
+}
+
+// releaseWIP 释放 acquireWIP 占用的看板，通知一个被阻塞的工件
+func (rt *stationRuntime) releaseWIP() {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.wip--
+	rt.publishWIPLocked()
+	rt.wipFree.Signal()
+}
+
+// publishWIPLocked 发布工站的在制品情况，调用方必须持有 rt.mu
+func (rt *stationRuntime) publishWIPLocked() {
+	rt.wipSeq++
+	rt.bus.Publish(event.Event{
+		Type:      event.WIPChanged,
+		StationID: rt.station.GetID(),
+		Seq:       rt.wipSeq,
+		WIP:       &event.WIPUsage{Limit: rt.wipLimit, InUse: rt.wip, Blocked: rt.wipBlocked},
+	})
+}
+
+// publishPoolLocked 发布资源池的占用情况，调用方必须持有 rt.mu
+// 事件处理器是异步执行的，消费者根据序号丢弃乱序到达的旧状态
+func (rt *stationRuntime) publishPoolLocked() {
+	rt.poolSeq++
+	rt.bus.Publish(event.Event{
+		Type:      event.PoolChanged,
+		StationID: rt.station.GetID(),
+		Seq:       rt.poolSeq,
+		Pool:      &event.PoolUsage{Capacity: rt.poolSize, InUse: rt.poolInUse, Waiting: rt.poolWaiting},
+	})
+}
+
+// info 返回工站的快照
+func (rt *stationRuntime) info() StationInfo {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	info := StationInfo{
+		ID:       rt.station.GetID(),
+		Driver:   DriverLocal,
+		Status:   string(rt.fsm.State()),
+		Enabled:  !rt.disabled,
+		PoolSize: rt.poolSize,
+		PoolUsed: rt.poolInUse,
+		PoolWait: rt.poolWaiting,
+		Active:   rt.active,
+		WIPLimit: rt.wipLimit,
+		WIP:      rt.wip,
+		Blocked:  rt.wipBlocked,
+	}
+	if remote, ok := rt.station.(*station.RemoteStation); ok {
+		info.Driver = DriverRemote
+		info.Endpoint = remote.Endpoint
+	}
+	return info
+}
+
+// StationRegistry 是引擎与 API 共享的工站注册表，可以被并发访问
+type StationRegistry struct {
+	mu       sync.RWMutex
+	stations map[types.StationID]*stationRuntime
+	pools    map[types.StationID]int // 资源池配置，工站注册时按此创建资源池
+	wip      map[types.StationID]int // 在制品上限配置，工站注册时按此设置看板数
+	bus      *event.Bus
+
+	calendar        *calendar.Calendar // 班次和计划停机日历，为 nil 时所有工站全天在线
+	calendarChanged chan struct{}      // 日历被替换时关闭，唤醒等待工站恢复在线的工件
+
+	chaos *chaos.Injector // 注入的故障，为 nil 时不注入
+}
+
+// NewStationRegistry 创建一个工站注册表，pools 为各工站的资源池容量
+func NewStationRegistry(pools map[types.StationID]int, bus *event.Bus) *StationRegistry {
+	r := &StationRegistry{
+		stations: make(map[types.StationID]*stationRuntime),
+		pools:    make(map[types.StationID]int),
+		wip:      make(map[types.StationID]int),
+		bus:      bus,
+
+		calendarChanged: make(chan struct{}),
+	}
+	// Viper 加载配置时会将 key 转为小写，这里统一还原为大写的工站 ID
+	for id, size := range pools {
+		r.pools[types.StationID(strings.ToUpper(string(id)))] = size
+	}
+	return r
+}
+
+// Register 注册一个工站并发布工站 (以及资源池) 的初始状态，重复注册会替换原有的工站
+func (r *StationRegistry) Register(s station.Station) {
+	stationFSM := fsm.NewStationFSM(string(s.GetID()))
+	stationFSM.SetEventBus(r.bus)
+	rt := &stationRuntime{station: s, bus: r.bus, fsm: stationFSM}
+	rt.poolFree = sync.NewCond(&rt.mu)
+	rt.wipFree = sync.NewCond(&rt.mu)
+
+	r.mu.Lock()
+	rt.poolSize = max(r.pools[s.GetID()], 0)
+	rt.wipLimit = max(r.wip[s.GetID()], 0)
+	r.stations[s.GetID()] = rt
+	r.mu.Unlock()
+	r.bus.Publish(event.Event{Type: event.StationStatusChanged, StationID: s.GetID(), ToState: string(fsm.StationIdle)})
+	rt.mu.Lock()
+	if rt.poolSize > 0 {
+		rt.publishPoolLocked()
+	}
+	rt.publishWIPLocked()
+	rt.mu.Unlock()
+}
+
+// SetWIPLimits 设置各工站的在制品上限 (看板数)，未出现在 limits 中的工站不再限制，工站 ID 不区分大小写
+// 调大后被阻塞的工件立即放行；调小后超出上限的在制品在离开工站前不会被收回，期间上游的工件继续等待
+func (r *StationRegistry) SetWIPLimits(limits map[types.StationID]int) {
+	normalized := make(map[types.StationID]int, len(limits))
+	for id, limit := range limits {
+		normalized[types.StationID(strings.ToUpper(string(id)))] = max(limit, 0)
+	}
+	r.mu.Lock()
+	r.wip = normalized
+	stations := make([]*stationRuntime, 0, len(r.stations))
+	for _, rt := range r.stations {
+		stations = append(stations, rt)
+	}
+	r.mu.Unlock()
+
+	for _, rt := range stations {
+		rt.mu.Lock()
+		if limit := normalized[rt.station.GetID()]; limit != rt.wipLimit {
+			rt.wipLimit = limit
+			rt.publishWIPLocked()
+			rt.wipFree.Broadcast()
+		}
+		rt.mu.Unlock()
+	}
+}
+
+// get 返回工站的运行状态
+func (r *StationRegistry) get(id types.StationID) (*stationRuntime, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	rt, ok := r.stations[id]
+	return rt, ok
+}
+
+// Get 返回指定工站的快照
+func (r *StationRegistry) Get(id types.StationID) (StationInfo, bool) {
+	rt, ok := r.get(id)
+	if !ok {
+		return StationInfo{}, false
+	}
+	return r.info(rt), true
+}
+
+// info 返回工站的快照，并按日历标记工站是否离线
+func (r *StationRegistry) info(rt *stationRuntime) StationInfo {
+	info := rt.info()
+	r.mu.RLock()
+	cal := r.calendar
+	r.mu.RUnlock()
+	if w, offline := cal.Status(info.ID, time.Now()); offline {
+		info.Offline = &w
+	}
+	return info
+}
+
+// SetCalendar 替换班次和计划停机日历，为 nil 时所有工站全天在线
+// 等待工站恢复在线的工件按新的日历重新判断
+func (r *StationRegistry) SetCalendar(c *calendar.Calendar) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calendar = c
+	close(r.calendarChanged)
+	r.calendarChanged = make(chan struct{})
+}
+
+// waitOnline 工站按日历离线时等待其恢复在线，ctx 结束时返回取消的原因
+func (r *StationRegistry) waitOnline(ctx context.Context, id types.StationID, logger *slog.Logger) error {
+	for {
+		r.mu.RLock()
+		cal, changed := r.calendar, r.calendarChanged
+		r.mu.RUnlock()
+		w, offline := cal.Status(id, time.Now())
+		if !offline {
+			return nil
+		}
+		logger.Info("工站按日历离线，暂停派发", "reason", w.Reason, "name", w.Name, "until", w.To)
+		timer := time.NewTimer(time.Until(w.To))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return context.Cause(ctx)
+		case <-changed:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// List 返回所有工站的快照，按 ID 排序
+func (r *StationRegistry) List() []StationInfo {
+	r.mu.RLock()
+	runtimes := make([]*stationRuntime, 0, len(r.stations))
+	for _, rt := range r.stations {
+		runtimes = append(runtimes, rt)
+	}
+	r.mu.RUnlock()
+
+	infos := make([]StationInfo, 0, len(runtimes))
+	for _, rt := range runtimes {
+		infos = append(infos, r.info(rt))
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// Disable 停用工站：之后到达该工站的工件直接失败并触发补偿，正在加工的工件不受影响
+// 工站空闲后进入 MAINTENANCE 状态
+func (r *StationRegistry) Disable(id types.StationID) (StationInfo, error) {
+	rt, ok := r.get(id)
+	if !ok {
+		return StationInfo{}, ErrStationNotFound
+	}
+	rt.mu.Lock()
+	rt.disabled = true
+	if rt.active == 0 && rt.fsm.Can(fsm.StationEventStartService) {
+		rt.fsm.Fire(fsm.StationEventStartService)
+	}
+	rt.mu.Unlock()
+	return r.info(rt), nil
+}
+
+// Enable 重新启用工站，维护中的工站回到 IDLE
+func (r *StationRegistry) Enable(id types.StationID) (StationInfo, error) {
+	rt, ok := r.get(id)
+	if !ok {
+		return StationInfo{}, ErrStationNotFound
+	}
+	rt.mu.Lock()
+	rt.disabled = false
+	if rt.fsm.Can(fsm.StationEventEndService) {
+		rt.fsm.Fire(fsm.StationEventEndService)
+	}
+	rt.mu.Unlock()
+	return r.info(rt), nil
+}
+
+// SetChaos 设置故障注入器，之后的加工和补偿按生效中的故障注入失败、延迟和补偿丢弃
+func (r *StationRegistry) SetChaos(injector *chaos.Injector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.chaos = injector
+}
+
+// injector 返回故障注入器，未设置时返回 nil
+func (r *StationRegistry) injector() *chaos.Injector {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.chaos
+}
+
+// InjectFailures 让工站接下来的 count 次加工直接失败 (不调用工站)，与已注入但尚未消耗的次数累加
+func (r *StationRegistry) InjectFailures(id types.StationID, count int) error {
+	rt, ok := r.get(id)
+	if !ok {
+		return ErrStationNotFound
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.injected += max(count, 0)
+	return nil
+}
+
+// ResizePool 调整工站资源池的容量，size 为 0 时不再限制并发
+// 扩容后等待的工件立即获得凭证；缩容后超出容量的凭证在加工结束时才释放，期间新工件继续等待；
+// 从不限制到启用资源池时，已在加工的工件计入已占用的凭证，加工结束前新工件同样等待
+func (r *StationRegistry) ResizePool(id types.StationID, size int) (StationInfo, error) {
+	if size < 0 {
+		return StationInfo{}, ErrInvalidPoolSize
+	}
+	r.mu.Lock()
+	rt, ok := r.stations[id]
+	if ok {
+		if size > 0 {
+			r.pools[id] = size
+		} else {
+			delete(r.pools, id)
+		}
+	}
+	r.mu.Unlock()
+	if !ok {
+		return StationInfo{}, ErrStationNotFound
+	}
+
+	rt.mu.Lock()
+	if rt.poolSize != size {
+		if rt.poolSize == 0 {
+			rt.poolInUse += rt.poolBypass
+			rt.poolBypass = 0
+		}
+		rt.poolSize = size
+		rt.publishPoolLocked()
+		rt.poolFree.Broadcast()
+	}
+	rt.mu.Unlock()
+	return r.info(rt), nil
+}
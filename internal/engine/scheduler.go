@@ -3,13 +3,31 @@ package engine
 import (
 	"container/heap"
 	"context"
+	"errors"
+	"industrial-4.0-demo/internal/event"
+	"industrial-4.0-demo/internal/fsm"
 	"industrial-4.0-demo/internal/metrics"
 	"industrial-4.0-demo/internal/persistence"
+	"industrial-4.0-demo/internal/planner"
 	"industrial-4.0-demo/internal/types"
 	"industrial-4.0-demo/internal/util"
 	"industrial-4.0-demo/internal/web"
 	"log/slog"
+	"slices"
 	"sync"
+	"time"
+)
+
+// 取消任务时可能返回的错误
+var (
+	ErrTaskNotFound = errors.New("task not found")        // 任务不存在
+	ErrTaskFinished = errors.New("task already finished") // 任务已经结束，无法取消
+)
+
+// 调度器管理操作可能返回的错误
+var (
+	ErrInvalidWorkers = errors.New("max workers must be at least 1") // worker 数量不合法
+	ErrWALDisabled    = errors.New("wal is disabled")                // 未启用 WAL
 )
 
 // Scheduler 负责任务的调度和分发
@@ -17,31 +35,131 @@ import (
 type Scheduler struct {
 	pq           PriorityQueue     // 优先级队列，存储待处理的任务
 	engine       *WorkflowEngine   // 工作流引擎，用于执行任务
+	executor     Executor          // 执行出队的任务，默认为本进程的工作流引擎
 	mu           sync.Mutex        // 互斥锁，保护队列并发访问
-	cond         *sync.Cond        // 条件变量，用于通知 worker 有新任务
+	cond         *sync.Cond        // 条件变量，用于通知调度循环队列、worker 或暂停状态发生了变化
 	maxWorkers   int               // 最大并发 worker 数
 	wg           sync.WaitGroup    // 等待组，用于优雅停机
-	wal          *persistence.WAL  // 预写日志，用于持久化任务
+	wal          persistence.Log   // 预写日志，用于持久化任务
 	stateTracker *web.StateTracker // 状态追踪器，用于更新前端状态
+	metrics      *metrics.Metrics  // 队列长度和 worker 占用指标
+	policy       *PriorityPolicy   // 优先级策略，为 nil 时使用客户端提交的优先级
+	planning     planner.Options   // 生成派工计划使用的排产参数
+	plan         *planner.Plan     // 正在执行的派工计划，为 nil 时按优先级出队
+	planLeft     int               // 队列中尚未出队的计划内任务数
+	donePlan     *planner.Plan     // 最近一次执行完毕的派工计划，用于对比计划与实际
+	recorder     Recorder          // 录制提交和取消的任务，为 nil 时不录制
 	logger       *slog.Logger      // 结构化日志记录器
+
+	queued      map[string]*Item                   // 队列中的任务，用于按 ID 从堆中移除
+	running     map[string]context.CancelCauseFunc // 正在执行的任务及其取消函数
+	finished    map[string]time.Time               // 已经结束 (完成、失败或取消) 的任务及其结束时间，用于取消时区分已结束和不存在
+	ended       []finishedTask                     // 按结束时间排列的已结束任务，用于淘汰超过 finishedTTL 的记录
+	finishedTTL time.Duration                      // 已结束任务的保留时间，与实时状态的保留时间一致，0 表示永久保留
+	submitted   uint64                             // 已入队的任务数，用作同优先级任务的入队序号
+	workers     []web.WorkerState                  // 每个 worker 上正在执行的任务，缩容后编号超出上限的 worker 在任务结束后移除
+	dispatching string                             // 已出队、正在等待空闲 worker 的任务
+	stopping    bool                               // 系统停机中，不再出队
+	paused      bool                               // 管理员暂停了出队
+	standby     bool                               // 集群中的跟随者，成为领导者之前不出队
+	draining    bool                               // 管理员请求排空，等待执行中的任务结束
+	quotas      map[string]int                     // 各命名空间可以同时占用的 worker 数上限，未配置的命名空间不限制
+	active      map[string]int                     // 各命名空间已出队 (等待 worker 或执行中) 的任务数
 }
 
 // NewScheduler 创建一个新的 Scheduler 实例
-func NewScheduler(engine *WorkflowEngine, maxWorkers int, wal *persistence.WAL, st *web.StateTracker, logger *slog.Logger) *Scheduler {
+func NewScheduler(engine *WorkflowEngine, maxWorkers int, wal persistence.Log, st *web.StateTracker, m *metrics.Metrics, logger *slog.Logger) *Scheduler {
 	s := &Scheduler{
 		pq:           make(PriorityQueue, 0),
 		engine:       engine,
+		executor:     engine,
 		maxWorkers:   maxWorkers,
 		wal:          wal,
 		stateTracker: st,
+		metrics:      m,
 		logger:       logger.With("component", "scheduler"),
+		queued:       make(map[string]*Item),
+		running:      make(map[string]context.CancelCauseFunc),
+		finished:     make(map[string]time.Time),
+		active:       make(map[string]int),
+		workers:      make([]web.WorkerState, maxWorkers),
+	}
+	for i := range s.workers {
+		s.workers[i].Worker = i
+	}
+	if wal != nil {
+		engine.SetCheckpointer(s.checkpoint)
 	}
 	s.cond = sync.NewCond(&s.mu)
+	s.metrics.ObserveWorkers(0, maxWorkers, 0)
 	return s
 }
 
+// publishStateLocked 将调度器当前的队列和 worker 占用上报给状态追踪器，并更新 worker 利用率指标
+// 调用方必须持有 s.mu
+func (s *Scheduler) publishStateLocked() {
+	state := s.stateLocked()
+	waiting := len(state.Queue)
+	if state.Dispatching != "" {
+		waiting++
+	}
+	s.metrics.ObserveWorkers(state.BusyWorkers, state.Workers, waiting)
+	s.stateTracker.SetSchedulerState(state)
+}
+
+// State 返回调度器当前的队列、worker 占用和运行状态
+func (s *Scheduler) State() web.SchedulerState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stateLocked()
+}
+
+// stateLocked 生成调度器的状态快照，调用方必须持有 s.mu
+func (s *Scheduler) stateLocked() web.SchedulerState {
+	state := web.SchedulerState{
+		Status:      web.SchedulerRunning,
+		Dispatch:    web.DispatchPriority,
+		Workers:     s.maxWorkers,
+		Dispatching: s.dispatching,
+		Queue:       make([]web.QueueEntry, 0, len(s.pq)),
+		InFlight:    slices.Clone(s.workers),
+		Quotas:      s.quotaStatesLocked(),
+	}
+	switch {
+	case s.stopping || s.draining:
+		state.Status = web.SchedulerDraining
+	case s.standby:
+		state.Status = web.SchedulerStandby
+	case s.paused:
+		state.Status = web.SchedulerPaused
+	}
+	if s.plan != nil {
+		state.Dispatch = web.DispatchPlanned
+	}
+	for _, w := range s.workers {
+		if w.ProductID != "" {
+			state.BusyWorkers++
+		}
+	}
+	if s.maxWorkers > 0 {
+		state.Occupancy = float64(state.BusyWorkers) / float64(s.maxWorkers) * 100
+	}
+
+	for i, item := range s.orderedLocked() {
+		state.Queue = append(state.Queue, web.QueueEntry{
+			Position:  i + 1,
+			ProductID: item.Product.ID,
+			Type:      item.Product.Type,
+			Priority:  item.Product.Priority,
+			Namespace: item.Product.Namespace,
+			Planned:   item.rank > 0,
+		})
+	}
+	return state
+}
+
 // RecoverTasks 从 WAL 日志中恢复未完成的任务
-// 在系统启动时调用，确保任务不丢失
+// 在系统启动时调用，确保任务不丢失；已完成部分步骤的任务从最近的检查点之后继续
 func (s *Scheduler) RecoverTasks() error {
 	if s.wal == nil {
 		return nil
@@ -51,52 +169,158 @@ func (s *Scheduler) RecoverTasks() error {
 		return err
 	}
 	for _, p := range tasks {
-		s.logger.Info("重新加载未完成的工件", "product_id", p.ID)
-		s.submit(p) // 内部提交，不重复写 WAL
+		if p.Resume != nil {
+			s.logger.Info("重新加载未完成的工件", "product_id", p.ID, "completed_step", p.Resume.Step)
+		} else {
+			s.logger.Info("重新加载未完成的工件", "product_id", p.ID)
+		}
+		s.submit(p, time.Now()) // 内部提交，不重复写 WAL
 	}
 	return nil
 }
 
+// checkpoint 将工件完成的步骤写入 WAL，写入失败时工件重启后从上一个检查点继续，不影响本次生产
+func (s *Scheduler) checkpoint(p *types.Product, cp types.Checkpoint) {
+	if err := s.timeWAL("checkpoint", func() error { return s.wal.Checkpoint(p.ID, cp) }); err != nil {
+		s.logger.Error("写入检查点失败", "product_id", p.ID, "step", cp.Step, "error", err)
+	}
+}
+
+// SetPriorityPolicy 设置提交任务时使用的优先级策略，为 nil 时使用客户端提交的优先级
+// 只影响之后提交的任务，已在队列中的任务保持原有的优先级
+func (s *Scheduler) SetPriorityPolicy(policy *PriorityPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policy = policy
+}
+
+// Executor 执行出队的任务，返回任务是否已经执行结束
+// 返回 false 表示任务没有执行完 (例如停机时仍在共享队列中等待)，WAL 中不标记结束，重启后重新恢复
+type Executor interface {
+	Execute(ctx context.Context, p *types.Product) bool
+}
+
+// SetExecutor 设置执行任务的执行器，需要在 Start 之前调用；为 nil 时使用本进程的工作流引擎
+func (s *Scheduler) SetExecutor(e Executor) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e == nil {
+		e = s.engine
+	}
+	// 在其他进程中执行任务的执行器 (共享工作队列) 转交 worker 上报的检查点，同样写入 WAL
+	if c, ok := e.(checkpointer); ok && s.wal != nil {
+		c.SetCheckpointer(s.checkpoint)
+	}
+	s.executor = e
+}
+
+// checkpointer 是可以记录检查点的执行器
+type checkpointer interface {
+	SetCheckpointer(fn func(p *types.Product, cp types.Checkpoint))
+}
+
+// Recorder 录制提交和取消的任务，用于之后重放同一次生产
+type Recorder interface {
+	RecordSubmit(p types.Product)
+	RecordCancel(id string)
+}
+
+// SetFinishedTTL 设置已结束任务的保留时间，超过后不再记录，取消时返回 ErrTaskNotFound；ttl <= 0 时永久保留
+func (s *Scheduler) SetFinishedTTL(ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.finishedTTL = ttl
+	s.evictFinishedLocked(time.Now())
+}
+
+// SetRecorder 设置录制器，之后提交和取消的任务都会被录制；从 WAL 恢复的任务不录制
+func (s *Scheduler) SetRecorder(r Recorder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recorder = r
+}
+
 // SubmitTask 提交一个新任务到调度器
-// 先写入 WAL 持久化，再放入内存队列
+// 设置了优先级策略时先按策略计算优先级，再写入 WAL 持久化，最后放入内存队列
 func (s *Scheduler) SubmitTask(p *types.Product) {
+	start := time.Now()
+	s.mu.Lock()
+	recorder := s.recorder
+	s.mu.Unlock()
+	if recorder != nil {
+		// 录制客户端提交的原始任务，回放时按同样的优先级策略重新计算
+		recorder.RecordSubmit(*p)
+	}
+	s.applyPriorityPolicy(p)
 	if s.wal != nil {
-		if err := s.wal.Append(p); err != nil {
+		if err := s.timeWAL("append", func() error { return s.wal.Append(p) }); err != nil {
 			s.logger.Error("写入 WAL 失败", "error", err, "product_id", p.ID)
 			// 注意：生产环境中这里可能需要返回错误或重试
 		}
 	}
-	s.submit(p)
+	s.submit(p, start)
+	s.metrics.SubmitDuration.Observe(time.Since(start).Seconds())
 }
 
-// submit 将任务放入优先级队列并唤醒 worker
-func (s *Scheduler) submit(p *types.Product) {
+// applyPriorityPolicy 按优先级策略覆盖客户端提交的优先级
+func (s *Scheduler) applyPriorityPolicy(p *types.Product) {
+	s.mu.Lock()
+	policy := s.policy
+	s.mu.Unlock()
+	if policy == nil {
+		return
+	}
+	priority, errs := policy.Priority(p)
+	for _, err := range errs {
+		s.logger.Warn("优先级规则求值失败", "error", err, "product_id", p.ID)
+	}
+	if priority != p.Priority {
+		s.logger.Debug("按优先级策略调整优先级", "product_id", p.ID, "requested", p.Priority, "priority", priority)
+	}
+	p.Priority = priority
+}
+
+// submit 将任务放入优先级队列并唤醒 worker，submittedAt 是统计分派延迟的起点
+func (s *Scheduler) submit(p *types.Product, submittedAt time.Time) {
+	if p.Namespace == "" {
+		// 在引入命名空间之前写入 WAL 的任务恢复时同样归入默认命名空间
+		p.Namespace = types.DefaultNamespace
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.logger.Info("接收到工件", "product_id", p.ID, "type", p.Type, "priority", p.Priority)
-	heap.Push(&s.pq, &Item{Product: p})
-	metrics.TasksInQueue.Inc()
+	s.logger.Info("接收到工件", "product_id", p.ID, "type", p.Type, "priority", p.Priority, "namespace", p.Namespace)
+	s.submitted++
+	item := &Item{Product: p, seq: s.submitted, submittedAt: submittedAt}
+	s.pushLocked(item)
+	s.queued[p.ID] = item
+	s.metrics.TasksInQueue.WithLabelValues(p.Namespace).Inc()
 	s.stateTracker.AddProduct(p)
-	s.cond.Signal() // 唤醒一个等待的 worker
+	s.publishStateLocked()
+	s.engine.eventBus.Publish(event.Event{Type: event.ProductQueued, ProductID: p.ID, Product: p.Snapshot()})
+	s.cond.Broadcast() // 唤醒调度循环
 }
 
 // Start 启动调度循环
 // 启动 worker 池来并发处理任务
 func (s *Scheduler) Start(ctx context.Context) {
-	workerPool := make(chan struct{}, s.maxWorkers)
+	s.mu.Lock()
+	s.publishStateLocked()
+	s.mu.Unlock()
 
 	// 监听上下文取消信号，用于优雅停机
 	go func() {
 		<-ctx.Done()
 		s.mu.Lock()
-		s.cond.Broadcast() // 唤醒所有 worker 以便它们退出
+		s.stopping = true
+		s.publishStateLocked()
+		s.cond.Broadcast() // 唤醒调度循环以便退出
 		s.mu.Unlock()
 	}()
 
 	for {
 		s.mu.Lock()
-		// 如果队列为空，等待新任务
-		for s.pq.Len() == 0 {
+		// 如果队列为空或调度已暂停，等待新任务或恢复
+		for s.pq.Len() == 0 || s.paused || s.standby || !s.dispatchableLocked() {
 			if ctx.Err() != nil {
 				s.mu.Unlock()
 				return
@@ -110,31 +334,209 @@ func (s *Scheduler) Start(ctx context.Context) {
 			return
 		}
 
-		// 取出优先级最高的任务
-		item := heap.Pop(&s.pq).(*Item)
-		metrics.TasksInQueue.Dec()
-		s.mu.Unlock()
+		// 取出优先级最高、所属命名空间未达到配额的任务
+		item := s.nextLocked()
+		s.acquireLocked(item.Product.Namespace)
+		s.metrics.TasksInQueue.WithLabelValues(item.Product.Namespace).Dec()
+		delete(s.queued, item.Product.ID)
+
+		// 生成 Trace ID 并注入 Context，用于全链路追踪
+		// 任务 Context 在出队时即登记，保证取消请求不会落在出队与执行之间的空隙
+		traceID := util.NewTraceID()
+		taskCtx, cancel := context.WithCancelCause(util.ContextWithTraceID(ctx, traceID))
+		s.running[item.Product.ID] = cancel
+		s.dispatching = item.Product.ID
+		s.publishStateLocked()
 
-		// 获取 worker 凭证（控制并发数）
-		workerPool <- struct{}{}
+		// 等待空闲的 worker（控制并发数）
+		worker := s.idleWorkerLocked()
+		for worker < 0 && ctx.Err() == nil {
+			s.cond.Wait()
+			worker = s.idleWorkerLocked()
+		}
+		s.dispatching = ""
+		if worker < 0 {
+			// 停机时任务放回队列，它仍在 WAL 中，重启后会被恢复
+			delete(s.running, item.Product.ID)
+			s.releaseLocked(item.Product.Namespace)
+			cancel(nil)
+			s.pushLocked(item)
+			s.queued[item.Product.ID] = item
+			s.metrics.TasksInQueue.WithLabelValues(item.Product.Namespace).Inc()
+			s.publishStateLocked()
+			s.mu.Unlock()
+			return
+		}
 		s.wg.Add(1)
+		s.workers[worker] = web.WorkerState{Worker: worker, ProductID: item.Product.ID, StartedAt: time.Now(), Namespace: item.Product.Namespace}
+		s.publishStateLocked()
+		executor := s.executor
+		s.mu.Unlock()
+		latency := time.Since(item.submittedAt)
+		metrics.ObserveWithTrace(s.metrics.DispatchLatency.WithLabelValues(item.Product.Namespace), latency.Seconds(), traceID, item.Product.ID)
+		s.logger.Debug("工件已分派", "product_id", item.Product.ID, "trace_id", traceID, "worker", worker, "dispatch_latency", latency.Seconds())
+		s.engine.eventBus.Publish(event.Event{Type: event.ProductDispatched, ProductID: item.Product.ID, TraceID: traceID, Worker: worker})
 
 		// 启动 goroutine 执行任务
-		go func(p *types.Product) {
+		go func(p *types.Product, taskCtx context.Context, cancel context.CancelCauseFunc, worker int) {
 			defer s.wg.Done()
+			defer cancel(nil)
 
-			// 生成 Trace ID 并注入 Context，用于全链路追踪
-			traceID := util.NewTraceID()
-			taskCtx := util.ContextWithTraceID(ctx, traceID)
+			finished := executor.Execute(taskCtx, p)
 
-			s.engine.Process(taskCtx, p)
+			s.mu.Lock()
+			delete(s.running, p.ID)
+			s.finishLocked(p.ID, time.Now())
+			s.releaseLocked(p.Namespace)
+			s.workers[worker] = web.WorkerState{Worker: worker}
+			s.trimWorkersLocked()
+			s.publishStateLocked()
+			s.cond.Broadcast() // 释放 worker，唤醒调度循环和等待排空的调用方
+			s.mu.Unlock()
 
-			// 任务完成后标记 WAL
-			if s.wal != nil {
-				_ = s.wal.Complete(p.ID)
+			// 任务结束后标记 WAL
+			if s.wal != nil && finished {
+				if isCancelled(taskCtx) {
+					_ = s.timeWAL("cancel", func() error { return s.wal.Cancel(p.ID) })
+				} else {
+					_ = s.timeWAL("complete", func() error { return s.wal.Complete(p.ID) })
+				}
 			}
-			<-workerPool // 释放 worker 凭证
-		}(item.Product)
+		}(item.Product, taskCtx, cancel, worker)
+	}
+}
+
+// pushLocked 将任务放入优先级队列并记录堆操作耗时，调用方必须持有 s.mu
+func (s *Scheduler) pushLocked(item *Item) {
+	start := time.Now()
+	if item.rank > 0 {
+		// 停机时放回队列的计划内任务：计划已结束则按优先级出队
+		if s.plan == nil {
+			item.rank = 0
+		} else {
+			s.planLeft++
+		}
+	}
+	heap.Push(&s.pq, item)
+	s.metrics.QueueOperationDuration.WithLabelValues("push").Observe(time.Since(start).Seconds())
+}
+
+// popLocked 取出优先级最高的任务并记录堆操作耗时，调用方必须持有 s.mu
+func (s *Scheduler) popLocked() *Item {
+	start := time.Now()
+	item := heap.Pop(&s.pq).(*Item)
+	s.metrics.QueueOperationDuration.WithLabelValues("pop").Observe(time.Since(start).Seconds())
+	s.leavePlanLocked(item)
+	return item
+}
+
+// removeLocked 从优先级队列中移除任务并记录堆操作耗时，调用方必须持有 s.mu
+func (s *Scheduler) removeLocked(item *Item) {
+	start := time.Now()
+	heap.Remove(&s.pq, item.index)
+	s.metrics.QueueOperationDuration.WithLabelValues("remove").Observe(time.Since(start).Seconds())
+	s.leavePlanLocked(item)
+}
+
+// timeWAL 执行一次 WAL 写入并按操作记录耗时 (包括 fsync)
+func (s *Scheduler) timeWAL(op string, write func() error) error {
+	start := time.Now()
+	err := write()
+	s.metrics.WALOperationDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// idleWorkerLocked 返回编号最小的空闲 worker，没有空闲 worker 时返回 -1
+// 调用方必须持有 s.mu
+func (s *Scheduler) idleWorkerLocked() int {
+	for i := 0; i < s.maxWorkers && i < len(s.workers); i++ {
+		if s.workers[i].ProductID == "" {
+			return i
+		}
+	}
+	return -1
+}
+
+// trimWorkersLocked 移除缩容后超出上限且已空闲的 worker
+// 调用方必须持有 s.mu
+func (s *Scheduler) trimWorkersLocked() {
+	n := len(s.workers)
+	for n > s.maxWorkers && s.workers[n-1].ProductID == "" {
+		n--
+	}
+	s.workers = s.workers[:n]
+}
+
+// Cancel 取消一个任务
+// 队列中的任务直接移出队列；正在执行的任务取消其 Context，由引擎在当前步骤结束后停止
+func (s *Scheduler) Cancel(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if item, ok := s.queued[id]; ok {
+		s.removeLocked(item)
+		delete(s.queued, id)
+		s.finishLocked(id, time.Now())
+		s.metrics.TasksInQueue.WithLabelValues(item.Product.Namespace).Dec()
+		if s.wal != nil {
+			if err := s.timeWAL("cancel", func() error { return s.wal.Cancel(id) }); err != nil {
+				s.logger.Error("写入 WAL 失败", "error", err, "product_id", id)
+			}
+		}
+		s.stateTracker.UpdateProductState(id, "", string(fsm.StateCancelled))
+		s.publishStateLocked()
+		s.engine.eventBus.Publish(event.Event{Type: event.ProductCancelled, ProductID: id, Product: item.Product.Snapshot()})
+		s.logger.Info("已从队列中取消工件", "product_id", id)
+		s.recordCancelLocked(id)
+		return nil
+	}
+
+	if cancel, ok := s.running[id]; ok {
+		cancel(ErrTaskCancelled)
+		s.recordCancelLocked(id)
+		s.logger.Info("已请求取消执行中的工件", "product_id", id)
+		return nil
+	}
+
+	s.evictFinishedLocked(time.Now())
+	if _, ok := s.finished[id]; ok {
+		return ErrTaskFinished
+	}
+	return ErrTaskNotFound
+}
+
+// finishedTask 是一个已结束的任务
+type finishedTask struct {
+	id string
+	at time.Time
+}
+
+// finishLocked 记录任务结束，并淘汰超过保留时间的已结束任务，调用方必须持有 s.mu
+func (s *Scheduler) finishLocked(id string, now time.Time) {
+	s.finished[id] = now
+	s.ended = append(s.ended, finishedTask{id: id, at: now})
+	s.evictFinishedLocked(now)
+}
+
+// evictFinishedLocked 移除结束超过 finishedTTL 的任务，之后取消它们返回 ErrTaskNotFound，调用方必须持有 s.mu
+func (s *Scheduler) evictFinishedLocked(now time.Time) {
+	if s.finishedTTL <= 0 {
+		return
+	}
+	n := 0
+	for ; n < len(s.ended) && now.Sub(s.ended[n].at) >= s.finishedTTL; n++ {
+		// 同一个 ID 重新提交后再次结束时只保留最新的记录
+		if task := s.ended[n]; s.finished[task.id].Equal(task.at) {
+			delete(s.finished, task.id)
+		}
+	}
+	s.ended = s.ended[n:]
+}
+
+// recordCancelLocked 录制取消的任务，调用方必须持有 s.mu
+func (s *Scheduler) recordCancelLocked(id string) {
+	if s.recorder != nil {
+		s.recorder.RecordCancel(id)
 	}
 }
 
@@ -143,3 +545,108 @@ func (s *Scheduler) Start(ctx context.Context) {
 func (s *Scheduler) WaitForCompletion() {
 	s.wg.Wait()
 }
+
+// Engine 返回调度器使用的工作流引擎
+func (s *Scheduler) Engine() *WorkflowEngine {
+	return s.engine
+}
+
+// Pause 暂停出队，队列中的任务保持等待，正在执行的任务不受影响
+func (s *Scheduler) Pause() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = true
+	s.publishStateLocked()
+	s.logger.Info("调度器已暂停")
+}
+
+// SetStandby 设置调度器是否处于待命状态：集群中的跟随者待命，成为领导者后开始出队
+// 待命与管理员的暂停相互独立，Resume 不会结束待命
+func (s *Scheduler) SetStandby(standby bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.standby = standby
+	s.publishStateLocked()
+	s.cond.Broadcast()
+}
+
+// Resume 恢复出队，同时结束未完成的排空
+func (s *Scheduler) Resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = false
+	s.draining = false
+	s.publishStateLocked()
+	s.cond.Broadcast()
+	s.logger.Info("调度器已恢复")
+}
+
+// Drain 暂停出队并等待正在执行的任务全部结束，之后调度器保持暂停，直到调用 Resume
+// ctx 结束时停止等待并返回 ctx 的错误，调度器仍处于排空状态
+func (s *Scheduler) Drain(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = true
+	s.draining = true
+	s.publishStateLocked()
+	s.logger.Info("调度器开始排空", "running", len(s.running))
+
+	// ctx 结束时唤醒等待，条件变量本身无法感知 ctx
+	stop := context.AfterFunc(ctx, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.cond.Broadcast()
+	})
+	defer stop()
+
+	for len(s.running) > 0 && s.draining {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		s.cond.Wait()
+	}
+	if s.draining {
+		s.draining = false
+		s.publishStateLocked()
+		s.logger.Info("调度器排空完成")
+	}
+	return nil
+}
+
+// SetMaxWorkers 调整 worker 池大小，扩容立即生效；缩容时正在执行任务的 worker 在任务结束后移除
+func (s *Scheduler) SetMaxWorkers(n int) error {
+	if n < 1 {
+		return ErrInvalidWorkers
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.workers); i < n; i++ {
+		s.workers = append(s.workers, web.WorkerState{Worker: i})
+	}
+	s.maxWorkers = n
+	s.trimWorkersLocked()
+	s.publishStateLocked()
+	s.cond.Broadcast()
+	s.logger.Info("已调整 worker 数量", "max_workers", n)
+	return nil
+}
+
+// FlushWAL 将 WAL 刷新到磁盘
+func (s *Scheduler) FlushWAL() error {
+	if s.wal == nil {
+		return ErrWALDisabled
+	}
+	return s.wal.Flush()
+}
+
+// CompactWAL 压缩 WAL，只保留尚未结束的任务
+func (s *Scheduler) CompactWAL() (persistence.CompactResult, error) {
+	if s.wal == nil {
+		return persistence.CompactResult{}, ErrWALDisabled
+	}
+	result, err := s.wal.Compact()
+	if err == nil {
+		s.logger.Info("WAL 压缩完成", "pending", result.Pending, "bytes_before", result.BytesBefore, "bytes_after", result.BytesAfter)
+	}
+	return result, err
+}
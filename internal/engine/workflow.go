@@ -2,14 +2,19 @@ package engine
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/antonmedv/expr"
+	"industrial-4.0-demo/internal/costing"
+	"industrial-4.0-demo/internal/defect"
 	"industrial-4.0-demo/internal/event"
 	"industrial-4.0-demo/internal/fsm"
+	"industrial-4.0-demo/internal/serial"
 	"industrial-4.0-demo/internal/station"
 	"industrial-4.0-demo/internal/types"
 	"industrial-4.0-demo/internal/util"
 	"log/slog"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -18,40 +23,97 @@ import (
 // WorkflowEngine 负责编排和执行生产流程
 // 它管理工站、工作流定义、资源池，并协调工件在各个工站间的流转
 type WorkflowEngine struct {
-	stations      map[types.StationID]station.Station // 已注册的工站映射
-	workflows     map[string][]types.WorkflowStep     // 工作流定义，Key 为产品类型
-	resourcePools map[types.StationID]chan struct{}   // 资源池，用于限制特定工站的并发数
-	logger        *slog.Logger                        // 结构化日志记录器
-	eventBus      *event.Bus                          // 事件总线，用于发布业务事件
-	stepDelay     time.Duration                       // 步骤之间的移动延时
+	stations   *StationRegistry                            // 已注册的工站及其运行状态、资源池
+	workflows  *WorkflowStore                              // 版本化的工作流定义，Key 为产品类型
+	lifecycles map[string]fsm.Variant                      // 生命周期变体，Key 为产品类型 (小写)
+	logger     *slog.Logger                                // 结构化日志记录器
+	eventBus   *event.Bus                                  // 事件总线，用于发布业务事件
+	stepDelay  time.Duration                               // 步骤之间的移动延时
+	operators  *OperatorPool                               // 操作员池，为 nil 时工站不需要操作员
+	serials    *serial.Generator                           // 序列号生成器，为 nil 时不分配序列号
+	costing    *costing.Model                              // 成本模型，为 nil 时不计算加工成本
+	checkpoint func(p *types.Product, cp types.Checkpoint) // 记录工件完成的步骤，为 nil 时不记录
 }
 
 // NewWorkflowEngine 创建一个新的 WorkflowEngine 实例
 func NewWorkflowEngine(
 	workflows map[string][]types.WorkflowStep,
 	pools map[types.StationID]int,
+	lifecycles map[string]fsm.Variant,
 	logger *slog.Logger,
 	bus *event.Bus,
 	stepDelayMs int,
 ) *WorkflowEngine {
 	engine := &WorkflowEngine{
-		stations:      make(map[types.StationID]station.Station),
-		workflows:     workflows,
-		resourcePools: make(map[types.StationID]chan struct{}),
-		logger:        logger,
-		eventBus:      bus,
-		stepDelay:     time.Duration(stepDelayMs) * time.Millisecond,
+		stations:   NewStationRegistry(pools, bus),
+		workflows:  NewWorkflowStore(workflows),
+		lifecycles: make(map[string]fsm.Variant),
+		logger:     logger,
+		eventBus:   bus,
+		stepDelay:  time.Duration(stepDelayMs) * time.Millisecond,
 	}
-	// 初始化资源池
-	for id, size := range pools {
-		engine.resourcePools[id] = make(chan struct{}, size)
+	// 统一使用小写 key，与 Viper 加载后的工作流 key 保持一致
+	for productType, variant := range lifecycles {
+		engine.lifecycles[strings.ToLower(productType)] = variant
 	}
 	return engine
 }
 
-// RegisterStation 注册一个工站到引擎中
+// ErrTaskCancelled 是操作员取消任务时附加到任务 Context 上的取消原因
+// 用于区分主动取消与系统停机等其他原因导致的 Context 取消
+var ErrTaskCancelled = errors.New("task cancelled by operator")
+
+// isCancelled 判断任务是否已被操作员取消
+func isCancelled(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrTaskCancelled)
+}
+
+// inspectionStations 定义了属于质检环节的工站
+// 执行这些工站时，支持质检的生命周期会进入 QUALITY_CHECK 状态
+var inspectionStations = map[types.StationID]bool{
+	types.StationAOI:   true,
+	types.StationETest: true,
+}
+
+// RegisterStation 注册一个工站到引擎中，并发布工站的初始状态
 func (e *WorkflowEngine) RegisterStation(s station.Station) {
-	e.stations[s.GetID()] = s
+	e.stations.Register(s)
+}
+
+// Stations 返回引擎使用的工站注册表
+func (e *WorkflowEngine) Stations() *StationRegistry {
+	return e.stations
+}
+
+// SetOperators 设置操作员池，需要在开始处理工件之前调用
+func (e *WorkflowEngine) SetOperators(p *OperatorPool) {
+	e.operators = p
+}
+
+// Operators 返回引擎使用的操作员池，未设置时返回 nil
+func (e *WorkflowEngine) Operators() *OperatorPool {
+	return e.operators
+}
+
+// SetSerials 设置开始生产时分配序列号的生成器，需要在开始处理工件之前调用
+func (e *WorkflowEngine) SetSerials(g *serial.Generator) {
+	e.serials = g
+}
+
+// SetCosting 设置计算加工成本的模型，需要在开始处理工件之前调用
+func (e *WorkflowEngine) SetCosting(m *costing.Model) {
+	e.costing = m
+}
+
+// SetCheckpointer 设置每完成一个步骤时调用的检查点记录函数，调度器启用 WAL 时设置为写入 WAL
+func (e *WorkflowEngine) SetCheckpointer(fn func(p *types.Product, cp types.Checkpoint)) {
+	e.checkpoint = fn
+}
+
+// Execute 在本进程中执行工件的生产流程，实现 Executor，总是执行到结束
+func (e *WorkflowEngine) Execute(ctx context.Context, p *types.Product) bool {
+	e.Process(ctx, p)
+	return true
 }
 
 // Process 执行工件的生产流程
@@ -59,28 +121,78 @@ func (e *WorkflowEngine) RegisterStation(s station.Station) {
 func (e *WorkflowEngine) Process(ctx context.Context, p *types.Product) {
 	// 创建带有上下文信息的 Logger
 	logger := e.logger.With("product_id", p.ID, "product_type", p.Type)
-	if traceID, ok := util.TraceIDFromContext(ctx); ok {
+	traceID, hasTrace := util.TraceIDFromContext(ctx)
+	if hasTrace {
 		logger = logger.With("trace_id", traceID)
 	}
 
-	// 初始化工件的 FSM 状态机
-	productFSM := fsm.NewFSM(p.ID)
+	// 根据产品类型解析生命周期变体，并初始化工件的 FSM 状态机
+	productFSM := fsm.NewFSMWithVariant(p.ID, e.lifecycleFor(p.Type))
+	productFSM.SetEventBus(e.eventBus)
 	p.FSM = productFSM
 
+	// 补偿阶段计时：进入 COMPENSATING 时开始计时，离开时记录耗时
+	var compensateStart time.Time
+	productFSM.OnEnter(fsm.StateCompensating, func(_ string, _ fsm.Event) {
+		compensateStart = time.Now()
+	})
+	productFSM.OnExit(fsm.StateCompensating, func(_ string, ev fsm.Event) {
+		logger.Info("补偿阶段结束", "trigger", ev, "duration", time.Since(compensateStart).Seconds())
+	})
+
+	// 开始生产时分配序列号，从 WAL 恢复的工件沿用已分配的序列号
+	if p.Serial == "" && p.Resume != nil {
+		p.Serial = p.Resume.Serial
+	}
+	if p.Serial == "" {
+		p.Serial = e.serials.Next(p, time.Now())
+	}
+	if p.Serial != "" {
+		logger = logger.With("serial", p.Serial)
+	}
+
 	// 发布工件开始生产事件
-	e.eventBus.Publish(event.Event{Type: event.ProductStarted, ProductID: p.ID, Product: p})
+	e.eventBus.Publish(event.Event{Type: event.ProductStarted, ProductID: p.ID, Product: p.Snapshot(), TraceID: traceID})
+	e.fire(productFSM, p, fsm.EventStart, logger)
 	logger.Info("开始生产工件", "attributes", p.Attrs)
 
-	// 获取对应产品类型的工作流
-	// 注意：Viper 将配置文件的 key 转换为小写，所以查找时需要转换为小写
-	sequence, ok := e.workflows[strings.ToLower(p.Type)]
-	if !ok {
-		logger.Warn("未找到指定的工作流，将使用默认流程", "requested_type", p.Type)
-		sequence = e.workflows["pcb_double_layer"] // 使用小写 key
+	// 获取对应产品类型的工作流的当前版本，之后对工作流的修改不影响本工件
+	workflow, fellBack, err := e.workflows.Resolve(p.Type)
+	if err != nil {
+		// 严格模式下提交时已经拒绝了未知的产品类型，这里只会遇到提交后被删除的工作流或从 WAL 恢复的任务
+		logger.Error("没有可用的工作流", "error", err)
+		e.fire(productFSM, p, fsm.EventFail, logger)
+		e.eventBus.Publish(event.Event{Type: event.ProductFailed, ProductID: p.ID, Product: p.Snapshot(), Error: err, TraceID: traceID})
+		return
 	}
+	if fellBack {
+		logger.Warn("未找到指定的工作流，将使用默认流程", "requested_type", p.Type, "default_workflow", workflow.Name)
+	}
+	// 从 WAL 恢复的工件从最近完成的步骤之后继续，已执行的工站在之后失败时仍然补偿
+	start, executedStations := 0, []station.Station{}
+	if p.Resume != nil {
+		workflow, start, executedStations = e.resume(workflow, p, logger)
+	}
+	sequence := workflow.Steps
+	logger.Info("使用工作流", "workflow", workflow.Name, "workflow_version", workflow.Version)
+
+	// 工件在离开工站 (进入下一个工站或结束生产) 前一直占用该工站的看板
+	var held []*stationRuntime
+	defer func() {
+		for _, rt := range held {
+			rt.releaseWIP()
+		}
+	}()
 
-	executedStations := []station.Station{}
 	for i, step := range sequence {
+		if i < start {
+			continue
+		}
+		// 每个步骤开始前检查任务是否已被取消
+		if isCancelled(ctx) {
+			e.cancel(productFSM, p, traceID, logger)
+			return
+		}
 		p.Step = i
 		// 规则引擎评估：判断是否需要跳过当前步骤
 		if shouldSkip, err := e.evaluateRule(step.Rule, p); err != nil {
@@ -91,28 +203,200 @@ func (e *WorkflowEngine) Process(ctx context.Context, p *types.Product) {
 			continue
 		}
 
+		// 拉动式流转：下一个工站的在制品达到上限时工件停留在当前工站，直到下游释放看板
+		var err error
+		if held, err = e.pull(ctx, step, held, p, traceID, logger); err != nil {
+			e.cancel(productFSM, p, traceID, logger)
+			return
+		}
+
 		// 在执行步骤前，增加一个“移动”延时
 		if i > 0 { // 第一个步骤不需要移动
 			time.Sleep(e.stepDelay)
 		}
 
+		// 质检步骤：支持质检的生命周期进入 QUALITY_CHECK 状态
+		inspecting := isInspectionStep(step) && productFSM.Can(fsm.EventEnterQC)
+		if inspecting {
+			e.fire(productFSM, p, fsm.EventEnterQC, logger)
+		}
+
 		// 执行当前步骤（可能包含并行工站）
-		stepResults, stepStations := e.executeStep(ctx, step, p, logger)
+		stepResults, stepStations := e.executeStep(ctx, step, workflow.Version, p, logger)
 
 		// 检查步骤执行结果，如果有失败则触发 Saga 回滚
-		if failed, err := e.checkStepFailure(stepResults); failed {
-			e.eventBus.Publish(event.Event{Type: event.ProductFailed, ProductID: p.ID, Product: p, Error: err})
+		if failed := firstFailure(stepResults); failed >= 0 {
+			// 取消导致的工站中断不视为生产失败
+			if isCancelled(ctx) {
+				e.cancel(productFSM, p, traceID, logger)
+				return
+			}
+			e.fire(productFSM, p, fsm.EventFail, logger)
+			res := stepResults[failed]
+			e.eventBus.Publish(event.Event{
+				Type:      event.ProductFailed,
+				ProductID: p.ID,
+				Product:   p.Snapshot(),
+				StationID: step.StationIDs[failed],
+				Step:      i,
+				Error:     res.Error,
+				Defect:    res.Defect,
+				TraceID:   traceID,
+			})
 			e.rollback(ctx, executedStations, p, logger)
 			return
 		}
 		executedStations = append(executedStations, stepStations...)
+
+		if inspecting {
+			e.fire(productFSM, p, fsm.EventPassQC, logger)
+		}
+		// 多层板生命周期在层压完成后执行层压检测
+		if containsStation(step, types.StationLami) && productFSM.Can(fsm.EventEnterLamiInspection) {
+			e.fire(productFSM, p, fsm.EventEnterLamiInspection, logger)
+			e.fire(productFSM, p, fsm.EventPassLamiInspection, logger)
+		}
+		e.recordCheckpoint(p, i, workflow, executedStations)
 	}
 
 	// 流程成功完成
-	e.eventBus.Publish(event.Event{Type: event.ProductCompleted, ProductID: p.ID, Product: p})
+	e.fire(productFSM, p, fsm.EventFinish, logger)
+	e.eventBus.Publish(event.Event{Type: event.ProductCompleted, ProductID: p.ID, Product: p.Snapshot(), TraceID: traceID})
 	logger.Info("工件顺利下线")
 }
 
+// resume 返回恢复的工件继续使用的工作流、开始的步骤和已执行的工站
+// 检查点记录的工作流版本不存在 (例如重启前在运行时修改过工作流) 或已执行的工站没有注册时从第一个步骤重新开始
+func (e *WorkflowEngine) resume(current WorkflowDefinition, p *types.Product, logger *slog.Logger) (WorkflowDefinition, int, []station.Station) {
+	cp := p.Resume
+	p.Resume = nil
+	workflow, ok := e.workflows.Version(cp.Workflow, cp.Version)
+	if !ok || cp.Step >= len(workflow.Steps) {
+		logger.Warn("检查点的工作流版本不存在，从第一个步骤重新开始", "workflow", cp.Workflow, "workflow_version", cp.Version, "step", cp.Step)
+		return current, 0, []station.Station{}
+	}
+	executed := make([]station.Station, 0, len(cp.Stations))
+	for _, id := range cp.Stations {
+		rt, ok := e.stations.get(id)
+		if !ok {
+			logger.Warn("检查点中的工站未注册，从第一个步骤重新开始", "station_id", id, "step", cp.Step)
+			return current, 0, []station.Station{}
+		}
+		executed = append(executed, rt.station)
+	}
+	p.History = slices.Clone(cp.History)
+	logger.Info("从检查点继续生产", "step", cp.Step+1, "workflow", workflow.Name, "workflow_version", workflow.Version)
+	return workflow, cp.Step + 1, executed
+}
+
+// recordCheckpoint 记录工件完成的步骤和已执行的工站
+func (e *WorkflowEngine) recordCheckpoint(p *types.Product, step int, workflow WorkflowDefinition, executed []station.Station) {
+	if e.checkpoint == nil {
+		return
+	}
+	ids := make([]types.StationID, len(executed))
+	for i, s := range executed {
+		ids[i] = s.GetID()
+	}
+	e.checkpoint(p, types.Checkpoint{
+		Step:     step,
+		Workflow: workflow.Name,
+		Version:  workflow.Version,
+		Stations: ids,
+		History:  slices.Clone(p.History),
+		Serial:   p.Serial,
+	})
+}
+
+// pull 为步骤的工站占用看板，成功后释放工件当前占用的其余看板并返回新占用的看板
+// 工站按 ID 顺序申请，避免并行步骤之间互相等待；工件已占用的工站直接沿用原来的看板
+// ctx 结束时释放本次已占用的看板，返回原来的看板和错误
+func (e *WorkflowEngine) pull(ctx context.Context, step types.WorkflowStep, held []*stationRuntime, p *types.Product, traceID string, logger *slog.Logger) ([]*stationRuntime, error) {
+	ids := slices.Clone(step.StationIDs)
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+
+	kept := make(map[*stationRuntime]bool, len(held))
+	next := make([]*stationRuntime, 0, len(ids))
+	for _, id := range ids {
+		rt, ok := e.stations.get(id)
+		if !ok {
+			continue // 工站不存在时由 executeStep 报告失败
+		}
+		if slices.Contains(held, rt) {
+			kept[rt] = true
+			next = append(next, rt)
+			continue
+		}
+		blocked, err := rt.acquireWIP(ctx, func() {
+			logger.Info("下游工站在制品已满，等待看板", "station_id", id)
+			e.eventBus.Publish(event.Event{Type: event.StepBlocked, ProductID: p.ID, StationID: id, Step: p.Step, TraceID: traceID})
+		})
+		if blocked > 0 {
+			e.eventBus.Publish(event.Event{Type: event.StepUnblocked, ProductID: p.ID, StationID: id, Step: p.Step, TraceID: traceID, Blocked: blocked, Error: err})
+		}
+		if err != nil {
+			for _, rt := range next {
+				if !kept[rt] {
+					rt.releaseWIP()
+				}
+			}
+			return held, err
+		}
+		next = append(next, rt)
+	}
+	for _, rt := range held {
+		if !kept[rt] {
+			rt.releaseWIP()
+		}
+	}
+	return next, nil
+}
+
+// cancel 结束被取消的工件：已执行的工站不做补偿，工件保持在取消时的物理状态等待人工处置
+func (e *WorkflowEngine) cancel(f *fsm.ProductFSM, p *types.Product, traceID string, logger *slog.Logger) {
+	e.fire(f, p, fsm.EventCancel, logger)
+	e.eventBus.Publish(event.Event{Type: event.ProductCancelled, ProductID: p.ID, Product: p.Snapshot(), TraceID: traceID})
+	logger.Warn("工件已被取消", "step", p.Step)
+}
+
+// lifecycleFor 返回产品类型对应的生命周期变体，未配置时使用标准流程
+func (e *WorkflowEngine) lifecycleFor(productType string) fsm.Variant {
+	if variant, ok := e.lifecycles[strings.ToLower(productType)]; ok {
+		return variant
+	}
+	return fsm.VariantStandard
+}
+
+// fire 触发工件 FSM 的状态转移，并将最新状态同步到工件上
+func (e *WorkflowEngine) fire(f *fsm.ProductFSM, p *types.Product, ev fsm.Event, logger *slog.Logger) {
+	if err := f.Fire(ev); err != nil {
+		logger.Warn("状态转移失败", "error", err)
+		return
+	}
+	p.Status = string(f.State())
+}
+
+// isInspectionStep 判断步骤是否包含质检工站
+func isInspectionStep(step types.WorkflowStep) bool {
+	for _, id := range step.StationIDs {
+		if inspectionStations[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// containsStation 判断步骤是否包含指定工站
+func containsStation(step types.WorkflowStep, id types.StationID) bool {
+	for _, sID := range step.StationIDs {
+		if sID == id {
+			return true
+		}
+	}
+	return false
+}
+
 // evaluateRule 使用 expr 引擎评估规则表达式
 func (e *WorkflowEngine) evaluateRule(rule string, p *types.Product) (bool, error) {
 	if rule == "" {
@@ -135,63 +419,170 @@ func (e *WorkflowEngine) evaluateRule(rule string, p *types.Product) (bool, erro
 }
 
 // executeStep 执行单个工作流步骤，支持并行执行多个工站
-func (e *WorkflowEngine) executeStep(ctx context.Context, step types.WorkflowStep, p *types.Product, logger *slog.Logger) ([]types.Result, []station.Station) {
+// version 是工件使用的工作流版本，随步骤完成事件发布，用于按版本统计步骤耗时
+func (e *WorkflowEngine) executeStep(ctx context.Context, step types.WorkflowStep, version int, p *types.Product, logger *slog.Logger) ([]types.Result, []station.Station) {
 	var wg sync.WaitGroup
+	stepIndex := p.Step
+	traceID, _ := util.TraceIDFromContext(ctx)
 	results := make([]types.Result, len(step.StationIDs))
 	stations := make([]station.Station, len(step.StationIDs))
 
 	for i, sID := range step.StationIDs {
-		st, exists := e.stations[sID]
+		rt, exists := e.stations.get(sID)
 		if !exists {
 			results[i] = types.Result{ProductID: p.ID, Success: false, Error: fmt.Errorf("station %s not found", sID)}
 			continue
 		}
-		stations[i] = st
+		stations[i] = rt.station
 		wg.Add(1)
-		go func(index int, s station.Station) {
+		go func(index int, rt *stationRuntime) {
 			defer wg.Done()
+			s := rt.station
 			stationLogger := logger.With("station_id", s.GetID())
 
+			e.eventBus.Publish(event.Event{Type: event.StepQueued, ProductID: p.ID, StationID: s.GetID(), Step: stepIndex, TraceID: traceID})
+
+			// 工站按日历离线时等待恢复在线，期间不占用资源凭证
+			if err := e.stations.waitOnline(ctx, s.GetID(), stationLogger); err != nil {
+				results[index] = types.Result{ProductID: p.ID, Success: false, Error: fmt.Errorf("station %s: %w", s.GetID(), err)}
+				return
+			}
+
 			// 资源申请逻辑
-			pool, hasPool := e.resourcePools[s.GetID()]
-			if hasPool {
-				stationLogger.Info("等待资源")
-				pool <- struct{}{} // 获取资源凭证
-				stationLogger.Info("获得资源")
-				defer func() {
-					<-pool // 释放资源凭证
-					stationLogger.Info("释放资源")
-				}()
+			held, err := rt.acquirePool(ctx, stationLogger)
+			if err != nil {
+				results[index] = types.Result{ProductID: p.ID, Success: false, Error: fmt.Errorf("station %s: %w", s.GetID(), err)}
+				return
 			}
+			defer rt.releasePool(held, stationLogger)
 
-			e.eventBus.Publish(event.Event{Type: event.StepStarted, ProductID: p.ID, StationID: s.GetID()})
+			// 需要认证操作员的工站在加工前占用一名操作员，与资源凭证一样在加工结束后释放
+			op, err := e.operators.acquire(ctx, s.GetID(), p.ID, stationLogger)
+			if err != nil {
+				results[index] = types.Result{ProductID: p.ID, Success: false, Error: fmt.Errorf("station %s: %w", s.GetID(), err)}
+				return
+			}
+			if op != nil {
+				defer e.operators.release(op, stationLogger)
+			}
+
+			// 等待资源期间工站可能被停用，此时不再加工该工件
+			if err := rt.acquire(); err != nil {
+				stationLogger.Warn("工站已停用，拒绝加工")
+				results[index] = types.Result{ProductID: p.ID, Success: false, Error: fmt.Errorf("station %s: %w", s.GetID(), err)}
+				e.eventBus.Publish(event.Event{Type: event.StepRejected, ProductID: p.ID, StationID: s.GetID(), Step: stepIndex, TraceID: traceID, Error: err})
+				return
+			}
+			e.eventBus.Publish(event.Event{Type: event.StepStarted, ProductID: p.ID, StationID: s.GetID(), Step: stepIndex, TraceID: traceID})
 			start := time.Now()
-			results[index] = s.Execute(ctx, p)
-			duration := time.Since(start).Seconds()
-			e.eventBus.Publish(event.Event{Type: event.StepCompleted, ProductID: p.ID, StationID: s.GetID(), Product: &types.Product{Attrs: map[string]interface{}{"duration": duration}}})
+			fault := e.stations.injector().Execution(s.GetID())
+			if fault.Latency > 0 {
+				stationLogger.Warn("注入加工延迟", "product_id", p.ID, "latency", fault.Latency)
+				select {
+				case <-ctx.Done():
+				case <-time.After(fault.Latency):
+				}
+			}
+			switch {
+			case rt.takeInjected():
+				stationLogger.Warn("注入加工失败", "product_id", p.ID)
+				results[index] = types.Result{ProductID: p.ID, Success: false, Error: fmt.Errorf("station %s: %w", s.GetID(), ErrInjectedFailure), Defect: defect.Primary(s.GetID())}
+			case fault.Crash:
+				stationLogger.Warn("注入工站宕机，加工失败", "product_id", p.ID)
+				d := defect.Equipment("EQ-COMM", fmt.Sprintf("station %s: %v", s.GetID(), fault.Err))
+				results[index] = types.Result{ProductID: p.ID, Success: false, Error: d, Defect: d}
+			case fault.Err != nil:
+				stationLogger.Warn("注入加工失败", "product_id", p.ID, "error", fault.Err)
+				results[index] = types.Result{ProductID: p.ID, Success: false, Error: fmt.Errorf("station %s: %w: %w", s.GetID(), ErrInjectedFailure, fault.Err), Defect: defect.Primary(s.GetID())}
+			default:
+				results[index] = s.Execute(ctx, p)
+			}
+			// 工站没有返回缺陷代码时按错误归类
+			if res := &results[index]; !res.Success && res.Defect == nil {
+				res.Defect = defect.Classify(resultError(*res))
+			}
+			if op != nil {
+				results[index].Provenance.Operator = op.ID
+				results[index].Provenance.OperatorName = op.Name
+			}
+			elapsed := time.Since(start)
+			duration := elapsed.Seconds()
+			provenance := results[index].Provenance
+			var cost *types.Cost
+			if e.costing != nil {
+				c := e.costing.Step(s.GetID(), elapsed, results[index].Success, provenance)
+				cost = &c
+			}
+			rt.release()
+			e.eventBus.Publish(event.Event{
+				Type:         event.StepCompleted,
+				ProductID:    p.ID,
+				StationID:    s.GetID(),
+				Step:         stepIndex,
+				TraceID:      traceID,
+				Error:        resultError(results[index]),
+				Measurements: results[index].Measurements,
+				Defect:       results[index].Defect,
+				Provenance:   &provenance,
+				Cost:         cost,
+				Product: &types.Product{
+					Type:      p.Type,
+					Namespace: p.Namespace,
+					Attrs:     map[string]interface{}{"duration": duration, "workflow_version": version},
+				},
+			})
 
-		}(i, st)
+		}(i, rt)
 	}
 	wg.Wait() // 确保所有并行的 goroutine 都执行完毕
 	return results, stations
 }
 
-// checkStepFailure 检查步骤执行结果中是否有失败
-func (e *WorkflowEngine) checkStepFailure(results []types.Result) (bool, error) {
-	for _, res := range results {
+// resultError 返回工站执行结果对应的错误，成功时返回 nil
+func resultError(res types.Result) error {
+	if res.Success {
+		return nil
+	}
+	if res.Error != nil {
+		return res.Error
+	}
+	return fmt.Errorf("station returned failure for product %s", res.ProductID)
+}
+
+// firstFailure 返回步骤执行结果中第一个失败的工站的下标，都成功时返回 -1
+func firstFailure(results []types.Result) int {
+	for i, res := range results {
 		if !res.Success {
-			return true, res.Error
+			return i
 		}
 	}
-	return false, nil
+	return -1
 }
 
 // rollback 执行 Saga 补偿流程，逆序执行已完成工站的补偿操作
+// 单个工站补偿失败时发布 CompensationFailed 并继续补偿其余工站
 func (e *WorkflowEngine) rollback(ctx context.Context, stations []station.Station, p *types.Product, logger *slog.Logger) {
 	logger.Warn("启动 SAGA 补偿流程")
+	productFSM, _ := p.FSM.(*fsm.ProductFSM)
+	if productFSM != nil {
+		e.fire(productFSM, p, fsm.EventCompensate, logger)
+	}
+	traceID, _ := util.TraceIDFromContext(ctx)
 	for i := len(stations) - 1; i >= 0; i-- {
-		stations[i].Compensate(ctx, p)
+		err := e.stations.injector().Compensation(stations[i].GetID())
+		if err == nil {
+			err = stations[i].Compensate(ctx, p)
+		}
+		if err != nil {
+			logger.Error("工站补偿失败", "station_id", stations[i].GetID(), "error", err)
+			e.eventBus.Publish(event.Event{Type: event.CompensationFailed, ProductID: p.ID, Product: p.Snapshot(), StationID: stations[i].GetID(), TraceID: traceID, Error: err})
+			continue
+		}
+		e.eventBus.Publish(event.Event{Type: event.StepCompensated, ProductID: p.ID, StationID: stations[i].GetID(), TraceID: traceID})
+	}
+	if productFSM != nil {
+		e.fire(productFSM, p, fsm.EventRollback, logger)
 	}
-	e.eventBus.Publish(event.Event{Type: event.ProductCompensated, ProductID: p.ID, Product: p})
+	e.eventBus.Publish(event.Event{Type: event.ProductCompensated, ProductID: p.ID, Product: p.Snapshot(), TraceID: traceID})
 	logger.Info("工件补偿完成")
 }
@@ -0,0 +1,268 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"github.com/antonmedv/expr"
+	"industrial-4.0-demo/internal/types"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultWorkflow 是未配置时找不到产品类型对应的工作流所使用的默认工作流
+const DefaultWorkflow = "pcb_double_layer"
+
+// 管理工作流定义时可能返回的错误
+var (
+	ErrWorkflowNotFound   = errors.New("workflow not found")                 // 工作流或指定版本不存在
+	ErrWorkflowExists     = errors.New("workflow already exists")            // 创建时工作流已存在
+	ErrInvalidWorkflow    = errors.New("invalid workflow")                   // 工作流定义未通过校验
+	ErrWorkflowProtected  = errors.New("default workflow cannot be deleted") // 默认工作流是兜底流程，不允许删除
+	ErrUnknownProductType = errors.New("unknown product type")               // 严格模式下产品类型没有对应的工作流
+)
+
+// WorkflowDefinition 是一个版本化的工作流定义
+type WorkflowDefinition struct {
+	Name      string               `json:"name"`       // 工作流名称 (即产品类型，统一为小写)
+	Version   int                  `json:"version"`    // 版本号，从 1 开始，每次更新递增
+	Steps     []types.WorkflowStep `json:"steps"`      // 工作流步骤
+	UpdatedAt time.Time            `json:"updated_at"` // 该版本生效的时间
+}
+
+// WorkflowStore 保存所有工作流定义及其历史版本，支持运行时修改
+// 执行中的工件在开始生产时取得工作流的当前版本，之后的修改只影响新开始生产的工件
+type WorkflowStore struct {
+	mu       sync.RWMutex
+	versions map[string][]WorkflowDefinition // 按名称存储的所有版本，最后一个为当前版本
+	deleted  map[string]bool                 // 已删除的工作流，历史版本仍可查询
+	fallback string                          // 找不到产品类型对应的工作流时使用的默认工作流
+	strict   bool                            // 严格模式下不使用默认工作流，未知的产品类型在提交时被拒绝
+}
+
+// NewWorkflowStore 使用配置文件中的工作流创建存储，配置中的工作流作为版本 1
+func NewWorkflowStore(workflows map[string][]types.WorkflowStep) *WorkflowStore {
+	s := &WorkflowStore{
+		versions: make(map[string][]WorkflowDefinition),
+		deleted:  make(map[string]bool),
+		fallback: DefaultWorkflow,
+	}
+	now := time.Now()
+	for name, steps := range workflows {
+		name = normalizeWorkflowName(name)
+		s.versions[name] = []WorkflowDefinition{{Name: name, Version: 1, Steps: steps, UpdatedAt: now}}
+	}
+	return s
+}
+
+// normalizeWorkflowName 统一使用小写名称，与 Viper 加载后的工作流 key 保持一致
+func normalizeWorkflowName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// Current 返回工作流的当前版本
+func (s *WorkflowStore) Current(name string) (WorkflowDefinition, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.currentLocked(normalizeWorkflowName(name))
+}
+
+// currentLocked 返回工作流的当前版本，调用方必须持有读锁
+func (s *WorkflowStore) currentLocked(name string) (WorkflowDefinition, bool) {
+	versions := s.versions[name]
+	if len(versions) == 0 || s.deleted[name] {
+		return WorkflowDefinition{}, false
+	}
+	return versions[len(versions)-1], true
+}
+
+// SetFallback 设置找不到产品类型对应的工作流时使用的默认工作流，工作流必须存在；name 为空时不使用默认工作流
+func (s *WorkflowStore) SetFallback(name string) error {
+	name = normalizeWorkflowName(name)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.currentLocked(name); !ok && name != "" {
+		return fmt.Errorf("%w: %s", ErrWorkflowNotFound, name)
+	}
+	s.fallback = name
+	return nil
+}
+
+// Fallback 返回默认工作流的名称，未使用默认工作流时为空
+func (s *WorkflowStore) Fallback() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.fallback
+}
+
+// SetStrict 设置是否拒绝没有对应工作流的产品类型
+func (s *WorkflowStore) SetStrict(strict bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.strict = strict
+}
+
+// CheckProductType 在提交时检查产品类型，严格模式下没有对应工作流的产品类型返回 ErrUnknownProductType
+func (s *WorkflowStore) CheckProductType(productType string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.currentLocked(normalizeWorkflowName(productType)); ok || !s.strict {
+		return nil
+	}
+	return fmt.Errorf("%w %q (known types: %s)", ErrUnknownProductType, productType, strings.Join(s.namesLocked(), ", "))
+}
+
+// Resolve 返回产品类型对应的工作流的当前版本，找不到时使用默认工作流，fellBack 表示使用了默认工作流
+// 严格模式下或未设置默认工作流时返回 ErrUnknownProductType
+func (s *WorkflowStore) Resolve(productType string) (def WorkflowDefinition, fellBack bool, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if def, ok := s.currentLocked(normalizeWorkflowName(productType)); ok {
+		return def, false, nil
+	}
+	if s.strict || s.fallback == "" {
+		return WorkflowDefinition{}, false, fmt.Errorf("%w %q", ErrUnknownProductType, productType)
+	}
+	def, ok := s.currentLocked(s.fallback)
+	if !ok {
+		return WorkflowDefinition{}, false, fmt.Errorf("%w: %s", ErrWorkflowNotFound, s.fallback)
+	}
+	return def, true, nil
+}
+
+// Route 返回产品类型当前使用的工作流步骤，与 Resolve 使用相同的回退规则，没有可用的工作流时返回 nil
+func (s *WorkflowStore) Route(productType string) []types.WorkflowStep {
+	def, _, err := s.Resolve(productType)
+	if err != nil {
+		return nil
+	}
+	return def.Steps
+}
+
+// namesLocked 返回所有未删除的工作流名称，调用方必须持有读锁
+func (s *WorkflowStore) namesLocked() []string {
+	names := make([]string, 0, len(s.versions))
+	for name := range s.versions {
+		if !s.deleted[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Version 返回工作流的指定版本，已删除的工作流的历史版本仍可查询
+func (s *WorkflowStore) Version(name string, version int) (WorkflowDefinition, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	versions := s.versions[normalizeWorkflowName(name)]
+	if version < 1 || version > len(versions) {
+		return WorkflowDefinition{}, false
+	}
+	return versions[version-1], true
+}
+
+// List 返回所有工作流的当前版本，按名称排序
+func (s *WorkflowStore) List() []WorkflowDefinition {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]WorkflowDefinition, 0, len(s.versions))
+	for name := range s.versions {
+		if def, ok := s.currentLocked(name); ok {
+			list = append(list, def)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// put 写入工作流的新版本，create 为 true 时要求工作流不存在，否则要求工作流已存在
+func (s *WorkflowStore) put(name string, steps []types.WorkflowStep, create bool) (WorkflowDefinition, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, exists := s.currentLocked(name)
+	if create && exists {
+		return WorkflowDefinition{}, ErrWorkflowExists
+	}
+	if !create && !exists {
+		return WorkflowDefinition{}, ErrWorkflowNotFound
+	}
+	// 删除后重新创建的工作流延续原有的版本号
+	def := WorkflowDefinition{Name: name, Version: len(s.versions[name]) + 1, Steps: slices.Clone(steps), UpdatedAt: time.Now()}
+	s.versions[name] = append(s.versions[name], def)
+	delete(s.deleted, name)
+	return def, nil
+}
+
+// Delete 删除一个工作流，默认工作流不允许删除
+func (s *WorkflowStore) Delete(name string) error {
+	name = normalizeWorkflowName(name)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if name != "" && name == s.fallback {
+		return ErrWorkflowProtected
+	}
+	if _, ok := s.currentLocked(name); !ok {
+		return ErrWorkflowNotFound
+	}
+	s.deleted[name] = true
+	return nil
+}
+
+// Workflows 返回引擎使用的工作流存储
+func (e *WorkflowEngine) Workflows() *WorkflowStore {
+	return e.workflows
+}
+
+// CreateWorkflow 校验并创建一个新的工作流
+func (e *WorkflowEngine) CreateWorkflow(name string, steps []types.WorkflowStep) (WorkflowDefinition, error) {
+	name = normalizeWorkflowName(name)
+	if err := e.ValidateWorkflow(name, steps); err != nil {
+		return WorkflowDefinition{}, err
+	}
+	return e.workflows.put(name, steps, true)
+}
+
+// UpdateWorkflow 校验并发布工作流的新版本
+func (e *WorkflowEngine) UpdateWorkflow(name string, steps []types.WorkflowStep) (WorkflowDefinition, error) {
+	name = normalizeWorkflowName(name)
+	if err := e.ValidateWorkflow(name, steps); err != nil {
+		return WorkflowDefinition{}, err
+	}
+	return e.workflows.put(name, steps, false)
+}
+
+// ValidateWorkflow 在工作流生效前进行校验：
+// 名称不能为空，至少包含一个步骤，每个步骤至少包含一个已注册的工站且同一步骤内不重复，规则表达式必须能编译为布尔值
+func (e *WorkflowEngine) ValidateWorkflow(name string, steps []types.WorkflowStep) error {
+	if name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidWorkflow)
+	}
+	if len(steps) == 0 {
+		return fmt.Errorf("%w: at least one step is required", ErrInvalidWorkflow)
+	}
+	env := map[string]interface{}{"product": &types.Product{}}
+	for i, step := range steps {
+		if len(step.StationIDs) == 0 {
+			return fmt.Errorf("%w: step %d has no stations", ErrInvalidWorkflow, i)
+		}
+		seen := make(map[types.StationID]bool)
+		for _, id := range step.StationIDs {
+			if _, ok := e.stations.get(id); !ok {
+				return fmt.Errorf("%w: step %d references unknown station %s", ErrInvalidWorkflow, i, id)
+			}
+			if seen[id] {
+				return fmt.Errorf("%w: step %d lists station %s twice", ErrInvalidWorkflow, i, id)
+			}
+			seen[id] = true
+		}
+		if step.Rule != "" {
+			if _, err := expr.Compile(step.Rule, expr.Env(env), expr.AsBool()); err != nil {
+				return fmt.Errorf("%w: step %d rule: %v", ErrInvalidWorkflow, i, err)
+			}
+		}
+	}
+	return nil
+}
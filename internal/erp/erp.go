@@ -0,0 +1,407 @@
+// Package erp 是 ERP 订单的集成适配器：定期轮询 REST 接口或读取投递目录中的 JSON / CSV 订单，
+// 按字段映射转换为工件提交给调度器
+//
+// 每条订单以幂等键 (通常是 ERP 订单号) 去重，同一个键只提交一次，ERP 每次返回全部未关闭的订单也不会重复下单；
+// 已提交的键保存在 state_file 中，重启后仍然有效。导入状态通过 GET /api/v1/integrations/erp 和 erp_* 指标查看
+package erp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"industrial-4.0-demo/internal/engine"
+	"industrial-4.0-demo/internal/lot"
+	"industrial-4.0-demo/internal/metrics"
+	"industrial-4.0-demo/internal/types"
+	"industrial-4.0-demo/internal/web"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 订单的导入结果，用于 erp_orders_total 指标和导入记录
+const (
+	ResultSubmitted = "submitted" // 已提交
+	ResultDuplicate = "duplicate" // 幂等键已提交过，跳过
+	ResultRejected  = "rejected"  // 字段映射或校验失败
+)
+
+// 投递目录中存放已读取文件的子目录
+const (
+	ProcessedDir = "processed"
+	FailedDir    = "failed" // 无法按格式解析
+)
+
+// maxRecent 是导入状态中保留的最近导入记录数
+const maxRecent = 50
+
+// Options 定义订单来源、字段映射和幂等键的保存位置，url 和 dir 都为空时不启用
+type Options struct {
+	URL             string            `mapstructure:"url"`              // 轮询的 REST 接口 (GET)
+	Headers         map[string]string `mapstructure:"headers"`          // 请求头，例如 Authorization
+	Dir             string            `mapstructure:"dir"`              // 投递目录，读取其中的 .json 和 .csv 文件，与 url 二选一
+	Format          string            `mapstructure:"format"`           // json / csv，为空时按 Content-Type 或文件扩展名判断
+	Records         string            `mapstructure:"records"`          // JSON 中订单数组的路径，为空时整个文档是订单数组
+	IntervalSeconds int               `mapstructure:"interval_seconds"` // 轮询间隔
+	TimeoutSeconds  int               `mapstructure:"timeout_seconds"`  // 单次请求的超时
+	Namespace       string            `mapstructure:"namespace"`        // 工件所属的命名空间，为空时使用默认命名空间
+	StateFile       string            `mapstructure:"state_file"`       // 保存已提交的幂等键的文件，为空时只保存在内存中
+	Fields          Fields            `mapstructure:"fields"`
+	TypeMap         map[string]string `mapstructure:"type_map"` // ERP 中的产品代码到产品类型的映射，不区分大小写
+}
+
+// Enabled 判断是否配置了订单来源
+func (o Options) Enabled() bool {
+	return o.URL != "" || o.Dir != ""
+}
+
+// Entry 是一条订单的导入记录
+type Entry struct {
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"` // 接口地址或文件名
+	Key    string    `json:"key"`
+	ID     string    `json:"id,omitempty"` // 提交的工件 (批次) ID
+	Result string    `json:"result"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// Status 是适配器的导入状态
+type Status struct {
+	Source        string    `json:"source"` // 接口地址或投递目录
+	Polls         int       `json:"polls"`
+	LastPollAt    time.Time `json:"last_poll_at,omitzero"`
+	LastSuccessAt time.Time `json:"last_success_at,omitzero"`
+	LastError     string    `json:"last_error,omitempty"` // 最近一次轮询的错误，成功后清空
+	Submitted     int       `json:"submitted"`
+	Duplicates    int       `json:"duplicates"`
+	Rejected      int       `json:"rejected"`
+	Keys          int       `json:"keys"`   // 已提交的幂等键数
+	Recent        []Entry   `json:"recent"` // 最近提交和拒绝的订单，最新的在前，重复的订单不记录
+}
+
+// Adapter 轮询订单来源并提交新订单
+type Adapter struct {
+	opts         Options
+	scheduler    *engine.Scheduler
+	stateTracker *web.StateTracker
+	lots         *lot.Tracker // 为 nil 时数量大于 1 的订单被拒绝
+	typeMap      map[string]string
+	client       *http.Client
+	metrics      *metrics.Metrics
+	logger       *slog.Logger
+
+	pollMu sync.Mutex // 串行化定时轮询和手动触发的轮询
+
+	mu       sync.Mutex
+	keys     map[string]string // 已提交的幂等键到工件 ID
+	rejected map[string]string // 被拒绝的幂等键到原因，原因不变时不重复计数
+	status   Status
+}
+
+// stateFile 是 state_file 的内容
+type stateFile struct {
+	Keys map[string]string `json:"keys"`
+}
+
+// New 创建一个适配器，从 state_file 加载已提交的幂等键
+func New(opts Options, scheduler *engine.Scheduler, st *web.StateTracker, lots *lot.Tracker, m *metrics.Metrics, logger *slog.Logger) (*Adapter, error) {
+	a := &Adapter{
+		opts:         opts,
+		scheduler:    scheduler,
+		stateTracker: st,
+		lots:         lots,
+		typeMap:      make(map[string]string, len(opts.TypeMap)),
+		client:       &http.Client{Timeout: time.Duration(opts.TimeoutSeconds) * time.Second},
+		metrics:      m,
+		logger:       logger.With("component", "erp"),
+		keys:         make(map[string]string),
+		rejected:     make(map[string]string),
+		status:       Status{Source: opts.URL, Recent: []Entry{}},
+	}
+	if a.status.Source == "" {
+		a.status.Source = opts.Dir
+	}
+	for code, productType := range opts.TypeMap {
+		a.typeMap[strings.ToUpper(code)] = strings.ToUpper(productType)
+	}
+	if opts.StateFile != "" {
+		data, err := os.ReadFile(opts.StateFile)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return nil, fmt.Errorf("read erp state: %w", err)
+		default:
+			var state stateFile
+			if err := json.Unmarshal(data, &state); err != nil {
+				return nil, fmt.Errorf("parse erp state %s: %w", opts.StateFile, err)
+			}
+			maps.Copy(a.keys, state.Keys)
+		}
+	}
+	a.status.Keys = len(a.keys)
+	return a, nil
+}
+
+// Run 立即轮询一次，之后每隔 interval_seconds 轮询，直到 ctx 结束
+func (a *Adapter) Run(ctx context.Context) {
+	interval := time.Duration(a.opts.IntervalSeconds) * time.Second
+	a.logger.Info("开始轮询 ERP 订单", "source", a.status.Source, "interval", interval, "keys", len(a.keys))
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := a.Poll(ctx); err != nil && ctx.Err() == nil {
+			a.logger.Warn("轮询 ERP 订单失败", "source", a.status.Source, "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll 轮询一次订单来源并提交新订单，无法读取或解析订单时返回错误
+func (a *Adapter) Poll(ctx context.Context) error {
+	a.pollMu.Lock()
+	defer a.pollMu.Unlock()
+	var err error
+	if a.opts.URL != "" {
+		err = a.pollURL(ctx)
+	} else {
+		err = a.pollDir()
+	}
+
+	now := time.Now()
+	a.mu.Lock()
+	a.status.Polls++
+	a.status.LastPollAt = now
+	if err != nil {
+		a.status.LastError = err.Error()
+	} else {
+		a.status.LastError = ""
+		a.status.LastSuccessAt = now
+	}
+	a.mu.Unlock()
+	if err != nil {
+		a.metrics.ERPPollsTotal.WithLabelValues("error").Inc()
+		return err
+	}
+	a.metrics.ERPPollsTotal.WithLabelValues("success").Inc()
+	a.metrics.ERPLastSuccessTimestamp.Set(float64(now.Unix()))
+	return nil
+}
+
+// Status 返回导入状态
+func (a *Adapter) Status() Status {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s := a.status
+	s.Recent = slices.Clone(s.Recent)
+	return s
+}
+
+// pollURL 请求 REST 接口并导入返回的订单
+func (a *Adapter) pollURL(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.opts.URL, nil)
+	if err != nil {
+		return err
+	}
+	for name, value := range a.opts.Headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	format := a.opts.Format
+	if format == "" {
+		format = FormatJSON
+		if strings.Contains(resp.Header.Get("Content-Type"), "csv") {
+			format = FormatCSV
+		}
+	}
+	return a.process(data, format, a.opts.URL)
+}
+
+// pollDir 按文件名顺序导入投递目录中的 .json 和 .csv 文件，导入后移入 processed 子目录，无法解析的移入 failed 子目录
+// 单个文件无法解析不影响其他文件，返回最后一个错误
+func (a *Adapter) pollDir() error {
+	for _, sub := range []string{ProcessedDir, FailedDir} {
+		if err := os.MkdirAll(filepath.Join(a.opts.Dir, sub), 0o755); err != nil {
+			return err
+		}
+	}
+	entries, err := os.ReadDir(a.opts.Dir)
+	if err != nil {
+		return err
+	}
+	var lastErr error
+	for _, entry := range entries {
+		format := a.opts.Format
+		switch ext := strings.ToLower(filepath.Ext(entry.Name())); {
+		case !entry.Type().IsRegular() || (ext != ".json" && ext != ".csv"):
+			continue
+		case format == "":
+			format = strings.TrimPrefix(ext, ".")
+		}
+		path := filepath.Join(a.opts.Dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		dest := ProcessedDir
+		if err := a.process(data, format, entry.Name()); err != nil {
+			lastErr = fmt.Errorf("%s: %w", entry.Name(), err)
+			dest = FailedDir
+		}
+		if err := os.Rename(path, filepath.Join(a.opts.Dir, dest, entry.Name())); err != nil {
+			// 文件无法移走时删除，避免下次轮询重复读取
+			a.logger.Error("移动订单文件失败", "file", path, "error", err)
+			os.Remove(path)
+		}
+	}
+	return lastErr
+}
+
+// process 解析订单数据，逐条转换并提交幂等键未提交过的订单
+func (a *Adapter) process(data []byte, format, source string) error {
+	records, err := decode(data, format, a.opts.Records)
+	if err != nil {
+		return err
+	}
+	namespace := a.opts.Namespace
+	if namespace == "" {
+		namespace = types.DefaultNamespace
+	}
+	workflows := a.scheduler.Engine().Workflows()
+	submitted := 0
+	for _, r := range records {
+		o, err := transform(r, a.opts.Fields, a.typeMap)
+		if err != nil {
+			a.reject(source, o.Key, err.Error())
+			continue
+		}
+		a.mu.Lock()
+		_, seen := a.keys[o.Key]
+		if seen {
+			a.status.Duplicates++
+		}
+		a.mu.Unlock()
+		if seen {
+			a.metrics.ERPOrdersTotal.WithLabelValues(ResultDuplicate).Inc()
+			continue
+		}
+		if _, ok := workflows.Current(o.Type); !ok {
+			a.reject(source, o.Key, fmt.Sprintf("unknown product type %q", o.Type))
+			continue
+		}
+		if _, exists := a.stateTracker.GetProduct(o.ID); exists {
+			a.reject(source, o.Key, fmt.Sprintf("order id %q already exists", o.ID))
+			continue
+		}
+		if err := a.submit(o, namespace); err != nil {
+			a.reject(source, o.Key, err.Error())
+			continue
+		}
+
+		a.mu.Lock()
+		a.keys[o.Key] = o.ID
+		delete(a.rejected, o.Key)
+		a.status.Submitted++
+		a.status.Keys = len(a.keys)
+		a.addRecent(Entry{Time: time.Now(), Source: source, Key: o.Key, ID: o.ID, Result: ResultSubmitted})
+		a.mu.Unlock()
+		a.metrics.ERPOrdersTotal.WithLabelValues(ResultSubmitted).Inc()
+		submitted++
+	}
+	if submitted > 0 {
+		a.logger.Info("ERP 订单已提交", "source", source, "submitted", submitted, "records", len(records), "namespace", namespace)
+		if err := a.save(); err != nil {
+			a.logger.Error("保存 ERP 幂等键失败", "file", a.opts.StateFile, "error", err)
+		}
+	}
+	return nil
+}
+
+// submit 提交订单，数量大于 1 时按拼板拆分为批次
+func (a *Adapter) submit(o order, namespace string) error {
+	p := types.Product{ID: o.ID, Type: o.Type, Priority: o.Priority, Namespace: namespace, DueAt: o.DueDate, Attrs: o.Attrs}
+	p.Attrs["erp_order"] = o.Key
+	if !o.DueDate.IsZero() {
+		p.Attrs["due_date"] = o.DueDate.Format(time.RFC3339)
+	}
+	if o.Quantity == 1 {
+		a.scheduler.SubmitTask(&p)
+		return nil
+	}
+	if a.lots == nil {
+		return errors.New("lots are not enabled")
+	}
+	panels, err := a.lots.Split(p, o.Quantity)
+	if err != nil {
+		return err
+	}
+	for _, panel := range panels {
+		a.scheduler.SubmitTask(panel)
+	}
+	return nil
+}
+
+// reject 记录被拒绝的订单，同一个幂等键的拒绝原因不变时不重复计数
+func (a *Adapter) reject(source, key, reason string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if key != "" {
+		if prev, ok := a.rejected[key]; ok && prev == reason {
+			return
+		}
+		a.rejected[key] = reason
+	}
+	a.status.Rejected++
+	a.addRecent(Entry{Time: time.Now(), Source: source, Key: key, Result: ResultRejected, Error: reason})
+	a.metrics.ERPOrdersTotal.WithLabelValues(ResultRejected).Inc()
+	a.logger.Warn("ERP 订单被拒绝", "source", source, "key", key, "reason", reason)
+}
+
+// addRecent 追加一条导入记录，调用方必须持有 a.mu
+func (a *Adapter) addRecent(e Entry) {
+	a.status.Recent = slices.Insert(a.status.Recent, 0, e)
+	if len(a.status.Recent) > maxRecent {
+		a.status.Recent = a.status.Recent[:maxRecent]
+	}
+}
+
+// save 将已提交的幂等键写入 state_file，先写入临时文件再重命名，避免写入中断时损坏
+func (a *Adapter) save() error {
+	if a.opts.StateFile == "" {
+		return nil
+	}
+	a.mu.Lock()
+	data, err := json.MarshalIndent(stateFile{Keys: a.keys}, "", "  ")
+	a.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp := a.opts.StateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, a.opts.StateFile)
+}
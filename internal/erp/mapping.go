@@ -0,0 +1,192 @@
+package erp
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"industrial-4.0-demo/internal/importer"
+	"industrial-4.0-demo/internal/lot"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 订单数据的格式
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+// ErrMalformed 表示订单数据无法按配置的格式解析
+var ErrMalformed = errors.New("malformed order data")
+
+// Fields 定义订单字段到工件的映射，值为源字段名，JSON 中的嵌套字段用 . 分隔，例如 header.order_no
+type Fields struct {
+	Key      string            `mapstructure:"key"`      // 幂等键 (ERP 订单号)，必填，同一个键只提交一次
+	ID       string            `mapstructure:"id"`       // 工件 ID，为空时使用幂等键
+	Type     string            `mapstructure:"type"`     // 产品类型，取值可以通过 type_map 转换
+	Priority string            `mapstructure:"priority"` // 优先级，非负整数
+	DueDate  string            `mapstructure:"due_date"` // 交期
+	Quantity string            `mapstructure:"quantity"` // 数量，大于 1 时按拼板拆分为批次
+	Attrs    map[string]string `mapstructure:"attrs"`    // 工件属性名到源字段的映射
+}
+
+// record 是一条原始订单记录
+type record map[string]any
+
+// order 是按字段映射转换后的订单
+type order struct {
+	Key      string
+	ID       string
+	Type     string
+	Priority int
+	DueDate  time.Time
+	Quantity int
+	Attrs    map[string]interface{}
+}
+
+// decode 将订单数据解析为记录，JSON 可以是数组或包含数组的对象 (由 records 指定路径)，CSV 第一行为表头
+func decode(data []byte, format, records string) ([]record, error) {
+	if format == FormatCSV {
+		return decodeCSV(data)
+	}
+	var doc any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	if records != "" {
+		v, ok := lookup(doc, records)
+		if !ok {
+			return nil, fmt.Errorf("%w: field %q not found", ErrMalformed, records)
+		}
+		doc = v
+	}
+	items, ok := doc.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: expected an array of orders", ErrMalformed)
+	}
+	out := make([]record, 0, len(items))
+	for i, item := range items {
+		r, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%w: order #%d is not an object", ErrMalformed, i+1)
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// decodeCSV 将 CSV 的每一行解析为以表头为字段名的记录，空行被忽略
+func decodeCSV(data []byte) ([]record, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	header := rows[0]
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+	out := make([]record, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		rec := make(record, len(header))
+		blank := true
+		for i, name := range header {
+			if i < len(row) {
+				rec[strings.TrimSpace(name)] = row[i]
+				blank = blank && strings.TrimSpace(row[i]) == ""
+			}
+		}
+		if !blank {
+			out = append(out, rec)
+		}
+	}
+	return out, nil
+}
+
+// lookup 按 . 分隔的路径取出嵌套字段
+func lookup(v any, path string) (any, bool) {
+	for _, name := range strings.Split(path, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[name]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// text 返回字段的文本值，字段不存在或为 null 时返回空字符串
+func (r record) text(path string) string {
+	if path == "" {
+		return ""
+	}
+	v, ok := lookup(map[string]any(r), path)
+	if !ok || v == nil {
+		return ""
+	}
+	return strings.TrimSpace(fmt.Sprint(v))
+}
+
+// transform 按字段映射将记录转换为订单，typeMap 的键为大写的源取值
+func transform(r record, fields Fields, typeMap map[string]string) (order, error) {
+	o := order{Key: r.text(fields.Key), ID: r.text(fields.ID), Quantity: 1, Attrs: make(map[string]interface{})}
+	if o.Key == "" {
+		return o, fmt.Errorf("%s: idempotency key is required", fields.Key)
+	}
+	if o.ID == "" {
+		o.ID = o.Key
+	}
+	o.Type = strings.ToUpper(r.text(fields.Type))
+	if mapped, ok := typeMap[o.Type]; ok {
+		o.Type = mapped
+	}
+	if o.Type == "" {
+		return o, fmt.Errorf("%s: product type is required", fields.Type)
+	}
+	if v := r.text(fields.Priority); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return o, fmt.Errorf("%s: invalid priority %q", fields.Priority, v)
+		}
+		o.Priority = n
+	}
+	if v := r.text(fields.DueDate); v != "" {
+		due, err := importer.ParseDate(v)
+		if err != nil {
+			return o, fmt.Errorf("%s: invalid due date %q", fields.DueDate, v)
+		}
+		o.DueDate = due
+	}
+	if v := r.text(fields.Quantity); v != "" {
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil || n < 1 || n > lot.MaxQuantity || n != math.Trunc(n) {
+			return o, fmt.Errorf("%s: invalid quantity %q", fields.Quantity, v)
+		}
+		o.Quantity = int(n)
+	}
+	for attr, path := range fields.Attrs {
+		v, ok := lookup(map[string]any(r), path)
+		if !ok || v == nil {
+			continue
+		}
+		if n, ok := v.(json.Number); ok {
+			// 与 API 提交的工件一致，JSON 数字作为 float64 保存
+			v, _ = n.Float64()
+		}
+		o.Attrs[attr] = v
+	}
+	return o, nil
+}
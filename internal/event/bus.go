@@ -3,6 +3,7 @@ package event
 import (
 	"industrial-4.0-demo/internal/types"
 	"sync"
+	"time"
 )
 
 // EventType 定义事件的类型
@@ -10,21 +11,124 @@ type EventType string
 
 // 定义所有业务事件类型
 const (
+	ProductQueued      EventType = "ProductQueued"      // 产品进入调度队列
+	ProductDispatched  EventType = "ProductDispatched"  // 产品出队并分配到 worker
 	ProductStarted     EventType = "ProductStarted"     // 产品开始生产
 	ProductCompleted   EventType = "ProductCompleted"   // 产品成功完成
 	ProductFailed      EventType = "ProductFailed"      // 产品生产失败
 	ProductCompensated EventType = "ProductCompensated" // 产品补偿完成
+	ProductCancelled   EventType = "ProductCancelled"   // 产品被取消
+	StepQueued         EventType = "StepQueued"         // 步骤等待工站资源
 	StepStarted        EventType = "StepStarted"        // 步骤开始执行
 	StepCompleted      EventType = "StepCompleted"      // 步骤执行完成
+	StepCompensated    EventType = "StepCompensated"    // 单个工站补偿完成
+	StepRejected       EventType = "StepRejected"       // 工站已停用，步骤未执行
+	StepBlocked        EventType = "StepBlocked"        // 下一个工站的在制品达到上限，工件停留在上游等待
+	StepUnblocked      EventType = "StepUnblocked"      // 下一个工站释放了看板，工件解除阻塞
+	CompensationFailed EventType = "CompensationFailed" // 单个工站补偿失败
+	StateChanged       EventType = "StateChanged"       // 工件生命周期状态变更 (由 FSM 发布)
+
+	StationStatusChanged EventType = "StationStatusChanged" // 工站状态变更 (由工站 FSM 发布)
+	PoolChanged          EventType = "PoolChanged"          // 资源池占用变化 (由工站注册表发布)
+	WIPChanged           EventType = "WIPChanged"           // 工站的在制品或在制品上限变化 (由工站注册表发布)
+	StationAnomaly       EventType = "StationAnomaly"       // 工站步骤耗时偏离基线 (由异常检测器发布)
+	LotCompleted         EventType = "LotCompleted"         // 批次的所有拼板都已结束 (由批次追踪器发布)
+	MaintenanceDue       EventType = "MaintenanceDue"       // 工站触发维护规则，已创建维护工单 (由维护追踪器发布)
+	OperatorChanged      EventType = "OperatorChanged"      // 操作员的分配或负荷变化 (由操作员池发布)
+	SLABreachPredicted   EventType = "SLABreachPredicted"   // 工件的预计完工时间晚于交期 (由交期追踪器发布)
+	SLABreached          EventType = "SLABreached"          // 工件超过交期仍未完成，或完成时已超过交期 (由交期追踪器发布)
 )
 
+// SLAStatus 是工件的交期和预计完工时间
+type SLAStatus struct {
+	DueAt       time.Time // 交期
+	ProjectedAt time.Time // 预计完工时间，完成时已超过交期的工件为完成时间
+}
+
+// PoolUsage 是资源池在某一时刻的占用情况
+type PoolUsage struct {
+	Capacity int // 资源池容量
+	InUse    int // 已占用的资源凭证数
+	Waiting  int // 等待资源凭证的工件数
+}
+
+// WIPUsage 是工站在某一时刻的在制品情况
+type WIPUsage struct {
+	Limit   int // 在制品上限，0 表示不限制
+	InUse   int // 占用看板的工件数
+	Blocked int // 等待看板的工件数
+}
+
+// Anomaly 是一次偏离基线的步骤耗时
+type Anomaly struct {
+	DurationSeconds float64 // 本次步骤的耗时
+	MeanSeconds     float64 // 检测时的基线均值
+	StdDevSeconds   float64 // 检测时的基线标准差
+	ZScore          float64 // (耗时 - 均值) / 标准差，正值表示变慢
+}
+
+// LotSummary 是批次结束时的汇总
+type LotSummary struct {
+	ID        string
+	Status    string // COMPLETED / PARTIAL / FAILED
+	Quantity  int
+	Completed int
+	Failed    int
+	Cancelled int
+}
+
+// WorkOrderSummary 是新创建的维护工单
+type WorkOrderSummary struct {
+	ID          string
+	Rule        string // 触发的维护规则
+	Reason      string // duration_drift / failure_rate
+	Maintenance bool   // 工站已进入维护模式
+}
+
+// OperatorUsage 是操作员在某一时刻的分配和累计负荷
+type OperatorUsage struct {
+	ID          string
+	Name        string
+	Busy        bool    // 正在操作工站，工站和工件见事件的 StationID 和 ProductID
+	Assignments int     // 累计分配的加工次数
+	BusySeconds float64 // 累计加工时长，不含进行中的分配
+}
+
 // Event 结构体定义了事件的数据负载
 type Event struct {
-	Type      EventType       // 事件类型
-	ProductID string          // 关联的产品 ID
-	Product   *types.Product  // 完整的产品数据
-	StationID types.StationID // 关联的工站 ID (仅步骤相关事件)
-	Error     error           // 错误信息 (仅失败事件)
+	Type         EventType           // 事件类型
+	ProductID    string              // 关联的产品 ID
+	Product      *types.Product      // 完整的产品数据
+	StationID    types.StationID     // 关联的工站 ID (步骤相关事件；工件失败事件中为失败的工站)
+	Step         int                 // 步骤索引 (步骤相关事件；工件失败事件中为失败的步骤)
+	TraceID      string              // 本次生产的 Trace ID
+	Timestamp    time.Time           // 事件发生时间，为空时由 Publish 填充
+	Error        error               // 错误信息 (仅失败事件)
+	FromState    string              // 转移前的状态 (仅状态变更事件)
+	ToState      string              // 转移后的状态 (仅状态变更事件)
+	Trigger      string              // 触发转移的 FSM 事件 (仅状态变更事件)
+	Seq          uint64              // 状态转移序号，处理器是异步执行的，消费者据此丢弃乱序到达的旧状态
+	Worker       int                 // 执行任务的 worker 编号 (仅派发事件)
+	Pool         *PoolUsage          // 资源池占用 (仅资源池事件)
+	WIP          *WIPUsage           // 在制品 (仅在制品事件)
+	SLA          *SLAStatus          // 交期和预计完工时间 (仅 SLA 事件)
+	Blocked      time.Duration       // 工件被阻塞的时长 (仅解除阻塞事件)
+	Anomaly      *Anomaly            // 步骤耗时异常 (仅工站异常事件)
+	Lot          *LotSummary         // 批次汇总 (仅批次事件)
+	WorkOrder    *WorkOrderSummary   // 维护工单 (仅维护事件)
+	Operator     *OperatorUsage      // 操作员负荷 (仅操作员事件)
+	Measurements []types.Measurement // 工站采集的质量测量值 (仅步骤完成事件)
+	Defect       *types.Defect       // 失败步骤的缺陷 (步骤完成和工件失败事件)
+	Provenance   *types.Provenance   // 加工的设备、操作员和物料 (仅步骤完成事件)
+	Cost         *types.Cost         // 加工成本，引擎没有成本模型时为空 (仅步骤完成事件)
+}
+
+// Namespace 返回事件关联的工件所属的命名空间，没有工件数据时为空，用于指标的 namespace 标签
+func (e Event) Namespace() string {
+	if e.Product == nil {
+		return ""
+	}
+	return e.Product.Namespace
 }
 
 // Handler 是事件处理函数的签名
@@ -52,6 +156,10 @@ func (b *Bus) Subscribe(eventType EventType, handler Handler) {
 
 // Publish 发布一个事件，所有订阅了该事件类型的处理器都将被调用
 func (b *Bus) Publish(e Event) {
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 
@@ -0,0 +1,148 @@
+// Package features 提供简单的功能开关：实验性的子系统默认关闭随版本发布，在配置中或运行中通过管理接口打开，演示时可以随时切换
+package features
+
+import (
+	"errors"
+	"fmt"
+	"industrial-4.0-demo/internal/metrics"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// 所有功能开关，名称与配置文件 features 段中的键相同
+const (
+	DAGEngine     = "dag_engine"     // 按依赖关系 (DAG) 而不是顺序步骤执行工作流
+	Preemption    = "preemption"     // 高优先级任务抢占低优先级任务等待的资源
+	WSDelta       = "ws_delta"       // WebSocket 只推送状态的增量而不是完整快照
+	AsyncStations = "async_stations" // 远程工站异步回调加工结果
+)
+
+// descriptions 是各功能开关的说明，按名称排序列出
+var descriptions = map[string]string{
+	DAGEngine:     "按依赖关系 (DAG) 而不是顺序步骤执行工作流",
+	Preemption:    "高优先级任务抢占低优先级任务等待的资源",
+	WSDelta:       "WebSocket 只推送状态的增量而不是完整快照",
+	AsyncStations: "远程工站异步回调加工结果",
+}
+
+// ErrUnknownFlag 表示功能开关不存在
+var ErrUnknownFlag = errors.New("unknown feature flag")
+
+// Flag 是一个功能开关的当前状态
+type Flag struct {
+	Name        string `json:"name"`
+	Enabled     bool   `json:"enabled"`
+	Description string `json:"description"`
+}
+
+// Names 返回所有功能开关的名称，按名称排序
+func Names() []string {
+	names := make([]string, 0, len(descriptions))
+	for name := range descriptions {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Check 检查功能开关的名称，不存在时返回 ErrUnknownFlag
+func Check(name string) error {
+	if _, ok := descriptions[strings.ToLower(name)]; !ok {
+		return fmt.Errorf("%w %q (known flags: %s)", ErrUnknownFlag, name, strings.Join(Names(), ", "))
+	}
+	return nil
+}
+
+// Flags 保存功能开关的当前状态，可以在运行中切换
+// nil 的 *Flags 视为所有开关关闭，未接入功能开关的组件不需要判空
+type Flags struct {
+	mu      sync.RWMutex
+	enabled map[string]bool
+	metrics *metrics.Metrics
+}
+
+// New 按配置创建功能开关，未配置的开关关闭，配置中出现未知的开关时返回错误
+func New(initial map[string]bool, m *metrics.Metrics) (*Flags, error) {
+	f := &Flags{enabled: make(map[string]bool), metrics: m}
+	if err := f.Update(initial); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Enabled 判断功能开关是否打开
+func (f *Flags) Enabled(name string) bool {
+	if f == nil {
+		return false
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.enabled[strings.ToLower(name)]
+}
+
+// Set 打开或关闭一个功能开关，返回修改后的状态
+func (f *Flags) Set(name string, enabled bool) (Flag, error) {
+	if err := Check(name); err != nil {
+		return Flag{}, err
+	}
+	name = strings.ToLower(name)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.setLocked(name, enabled)
+	return Flag{Name: name, Enabled: enabled, Description: descriptions[name]}, nil
+}
+
+// Update 按 values 设置所有功能开关，未出现的开关关闭；任一名称未知时返回错误且不做任何修改
+func (f *Flags) Update(values map[string]bool) error {
+	for name := range values {
+		if err := Check(name); err != nil {
+			return err
+		}
+	}
+	normalized := make(map[string]bool, len(values))
+	for name, enabled := range values {
+		normalized[strings.ToLower(name)] = enabled
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, name := range Names() {
+		f.setLocked(name, normalized[name])
+	}
+	return nil
+}
+
+// setLocked 修改开关并更新指标，调用方必须持有写锁
+func (f *Flags) setLocked(name string, enabled bool) {
+	f.enabled[name] = enabled
+	if f.metrics == nil {
+		return
+	}
+	value := 0.0
+	if enabled {
+		value = 1
+	}
+	f.metrics.FeatureFlagEnabled.WithLabelValues(name).Set(value)
+}
+
+// List 返回所有功能开关的当前状态，按名称排序
+func (f *Flags) List() []Flag {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	list := make([]Flag, 0, len(descriptions))
+	for _, name := range Names() {
+		list = append(list, Flag{Name: name, Enabled: f.enabled[name], Description: descriptions[name]})
+	}
+	return list
+}
+
+// Values 返回所有功能开关的开关状态，键为名称
+func (f *Flags) Values() map[string]bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	values := make(map[string]bool, len(f.enabled))
+	for name, enabled := range f.enabled {
+		values[name] = enabled
+	}
+	return values
+}
@@ -0,0 +1,36 @@
+package fsm
+
+// AlertState 定义安灯告警的处理状态
+type AlertState string
+
+// AlertEvent 定义触发告警状态转移的事件类型
+type AlertEvent string
+
+// 定义告警的所有状态
+const (
+	AlertOpen         AlertState = "OPEN"         // 已产生，等待现场人员响应
+	AlertAcknowledged AlertState = "ACKNOWLEDGED" // 已确认，正在处理
+	AlertResolved     AlertState = "RESOLVED"     // 已解决
+)
+
+// 定义所有可能触发告警状态转移的事件
+const (
+	AlertEventAck     AlertEvent = "ACK"     // 确认告警
+	AlertEventResolve AlertEvent = "RESOLVE" // 解决告警
+)
+
+// AlertFSM 是告警处理状态机
+type AlertFSM = FSM[AlertState, AlertEvent]
+
+// alertLifecycle 是告警处理的状态机定义，未确认的告警也可以直接解决
+var alertLifecycle = NewBuilder[AlertState, AlertEvent]("alert", AlertOpen).
+	Permit(AlertOpen, AlertEventAck, AlertAcknowledged).
+	Permit(AlertOpen, AlertEventResolve, AlertResolved).
+	Permit(AlertAcknowledged, AlertEventResolve, AlertResolved).
+	Build()
+
+// NewAlertFSM 创建一个新的告警状态机，初始状态为 OPEN
+// 告警状态变更通过看板推送，不发布到事件总线
+func NewAlertFSM(alertID string) *AlertFSM {
+	return alertLifecycle.New(alertID)
+}
@@ -2,104 +2,173 @@ package fsm
 
 import (
 	"fmt"
+	"industrial-4.0-demo/internal/event"
 	"sync"
 )
 
-// State 定义状态的类型
-type State string
-
-// Event 定义事件的类型
-type Event string
-
-// 定义所有可能的状态
-const (
-	StateCreated      State = "CREATED"       // 已创建
-	StateProcessing   State = "PROCESSING"    // 处理中
-	StateQualityCheck State = "QUALITY_CHECK" // 质检中
-	StateCompleted    State = "COMPLETED"     // 已完成
-	StateFailed       State = "FAILED"        // 已失败
-	StateCompensating State = "COMPENSATING"  // 补偿中
-	StateCompensated  State = "COMPENSATED"   // 已补偿
-)
+// Definition 是一个不可变的状态机定义 (初始状态 + 状态转移表)
+// 同一个定义可以创建任意多个 FSM 实例，由 Builder 构建
+type Definition[S ~string, E ~string] struct {
+	name        string                            // 定义名称 (如生命周期变体名)
+	initial     S                                 // 初始状态
+	transitions map[S]map[E]S                     // 状态转移表: map[当前状态]map[事件]下一个状态
+	newEvent    func(targetID string) event.Event // 状态变更事件的模板，为 nil 时发布以 targetID 为工件 ID 的 StateChanged 事件
+}
 
-// 定义所有可能触发状态转移的事件
-const (
-	EventStart      Event = "START"         // 开始处理
-	EventEnterQC    Event = "ENTER_QC"      // 进入质检
-	EventPassQC     Event = "PASS_QC"       // 质检通过
-	EventFinish     Event = "FINISH"        // 完成处理
-	EventFail       Event = "FAIL"          // 处理失败
-	EventCompensate Event = "COMPENSATE"    // 开始补偿
-	EventRollback   Event = "ROLLBACK_DONE" // 补偿完成
-)
+// Name 返回定义名称
+func (d *Definition[S, E]) Name() string {
+	return d.name
+}
 
-// FSM 是一个简单的有限状态机实现
-type FSM struct {
-	Current     State                           // 当前状态
-	mu          sync.Mutex                      // 互斥锁，保证并发安全
-	transitions map[State]map[Event]State       // 状态转移表: map[当前状态]map[事件]下一个状态
-	callbacks   map[State]func(targetID string) // 状态进入时的回调函数
-	TargetID    string                          // 状态机关联的目标对象 ID (如工件 ID)
-}
-
-// NewFSM 创建一个新的 FSM 实例
-func NewFSM(targetID string) *FSM {
-	fsm := &FSM{
-		Current:     StateCreated,
-		TargetID:    targetID,
-		transitions: make(map[State]map[Event]State),
-		callbacks:   make(map[State]func(string)),
+// New 基于该定义创建一个新的 FSM 实例
+func (d *Definition[S, E]) New(targetID string) *FSM[S, E] {
+	return &FSM[S, E]{
+		Current:  d.initial,
+		TargetID: targetID,
+		def:      d,
+		onEnter:  make(map[S][]Action[E]),
+		onExit:   make(map[S][]Action[E]),
 	}
-	fsm.initTransitions()
-	return fsm
 }
 
-// initTransitions 初始化状态转移表
-func (f *FSM) initTransitions() {
-	f.addTransition(StateCreated, EventStart, StateProcessing)
-	f.addTransition(StateProcessing, EventEnterQC, StateQualityCheck)
-	f.addTransition(StateProcessing, EventFinish, StateCompleted)
-	f.addTransition(StateProcessing, EventFail, StateFailed)
-
-	f.addTransition(StateQualityCheck, EventPassQC, StateProcessing)
-	f.addTransition(StateQualityCheck, EventFinish, StateCompleted)
-	f.addTransition(StateQualityCheck, EventFail, StateFailed)
+// Builder 用于以链式调用的方式构建状态机定义
+type Builder[S ~string, E ~string] struct {
+	def *Definition[S, E]
+}
 
-	f.addTransition(StateFailed, EventCompensate, StateCompensating)
-	f.addTransition(StateCompensating, EventRollback, StateCompensated)
+// NewBuilder 创建一个新的状态机定义构建器
+func NewBuilder[S ~string, E ~string](name string, initial S) *Builder[S, E] {
+	return &Builder[S, E]{def: &Definition[S, E]{
+		name:        name,
+		initial:     initial,
+		transitions: make(map[S]map[E]S),
+	}}
 }
 
-// addTransition 添加一条状态转移规则
-func (f *FSM) addTransition(from State, event Event, to State) {
-	if _, ok := f.transitions[from]; !ok {
-		f.transitions[from] = make(map[Event]State)
+// Permit 添加一条状态转移规则：在 from 状态下触发 ev 事件将转移到 to 状态
+func (b *Builder[S, E]) Permit(from S, ev E, to S) *Builder[S, E] {
+	if _, ok := b.def.transitions[from]; !ok {
+		b.def.transitions[from] = make(map[E]S)
 	}
-	f.transitions[from][event] = to
+	b.def.transitions[from][ev] = to
+	return b
+}
+
+// PublishAs 指定状态转移时发布的事件模板，用于非工件领域的状态机 (如工站)
+// newEvent 返回的事件只需填写类型和目标 ID，状态、触发事件和序号由 FSM 填充
+func (b *Builder[S, E]) PublishAs(newEvent func(targetID string) event.Event) *Builder[S, E] {
+	b.def.newEvent = newEvent
+	return b
+}
+
+// Build 返回构建完成的状态机定义
+// 调用 Build 之后不应再使用该构建器
+func (b *Builder[S, E]) Build() *Definition[S, E] {
+	return b.def
+}
+
+// Action 是进入或离开某个状态时执行的动作
+// targetID 为状态机关联的目标对象 ID，ev 为触发本次转移的事件
+type Action[E ~string] func(targetID string, ev E)
+
+// FSM 是一个通用的有限状态机实现
+// S 为状态类型，E 为事件类型，不同领域的状态机使用各自的类型以避免混用
+type FSM[S ~string, E ~string] struct {
+	Current  S                 // 当前状态
+	TargetID string            // 状态机关联的目标对象 ID (如工件 ID)
+	mu       sync.Mutex        // 互斥锁，保证并发安全
+	def      *Definition[S, E] // 状态机定义
+	onEnter  map[S][]Action[E] // 进入状态时执行的动作
+	onExit   map[S][]Action[E] // 离开状态时执行的动作
+	bus      *event.Bus        // 事件总线，每次成功的状态转移都会发布状态变更事件
+	seq      uint64            // 已发生的状态转移次数
+}
+
+// Name 返回状态机定义的名称
+func (f *FSM[S, E]) Name() string {
+	return f.def.name
 }
 
 // RegisterCallback 注册进入某个状态时的回调函数
-func (f *FSM) RegisterCallback(state State, callback func(targetID string)) {
-	f.callbacks[state] = callback
+// 保留用于兼容，新代码应使用 OnEnter
+func (f *FSM[S, E]) RegisterCallback(state S, callback func(targetID string)) {
+	f.OnEnter(state, func(targetID string, _ E) { callback(targetID) })
+}
+
+// OnEnter 注册进入某个状态时执行的动作，同一状态可以注册多个动作，按注册顺序执行
+func (f *FSM[S, E]) OnEnter(state S, action Action[E]) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.onEnter[state] = append(f.onEnter[state], action)
+}
+
+// OnExit 注册离开某个状态时执行的动作，用于释放资源、停止计时器等清理工作
+func (f *FSM[S, E]) OnExit(state S, action Action[E]) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.onExit[state] = append(f.onExit[state], action)
+}
+
+// SetEventBus 设置用于发布状态变更事件的事件总线
+func (f *FSM[S, E]) SetEventBus(bus *event.Bus) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.bus = bus
+}
+
+// Can 判断当前状态下是否可以触发指定事件
+func (f *FSM[S, E]) Can(ev E) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.def.transitions[f.Current][ev]
+	return ok
+}
+
+// State 返回当前状态
+func (f *FSM[S, E]) State() S {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.Current
 }
 
 // Fire 触发一个事件，尝试进行状态转移
-func (f *FSM) Fire(event Event) error {
+func (f *FSM[S, E]) Fire(ev E) error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
 	// 查找当前状态下，该事件是否能触发合法的转移
-	nextState, ok := f.transitions[f.Current][event]
+	nextState, ok := f.def.transitions[f.Current][ev]
 	if !ok {
-		return fmt.Errorf("invalid transition: cannot fire event '%s' from state '%s'", event, f.Current)
+		return fmt.Errorf("invalid transition: cannot fire event '%s' from state '%s'", ev, f.Current)
+	}
+
+	prevState := f.Current
+
+	// 注意：动作是同步执行的，应避免在动作中执行耗时操作或再次调用 Fire 导致死锁
+	// 先执行离开旧状态的动作
+	for _, action := range f.onExit[prevState] {
+		action(f.TargetID, ev)
 	}
 
-	// prevState := f.Current // 移除未使用的变量
 	f.Current = nextState
+	f.seq++
+
+	// 发布状态变更事件，供 UI 投影等订阅者消费
+	if f.bus != nil {
+		e := event.Event{Type: event.StateChanged, ProductID: f.TargetID}
+		if f.def.newEvent != nil {
+			e = f.def.newEvent(f.TargetID)
+		}
+		e.FromState = string(prevState)
+		e.ToState = string(nextState)
+		e.Trigger = string(ev)
+		e.Seq = f.seq
+		f.bus.Publish(e)
+	}
 
-	// 触发回调（如果已注册）
-	if cb, exists := f.callbacks[nextState]; exists {
-		// 注意：回调是同步执行的，应避免在回调中执行耗时操作或再次调用 Fire 导致死锁
-		cb(f.TargetID)
+	// 再执行进入新状态的动作
+	for _, action := range f.onEnter[nextState] {
+		action(f.TargetID, ev)
 	}
 
 	return nil
@@ -0,0 +1,108 @@
+package fsm
+
+// State 定义工件生命周期的状态类型
+type State string
+
+// Event 定义触发工件状态转移的事件类型
+type Event string
+
+// 定义所有可能的状态
+const (
+	StateCreated      State = "CREATED"       // 已创建
+	StateProcessing   State = "PROCESSING"    // 处理中
+	StateQualityCheck State = "QUALITY_CHECK" // 质检中
+	StateCompleted    State = "COMPLETED"     // 已完成
+	StateFailed       State = "FAILED"        // 已失败
+	StateCompensating State = "COMPENSATING"  // 补偿中
+	StateCompensated  State = "COMPENSATED"   // 已补偿
+	StateCancelled    State = "CANCELLED"     // 已取消
+
+	StateLaminationInspection State = "LAMINATION_INSPECTION" // 层压检测中 (多层板专用)
+)
+
+// 定义所有可能触发状态转移的事件
+const (
+	EventStart      Event = "START"         // 开始处理
+	EventEnterQC    Event = "ENTER_QC"      // 进入质检
+	EventPassQC     Event = "PASS_QC"       // 质检通过
+	EventFinish     Event = "FINISH"        // 完成处理
+	EventFail       Event = "FAIL"          // 处理失败
+	EventCompensate Event = "COMPENSATE"    // 开始补偿
+	EventRollback   Event = "ROLLBACK_DONE" // 补偿完成
+	EventCancel     Event = "CANCEL"        // 操作员取消
+
+	EventEnterLamiInspection Event = "ENTER_LAMI_INSPECTION" // 进入层压检测
+	EventPassLamiInspection  Event = "PASS_LAMI_INSPECTION"  // 层压检测通过
+)
+
+// Variant 定义生命周期变体的名称
+// 不同产品类型可以选择不同的状态转移表
+type Variant string
+
+// 定义所有支持的生命周期变体
+const (
+	VariantStandard   Variant = "standard"   // 标准流程：包含质检环节
+	VariantPrototype  Variant = "prototype"  // 打样流程：跳过质检，追求交付速度
+	VariantMultilayer Variant = "multilayer" // 多层板流程：层压后增加层压检测环节
+)
+
+// ProductFSM 是工件生命周期状态机
+type ProductFSM = FSM[State, Event]
+
+// productLifecycles 存储所有生命周期变体的状态机定义
+var productLifecycles = map[Variant]*Definition[State, Event]{
+	VariantStandard:   buildProductLifecycle(VariantStandard),
+	VariantPrototype:  buildProductLifecycle(VariantPrototype),
+	VariantMultilayer: buildProductLifecycle(VariantMultilayer),
+}
+
+// IsValid 判断变体名称是否受支持
+func (v Variant) IsValid() bool {
+	_, ok := productLifecycles[v]
+	return ok
+}
+
+// NewFSM 创建一个使用标准生命周期的工件状态机
+func NewFSM(targetID string) *ProductFSM {
+	return NewFSMWithVariant(targetID, VariantStandard)
+}
+
+// NewFSMWithVariant 创建一个使用指定生命周期变体的工件状态机
+// 未知的变体会回退到标准生命周期
+func NewFSMWithVariant(targetID string, variant Variant) *ProductFSM {
+	def, ok := productLifecycles[variant]
+	if !ok {
+		def = productLifecycles[VariantStandard]
+	}
+	return def.New(targetID)
+}
+
+// buildProductLifecycle 根据变体构建工件生命周期的状态转移表
+func buildProductLifecycle(variant Variant) *Definition[State, Event] {
+	b := NewBuilder[State, Event](string(variant), StateCreated).
+		Permit(StateCreated, EventStart, StateProcessing).
+		Permit(StateProcessing, EventFinish, StateCompleted).
+		Permit(StateProcessing, EventFail, StateFailed).
+		Permit(StateFailed, EventCompensate, StateCompensating).
+		Permit(StateCompensating, EventRollback, StateCompensated).
+		Permit(StateCreated, EventCancel, StateCancelled).
+		Permit(StateProcessing, EventCancel, StateCancelled)
+
+	// 打样流程不经过质检
+	if variant != VariantPrototype {
+		b.Permit(StateProcessing, EventEnterQC, StateQualityCheck).
+			Permit(StateQualityCheck, EventPassQC, StateProcessing).
+			Permit(StateQualityCheck, EventFinish, StateCompleted).
+			Permit(StateQualityCheck, EventFail, StateFailed).
+			Permit(StateQualityCheck, EventCancel, StateCancelled)
+	}
+
+	// 多层板在层压后需要额外的层压检测
+	if variant == VariantMultilayer {
+		b.Permit(StateProcessing, EventEnterLamiInspection, StateLaminationInspection).
+			Permit(StateLaminationInspection, EventPassLamiInspection, StateProcessing).
+			Permit(StateLaminationInspection, EventFail, StateFailed).
+			Permit(StateLaminationInspection, EventCancel, StateCancelled)
+	}
+	return b.Build()
+}
@@ -0,0 +1,53 @@
+package fsm
+
+import (
+	"industrial-4.0-demo/internal/event"
+	"industrial-4.0-demo/internal/types"
+)
+
+// StationState 定义工站生命周期的状态类型
+type StationState string
+
+// StationEvent 定义触发工站状态转移的事件类型
+type StationEvent string
+
+// 定义工站的所有状态
+const (
+	StationIdle        StationState = "IDLE"        // 空闲
+	StationBusy        StationState = "BUSY"        // 加工中
+	StationDown        StationState = "DOWN"        // 故障停机
+	StationMaintenance StationState = "MAINTENANCE" // 维护中
+)
+
+// 定义所有可能触发工站状态转移的事件
+const (
+	StationEventAcquire      StationEvent = "ACQUIRE"       // 开始加工工件
+	StationEventRelease      StationEvent = "RELEASE"       // 工件加工结束
+	StationEventBreakdown    StationEvent = "BREAKDOWN"     // 设备故障
+	StationEventRepair       StationEvent = "REPAIR"        // 故障修复
+	StationEventStartService StationEvent = "START_SERVICE" // 开始维护
+	StationEventEndService   StationEvent = "END_SERVICE"   // 维护结束
+)
+
+// StationFSM 是工站生命周期状态机
+type StationFSM = FSM[StationState, StationEvent]
+
+// stationLifecycle 是工站生命周期的状态机定义
+var stationLifecycle = NewBuilder[StationState, StationEvent]("station", StationIdle).
+	Permit(StationIdle, StationEventAcquire, StationBusy).
+	Permit(StationBusy, StationEventRelease, StationIdle).
+	Permit(StationIdle, StationEventBreakdown, StationDown).
+	Permit(StationBusy, StationEventBreakdown, StationDown).
+	Permit(StationDown, StationEventRepair, StationIdle).
+	Permit(StationIdle, StationEventStartService, StationMaintenance).
+	Permit(StationDown, StationEventStartService, StationMaintenance).
+	Permit(StationMaintenance, StationEventEndService, StationIdle).
+	PublishAs(func(stationID string) event.Event {
+		return event.Event{Type: event.StationStatusChanged, StationID: types.StationID(stationID)}
+	}).
+	Build()
+
+// NewStationFSM 创建一个新的工站状态机，初始状态为 IDLE
+func NewStationFSM(stationID string) *StationFSM {
+	return stationLifecycle.New(stationID)
+}
@@ -0,0 +1,151 @@
+// Package gantt 将派工计划和加工履历整理为按工站排列的甘特图数据
+// 计划条来自派工计划 (或按当前出队顺序的估算)，实际条来自事件写入的加工履历，两者对比得到计划与实际的偏差
+package gantt
+
+import (
+	"cmp"
+	"industrial-4.0-demo/internal/history"
+	"industrial-4.0-demo/internal/planner"
+	"industrial-4.0-demo/internal/types"
+	"maps"
+	"slices"
+	"time"
+)
+
+// 计划条的来源
+const (
+	SourcePlan     = "plan"     // 正在执行的派工计划
+	SourceForecast = "forecast" // 没有派工计划时按当前出队顺序估算的预计进度
+)
+
+// Bar 是甘特图上工件在一个工站的一段加工
+type Bar struct {
+	ProductID    string    `json:"product_id"`
+	Type         string    `json:"type"`
+	Namespace    string    `json:"namespace,omitempty"`
+	Step         int       `json:"step"` // 步骤索引
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`                     // 实际加工未结束时为当前时间
+	SetupSeconds float64   `json:"setup_seconds,omitempty"` // 计划中开工前的换型时间
+	Running      bool      `json:"running,omitempty"`       // 实际加工尚未结束
+	Failed       bool      `json:"failed,omitempty"`        // 实际加工失败
+}
+
+// Row 是一个工站的计划加工和实际加工，均按开始时间排序
+type Row struct {
+	StationID types.StationID `json:"station_id"`
+	Planned   []Bar           `json:"planned"`
+	Actual    []Bar           `json:"actual"`
+}
+
+// Drift 是计划内的工件实际开工、完工与计划的偏差，正数表示晚于计划
+type Drift struct {
+	ProductID         string    `json:"product_id"`
+	Namespace         string    `json:"namespace,omitempty"`
+	PlannedStart      time.Time `json:"planned_start"`
+	PlannedEnd        time.Time `json:"planned_end"`
+	ActualStart       time.Time `json:"actual_start"`
+	ActualEnd         time.Time `json:"actual_end,omitzero"` // 尚未结束时为空
+	StartDriftSeconds float64   `json:"start_drift_seconds"`
+	EndDriftSeconds   *float64  `json:"end_drift_seconds,omitempty"` // 尚未结束时为空
+}
+
+// Chart 是时间范围 [From, To] 内的甘特图
+type Chart struct {
+	Window    string    `json:"window"`
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	Source    string    `json:"source"`     // 计划条的来源: plan / forecast
+	PlannedAt time.Time `json:"planned_at"` // 计划或估算的生成时间
+	Stations  []Row     `json:"stations"`   // 按工站 ID 排序，只包含有加工的工站
+	Drift     []Drift   `json:"drift"`      // 已开工的计划内工件，按工件 ID 排序
+}
+
+// Build 组装以 now 为中心、前后各 window 的甘特图
+// 实际条取自 records 中在范围内加工的步骤，计划条取自 plan 中与范围重叠的加工；visible 判断调用方能否看到某个命名空间的工件
+func Build(plan planner.Plan, source string, records []history.Record, window time.Duration, now time.Time, visible func(namespace string) bool) Chart {
+	from, to := now.Add(-window), now.Add(window)
+	chart := Chart{
+		Window:    window.String(),
+		From:      from,
+		To:        to,
+		Source:    source,
+		PlannedAt: plan.CreatedAt,
+		Stations:  []Row{},
+		Drift:     []Drift{},
+	}
+	rows := make(map[types.StationID]*Row)
+	row := func(id types.StationID) *Row {
+		r, ok := rows[id]
+		if !ok {
+			r = &Row{StationID: id, Planned: []Bar{}, Actual: []Bar{}}
+			rows[id] = r
+		}
+		return r
+	}
+
+	actual := make(map[string]history.Record, len(records))
+	for _, rec := range records {
+		if !visible(rec.Namespace) {
+			continue
+		}
+		actual[rec.ProductID] = rec
+		for _, step := range rec.Steps {
+			if step.StartedAt.IsZero() || step.StartedAt.After(to) {
+				continue
+			}
+			bar := Bar{ProductID: rec.ProductID, Type: rec.Type, Namespace: rec.Namespace, Step: step.Step, Start: step.StartedAt, End: step.FinishedAt}
+			if step.FinishedAt.IsZero() {
+				bar.End, bar.Running = now, true
+			} else {
+				bar.Failed = !step.Success
+			}
+			if bar.End.Before(from) {
+				continue
+			}
+			r := row(step.StationID)
+			r.Actual = append(r.Actual, bar)
+		}
+	}
+
+	for _, job := range plan.Jobs {
+		if !visible(job.Namespace) {
+			continue
+		}
+		for _, op := range job.Operations {
+			if op.End.Before(from) || op.Start.After(to) {
+				continue
+			}
+			r := row(op.StationID)
+			r.Planned = append(r.Planned, Bar{ProductID: job.ProductID, Type: job.Type, Namespace: job.Namespace, Step: op.Step, Start: op.Start, End: op.End, SetupSeconds: op.SetupSeconds})
+		}
+		rec, ok := actual[job.ProductID]
+		if !ok || rec.StartedAt.IsZero() {
+			continue
+		}
+		d := Drift{
+			ProductID:         job.ProductID,
+			Namespace:         job.Namespace,
+			PlannedStart:      job.Start,
+			PlannedEnd:        job.End,
+			ActualStart:       rec.StartedAt,
+			ActualEnd:         rec.FinishedAt,
+			StartDriftSeconds: rec.StartedAt.Sub(job.Start).Seconds(),
+		}
+		if !rec.FinishedAt.IsZero() {
+			end := rec.FinishedAt.Sub(job.End).Seconds()
+			d.EndDriftSeconds = &end
+		}
+		chart.Drift = append(chart.Drift, d)
+	}
+
+	byStart := func(a, b Bar) int { return a.Start.Compare(b.Start) }
+	for _, id := range slices.Sorted(maps.Keys(rows)) {
+		r := rows[id]
+		slices.SortStableFunc(r.Planned, byStart)
+		slices.SortStableFunc(r.Actual, byStart)
+		chart.Stations = append(chart.Stations, *r)
+	}
+	slices.SortFunc(chart.Drift, func(a, b Drift) int { return cmp.Compare(a.ProductID, b.ProductID) })
+	return chart
+}
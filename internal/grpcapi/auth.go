@@ -0,0 +1,135 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"industrial-4.0-demo/internal/auth"
+	"industrial-4.0-demo/internal/grpcapi/orchestratorv1"
+	"net"
+	"net/http"
+	"net/url"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// methodRoles 定义每个 RPC 要求的角色，与 HTTP API 中同类接口的要求一致
+var methodRoles = map[string]auth.Role{
+	orchestratorv1.Orchestrator_SubmitTask_FullMethodName:  auth.RoleOperator,
+	orchestratorv1.Orchestrator_CancelTask_FullMethodName:  auth.RoleOperator,
+	orchestratorv1.Orchestrator_GetTask_FullMethodName:     auth.RoleViewer,
+	orchestratorv1.Orchestrator_ListQueue_FullMethodName:   auth.RoleViewer,
+	orchestratorv1.Orchestrator_StreamState_FullMethodName: auth.RoleViewer,
+}
+
+// authorize 认证调用方并校验其角色，返回注入了调用方信息的 Context
+// 凭证与 HTTP API 相同，通过 x-api-key 或 authorization: Bearer <JWT> 元数据传递；未启用认证时直接放行
+func (s *Server) authorize(ctx context.Context, method string) (context.Context, error) {
+	if s.auth == nil {
+		return ctx, nil
+	}
+	principal, err := s.auth.Authenticate(requestFromMetadata(ctx))
+	if err != nil {
+		code, reason := codes.Unauthenticated, "invalid"
+		switch {
+		case errors.Is(err, auth.ErrNoCredentials):
+			reason = "missing"
+		case errors.Is(err, auth.ErrForbidden):
+			code, reason = codes.PermissionDenied, "forbidden"
+		}
+		s.metrics.AuthFailuresTotal.WithLabelValues(reason).Inc()
+		s.logger.Warn("gRPC 认证失败", "error", err, "method", method)
+		return nil, status.Error(code, err.Error())
+	}
+	if required, ok := methodRoles[method]; ok && !principal.HasRole(required) {
+		s.metrics.AuthFailuresTotal.WithLabelValues("forbidden").Inc()
+		s.logger.Warn("gRPC 调用方权限不足", "subject", principal.Subject, "method", method, "required_role", required)
+		return nil, status.Errorf(codes.PermissionDenied, "role %s required", required)
+	}
+	return auth.ContextWithPrincipal(ctx, principal), nil
+}
+
+// requestFromMetadata 将 gRPC 元数据转换为 HTTP 请求，以复用 HTTP API 的认证器
+func requestFromMetadata(ctx context.Context) *http.Request {
+	r := &http.Request{Header: make(http.Header), URL: &url.URL{}}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, name := range []string{"X-API-Key", "Authorization"} {
+		if values := md.Get(name); len(values) > 0 {
+			r.Header.Set(name, values[0])
+		}
+	}
+	r.RemoteAddr = remoteAddr(ctx)
+	return r.WithContext(ctx)
+}
+
+// leaderMethods 是只能由集群领导者处理的 RPC
+var leaderMethods = map[string]bool{
+	orchestratorv1.Orchestrator_SubmitTask_FullMethodName: true,
+	orchestratorv1.Orchestrator_CancelTask_FullMethodName: true,
+}
+
+// checkLeader 在本节点是集群跟随者时拒绝会修改任务的 RPC，客户端应改为调用错误信息中的领导者
+func (s *Server) checkLeader(method string) error {
+	if s.cluster == nil || !leaderMethods[method] || s.cluster.IsLeader() {
+		return nil
+	}
+	leader := s.cluster.Status()
+	if leader.Leader == "" {
+		return status.Error(codes.Unavailable, "not the cluster leader, leader is unknown")
+	}
+	return status.Errorf(codes.Unavailable, "not the cluster leader, leader is %s (%s)", leader.Leader, leader.LeaderURL)
+}
+
+// unaryInterceptor 为普通 RPC 加上认证和角色校验，集群跟随者拒绝会修改任务的 RPC
+func (s *Server) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := s.authorize(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkLeader(info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// streamInterceptor 为流式 RPC 加上认证和角色校验
+func (s *Server) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authorize(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authorizedStream{ServerStream: ss, ctx: ctx})
+}
+
+// authorizedStream 替换流的 Context，使处理函数可以读取调用方信息
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authorizedStream) Context() context.Context {
+	return s.ctx
+}
+
+// clientKey 返回限流使用的调用方标识，与 HTTP API 的规则一致：已认证时使用调用方身份，否则使用客户端 IP
+func clientKey(ctx context.Context) string {
+	if p, ok := auth.PrincipalFromContext(ctx); ok {
+		return p.Method + ":" + p.Subject
+	}
+	host := remoteAddr(ctx)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return "ip:" + host
+}
+
+// remoteAddr 返回调用方的网络地址
+func remoteAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok {
+		return p.Addr.String()
+	}
+	return "unknown"
+}
@@ -0,0 +1,166 @@
+package grpcapi
+
+import (
+	"industrial-4.0-demo/internal/grpcapi/orchestratorv1"
+	"industrial-4.0-demo/internal/history"
+	"industrial-4.0-demo/internal/types"
+	"industrial-4.0-demo/internal/web"
+	"log/slog"
+	"sort"
+	"time"
+
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// productFromProto 将请求中的工件转换为调度器使用的工件
+func productFromProto(p *orchestratorv1.Product) *types.Product {
+	return &types.Product{
+		ID:        p.GetId(),
+		Type:      p.GetType(),
+		Priority:  int(p.GetPriority()),
+		Attrs:     p.GetAttrs().AsMap(),
+		RetryOf:   p.GetRetryOf(),
+		Namespace: p.GetNamespace(),
+	}
+}
+
+// attrsToProto 将工件的动态属性转换为 Struct，无法表示的属性会被忽略
+func attrsToProto(attrs map[string]interface{}) *structpb.Struct {
+	if len(attrs) == 0 {
+		return nil
+	}
+	s, err := structpb.NewStruct(attrs)
+	if err != nil {
+		slog.Warn("工件属性无法转换为 protobuf Struct", "error", err)
+		return nil
+	}
+	return s
+}
+
+// timestampToProto 转换时间，零值时间转换为空
+func timestampToProto(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+// stepToProto 转换一条步骤履历，尚未结束的步骤没有结果
+func stepToProto(productID string, s history.StepRecord) *orchestratorv1.Step {
+	step := &orchestratorv1.Step{
+		Step:            int32(s.Step),
+		StationId:       string(s.StationID),
+		StartedAt:       timestampToProto(s.StartedAt),
+		FinishedAt:      timestampToProto(s.FinishedAt),
+		DurationSeconds: s.DurationSeconds,
+	}
+	if !s.FinishedAt.IsZero() {
+		step.Result = &orchestratorv1.Result{ProductId: productID, Success: s.Success, Error: s.Error}
+	}
+	return step
+}
+
+// productStateToProto 转换工件的实时状态
+func productStateToProto(p web.ProductState) *orchestratorv1.ProductState {
+	return &orchestratorv1.ProductState{
+		Id:        p.ID,
+		Type:      p.Type,
+		Priority:  int32(p.Priority),
+		StationId: string(p.Station),
+		Status:    p.Status,
+		Lifecycle: p.Lifecycle,
+		RetryOf:   p.RetryOf,
+		Attrs:     attrsToProto(p.Attrs),
+		Namespace: p.Namespace,
+	}
+}
+
+// stationStateToProto 转换工站的实时状态
+func stationStateToProto(s web.StationStatus) *orchestratorv1.StationState {
+	return &orchestratorv1.StationState{
+		Id:          string(s.ID),
+		Status:      s.Status,
+		Products:    s.Products,
+		QueueLength: int32(s.QueueLength),
+		Utilization: s.Utilization,
+		Health:      s.Health,
+	}
+}
+
+// poolStateToProto 转换资源池的占用情况
+func poolStateToProto(p web.PoolStatus) *orchestratorv1.PoolState {
+	return &orchestratorv1.PoolState{
+		StationId: string(p.ID),
+		Capacity:  int32(p.Capacity),
+		InUse:     int32(p.InUse),
+		Waiting:   int32(p.Waiting),
+	}
+}
+
+// schedulerToProto 转换调度器状态，state 为 nil 时返回 nil
+func schedulerToProto(state *web.SchedulerState) *orchestratorv1.SchedulerState {
+	if state == nil {
+		return nil
+	}
+	s := &orchestratorv1.SchedulerState{
+		Status:      state.Status,
+		Workers:     int32(state.Workers),
+		BusyWorkers: int32(state.BusyWorkers),
+		Occupancy:   state.Occupancy,
+	}
+	for _, e := range state.Queue {
+		s.Queue = append(s.Queue, &orchestratorv1.QueueEntry{
+			Position:  int32(e.Position),
+			ProductId: e.ProductID,
+			Type:      e.Type,
+			Priority:  int32(e.Priority),
+			Namespace: e.Namespace,
+		})
+	}
+	for _, w := range state.InFlight {
+		s.InFlight = append(s.InFlight, &orchestratorv1.WorkerState{
+			Worker:    int32(w.Worker),
+			ProductId: w.ProductID,
+			StartedAt: timestampToProto(w.StartedAt),
+			Namespace: w.Namespace,
+		})
+	}
+	return s
+}
+
+// updateToProto 将 Hub 推送的消息转换为 StateUpdate，快照中的工件、工站和资源池按 ID 排序
+func updateToProto(msg web.Message) *orchestratorv1.StateUpdate {
+	u := &orchestratorv1.StateUpdate{Seq: msg.Seq}
+	switch msg.Type {
+	case web.MessageSnapshot:
+		snapshot := &orchestratorv1.Snapshot{}
+		if msg.State != nil {
+			for _, p := range msg.State.Products {
+				snapshot.Products = append(snapshot.Products, productStateToProto(p))
+			}
+			sort.Slice(snapshot.Products, func(i, j int) bool { return snapshot.Products[i].Id < snapshot.Products[j].Id })
+			for _, s := range msg.State.Stations {
+				snapshot.Stations = append(snapshot.Stations, stationStateToProto(s))
+			}
+			sort.Slice(snapshot.Stations, func(i, j int) bool { return snapshot.Stations[i].Id < snapshot.Stations[j].Id })
+			for _, p := range msg.State.Pools {
+				snapshot.Pools = append(snapshot.Pools, poolStateToProto(p))
+			}
+			sort.Slice(snapshot.Pools, func(i, j int) bool { return snapshot.Pools[i].StationId < snapshot.Pools[j].StationId })
+			snapshot.Scheduler = schedulerToProto(msg.State.Scheduler)
+		}
+		u.Update = &orchestratorv1.StateUpdate_Snapshot{Snapshot: snapshot}
+	case web.MessagePatch:
+		u.Update = &orchestratorv1.StateUpdate_Product{Product: productStateToProto(*msg.Product)}
+	case web.MessageRemove:
+		u.Update = &orchestratorv1.StateUpdate_RemovedProductId{RemovedProductId: msg.ProductID}
+	case web.MessageStation:
+		u.Update = &orchestratorv1.StateUpdate_Station{Station: stationStateToProto(*msg.Station)}
+	case web.MessageScheduler:
+		u.Update = &orchestratorv1.StateUpdate_Scheduler{Scheduler: schedulerToProto(msg.Scheduler)}
+	case web.MessagePool:
+		u.Update = &orchestratorv1.StateUpdate_Pool{Pool: poolStateToProto(*msg.Pool)}
+	}
+	return u
+}
@@ -0,0 +1,1770 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: orchestrator/v1/orchestrator.proto
+
+// 编排器的 gRPC 接口，供其他后端服务以强类型方式提交任务、查询任务并订阅实时状态
+
+package orchestratorv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Product 是生产线上的工件 (PCB 板)
+type Product struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Type          string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`                      // 产品类型: PCB_DOUBLE_LAYER, PCB_MULTILAYER, PCB_PROTOTYPE
+	Priority      int32                  `protobuf:"varint,3,opt,name=priority,proto3" json:"priority,omitempty"`             // 数值越大优先级越高
+	Attrs         *structpb.Struct       `protobuf:"bytes,4,opt,name=attrs,proto3" json:"attrs,omitempty"`                    // 动态属性，用于规则引擎决策
+	RetryOf       string                 `protobuf:"bytes,5,opt,name=retry_of,json=retryOf,proto3" json:"retry_of,omitempty"` // 重试来源的工件 ID
+	Namespace     string                 `protobuf:"bytes,6,opt,name=namespace,proto3" json:"namespace,omitempty"`            // 所属的命名空间 (产线)，提交时为空则使用调用方绑定的第一个命名空间或 default
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Product) Reset() {
+	*x = Product{}
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Product) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Product) ProtoMessage() {}
+
+func (x *Product) ProtoReflect() protoreflect.Message {
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Product.ProtoReflect.Descriptor instead.
+func (*Product) Descriptor() ([]byte, []int) {
+	return file_orchestrator_v1_orchestrator_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Product) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Product) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Product) GetPriority() int32 {
+	if x != nil {
+		return x.Priority
+	}
+	return 0
+}
+
+func (x *Product) GetAttrs() *structpb.Struct {
+	if x != nil {
+		return x.Attrs
+	}
+	return nil
+}
+
+func (x *Product) GetRetryOf() string {
+	if x != nil {
+		return x.RetryOf
+	}
+	return ""
+}
+
+func (x *Product) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+// Result 是工站任务或整个生产过程的执行结果
+type Result struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ProductId     string                 `protobuf:"bytes,1,opt,name=product_id,json=productId,proto3" json:"product_id,omitempty"`
+	Success       bool                   `protobuf:"varint,2,opt,name=success,proto3" json:"success,omitempty"`
+	Error         string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"` // 失败原因
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Result) Reset() {
+	*x = Result{}
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Result) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Result) ProtoMessage() {}
+
+func (x *Result) ProtoReflect() protoreflect.Message {
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Result.ProtoReflect.Descriptor instead.
+func (*Result) Descriptor() ([]byte, []int) {
+	return file_orchestrator_v1_orchestrator_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Result) GetProductId() string {
+	if x != nil {
+		return x.ProductId
+	}
+	return ""
+}
+
+func (x *Result) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *Result) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type SubmitTaskRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Product       *Product               `protobuf:"bytes,1,opt,name=product,proto3" json:"product,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitTaskRequest) Reset() {
+	*x = SubmitTaskRequest{}
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitTaskRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitTaskRequest) ProtoMessage() {}
+
+func (x *SubmitTaskRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitTaskRequest.ProtoReflect.Descriptor instead.
+func (*SubmitTaskRequest) Descriptor() ([]byte, []int) {
+	return file_orchestrator_v1_orchestrator_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SubmitTaskRequest) GetProduct() *Product {
+	if x != nil {
+		return x.Product
+	}
+	return nil
+}
+
+type SubmitTaskResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Status        string                 `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`       // 固定为 accepted
+	Namespace     string                 `protobuf:"bytes,3,opt,name=namespace,proto3" json:"namespace,omitempty"` // 任务最终所属的命名空间
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitTaskResponse) Reset() {
+	*x = SubmitTaskResponse{}
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitTaskResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitTaskResponse) ProtoMessage() {}
+
+func (x *SubmitTaskResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitTaskResponse.ProtoReflect.Descriptor instead.
+func (*SubmitTaskResponse) Descriptor() ([]byte, []int) {
+	return file_orchestrator_v1_orchestrator_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *SubmitTaskResponse) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *SubmitTaskResponse) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *SubmitTaskResponse) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+type GetTaskRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetTaskRequest) Reset() {
+	*x = GetTaskRequest{}
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetTaskRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetTaskRequest) ProtoMessage() {}
+
+func (x *GetTaskRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetTaskRequest.ProtoReflect.Descriptor instead.
+func (*GetTaskRequest) Descriptor() ([]byte, []int) {
+	return file_orchestrator_v1_orchestrator_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *GetTaskRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+// Task 合并了工件的实时状态和加工履历
+type Task struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Product       *Product               `protobuf:"bytes,1,opt,name=product,proto3" json:"product,omitempty"`
+	StationId     string                 `protobuf:"bytes,2,opt,name=station_id,json=stationId,proto3" json:"station_id,omitempty"` // 当前所在工站
+	Status        string                 `protobuf:"bytes,3,opt,name=status,proto3" json:"status,omitempty"`                        // 状态机的当前状态，实时状态已清理时为最终结果
+	Lifecycle     string                 `protobuf:"bytes,4,opt,name=lifecycle,proto3" json:"lifecycle,omitempty"`
+	TraceId       string                 `protobuf:"bytes,5,opt,name=trace_id,json=traceId,proto3" json:"trace_id,omitempty"`
+	Steps         []*Step                `protobuf:"bytes,6,rep,name=steps,proto3" json:"steps,omitempty"` // 按步骤排序的加工履历
+	Compensations []*Compensation        `protobuf:"bytes,7,rep,name=compensations,proto3" json:"compensations,omitempty"`
+	Outcome       string                 `protobuf:"bytes,8,opt,name=outcome,proto3" json:"outcome,omitempty"` // 最终结果: COMPLETED / FAILED / COMPENSATED，未结束时为空
+	Result        *Result                `protobuf:"bytes,9,opt,name=result,proto3" json:"result,omitempty"`   // 生产结束后的结果，未结束时为空
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Task) Reset() {
+	*x = Task{}
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Task) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Task) ProtoMessage() {}
+
+func (x *Task) ProtoReflect() protoreflect.Message {
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Task.ProtoReflect.Descriptor instead.
+func (*Task) Descriptor() ([]byte, []int) {
+	return file_orchestrator_v1_orchestrator_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Task) GetProduct() *Product {
+	if x != nil {
+		return x.Product
+	}
+	return nil
+}
+
+func (x *Task) GetStationId() string {
+	if x != nil {
+		return x.StationId
+	}
+	return ""
+}
+
+func (x *Task) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Task) GetLifecycle() string {
+	if x != nil {
+		return x.Lifecycle
+	}
+	return ""
+}
+
+func (x *Task) GetTraceId() string {
+	if x != nil {
+		return x.TraceId
+	}
+	return ""
+}
+
+func (x *Task) GetSteps() []*Step {
+	if x != nil {
+		return x.Steps
+	}
+	return nil
+}
+
+func (x *Task) GetCompensations() []*Compensation {
+	if x != nil {
+		return x.Compensations
+	}
+	return nil
+}
+
+func (x *Task) GetOutcome() string {
+	if x != nil {
+		return x.Outcome
+	}
+	return ""
+}
+
+func (x *Task) GetResult() *Result {
+	if x != nil {
+		return x.Result
+	}
+	return nil
+}
+
+// Step 是工件在某个工站上的一次加工
+type Step struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Step            int32                  `protobuf:"varint,1,opt,name=step,proto3" json:"step,omitempty"`
+	StationId       string                 `protobuf:"bytes,2,opt,name=station_id,json=stationId,proto3" json:"station_id,omitempty"`
+	StartedAt       *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=started_at,json=startedAt,proto3" json:"started_at,omitempty"`
+	FinishedAt      *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=finished_at,json=finishedAt,proto3" json:"finished_at,omitempty"` // 未结束时为空
+	DurationSeconds float64                `protobuf:"fixed64,5,opt,name=duration_seconds,json=durationSeconds,proto3" json:"duration_seconds,omitempty"`
+	Result          *Result                `protobuf:"bytes,6,opt,name=result,proto3" json:"result,omitempty"` // 未结束时为空
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *Step) Reset() {
+	*x = Step{}
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Step) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Step) ProtoMessage() {}
+
+func (x *Step) ProtoReflect() protoreflect.Message {
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Step.ProtoReflect.Descriptor instead.
+func (*Step) Descriptor() ([]byte, []int) {
+	return file_orchestrator_v1_orchestrator_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Step) GetStep() int32 {
+	if x != nil {
+		return x.Step
+	}
+	return 0
+}
+
+func (x *Step) GetStationId() string {
+	if x != nil {
+		return x.StationId
+	}
+	return ""
+}
+
+func (x *Step) GetStartedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartedAt
+	}
+	return nil
+}
+
+func (x *Step) GetFinishedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.FinishedAt
+	}
+	return nil
+}
+
+func (x *Step) GetDurationSeconds() float64 {
+	if x != nil {
+		return x.DurationSeconds
+	}
+	return 0
+}
+
+func (x *Step) GetResult() *Result {
+	if x != nil {
+		return x.Result
+	}
+	return nil
+}
+
+type Compensation struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	StationId     string                 `protobuf:"bytes,1,opt,name=station_id,json=stationId,proto3" json:"station_id,omitempty"`
+	At            *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=at,proto3" json:"at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Compensation) Reset() {
+	*x = Compensation{}
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Compensation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Compensation) ProtoMessage() {}
+
+func (x *Compensation) ProtoReflect() protoreflect.Message {
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Compensation.ProtoReflect.Descriptor instead.
+func (*Compensation) Descriptor() ([]byte, []int) {
+	return file_orchestrator_v1_orchestrator_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Compensation) GetStationId() string {
+	if x != nil {
+		return x.StationId
+	}
+	return ""
+}
+
+func (x *Compensation) GetAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.At
+	}
+	return nil
+}
+
+type CancelTaskRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CancelTaskRequest) Reset() {
+	*x = CancelTaskRequest{}
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CancelTaskRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CancelTaskRequest) ProtoMessage() {}
+
+func (x *CancelTaskRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CancelTaskRequest.ProtoReflect.Descriptor instead.
+func (*CancelTaskRequest) Descriptor() ([]byte, []int) {
+	return file_orchestrator_v1_orchestrator_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *CancelTaskRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type CancelTaskResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Status        string                 `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"` // 固定为 cancelling
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CancelTaskResponse) Reset() {
+	*x = CancelTaskResponse{}
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CancelTaskResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CancelTaskResponse) ProtoMessage() {}
+
+func (x *CancelTaskResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CancelTaskResponse.ProtoReflect.Descriptor instead.
+func (*CancelTaskResponse) Descriptor() ([]byte, []int) {
+	return file_orchestrator_v1_orchestrator_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *CancelTaskResponse) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *CancelTaskResponse) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+type ListQueueRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListQueueRequest) Reset() {
+	*x = ListQueueRequest{}
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListQueueRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListQueueRequest) ProtoMessage() {}
+
+func (x *ListQueueRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListQueueRequest.ProtoReflect.Descriptor instead.
+func (*ListQueueRequest) Descriptor() ([]byte, []int) {
+	return file_orchestrator_v1_orchestrator_proto_rawDescGZIP(), []int{10}
+}
+
+type ListQueueResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Scheduler     *SchedulerState        `protobuf:"bytes,1,opt,name=scheduler,proto3" json:"scheduler,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListQueueResponse) Reset() {
+	*x = ListQueueResponse{}
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListQueueResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListQueueResponse) ProtoMessage() {}
+
+func (x *ListQueueResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListQueueResponse.ProtoReflect.Descriptor instead.
+func (*ListQueueResponse) Descriptor() ([]byte, []int) {
+	return file_orchestrator_v1_orchestrator_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *ListQueueResponse) GetScheduler() *SchedulerState {
+	if x != nil {
+		return x.Scheduler
+	}
+	return nil
+}
+
+// StreamStateRequest 是订阅条件，各条件之间为"与"关系，空条件表示不限制
+type StreamStateRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ProductIds    []string               `protobuf:"bytes,1,rep,name=product_ids,json=productIds,proto3" json:"product_ids,omitempty"`
+	ProductTypes  []string               `protobuf:"bytes,2,rep,name=product_types,json=productTypes,proto3" json:"product_types,omitempty"`
+	Stations      []string               `protobuf:"bytes,3,rep,name=stations,proto3" json:"stations,omitempty"`
+	Namespaces    []string               `protobuf:"bytes,4,rep,name=namespaces,proto3" json:"namespaces,omitempty"` // 只推送这些命名空间的工件，调用方绑定了命名空间时被限制在其中
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamStateRequest) Reset() {
+	*x = StreamStateRequest{}
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamStateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamStateRequest) ProtoMessage() {}
+
+func (x *StreamStateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamStateRequest.ProtoReflect.Descriptor instead.
+func (*StreamStateRequest) Descriptor() ([]byte, []int) {
+	return file_orchestrator_v1_orchestrator_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *StreamStateRequest) GetProductIds() []string {
+	if x != nil {
+		return x.ProductIds
+	}
+	return nil
+}
+
+func (x *StreamStateRequest) GetProductTypes() []string {
+	if x != nil {
+		return x.ProductTypes
+	}
+	return nil
+}
+
+func (x *StreamStateRequest) GetStations() []string {
+	if x != nil {
+		return x.Stations
+	}
+	return nil
+}
+
+func (x *StreamStateRequest) GetNamespaces() []string {
+	if x != nil {
+		return x.Namespaces
+	}
+	return nil
+}
+
+// StateUpdate 是一条状态推送，seq 单调递增，客户端应按工件丢弃 seq 不大于已应用值的更新
+type StateUpdate struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Seq   uint64                 `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"`
+	// Types that are valid to be assigned to Update:
+	//
+	//	*StateUpdate_Snapshot
+	//	*StateUpdate_Product
+	//	*StateUpdate_RemovedProductId
+	//	*StateUpdate_Station
+	//	*StateUpdate_Scheduler
+	//	*StateUpdate_Pool
+	Update        isStateUpdate_Update `protobuf_oneof:"update"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StateUpdate) Reset() {
+	*x = StateUpdate{}
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StateUpdate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StateUpdate) ProtoMessage() {}
+
+func (x *StateUpdate) ProtoReflect() protoreflect.Message {
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StateUpdate.ProtoReflect.Descriptor instead.
+func (*StateUpdate) Descriptor() ([]byte, []int) {
+	return file_orchestrator_v1_orchestrator_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *StateUpdate) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *StateUpdate) GetUpdate() isStateUpdate_Update {
+	if x != nil {
+		return x.Update
+	}
+	return nil
+}
+
+func (x *StateUpdate) GetSnapshot() *Snapshot {
+	if x != nil {
+		if x, ok := x.Update.(*StateUpdate_Snapshot); ok {
+			return x.Snapshot
+		}
+	}
+	return nil
+}
+
+func (x *StateUpdate) GetProduct() *ProductState {
+	if x != nil {
+		if x, ok := x.Update.(*StateUpdate_Product); ok {
+			return x.Product
+		}
+	}
+	return nil
+}
+
+func (x *StateUpdate) GetRemovedProductId() string {
+	if x != nil {
+		if x, ok := x.Update.(*StateUpdate_RemovedProductId); ok {
+			return x.RemovedProductId
+		}
+	}
+	return ""
+}
+
+func (x *StateUpdate) GetStation() *StationState {
+	if x != nil {
+		if x, ok := x.Update.(*StateUpdate_Station); ok {
+			return x.Station
+		}
+	}
+	return nil
+}
+
+func (x *StateUpdate) GetScheduler() *SchedulerState {
+	if x != nil {
+		if x, ok := x.Update.(*StateUpdate_Scheduler); ok {
+			return x.Scheduler
+		}
+	}
+	return nil
+}
+
+func (x *StateUpdate) GetPool() *PoolState {
+	if x != nil {
+		if x, ok := x.Update.(*StateUpdate_Pool); ok {
+			return x.Pool
+		}
+	}
+	return nil
+}
+
+type isStateUpdate_Update interface {
+	isStateUpdate_Update()
+}
+
+type StateUpdate_Snapshot struct {
+	Snapshot *Snapshot `protobuf:"bytes,2,opt,name=snapshot,proto3,oneof"` // 订阅后的第一条消息
+}
+
+type StateUpdate_Product struct {
+	Product *ProductState `protobuf:"bytes,3,opt,name=product,proto3,oneof"` // 单个工件的完整最新状态
+}
+
+type StateUpdate_RemovedProductId struct {
+	RemovedProductId string `protobuf:"bytes,4,opt,name=removed_product_id,json=removedProductId,proto3,oneof"` // 已结束的工件超过保留时间被移除
+}
+
+type StateUpdate_Station struct {
+	Station *StationState `protobuf:"bytes,5,opt,name=station,proto3,oneof"` // 单个工站的完整最新状态
+}
+
+type StateUpdate_Scheduler struct {
+	Scheduler *SchedulerState `protobuf:"bytes,6,opt,name=scheduler,proto3,oneof"` // 调度器的完整最新状态
+}
+
+type StateUpdate_Pool struct {
+	Pool *PoolState `protobuf:"bytes,7,opt,name=pool,proto3,oneof"` // 单个资源池的完整最新状态
+}
+
+func (*StateUpdate_Snapshot) isStateUpdate_Update() {}
+
+func (*StateUpdate_Product) isStateUpdate_Update() {}
+
+func (*StateUpdate_RemovedProductId) isStateUpdate_Update() {}
+
+func (*StateUpdate_Station) isStateUpdate_Update() {}
+
+func (*StateUpdate_Scheduler) isStateUpdate_Update() {}
+
+func (*StateUpdate_Pool) isStateUpdate_Update() {}
+
+type Snapshot struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Products      []*ProductState        `protobuf:"bytes,1,rep,name=products,proto3" json:"products,omitempty"`
+	Stations      []*StationState        `protobuf:"bytes,2,rep,name=stations,proto3" json:"stations,omitempty"`
+	Scheduler     *SchedulerState        `protobuf:"bytes,3,opt,name=scheduler,proto3" json:"scheduler,omitempty"` // 调度器尚未上报状态时为空
+	Pools         []*PoolState           `protobuf:"bytes,4,rep,name=pools,proto3" json:"pools,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Snapshot) Reset() {
+	*x = Snapshot{}
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Snapshot) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Snapshot) ProtoMessage() {}
+
+func (x *Snapshot) ProtoReflect() protoreflect.Message {
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Snapshot.ProtoReflect.Descriptor instead.
+func (*Snapshot) Descriptor() ([]byte, []int) {
+	return file_orchestrator_v1_orchestrator_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *Snapshot) GetProducts() []*ProductState {
+	if x != nil {
+		return x.Products
+	}
+	return nil
+}
+
+func (x *Snapshot) GetStations() []*StationState {
+	if x != nil {
+		return x.Stations
+	}
+	return nil
+}
+
+func (x *Snapshot) GetScheduler() *SchedulerState {
+	if x != nil {
+		return x.Scheduler
+	}
+	return nil
+}
+
+func (x *Snapshot) GetPools() []*PoolState {
+	if x != nil {
+		return x.Pools
+	}
+	return nil
+}
+
+type ProductState struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Type          string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	Priority      int32                  `protobuf:"varint,3,opt,name=priority,proto3" json:"priority,omitempty"`
+	StationId     string                 `protobuf:"bytes,4,opt,name=station_id,json=stationId,proto3" json:"station_id,omitempty"`
+	Status        string                 `protobuf:"bytes,5,opt,name=status,proto3" json:"status,omitempty"`
+	Lifecycle     string                 `protobuf:"bytes,6,opt,name=lifecycle,proto3" json:"lifecycle,omitempty"`
+	RetryOf       string                 `protobuf:"bytes,7,opt,name=retry_of,json=retryOf,proto3" json:"retry_of,omitempty"`
+	Attrs         *structpb.Struct       `protobuf:"bytes,8,opt,name=attrs,proto3" json:"attrs,omitempty"`
+	Namespace     string                 `protobuf:"bytes,9,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ProductState) Reset() {
+	*x = ProductState{}
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ProductState) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProductState) ProtoMessage() {}
+
+func (x *ProductState) ProtoReflect() protoreflect.Message {
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProductState.ProtoReflect.Descriptor instead.
+func (*ProductState) Descriptor() ([]byte, []int) {
+	return file_orchestrator_v1_orchestrator_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *ProductState) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *ProductState) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *ProductState) GetPriority() int32 {
+	if x != nil {
+		return x.Priority
+	}
+	return 0
+}
+
+func (x *ProductState) GetStationId() string {
+	if x != nil {
+		return x.StationId
+	}
+	return ""
+}
+
+func (x *ProductState) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *ProductState) GetLifecycle() string {
+	if x != nil {
+		return x.Lifecycle
+	}
+	return ""
+}
+
+func (x *ProductState) GetRetryOf() string {
+	if x != nil {
+		return x.RetryOf
+	}
+	return ""
+}
+
+func (x *ProductState) GetAttrs() *structpb.Struct {
+	if x != nil {
+		return x.Attrs
+	}
+	return nil
+}
+
+func (x *ProductState) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+type StationState struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Status        string                 `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`     // IDLE / BUSY / DOWN / MAINTENANCE
+	Products      []string               `protobuf:"bytes,3,rep,name=products,proto3" json:"products,omitempty"` // 正在加工的工件
+	QueueLength   int32                  `protobuf:"varint,4,opt,name=queue_length,json=queueLength,proto3" json:"queue_length,omitempty"`
+	Utilization   float64                `protobuf:"fixed64,5,opt,name=utilization,proto3" json:"utilization,omitempty"` // BUSY 时间占比 (%)
+	Health        string                 `protobuf:"bytes,6,opt,name=health,proto3" json:"health,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StationState) Reset() {
+	*x = StationState{}
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StationState) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StationState) ProtoMessage() {}
+
+func (x *StationState) ProtoReflect() protoreflect.Message {
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StationState.ProtoReflect.Descriptor instead.
+func (*StationState) Descriptor() ([]byte, []int) {
+	return file_orchestrator_v1_orchestrator_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *StationState) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *StationState) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *StationState) GetProducts() []string {
+	if x != nil {
+		return x.Products
+	}
+	return nil
+}
+
+func (x *StationState) GetQueueLength() int32 {
+	if x != nil {
+		return x.QueueLength
+	}
+	return 0
+}
+
+func (x *StationState) GetUtilization() float64 {
+	if x != nil {
+		return x.Utilization
+	}
+	return 0
+}
+
+func (x *StationState) GetHealth() string {
+	if x != nil {
+		return x.Health
+	}
+	return ""
+}
+
+// PoolState 是工站资源池的占用情况
+type PoolState struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	StationId     string                 `protobuf:"bytes,1,opt,name=station_id,json=stationId,proto3" json:"station_id,omitempty"`
+	Capacity      int32                  `protobuf:"varint,2,opt,name=capacity,proto3" json:"capacity,omitempty"`
+	InUse         int32                  `protobuf:"varint,3,opt,name=in_use,json=inUse,proto3" json:"in_use,omitempty"` // 已占用的资源凭证数
+	Waiting       int32                  `protobuf:"varint,4,opt,name=waiting,proto3" json:"waiting,omitempty"`          // 等待资源凭证的工件数
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PoolState) Reset() {
+	*x = PoolState{}
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PoolState) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PoolState) ProtoMessage() {}
+
+func (x *PoolState) ProtoReflect() protoreflect.Message {
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PoolState.ProtoReflect.Descriptor instead.
+func (*PoolState) Descriptor() ([]byte, []int) {
+	return file_orchestrator_v1_orchestrator_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *PoolState) GetStationId() string {
+	if x != nil {
+		return x.StationId
+	}
+	return ""
+}
+
+func (x *PoolState) GetCapacity() int32 {
+	if x != nil {
+		return x.Capacity
+	}
+	return 0
+}
+
+func (x *PoolState) GetInUse() int32 {
+	if x != nil {
+		return x.InUse
+	}
+	return 0
+}
+
+func (x *PoolState) GetWaiting() int32 {
+	if x != nil {
+		return x.Waiting
+	}
+	return 0
+}
+
+type SchedulerState struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Status        string                 `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"` // running / draining / paused
+	Workers       int32                  `protobuf:"varint,2,opt,name=workers,proto3" json:"workers,omitempty"`
+	BusyWorkers   int32                  `protobuf:"varint,3,opt,name=busy_workers,json=busyWorkers,proto3" json:"busy_workers,omitempty"`
+	Occupancy     float64                `protobuf:"fixed64,4,opt,name=occupancy,proto3" json:"occupancy,omitempty"` // worker 占用率 (%)
+	Queue         []*QueueEntry          `protobuf:"bytes,5,rep,name=queue,proto3" json:"queue,omitempty"`           // 按出队顺序排列
+	InFlight      []*WorkerState         `protobuf:"bytes,6,rep,name=in_flight,json=inFlight,proto3" json:"in_flight,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SchedulerState) Reset() {
+	*x = SchedulerState{}
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SchedulerState) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SchedulerState) ProtoMessage() {}
+
+func (x *SchedulerState) ProtoReflect() protoreflect.Message {
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SchedulerState.ProtoReflect.Descriptor instead.
+func (*SchedulerState) Descriptor() ([]byte, []int) {
+	return file_orchestrator_v1_orchestrator_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *SchedulerState) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *SchedulerState) GetWorkers() int32 {
+	if x != nil {
+		return x.Workers
+	}
+	return 0
+}
+
+func (x *SchedulerState) GetBusyWorkers() int32 {
+	if x != nil {
+		return x.BusyWorkers
+	}
+	return 0
+}
+
+func (x *SchedulerState) GetOccupancy() float64 {
+	if x != nil {
+		return x.Occupancy
+	}
+	return 0
+}
+
+func (x *SchedulerState) GetQueue() []*QueueEntry {
+	if x != nil {
+		return x.Queue
+	}
+	return nil
+}
+
+func (x *SchedulerState) GetInFlight() []*WorkerState {
+	if x != nil {
+		return x.InFlight
+	}
+	return nil
+}
+
+type QueueEntry struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Position      int32                  `protobuf:"varint,1,opt,name=position,proto3" json:"position,omitempty"` // 出队顺序，从 1 开始
+	ProductId     string                 `protobuf:"bytes,2,opt,name=product_id,json=productId,proto3" json:"product_id,omitempty"`
+	Type          string                 `protobuf:"bytes,3,opt,name=type,proto3" json:"type,omitempty"`
+	Priority      int32                  `protobuf:"varint,4,opt,name=priority,proto3" json:"priority,omitempty"`
+	Namespace     string                 `protobuf:"bytes,5,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueueEntry) Reset() {
+	*x = QueueEntry{}
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueueEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueueEntry) ProtoMessage() {}
+
+func (x *QueueEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueueEntry.ProtoReflect.Descriptor instead.
+func (*QueueEntry) Descriptor() ([]byte, []int) {
+	return file_orchestrator_v1_orchestrator_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *QueueEntry) GetPosition() int32 {
+	if x != nil {
+		return x.Position
+	}
+	return 0
+}
+
+func (x *QueueEntry) GetProductId() string {
+	if x != nil {
+		return x.ProductId
+	}
+	return ""
+}
+
+func (x *QueueEntry) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *QueueEntry) GetPriority() int32 {
+	if x != nil {
+		return x.Priority
+	}
+	return 0
+}
+
+func (x *QueueEntry) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+type WorkerState struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Worker        int32                  `protobuf:"varint,1,opt,name=worker,proto3" json:"worker,omitempty"`
+	ProductId     string                 `protobuf:"bytes,2,opt,name=product_id,json=productId,proto3" json:"product_id,omitempty"` // 空闲时为空
+	StartedAt     *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=started_at,json=startedAt,proto3" json:"started_at,omitempty"`
+	Namespace     string                 `protobuf:"bytes,4,opt,name=namespace,proto3" json:"namespace,omitempty"` // 正在执行的任务所属的命名空间
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WorkerState) Reset() {
+	*x = WorkerState{}
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WorkerState) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WorkerState) ProtoMessage() {}
+
+func (x *WorkerState) ProtoReflect() protoreflect.Message {
+	mi := &file_orchestrator_v1_orchestrator_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WorkerState.ProtoReflect.Descriptor instead.
+func (*WorkerState) Descriptor() ([]byte, []int) {
+	return file_orchestrator_v1_orchestrator_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *WorkerState) GetWorker() int32 {
+	if x != nil {
+		return x.Worker
+	}
+	return 0
+}
+
+func (x *WorkerState) GetProductId() string {
+	if x != nil {
+		return x.ProductId
+	}
+	return ""
+}
+
+func (x *WorkerState) GetStartedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartedAt
+	}
+	return nil
+}
+
+func (x *WorkerState) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+var File_orchestrator_v1_orchestrator_proto protoreflect.FileDescriptor
+
+const file_orchestrator_v1_orchestrator_proto_rawDesc = "" +
+	"\n" +
+	"\"orchestrator/v1/orchestrator.proto\x12\x0forchestrator.v1\x1a\x1cgoogle/protobuf/struct.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\xb1\x01\n" +
+	"\aProduct\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12\x1a\n" +
+	"\bpriority\x18\x03 \x01(\x05R\bpriority\x12-\n" +
+	"\x05attrs\x18\x04 \x01(\v2\x17.google.protobuf.StructR\x05attrs\x12\x19\n" +
+	"\bretry_of\x18\x05 \x01(\tR\aretryOf\x12\x1c\n" +
+	"\tnamespace\x18\x06 \x01(\tR\tnamespace\"W\n" +
+	"\x06Result\x12\x1d\n" +
+	"\n" +
+	"product_id\x18\x01 \x01(\tR\tproductId\x12\x18\n" +
+	"\asuccess\x18\x02 \x01(\bR\asuccess\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\"G\n" +
+	"\x11SubmitTaskRequest\x122\n" +
+	"\aproduct\x18\x01 \x01(\v2\x18.orchestrator.v1.ProductR\aproduct\"Z\n" +
+	"\x12SubmitTaskResponse\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\x12\x1c\n" +
+	"\tnamespace\x18\x03 \x01(\tR\tnamespace\" \n" +
+	"\x0eGetTaskRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\xe7\x02\n" +
+	"\x04Task\x122\n" +
+	"\aproduct\x18\x01 \x01(\v2\x18.orchestrator.v1.ProductR\aproduct\x12\x1d\n" +
+	"\n" +
+	"station_id\x18\x02 \x01(\tR\tstationId\x12\x16\n" +
+	"\x06status\x18\x03 \x01(\tR\x06status\x12\x1c\n" +
+	"\tlifecycle\x18\x04 \x01(\tR\tlifecycle\x12\x19\n" +
+	"\btrace_id\x18\x05 \x01(\tR\atraceId\x12+\n" +
+	"\x05steps\x18\x06 \x03(\v2\x15.orchestrator.v1.StepR\x05steps\x12C\n" +
+	"\rcompensations\x18\a \x03(\v2\x1d.orchestrator.v1.CompensationR\rcompensations\x12\x18\n" +
+	"\aoutcome\x18\b \x01(\tR\aoutcome\x12/\n" +
+	"\x06result\x18\t \x01(\v2\x17.orchestrator.v1.ResultR\x06result\"\x8d\x02\n" +
+	"\x04Step\x12\x12\n" +
+	"\x04step\x18\x01 \x01(\x05R\x04step\x12\x1d\n" +
+	"\n" +
+	"station_id\x18\x02 \x01(\tR\tstationId\x129\n" +
+	"\n" +
+	"started_at\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\tstartedAt\x12;\n" +
+	"\vfinished_at\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"finishedAt\x12)\n" +
+	"\x10duration_seconds\x18\x05 \x01(\x01R\x0fdurationSeconds\x12/\n" +
+	"\x06result\x18\x06 \x01(\v2\x17.orchestrator.v1.ResultR\x06result\"Y\n" +
+	"\fCompensation\x12\x1d\n" +
+	"\n" +
+	"station_id\x18\x01 \x01(\tR\tstationId\x12*\n" +
+	"\x02at\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x02at\"#\n" +
+	"\x11CancelTaskRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"<\n" +
+	"\x12CancelTaskResponse\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\"\x12\n" +
+	"\x10ListQueueRequest\"R\n" +
+	"\x11ListQueueResponse\x12=\n" +
+	"\tscheduler\x18\x01 \x01(\v2\x1f.orchestrator.v1.SchedulerStateR\tscheduler\"\x96\x01\n" +
+	"\x12StreamStateRequest\x12\x1f\n" +
+	"\vproduct_ids\x18\x01 \x03(\tR\n" +
+	"productIds\x12#\n" +
+	"\rproduct_types\x18\x02 \x03(\tR\fproductTypes\x12\x1a\n" +
+	"\bstations\x18\x03 \x03(\tR\bstations\x12\x1e\n" +
+	"\n" +
+	"namespaces\x18\x04 \x03(\tR\n" +
+	"namespaces\"\xfb\x02\n" +
+	"\vStateUpdate\x12\x10\n" +
+	"\x03seq\x18\x01 \x01(\x04R\x03seq\x127\n" +
+	"\bsnapshot\x18\x02 \x01(\v2\x19.orchestrator.v1.SnapshotH\x00R\bsnapshot\x129\n" +
+	"\aproduct\x18\x03 \x01(\v2\x1d.orchestrator.v1.ProductStateH\x00R\aproduct\x12.\n" +
+	"\x12removed_product_id\x18\x04 \x01(\tH\x00R\x10removedProductId\x129\n" +
+	"\astation\x18\x05 \x01(\v2\x1d.orchestrator.v1.StationStateH\x00R\astation\x12?\n" +
+	"\tscheduler\x18\x06 \x01(\v2\x1f.orchestrator.v1.SchedulerStateH\x00R\tscheduler\x120\n" +
+	"\x04pool\x18\a \x01(\v2\x1a.orchestrator.v1.PoolStateH\x00R\x04poolB\b\n" +
+	"\x06update\"\xf1\x01\n" +
+	"\bSnapshot\x129\n" +
+	"\bproducts\x18\x01 \x03(\v2\x1d.orchestrator.v1.ProductStateR\bproducts\x129\n" +
+	"\bstations\x18\x02 \x03(\v2\x1d.orchestrator.v1.StationStateR\bstations\x12=\n" +
+	"\tscheduler\x18\x03 \x01(\v2\x1f.orchestrator.v1.SchedulerStateR\tscheduler\x120\n" +
+	"\x05pools\x18\x04 \x03(\v2\x1a.orchestrator.v1.PoolStateR\x05pools\"\x8b\x02\n" +
+	"\fProductState\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12\x1a\n" +
+	"\bpriority\x18\x03 \x01(\x05R\bpriority\x12\x1d\n" +
+	"\n" +
+	"station_id\x18\x04 \x01(\tR\tstationId\x12\x16\n" +
+	"\x06status\x18\x05 \x01(\tR\x06status\x12\x1c\n" +
+	"\tlifecycle\x18\x06 \x01(\tR\tlifecycle\x12\x19\n" +
+	"\bretry_of\x18\a \x01(\tR\aretryOf\x12-\n" +
+	"\x05attrs\x18\b \x01(\v2\x17.google.protobuf.StructR\x05attrs\x12\x1c\n" +
+	"\tnamespace\x18\t \x01(\tR\tnamespace\"\xaf\x01\n" +
+	"\fStationState\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\x12\x1a\n" +
+	"\bproducts\x18\x03 \x03(\tR\bproducts\x12!\n" +
+	"\fqueue_length\x18\x04 \x01(\x05R\vqueueLength\x12 \n" +
+	"\vutilization\x18\x05 \x01(\x01R\vutilization\x12\x16\n" +
+	"\x06health\x18\x06 \x01(\tR\x06health\"w\n" +
+	"\tPoolState\x12\x1d\n" +
+	"\n" +
+	"station_id\x18\x01 \x01(\tR\tstationId\x12\x1a\n" +
+	"\bcapacity\x18\x02 \x01(\x05R\bcapacity\x12\x15\n" +
+	"\x06in_use\x18\x03 \x01(\x05R\x05inUse\x12\x18\n" +
+	"\awaiting\x18\x04 \x01(\x05R\awaiting\"\xf1\x01\n" +
+	"\x0eSchedulerState\x12\x16\n" +
+	"\x06status\x18\x01 \x01(\tR\x06status\x12\x18\n" +
+	"\aworkers\x18\x02 \x01(\x05R\aworkers\x12!\n" +
+	"\fbusy_workers\x18\x03 \x01(\x05R\vbusyWorkers\x12\x1c\n" +
+	"\toccupancy\x18\x04 \x01(\x01R\toccupancy\x121\n" +
+	"\x05queue\x18\x05 \x03(\v2\x1b.orchestrator.v1.QueueEntryR\x05queue\x129\n" +
+	"\tin_flight\x18\x06 \x03(\v2\x1c.orchestrator.v1.WorkerStateR\binFlight\"\x95\x01\n" +
+	"\n" +
+	"QueueEntry\x12\x1a\n" +
+	"\bposition\x18\x01 \x01(\x05R\bposition\x12\x1d\n" +
+	"\n" +
+	"product_id\x18\x02 \x01(\tR\tproductId\x12\x12\n" +
+	"\x04type\x18\x03 \x01(\tR\x04type\x12\x1a\n" +
+	"\bpriority\x18\x04 \x01(\x05R\bpriority\x12\x1c\n" +
+	"\tnamespace\x18\x05 \x01(\tR\tnamespace\"\x9d\x01\n" +
+	"\vWorkerState\x12\x16\n" +
+	"\x06worker\x18\x01 \x01(\x05R\x06worker\x12\x1d\n" +
+	"\n" +
+	"product_id\x18\x02 \x01(\tR\tproductId\x129\n" +
+	"\n" +
+	"started_at\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\tstartedAt\x12\x1c\n" +
+	"\tnamespace\x18\x04 \x01(\tR\tnamespace2\xa7\x03\n" +
+	"\fOrchestrator\x12U\n" +
+	"\n" +
+	"SubmitTask\x12\".orchestrator.v1.SubmitTaskRequest\x1a#.orchestrator.v1.SubmitTaskResponse\x12A\n" +
+	"\aGetTask\x12\x1f.orchestrator.v1.GetTaskRequest\x1a\x15.orchestrator.v1.Task\x12U\n" +
+	"\n" +
+	"CancelTask\x12\".orchestrator.v1.CancelTaskRequest\x1a#.orchestrator.v1.CancelTaskResponse\x12R\n" +
+	"\tListQueue\x12!.orchestrator.v1.ListQueueRequest\x1a\".orchestrator.v1.ListQueueResponse\x12R\n" +
+	"\vStreamState\x12#.orchestrator.v1.StreamStateRequest\x1a\x1c.orchestrator.v1.StateUpdate0\x01BDZBindustrial-4.0-demo/internal/grpcapi/orchestratorv1;orchestratorv1b\x06proto3"
+
+var (
+	file_orchestrator_v1_orchestrator_proto_rawDescOnce sync.Once
+	file_orchestrator_v1_orchestrator_proto_rawDescData []byte
+)
+
+func file_orchestrator_v1_orchestrator_proto_rawDescGZIP() []byte {
+	file_orchestrator_v1_orchestrator_proto_rawDescOnce.Do(func() {
+		file_orchestrator_v1_orchestrator_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_orchestrator_v1_orchestrator_proto_rawDesc), len(file_orchestrator_v1_orchestrator_proto_rawDesc)))
+	})
+	return file_orchestrator_v1_orchestrator_proto_rawDescData
+}
+
+var file_orchestrator_v1_orchestrator_proto_msgTypes = make([]protoimpl.MessageInfo, 21)
+var file_orchestrator_v1_orchestrator_proto_goTypes = []any{
+	(*Product)(nil),               // 0: orchestrator.v1.Product
+	(*Result)(nil),                // 1: orchestrator.v1.Result
+	(*SubmitTaskRequest)(nil),     // 2: orchestrator.v1.SubmitTaskRequest
+	(*SubmitTaskResponse)(nil),    // 3: orchestrator.v1.SubmitTaskResponse
+	(*GetTaskRequest)(nil),        // 4: orchestrator.v1.GetTaskRequest
+	(*Task)(nil),                  // 5: orchestrator.v1.Task
+	(*Step)(nil),                  // 6: orchestrator.v1.Step
+	(*Compensation)(nil),          // 7: orchestrator.v1.Compensation
+	(*CancelTaskRequest)(nil),     // 8: orchestrator.v1.CancelTaskRequest
+	(*CancelTaskResponse)(nil),    // 9: orchestrator.v1.CancelTaskResponse
+	(*ListQueueRequest)(nil),      // 10: orchestrator.v1.ListQueueRequest
+	(*ListQueueResponse)(nil),     // 11: orchestrator.v1.ListQueueResponse
+	(*StreamStateRequest)(nil),    // 12: orchestrator.v1.StreamStateRequest
+	(*StateUpdate)(nil),           // 13: orchestrator.v1.StateUpdate
+	(*Snapshot)(nil),              // 14: orchestrator.v1.Snapshot
+	(*ProductState)(nil),          // 15: orchestrator.v1.ProductState
+	(*StationState)(nil),          // 16: orchestrator.v1.StationState
+	(*PoolState)(nil),             // 17: orchestrator.v1.PoolState
+	(*SchedulerState)(nil),        // 18: orchestrator.v1.SchedulerState
+	(*QueueEntry)(nil),            // 19: orchestrator.v1.QueueEntry
+	(*WorkerState)(nil),           // 20: orchestrator.v1.WorkerState
+	(*structpb.Struct)(nil),       // 21: google.protobuf.Struct
+	(*timestamppb.Timestamp)(nil), // 22: google.protobuf.Timestamp
+}
+var file_orchestrator_v1_orchestrator_proto_depIdxs = []int32{
+	21, // 0: orchestrator.v1.Product.attrs:type_name -> google.protobuf.Struct
+	0,  // 1: orchestrator.v1.SubmitTaskRequest.product:type_name -> orchestrator.v1.Product
+	0,  // 2: orchestrator.v1.Task.product:type_name -> orchestrator.v1.Product
+	6,  // 3: orchestrator.v1.Task.steps:type_name -> orchestrator.v1.Step
+	7,  // 4: orchestrator.v1.Task.compensations:type_name -> orchestrator.v1.Compensation
+	1,  // 5: orchestrator.v1.Task.result:type_name -> orchestrator.v1.Result
+	22, // 6: orchestrator.v1.Step.started_at:type_name -> google.protobuf.Timestamp
+	22, // 7: orchestrator.v1.Step.finished_at:type_name -> google.protobuf.Timestamp
+	1,  // 8: orchestrator.v1.Step.result:type_name -> orchestrator.v1.Result
+	22, // 9: orchestrator.v1.Compensation.at:type_name -> google.protobuf.Timestamp
+	18, // 10: orchestrator.v1.ListQueueResponse.scheduler:type_name -> orchestrator.v1.SchedulerState
+	14, // 11: orchestrator.v1.StateUpdate.snapshot:type_name -> orchestrator.v1.Snapshot
+	15, // 12: orchestrator.v1.StateUpdate.product:type_name -> orchestrator.v1.ProductState
+	16, // 13: orchestrator.v1.StateUpdate.station:type_name -> orchestrator.v1.StationState
+	18, // 14: orchestrator.v1.StateUpdate.scheduler:type_name -> orchestrator.v1.SchedulerState
+	17, // 15: orchestrator.v1.StateUpdate.pool:type_name -> orchestrator.v1.PoolState
+	15, // 16: orchestrator.v1.Snapshot.products:type_name -> orchestrator.v1.ProductState
+	16, // 17: orchestrator.v1.Snapshot.stations:type_name -> orchestrator.v1.StationState
+	18, // 18: orchestrator.v1.Snapshot.scheduler:type_name -> orchestrator.v1.SchedulerState
+	17, // 19: orchestrator.v1.Snapshot.pools:type_name -> orchestrator.v1.PoolState
+	21, // 20: orchestrator.v1.ProductState.attrs:type_name -> google.protobuf.Struct
+	19, // 21: orchestrator.v1.SchedulerState.queue:type_name -> orchestrator.v1.QueueEntry
+	20, // 22: orchestrator.v1.SchedulerState.in_flight:type_name -> orchestrator.v1.WorkerState
+	22, // 23: orchestrator.v1.WorkerState.started_at:type_name -> google.protobuf.Timestamp
+	2,  // 24: orchestrator.v1.Orchestrator.SubmitTask:input_type -> orchestrator.v1.SubmitTaskRequest
+	4,  // 25: orchestrator.v1.Orchestrator.GetTask:input_type -> orchestrator.v1.GetTaskRequest
+	8,  // 26: orchestrator.v1.Orchestrator.CancelTask:input_type -> orchestrator.v1.CancelTaskRequest
+	10, // 27: orchestrator.v1.Orchestrator.ListQueue:input_type -> orchestrator.v1.ListQueueRequest
+	12, // 28: orchestrator.v1.Orchestrator.StreamState:input_type -> orchestrator.v1.StreamStateRequest
+	3,  // 29: orchestrator.v1.Orchestrator.SubmitTask:output_type -> orchestrator.v1.SubmitTaskResponse
+	5,  // 30: orchestrator.v1.Orchestrator.GetTask:output_type -> orchestrator.v1.Task
+	9,  // 31: orchestrator.v1.Orchestrator.CancelTask:output_type -> orchestrator.v1.CancelTaskResponse
+	11, // 32: orchestrator.v1.Orchestrator.ListQueue:output_type -> orchestrator.v1.ListQueueResponse
+	13, // 33: orchestrator.v1.Orchestrator.StreamState:output_type -> orchestrator.v1.StateUpdate
+	29, // [29:34] is the sub-list for method output_type
+	24, // [24:29] is the sub-list for method input_type
+	24, // [24:24] is the sub-list for extension type_name
+	24, // [24:24] is the sub-list for extension extendee
+	0,  // [0:24] is the sub-list for field type_name
+}
+
+func init() { file_orchestrator_v1_orchestrator_proto_init() }
+func file_orchestrator_v1_orchestrator_proto_init() {
+	if File_orchestrator_v1_orchestrator_proto != nil {
+		return
+	}
+	file_orchestrator_v1_orchestrator_proto_msgTypes[13].OneofWrappers = []any{
+		(*StateUpdate_Snapshot)(nil),
+		(*StateUpdate_Product)(nil),
+		(*StateUpdate_RemovedProductId)(nil),
+		(*StateUpdate_Station)(nil),
+		(*StateUpdate_Scheduler)(nil),
+		(*StateUpdate_Pool)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_orchestrator_v1_orchestrator_proto_rawDesc), len(file_orchestrator_v1_orchestrator_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   21,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_orchestrator_v1_orchestrator_proto_goTypes,
+		DependencyIndexes: file_orchestrator_v1_orchestrator_proto_depIdxs,
+		MessageInfos:      file_orchestrator_v1_orchestrator_proto_msgTypes,
+	}.Build()
+	File_orchestrator_v1_orchestrator_proto = out.File
+	file_orchestrator_v1_orchestrator_proto_goTypes = nil
+	file_orchestrator_v1_orchestrator_proto_depIdxs = nil
+}
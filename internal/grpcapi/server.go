@@ -0,0 +1,230 @@
+// Package grpcapi 提供编排器的 gRPC 接口，与 HTTP API 并行运行，供其他后端服务以强类型方式集成
+// 接口定义位于 proto/orchestrator/v1，修改后在仓库根目录执行 buf generate 重新生成 orchestratorv1 包
+package grpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"industrial-4.0-demo/internal/auth"
+	"industrial-4.0-demo/internal/cluster"
+	"industrial-4.0-demo/internal/engine"
+	"industrial-4.0-demo/internal/fsm"
+	"industrial-4.0-demo/internal/grpcapi/orchestratorv1"
+	"industrial-4.0-demo/internal/history"
+	"industrial-4.0-demo/internal/metrics"
+	"industrial-4.0-demo/internal/ratelimit"
+	"industrial-4.0-demo/internal/types"
+	"industrial-4.0-demo/internal/web"
+	"log/slog"
+	"math"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Server 实现 orchestrator.v1.Orchestrator 服务
+type Server struct {
+	orchestratorv1.UnimplementedOrchestratorServer
+
+	scheduler    *engine.Scheduler  // 调度器，用于提交和取消任务
+	hub          *web.Hub           // 状态推送 Hub，StreamState 作为它的订阅者
+	stateTracker *web.StateTracker  // 实时状态追踪器
+	history      *history.Store     // 工件加工履历
+	auth         auth.Authenticator // 认证器，为 nil 时不启用认证
+	limiter      *ratelimit.Limiter // 任务提交限流器，为 nil 时不启用限流，与 HTTP API 共享调用方配额
+	cluster      *cluster.Elector   // 集群选举者，为 nil 时单实例运行
+	metrics      *metrics.Metrics   // 认证失败和限流指标
+	logger       *slog.Logger       // 结构化日志记录器
+}
+
+// NewServer 创建一个新的 gRPC Server 实例
+func NewServer(scheduler *engine.Scheduler, hub *web.Hub, st *web.StateTracker, hist *history.Store, authenticator auth.Authenticator, limiter *ratelimit.Limiter, m *metrics.Metrics, logger *slog.Logger) *Server {
+	return &Server{
+		scheduler:    scheduler,
+		hub:          hub,
+		stateTracker: st,
+		history:      hist,
+		auth:         authenticator,
+		limiter:      limiter,
+		metrics:      m,
+		logger:       logger.With("component", "grpc"),
+	}
+}
+
+// SetCluster 设置集群选举者，设置后跟随者拒绝提交和取消任务，返回 Unavailable 和领导者的地址
+func (s *Server) SetCluster(elector *cluster.Elector) {
+	s.cluster = elector
+}
+
+// GRPCServer 创建注册了编排器服务和认证拦截器的 grpc.Server
+func (s *Server) GRPCServer() *grpc.Server {
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(s.unaryInterceptor),
+		grpc.StreamInterceptor(s.streamInterceptor),
+	)
+	orchestratorv1.RegisterOrchestratorServer(srv, s)
+	return srv
+}
+
+// SubmitTask 接收新的生产任务
+func (s *Server) SubmitTask(ctx context.Context, req *orchestratorv1.SubmitTaskRequest) (*orchestratorv1.SubmitTaskResponse, error) {
+	if req.GetProduct() == nil {
+		return nil, status.Error(codes.InvalidArgument, "product is required")
+	}
+	if s.limiter != nil {
+		key := clientKey(ctx)
+		if ok, wait := s.limiter.Allow(key); !ok {
+			s.metrics.RateLimitedRequestsTotal.WithLabelValues(orchestratorv1.Orchestrator_SubmitTask_FullMethodName).Inc()
+			s.logger.Warn("请求被限流", "client", key, "method", "SubmitTask")
+			grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(int(math.Ceil(wait.Seconds())))))
+			return nil, status.Error(codes.ResourceExhausted, "rate limit exceeded")
+		}
+	}
+
+	p := productFromProto(req.GetProduct())
+	principal, _ := auth.PrincipalFromContext(ctx)
+	namespace, err := auth.ResolveNamespace(principal, p.Namespace)
+	switch {
+	case errors.Is(err, auth.ErrForbidden):
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	p.Namespace = namespace
+	if err := s.scheduler.Engine().Workflows().CheckProductType(p.Type); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if p.ID == "" {
+		p.ID = "GRPC_ORDER_" + time.Now().Format("150405.000")
+	}
+	s.scheduler.SubmitTask(p)
+	return &orchestratorv1.SubmitTaskResponse{Id: p.ID, Status: "accepted", Namespace: p.Namespace}, nil
+}
+
+// visibleTask 判断任务是否存在且调用方可以访问它所属的命名空间，其他命名空间的任务视同不存在
+func (s *Server) visibleTask(ctx context.Context, id string) bool {
+	principal, _ := auth.PrincipalFromContext(ctx)
+	if state, ok := s.stateTracker.GetProduct(id); ok {
+		return principal.CanAccess(state.Namespace)
+	}
+	if record, ok := s.history.Get(id); ok {
+		return principal.CanAccess(record.Namespace)
+	}
+	return false
+}
+
+// GetTask 返回任务的实时状态和加工履历，实时状态已被清理的任务从履历中还原
+func (s *Server) GetTask(ctx context.Context, req *orchestratorv1.GetTaskRequest) (*orchestratorv1.Task, error) {
+	id := req.GetId()
+	state, hasState := s.stateTracker.GetProduct(id)
+	record, hasRecord := s.history.Get(id)
+	if !s.visibleTask(ctx, id) {
+		return nil, status.Error(codes.NotFound, "task not found")
+	}
+
+	task := &orchestratorv1.Task{
+		Product: &orchestratorv1.Product{
+			Id:        id,
+			Type:      state.Type,
+			Priority:  int32(state.Priority),
+			Attrs:     attrsToProto(state.Attrs),
+			RetryOf:   state.RetryOf,
+			Namespace: state.Namespace,
+		},
+		StationId: string(state.Station),
+		Status:    state.Status,
+		Lifecycle: state.Lifecycle,
+	}
+	if hasRecord {
+		if !hasState {
+			task.Product.Type = record.Type
+			task.Product.Priority = int32(record.Priority)
+			task.Product.Attrs = attrsToProto(record.Attrs)
+			task.Product.RetryOf = record.RetryOf
+			task.Product.Namespace = record.Namespace
+			task.Status = record.Outcome
+		}
+		task.TraceId = record.TraceID
+		task.Outcome = record.Outcome
+		for _, step := range record.Steps {
+			task.Steps = append(task.Steps, stepToProto(id, step))
+		}
+		for _, c := range record.Compensations {
+			task.Compensations = append(task.Compensations, &orchestratorv1.Compensation{StationId: string(c.StationID), At: timestampToProto(c.At)})
+		}
+		if record.Outcome != "" {
+			task.Result = &orchestratorv1.Result{
+				ProductId: id,
+				Success:   record.Outcome == string(fsm.StateCompleted),
+				Error:     record.Failure,
+			}
+		}
+	}
+	return task, nil
+}
+
+// CancelTask 取消一个排队中或执行中的任务
+func (s *Server) CancelTask(ctx context.Context, req *orchestratorv1.CancelTaskRequest) (*orchestratorv1.CancelTaskResponse, error) {
+	if !s.visibleTask(ctx, req.GetId()) {
+		return nil, status.Error(codes.NotFound, "task not found")
+	}
+	err := s.scheduler.Cancel(req.GetId())
+	switch {
+	case errors.Is(err, engine.ErrTaskNotFound):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, engine.ErrTaskFinished):
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &orchestratorv1.CancelTaskResponse{Id: req.GetId(), Status: "cancelling"}, nil
+}
+
+// ListQueue 返回调度器的当前状态，其中的队列按出队顺序排列，调用方绑定了命名空间时只包含这些命名空间的任务
+func (s *Server) ListQueue(ctx context.Context, req *orchestratorv1.ListQueueRequest) (*orchestratorv1.ListQueueResponse, error) {
+	state := s.scheduler.State().Scoped(auth.ScopeFromContext(ctx))
+	return &orchestratorv1.ListQueueResponse{Scheduler: schedulerToProto(&state)}, nil
+}
+
+// StreamState 以 Hub 订阅者的身份推送状态更新：先是一条按订阅条件过滤的快照，之后是增量更新
+// 停机或消费过慢时 Hub 会移除订阅者，此时以 Unavailable 结束流，客户端应重新订阅
+func (s *Server) StreamState(req *orchestratorv1.StreamStateRequest, stream orchestratorv1.Orchestrator_StreamStateServer) error {
+	filter := web.Filter{ProductIDs: req.GetProductIds(), ProductTypes: req.GetProductTypes(), Namespaces: req.GetNamespaces()}
+	for _, id := range req.GetStations() {
+		filter.Stations = append(filter.Stations, types.StationID(id))
+	}
+	filter = filter.Restrict(auth.ScopeFromContext(stream.Context()))
+	updates, cancel, ok := s.hub.Subscribe(remoteAddr(stream.Context()), filter)
+	if !ok {
+		return status.Error(codes.Unavailable, "server shutting down")
+	}
+	defer cancel()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case data, ok := <-updates:
+			if !ok {
+				return status.Error(codes.Unavailable, "subscription closed")
+			}
+			var msg web.Message
+			if err := json.Unmarshal(data, &msg); err != nil {
+				s.logger.Error("解析推送消息失败", "error", err)
+				continue
+			}
+			if msg.Type == web.MessageAlert {
+				// 安灯板告警只推送给看板，通过 HTTP 接口确认
+				continue
+			}
+			if err := stream.Send(updateToProto(msg)); err != nil {
+				return err
+			}
+		}
+	}
+}
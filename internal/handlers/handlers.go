@@ -1,53 +1,220 @@
 package handlers
 
 import (
+	"fmt"
 	"industrial-4.0-demo/internal/event"
 	"industrial-4.0-demo/internal/fsm"
+	"industrial-4.0-demo/internal/history"
 	"industrial-4.0-demo/internal/metrics"
 	"industrial-4.0-demo/internal/types"
 	"industrial-4.0-demo/internal/web"
 	"log/slog"
+	"strconv"
+	"time"
 )
 
 // RegisterEventHandlers 将所有事件处理器注册到事件总线
 // 这是事件驱动架构的核心，将不同的业务关注点（监控、UI、日志）解耦
-func RegisterEventHandlers(bus *event.Bus, st *web.StateTracker, logger *slog.Logger) {
+func RegisterEventHandlers(bus *event.Bus, st *web.StateTracker, hist *history.Store, m *metrics.Metrics, logger *slog.Logger) {
 	// --- 指标处理器 (Metrics Handler) ---
 	// 订阅产品完成事件，增加成功计数器
 	bus.Subscribe(event.ProductCompleted, func(e event.Event) {
-		metrics.TasksProcessedTotal.WithLabelValues("success", e.Product.Type).Inc()
+		m.TasksProcessedTotal.WithLabelValues("success", e.Product.Type, e.Product.Namespace).Inc()
 	})
 	// 订阅产品失败事件，增加失败计数器
 	bus.Subscribe(event.ProductFailed, func(e event.Event) {
-		metrics.TasksProcessedTotal.WithLabelValues("failed", e.Product.Type).Inc()
+		m.TasksProcessedTotal.WithLabelValues("failed", e.Product.Type, e.Product.Namespace).Inc()
 	})
-	// 订阅步骤完成事件，记录工站处理耗时
+	// 订阅入队与结束事件，记录从提交到完成或失败的端到端交期
+	newLeadTimeTracker(m).register(bus)
+	// 订阅步骤完成事件，记录工站处理耗时，并按产品类型和工作流版本细分；Trace ID 作为 exemplar 附在观测值上
 	bus.Subscribe(event.StepCompleted, func(e event.Event) {
 		if duration, ok := e.Product.Attrs["duration"].(float64); ok {
-			metrics.StationProcessingDuration.WithLabelValues(string(e.StationID)).Observe(duration)
+			metrics.ObserveWithTrace(m.StationProcessingDuration.WithLabelValues(string(e.StationID), e.Product.Namespace), duration, e.TraceID, e.ProductID)
+			version, _ := e.Product.Attrs["workflow_version"].(int)
+			metrics.ObserveWithTrace(m.WorkflowStepDuration.WithLabelValues(string(e.StationID), e.Product.Type, strconv.Itoa(version), e.Product.Namespace), duration, e.TraceID, e.ProductID)
 		}
 	})
 
+	// 订阅在制品变化和解除阻塞事件，记录拉动式生产中各工站的在制品和工件被阻塞的时长
+	newWIPTracker(m).register(bus)
+
 	// --- Web UI 处理器 (Web UI Handler) ---
-	// 订阅产品开始事件，更新 UI 状态
+	// 订阅产品开始事件，记录工件的生命周期变体
 	bus.Subscribe(event.ProductStarted, func(e event.Event) {
-		st.UpdateProductState(e.ProductID, types.StationCAM, string(fsm.StateProcessing))
+		if productFSM, ok := e.Product.FSM.(*fsm.ProductFSM); ok {
+			st.SetLifecycle(e.ProductID, productFSM.Name())
+		}
+		if e.Product.Serial != "" {
+			st.SetSerial(e.ProductID, e.Product.Serial)
+		}
 	})
 	// 订阅步骤开始事件，更新 UI 中工件的位置
 	bus.Subscribe(event.StepStarted, func(e event.Event) {
-		st.UpdateProductState(e.ProductID, e.StationID, string(fsm.StateProcessing))
+		st.UpdateProductStation(e.ProductID, e.StationID)
+	})
+	// 订阅步骤事件与工站状态变更事件，维护车间的设备视图
+	bus.Subscribe(event.StepQueued, func(e event.Event) {
+		st.StationStepQueued(e.StationID, e.ProductID, e.Step)
+	})
+	bus.Subscribe(event.StepStarted, func(e event.Event) {
+		st.StationStepStarted(e.StationID, e.ProductID, e.Step)
+	})
+	bus.Subscribe(event.StepRejected, func(e event.Event) {
+		st.StationStepRejected(e.StationID, e.ProductID, e.Step)
+	})
+	bus.Subscribe(event.StepCompleted, func(e event.Event) {
+		st.StationStepCompleted(e.StationID, e.ProductID, e.Step, e.Error == nil)
+	})
+	bus.Subscribe(event.StationStatusChanged, func(e event.Event) {
+		st.ApplyStationStatus(e.StationID, e.ToState, e.Seq)
+	})
+	// 订阅资源池占用变化事件，在看板上展示瓶颈工站的排队情况
+	bus.Subscribe(event.PoolChanged, func(e event.Event) {
+		st.ApplyPoolUsage(web.PoolStatus{ID: e.StationID, Capacity: e.Pool.Capacity, InUse: e.Pool.InUse, Waiting: e.Pool.Waiting}, e.Seq)
+	})
+	// 订阅在制品变化事件，在看板上展示各工站的看板占用和被阻塞的上游工件
+	bus.Subscribe(event.WIPChanged, func(e event.Event) {
+		st.ApplyWIPUsage(web.WIPStatus{ID: e.StationID, Limit: e.WIP.Limit, InUse: e.WIP.InUse, Blocked: e.WIP.Blocked}, e.Seq)
+	})
+	// 订阅操作员变化事件，在看板上展示人员的分配和工作量
+	bus.Subscribe(event.OperatorChanged, func(e event.Event) {
+		st.ApplyOperator(web.OperatorStatus{
+			ID:          e.Operator.ID,
+			Name:        e.Operator.Name,
+			Busy:        e.Operator.Busy,
+			StationID:   e.StationID,
+			ProductID:   e.ProductID,
+			Assignments: e.Operator.Assignments,
+			BusySeconds: e.Operator.BusySeconds,
+		}, e.Seq)
+	})
+	// 订阅 FSM 状态变更事件，将工件生命周期投影为 UI 状态
+	bus.Subscribe(event.StateChanged, func(e event.Event) {
+		st.ApplyStateChange(e.ProductID, e.ToState, e.Seq, stationForState(fsm.State(e.ToState)))
+	})
+
+	// --- 告警处理器 (Andon Handler) ---
+	// 将需要现场人员处理的异常推送到看板的安灯板
+	bus.Subscribe(event.ProductFailed, func(e event.Event) {
+		st.RaiseAlert(web.Alert{
+			Kind:      web.AlertProductFailed,
+			Severity:  web.SeverityWarning,
+			Message:   fmt.Sprintf("工件 %s 生产失败: %v", e.ProductID, e.Error),
+			ProductID: e.ProductID,
+			StationID: e.StationID,
+			Namespace: e.Product.Namespace,
+			RaisedAt:  e.Timestamp,
+		})
+	})
+	bus.Subscribe(event.CompensationFailed, func(e event.Event) {
+		st.RaiseAlert(web.Alert{
+			Kind:      web.AlertCompensationFailed,
+			Severity:  web.SeverityCritical,
+			Message:   fmt.Sprintf("工件 %s 在工站 %s 补偿失败: %v", e.ProductID, e.StationID, e.Error),
+			ProductID: e.ProductID,
+			StationID: e.StationID,
+			Namespace: e.Product.Namespace,
+			RaisedAt:  e.Timestamp,
+		})
+	})
+	bus.Subscribe(event.StationAnomaly, func(e event.Event) {
+		st.RaiseAlert(web.Alert{
+			Kind:      web.AlertStationAnomaly,
+			Severity:  web.SeverityWarning,
+			Message:   fmt.Sprintf("工站 %s 加工工件 %s 耗时 %.2f 秒，偏离基线 %.2f 秒 (z=%.1f)", e.StationID, e.ProductID, e.Anomaly.DurationSeconds, e.Anomaly.MeanSeconds, e.Anomaly.ZScore),
+			StationID: e.StationID,
+			RaisedAt:  e.Timestamp,
+		})
+	})
+	bus.Subscribe(event.MaintenanceDue, func(e event.Event) {
+		message := fmt.Sprintf("工站 %s 触发维护规则 %s (%s)，已创建维护工单 %s", e.StationID, e.WorkOrder.Rule, e.WorkOrder.Reason, e.WorkOrder.ID)
+		if e.WorkOrder.Maintenance {
+			message += "，工站已进入维护模式"
+		}
+		st.RaiseAlert(web.Alert{
+			Kind:      web.AlertMaintenanceDue,
+			Severity:  web.SeverityWarning,
+			Message:   message,
+			StationID: e.StationID,
+			RaisedAt:  e.Timestamp,
+		})
+	})
+	bus.Subscribe(event.SLABreachPredicted, func(e event.Event) {
+		st.RaiseAlert(web.Alert{
+			Kind:      web.AlertSLAAtRisk,
+			Severity:  web.SeverityWarning,
+			Message:   fmt.Sprintf("工件 %s 预计 %s 完工，晚于交期 %s", e.ProductID, e.SLA.ProjectedAt.Format(time.DateTime), e.SLA.DueAt.Format(time.DateTime)),
+			ProductID: e.ProductID,
+			Namespace: e.Product.Namespace,
+			RaisedAt:  e.Timestamp,
+		})
+	})
+	bus.Subscribe(event.SLABreached, func(e event.Event) {
+		st.RaiseAlert(web.Alert{
+			Kind:      web.AlertSLABreached,
+			Severity:  web.SeverityCritical,
+			Message:   fmt.Sprintf("工件 %s 已超过交期 %s", e.ProductID, e.SLA.DueAt.Format(time.DateTime)),
+			ProductID: e.ProductID,
+			Namespace: e.Product.Namespace,
+			RaisedAt:  e.Timestamp,
+		})
+	})
+	bus.Subscribe(event.StationStatusChanged, func(e event.Event) {
+		if e.ToState != string(fsm.StationDown) {
+			return
+		}
+		st.RaiseAlert(web.Alert{
+			Kind:      web.AlertStationDown,
+			Severity:  web.SeverityCritical,
+			Message:   fmt.Sprintf("工站 %s 故障停机", e.StationID),
+			StationID: e.StationID,
+			RaisedAt:  e.Timestamp,
+		})
+	})
+
+	// --- 履历处理器 (History Handler) ---
+	// 记录每个工件的加工履历，供任务详情 API 查询
+	bus.Subscribe(event.ProductQueued, func(e event.Event) {
+		hist.Queued(e.Product, e.Timestamp)
+	})
+	bus.Subscribe(event.ProductDispatched, func(e event.Event) {
+		hist.Dispatched(e.ProductID, e.Worker, e.Timestamp)
+	})
+	bus.Subscribe(event.ProductStarted, func(e event.Event) {
+		hist.Started(e.Product, e.TraceID, e.Timestamp)
+	})
+	bus.Subscribe(event.StepQueued, func(e event.Event) {
+		hist.StepQueued(e.ProductID, e.Step, e.StationID, e.Timestamp)
+	})
+	bus.Subscribe(event.StepStarted, func(e event.Event) {
+		hist.StepStarted(e.ProductID, e.Step, e.StationID, e.Timestamp)
+	})
+	bus.Subscribe(event.StepCompleted, func(e event.Event) {
+		duration, _ := e.Product.Attrs["duration"].(float64)
+		hist.StepFinished(e.ProductID, e.Step, e.StationID, e.Timestamp, history.StepOutcome{
+			Duration:     duration,
+			Error:        e.Error,
+			Defect:       e.Defect,
+			Measurements: e.Measurements,
+			Provenance:   e.Provenance,
+			Cost:         e.Cost,
+		})
+	})
+	bus.Subscribe(event.StepCompensated, func(e event.Event) {
+		hist.Compensated(e.ProductID, e.StationID, e.Timestamp)
 	})
-	// 订阅产品完成事件，将工件移动到出货区
 	bus.Subscribe(event.ProductCompleted, func(e event.Event) {
-		st.UpdateProductState(e.ProductID, types.StationPack, string(fsm.StateCompleted))
+		hist.Finished(e.ProductID, string(fsm.StateCompleted), e.Timestamp)
 	})
-	// 订阅产品失败事件，更新 UI 状态
 	bus.Subscribe(event.ProductFailed, func(e event.Event) {
-		st.UpdateProductState(e.ProductID, "", string(fsm.StateFailed))
+		hist.Failed(e.ProductID, string(fsm.StateFailed), e.Error, e.Timestamp)
 	})
-	// 订阅产品补偿完成事件，更新 UI 状态
 	bus.Subscribe(event.ProductCompensated, func(e event.Event) {
-		st.UpdateProductState(e.ProductID, "", string(fsm.StateCompensated))
+		hist.Finished(e.ProductID, string(fsm.StateCompensated), e.Timestamp)
+	})
+	bus.Subscribe(event.ProductCancelled, func(e event.Event) {
+		hist.Finished(e.ProductID, string(fsm.StateCancelled), e.Timestamp)
 	})
 
 	// --- 日志处理器 (Logging Handler) ---
@@ -58,4 +225,26 @@ func RegisterEventHandlers(bus *event.Bus, st *web.StateTracker, logger *slog.Lo
 	bus.Subscribe(event.ProductCompleted, func(e event.Event) {
 		logger.Info("产品处理成功", "product_id", e.ProductID)
 	})
+	bus.Subscribe(event.ProductCancelled, func(e event.Event) {
+		logger.Warn("产品已取消", "product_id", e.ProductID)
+	})
+	bus.Subscribe(event.StationAnomaly, func(e event.Event) {
+		logger.Warn("工站步骤耗时异常", "station_id", e.StationID, "product_id", e.ProductID, "trace_id", e.TraceID,
+			"duration", e.Anomaly.DurationSeconds, "mean", e.Anomaly.MeanSeconds, "stddev", e.Anomaly.StdDevSeconds, "z_score", e.Anomaly.ZScore)
+	})
+}
+
+// stationForState 返回工件进入某个状态时在 UI 中应处的位置
+// 完成的工件移动到出货区，失败、补偿中和已取消的工件移出产线；其余状态保持当前位置
+func stationForState(state fsm.State) *types.StationID {
+	var station types.StationID
+	switch state {
+	case fsm.StateCompleted:
+		station = types.StationPack
+	case fsm.StateFailed, fsm.StateCompensating, fsm.StateCompensated, fsm.StateCancelled:
+		station = ""
+	default:
+		return nil
+	}
+	return &station
 }
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"industrial-4.0-demo/internal/event"
+	"industrial-4.0-demo/internal/metrics"
+	"sync"
+	"time"
+)
+
+// leadTimeTracker 记录工件进入调度队列的时间，在工件结束时观测端到端交期
+// 处理器是异步执行的，结束事件先于入队事件到达时 (实际不会发生) 不做观测
+type leadTimeTracker struct {
+	mu      sync.Mutex
+	queued  map[string]time.Time
+	metrics *metrics.Metrics
+}
+
+// newLeadTimeTracker 创建一个空的交期追踪器，交期记录到 m
+func newLeadTimeTracker(m *metrics.Metrics) *leadTimeTracker {
+	return &leadTimeTracker{queued: make(map[string]time.Time), metrics: m}
+}
+
+// register 订阅入队和结束事件
+// 失败的工件在失败时观测，随后的补偿不计入交期；取消的工件只清理记录，不参与观测
+func (t *leadTimeTracker) register(bus *event.Bus) {
+	bus.Subscribe(event.ProductQueued, func(e event.Event) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.queued[e.ProductID] = e.Timestamp
+	})
+	bus.Subscribe(event.ProductCompleted, func(e event.Event) {
+		t.observe(e, "success")
+	})
+	bus.Subscribe(event.ProductFailed, func(e event.Event) {
+		t.observe(e, "failed")
+	})
+	bus.Subscribe(event.ProductCancelled, func(e event.Event) {
+		t.take(e.ProductID)
+	})
+}
+
+// observe 记录工件从入队到结束的耗时，按产品类型和最终状态分类，Trace ID 作为 exemplar 附在观测值上
+func (t *leadTimeTracker) observe(e event.Event, status string) {
+	queuedAt, ok := t.take(e.ProductID)
+	if !ok {
+		return
+	}
+	metrics.ObserveWithTrace(t.metrics.ProductLeadTime.WithLabelValues(e.Product.Type, status, e.Product.Namespace), e.Timestamp.Sub(queuedAt).Seconds(), e.TraceID, e.ProductID)
+}
+
+// take 取出并删除工件的入队时间
+func (t *leadTimeTracker) take(id string) (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	queuedAt, ok := t.queued[id]
+	delete(t.queued, id)
+	return queuedAt, ok
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"industrial-4.0-demo/internal/event"
+	"industrial-4.0-demo/internal/metrics"
+	"industrial-4.0-demo/internal/types"
+	"sync"
+)
+
+// wipTracker 将工站的在制品变化导出为仪表盘，并累计工件被阻塞的时长
+// 处理器是异步执行的，序号不大于已导出序号的在制品事件视为旧事件丢弃
+type wipTracker struct {
+	mu      sync.Mutex
+	seq     map[types.StationID]uint64
+	metrics *metrics.Metrics
+}
+
+// newWIPTracker 创建一个在制品追踪器，指标记录到 m
+func newWIPTracker(m *metrics.Metrics) *wipTracker {
+	return &wipTracker{seq: make(map[types.StationID]uint64), metrics: m}
+}
+
+// register 订阅在制品变化和解除阻塞事件
+func (t *wipTracker) register(bus *event.Bus) {
+	bus.Subscribe(event.WIPChanged, func(e event.Event) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if e.Seq <= t.seq[e.StationID] {
+			return
+		}
+		t.seq[e.StationID] = e.Seq
+		id := string(e.StationID)
+		t.metrics.StationWIP.WithLabelValues(id).Set(float64(e.WIP.InUse))
+		t.metrics.StationWIPLimit.WithLabelValues(id).Set(float64(e.WIP.Limit))
+		t.metrics.StationWIPBlocked.WithLabelValues(id).Set(float64(e.WIP.Blocked))
+	})
+	bus.Subscribe(event.StepUnblocked, func(e event.Event) {
+		t.metrics.StationBlockedSeconds.WithLabelValues(string(e.StationID)).Add(e.Blocked.Seconds())
+	})
+}
@@ -0,0 +1,117 @@
+// Package health 定期探测远程工站的健康检查端点，导出最近一次心跳的时间和在线状态
+// 远程服务静默宕机时，告警规则可以在工件到达该工站之前发现
+package health
+
+import (
+	"context"
+	"industrial-4.0-demo/internal/metrics"
+	"industrial-4.0-demo/internal/types"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Probe 探测一次工站，返回 nil 表示工站在线
+type Probe func(ctx context.Context) error
+
+// target 是一个被探测的工站
+type target struct {
+	id    types.StationID
+	probe Probe
+	last  time.Time // 最近一次探测成功的时间，从未成功时为零值
+	up    bool
+}
+
+// Checker 定期探测登记的工站，更新 station_last_heartbeat_timestamp_seconds 和 station_up 指标
+type Checker struct {
+	mu         sync.Mutex
+	targets    []*target
+	timeout    time.Duration // 单次探测的超时
+	staleAfter time.Duration // 超过该时长没有心跳的工站视为离线
+	metrics    *metrics.Metrics
+	logger     *slog.Logger
+}
+
+// NewChecker 创建一个健康检查器
+// timeout 是单次探测的超时；staleAfter 是判定离线的心跳间隔，应大于探测间隔，单次探测失败不会立即判定离线
+func NewChecker(timeout, staleAfter time.Duration, m *metrics.Metrics, logger *slog.Logger) *Checker {
+	return &Checker{
+		timeout:    timeout,
+		staleAfter: staleAfter,
+		metrics:    m,
+		logger:     logger.With("component", "health"),
+	}
+}
+
+// Watch 登记一个需要探测的工站，工站在第一次探测成功前视为离线
+func (c *Checker) Watch(id types.StationID, probe Probe) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.targets = append(c.targets, &target{id: id, probe: probe})
+	c.metrics.StationUp.WithLabelValues(string(id)).Set(0)
+}
+
+// Run 立即探测一次，之后每隔 interval 探测所有登记的工站，直到 ctx 结束
+func (c *Checker) Run(ctx context.Context, interval time.Duration) {
+	c.check(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.check(ctx)
+		}
+	}
+}
+
+// check 并发探测所有工站，等待全部探测结束
+func (c *Checker) check(ctx context.Context) {
+	c.mu.Lock()
+	targets := append([]*target(nil), c.targets...)
+	c.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, t := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			probeCtx, cancel := context.WithTimeout(ctx, c.timeout)
+			err := t.probe(probeCtx)
+			cancel()
+			if ctx.Err() != nil {
+				return
+			}
+			c.record(t, err, time.Now())
+		}()
+	}
+	wg.Wait()
+}
+
+// record 记录一次探测结果并更新指标，在线状态变化时记录日志
+func (c *Checker) record(t *target, err error, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := string(t.id)
+	if err == nil {
+		t.last = now
+		c.metrics.StationLastHeartbeat.WithLabelValues(id).Set(float64(now.UnixNano()) / 1e9)
+	} else {
+		c.logger.Debug("工站健康检查失败", "station_id", t.id, "error", err)
+	}
+	up := !t.last.IsZero() && now.Sub(t.last) <= c.staleAfter
+	if up != t.up {
+		if up {
+			c.logger.Info("工站心跳恢复", "station_id", t.id)
+		} else {
+			c.logger.Warn("工站心跳超时", "station_id", t.id, "last_heartbeat", t.last, "error", err)
+		}
+		t.up = up
+	}
+	if up {
+		c.metrics.StationUp.WithLabelValues(id).Set(1)
+	} else {
+		c.metrics.StationUp.WithLabelValues(id).Set(0)
+	}
+}
@@ -0,0 +1,307 @@
+package history
+
+import (
+	"industrial-4.0-demo/internal/costing"
+	"industrial-4.0-demo/internal/types"
+	"sort"
+	"sync"
+	"time"
+)
+
+// StepRecord 记录工件在某个工站上的一次加工
+type StepRecord struct {
+	Step            int                 `json:"step"`                   // 步骤索引
+	StationID       types.StationID     `json:"station_id"`             // 工站 ID
+	QueuedAt        time.Time           `json:"queued_at,omitzero"`     // 开始等待工站资源的时间
+	StartedAt       time.Time           `json:"started_at"`             // 开始时间
+	FinishedAt      time.Time           `json:"finished_at,omitzero"`   // 结束时间，未结束时为空
+	DurationSeconds float64             `json:"duration_seconds"`       // 加工耗时 (秒)
+	Success         bool                `json:"success"`                // 是否加工成功
+	Error           string              `json:"error,omitempty"`        // 失败原因
+	Defect          *types.Defect       `json:"defect,omitempty"`       // 失败时判定的缺陷
+	Measurements    []types.Measurement `json:"measurements,omitempty"` // 工站采集的质量测量值
+	Provenance      *types.Provenance   `json:"provenance,omitempty"`   // 执行加工的设备、操作员和消耗的物料
+	Cost            *types.Cost         `json:"cost,omitempty"`         // 加工成本，未配置成本模型时为空
+}
+
+// StepOutcome 是工件在某个工站的加工结果
+type StepOutcome struct {
+	Duration     float64 // 加工耗时 (秒)
+	Error        error   // 为空时表示加工成功
+	Defect       *types.Defect
+	Measurements []types.Measurement
+	Provenance   *types.Provenance
+	Cost         *types.Cost
+}
+
+// CompensationRecord 记录一次工站补偿动作
+type CompensationRecord struct {
+	StationID types.StationID `json:"station_id"` // 执行补偿的工站
+	At        time.Time       `json:"at"`         // 补偿完成时间
+}
+
+// Record 是单个工件的完整加工履历
+type Record struct {
+	ProductID     string                 `json:"product_id"`
+	Type          string                 `json:"type"`
+	Priority      int                    `json:"priority"`
+	Attrs         map[string]interface{} `json:"attrs,omitempty"`
+	RetryOf       string                 `json:"retry_of,omitempty"`      // 重试来源的工件 ID
+	Namespace     string                 `json:"namespace,omitempty"`     // 所属的命名空间
+	Lot           string                 `json:"lot,omitempty"`           // 所属的批次
+	Serial        string                 `json:"serial,omitempty"`        // 开始生产时分配的序列号
+	TraceID       string                 `json:"trace_id,omitempty"`      // 本次生产的 Trace ID，可直接用于检索日志
+	DueAt         time.Time              `json:"due_at,omitzero"`         // 提交时指定的交期
+	QueuedAt      time.Time              `json:"queued_at,omitzero"`      // 进入调度队列的时间
+	DispatchedAt  time.Time              `json:"dispatched_at,omitzero"`  // 出队并分配到 worker 的时间
+	Worker        *int                   `json:"worker,omitempty"`        // 执行任务的 worker 编号
+	StartedAt     time.Time              `json:"started_at"`              // 开始生产时间
+	FailedAt      time.Time              `json:"failed_at,omitzero"`      // 生产失败的时间
+	FinishedAt    time.Time              `json:"finished_at,omitzero"`    // 结束时间 (完成、失败或补偿完成)
+	Outcome       string                 `json:"outcome,omitempty"`       // 最终结果: COMPLETED / FAILED / COMPENSATED
+	Failure       string                 `json:"failure,omitempty"`       // 失败原因
+	Steps         []StepRecord           `json:"steps"`                   // 按开始时间排序的步骤履历
+	Compensations []CompensationRecord   `json:"compensations,omitempty"` // 补偿履历
+	Cost          *types.Cost            `json:"cost,omitempty"`          // 各步骤加工成本的汇总 (含失败的步骤)，未配置成本模型时为空
+}
+
+// Store 是一个内存中的加工履历存储
+// 数据由事件处理器写入，事件是异步投递的，因此所有写操作都允许乱序到达
+type Store struct {
+	mu      sync.RWMutex
+	records map[string]*Record
+}
+
+// NewStore 创建一个新的履历存储
+func NewStore() *Store {
+	return &Store{records: make(map[string]*Record)}
+}
+
+// record 返回工件的履历，不存在时创建 (调用方需持有写锁)
+func (s *Store) record(productID string) *Record {
+	r, ok := s.records[productID]
+	if !ok {
+		r = &Record{ProductID: productID}
+		s.records[productID] = r
+	}
+	return r
+}
+
+// step 返回指定步骤和工站的加工记录，不存在时创建 (调用方需持有写锁)
+func (r *Record) step(index int, stationID types.StationID) *StepRecord {
+	for i := range r.Steps {
+		if r.Steps[i].Step == index && r.Steps[i].StationID == stationID {
+			return &r.Steps[i]
+		}
+	}
+	r.Steps = append(r.Steps, StepRecord{Step: index, StationID: stationID})
+	return &r.Steps[len(r.Steps)-1]
+}
+
+// Queued 记录工件进入调度队列
+func (s *Store) Queued(p *types.Product, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.record(p.ID)
+	r.Type = p.Type
+	r.Priority = p.Priority
+	r.Attrs = p.Attrs
+	r.RetryOf = p.RetryOf
+	r.Namespace = p.Namespace
+	r.Lot = p.Lot
+	r.DueAt = p.DueAt
+	r.QueuedAt = at
+}
+
+// Dispatched 记录工件出队并分配到 worker
+func (s *Store) Dispatched(productID string, worker int, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.record(productID)
+	r.DispatchedAt = at
+	r.Worker = &worker
+}
+
+// Started 记录工件开始生产
+func (s *Store) Started(p *types.Product, traceID string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.record(p.ID)
+	r.Type = p.Type
+	r.Priority = p.Priority
+	r.Attrs = p.Attrs
+	r.RetryOf = p.RetryOf
+	r.Namespace = p.Namespace
+	r.Lot = p.Lot
+	r.Serial = p.Serial
+	r.TraceID = traceID
+	r.StartedAt = at
+}
+
+// StepQueued 记录工件开始等待某个工站的资源
+func (s *Store) StepQueued(productID string, index int, stationID types.StationID, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.record(productID).step(index, stationID).QueuedAt = at
+}
+
+// StepStarted 记录工件进入某个工站
+func (s *Store) StepStarted(productID string, index int, stationID types.StationID, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.record(productID).step(index, stationID).StartedAt = at
+}
+
+// StepFinished 记录工件在某个工站的加工结果、缺陷、采集的测量值和追溯信息
+func (s *Store) StepFinished(productID string, index int, stationID types.StationID, at time.Time, outcome StepOutcome) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.record(productID)
+	step := r.step(index, stationID)
+	step.FinishedAt = at
+	step.DurationSeconds = outcome.Duration
+	step.Success = outcome.Error == nil
+	step.Defect = outcome.Defect
+	step.Measurements = outcome.Measurements
+	step.Provenance = outcome.Provenance
+	step.Cost = outcome.Cost
+	if outcome.Error != nil {
+		step.Error = outcome.Error.Error()
+	}
+	r.Cost = rollup(r.Steps)
+}
+
+// rollup 汇总各步骤的加工成本，没有步骤记录成本时返回 nil
+func rollup(steps []StepRecord) *types.Cost {
+	var total *types.Cost
+	for _, step := range steps {
+		if step.Cost == nil {
+			continue
+		}
+		if total == nil {
+			total = &types.Cost{}
+		}
+		*total = total.Add(*step.Cost)
+	}
+	if total != nil {
+		*total = costing.Round(*total)
+	}
+	return total
+}
+
+// Compensated 记录一次工站补偿
+func (s *Store) Compensated(productID string, stationID types.StationID, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.record(productID)
+	r.Compensations = append(r.Compensations, CompensationRecord{StationID: stationID, At: at})
+}
+
+// Failed 记录工件失败的原因
+// 失败之后总会进入补偿流程，补偿完成事件可能先于失败事件到达，因此不会覆盖已记录的最终结果
+func (s *Store) Failed(productID string, outcome string, failure error, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.record(productID)
+	if failure != nil {
+		r.Failure = failure.Error()
+	}
+	r.FailedAt = at
+	if r.Outcome == "" {
+		r.Outcome = outcome
+		r.FinishedAt = at
+	}
+}
+
+// Finished 记录工件的最终结果
+func (s *Store) Finished(productID string, outcome string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.record(productID)
+	r.Outcome = outcome
+	r.FinishedAt = at
+}
+
+// Archive 将工件从实时状态中移除时的最终信息写入履历
+// 在排队阶段就被取消的工件没有开始生产的事件，其基础信息只能从这里补齐；已记录的字段不会被覆盖
+func (s *Store) Archive(p *types.Product, outcome string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.record(p.ID)
+	if r.Type == "" {
+		r.Type = p.Type
+		r.Priority = p.Priority
+		r.Attrs = p.Attrs
+		r.RetryOf = p.RetryOf
+		r.Namespace = p.Namespace
+		r.Lot = p.Lot
+	}
+	if r.Outcome == "" {
+		r.Outcome = outcome
+		r.FinishedAt = at
+	}
+}
+
+// Get 返回工件履历的副本，步骤和补偿记录按时间排序
+func (s *Store) Get(productID string) (Record, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	r, ok := s.records[productID]
+	if !ok {
+		return Record{}, false
+	}
+	return r.snapshot(), true
+}
+
+// Between 返回有步骤在 [from, to] 内加工的工件履历副本，未结束的步骤视为一直加工到现在，结果按工件 ID 排序
+func (s *Store) Between(from, to time.Time) []Record {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var records []Record
+	for _, r := range s.records {
+		for _, step := range r.Steps {
+			if step.StartedAt.IsZero() || step.StartedAt.After(to) {
+				continue
+			}
+			if step.FinishedAt.IsZero() || !step.FinishedAt.Before(from) {
+				records = append(records, r.snapshot())
+				break
+			}
+		}
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ProductID < records[j].ProductID })
+	return records
+}
+
+// snapshot 返回履历的副本，步骤和补偿记录按时间排序 (调用方需持有读锁)
+func (r *Record) snapshot() Record {
+	cp := *r
+	cp.Steps = append([]StepRecord(nil), r.Steps...)
+	cp.Compensations = append([]CompensationRecord(nil), r.Compensations...)
+	if r.Worker != nil {
+		worker := *r.Worker
+		cp.Worker = &worker
+	}
+	sort.SliceStable(cp.Steps, func(i, j int) bool {
+		if cp.Steps[i].Step != cp.Steps[j].Step {
+			return cp.Steps[i].Step < cp.Steps[j].Step
+		}
+		return cp.Steps[i].StartedAt.Before(cp.Steps[j].StartedAt)
+	})
+	sort.SliceStable(cp.Compensations, func(i, j int) bool {
+		return cp.Compensations[i].At.Before(cp.Compensations[j].At)
+	})
+	return cp
+}
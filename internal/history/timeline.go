@@ -0,0 +1,75 @@
+package history
+
+import (
+	"industrial-4.0-demo/internal/types"
+	"sort"
+	"time"
+)
+
+// 时间线事件类型
+const (
+	TimelineQueued       = "queued"        // 进入调度队列
+	TimelineDispatched   = "dispatched"    // 出队并分配到 worker
+	TimelineStepQueued   = "step_queued"   // 开始等待工站资源
+	TimelineStepStarted  = "step_started"  // 开始在工站上加工
+	TimelineStepFinished = "step_finished" // 工站加工成功
+	TimelineStepFailed   = "step_failed"   // 工站加工失败
+	TimelineFailed       = "failed"        // 生产失败，随后进入补偿
+	TimelineCompensated  = "compensated"   // 单个工站补偿完成
+	TimelineFinished     = "finished"      // 生产结束，结果见 Outcome
+)
+
+// TimelineEvent 是工件时间线上的一个事件
+type TimelineEvent struct {
+	At              time.Time       `json:"at"`
+	Kind            string          `json:"kind"`
+	Step            *int            `json:"step,omitempty"`             // 步骤索引 (仅步骤事件)
+	StationID       types.StationID `json:"station_id,omitempty"`       // 工站 ID (仅步骤和补偿事件)
+	Worker          *int            `json:"worker,omitempty"`           // worker 编号 (仅派发事件)
+	DurationSeconds float64         `json:"duration_seconds,omitempty"` // 加工或排队耗时 (秒)
+	Outcome         string          `json:"outcome,omitempty"`          // 最终结果 (仅结束事件)
+	Error           string          `json:"error,omitempty"`            // 失败原因
+}
+
+// Timeline 将履历展开为按时间排序的事件列表，用于甘特图等明细视图
+// 事件异步写入，尚未发生的事件 (时间为空) 不会出现在时间线中；时间相同的事件保持业务上的先后顺序
+func (r Record) Timeline() []TimelineEvent {
+	var events []TimelineEvent
+	add := func(e TimelineEvent) {
+		if !e.At.IsZero() {
+			events = append(events, e)
+		}
+	}
+
+	add(TimelineEvent{At: r.QueuedAt, Kind: TimelineQueued})
+	dispatched := TimelineEvent{At: r.DispatchedAt, Kind: TimelineDispatched, Worker: r.Worker}
+	if !r.QueuedAt.IsZero() && !r.DispatchedAt.IsZero() {
+		dispatched.DurationSeconds = r.DispatchedAt.Sub(r.QueuedAt).Seconds()
+	}
+	add(dispatched)
+
+	for _, s := range r.Steps {
+		step := s.Step
+		add(TimelineEvent{At: s.QueuedAt, Kind: TimelineStepQueued, Step: &step, StationID: s.StationID})
+		started := TimelineEvent{At: s.StartedAt, Kind: TimelineStepStarted, Step: &step, StationID: s.StationID}
+		if !s.QueuedAt.IsZero() && !s.StartedAt.IsZero() {
+			started.DurationSeconds = s.StartedAt.Sub(s.QueuedAt).Seconds()
+		}
+		add(started)
+		finished := TimelineEvent{At: s.FinishedAt, Kind: TimelineStepFinished, Step: &step, StationID: s.StationID, DurationSeconds: s.DurationSeconds}
+		if !s.Success {
+			finished.Kind = TimelineStepFailed
+			finished.Error = s.Error
+		}
+		add(finished)
+	}
+
+	add(TimelineEvent{At: r.FailedAt, Kind: TimelineFailed, Error: r.Failure})
+	for _, c := range r.Compensations {
+		add(TimelineEvent{At: c.At, Kind: TimelineCompensated, StationID: c.StationID})
+	}
+	add(TimelineEvent{At: r.FinishedAt, Kind: TimelineFinished, Outcome: r.Outcome})
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].At.Before(events[j].At) })
+	return events
+}
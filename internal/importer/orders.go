@@ -0,0 +1,244 @@
+// Package importer 将计划员交接的订单清单 (CSV / XLSX) 解析为生产订单，并逐行校验
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Format 是订单清单的文件格式
+type Format string
+
+const (
+	FormatCSV  Format = "csv"
+	FormatXLSX Format = "xlsx"
+)
+
+// xlsxContentType 是 XLSX 文件的 MIME 类型
+const xlsxContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// DetectFormat 根据文件名、Content-Type 和文件头判断格式，XLSX 是以 PK 开头的 zip 文件，其余按 CSV 处理
+func DetectFormat(filename, contentType string, data []byte) Format {
+	switch {
+	case strings.EqualFold(path.Ext(filename), ".xlsx"),
+		strings.HasPrefix(contentType, xlsxContentType),
+		bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		return FormatXLSX
+	}
+	return FormatCSV
+}
+
+// Order 是订单清单中通过校验的一行
+type Order struct {
+	Row      int       // 在文件中的行号 (表头为第 1 行)
+	ID       string    // 订单 ID，为空时由调用方生成
+	Type     string    // 产品类型
+	Priority int       // 优先级，未填写时为 0
+	Layers   int       // 层数，未填写时为 0
+	DueDate  time.Time // 交期，未填写时为零值
+}
+
+// RowError 是某一行的校验错误
+type RowError struct {
+	Row     int    `json:"row"`              // 行号，表头为第 1 行
+	Column  string `json:"column,omitempty"` // 出错的列，整行错误时为空
+	Message string `json:"message"`
+}
+
+func (e RowError) Error() string {
+	if e.Column == "" {
+		return fmt.Sprintf("row %d: %s", e.Row, e.Message)
+	}
+	return fmt.Sprintf("row %d, column %s: %s", e.Row, e.Column, e.Message)
+}
+
+// 订单清单的列，表头不区分大小写，支持常见的别名
+const (
+	columnID       = "id"
+	columnType     = "type"
+	columnPriority = "priority"
+	columnLayers   = "layers"
+	columnDueDate  = "due_date"
+)
+
+// columnAliases 将表头中的列名映射到标准列名
+var columnAliases = map[string]string{
+	"id":           columnID,
+	"order_id":     columnID,
+	"order":        columnID,
+	"type":         columnType,
+	"product_type": columnType,
+	"priority":     columnPriority,
+	"layers":       columnLayers,
+	"layer_count":  columnLayers,
+	"due_date":     columnDueDate,
+	"due":          columnDueDate,
+	"due date":     columnDueDate,
+}
+
+// ErrMissingColumn 表示表头中缺少必需的列
+var ErrMissingColumn = errors.New("missing required column")
+
+// dueDateLayouts 是交期支持的文本格式
+var dueDateLayouts = []string{time.RFC3339, "2006-01-02 15:04", "2006-01-02", "2006/01/02"}
+
+// Parse 解析订单清单，第一行为表头，列的顺序任意，空行被忽略
+// 返回通过校验的订单和逐行的校验错误；文件无法读取或缺少 type 列时返回 error
+func Parse(data []byte, format Format) ([]Order, []RowError, error) {
+	var (
+		rows [][]string
+		err  error
+	)
+	switch format {
+	case FormatXLSX:
+		rows, err = readXLSX(data)
+	default:
+		rows, err = readCSV(data)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil, fmt.Errorf("%w: %s", ErrMissingColumn, columnType)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range rows[0] {
+		// Excel 导出的 UTF-8 CSV 以 BOM 开头
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if column, ok := columnAliases[name]; ok {
+			columns[column] = i
+		}
+	}
+	if _, ok := columns[columnType]; !ok {
+		return nil, nil, fmt.Errorf("%w: %s", ErrMissingColumn, columnType)
+	}
+
+	var (
+		orders []Order
+		errs   []RowError
+		seen   = make(map[string]int) // 订单 ID 到首次出现的行号
+	)
+	for i, record := range rows[1:] {
+		row := i + 2
+		cell := func(column string) string {
+			if idx, ok := columns[column]; ok && idx < len(record) {
+				return strings.TrimSpace(record[idx])
+			}
+			return ""
+		}
+		if isBlank(record) {
+			continue
+		}
+
+		order := Order{Row: row, ID: cell(columnID), Type: strings.ToUpper(cell(columnType))}
+		var rowErrs []RowError
+		if order.Type == "" {
+			rowErrs = append(rowErrs, RowError{Row: row, Column: columnType, Message: "product type is required"})
+		}
+		if v := cell(columnPriority); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				rowErrs = append(rowErrs, RowError{Row: row, Column: columnPriority, Message: fmt.Sprintf("invalid priority %q", v)})
+			}
+			order.Priority = n
+		}
+		if v := cell(columnLayers); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				rowErrs = append(rowErrs, RowError{Row: row, Column: columnLayers, Message: fmt.Sprintf("invalid layer count %q", v)})
+			}
+			order.Layers = n
+		}
+		if v := cell(columnDueDate); v != "" {
+			due, err := parseDueDate(v, format)
+			if err != nil {
+				rowErrs = append(rowErrs, RowError{Row: row, Column: columnDueDate, Message: fmt.Sprintf("invalid due date %q", v)})
+			}
+			order.DueDate = due
+		}
+		if order.ID != "" {
+			if first, ok := seen[order.ID]; ok {
+				rowErrs = append(rowErrs, RowError{Row: row, Column: columnID, Message: fmt.Sprintf("duplicate order id %q (first seen in row %d)", order.ID, first)})
+			} else {
+				seen[order.ID] = row
+			}
+		}
+
+		if len(rowErrs) > 0 {
+			errs = append(errs, rowErrs...)
+			continue
+		}
+		orders = append(orders, order)
+	}
+	return orders, errs, nil
+}
+
+// readCSV 读取 CSV 的所有行，允许各行的列数不同
+func readCSV(data []byte) ([][]string, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	rows, err := r.ReadAll()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("read csv: %w", err)
+	}
+	return rows, nil
+}
+
+// readXLSX 读取工作簿第一个工作表的所有行，单元格保留原始值，日期为 Excel 序列号
+func readXLSX(data []byte) ([][]string, error) {
+	f, err := excelize.OpenReader(bytes.NewReader(data), excelize.Options{RawCellValue: true})
+	if err != nil {
+		return nil, fmt.Errorf("read xlsx: %w", err)
+	}
+	defer f.Close()
+	sheets := f.GetSheetList()
+	if len(sheets) == 0 {
+		return nil, nil
+	}
+	rows, err := f.GetRows(sheets[0])
+	if err != nil {
+		return nil, fmt.Errorf("read xlsx sheet %s: %w", sheets[0], err)
+	}
+	return rows, nil
+}
+
+// parseDueDate 解析交期，XLSX 中设置了日期格式的单元格为 Excel 序列号
+func parseDueDate(v string, format Format) (time.Time, error) {
+	if format == FormatXLSX {
+		if serial, err := strconv.ParseFloat(v, 64); err == nil {
+			return excelize.ExcelDateToTime(serial, false)
+		}
+	}
+	return ParseDate(v)
+}
+
+// ParseDate 按订单清单支持的文本格式解析交期，不带时区时按本地时间解析
+func ParseDate(v string) (time.Time, error) {
+	for _, layout := range dueDateLayouts {
+		if t, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unsupported date format %q", v)
+}
+
+// isBlank 判断一行是否所有单元格都为空
+func isBlank(record []string) bool {
+	for _, v := range record {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
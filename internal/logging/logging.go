@@ -0,0 +1,136 @@
+// Package logging 提供可在运行时调整的日志级别：整体级别作用于所有日志，各组件 (engine / scheduler / station / web) 可以单独覆盖
+// 例如排查故障时只把 engine 切换到 debug，其余组件保持 info，无需重启而丢失进行中的任务
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+)
+
+// 可单独设置级别的组件
+const (
+	ComponentEngine    = "engine"    // 工作流引擎和事件处理器
+	ComponentScheduler = "scheduler" // 调度器和 WAL
+	ComponentStation   = "station"   // 本地和远程工站
+	ComponentWeb       = "web"       // HTTP API、gRPC 和实时推送
+)
+
+// Components 是所有可单独设置级别的组件
+var Components = []string{ComponentEngine, ComponentScheduler, ComponentStation, ComponentWeb}
+
+// ErrUnknownComponent 表示组件不存在
+var ErrUnknownComponent = errors.New("unknown component")
+
+// componentLevel 是一个组件的级别，未覆盖时使用整体级别
+type componentLevel struct {
+	level    slog.LevelVar
+	override atomic.Bool
+}
+
+// Levels 保存整体级别和各组件的覆盖级别，并为各组件创建按当前级别过滤的 Logger
+// 级别保存在 slog.LevelVar 中，修改后对已创建的 Logger 立即生效
+type Levels struct {
+	handler    slog.Handler
+	level      slog.LevelVar
+	components map[string]*componentLevel
+}
+
+// State 是当前的日志级别，Components 只包含被覆盖的组件
+type State struct {
+	Level      string            `json:"level"`
+	Components map[string]string `json:"components"`
+}
+
+// New 创建日志级别控制，所有 Logger 写入 h，h 自身的级别不再起作用
+func New(h slog.Handler, level slog.Level) *Levels {
+	l := &Levels{handler: h, components: make(map[string]*componentLevel, len(Components))}
+	l.level.Set(level)
+	for _, c := range Components {
+		l.components[c] = &componentLevel{}
+	}
+	return l
+}
+
+// Logger 返回组件的 Logger，component 为空时只受整体级别控制
+func (l *Levels) Logger(component string) *slog.Logger {
+	return slog.New(&levelHandler{Handler: l.handler, levels: l, component: l.components[component]})
+}
+
+// Update 校验并修改日志级别，level 为空时保持整体级别不变；components 中级别为空的组件取消覆盖，恢复使用整体级别
+// 任一级别或组件无效时不做任何修改
+func (l *Levels) Update(level string, components map[string]string) error {
+	var base slog.Level
+	if level != "" {
+		if err := base.UnmarshalText([]byte(level)); err != nil {
+			return fmt.Errorf("invalid level %q", level)
+		}
+	}
+	overrides := make(map[string]slog.Level, len(components))
+	for c, v := range components {
+		if _, ok := l.components[strings.ToLower(c)]; !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownComponent, c)
+		}
+		if v == "" {
+			continue
+		}
+		var lv slog.Level
+		if err := lv.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("invalid level %q for component %s", v, c)
+		}
+		overrides[strings.ToLower(c)] = lv
+	}
+
+	if level != "" {
+		l.level.Set(base)
+	}
+	for c, v := range components {
+		cl := l.components[strings.ToLower(c)]
+		if v == "" {
+			cl.override.Store(false)
+			continue
+		}
+		cl.level.Set(overrides[strings.ToLower(c)])
+		cl.override.Store(true)
+	}
+	return nil
+}
+
+// State 返回当前的日志级别
+func (l *Levels) State() State {
+	state := State{Level: l.level.Level().String(), Components: map[string]string{}}
+	for c, cl := range l.components {
+		if cl.override.Load() {
+			state.Components[c] = cl.level.Level().String()
+		}
+	}
+	return state
+}
+
+// levelHandler 按组件的当前级别过滤日志，其余处理交给底层 Handler
+type levelHandler struct {
+	slog.Handler
+	levels    *Levels
+	component *componentLevel // 为 nil 时只受整体级别控制
+}
+
+// Enabled 判断日志级别是否达到组件的当前级别
+func (h *levelHandler) Enabled(_ context.Context, level slog.Level) bool {
+	if h.component != nil && h.component.override.Load() {
+		return level >= h.component.level.Level()
+	}
+	return level >= h.levels.level.Level()
+}
+
+// WithAttrs 返回附加了属性的 Handler，保持同一组件的级别
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{Handler: h.Handler.WithAttrs(attrs), levels: h.levels, component: h.component}
+}
+
+// WithGroup 返回带有分组的 Handler，保持同一组件的级别
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{Handler: h.Handler.WithGroup(name), levels: h.levels, component: h.component}
+}
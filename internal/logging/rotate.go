@@ -0,0 +1,122 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat 是轮转后文件名中的时间格式，按字典序排序即按时间排序
+const backupTimeFormat = "20060102T150405.000000000"
+
+// RotatingFile 是按大小和时长轮转的日志文件
+// 当前文件写满 maxBytes 或打开超过 maxAge 后重命名为 <name>-<时间><ext>，并打开新文件；只保留最近 maxBackups 个轮转后的文件
+type RotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxBytes   int64         // <= 0 时不按大小轮转
+	maxAge     time.Duration // <= 0 时不按时长轮转
+	maxBackups int           // <= 0 时保留全部
+	file       *os.File
+	size       int64
+	openedAt   time.Time
+}
+
+// OpenRotatingFile 创建或打开日志文件并追加写入，目录不存在时自动创建
+// 文件时长从打开时开始计算，重启后重新计时
+func OpenRotatingFile(path string, maxBytes int64, maxAge time.Duration, maxBackups int) (*RotatingFile, error) {
+	f := &RotatingFile{path: path, maxBytes: maxBytes, maxAge: maxAge, maxBackups: maxBackups}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := f.openLocked(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write 写入一条日志，写入前按需轮转；slog 的每条记录只调用一次 Write，不会被拆分到两个文件中
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.shouldRotateLocked(len(p)) {
+		if err := f.rotateLocked(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close 关闭当前文件
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+// shouldRotateLocked 判断写入 n 字节前是否需要轮转，空文件不会因大小轮转，调用方必须持有锁
+func (f *RotatingFile) shouldRotateLocked(n int) bool {
+	if f.maxBytes > 0 && f.size > 0 && f.size+int64(n) > f.maxBytes {
+		return true
+	}
+	return f.maxAge > 0 && time.Since(f.openedAt) >= f.maxAge
+}
+
+// openLocked 打开当前文件，调用方必须持有锁
+func (f *RotatingFile) openLocked() error {
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size, f.openedAt = file, info.Size(), time.Now()
+	return nil
+}
+
+// rotateLocked 重命名当前文件并打开新文件，然后清理多余的轮转文件，调用方必须持有锁
+func (f *RotatingFile) rotateLocked() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	ext := filepath.Ext(f.path)
+	backup := strings.TrimSuffix(f.path, ext) + "-" + time.Now().Format(backupTimeFormat) + ext
+	if err := os.Rename(f.path, backup); err != nil {
+		return err
+	}
+	if err := f.openLocked(); err != nil {
+		return err
+	}
+	f.pruneLocked()
+	return nil
+}
+
+// pruneLocked 删除最早的轮转文件，只保留最近 maxBackups 个，删除失败时留待下次轮转，调用方必须持有锁
+func (f *RotatingFile) pruneLocked() {
+	if f.maxBackups <= 0 {
+		return
+	}
+	backups := f.backupsLocked()
+	if len(backups) <= f.maxBackups {
+		return
+	}
+	for _, b := range backups[:len(backups)-f.maxBackups] {
+		os.Remove(b)
+	}
+}
+
+// backupsLocked 返回轮转后的文件，按时间从早到晚排序，调用方必须持有锁
+func (f *RotatingFile) backupsLocked() []string {
+	ext := filepath.Ext(f.path)
+	matches, _ := filepath.Glob(strings.TrimSuffix(f.path, ext) + "-*" + ext)
+	slices.Sort(matches)
+	return matches
+}
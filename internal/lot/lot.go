@@ -0,0 +1,238 @@
+// Package lot 将数量为 N 的订单拆分为 N 块拼板 (panel)，每块拼板作为独立的工件流转，按批次 (lot) 汇总进度
+// 所有拼板结束后在事件总线上发布 LotCompleted 事件；批次只保存在内存中，重试产生的工件不计入批次
+package lot
+
+import (
+	"errors"
+	"fmt"
+	"industrial-4.0-demo/internal/event"
+	"industrial-4.0-demo/internal/types"
+	"log/slog"
+	"maps"
+	"sync"
+	"time"
+)
+
+// MaxQuantity 是一个批次最多拆分的拼板数
+const MaxQuantity = 1000
+
+// 批次的状态
+const (
+	StatusInProcess = "IN_PROCESS" // 仍有拼板未结束
+	StatusCompleted = "COMPLETED"  // 所有拼板都已完成
+	StatusPartial   = "PARTIAL"    // 所有拼板都已结束，部分失败或取消
+	StatusFailed    = "FAILED"     // 所有拼板都已结束，没有完成的拼板
+)
+
+// 拼板的状态
+const (
+	PanelQueued    = "queued"     // 等待开始生产
+	PanelInProcess = "in_process" // 正在生产
+	PanelCompleted = "completed"
+	PanelFailed    = "failed"
+	PanelCancelled = "cancelled"
+)
+
+// 拆分批次时可能返回的错误
+var (
+	ErrExists          = errors.New("lot already exists")                   // 批次 ID 已被使用
+	ErrInvalidQuantity = fmt.Errorf("quantity must be 1 ~ %d", MaxQuantity) // 数量超出范围
+)
+
+// Panel 是批次中的一块拼板
+type Panel struct {
+	ID         string    `json:"id"`
+	Status     string    `json:"status"`
+	FinishedAt time.Time `json:"finished_at,omitzero"`
+}
+
+// Progress 是批次的进度，FirstFinishedAt 和 LastFinishedAt 是最早和最晚结束的拼板的结束时间
+type Progress struct {
+	ID              string    `json:"id"`
+	Type            string    `json:"type"`
+	Namespace       string    `json:"namespace,omitempty"`
+	Quantity        int       `json:"quantity"`
+	Status          string    `json:"status"`
+	Queued          int       `json:"queued"`
+	InProcess       int       `json:"in_process"`
+	Completed       int       `json:"completed"`
+	Failed          int       `json:"failed"`
+	Cancelled       int       `json:"cancelled"`
+	CreatedAt       time.Time `json:"created_at"`
+	FirstFinishedAt time.Time `json:"first_finished_at,omitzero"`
+	LastFinishedAt  time.Time `json:"last_finished_at,omitzero"`
+	Panels          []Panel   `json:"panels"`
+}
+
+// lot 是一个批次，panels 按拼板序号排列
+type lot struct {
+	id        string
+	product   types.Product // 拆分前的订单
+	createdAt time.Time
+	panels    []Panel
+	index     map[string]int // 拼板 ID 到序号
+	done      bool           // 已发布 LotCompleted 事件
+}
+
+// Tracker 拆分批次并订阅工件事件汇总批次进度
+type Tracker struct {
+	mu     sync.Mutex
+	lots   map[string]*lot
+	bus    *event.Bus
+	logger *slog.Logger
+}
+
+// NewTracker 创建一个批次追踪器
+func NewTracker(logger *slog.Logger) *Tracker {
+	return &Tracker{lots: make(map[string]*lot), logger: logger}
+}
+
+// Register 订阅工件的开始和结束事件，批次的所有拼板结束时在同一事件总线上发布 LotCompleted 事件
+// 工件被补偿时已先发布 ProductFailed 事件，补偿的结果不影响批次进度
+func (t *Tracker) Register(bus *event.Bus) {
+	t.mu.Lock()
+	t.bus = bus
+	t.mu.Unlock()
+	bus.Subscribe(event.ProductStarted, func(e event.Event) { t.record(e, PanelInProcess) })
+	bus.Subscribe(event.ProductCompleted, func(e event.Event) { t.record(e, PanelCompleted) })
+	bus.Subscribe(event.ProductFailed, func(e event.Event) { t.record(e, PanelFailed) })
+	bus.Subscribe(event.ProductCancelled, func(e event.Event) { t.record(e, PanelCancelled) })
+}
+
+// Split 将数量为 quantity 的订单拆分为拼板，批次 ID 为订单 ID，拼板 ID 为批次 ID 加上 _P001、_P002 等序号
+// 拼板继承订单的类型、优先级、属性和命名空间，调用方负责提交返回的拼板
+func (t *Tracker) Split(order types.Product, quantity int) ([]*types.Product, error) {
+	if quantity < 1 || quantity > MaxQuantity {
+		return nil, ErrInvalidQuantity
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.lots[order.ID]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrExists, order.ID)
+	}
+	l := &lot{
+		id:        order.ID,
+		product:   order,
+		createdAt: time.Now(),
+		panels:    make([]Panel, quantity),
+		index:     make(map[string]int, quantity),
+	}
+	panels := make([]*types.Product, quantity)
+	for i := range panels {
+		p := order
+		p.ID = fmt.Sprintf("%s_P%03d", order.ID, i+1)
+		p.Lot = order.ID
+		p.Attrs = maps.Clone(order.Attrs)
+		if p.Attrs == nil {
+			p.Attrs = make(map[string]interface{})
+		}
+		panels[i] = &p
+		l.panels[i] = Panel{ID: p.ID, Status: PanelQueued}
+		l.index[p.ID] = i
+	}
+	t.lots[l.id] = l
+	return panels, nil
+}
+
+// record 更新拼板的状态，结束的拼板不再变化；开始事件是异步处理的，可能晚于结束事件到达
+func (t *Tracker) record(e event.Event, status string) {
+	if e.Product == nil || e.Product.Lot == "" {
+		return
+	}
+	t.mu.Lock()
+	l, ok := t.lots[e.Product.Lot]
+	if !ok {
+		t.mu.Unlock()
+		return
+	}
+	i, ok := l.index[e.ProductID]
+	if !ok || !l.panels[i].FinishedAt.IsZero() {
+		t.mu.Unlock()
+		return
+	}
+	l.panels[i].Status = status
+	if status != PanelInProcess {
+		l.panels[i].FinishedAt = e.Timestamp
+	}
+	progress := l.progress()
+	publish := progress.Status != StatusInProcess && !l.done
+	if publish {
+		l.done = true
+	}
+	bus := t.bus
+	t.mu.Unlock()
+
+	if publish {
+		t.logger.Info("批次已结束", "lot_id", progress.ID, "status", progress.Status,
+			"completed", progress.Completed, "failed", progress.Failed, "cancelled", progress.Cancelled)
+		bus.Publish(event.Event{
+			Type:      event.LotCompleted,
+			Timestamp: progress.LastFinishedAt,
+			Lot: &event.LotSummary{
+				ID:        progress.ID,
+				Status:    progress.Status,
+				Quantity:  progress.Quantity,
+				Completed: progress.Completed,
+				Failed:    progress.Failed,
+				Cancelled: progress.Cancelled,
+			},
+		})
+	}
+}
+
+// Get 返回批次的进度
+func (t *Tracker) Get(id string) (Progress, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	l, ok := t.lots[id]
+	if !ok {
+		return Progress{}, false
+	}
+	return l.progress(), true
+}
+
+// progress 汇总批次的进度，调用方必须持有 t.mu
+func (l *lot) progress() Progress {
+	p := Progress{
+		ID:        l.id,
+		Type:      l.product.Type,
+		Namespace: l.product.Namespace,
+		Quantity:  len(l.panels),
+		CreatedAt: l.createdAt,
+		Panels:    make([]Panel, len(l.panels)),
+	}
+	copy(p.Panels, l.panels)
+	for _, panel := range l.panels {
+		switch panel.Status {
+		case PanelQueued:
+			p.Queued++
+		case PanelInProcess:
+			p.InProcess++
+		case PanelCompleted:
+			p.Completed++
+		case PanelFailed:
+			p.Failed++
+		case PanelCancelled:
+			p.Cancelled++
+		}
+		if at := panel.FinishedAt; !at.IsZero() {
+			if p.FirstFinishedAt.IsZero() || at.Before(p.FirstFinishedAt) {
+				p.FirstFinishedAt = at
+			}
+			if at.After(p.LastFinishedAt) {
+				p.LastFinishedAt = at
+			}
+		}
+	}
+	switch {
+	case p.Queued+p.InProcess > 0:
+		p.Status = StatusInProcess
+	case p.Completed == p.Quantity:
+		p.Status = StatusCompleted
+	case p.Completed > 0:
+		p.Status = StatusPartial
+	default:
+		p.Status = StatusFailed
+	}
+	return p
+}
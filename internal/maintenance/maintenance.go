@@ -0,0 +1,329 @@
+// Package maintenance 根据步骤耗时漂移和失败率触发基于状态的维护
+// 工站在规则的统计窗口内的耗时异常次数或步骤失败率达到阈值时创建维护工单，并附上触发时的证据；规则可以同时让工站进入维护模式
+// 同一工站同一规则同时只有一张未关闭的工单，工单关闭后只统计关闭之后的加工，避免旧的证据立即再次触发
+package maintenance
+
+import (
+	"errors"
+	"fmt"
+	"industrial-4.0-demo/internal/engine"
+	"industrial-4.0-demo/internal/event"
+	"industrial-4.0-demo/internal/metrics"
+	"industrial-4.0-demo/internal/types"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// 触发工单的原因
+const (
+	ReasonDrift       = "duration_drift" // 窗口内的耗时异常次数达到阈值
+	ReasonFailureRate = "failure_rate"   // 窗口内的步骤失败率达到阈值
+)
+
+// 工单的状态
+const (
+	StatusOpen   = "open"
+	StatusClosed = "closed"
+)
+
+// 操作工单时可能返回的错误
+var (
+	ErrNotFound = errors.New("work order not found")
+	ErrClosed   = errors.New("work order already closed")
+)
+
+// Rule 是一条维护规则，Anomalies 和 FailureRate 至少设置一个，任意一个达到阈值即触发
+type Rule struct {
+	Name        string
+	Stations    []types.StationID // 适用的工站，为空时适用于所有工站
+	Window      time.Duration     // 统计窗口
+	Anomalies   int               // 窗口内耗时异常 (StationAnomaly) 的次数达到该值时触发，0 表示不检查
+	FailureRate float64           // 窗口内的步骤失败率达到该值时触发，0 表示不检查
+	MinSteps    int               // 计算失败率需要的最少步骤数，步骤数不足时不检查失败率
+	Maintenance bool              // 触发时让工站进入维护模式 (停用)，工单关闭时重新启用
+}
+
+// AnomalyEvidence 是一次耗时异常
+type AnomalyEvidence struct {
+	At              time.Time `json:"at"`
+	ProductID       string    `json:"product_id"`
+	TraceID         string    `json:"trace_id,omitempty"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	MeanSeconds     float64   `json:"mean_seconds"`
+	ZScore          float64   `json:"z_score"`
+}
+
+// Evidence 是触发工单时统计窗口内的数据
+type Evidence struct {
+	From           time.Time         `json:"from"`
+	To             time.Time         `json:"to"`
+	Steps          int               `json:"steps"`
+	FailedSteps    int               `json:"failed_steps"`
+	FailureRate    float64           `json:"failure_rate"`
+	FailedProducts []string          `json:"failed_products,omitempty"` // 加工失败的工件
+	Anomalies      []AnomalyEvidence `json:"anomalies,omitempty"`
+}
+
+// WorkOrder 是一张维护工单
+type WorkOrder struct {
+	ID          string          `json:"id"`
+	StationID   types.StationID `json:"station_id"`
+	Rule        string          `json:"rule"`
+	Reason      string          `json:"reason"`      // duration_drift / failure_rate
+	Status      string          `json:"status"`      // open / closed
+	Maintenance bool            `json:"maintenance"` // 创建时让工站进入了维护模式
+	CreatedAt   time.Time       `json:"created_at"`
+	ClosedAt    time.Time       `json:"closed_at,omitzero"`
+	ClosedBy    string          `json:"closed_by,omitempty"`
+	Note        string          `json:"note,omitempty"` // 关闭时的备注
+	Evidence    Evidence        `json:"evidence"`
+}
+
+// Stations 是工单进入和退出维护模式时操作的工站注册表
+type Stations interface {
+	Disable(id types.StationID) (engine.StationInfo, error)
+	Enable(id types.StationID) (engine.StationInfo, error)
+}
+
+// step 是工站上的一次加工
+type step struct {
+	at        time.Time
+	failed    bool
+	productID string
+}
+
+// stationLog 记录保留时长内一个工站的加工和耗时异常
+type stationLog struct {
+	steps     []step
+	anomalies []AnomalyEvidence
+}
+
+// key 标识一个工站上的一条规则
+type key struct {
+	station types.StationID
+	rule    string
+}
+
+// Tracker 订阅步骤完成和耗时异常事件，按规则创建维护工单
+type Tracker struct {
+	mu       sync.Mutex
+	rules    []Rule
+	logs     map[types.StationID]*stationLog
+	orders   []*WorkOrder       // 按创建顺序排列
+	open     map[key]*WorkOrder // 未关闭的工单
+	since    map[key]time.Time  // 工单关闭的时间，之后的加工才计入该规则
+	nextID   int
+	stations Stations
+	bus      *event.Bus
+	metrics  *metrics.Metrics
+	logger   *slog.Logger
+}
+
+// NewTracker 创建一个维护追踪器，stations 用于让工站进入和退出维护模式
+func NewTracker(rules []Rule, stations Stations, m *metrics.Metrics, logger *slog.Logger) *Tracker {
+	return &Tracker{
+		rules:    rules,
+		logs:     make(map[types.StationID]*stationLog),
+		open:     make(map[key]*WorkOrder),
+		since:    make(map[key]time.Time),
+		stations: stations,
+		metrics:  m,
+		logger:   logger,
+	}
+}
+
+// SetRules 替换维护规则，已创建的工单不受影响
+func (t *Tracker) SetRules(rules []Rule) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rules = rules
+}
+
+// Register 订阅步骤完成和耗时异常事件，创建工单时在同一事件总线上发布 MaintenanceDue 事件
+// 被停用的工站拒绝的步骤 (StepRejected) 没有加工，不计入失败率
+func (t *Tracker) Register(bus *event.Bus) {
+	t.mu.Lock()
+	t.bus = bus
+	t.mu.Unlock()
+	bus.Subscribe(event.StepCompleted, func(e event.Event) {
+		t.observe(e.StationID, e.Timestamp, func(log *stationLog) {
+			log.steps = append(log.steps, step{at: e.Timestamp, failed: e.Error != nil, productID: e.ProductID})
+		})
+	})
+	bus.Subscribe(event.StationAnomaly, func(e event.Event) {
+		t.observe(e.StationID, e.Timestamp, func(log *stationLog) {
+			log.anomalies = append(log.anomalies, AnomalyEvidence{
+				At:              e.Timestamp,
+				ProductID:       e.ProductID,
+				TraceID:         e.TraceID,
+				DurationSeconds: e.Anomaly.DurationSeconds,
+				MeanSeconds:     e.Anomaly.MeanSeconds,
+				ZScore:          e.Anomaly.ZScore,
+			})
+		})
+	})
+}
+
+// observe 记录一次加工或耗时异常，然后检查适用于该工站的规则
+func (t *Tracker) observe(id types.StationID, at time.Time, record func(*stationLog)) {
+	t.mu.Lock()
+	log, ok := t.logs[id]
+	if !ok {
+		log = &stationLog{}
+		t.logs[id] = log
+	}
+	record(log)
+	t.pruneLocked(log, at)
+
+	var created []*WorkOrder
+	for _, rule := range t.rules {
+		k := key{station: id, rule: rule.Name}
+		if _, ok := t.open[k]; ok || (len(rule.Stations) > 0 && !slices.Contains(rule.Stations, id)) {
+			continue
+		}
+		from := at.Add(-rule.Window)
+		if since := t.since[k]; since.After(from) {
+			from = since
+		}
+		evidence := collect(log, from, at)
+		reason := ""
+		switch {
+		case rule.Anomalies > 0 && len(evidence.Anomalies) >= rule.Anomalies:
+			reason = ReasonDrift
+		case rule.FailureRate > 0 && evidence.Steps >= max(rule.MinSteps, 1) && evidence.FailureRate >= rule.FailureRate:
+			reason = ReasonFailureRate
+		default:
+			continue
+		}
+		t.nextID++
+		order := &WorkOrder{
+			ID:          fmt.Sprintf("WO-%04d", t.nextID),
+			StationID:   id,
+			Rule:        rule.Name,
+			Reason:      reason,
+			Status:      StatusOpen,
+			Maintenance: rule.Maintenance,
+			CreatedAt:   at,
+			Evidence:    evidence,
+		}
+		t.orders = append(t.orders, order)
+		t.open[k] = order
+		created = append(created, order)
+	}
+	bus := t.bus
+	t.mu.Unlock()
+
+	for _, order := range created {
+		t.metrics.MaintenanceWorkOrdersTotal.WithLabelValues(string(order.StationID), order.Reason).Inc()
+		t.logger.Warn("已创建维护工单", "work_order", order.ID, "station_id", order.StationID, "rule", order.Rule, "reason", order.Reason,
+			"steps", order.Evidence.Steps, "failure_rate", order.Evidence.FailureRate, "anomalies", len(order.Evidence.Anomalies))
+		if order.Maintenance {
+			if _, err := t.stations.Disable(order.StationID); err != nil {
+				t.logger.Error("工站进入维护模式失败", "work_order", order.ID, "station_id", order.StationID, "error", err)
+			}
+		}
+		if bus != nil {
+			bus.Publish(event.Event{
+				Type:      event.MaintenanceDue,
+				StationID: order.StationID,
+				Timestamp: order.CreatedAt,
+				WorkOrder: &event.WorkOrderSummary{ID: order.ID, Rule: order.Rule, Reason: order.Reason, Maintenance: order.Maintenance},
+			})
+		}
+	}
+}
+
+// collect 统计 [from, to] 内的加工和耗时异常
+func collect(log *stationLog, from, to time.Time) Evidence {
+	ev := Evidence{From: from, To: to}
+	in := func(at time.Time) bool { return !at.Before(from) && !at.After(to) }
+	for _, s := range log.steps {
+		if !in(s.at) {
+			continue
+		}
+		ev.Steps++
+		if s.failed {
+			ev.FailedSteps++
+			ev.FailedProducts = append(ev.FailedProducts, s.productID)
+		}
+	}
+	if ev.Steps > 0 {
+		ev.FailureRate = float64(ev.FailedSteps) / float64(ev.Steps)
+	}
+	for _, a := range log.anomalies {
+		if in(a.At) {
+			ev.Anomalies = append(ev.Anomalies, a)
+		}
+	}
+	return ev
+}
+
+// pruneLocked 丢弃早于所有规则的统计窗口的记录
+func (t *Tracker) pruneLocked(log *stationLog, now time.Time) {
+	var retention time.Duration
+	for _, rule := range t.rules {
+		retention = max(retention, rule.Window)
+	}
+	cutoff := now.Add(-retention)
+	log.steps = slices.DeleteFunc(log.steps, func(s step) bool { return s.at.Before(cutoff) })
+	log.anomalies = slices.DeleteFunc(log.anomalies, func(a AnomalyEvidence) bool { return a.At.Before(cutoff) })
+}
+
+// List 返回所有工单，按创建时间排序，status 不为空时只返回该状态的工单
+func (t *Tracker) List(status string) []WorkOrder {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	list := []WorkOrder{}
+	for _, order := range t.orders {
+		if status == "" || order.Status == status {
+			list = append(list, *order)
+		}
+	}
+	return list
+}
+
+// Get 返回工单
+func (t *Tracker) Get(id string) (WorkOrder, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, order := range t.orders {
+		if order.ID == id {
+			return *order, true
+		}
+	}
+	return WorkOrder{}, false
+}
+
+// Close 关闭工单，工单让工站进入了维护模式时重新启用工站
+func (t *Tracker) Close(id, by, note string) (WorkOrder, error) {
+	t.mu.Lock()
+	i := slices.IndexFunc(t.orders, func(o *WorkOrder) bool { return o.ID == id })
+	if i < 0 {
+		t.mu.Unlock()
+		return WorkOrder{}, ErrNotFound
+	}
+	order := t.orders[i]
+	if order.Status == StatusClosed {
+		t.mu.Unlock()
+		return *order, ErrClosed
+	}
+	order.Status = StatusClosed
+	order.ClosedAt = time.Now()
+	order.ClosedBy = by
+	order.Note = note
+	k := key{station: order.StationID, rule: order.Rule}
+	delete(t.open, k)
+	t.since[k] = order.ClosedAt
+	closed := *order
+	t.mu.Unlock()
+
+	if closed.Maintenance {
+		if _, err := t.stations.Enable(closed.StationID); err != nil {
+			t.logger.Error("工站退出维护模式失败", "work_order", closed.ID, "station_id", closed.StationID, "error", err)
+		}
+	}
+	t.logger.Info("维护工单已关闭", "work_order", closed.ID, "station_id", closed.StationID, "closed_by", by)
+	return closed, nil
+}
@@ -0,0 +1,21 @@
+package metrics
+
+import "time"
+
+// ObserveBuild 记录二进制的版本信息和加载的配置摘要，process_uptime_seconds 从 started 开始计算
+func (m *Metrics) ObserveBuild(version, commit, goVersion, configHash string, started time.Time) {
+	m.BuildInfo.Reset()
+	m.BuildInfo.WithLabelValues(version, commit, goVersion).Set(1)
+	m.ConfigInfo.Reset()
+	m.ConfigInfo.WithLabelValues(configHash).Set(1)
+	m.mu.Lock()
+	m.started = started
+	m.mu.Unlock()
+}
+
+// uptime 返回进程的运行时长，未调用 ObserveBuild 时从创建指标时开始计算
+func (m *Metrics) uptime() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return time.Since(m.started).Seconds()
+}
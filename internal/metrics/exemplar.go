@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ObserveWithTrace 观测一个值，并附带 trace_id 和 product_id 作为 exemplar，
+// 以便在 Grafana 中从直方图的慢桶直接跳转到对应工件的时间线 (接入链路追踪后跳转到 trace)
+// traceID 为空时只做普通观测；标签总长度超过 exemplar 的上限时省略 product_id
+func ObserveWithTrace(o prometheus.Observer, v float64, traceID, productID string) {
+	eo, ok := o.(prometheus.ExemplarObserver)
+	if !ok || traceID == "" {
+		o.Observe(v)
+		return
+	}
+	labels := prometheus.Labels{"trace_id": traceID}
+	if exemplarRunes(labels)+utf8.RuneCountInString("product_id")+utf8.RuneCountInString(productID) <= prometheus.ExemplarMaxRunes {
+		labels["product_id"] = productID
+	}
+	if exemplarRunes(labels) > prometheus.ExemplarMaxRunes {
+		o.Observe(v)
+		return
+	}
+	eo.ObserveWithExemplar(v, labels)
+}
+
+// exemplarRunes 返回 exemplar 标签名和值的总字符数
+func exemplarRunes(labels prometheus.Labels) int {
+	n := 0
+	for name, value := range labels {
+		n += utf8.RuneCountInString(name) + utf8.RuneCountInString(value)
+	}
+	return n
+}
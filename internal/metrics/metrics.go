@@ -1,31 +1,580 @@
 package metrics
 
 import (
+	"sync"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
-// 定义 Prometheus 监控指标
-var (
+// Metrics 是编排器的全部 Prometheus 指标
+// 由 New 创建一次，注入调度器、事件处理器、推送 Hub、API 等组件；指标注册在调用方提供的注册表上，同一进程中的多个应用实例 (例如测试) 互不影响
+type Metrics struct {
+	registry *prometheus.Registry
+
 	// TasksInQueue 仪表盘：当前队列中的任务数量
-	// 用于监控系统积压情况
-	TasksInQueue = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "scheduler_tasks_in_queue",
-		Help: "The number of tasks currently waiting in the priority queue",
-	})
+	// 按命名空间 (产线) 分类，用于监控各产线的积压情况
+	TasksInQueue *prometheus.GaugeVec
 
 	// TasksProcessedTotal 计数器：处理完成的任务总数
-	// 按状态 (success/failed) 和产品类型分类
-	TasksProcessedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
-		Name: "scheduler_tasks_processed_total",
-		Help: "The total number of processed tasks",
-	}, []string{"status", "type"})
+	// 按状态 (success/failed)、产品类型和命名空间分类
+	TasksProcessedTotal *prometheus.CounterVec
 
 	// StationProcessingDuration 直方图：工站处理耗时分布
-	// 用于分析各工站的性能瓶颈
-	StationProcessingDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	// 按工站和命名空间分类，用于分析各工站的性能瓶颈
+	StationProcessingDuration *prometheus.HistogramVec
+
+	// WorkflowStepDuration 直方图：按产品类型和工作流版本细分的工站处理耗时分布
+	// 同一工站加工不同产品 (例如双层板与多层板钻孔) 的耗时差异很大，用于对比各工作流的步骤耗时；同时按命名空间分类
+	WorkflowStepDuration *prometheus.HistogramVec
+
+	// StationOEEAvailability / StationOEEPerformance / StationOEEQuality / StationOEEOverall 仪表盘：
+	// 各工站在统计窗口内的设备综合效率 (OEE) 及其三个分量，取值 0 ~ 1，由 oee.Tracker 定期刷新
+	StationOEEAvailability *prometheus.GaugeVec
+	StationOEEPerformance  *prometheus.GaugeVec
+	StationOEEQuality      *prometheus.GaugeVec
+	StationOEEOverall      *prometheus.GaugeVec
+
+	// StationFirstPassYield / ProductFirstPassYield 仪表盘：各工站和各产品类型在统计窗口内的直通率 (首次加工或首次生产即成功的比例)，取值 0 ~ 1，由 oee.Tracker 定期刷新
+	StationFirstPassYield *prometheus.GaugeVec
+	ProductFirstPassYield *prometheus.GaugeVec
+
+	// ScrapTotal 计数器：生产失败报废的工件数
+	// 按产品类型和命名空间分类，包括重试后仍失败的工件
+	ScrapTotal *prometheus.CounterVec
+
+	// ScrappedProductsTotal 计数器：超过返工上限或缺陷处置为报废的工件数，按产品类型、判定报废的工站、缺陷代码和命名空间分类
+	// 与 ScrapTotal 不同，等待返工的失败工件不计入
+	ScrappedProductsTotal *prometheus.CounterVec
+
+	// ScrapCostTotal 计数器：报废成本 (物料成本 + 谱系中的工站加工成本)，按产品类型、判定报废的工站和命名空间分类
+	ScrapCostTotal *prometheus.CounterVec
+
+	// ProductFinalYield / StationYield 仪表盘：各产品类型在统计窗口内的最终良率 (含返工) 和各工站的加工良率，取值 0 ~ 1，由 yield.Tracker 定期刷新
+	ProductFinalYield *prometheus.GaugeVec
+	StationYield      *prometheus.GaugeVec
+
+	// StationStepFailureRate 仪表盘：各工站在统计窗口内加工失败的步骤比例，取值 0 ~ 1，由 reliability.Tracker 定期刷新
+	StationStepFailureRate *prometheus.GaugeVec
+
+	// StationMTBF / StationMTTR 仪表盘：各工站在统计窗口内的平均故障间隔和平均修复时间，窗口内没有故障或修复的工站不导出
+	StationMTBF *prometheus.GaugeVec
+	StationMTTR *prometheus.GaugeVec
+
+	// StationStepDurationZScore 仪表盘：各工站最近一个步骤耗时相对 EWMA 基线的 z-score，基线积累完成前不导出
+	StationStepDurationZScore *prometheus.GaugeVec
+
+	// StationAnomaliesTotal 计数器：步骤耗时偏离基线超过阈值的次数
+	// 按工站和方向 (slow/fast) 分类
+	StationAnomaliesTotal *prometheus.CounterVec
+
+	// StationLastHeartbeat 仪表盘：远程工站最近一次健康检查成功的 Unix 时间戳 (秒)，从未成功的工站不导出
+	StationLastHeartbeat *prometheus.GaugeVec
+
+	// StationUp 仪表盘：远程工站是否在线 (1/0)，超过 health_check.stale_after_seconds 没有心跳即为离线
+	StationUp *prometheus.GaugeVec
+
+	// ThroughputUnitsPerHour 仪表盘：统计窗口内各产品类型每小时完成的工件数，由 throughput.Tracker 定期刷新
+	ThroughputUnitsPerHour *prometheus.GaugeVec
+
+	// TaktTimeSeconds 仪表盘：统计窗口内各产品类型相邻两个完成工件的平均间隔 (滚动节拍)
+	TaktTimeSeconds *prometheus.GaugeVec
+
+	// StationQueueTimeShare 仪表盘：统计窗口内各工站的排队时间占所有工站排队时间的比例，占比最高的工站即瓶颈
+	StationQueueTimeShare *prometheus.GaugeVec
+
+	// StationWIP / StationWIPLimit / StationWIPBlocked 仪表盘：各工站占用看板的在制品数、在制品上限 (0 表示不限制) 和等待看板的上游工件数
+	StationWIP        *prometheus.GaugeVec
+	StationWIPLimit   *prometheus.GaugeVec
+	StationWIPBlocked *prometheus.GaugeVec
+
+	// StationBlockedSeconds 计数器：工件因工站在制品达到上限而停留在上游的累计时长 (秒)，按被等待的工站分类
+	StationBlockedSeconds *prometheus.CounterVec
+
+	// ProductLeadTime 直方图：工件从提交 (进入调度队列) 到完成或失败的端到端交期
+	// 按产品类型、最终状态 (success/failed) 和命名空间分类，包含排队、工站间移动和资源等待的时间
+	ProductLeadTime *prometheus.HistogramVec
+
+	// SLAOnTimeDeliveryRatio 仪表盘：统计窗口内各产品类型有交期的工件按期完成的比例，取值 0 ~ 1，由 sla.Tracker 定期刷新
+	SLAOnTimeDeliveryRatio *prometheus.GaugeVec
+
+	// SLABreachesTotal 计数器：预测会延期 (kind=predicted) 和超过交期 (kind=breached) 的工件数，按产品类型和命名空间分类
+	SLABreachesTotal *prometheus.CounterVec
+
+	// SLAAtRiskProducts 仪表盘：当前预测会延期或已超过交期、尚未完成的工件数
+	SLAAtRiskProducts prometheus.Gauge
+
+	// AuthFailuresTotal 计数器：认证失败次数
+	// 按失败原因 (missing/invalid/forbidden) 分类
+	AuthFailuresTotal *prometheus.CounterVec
+
+	// RateLimitedRequestsTotal 计数器：被限流拒绝的请求数
+	// 按路由分类
+	RateLimitedRequestsTotal *prometheus.CounterVec
+
+	// APIRequestsTotal 计数器：HTTP 请求数
+	// 按路由模式 (例如 GET /api/v1/tasks/{id}) 和状态码分类
+	APIRequestsTotal *prometheus.CounterVec
+
+	// APIRequestDuration 直方图：HTTP 请求耗时分布
+	// 按路由模式分类，WebSocket 和 SSE 路由记录的是连接的持续时间
+	APIRequestDuration *prometheus.HistogramVec
+
+	// WebSocketClients 仪表盘：当前连接的推送客户端数量 (WebSocket、SSE 和 gRPC 订阅者)
+	WebSocketClients prometheus.Gauge
+
+	// HubBroadcastDuration 直方图：一条广播分发到所有客户端发送缓冲区的耗时
+	// 包括过滤和序列化，不包括实际写入连接
+	HubBroadcastDuration prometheus.Histogram
+
+	// HubDroppedMessagesTotal 计数器：未能放入客户端发送缓冲区的消息数
+	// 按原因分类：slow_client (缓冲区已满，客户端被断开) / marshal_error (序列化失败)
+	HubDroppedMessagesTotal *prometheus.CounterVec
+
+	// PushWriteErrorsTotal 计数器：向推送连接写入失败的次数
+	// 按传输方式 (websocket/sse) 分类，写入失败后连接会被关闭
+	PushWriteErrorsTotal *prometheus.CounterVec
+
+	// AlertsRaisedTotal 计数器：推送到安灯板的告警数
+	// 按告警类型和级别分类
+	AlertsRaisedTotal *prometheus.CounterVec
+
+	// AlertsUnresolved 仪表盘：安灯板上未解决 (OPEN 或 ACKNOWLEDGED) 的告警数，按级别分类
+	AlertsUnresolved *prometheus.GaugeVec
+
+	// SubmitDuration 直方图：SubmitTask 的耗时，包括写入 WAL、等待调度器锁和入堆
+	SubmitDuration prometheus.Histogram
+
+	// DispatchLatency 直方图：任务从提交到分派给 worker 的耗时，包括排队和等待空闲 worker 的时间，按命名空间分类
+	DispatchLatency *prometheus.HistogramVec
+
+	// NamespaceActiveTasks 仪表盘：各命名空间已出队 (等待 worker 或执行中) 的任务数
+	NamespaceActiveTasks *prometheus.GaugeVec
+
+	// NamespaceWorkerQuota 仪表盘：各命名空间可以同时占用的 worker 数上限，只包含配置了配额的命名空间
+	NamespaceWorkerQuota *prometheus.GaugeVec
+
+	// QueueOperationDuration 直方图：优先级队列 (堆) 操作的耗时
+	// 按操作 (push/pop/remove) 分类，不包括等待调度器锁的时间
+	QueueOperationDuration *prometheus.HistogramVec
+
+	// WALOperationDuration 直方图：WAL 写入的耗时，包括 fsync
+	// 按操作 (append/checkpoint/complete/cancel) 分类
+	WALOperationDuration *prometheus.HistogramVec
+
+	// WorkersBusy / WorkersMax 仪表盘：正在执行任务的 worker 数和 worker 池大小 (MaxWorkers)
+	WorkersBusy prometheus.Gauge
+	WorkersMax  prometheus.Gauge
+
+	// WorkerBusySeconds 计数器：worker 执行任务的累计时间 (worker·秒)
+	// rate(scheduler_worker_busy_seconds_total[5m]) / scheduler_workers_max 即为这段时间的平均利用率
+	WorkerBusySeconds prometheus.CounterFunc
+
+	// WorkersSaturatedSeconds 计数器：所有 worker 都在执行任务且仍有任务等待的累计时间
+	// rate(scheduler_workers_saturated_seconds_total[5m]) 是这段时间内处于饱和状态的比例，持续偏高说明需要增加 worker
+	WorkersSaturatedSeconds prometheus.CounterFunc
+
+	// BuildInfo 仪表盘：固定为 1，标签记录二进制的版本、提交和 Go 版本
+	BuildInfo *prometheus.GaugeVec
+
+	// ConfigInfo 仪表盘：固定为 1，标签记录加载的配置的摘要，配置不同的实例摘要不同
+	ConfigInfo *prometheus.GaugeVec
+
+	// Uptime 仪表盘：进程的运行时长
+	Uptime prometheus.GaugeFunc
+
+	// PushFailuresTotal 计数器：推送到 Pushgateway 失败的次数
+	PushFailuresTotal prometheus.Counter
+
+	// FeatureFlagEnabled 仪表盘：功能开关是否打开 (1/0)，按开关名称分类
+	FeatureFlagEnabled *prometheus.GaugeVec
+
+	// MaintenanceWorkOrdersTotal 计数器：维护规则创建的工单数
+	// 按工站和原因 (duration_drift/failure_rate) 分类
+	MaintenanceWorkOrdersTotal *prometheus.CounterVec
+
+	// QualityOutOfSpecTotal 计数器：超出规格界限的质量测量值数
+	// 按工站、测量项和命名空间分类
+	QualityOutOfSpecTotal *prometheus.CounterVec
+
+	// DefectsTotal 计数器：失败步骤判定的缺陷数
+	// 按工站、缺陷类别、处置方式 (scrap/rework/hold) 和命名空间分类
+	DefectsTotal *prometheus.CounterVec
+
+	// ChaosFaultsInjectedTotal 计数器：故障注入生效的次数
+	// 按工站和故障种类 (failure/latency/drop_compensation/crash) 分类
+	ChaosFaultsInjectedTotal *prometheus.CounterVec
+
+	// SparkplugMessagesPublishedTotal 计数器：发布到 MQTT Broker 的 Sparkplug B 消息数
+	// 按消息类型 (NBIRTH/NDEATH/NDATA/DBIRTH/DDEATH/DDATA) 分类
+	SparkplugMessagesPublishedTotal *prometheus.CounterVec
+
+	// B2MMLSegmentRequirementsTotal 计数器：导入的 B2MML 排产计划中的段需求数
+	// 按来源 (http/dir) 和结果 (accepted/rejected) 分类
+	B2MMLSegmentRequirementsTotal *prometheus.CounterVec
+
+	// ERPPollsTotal 计数器：轮询 ERP 订单来源的次数，按结果 (success/error) 分类
+	ERPPollsTotal *prometheus.CounterVec
+
+	// ERPOrdersTotal 计数器：从 ERP 读取的订单数，按结果 (submitted/duplicate/rejected) 分类
+	ERPOrdersTotal *prometheus.CounterVec
+
+	// ERPLastSuccessTimestamp 仪表盘：最近一次成功轮询 ERP 的 Unix 时间戳
+	ERPLastSuccessTimestamp prometheus.Gauge
+
+	// ClusterLeader 仪表盘：本节点是否是集群的领导者 (1 是，0 否)
+	ClusterLeader prometheus.Gauge
+
+	// ClusterLeaderChangesTotal 计数器：本节点成为领导者的次数
+	ClusterLeaderChangesTotal prometheus.Counter
+
+	// WorkQueueDeliveriesTotal 计数器：工作队列投递的结果 (acked / redelivered / dead)
+	WorkQueueDeliveriesTotal *prometheus.CounterVec
+
+	// WorkQueuePending 仪表盘：工作队列中等待 worker 拉取的任务数
+	WorkQueuePending prometheus.Gauge
+
+	// WorkQueueLeased 仪表盘：worker 正在执行、尚未确认的任务数
+	WorkQueueLeased prometheus.Gauge
+
+	// NotificationsTotal 计数器：通知的投递结果，按通道、事件和结果 (sent/failed/rate_limited/dropped) 分类
+	NotificationsTotal *prometheus.CounterVec
+
+	// NotificationDeliveryDuration 直方图：投递一条通知的耗时，按通道分类
+	NotificationDeliveryDuration *prometheus.HistogramVec
+
+	busyWorkerTime timeIntegral // 正在执行任务的 worker 数对时间的积分
+	saturatedTime  timeIntegral // worker 池处于饱和状态的累计时间
+
+	mu      sync.Mutex
+	started time.Time // 进程启动时间，由 ObserveBuild 设置
+}
+
+// NewRegistry 创建一个注册了 Go 运行时和进程指标的注册表，与 Prometheus 默认注册表导出的基础指标一致
+func NewRegistry() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	return reg
+}
+
+// New 创建全部指标并注册到 reg，/metrics 和 Pushgateway 推送都从 reg 采集；同一个注册表只能调用一次
+func New(reg *prometheus.Registry) *Metrics {
+	f := promauto.With(reg)
+	m := &Metrics{registry: reg, started: time.Now()}
+	m.TasksInQueue = f.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "scheduler_tasks_in_queue",
+		Help: "The number of tasks currently waiting in the priority queue",
+	}, []string{"namespace"})
+	m.TasksProcessedTotal = f.NewCounterVec(prometheus.CounterOpts{
+		Name: "scheduler_tasks_processed_total",
+		Help: "The total number of processed tasks",
+	}, []string{"status", "type", "namespace"})
+	m.StationProcessingDuration = f.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "station_processing_duration_seconds",
 		Help:    "Time spent in each station",
 		Buckets: prometheus.DefBuckets,
+	}, []string{"station_id", "namespace"})
+	m.WorkflowStepDuration = f.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "workflow_step_duration_seconds",
+		Help:    "Time spent in each station, by product type and workflow version",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"station_id", "type", "workflow_version", "namespace"})
+	m.StationOEEAvailability = f.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "station_oee_availability",
+		Help: "Station availability (run time / planned production time) over the OEE window",
 	}, []string{"station_id"})
-)
+	m.StationOEEPerformance = f.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "station_oee_performance",
+		Help: "Station performance (ideal cycle time x count / processing time) over the OEE window",
+	}, []string{"station_id"})
+	m.StationOEEQuality = f.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "station_oee_quality",
+		Help: "Station quality (good steps / total steps) over the OEE window",
+	}, []string{"station_id"})
+	m.StationOEEOverall = f.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "station_oee_overall",
+		Help: "Station overall equipment effectiveness over the OEE window",
+	}, []string{"station_id"})
+	m.StationFirstPassYield = f.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "station_first_pass_yield",
+		Help: "Share of first-pass steps (excluding rework after a retry) that succeeded at each station over the OEE window",
+	}, []string{"station_id"})
+	m.ProductFirstPassYield = f.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "product_first_pass_yield",
+		Help: "Share of first-attempt products of each type that completed without a retry over the OEE window",
+	}, []string{"type"})
+	m.ScrapTotal = f.NewCounterVec(prometheus.CounterOpts{
+		Name: "scrap_total",
+		Help: "The total number of failed (scrapped) products",
+	}, []string{"type", "namespace"})
+	m.ScrappedProductsTotal = f.NewCounterVec(prometheus.CounterOpts{
+		Name: "scrapped_products_total",
+		Help: "The total number of products scrapped after exhausting rework or with a scrap disposition",
+	}, []string{"type", "station_id", "reason", "namespace"})
+	m.ScrapCostTotal = f.NewCounterVec(prometheus.CounterOpts{
+		Name: "scrap_cost_total",
+		Help: "The total cost of scrapped products (unit cost plus station processing cost of the lineage)",
+	}, []string{"type", "station_id", "namespace"})
+	m.ProductFinalYield = f.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "product_final_yield",
+		Help: "Share of finished products of each type that completed (including after rework) rather than being scrapped over the yield window",
+	}, []string{"type"})
+	m.StationYield = f.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "station_yield",
+		Help: "Share of steps that succeeded at each station over the yield window",
+	}, []string{"station_id"})
+	m.StationStepFailureRate = f.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "station_step_failure_rate",
+		Help: "Share of failed steps per station over the reliability window",
+	}, []string{"station_id"})
+	m.StationMTBF = f.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "station_mtbf_seconds",
+		Help: "Mean time between station breakdowns over the reliability window",
+	}, []string{"station_id"})
+	m.StationMTTR = f.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "station_mttr_seconds",
+		Help: "Mean time to recover from a station breakdown over the reliability window",
+	}, []string{"station_id"})
+	m.StationStepDurationZScore = f.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "station_step_duration_zscore",
+		Help: "Z-score of the latest step duration of each station against its EWMA baseline",
+	}, []string{"station_id"})
+	m.StationAnomaliesTotal = f.NewCounterVec(prometheus.CounterOpts{
+		Name: "station_anomalies_total",
+		Help: "The total number of step durations that deviated from the station baseline beyond the z-score threshold",
+	}, []string{"station_id", "direction"})
+	m.StationLastHeartbeat = f.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "station_last_heartbeat_timestamp_seconds",
+		Help: "Unix time of the last successful health check of each remote station",
+	}, []string{"station_id"})
+	m.StationUp = f.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "station_up",
+		Help: "Whether each remote station answered a health check within the staleness window (1) or not (0)",
+	}, []string{"station_id"})
+	m.ThroughputUnitsPerHour = f.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "throughput_units_per_hour",
+		Help: "Completed units per hour over the throughput window",
+	}, []string{"type"})
+	m.TaktTimeSeconds = f.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "throughput_takt_time_seconds",
+		Help: "Rolling takt time (mean interval between completions) over the throughput window",
+	}, []string{"type"})
+	m.StationQueueTimeShare = f.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "station_queue_time_share",
+		Help: "Share of total queue time spent waiting for each station over the throughput window",
+	}, []string{"station_id"})
+	m.StationWIP = f.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "station_wip",
+		Help: "The number of products holding a kanban of each station",
+	}, []string{"station_id"})
+	m.StationWIPLimit = f.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "station_wip_limit",
+		Help: "The WIP limit of each station, 0 means unlimited",
+	}, []string{"station_id"})
+	m.StationWIPBlocked = f.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "station_wip_blocked",
+		Help: "The number of upstream products blocked because the station is at its WIP limit",
+	}, []string{"station_id"})
+	m.StationBlockedSeconds = f.NewCounterVec(prometheus.CounterOpts{
+		Name: "station_blocked_seconds_total",
+		Help: "The total time products spent blocked upstream waiting for a kanban of each station",
+	}, []string{"station_id"})
+	m.ProductLeadTime = f.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "product_lead_time_seconds",
+		Help:    "End-to-end time from task submission to completion or failure",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12), // 1s ~ 34min
+	}, []string{"type", "status", "namespace"})
+	m.SLAOnTimeDeliveryRatio = f.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sla_on_time_delivery_ratio",
+		Help: "Share of products with a due date completed on time over the SLA window",
+	}, []string{"type"})
+	m.SLABreachesTotal = f.NewCounterVec(prometheus.CounterOpts{
+		Name: "sla_breaches_total",
+		Help: "The total number of products predicted to miss (kind=predicted) or having missed (kind=breached) their due date",
+	}, []string{"type", "kind", "namespace"})
+	m.SLAAtRiskProducts = f.NewGauge(prometheus.GaugeOpts{
+		Name: "sla_at_risk_products",
+		Help: "The number of unfinished products predicted to miss or having missed their due date",
+	})
+	m.AuthFailuresTotal = f.NewCounterVec(prometheus.CounterOpts{
+		Name: "api_auth_failures_total",
+		Help: "The total number of rejected API authentication attempts",
+	}, []string{"reason"})
+	m.RateLimitedRequestsTotal = f.NewCounterVec(prometheus.CounterOpts{
+		Name: "api_rate_limited_requests_total",
+		Help: "The total number of API requests rejected by the rate limiter",
+	}, []string{"route"})
+	m.APIRequestsTotal = f.NewCounterVec(prometheus.CounterOpts{
+		Name: "api_requests_total",
+		Help: "The total number of HTTP requests",
+	}, []string{"route", "status"})
+	m.APIRequestDuration = f.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "api_request_duration_seconds",
+		Help:    "Time spent serving HTTP requests",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route"})
+	m.WebSocketClients = f.NewGauge(prometheus.GaugeOpts{
+		Name: "websocket_connected_clients",
+		Help: "The number of currently connected WebSocket clients",
+	})
+	m.HubBroadcastDuration = f.NewHistogram(prometheus.HistogramOpts{
+		Name:    "hub_broadcast_duration_seconds",
+		Help:    "Time spent fanning out a broadcast message to all clients",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 2, 12), // 100us ~ 200ms
+	})
+	m.HubDroppedMessagesTotal = f.NewCounterVec(prometheus.CounterOpts{
+		Name: "hub_dropped_messages_total",
+		Help: "The total number of push messages dropped before reaching a client",
+	}, []string{"reason"})
+	m.PushWriteErrorsTotal = f.NewCounterVec(prometheus.CounterOpts{
+		Name: "push_write_errors_total",
+		Help: "The total number of failed writes to push connections",
+	}, []string{"transport"})
+	m.AlertsRaisedTotal = f.NewCounterVec(prometheus.CounterOpts{
+		Name: "alerts_raised_total",
+		Help: "The total number of alerts raised on the andon board",
+	}, []string{"kind", "severity"})
+	m.AlertsUnresolved = f.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "alerts_unresolved",
+		Help: "The number of open or acknowledged alerts on the andon board",
+	}, []string{"severity"})
+
+	m.SubmitDuration = f.NewHistogram(prometheus.HistogramOpts{
+		Name:    "scheduler_submit_duration_seconds",
+		Help:    "Time spent in SubmitTask, including the WAL append, waiting for the scheduler lock and the heap push",
+		Buckets: prometheus.ExponentialBuckets(0.00001, 4, 10), // 10us ~ 2.6s
+	})
+	m.DispatchLatency = f.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "scheduler_dispatch_latency_seconds",
+		Help:    "Time from task submission until the task is handed to a worker",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 12), // 100us ~ 7min
+	}, []string{"namespace"})
+	m.NamespaceActiveTasks = f.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "scheduler_namespace_active_tasks",
+		Help: "The number of dequeued tasks (waiting for a worker or running) by namespace",
+	}, []string{"namespace"})
+	m.NamespaceWorkerQuota = f.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "scheduler_namespace_worker_quota",
+		Help: "The maximum number of workers a namespace may occupy at the same time",
+	}, []string{"namespace"})
+	m.QueueOperationDuration = f.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "scheduler_queue_operation_duration_seconds",
+		Help:    "Time spent in priority queue heap operations",
+		Buckets: prometheus.ExponentialBuckets(0.0000001, 4, 10), // 100ns ~ 26ms
+	}, []string{"op"})
+	m.WALOperationDuration = f.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "wal_operation_duration_seconds",
+		Help:    "Time spent writing and syncing WAL entries",
+		Buckets: prometheus.ExponentialBuckets(0.00001, 4, 10), // 10us ~ 2.6s
+	}, []string{"op"})
+
+	m.WorkersBusy = f.NewGauge(prometheus.GaugeOpts{
+		Name: "scheduler_workers_busy",
+		Help: "The number of workers currently executing a task",
+	})
+	m.WorkersMax = f.NewGauge(prometheus.GaugeOpts{
+		Name: "scheduler_workers_max",
+		Help: "The configured size of the worker pool",
+	})
+	m.WorkerBusySeconds = f.NewCounterFunc(prometheus.CounterOpts{
+		Name: "scheduler_worker_busy_seconds_total",
+		Help: "Total worker-seconds spent executing tasks",
+	}, m.busyWorkerTime.read)
+	m.WorkersSaturatedSeconds = f.NewCounterFunc(prometheus.CounterOpts{
+		Name: "scheduler_workers_saturated_seconds_total",
+		Help: "Total seconds during which every worker was busy and tasks were still waiting",
+	}, m.saturatedTime.read)
+	m.BuildInfo = f.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "build_info",
+		Help: "A metric with a constant '1' value labeled by version, commit and go_version of the running binary",
+	}, []string{"version", "commit", "go_version"})
+	m.ConfigInfo = f.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "config_info",
+		Help: "A metric with a constant '1' value labeled by the hash of the loaded configuration",
+	}, []string{"hash"})
+	m.Uptime = f.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "process_uptime_seconds",
+		Help: "Seconds since the orchestrator process started",
+	}, m.uptime)
+	m.PushFailuresTotal = f.NewCounter(prometheus.CounterOpts{
+		Name: "metrics_push_failures_total",
+		Help: "The total number of failed pushes to the Pushgateway",
+	})
+	m.FeatureFlagEnabled = f.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "feature_flag_enabled",
+		Help: "Whether a feature flag is enabled (1) or disabled (0)",
+	}, []string{"flag"})
+	m.MaintenanceWorkOrdersTotal = f.NewCounterVec(prometheus.CounterOpts{
+		Name: "maintenance_work_orders_total",
+		Help: "The total number of maintenance work orders raised by condition-based maintenance rules",
+	}, []string{"station_id", "reason"})
+	m.QualityOutOfSpecTotal = f.NewCounterVec(prometheus.CounterOpts{
+		Name: "quality_out_of_spec_total",
+		Help: "The total number of quality measurements outside their specification limits",
+	}, []string{"station_id", "measurement", "namespace"})
+	m.DefectsTotal = f.NewCounterVec(prometheus.CounterOpts{
+		Name: "defects_total",
+		Help: "The total number of defects recorded for failed steps, by defect category and disposition",
+	}, []string{"station_id", "category", "disposition", "namespace"})
+	m.ChaosFaultsInjectedTotal = f.NewCounterVec(prometheus.CounterOpts{
+		Name: "chaos_faults_injected_total",
+		Help: "The total number of times an injected chaos fault took effect, by station and fault kind",
+	}, []string{"station_id", "kind"})
+	m.SparkplugMessagesPublishedTotal = f.NewCounterVec(prometheus.CounterOpts{
+		Name: "sparkplug_messages_published_total",
+		Help: "The total number of Sparkplug B messages published to the MQTT broker, by message type",
+	}, []string{"message_type"})
+	m.B2MMLSegmentRequirementsTotal = f.NewCounterVec(prometheus.CounterOpts{
+		Name: "b2mml_segment_requirements_total",
+		Help: "The total number of segment requirements imported from B2MML production schedules, by source and result",
+	}, []string{"source", "result"})
+	m.ERPPollsTotal = f.NewCounterVec(prometheus.CounterOpts{
+		Name: "erp_polls_total",
+		Help: "The total number of times the ERP order source was polled, by result",
+	}, []string{"result"})
+	m.ERPOrdersTotal = f.NewCounterVec(prometheus.CounterOpts{
+		Name: "erp_orders_total",
+		Help: "The total number of orders read from the ERP order source, by import result",
+	}, []string{"result"})
+	m.ERPLastSuccessTimestamp = f.NewGauge(prometheus.GaugeOpts{
+		Name: "erp_last_success_timestamp_seconds",
+		Help: "The Unix time of the last successful poll of the ERP order source",
+	})
+	m.ClusterLeader = f.NewGauge(prometheus.GaugeOpts{
+		Name: "cluster_is_leader",
+		Help: "Whether this orchestrator instance currently holds the cluster leader lease (1) or not (0)",
+	})
+	m.ClusterLeaderChangesTotal = f.NewCounter(prometheus.CounterOpts{
+		Name: "cluster_leader_elections_total",
+		Help: "The total number of times this orchestrator instance was elected cluster leader",
+	})
+	m.WorkQueueDeliveriesTotal = f.NewCounterVec(prometheus.CounterOpts{
+		Name: "work_queue_deliveries_total",
+		Help: "The total number of work queue deliveries by result",
+	}, []string{"result"})
+	m.WorkQueuePending = f.NewGauge(prometheus.GaugeOpts{
+		Name: "work_queue_pending",
+		Help: "The number of tasks waiting in the work queue for a worker",
+	})
+	m.WorkQueueLeased = f.NewGauge(prometheus.GaugeOpts{
+		Name: "work_queue_leased",
+		Help: "The number of tasks being executed by workers and not yet acknowledged",
+	})
+	m.NotificationsTotal = f.NewCounterVec(prometheus.CounterOpts{
+		Name: "notifications_total",
+		Help: "The total number of notifications by channel, event and delivery result",
+	}, []string{"channel", "event", "result"})
+	m.NotificationDeliveryDuration = f.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "notification_delivery_duration_seconds",
+		Help:    "Time spent delivering a notification to a channel",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"channel"})
+	return m
+}
+
+// Registry 返回指标注册的注册表，供 /metrics 和 Pushgateway 推送采集
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
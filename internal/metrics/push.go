@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// 推送的超时时间和未配置时的推送间隔
+const (
+	pushTimeout         = 10 * time.Second
+	defaultPushInterval = 15 * time.Second
+)
+
+// Pusher 定期将注册表中的全部指标推送到 Pushgateway，供无法被 Prometheus 抓取的边缘部署使用
+// 推送的内容与 /metrics 相同，指标仍然只在 New 中注册
+type Pusher struct {
+	pusher   *push.Pusher
+	failures prometheus.Counter
+	logger   *slog.Logger
+}
+
+// NewPusher 创建推送器，url 是 Pushgateway 的地址，指标按 job 和 instance 分组，每次推送替换该分组下的全部指标
+func (m *Metrics) NewPusher(url, job, instance string, logger *slog.Logger) *Pusher {
+	return &Pusher{
+		pusher:   push.New(url, job).Gatherer(m.registry).Grouping("instance", instance),
+		failures: m.PushFailuresTotal,
+		logger:   logger.With("component", "metrics_push"),
+	}
+}
+
+// Run 每隔 interval (<= 0 时为 15 秒) 推送一次指标，直到 ctx 结束；结束时再推送一次，让 Pushgateway 保留退出前的最终值
+// 推送失败只记录日志和 metrics_push_failures_total，下一个周期重试
+func (p *Pusher) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultPushInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			p.push(context.Background())
+			return
+		case <-ticker.C:
+			p.push(ctx)
+		}
+	}
+}
+
+// push 推送一次指标
+func (p *Pusher) push(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, pushTimeout)
+	defer cancel()
+	if err := p.pusher.PushContext(ctx); err != nil {
+		p.failures.Inc()
+		p.logger.Warn("推送指标到 Pushgateway 失败", "error", err)
+	}
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// timeIntegral 对随时间阶跃变化的数值求时间积分
+// 数值只在调度器状态变化时更新，抓取时把当前这段也计算在内，长时间不变的状态同样能在每次抓取时看到累计值的增长
+type timeIntegral struct {
+	mu    sync.Mutex
+	value float64   // 当前数值
+	since time.Time // 当前数值开始的时间
+	total float64   // 之前各段的累计值
+}
+
+// set 在 now 时刻将数值切换为 v
+func (t *timeIntegral) set(v float64, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.since.IsZero() {
+		t.total += t.value * now.Sub(t.since).Seconds()
+	}
+	t.value, t.since = v, now
+}
+
+// read 返回截至当前的累计值
+func (t *timeIntegral) read() float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.since.IsZero() {
+		return t.total
+	}
+	return t.total + t.value*time.Since(t.since).Seconds()
+}
+
+// ObserveWorkers 记录 worker 池的最新占用情况，waiting 是仍在等待 worker 的任务数
+// 由调度器在队列或 worker 占用变化时调用
+func (m *Metrics) ObserveWorkers(busy, max, waiting int) {
+	now := time.Now()
+	m.WorkersBusy.Set(float64(busy))
+	m.WorkersMax.Set(float64(max))
+	m.busyWorkerTime.set(float64(busy), now)
+	saturated := 0.0
+	if max > 0 && busy >= max && waiting > 0 {
+		saturated = 1
+	}
+	m.saturatedTime.set(saturated, now)
+}
@@ -0,0 +1,37 @@
+package notify
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// limiter 是单个通道的令牌桶，限制通道的发送频率
+// 不使用 ratelimit 包：它依赖 auth 和 config，config 又依赖本包的 Options
+type limiter struct {
+	mu       sync.Mutex
+	rate     float64 // 每秒补充的令牌数
+	burst    float64 // 桶容量
+	tokens   float64
+	lastSeen time.Time
+}
+
+// newLimiter 创建一个装满令牌的令牌桶
+func newLimiter(rate float64, burst int) *limiter {
+	return &limiter{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// allow 尝试消耗一个令牌
+func (l *limiter) allow(now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.lastSeen.IsZero() {
+		l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.lastSeen).Seconds()*l.rate)
+	}
+	l.lastSeen = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
@@ -0,0 +1,80 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// sendMail 通过 SMTP 发送一封纯文本邮件；服务器支持 STARTTLS 时先升级为 TLS，配置了用户名时使用 PLAIN 认证
+// net/smtp 的 SendMail 不支持 ctx，这里自己拨号，ctx 的截止时间同时作为连接的读写超时
+func sendMail(ctx context.Context, o SMTPOptions, subject, text string) error {
+	host, _, err := net.SplitHostPort(o.Addr)
+	if err != nil {
+		return err
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", o.Addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return fmt.Errorf("starttls: %w", err)
+		}
+	}
+	if o.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", o.Username, o.Password, host)); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+	if err := c.Mail(o.From); err != nil {
+		return err
+	}
+	for _, to := range o.To {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("rcpt %s: %w", to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message(o, subject, text)); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// message 生成 UTF-8 纯文本邮件，主题按 RFC 2047 编码
+func message(o SMTPOptions, subject, text string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", o.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(o.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(text, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
@@ -0,0 +1,479 @@
+// Package notify 在关键结果 (工件失败、补偿完成、补偿失败、工站故障停机) 发生时通过 webhook、
+// Slack 兼容的 webhook 或邮件通知值班人员，没有人盯着看板时故障同样能被及时处理
+//
+// 通知在后台按通道投递，事件处理器不会阻塞在慢速的通道上；每个通道可以按事件过滤、用模板定制消息并限制发送频率。
+// 投递结果通过 GET /api/v1/notifications 和 notifications_total 指标查看
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"industrial-4.0-demo/internal/event"
+	"industrial-4.0-demo/internal/fsm"
+	"industrial-4.0-demo/internal/metrics"
+	"industrial-4.0-demo/internal/types"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// 通知的事件，用于通道的 events 过滤和 notifications_total 的 event 标签
+const (
+	EventProductFailed      = "product_failed"      // 工件生产失败
+	EventProductCompensated = "product_compensated" // 失败的工件补偿完成
+	EventCompensationFailed = "compensation_failed" // 单个工站补偿失败，需要人工处理
+	EventStationDown        = "station_down"        // 工站故障停机
+	EventTest               = "test"                // 通过 API 发送的测试通知，不受事件过滤
+)
+
+// Events 是可以在 events 中配置的事件
+var Events = []string{EventProductFailed, EventProductCompensated, EventCompensationFailed, EventStationDown}
+
+// 通道类型
+const (
+	ChannelWebhook = "webhook" // 以 JSON 发送完整的通知
+	ChannelSlack   = "slack"   // Slack 兼容的 incoming webhook，只发送 {"text": ...}
+	ChannelSMTP    = "smtp"    // 邮件
+)
+
+// 通知的级别
+const (
+	SeverityCritical = "critical"
+	SeverityWarning  = "warning"
+)
+
+// 投递结果，用于 notifications_total 的 result 标签和投递记录
+const (
+	ResultSent        = "sent"         // 投递成功
+	ResultFailed      = "failed"       // 投递失败
+	ResultRateLimited = "rate_limited" // 超过通道的发送频率，丢弃
+	ResultDropped     = "dropped"      // 发送队列已满，丢弃
+)
+
+// DefaultTemplate 是未配置 template 时的消息模板
+const DefaultTemplate = "[{{.Severity}}] {{.Summary}}"
+
+// DefaultSubject 是未配置 subject 时的邮件主题模板
+const DefaultSubject = "[industrial-4.0-demo] {{.Severity}}: {{.Event}}"
+
+// maxRecent 是投递状态中保留的最近投递记录数
+const maxRecent = 50
+
+// Options 定义通知的通道，channels 为空时不启用
+type Options struct {
+	Channels       []Channel `mapstructure:"channels"`
+	QueueSize      int       `mapstructure:"queue_size"`      // 等待投递的通知数上限，队列满时新通知被丢弃
+	TimeoutSeconds int       `mapstructure:"timeout_seconds"` // 单次投递的超时
+}
+
+// Enabled 判断是否配置了通道
+func (o Options) Enabled() bool {
+	return len(o.Channels) > 0
+}
+
+// Channel 定义一个通知通道
+type Channel struct {
+	Name          string            `mapstructure:"name"`            // 通道名称，用于指标标签和投递记录
+	Type          string            `mapstructure:"type"`            // webhook / slack / smtp
+	URL           string            `mapstructure:"url"`             // webhook 和 slack 的地址
+	Headers       map[string]string `mapstructure:"headers"`         // webhook 的请求头，例如 Authorization
+	Events        []string          `mapstructure:"events"`          // 通知的事件，为空时通知全部事件
+	Template      string            `mapstructure:"template"`        // 消息正文的 text/template 模板，为空时使用 DefaultTemplate
+	Subject       string            `mapstructure:"subject"`         // 邮件主题的模板，为空时使用 DefaultSubject
+	RatePerMinute float64           `mapstructure:"rate_per_minute"` // 每分钟最多发送的通知数，为 0 时不限制
+	Burst         int               `mapstructure:"burst"`           // 允许的突发通知数
+	SMTP          SMTPOptions       `mapstructure:"smtp"`
+}
+
+// SMTPOptions 定义邮件通道的服务器和收件人
+type SMTPOptions struct {
+	Addr     string   `mapstructure:"addr"` // host:port
+	Username string   `mapstructure:"username"`
+	Password string   `mapstructure:"password"`
+	From     string   `mapstructure:"from"`
+	To       []string `mapstructure:"to"`
+}
+
+// Validate 检查通道的类型、地址、事件和模板
+func (c Channel) Validate() error {
+	if c.Name == "" {
+		return errors.New("name is required")
+	}
+	switch c.Type {
+	case ChannelWebhook, ChannelSlack:
+		if u, err := url.Parse(c.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("url is not a valid HTTP URL: %q", c.URL)
+		}
+	case ChannelSMTP:
+		if _, _, err := net.SplitHostPort(c.SMTP.Addr); err != nil {
+			return fmt.Errorf("smtp.addr must be host:port: %q", c.SMTP.Addr)
+		}
+		if c.SMTP.From == "" || len(c.SMTP.To) == 0 {
+			return errors.New("smtp.from and smtp.to are required")
+		}
+	default:
+		return fmt.Errorf("unknown type %q (webhook, slack or smtp)", c.Type)
+	}
+	for _, e := range c.Events {
+		if !slices.Contains(Events, e) {
+			return fmt.Errorf("unknown event %q", e)
+		}
+	}
+	if c.RatePerMinute < 0 || c.Burst < 0 {
+		return errors.New("rate_per_minute and burst must not be negative")
+	}
+	if _, _, err := c.templates(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// templates 解析通道的正文和主题模板
+func (c Channel) templates() (*template.Template, *template.Template, error) {
+	text := c.Template
+	if text == "" {
+		text = DefaultTemplate
+	}
+	subject := c.Subject
+	if subject == "" {
+		subject = DefaultSubject
+	}
+	body, err := template.New(c.Name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, nil, fmt.Errorf("template: %w", err)
+	}
+	title, err := template.New(c.Name + "_subject").Option("missingkey=zero").Parse(subject)
+	if err != nil {
+		return nil, nil, fmt.Errorf("subject: %w", err)
+	}
+	return body, title, nil
+}
+
+// Notification 是一条通知，同时是模板的数据和 webhook 的请求体
+type Notification struct {
+	Event       string          `json:"event"`
+	Severity    string          `json:"severity"`
+	Summary     string          `json:"summary"`        // 默认的一句话描述
+	Text        string          `json:"text,omitempty"` // 按通道模板渲染的消息正文
+	ProductID   string          `json:"product_id,omitempty"`
+	ProductType string          `json:"product_type,omitempty"`
+	Namespace   string          `json:"namespace,omitempty"`
+	StationID   types.StationID `json:"station_id,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	TraceID     string          `json:"trace_id,omitempty"`
+	Time        time.Time       `json:"time"`
+}
+
+// Delivery 是一次投递的记录
+type Delivery struct {
+	Time      time.Time `json:"time"`
+	Channel   string    `json:"channel"`
+	Event     string    `json:"event"`
+	ProductID string    `json:"product_id,omitempty"`
+	StationID string    `json:"station_id,omitempty"`
+	Result    string    `json:"result"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// ChannelStatus 是一个通道的投递统计
+type ChannelStatus struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	Events      []string `json:"events"`
+	Sent        int      `json:"sent"`
+	Failed      int      `json:"failed"`
+	RateLimited int      `json:"rate_limited"`
+	Dropped     int      `json:"dropped"`
+}
+
+// Status 是通知的投递状态
+type Status struct {
+	Channels []ChannelStatus `json:"channels"`
+	Recent   []Delivery      `json:"recent"` // 最近的投递记录，最新的在前
+}
+
+// channel 是解析了模板和限流器的通道
+type channel struct {
+	Channel
+	body    *template.Template
+	subject *template.Template
+	limiter *limiter // 为 nil 时不限制
+	status  ChannelStatus
+}
+
+// accepts 判断通道是否需要通知该事件
+func (c *channel) accepts(e string) bool {
+	return e == EventTest || len(c.Events) == 0 || slices.Contains(c.Events, e)
+}
+
+// job 是等待投递的通知
+type job struct {
+	channel *channel
+	n       Notification
+}
+
+// Notifier 订阅事件总线上的关键事件，并在后台将通知投递到各个通道
+type Notifier struct {
+	channels []*channel
+	queue    chan job
+	client   *http.Client
+	timeout  time.Duration
+	metrics  *metrics.Metrics
+	logger   *slog.Logger
+
+	mu     sync.Mutex
+	recent []Delivery
+}
+
+// New 创建通知器，通道的配置不合法时返回错误
+func New(opts Options, m *metrics.Metrics, logger *slog.Logger) (*Notifier, error) {
+	timeout := time.Duration(opts.TimeoutSeconds) * time.Second
+	n := &Notifier{
+		queue:   make(chan job, max(opts.QueueSize, 1)),
+		client:  &http.Client{Timeout: timeout},
+		timeout: timeout,
+		metrics: m,
+		logger:  logger.With("component", "notify"),
+		recent:  []Delivery{},
+	}
+	for i, c := range opts.Channels {
+		if err := c.Validate(); err != nil {
+			return nil, fmt.Errorf("channels[%d]: %w", i, err)
+		}
+		body, subject, _ := c.templates()
+		ch := &channel{Channel: c, body: body, subject: subject, status: ChannelStatus{Name: c.Name, Type: c.Type, Events: c.Events}}
+		if ch.status.Events == nil {
+			ch.status.Events = Events
+		}
+		if c.RatePerMinute > 0 {
+			ch.limiter = newLimiter(c.RatePerMinute/60, max(c.Burst, 1))
+		}
+		n.channels = append(n.channels, ch)
+	}
+	return n, nil
+}
+
+// Register 订阅工件失败、补偿完成、补偿失败和工站状态变更事件，工站进入 DOWN 时通知
+func (n *Notifier) Register(bus *event.Bus) {
+	bus.Subscribe(event.ProductFailed, func(e event.Event) {
+		n.Notify(fromEvent(EventProductFailed, SeverityCritical, e))
+	})
+	bus.Subscribe(event.ProductCompensated, func(e event.Event) {
+		n.Notify(fromEvent(EventProductCompensated, SeverityWarning, e))
+	})
+	bus.Subscribe(event.CompensationFailed, func(e event.Event) {
+		n.Notify(fromEvent(EventCompensationFailed, SeverityCritical, e))
+	})
+	bus.Subscribe(event.StationStatusChanged, func(e event.Event) {
+		if e.ToState == string(fsm.StationDown) {
+			n.Notify(fromEvent(EventStationDown, SeverityCritical, e))
+		}
+	})
+}
+
+// fromEvent 由事件生成通知
+func fromEvent(kind, severity string, e event.Event) Notification {
+	n := Notification{
+		Event:     kind,
+		Severity:  severity,
+		ProductID: e.ProductID,
+		Namespace: e.Namespace(),
+		StationID: e.StationID,
+		TraceID:   e.TraceID,
+		Time:      e.Timestamp,
+	}
+	if e.Product != nil {
+		n.ProductType = e.Product.Type
+	}
+	if e.Error != nil {
+		n.Error = e.Error.Error()
+	}
+	if n.Time.IsZero() {
+		n.Time = time.Now()
+	}
+	n.Summary = summary(n)
+	return n
+}
+
+// summary 生成通知的一句话描述
+func summary(n Notification) string {
+	var b strings.Builder
+	switch n.Event {
+	case EventProductFailed:
+		fmt.Fprintf(&b, "工件 %s (%s) 生产失败", n.ProductID, n.ProductType)
+		if n.StationID != "" {
+			fmt.Fprintf(&b, "，失败工站 %s", n.StationID)
+		}
+	case EventProductCompensated:
+		fmt.Fprintf(&b, "工件 %s (%s) 已完成补偿", n.ProductID, n.ProductType)
+	case EventCompensationFailed:
+		fmt.Fprintf(&b, "工件 %s 在工站 %s 补偿失败，需要人工处理", n.ProductID, n.StationID)
+	case EventStationDown:
+		fmt.Fprintf(&b, "工站 %s 故障停机", n.StationID)
+	default:
+		b.WriteString("测试通知")
+	}
+	if n.Namespace != "" {
+		fmt.Fprintf(&b, " [%s]", n.Namespace)
+	}
+	if n.Error != "" {
+		fmt.Fprintf(&b, ": %s", n.Error)
+	}
+	return b.String()
+}
+
+// Notify 将通知放入各个接受该事件的通道的发送队列，超过通道发送频率或队列已满的通知被丢弃
+func (n *Notifier) Notify(note Notification) {
+	for _, c := range n.channels {
+		if !c.accepts(note.Event) {
+			continue
+		}
+		if c.limiter != nil {
+			if !c.limiter.allow(time.Now()) {
+				n.record(c, note, ResultRateLimited, nil)
+				continue
+			}
+		}
+		select {
+		case n.queue <- job{channel: c, n: note}:
+		default:
+			n.record(c, note, ResultDropped, nil)
+		}
+	}
+}
+
+// Run 投递队列中的通知，直到 ctx 结束
+func (n *Notifier) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case j := <-n.queue:
+			err := n.deliver(ctx, j.channel, j.n)
+			result := ResultSent
+			if err != nil {
+				result = ResultFailed
+				n.logger.Warn("投递通知失败", "channel", j.channel.Name, "event", j.n.Event, "error", err)
+			}
+			n.record(j.channel, j.n, result, err)
+		}
+	}
+}
+
+// Test 立即向所有通道同步发送一条测试通知，不受事件过滤和发送频率限制，返回各通道的投递记录
+func (n *Notifier) Test(ctx context.Context) []Delivery {
+	note := Notification{Event: EventTest, Severity: SeverityWarning, Time: time.Now()}
+	note.Summary = summary(note)
+	deliveries := make([]Delivery, 0, len(n.channels))
+	for _, c := range n.channels {
+		err := n.deliver(ctx, c, note)
+		result := ResultSent
+		if err != nil {
+			result = ResultFailed
+		}
+		deliveries = append(deliveries, n.record(c, note, result, err))
+	}
+	return deliveries
+}
+
+// deliver 按通道模板渲染通知并投递到通道
+func (n *Notifier) deliver(ctx context.Context, c *channel, note Notification) error {
+	start := time.Now()
+	defer func() {
+		n.metrics.NotificationDeliveryDuration.WithLabelValues(c.Name).Observe(time.Since(start).Seconds())
+	}()
+	var text bytes.Buffer
+	if err := c.body.Execute(&text, note); err != nil {
+		return fmt.Errorf("render template: %w", err)
+	}
+	note.Text = text.String()
+	if n.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, n.timeout)
+		defer cancel()
+	}
+	switch c.Type {
+	case ChannelSlack:
+		return n.post(ctx, c, map[string]string{"text": note.Text})
+	case ChannelSMTP:
+		var subject bytes.Buffer
+		if err := c.subject.Execute(&subject, note); err != nil {
+			return fmt.Errorf("render subject: %w", err)
+		}
+		return sendMail(ctx, c.SMTP, subject.String(), note.Text)
+	default:
+		return n.post(ctx, c, note)
+	}
+}
+
+// post 以 JSON 请求体 POST 到通道地址，非 2xx 响应视为失败
+func (n *Notifier) post(ctx context.Context, c *channel, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range c.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// record 记录一次投递的结果并计数
+func (n *Notifier) record(c *channel, note Notification, result string, err error) Delivery {
+	d := Delivery{Time: time.Now(), Channel: c.Name, Event: note.Event, ProductID: note.ProductID, StationID: string(note.StationID), Result: result}
+	if err != nil {
+		d.Error = err.Error()
+	}
+	n.metrics.NotificationsTotal.WithLabelValues(c.Name, note.Event, result).Inc()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	switch result {
+	case ResultSent:
+		c.status.Sent++
+	case ResultFailed:
+		c.status.Failed++
+	case ResultRateLimited:
+		c.status.RateLimited++
+	case ResultDropped:
+		c.status.Dropped++
+	}
+	n.recent = append([]Delivery{d}, n.recent...)
+	if len(n.recent) > maxRecent {
+		n.recent = n.recent[:maxRecent]
+	}
+	return d
+}
+
+// Status 返回各通道的投递统计和最近的投递记录
+func (n *Notifier) Status() Status {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	status := Status{Channels: make([]ChannelStatus, 0, len(n.channels)), Recent: slices.Clone(n.recent)}
+	for _, c := range n.channels {
+		status.Channels = append(status.Channels, c.status)
+	}
+	return status
+}
@@ -0,0 +1,433 @@
+// Package oee 根据步骤事件和工站状态变更统计各工站的设备综合效率 (OEE)
+// OEE = 可用率 × 性能 × 质量：
+//   - 可用率: 运行时间 / 计划生产时间，DOWN 计为故障停机，MAINTENANCE 和日历中的离线时间 (班次之外、休息、计划停机) 视为计划停机，不计入计划生产时间
+//   - 性能: 理想节拍 × 加工数 / 实际加工时长之和，只衡量加工速度损失；工站可以并行加工，等待订单的空闲时间不计入
+//   - 质量: 加工成功的步骤数 / 加工的步骤数
+//
+// 同时统计直通率 (首次加工即成功的比例)：工件失败后重试产生的新工件与原工件属于同一谱系，谱系中的工件再次经过同一工站时记为返工，不计入首次加工
+package oee
+
+import (
+	"cmp"
+	"context"
+	"industrial-4.0-demo/internal/calendar"
+	"industrial-4.0-demo/internal/event"
+	"industrial-4.0-demo/internal/fsm"
+	"industrial-4.0-demo/internal/metrics"
+	"industrial-4.0-demo/internal/types"
+	"industrial-4.0-demo/internal/windowed"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gaugeInterval 是刷新 station_oee_* 指标的间隔
+const gaugeInterval = 10 * time.Second
+
+// StationOEE 是一个工站在统计窗口内的 OEE，比例均为 0 ~ 1，窗口内没有加工时性能和质量为 0
+type StationOEE struct {
+	StationID              types.StationID `json:"station_id"`
+	Availability           float64         `json:"availability"`
+	Performance            float64         `json:"performance"`
+	Quality                float64         `json:"quality"`
+	OEE                    float64         `json:"oee"`
+	PlannedSeconds         float64         `json:"planned_seconds"`          // 计划生产时间 (窗口时长减去计划停机时间)
+	PlannedDowntimeSeconds float64         `json:"planned_downtime_seconds"` // 计划停机时间：维护时间和日历中的离线时间
+	DowntimeSeconds        float64         `json:"downtime_seconds"`         // 故障停机时间，不含日历中的离线时间
+	Total                  int             `json:"total"`                    // 加工的步骤数
+	Good                   int             `json:"good"`                     // 加工成功的步骤数
+	IdealCycleSeconds      float64         `json:"ideal_cycle_seconds"`
+	FirstPassYield         float64         `json:"first_pass_yield"` // 首次加工成功的步骤数 / 首次加工的步骤数，窗口内没有首次加工时为 0
+	FirstPass              int             `json:"first_pass"`       // 首次加工的步骤数
+	FirstPassGood          int             `json:"first_pass_good"`  // 首次加工成功的步骤数
+	Rework                 int             `json:"rework"`           // 返工的步骤数
+}
+
+// ProductYield 是一种产品类型在统计窗口内的直通率和报废数
+type ProductYield struct {
+	Type           string  `json:"type"`
+	FirstPassYield float64 `json:"first_pass_yield"` // 首次生产即完成的工件数 / 首次生产结束的工件数，窗口内没有首次生产结束的工件时为 0
+	FirstPass      int     `json:"first_pass"`       // 首次生产 (不是重试) 结束的工件数
+	FirstPassGood  int     `json:"first_pass_good"`  // 首次生产即完成的工件数
+	ReworkGood     int     `json:"rework_good"`      // 重试后完成的工件数
+	Scrap          int     `json:"scrap"`            // 生产失败报废的工件数，包括重试失败的工件
+}
+
+// Report 是统计窗口内所有工站的 OEE
+// 窗口早于追踪开始时从追踪开始时计算
+type Report struct {
+	Window   string         `json:"window"`
+	From     time.Time      `json:"from"`
+	To       time.Time      `json:"to"`
+	Stations []StationOEE   `json:"stations"`
+	Products []ProductYield `json:"products"`
+}
+
+// transition 是一次工站状态变更
+type transition struct {
+	seq   uint64
+	at    time.Time
+	state string
+}
+
+// stepRecord 是工站上的一次加工
+type stepRecord struct {
+	at       time.Time
+	duration time.Duration
+	good     bool
+	rework   bool // 谱系中的其他工件此前已在该工站加工过
+}
+
+// finish 是一个工件的结束
+type finish struct {
+	at          time.Time
+	productType string
+	retry       bool // 重试产生的工件
+	good        bool // 完成为 true，失败报废为 false
+}
+
+// lineage 是一个工件及其重试组成的谱系
+type lineage struct {
+	at      time.Time                  // 最近一次加工或结束的时间，超过保留时长后丢弃
+	members []string                   // 谱系中的工件 ID
+	visited map[types.StationID]string // 每个工站上第一个加工的工件
+}
+
+// stationLog 记录保留时长内一个工站的状态变更和加工
+// 状态变更按序号排序，并保留保留时长之前的最后一次变更，用于确定窗口开始时的状态
+type stationLog struct {
+	transitions []transition
+	steps       []stepRecord
+}
+
+// Tracker 订阅事件总线，保留最近 retention 时长内的事件并按需计算 OEE
+type Tracker struct {
+	mu         sync.Mutex
+	idealCycle time.Duration                     // 未单独配置的工站的理想节拍
+	overrides  map[types.StationID]time.Duration // 单独配置的理想节拍
+	retention  windowed.Retention                // 事件的保留时长和开始记录的时间
+	stations   map[types.StationID]*stationLog
+	finishes   []finish
+	roots      map[string]string   // 工件 ID 到所属谱系 (最初的工件 ID)
+	lineages   map[string]*lineage // 按最初的工件 ID 索引
+	calendar   *calendar.Calendar  // 班次和计划停机日历，为 nil 时工站全天在计划生产时间内
+	metrics    *metrics.Metrics
+}
+
+// NewTracker 创建一个 OEE 追踪器
+// idealCycle 是工站的理想节拍，overrides 按工站覆盖 (工站 ID 不区分大小写)；retention 是事件的保留时长，也是可查询的最大窗口；m 是 Run 更新的指标
+func NewTracker(idealCycle time.Duration, overrides map[types.StationID]time.Duration, retention time.Duration, m *metrics.Metrics) *Tracker {
+	normalized := make(map[types.StationID]time.Duration, len(overrides))
+	for id, d := range overrides {
+		normalized[types.StationID(strings.ToUpper(string(id)))] = d
+	}
+	return &Tracker{
+		idealCycle: idealCycle,
+		overrides:  normalized,
+		retention:  windowed.NewRetention(retention),
+		stations:   make(map[types.StationID]*stationLog),
+		roots:      make(map[string]string),
+		lineages:   make(map[string]*lineage),
+		metrics:    m,
+	}
+}
+
+// SetCalendar 替换班次和计划停机日历，之后的报告按新的日历区分计划停机和故障停机
+func (t *Tracker) SetCalendar(c *calendar.Calendar) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.calendar = c
+}
+
+// Register 订阅步骤完成、工件结束和工站状态变更事件
+// 被停用的工站拒绝的步骤 (StepRejected) 没有加工，不计入；取消的工件既不计入直通率也不计入报废
+func (t *Tracker) Register(bus *event.Bus) {
+	bus.Subscribe(event.StepCompleted, func(e event.Event) {
+		duration, _ := e.Product.Attrs["duration"].(float64)
+		t.recordStep(e.StationID, e.Product, e.Timestamp, time.Duration(duration*float64(time.Second)), e.Error == nil)
+	})
+	bus.Subscribe(event.ProductCompleted, func(e event.Event) {
+		t.recordFinish(e.Product, e.Timestamp, true)
+	})
+	bus.Subscribe(event.ProductFailed, func(e event.Event) {
+		t.recordFinish(e.Product, e.Timestamp, false)
+		t.metrics.ScrapTotal.WithLabelValues(e.Product.Type, e.Product.Namespace).Inc()
+	})
+	bus.Subscribe(event.StationStatusChanged, func(e event.Event) {
+		t.recordStatus(e.StationID, e.Seq, e.Timestamp, e.ToState)
+	})
+}
+
+// Run 定期按 window 统计 OEE 和直通率并更新 station_oee_*、*_first_pass_yield 指标，直到 ctx 结束，window 超过保留时长时使用保留时长
+// 窗口内没有首次加工的工站和没有首次生产结束的产品类型不更新直通率
+func (t *Tracker) Run(ctx context.Context, window time.Duration) {
+	window = t.retention.Clamp(window)
+	ticker := time.NewTicker(gaugeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			report, _ := t.Report(window, now)
+			for _, s := range report.Stations {
+				id := string(s.StationID)
+				t.metrics.StationOEEAvailability.WithLabelValues(id).Set(s.Availability)
+				t.metrics.StationOEEPerformance.WithLabelValues(id).Set(s.Performance)
+				t.metrics.StationOEEQuality.WithLabelValues(id).Set(s.Quality)
+				t.metrics.StationOEEOverall.WithLabelValues(id).Set(s.OEE)
+				if s.FirstPass > 0 {
+					t.metrics.StationFirstPassYield.WithLabelValues(id).Set(s.FirstPassYield)
+				}
+			}
+			for _, p := range report.Products {
+				if p.FirstPass > 0 {
+					t.metrics.ProductFirstPassYield.WithLabelValues(p.Type).Set(p.FirstPassYield)
+				}
+			}
+		}
+	}
+}
+
+// recordStep 记录一次加工，谱系中的其他工件此前已在该工站加工过时记为返工
+func (t *Tracker) recordStep(id types.StationID, p *types.Product, at time.Time, duration time.Duration, good bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	l := t.lineageLocked(p, at)
+	first, visited := l.visited[id]
+	if !visited {
+		l.visited[id] = p.ID
+	}
+	log := t.stationLocked(id)
+	log.steps = append(log.steps, stepRecord{at: at, duration: duration, good: good, rework: visited && first != p.ID})
+	t.pruneLocked(log, at)
+	t.pruneProductsLocked(at)
+}
+
+// recordFinish 记录一个工件的结束
+func (t *Tracker) recordFinish(p *types.Product, at time.Time, good bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lineageLocked(p, at)
+	t.finishes = append(t.finishes, finish{at: at, productType: p.Type, retry: p.RetryOf != "", good: good})
+	t.pruneProductsLocked(at)
+}
+
+// lineageLocked 返回工件所属的谱系并刷新其活动时间，谱系不存在时创建，调用方必须持有锁
+// 重试来源已超出保留时长 (或早于追踪开始) 时，以重试来源的 ID 作为谱系
+func (t *Tracker) lineageLocked(p *types.Product, at time.Time) *lineage {
+	root, ok := t.roots[p.ID]
+	if !ok {
+		root = p.ID
+		if p.RetryOf != "" {
+			root = cmp.Or(t.roots[p.RetryOf], p.RetryOf)
+		}
+		t.roots[p.ID] = root
+	}
+	l, ok := t.lineages[root]
+	if !ok {
+		l = &lineage{visited: make(map[types.StationID]string)}
+		t.lineages[root] = l
+	}
+	if !slices.Contains(l.members, p.ID) {
+		l.members = append(l.members, p.ID)
+	}
+	if at.After(l.at) {
+		l.at = at
+	}
+	return l
+}
+
+// pruneProductsLocked 丢弃超过保留时长的工件结束记录和谱系，调用方必须持有锁
+func (t *Tracker) pruneProductsLocked(now time.Time) {
+	cutoff := t.retention.Cutoff(now)
+	t.finishes = windowed.Prune(t.finishes, cutoff, func(f finish) time.Time { return f.at })
+	for root, l := range t.lineages {
+		if l.at.Before(cutoff) {
+			for _, id := range l.members {
+				delete(t.roots, id)
+			}
+			delete(t.lineages, root)
+		}
+	}
+}
+
+// recordStatus 按序号插入一次状态变更，处理器是异步执行的，变更可能乱序到达，重复的序号被忽略
+func (t *Tracker) recordStatus(id types.StationID, seq uint64, at time.Time, state string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	log := t.stationLocked(id)
+	i, found := slices.BinarySearchFunc(log.transitions, seq, func(tr transition, seq uint64) int {
+		return cmp.Compare(tr.seq, seq)
+	})
+	if found {
+		return
+	}
+	log.transitions = slices.Insert(log.transitions, i, transition{seq: seq, at: at, state: state})
+	t.pruneLocked(log, at)
+}
+
+// stationLocked 返回工站的记录，不存在时创建，调用方必须持有锁
+func (t *Tracker) stationLocked(id types.StationID) *stationLog {
+	log, ok := t.stations[id]
+	if !ok {
+		log = &stationLog{}
+		t.stations[id] = log
+	}
+	return log
+}
+
+// pruneLocked 丢弃超过保留时长的加工和状态变更，调用方必须持有锁
+func (t *Tracker) pruneLocked(log *stationLog, now time.Time) {
+	cutoff := t.retention.Cutoff(now)
+	log.steps = windowed.Prune(log.steps, cutoff, func(s stepRecord) time.Time { return s.at })
+	log.transitions = windowed.PruneKeepLast(log.transitions, cutoff, func(tr transition) time.Time { return tr.at })
+}
+
+// Report 统计截至 now 的 window 时长内各工站的 OEE，按工站 ID 排序
+func (t *Tracker) Report(window time.Duration, now time.Time) (Report, error) {
+	from, err := t.retention.From(window, now)
+	if err != nil {
+		return Report{}, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	report := Report{Window: window.String(), From: from, To: now, Stations: []StationOEE{}, Products: t.productYieldsLocked(from, now)}
+	for id, log := range t.stations {
+		report.Stations = append(report.Stations, t.stationOEELocked(id, log, from, now))
+	}
+	slices.SortFunc(report.Stations, func(a, b StationOEE) int {
+		return strings.Compare(string(a.StationID), string(b.StationID))
+	})
+	return report, nil
+}
+
+// productYieldsLocked 统计 [from, to] 内结束的工件的直通率和报废数，按产品类型排序，调用方必须持有锁
+func (t *Tracker) productYieldsLocked(from, to time.Time) []ProductYield {
+	byType := make(map[string]*ProductYield)
+	for _, f := range t.finishes {
+		if f.at.Before(from) || f.at.After(to) {
+			continue
+		}
+		y, ok := byType[f.productType]
+		if !ok {
+			y = &ProductYield{Type: f.productType}
+			byType[f.productType] = y
+		}
+		switch {
+		case !f.good:
+			y.Scrap++
+		case f.retry:
+			y.ReworkGood++
+		default:
+			y.FirstPassGood++
+		}
+		if !f.retry {
+			y.FirstPass++
+		}
+	}
+	yields := make([]ProductYield, 0, len(byType))
+	for _, y := range byType {
+		if y.FirstPass > 0 {
+			y.FirstPassYield = float64(y.FirstPassGood) / float64(y.FirstPass)
+		}
+		yields = append(yields, *y)
+	}
+	slices.SortFunc(yields, func(a, b ProductYield) int {
+		return strings.Compare(a.Type, b.Type)
+	})
+	return yields
+}
+
+// stationOEELocked 统计一个工站在 [from, to] 内的 OEE，调用方必须持有锁
+func (t *Tracker) stationOEELocked(id types.StationID, log *stationLog, from, to time.Time) StationOEE {
+	ideal, ok := t.overrides[id]
+	if !ok {
+		ideal = t.idealCycle
+	}
+	s := StationOEE{StationID: id, IdealCycleSeconds: ideal.Seconds()}
+
+	// 日历中的离线时间计为计划停机，其间的故障和维护不再重复计入
+	offline := t.calendar.Offline(id, from, to)
+	var scheduled time.Duration
+	for _, w := range offline {
+		scheduled += w.To.Sub(w.From)
+	}
+
+	// 工站在第一次状态变更前处于 IDLE
+	var down, maintenance time.Duration
+	state, since := string(fsm.StationIdle), t.retention.Started()
+	accumulate := func(until time.Time) {
+		d := overlap(since, until, from, to)
+		for _, w := range offline {
+			d -= overlap(since, until, w.From, w.To)
+		}
+		switch state {
+		case string(fsm.StationDown):
+			down += d
+		case string(fsm.StationMaintenance):
+			maintenance += d
+		}
+	}
+	for _, tr := range log.transitions {
+		accumulate(tr.at)
+		state, since = tr.state, tr.at
+	}
+	accumulate(to)
+
+	planned := to.Sub(from) - maintenance - scheduled
+	s.PlannedSeconds = planned.Seconds()
+	s.PlannedDowntimeSeconds = (maintenance + scheduled).Seconds()
+	s.DowntimeSeconds = down.Seconds()
+	if planned > 0 {
+		s.Availability = float64(planned-down) / float64(planned)
+	}
+
+	var busy time.Duration
+	for _, step := range log.steps {
+		if step.at.Before(from) || step.at.After(to) {
+			continue
+		}
+		s.Total++
+		busy += step.duration
+		if step.good {
+			s.Good++
+		}
+		if step.rework {
+			s.Rework++
+			continue
+		}
+		s.FirstPass++
+		if step.good {
+			s.FirstPassGood++
+		}
+	}
+	if s.FirstPass > 0 {
+		s.FirstPassYield = float64(s.FirstPassGood) / float64(s.FirstPass)
+	}
+	if s.Total > 0 {
+		s.Quality = float64(s.Good) / float64(s.Total)
+		s.Performance = 1
+		if busy > 0 {
+			s.Performance = min(1, float64(ideal)*float64(s.Total)/float64(busy))
+		}
+	}
+	s.OEE = s.Availability * s.Performance * s.Quality
+	return s
+}
+
+// overlap 返回 [start, end) 与 [from, to) 重叠的时长
+func overlap(start, end, from, to time.Time) time.Duration {
+	if start.Before(from) {
+		start = from
+	}
+	if end.After(to) {
+		end = to
+	}
+	if !end.After(start) {
+		return 0
+	}
+	return end.Sub(start)
+}
@@ -0,0 +1,515 @@
+// Package opcua 在编排器中内嵌 OPC UA 服务，将工件、工站状态和 KPI 以只读地址空间的形式暴露，
+// 供标准的 SCADA/HMI 工具像浏览真实设备一样浏览演示工厂
+//
+// 地址空间挂在 Objects 文件夹下，节点 ID 为 ns=<NamespaceURI 的索引>;s=<路径>：
+//
+//	Factory
+//	├── Scheduler/{Status,Dispatch,Workers,BusyWorkers,Occupancy,QueueLength}
+//	├── Stations/<工站 ID>/{Status,Health,ActiveProducts,QueueLength,Utilization,OEE,Availability,Performance,Quality}
+//	├── Products/<工件 ID>/{Type,Status,Station,Priority,Lot,Serial,Namespace}
+//	└── KPIs/{WorkInProgress,ActiveAlerts,Completed,UnitsPerHour,TaktSeconds,Bottleneck}
+//
+// 地址空间按 refreshInterval 从状态追踪器和 KPI 追踪器重建，值变化时通知订阅了该节点的客户端
+package opcua
+
+import (
+	"context"
+	"fmt"
+	"industrial-4.0-demo/internal/oee"
+	"industrial-4.0-demo/internal/throughput"
+	"industrial-4.0-demo/internal/types"
+	"industrial-4.0-demo/internal/web"
+	"log/slog"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/server"
+	"github.com/gopcua/opcua/server/attrs"
+	"github.com/gopcua/opcua/ua"
+)
+
+// NamespaceURI 是工厂地址空间的命名空间 URI，客户端据此查找命名空间索引
+const NamespaceURI = "urn:industrial-4.0-demo:factory"
+
+// refreshInterval 是重建地址空间的间隔
+const refreshInterval = time.Second
+
+// rootPath 是工厂根节点的路径
+const rootPath = "Factory"
+
+// node 是地址空间中的一个节点，value 为 nil 的是对象节点
+type node struct {
+	name     string
+	parent   string
+	children []string
+	folder   bool // 子节点数量不固定的文件夹 (Stations、Products)
+	value    any
+}
+
+// Server 是内嵌的 OPC UA 服务，同时实现 gopcua 的 server.NameSpace 接口提供工厂地址空间
+type Server struct {
+	addr         string
+	stateTracker *web.StateTracker
+	oee          *oee.Tracker        // 为 nil 时工站下没有 OEE 节点
+	oeeWindow    time.Duration       // 工站 OEE 的统计窗口
+	throughput   *throughput.Tracker // 为 nil 时 KPIs 下没有产出节点
+	tpWindow     time.Duration       // 产出的统计窗口
+	logger       *slog.Logger
+
+	srv   *server.Server
+	id    uint16
+	mu    sync.RWMutex
+	nodes map[string]*node // 按路径索引，每次刷新整体替换
+}
+
+// NewServer 创建监听 addr (host:port) 的 OPC UA 服务，地址空间来自 st
+func NewServer(addr string, st *web.StateTracker, logger *slog.Logger) *Server {
+	return &Server{
+		addr:         addr,
+		stateTracker: st,
+		logger:       logger.With("component", "opcua"),
+		nodes:        make(map[string]*node),
+	}
+}
+
+// SetOEE 设置工站 OEE 的来源和统计窗口
+func (s *Server) SetOEE(t *oee.Tracker, window time.Duration) {
+	s.oee, s.oeeWindow = t, window
+}
+
+// SetThroughput 设置产出 KPI 的来源和统计窗口
+func (s *Server) SetThroughput(t *throughput.Tracker, window time.Duration) {
+	s.throughput, s.tpWindow = t, window
+}
+
+// Start 开始监听并在后台刷新地址空间，ctx 结束时关闭服务
+func (s *Server) Start(ctx context.Context) error {
+	host, portStr, err := net.SplitHostPort(s.addr)
+	if err != nil {
+		return fmt.Errorf("invalid opcua address %q: %w", s.addr, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return fmt.Errorf("invalid opcua port %q: %w", portStr, err)
+	}
+	if host == "" {
+		host = "0.0.0.0"
+	}
+	// 服务启动前没有订阅者，首次刷新不需要通知
+	s.refresh()
+	s.srv = server.New(
+		server.EndPoint(host, port),
+		server.EnableSecurity("None", ua.MessageSecurityModeNone),
+		server.EnableAuthMode(ua.UserTokenTypeAnonymous),
+		server.ServerName("industrial-4.0-demo"),
+		server.ProductName("industrial-4.0-demo orchestrator"),
+	)
+	s.srv.AddNamespace(s)
+	if root, err := s.srv.Namespace(0); err == nil {
+		root.Objects().AddRef(s.Objects(), id.Organizes, true)
+	}
+	if err := s.srv.Start(ctx); err != nil {
+		return err
+	}
+	s.logger.Info("OPC UA 服务已启动", "endpoint", s.srv.URLs()[0], "namespace", NamespaceURI)
+
+	go func() {
+		ticker := time.NewTicker(refreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				s.srv.Close()
+				return
+			case <-ticker.C:
+				s.refresh()
+			}
+		}
+	}()
+	return nil
+}
+
+// refresh 重建地址空间，并通知值发生变化的节点的订阅者
+func (s *Server) refresh() {
+	nodes := s.build(time.Now())
+	s.mu.Lock()
+	old := s.nodes
+	s.nodes = nodes
+	s.mu.Unlock()
+
+	if s.srv == nil {
+		return
+	}
+	for path, n := range nodes {
+		if n.value == nil {
+			continue
+		}
+		if prev, ok := old[path]; !ok || prev.value != n.value {
+			s.srv.ChangeNotification(ua.NewStringNodeID(s.id, path))
+		}
+	}
+}
+
+// build 按当前状态生成地址空间
+func (s *Server) build(now time.Time) map[string]*node {
+	b := builder{nodes: make(map[string]*node)}
+	b.nodes[rootPath] = &node{name: rootPath}
+	state := s.stateTracker.GetStateSnapshot()
+
+	sched := b.object(rootPath, "Scheduler", false)
+	if st := state.Scheduler; st != nil {
+		b.variable(sched, "Status", st.Status)
+		b.variable(sched, "Dispatch", st.Dispatch)
+		b.variable(sched, "Workers", int32(st.Workers))
+		b.variable(sched, "BusyWorkers", int32(st.BusyWorkers))
+		b.variable(sched, "Occupancy", st.Occupancy)
+		b.variable(sched, "QueueLength", int32(len(st.Queue)))
+	}
+
+	var stationOEE map[types.StationID]oee.StationOEE
+	if s.oee != nil {
+		if report, err := s.oee.Report(s.oeeWindow, now); err == nil {
+			stationOEE = make(map[types.StationID]oee.StationOEE, len(report.Stations))
+			for _, so := range report.Stations {
+				stationOEE[so.StationID] = so
+			}
+		}
+	}
+	stations := b.object(rootPath, "Stations", true)
+	for _, sid := range sortedKeys(state.Stations) {
+		st := state.Stations[sid]
+		path := b.object(stations, string(sid), false)
+		b.variable(path, "Status", st.Status)
+		b.variable(path, "Health", st.Health)
+		b.variable(path, "ActiveProducts", int32(len(st.Products)))
+		b.variable(path, "QueueLength", int32(st.QueueLength))
+		b.variable(path, "Utilization", st.Utilization)
+		if so, ok := stationOEE[sid]; ok {
+			b.variable(path, "OEE", so.OEE)
+			b.variable(path, "Availability", so.Availability)
+			b.variable(path, "Performance", so.Performance)
+			b.variable(path, "Quality", so.Quality)
+		}
+	}
+
+	wip := 0
+	products := b.object(rootPath, "Products", true)
+	for _, pid := range sortedKeys(state.Products) {
+		p := state.Products[pid]
+		if p.FinishedAt.IsZero() {
+			wip++
+		}
+		path := b.object(products, pid, false)
+		b.variable(path, "Type", p.Type)
+		b.variable(path, "Status", p.Status)
+		b.variable(path, "Station", string(p.Station))
+		b.variable(path, "Priority", int32(p.Priority))
+		b.variable(path, "Lot", p.Lot)
+		b.variable(path, "Serial", p.Serial)
+		b.variable(path, "Namespace", p.Namespace)
+	}
+
+	kpis := b.object(rootPath, "KPIs", false)
+	b.variable(kpis, "WorkInProgress", int32(wip))
+	b.variable(kpis, "ActiveAlerts", int32(len(state.Alerts)))
+	if s.throughput != nil {
+		if report, err := s.throughput.Report(s.tpWindow, now); err == nil {
+			b.variable(kpis, "Completed", int32(report.Completed))
+			b.variable(kpis, "UnitsPerHour", report.UnitsPerHour)
+			b.variable(kpis, "TaktSeconds", report.TaktSeconds)
+			b.variable(kpis, "Bottleneck", string(report.Bottleneck))
+		}
+	}
+	return b.nodes
+}
+
+// builder 按路径生成节点
+type builder struct {
+	nodes map[string]*node
+}
+
+// object 在 parent 下添加对象节点，返回它的路径
+func (b builder) object(parent, name string, folder bool) string {
+	path := parent + "/" + name
+	b.nodes[path] = &node{name: name, parent: parent, folder: folder}
+	b.nodes[parent].children = append(b.nodes[parent].children, path)
+	return path
+}
+
+// variable 在 parent 下添加变量节点
+func (b builder) variable(parent, name string, value any) {
+	path := parent + "/" + name
+	b.nodes[path] = &node{name: name, parent: parent, value: value}
+	b.nodes[parent].children = append(b.nodes[parent].children, path)
+}
+
+// sortedKeys 返回按字典序排列的键，使浏览结果的顺序稳定
+func sortedKeys[K ~string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// lookup 返回节点 ID 对应的节点，不属于工厂地址空间时返回 nil
+func (s *Server) lookup(nid *ua.NodeID) *node {
+	if nid.Namespace() != s.id || nid.Type() != ua.NodeIDTypeString {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.nodes[nid.StringID()]
+}
+
+// Name 实现 server.NameSpace，返回命名空间 URI
+func (s *Server) Name() string { return NamespaceURI }
+
+// ID 实现 server.NameSpace
+func (s *Server) ID() uint16 { return s.id }
+
+// SetID 实现 server.NameSpace，由 server.AddNamespace 调用
+func (s *Server) SetID(id uint16) { s.id = id }
+
+// AddNode 实现 server.NameSpace，地址空间由工厂状态生成，不接受外部添加的节点
+func (s *Server) AddNode(n *server.Node) *server.Node { return n }
+
+// Node 实现 server.NameSpace，工厂地址空间的节点不以 server.Node 的形式保存，
+// 只为 Objects 文件夹浏览时查询的工厂根节点返回节点
+func (s *Server) Node(nid *ua.NodeID) *server.Node {
+	if nid.Namespace() == s.id && nid.Type() == ua.NodeIDTypeString && nid.StringID() == rootPath {
+		return s.Objects()
+	}
+	return nil
+}
+
+// Objects 实现 server.NameSpace，返回工厂根节点，用于从 Objects 文件夹引用
+func (s *Server) Objects() *server.Node {
+	return server.NewNode(
+		ua.NewStringNodeID(s.id, rootPath),
+		map[ua.AttributeID]*ua.DataValue{
+			ua.AttributeIDNodeClass:   server.DataValueFromValue(int32(ua.NodeClassObject)),
+			ua.AttributeIDBrowseName:  server.DataValueFromValue(&ua.QualifiedName{NamespaceIndex: s.id, Name: rootPath}),
+			ua.AttributeIDDisplayName: server.DataValueFromValue(attrs.DisplayName(rootPath, "")),
+			ua.AttributeIDDataType:    server.DataValueFromValue(ua.NewNumericExpandedNodeID(0, id.BaseObjectType)),
+		},
+		nil,
+		nil,
+	)
+}
+
+// Root 实现 server.NameSpace，工厂地址空间没有单独的根文件夹
+func (s *Server) Root() *server.Node { return s.Objects() }
+
+// Browse 实现 server.NameSpace，返回节点的类型定义、子节点和父节点引用
+func (s *Server) Browse(bd *ua.BrowseDescription) *ua.BrowseResult {
+	n := s.lookup(bd.NodeID)
+	if n == nil {
+		return &ua.BrowseResult{StatusCode: ua.StatusBadNodeIDUnknown}
+	}
+	s.mu.RLock()
+	nodes := s.nodes
+	s.mu.RUnlock()
+
+	var refs []*ua.ReferenceDescription
+	add := func(refType uint32, forward bool, target *ua.ExpandedNodeID, name *ua.QualifiedName, class ua.NodeClass, typeDef uint32) {
+		if !browseDirection(bd.BrowseDirection, forward) || !browseRefType(bd, refType) ||
+			(bd.NodeClassMask != 0 && bd.NodeClassMask&uint32(class) == 0) {
+			return
+		}
+		refs = append(refs, &ua.ReferenceDescription{
+			ReferenceTypeID: ua.NewNumericNodeID(0, refType),
+			IsForward:       forward,
+			NodeID:          target,
+			BrowseName:      name,
+			DisplayName:     &ua.LocalizedText{EncodingMask: ua.LocalizedTextText, Text: name.Name},
+			NodeClass:       class,
+			TypeDefinition:  ua.NewNumericExpandedNodeID(0, typeDef),
+		})
+	}
+
+	typeDef, typeClass := typeDefinition(n)
+	add(id.HasTypeDefinition, true, ua.NewNumericExpandedNodeID(0, typeDef),
+		&ua.QualifiedName{Name: typeName(typeDef)}, typeClass, 0)
+	for _, path := range n.children {
+		child := nodes[path]
+		childType, _ := typeDefinition(child)
+		add(childReference(n), true, ua.NewStringExpandedNodeID(s.id, path),
+			&ua.QualifiedName{NamespaceIndex: s.id, Name: child.name}, nodeClass(child), childType)
+	}
+	if n.parent == "" {
+		add(id.Organizes, false, ua.NewNumericExpandedNodeID(0, id.ObjectsFolder),
+			&ua.QualifiedName{Name: "Objects"}, ua.NodeClassObject, id.FolderType)
+	} else {
+		parent := nodes[n.parent]
+		parentType, _ := typeDefinition(parent)
+		add(childReference(parent), false, ua.NewStringExpandedNodeID(s.id, n.parent),
+			&ua.QualifiedName{NamespaceIndex: s.id, Name: parent.name}, ua.NodeClassObject, parentType)
+	}
+	return &ua.BrowseResult{StatusCode: ua.StatusGood, References: refs}
+}
+
+// Attribute 实现 server.NameSpace，读取节点的属性
+func (s *Server) Attribute(nid *ua.NodeID, attr ua.AttributeID) *ua.DataValue {
+	n := s.lookup(nid)
+	if n == nil {
+		return badValue(ua.StatusBadNodeIDUnknown)
+	}
+	var v any
+	switch attr {
+	case ua.AttributeIDNodeID:
+		v = nid
+	case ua.AttributeIDNodeClass:
+		v = int32(nodeClass(n))
+	case ua.AttributeIDBrowseName:
+		v = &ua.QualifiedName{NamespaceIndex: s.id, Name: n.name}
+	case ua.AttributeIDDisplayName:
+		v = attrs.DisplayName(n.name, "")
+	case ua.AttributeIDDescription:
+		v = &ua.LocalizedText{}
+	case ua.AttributeIDWriteMask, ua.AttributeIDUserWriteMask:
+		v = uint32(0)
+	case ua.AttributeIDEventNotifier:
+		if n.value != nil {
+			return badValue(ua.StatusBadAttributeIDInvalid)
+		}
+		v = byte(0)
+	case ua.AttributeIDValue:
+		if n.value == nil {
+			return badValue(ua.StatusBadAttributeIDInvalid)
+		}
+		v = n.value
+	case ua.AttributeIDDataType:
+		if n.value == nil {
+			return badValue(ua.StatusBadAttributeIDInvalid)
+		}
+		v = ua.NewNumericNodeID(0, dataType(n.value))
+	case ua.AttributeIDValueRank:
+		v = int32(-1) // 标量
+	case ua.AttributeIDArrayDimensions:
+		v = []uint32{}
+	case ua.AttributeIDAccessLevel, ua.AttributeIDUserAccessLevel:
+		v = byte(ua.AccessLevelTypeCurrentRead)
+	case ua.AttributeIDMinimumSamplingInterval:
+		v = float64(refreshInterval / time.Millisecond)
+	case ua.AttributeIDHistorizing:
+		v = false
+	default:
+		return badValue(ua.StatusBadAttributeIDInvalid)
+	}
+	return &ua.DataValue{
+		EncodingMask:    ua.DataValueValue | ua.DataValueServerTimestamp | ua.DataValueSourceTimestamp,
+		Value:           ua.MustVariant(v),
+		ServerTimestamp: time.Now(),
+		SourceTimestamp: time.Now(),
+	}
+}
+
+// SetAttribute 实现 server.NameSpace，工厂地址空间只读
+func (s *Server) SetAttribute(*ua.NodeID, ua.AttributeID, *ua.DataValue) ua.StatusCode {
+	return ua.StatusBadNotWritable
+}
+
+// badValue 返回只带状态码的 DataValue
+func badValue(code ua.StatusCode) *ua.DataValue {
+	return &ua.DataValue{
+		EncodingMask:    ua.DataValueStatusCode | ua.DataValueServerTimestamp,
+		Status:          code,
+		ServerTimestamp: time.Now(),
+	}
+}
+
+// nodeClass 返回节点的类别
+func nodeClass(n *node) ua.NodeClass {
+	if n.value == nil {
+		return ua.NodeClassObject
+	}
+	return ua.NodeClassVariable
+}
+
+// typeDefinition 返回节点的类型定义和类型定义的类别
+func typeDefinition(n *node) (uint32, ua.NodeClass) {
+	switch {
+	case n.value != nil:
+		return id.BaseDataVariableType, ua.NodeClassVariableType
+	case n.folder:
+		return id.FolderType, ua.NodeClassObjectType
+	default:
+		return id.BaseObjectType, ua.NodeClassObjectType
+	}
+}
+
+// typeName 返回类型定义的浏览名
+func typeName(typeDef uint32) string {
+	switch typeDef {
+	case id.BaseDataVariableType:
+		return "BaseDataVariableType"
+	case id.FolderType:
+		return "FolderType"
+	default:
+		return "BaseObjectType"
+	}
+}
+
+// childReference 返回父节点引用子节点的引用类型：文件夹使用 Organizes，其他对象使用 HasComponent
+func childReference(parent *node) uint32 {
+	if parent.folder {
+		return id.Organizes
+	}
+	return id.HasComponent
+}
+
+// dataType 返回变量值对应的 OPC UA 内置数据类型
+func dataType(v any) uint32 {
+	switch v.(type) {
+	case bool:
+		return id.Boolean
+	case int32:
+		return id.Int32
+	case float64:
+		return id.Double
+	case string:
+		return id.String
+	default:
+		return id.BaseDataType
+	}
+}
+
+// browseDirection 判断引用的方向是否符合浏览请求
+func browseDirection(dir ua.BrowseDirection, forward bool) bool {
+	switch dir {
+	case ua.BrowseDirectionBoth:
+		return true
+	case ua.BrowseDirectionInverse:
+		return !forward
+	default:
+		return forward
+	}
+}
+
+// refSupertypes 是地址空间中使用的引用类型及其所有父类型
+var refSupertypes = map[uint32][]uint32{
+	id.HasComponent:      {id.Aggregates, id.HierarchicalReferences, id.References},
+	id.Organizes:         {id.HierarchicalReferences, id.References},
+	id.HasTypeDefinition: {id.NonHierarchicalReferences, id.References},
+}
+
+// browseRefType 判断引用类型是否符合浏览请求
+func browseRefType(bd *ua.BrowseDescription, refType uint32) bool {
+	want := bd.ReferenceTypeID
+	if want == nil || (want.Namespace() == 0 && want.IntID() == 0) {
+		return true
+	}
+	if want.Namespace() != 0 {
+		return false
+	}
+	if want.IntID() == refType {
+		return true
+	}
+	return bd.IncludeSubtypes && slices.Contains(refSupertypes[refType], want.IntID())
+}
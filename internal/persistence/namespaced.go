@@ -0,0 +1,239 @@
+package persistence
+
+import (
+	"errors"
+	"industrial-4.0-demo/internal/types"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Log 是调度器持久化任务使用的预写日志，WAL 和 NamespacedWAL 都实现了该接口
+type Log interface {
+	Append(task *types.Product) error
+	Complete(taskID string) error
+	Cancel(taskID string) error
+	Checkpoint(taskID string, cp types.Checkpoint) error
+	Recover() ([]*types.Product, error)
+	Flush() error
+	Compact() (CompactResult, error)
+	Reopen() error
+	Close() error
+	SetSyncOnWrite(sync bool)
+}
+
+var (
+	_ Log = (*WAL)(nil)
+	_ Log = (*NamespacedWAL)(nil)
+)
+
+// NamespacedWAL 按命名空间 (产线) 将任务写入各自的 WAL 文件，不同产线的日志可以单独备份、压缩和清理
+// 默认命名空间使用配置的路径，其他命名空间在扩展名之前插入命名空间名称，例如 tasks.wal 对应 tasks.line-a.wal
+type NamespacedWAL struct {
+	path   string            // 默认命名空间的日志路径，其他命名空间的路径由它派生
+	mu     sync.Mutex        // 保护 logs 和 owners
+	logs   map[string]*WAL   // 已打开的各命名空间的日志
+	owners map[string]string // 尚未结束的任务所属的命名空间，标记完成和取消时按它找到日志
+	noSync bool              // 写入后不立即刷新到磁盘
+}
+
+// NewNamespacedWAL 创建按命名空间拆分的 WAL，默认命名空间的日志文件立即打开，其他命名空间的日志在首次写入或恢复时打开
+func NewNamespacedWAL(path string) (*NamespacedWAL, error) {
+	w := &NamespacedWAL{path: path, logs: make(map[string]*WAL), owners: make(map[string]string)}
+	if _, err := w.logLocked(types.DefaultNamespace); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// NamespacePath 返回命名空间的日志文件路径
+func (w *NamespacedWAL) NamespacePath(ns string) string {
+	if ns == "" || ns == types.DefaultNamespace {
+		return w.path
+	}
+	ext := filepath.Ext(w.path)
+	return strings.TrimSuffix(w.path, ext) + "." + ns + ext
+}
+
+// logLocked 返回命名空间的日志，尚未打开时打开它，调用方必须持有 w.mu
+func (w *NamespacedWAL) logLocked(ns string) (*WAL, error) {
+	if ns == "" {
+		ns = types.DefaultNamespace
+	}
+	if log, ok := w.logs[ns]; ok {
+		return log, nil
+	}
+	log, err := NewWAL(w.NamespacePath(ns))
+	if err != nil {
+		return nil, err
+	}
+	log.SetSyncOnWrite(!w.noSync)
+	w.logs[ns] = log
+	return log, nil
+}
+
+// Append 将新任务写入其命名空间的日志
+func (w *NamespacedWAL) Append(task *types.Product) error {
+	w.mu.Lock()
+	log, err := w.logLocked(task.Namespace)
+	if err == nil {
+		w.owners[task.ID] = task.Namespace
+	}
+	w.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return log.Append(task)
+}
+
+// Complete 在任务所属命名空间的日志中标记任务已完成
+func (w *NamespacedWAL) Complete(taskID string) error {
+	return w.mark(taskID, (*WAL).Complete)
+}
+
+// Cancel 在任务所属命名空间的日志中标记任务已取消
+func (w *NamespacedWAL) Cancel(taskID string) error {
+	return w.mark(taskID, (*WAL).Cancel)
+}
+
+// Checkpoint 在任务所属命名空间的日志中记录任务最近完成的步骤
+func (w *NamespacedWAL) Checkpoint(taskID string, cp types.Checkpoint) error {
+	w.mu.Lock()
+	log, err := w.logLocked(w.owners[taskID])
+	w.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return log.Checkpoint(taskID, cp)
+}
+
+// mark 找到任务所属的日志并写入结束记录，不知道所属命名空间的任务 (例如其他实例提交的任务) 写入默认命名空间的日志
+func (w *NamespacedWAL) mark(taskID string, write func(*WAL, string) error) error {
+	w.mu.Lock()
+	ns := w.owners[taskID]
+	delete(w.owners, taskID)
+	log, err := w.logLocked(ns)
+	w.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return write(log, taskID)
+}
+
+// Recover 从所有命名空间的日志中恢复未完成的任务，默认命名空间在前，其余按命名空间名称排序，同一命名空间内保持提交顺序
+func (w *NamespacedWAL) Recover() ([]*types.Product, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	namespaces, err := w.discoverLocked()
+	if err != nil {
+		return nil, err
+	}
+	var recovered []*types.Product
+	for _, ns := range namespaces {
+		log, err := w.logLocked(ns)
+		if err != nil {
+			return nil, err
+		}
+		tasks, err := log.Recover()
+		if err != nil {
+			return nil, err
+		}
+		for _, task := range tasks {
+			if task.Namespace == "" {
+				task.Namespace = types.DefaultNamespace
+			}
+			w.owners[task.ID] = ns
+		}
+		recovered = append(recovered, tasks...)
+	}
+	return recovered, nil
+}
+
+// discoverLocked 返回磁盘上存在日志文件和已打开日志的命名空间，调用方必须持有 w.mu
+func (w *NamespacedWAL) discoverLocked() ([]string, error) {
+	ext := filepath.Ext(w.path)
+	prefix := strings.TrimSuffix(w.path, ext) + "."
+	matches, err := filepath.Glob(globEscape(prefix) + "*" + globEscape(ext))
+	if err != nil {
+		return nil, err
+	}
+	var namespaces []string
+	for ns := range w.logs {
+		if ns != types.DefaultNamespace {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	for _, match := range matches {
+		ns := strings.TrimSuffix(strings.TrimPrefix(match, prefix), ext)
+		// 跳过压缩时的临时文件和其他不是命名空间日志的文件
+		if types.IsValidNamespace(ns) && ns != types.DefaultNamespace && !slices.Contains(namespaces, ns) {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	slices.Sort(namespaces)
+	return append([]string{types.DefaultNamespace}, namespaces...), nil
+}
+
+// globEscape 转义路径中的通配符，避免路径本身被当作模式匹配
+func globEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[\`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// each 对所有已打开的日志执行 fn，返回所有错误
+func (w *NamespacedWAL) each(fn func(*WAL) error) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var errs []error
+	for _, log := range w.logs {
+		if err := fn(log); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Flush 将所有命名空间的日志刷新到磁盘
+func (w *NamespacedWAL) Flush() error {
+	return w.each((*WAL).Flush)
+}
+
+// Compact 逐个压缩所有命名空间的日志，返回合计的结果
+func (w *NamespacedWAL) Compact() (CompactResult, error) {
+	var total CompactResult
+	err := w.each(func(log *WAL) error {
+		result, err := log.Compact()
+		total.Pending += result.Pending
+		total.BytesBefore += result.BytesBefore
+		total.BytesAfter += result.BytesAfter
+		return err
+	})
+	return total, err
+}
+
+// Reopen 重新打开所有已打开的日志，其他实例新建的命名空间日志在 Recover 时打开
+func (w *NamespacedWAL) Reopen() error {
+	return w.each((*WAL).Reopen)
+}
+
+// Close 关闭所有命名空间的日志
+func (w *NamespacedWAL) Close() error {
+	return w.each((*WAL).Close)
+}
+
+// SetSyncOnWrite 设置所有命名空间的日志写入后是否立即刷新到磁盘，之后打开的日志使用同样的设置
+func (w *NamespacedWAL) SetSyncOnWrite(sync bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.noSync = !sync
+	for _, log := range w.logs {
+		log.SetSyncOnWrite(sync)
+	}
+}
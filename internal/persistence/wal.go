@@ -4,21 +4,32 @@ import (
 	"bufio"
 	"encoding/json"
 	"industrial-4.0-demo/internal/types"
+	"io"
 	"os"
 	"sync"
 )
 
 // LogEntry 代表 WAL 文件中的一条日志记录
 type LogEntry struct {
-	Type   string         `json:"type"`              // 日志类型: "TASK" (新任务) 或 "COMPLETE" (任务完成)
-	Task   *types.Product `json:"task,omitempty"`    // 如果是新任务，包含完整的任务数据
-	TaskID string         `json:"task_id,omitempty"` // 如果是任务完成，只包含任务 ID
+	Type       string            `json:"type"`                 // 日志类型: "TASK" (新任务)、"STEP" (步骤完成)、"COMPLETE" (任务完成) 或 "CANCEL" (任务取消)
+	Task       *types.Product    `json:"task,omitempty"`       // 如果是新任务，包含完整的任务数据
+	TaskID     string            `json:"task_id,omitempty"`    // 如果是步骤或任务完成，只包含任务 ID
+	Checkpoint *types.Checkpoint `json:"checkpoint,omitempty"` // 如果是步骤完成，包含最近完成的步骤
 }
 
 // WAL (Write-Ahead Log) 实现了简单的预写日志功能，用于持久化任务
 type WAL struct {
-	file *os.File   // 日志文件句柄
-	mu   sync.Mutex // 互斥锁，保证文件写入的原子性
+	path   string     // 日志文件路径，压缩时用于替换文件
+	file   *os.File   // 日志文件句柄
+	mu     sync.Mutex // 互斥锁，保证文件写入的原子性
+	noSync bool       // 写入后不立即刷新到磁盘，由操作系统决定刷新时机
+}
+
+// CompactResult 是 WAL 压缩的结果
+type CompactResult struct {
+	Pending     int   `json:"pending"`      // 保留的未结束任务数
+	BytesBefore int64 `json:"bytes_before"` // 压缩前的文件大小
+	BytesAfter  int64 `json:"bytes_after"`  // 压缩后的文件大小
 }
 
 // NewWAL 创建或打开一个 WAL 文件
@@ -28,7 +39,7 @@ func NewWAL(path string) (*WAL, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &WAL{file: file}, nil
+	return &WAL{path: path, file: file}, nil
 }
 
 // Append 将一个新任务写入日志
@@ -48,15 +59,50 @@ func (w *WAL) Append(task *types.Product) error {
 		return err
 	}
 	// 确保数据被刷新到磁盘，防止数据丢失
+	return w.syncLocked()
+}
+
+// SetSyncOnWrite 设置每条记录写入后是否立即刷新到磁盘，默认开启
+// 关闭后写入更快，但主机掉电时可能丢失最近提交的任务，进程崩溃不受影响
+func (w *WAL) SetSyncOnWrite(sync bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.noSync = !sync
+}
+
+// syncLocked 按设置将写入的记录刷新到磁盘，调用方必须持有 w.mu
+func (w *WAL) syncLocked() error {
+	if w.noSync {
+		return nil
+	}
 	return w.file.Sync()
 }
 
 // Complete 在日志中标记一个任务已完成
 func (w *WAL) Complete(taskID string) error {
+	return w.mark("COMPLETE", taskID)
+}
+
+// Cancel 在日志中标记一个任务已取消，取消的任务在恢复时不会重新加载
+func (w *WAL) Cancel(taskID string) error {
+	return w.mark("CANCEL", taskID)
+}
+
+// Checkpoint 在日志中记录任务最近完成的步骤，恢复时任务从下一个步骤继续，而不是从头开始
+func (w *WAL) Checkpoint(taskID string, cp types.Checkpoint) error {
+	return w.write(LogEntry{Type: "STEP", TaskID: taskID, Checkpoint: &cp})
+}
+
+// mark 写入一条只包含任务 ID 的日志记录
+func (w *WAL) mark(entryType string, taskID string) error {
+	return w.write(LogEntry{Type: entryType, TaskID: taskID})
+}
+
+// write 写入一条日志记录
+func (w *WAL) write(entry LogEntry) error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	entry := LogEntry{Type: "COMPLETE", TaskID: taskID}
 	data, err := json.Marshal(entry)
 	if err != nil {
 		return err
@@ -66,7 +112,7 @@ func (w *WAL) Complete(taskID string) error {
 	if err != nil {
 		return err
 	}
-	return w.file.Sync()
+	return w.syncLocked()
 }
 
 // Recover 从日志文件中恢复未完成的任务
@@ -74,14 +120,22 @@ func (w *WAL) Complete(taskID string) error {
 func (w *WAL) Recover() ([]*types.Product, error) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
+	return w.pendingLocked()
+}
 
+// pendingLocked 读取整个日志文件，按提交顺序返回所有未完成的任务，并将文件指针恢复到末尾
+// 记录了完成步骤的任务附带最近的检查点 (Resume)
+// 调用方必须持有 w.mu
+func (w *WAL) pendingLocked() ([]*types.Product, error) {
 	// 将文件指针移动到开头以进行读取
-	if _, err := w.file.Seek(0, 0); err != nil {
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
 		return nil, err
 	}
 
-	pendingTasks := make(map[string]*types.Product) // 存储所有已提交的任务
-	completedTasks := make(map[string]bool)         // 存储所有已完成的任务 ID
+	var order []string                                // 任务的提交顺序
+	pendingTasks := make(map[string]*types.Product)   // 存储所有已提交的任务
+	completedTasks := make(map[string]bool)           // 存储所有已完成或已取消的任务 ID
+	checkpoints := make(map[string]*types.Checkpoint) // 存储任务最近完成的步骤
 
 	scanner := bufio.NewScanner(w.file)
 	for scanner.Scan() {
@@ -93,8 +147,16 @@ func (w *WAL) Recover() ([]*types.Product, error) {
 
 		switch entry.Type {
 		case "TASK":
+			if _, ok := pendingTasks[entry.Task.ID]; !ok {
+				order = append(order, entry.Task.ID)
+			}
 			pendingTasks[entry.Task.ID] = entry.Task
-		case "COMPLETE":
+			delete(checkpoints, entry.Task.ID)
+		case "STEP":
+			if entry.Checkpoint != nil {
+				checkpoints[entry.TaskID] = entry.Checkpoint
+			}
+		case "COMPLETE", "CANCEL":
 			completedTasks[entry.TaskID] = true
 		}
 	}
@@ -105,20 +167,102 @@ func (w *WAL) Recover() ([]*types.Product, error) {
 
 	// 找出所有已提交但未完成的任务
 	var recoveredTasks []*types.Product
-	for id, task := range pendingTasks {
+	for _, id := range order {
 		if !completedTasks[id] {
+			task := pendingTasks[id]
+			if cp, ok := checkpoints[id]; ok {
+				task.Resume = cp
+			}
 			recoveredTasks = append(recoveredTasks, task)
 		}
 	}
 
 	// 恢复文件指针到末尾，以便后续追加写入
-	if _, err := w.file.Seek(0, os.SEEK_END); err != nil {
+	if _, err := w.file.Seek(0, io.SeekEnd); err != nil {
 		return nil, err
 	}
 
 	return recoveredTasks, nil
 }
 
+// Flush 将已写入的日志刷新到磁盘
+func (w *WAL) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.Sync()
+}
+
+// Compact 重写日志文件，只保留尚未结束的任务，已完成和已取消的任务记录被丢弃，检查点并入任务记录
+// 新文件先写入临时文件再原子替换，压缩失败时原文件保持不变
+func (w *WAL) Compact() (CompactResult, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var result CompactResult
+	if info, err := w.file.Stat(); err == nil {
+		result.BytesBefore = info.Size()
+	}
+	tasks, err := w.pendingLocked()
+	if err != nil {
+		return result, err
+	}
+
+	tmpPath := w.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return result, err
+	}
+	writer := bufio.NewWriter(tmp)
+	for _, task := range tasks {
+		data, err := json.Marshal(LogEntry{Type: "TASK", Task: task})
+		if err == nil {
+			writer.Write(append(data, '\n'))
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return result, err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return result, err
+	}
+	tmp.Close()
+	if err := os.Rename(tmpPath, w.path); err != nil {
+		os.Remove(tmpPath)
+		return result, err
+	}
+
+	// 重新打开替换后的文件，之后的写入追加到新文件
+	file, err := os.OpenFile(w.path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return result, err
+	}
+	w.file.Close()
+	w.file = file
+
+	result.Pending = len(tasks)
+	if info, err := file.Stat(); err == nil {
+		result.BytesAfter = info.Size()
+	}
+	return result, nil
+}
+
+// Reopen 重新打开日志文件，用于读取其他实例写入或压缩替换后的共享日志
+func (w *WAL) Reopen() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	file, err := os.OpenFile(w.path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	w.file.Close()
+	w.file = file
+	return nil
+}
+
 // Close 关闭 WAL 文件
 func (w *WAL) Close() error {
 	w.mu.Lock()
@@ -0,0 +1,344 @@
+// Package planner 根据待处理队列离线生成有限产能下的派工计划
+// 它按工艺路线、工站产能、换型时间和交期模拟整批任务的加工过程，
+// 先用启发式规则构造初始顺序，再用局部搜索 (交换和插入) 降低完工时间和拖期
+package planner
+
+import (
+	"industrial-4.0-demo/internal/types"
+	"slices"
+	"time"
+)
+
+// defaultMaxIterations 是局部搜索默认的最大评估次数
+const defaultMaxIterations = 2000
+
+// Job 是待排产的一个任务
+type Job struct {
+	ProductID string
+	Type      string
+	Priority  int
+	Namespace string
+	DueAt     time.Time            // 交期，零值表示没有交期
+	Steps     []types.WorkflowStep // 工艺路线
+}
+
+// Changeover 是换型矩阵中的一条规则：工站从 From 类型切换到 To 类型时需要的准备时间
+// From、To 为空表示任意类型，Stations 为空表示所有工站；按配置顺序匹配第一条规则
+type Changeover struct {
+	From     string            `mapstructure:"from" json:"from,omitempty"`
+	To       string            `mapstructure:"to" json:"to,omitempty"`
+	Stations []types.StationID `mapstructure:"stations" json:"stations,omitempty"`
+	Seconds  float64           `mapstructure:"seconds" json:"seconds"`
+}
+
+// Options 是排产模型的参数
+type Options struct {
+	Workers         int                               // 同时执行的任务数上限
+	Capacity        map[types.StationID]int           // 工站可同时加工的工件数，未配置或 <= 0 时不限制 (受 Workers 约束)
+	Durations       map[types.StationID]time.Duration // 各工站的加工时间估计
+	DefaultDuration time.Duration                     // 未单独配置的工站的加工时间
+	Move            time.Duration                     // 相邻步骤之间的搬运时间
+	Changeovers     []Changeover                      // 换型矩阵
+	MakespanWeight  float64                           // 目标函数中完工时间的权重
+	TardinessWeight float64                           // 目标函数中总拖期的权重
+	MaxIterations   int                               // 局部搜索的最大评估次数，<= 0 时使用默认值
+}
+
+// Score 是一个派工顺序的评估结果
+type Score struct {
+	Makespan       float64 `json:"makespan_seconds"`        // 最后一个任务的完工时间 (相对于排产时刻)
+	TotalTardiness float64 `json:"total_tardiness_seconds"` // 所有任务拖期之和
+	Late           int     `json:"late"`                    // 预计拖期的任务数
+	Changeovers    int     `json:"changeovers"`             // 换型次数
+	Objective      float64 `json:"objective"`               // 加权目标值，越小越好
+}
+
+// Assignment 是计划中的一个任务
+type Assignment struct {
+	Order            int         `json:"order"` // 出队顺序，从 1 开始
+	ProductID        string      `json:"product_id"`
+	Type             string      `json:"type"`
+	Priority         int         `json:"priority"`
+	Namespace        string      `json:"namespace,omitempty"`
+	DueAt            time.Time   `json:"due_at,omitzero"`
+	Start            time.Time   `json:"start"` // 预计开工时间
+	End              time.Time   `json:"end"`   // 预计完工时间
+	TardinessSeconds float64     `json:"tardiness_seconds,omitempty"`
+	Operations       []Operation `json:"operations"` // 各工站上的预计加工时间
+}
+
+// Operation 是任务在一个工站上的预计加工
+type Operation struct {
+	Step         int             `json:"step"` // 步骤索引
+	StationID    types.StationID `json:"station_id"`
+	Start        time.Time       `json:"start"`                   // 预计开工时间，换型在开工前完成
+	End          time.Time       `json:"end"`                     // 预计完工时间
+	SetupSeconds float64         `json:"setup_seconds,omitempty"` // 开工前的换型时间
+}
+
+// Plan 是优化后的派工计划
+type Plan struct {
+	Score
+	CreatedAt   time.Time    `json:"created_at"`
+	Jobs        []Assignment `json:"jobs"`        // 按计划的出队顺序排列
+	Baseline    Score        `json:"baseline"`    // 按当前出队顺序的评估结果
+	Evaluations int          `json:"evaluations"` // 局部搜索评估的顺序数
+}
+
+// slot 是工站的一个加工位
+type slot struct {
+	free time.Duration // 空闲时刻 (相对于排产时刻)
+	last string        // 最近加工的工件类型，用于计算换型时间
+}
+
+// timing 是模拟得到的单个任务的开工和完工时刻，以及各工站的加工时刻 (只在需要时记录)
+type timing struct {
+	start, end time.Duration
+	ops        []operation
+}
+
+// operation 是模拟得到的一次工站加工
+type operation struct {
+	step       int
+	station    types.StationID
+	start, end time.Duration
+	setup      time.Duration
+}
+
+// Optimize 为 jobs 生成派工计划，jobs 的顺序视为当前的出队顺序
+func Optimize(jobs []Job, opts Options, now time.Time) Plan {
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	maxEvals := opts.MaxIterations
+	if maxEvals <= 0 {
+		maxEvals = defaultMaxIterations
+	}
+
+	baseline := make([]int, len(jobs))
+	for i := range baseline {
+		baseline[i] = i
+	}
+	baseScore, _ := evaluate(jobs, baseline, opts, now, false)
+
+	// 启发式初始解：当前顺序、最早交期优先、按类型成批 (减少换型)，取目标值最小者
+	order, best := baseline, baseScore
+	for _, candidate := range [][]int{earliestDue(jobs, baseline), batched(jobs, baseline)} {
+		if score, _ := evaluate(jobs, candidate, opts, now, false); score.Objective < best.Objective {
+			order, best = candidate, score
+		}
+	}
+	order = slices.Clone(order)
+
+	// 局部搜索：交换两个任务或把一个任务插入到其他位置，目标值下降则接受，直到没有改进或评估次数用完
+	evals := 0
+	try := func(next []int) bool {
+		evals++
+		score, _ := evaluate(jobs, next, opts, now, false)
+		if score.Objective < best.Objective {
+			order, best = next, score
+			return true
+		}
+		return false
+	}
+	for improved := true; improved && evals < maxEvals; {
+		improved = false
+		for i := 0; i < len(order) && evals < maxEvals; i++ {
+			for j := i + 1; j < len(order) && evals < maxEvals; j++ {
+				next := slices.Clone(order)
+				next[i], next[j] = next[j], next[i]
+				if try(next) {
+					improved = true
+				}
+				next = slices.Clone(order)
+				moved := next[j]
+				next = slices.Insert(slices.Delete(next, j, j+1), i, moved)
+				if evals < maxEvals && try(next) {
+					improved = true
+				}
+			}
+		}
+	}
+
+	plan := build(jobs, order, opts, now)
+	plan.Baseline, plan.Evaluations = baseScore, evals
+	return plan
+}
+
+// Project 按 jobs 的顺序 (不做优化) 模拟派工，得到当前出队顺序下的预计进度
+func Project(jobs []Job, opts Options, now time.Time) Plan {
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	order := make([]int, len(jobs))
+	for i := range order {
+		order[i] = i
+	}
+	plan := build(jobs, order, opts, now)
+	plan.Baseline = plan.Score
+	return plan
+}
+
+// build 按 order 顺序模拟派工并生成计划
+func build(jobs []Job, order []int, opts Options, now time.Time) Plan {
+	score, times := evaluate(jobs, order, opts, now, true)
+	plan := Plan{Score: score, CreatedAt: now, Jobs: make([]Assignment, 0, len(order))}
+	for pos, idx := range order {
+		job := jobs[idx]
+		end := now.Add(times[idx].end)
+		a := Assignment{
+			Order:      pos + 1,
+			ProductID:  job.ProductID,
+			Type:       job.Type,
+			Priority:   job.Priority,
+			Namespace:  job.Namespace,
+			DueAt:      job.DueAt,
+			Start:      now.Add(times[idx].start),
+			End:        end,
+			Operations: make([]Operation, 0, len(times[idx].ops)),
+		}
+		if !job.DueAt.IsZero() && end.After(job.DueAt) {
+			a.TardinessSeconds = end.Sub(job.DueAt).Seconds()
+		}
+		for _, op := range times[idx].ops {
+			a.Operations = append(a.Operations, Operation{
+				Step:         op.step,
+				StationID:    op.station,
+				Start:        now.Add(op.start),
+				End:          now.Add(op.end),
+				SetupSeconds: op.setup.Seconds(),
+			})
+		}
+		plan.Jobs = append(plan.Jobs, a)
+	}
+	return plan
+}
+
+// evaluate 按 order 顺序模拟派工，返回评估结果和每个任务的开工、完工时刻 (按 jobs 下标)，record 为 true 时同时记录各工站的加工时刻
+// 任务按顺序占用最早空闲的 worker，每个步骤在各工站选择能最早开工的加工位，
+// 加工位上一个工件的类型不同时先换型；步骤在所有并行工站完成后结束
+func evaluate(jobs []Job, order []int, opts Options, now time.Time, record bool) (Score, []timing) {
+	workers := make([]time.Duration, opts.Workers)
+	stations := make(map[types.StationID][]slot)
+	times := make([]timing, len(jobs))
+	var score Score
+	for _, idx := range order {
+		job := jobs[idx]
+		w := 0
+		for i := range workers {
+			if workers[i] < workers[w] {
+				w = i
+			}
+		}
+		t := workers[w]
+		times[idx].start = t
+		for i, step := range job.Steps {
+			if i > 0 {
+				t += opts.Move
+			}
+			end := t
+			for _, id := range step.StationIDs {
+				slots, ok := stations[id]
+				if !ok {
+					n := opts.Capacity[id]
+					if n <= 0 || n > opts.Workers {
+						n = opts.Workers
+					}
+					slots = make([]slot, n)
+					stations[id] = slots
+				}
+				best, bestStart, bestSetup := 0, time.Duration(-1), time.Duration(0)
+				for k, sl := range slots {
+					setup := time.Duration(0)
+					if sl.last != "" && sl.last != job.Type {
+						setup = opts.changeover(id, sl.last, job.Type)
+					}
+					start := max(t, sl.free+setup)
+					if bestStart < 0 || start < bestStart {
+						best, bestStart, bestSetup = k, start, setup
+					}
+				}
+				if bestSetup > 0 {
+					score.Changeovers++
+				}
+				finish := bestStart + opts.duration(id)
+				slots[best] = slot{free: finish, last: job.Type}
+				if record {
+					times[idx].ops = append(times[idx].ops, operation{step: i, station: id, start: bestStart, end: finish, setup: bestSetup})
+				}
+				end = max(end, finish)
+			}
+			t = end
+		}
+		workers[w] = t
+		times[idx].end = t
+		score.Makespan = max(score.Makespan, t.Seconds())
+		if !job.DueAt.IsZero() {
+			if late := now.Add(t).Sub(job.DueAt); late > 0 {
+				score.TotalTardiness += late.Seconds()
+				score.Late++
+			}
+		}
+	}
+	score.Objective = opts.MakespanWeight*score.Makespan + opts.TardinessWeight*score.TotalTardiness
+	return score, times
+}
+
+// duration 返回工站的加工时间估计
+func (o Options) duration(id types.StationID) time.Duration {
+	if d, ok := o.Durations[id]; ok {
+		return d
+	}
+	return o.DefaultDuration
+}
+
+// changeover 返回工站从 from 类型切换到 to 类型的准备时间，没有匹配的规则时为 0
+func (o Options) changeover(id types.StationID, from, to string) time.Duration {
+	for _, c := range o.Changeovers {
+		if (c.From == "" || c.From == from) && (c.To == "" || c.To == to) && (len(c.Stations) == 0 || slices.Contains(c.Stations, id)) {
+			return time.Duration(c.Seconds * float64(time.Second))
+		}
+	}
+	return 0
+}
+
+// earliestDue 按交期从早到晚排序，没有交期的任务排在最后，其余保持原有顺序
+func earliestDue(jobs []Job, order []int) []int {
+	out := slices.Clone(order)
+	slices.SortStableFunc(out, func(a, b int) int {
+		return compareDue(jobs[a].DueAt, jobs[b].DueAt)
+	})
+	return out
+}
+
+// batched 将同类型的任务排在一起以减少换型，各批次按批内最早的交期排序，批内按交期排序
+func batched(jobs []Job, order []int) []int {
+	byDue := earliestDue(jobs, order)
+	var kinds []string
+	groups := make(map[string][]int)
+	for _, idx := range byDue {
+		t := jobs[idx].Type
+		if _, ok := groups[t]; !ok {
+			kinds = append(kinds, t)
+		}
+		groups[t] = append(groups[t], idx)
+	}
+	out := make([]int, 0, len(order))
+	for _, t := range kinds {
+		out = append(out, groups[t]...)
+	}
+	return out
+}
+
+// compareDue 比较两个交期，零值视为最晚
+func compareDue(a, b time.Time) int {
+	switch {
+	case a.Equal(b):
+		return 0
+	case a.IsZero():
+		return 1
+	case b.IsZero():
+		return -1
+	}
+	return a.Compare(b)
+}
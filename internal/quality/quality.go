@@ -0,0 +1,194 @@
+// Package quality 汇总工站加工时采集的质量测量值，按工站和测量项计算 SPC 统计量 (均值、标准差、控制限和过程能力)
+// 每个测量项只保留最近 MaxSamples 个样本；单个工件的测量值保存在加工履历中
+package quality
+
+import (
+	"cmp"
+	"industrial-4.0-demo/internal/event"
+	"industrial-4.0-demo/internal/history"
+	"industrial-4.0-demo/internal/metrics"
+	"industrial-4.0-demo/internal/types"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MaxSamples 是每个工站的每个测量项参与统计的最近样本数
+const MaxSamples = 500
+
+// Stats 是一个工站的一个测量项在最近样本上的统计量
+// 控制限为均值 ± 3 倍标准差；Cp 需要同时有上下限，Cpk 取已有界限中较小的一侧，标准差为 0 或缺少界限时为 0
+type Stats struct {
+	StationID types.StationID `json:"station_id"`
+	Name      string          `json:"name"`
+	Unit      string          `json:"unit,omitempty"`
+	Count     int             `json:"count"`
+	Mean      float64         `json:"mean"`
+	StdDev    float64         `json:"std_dev"`
+	Min       float64         `json:"min"`
+	Max       float64         `json:"max"`
+	LSL       *float64        `json:"lsl,omitempty"` // 最近一个样本的规格界限
+	USL       *float64        `json:"usl,omitempty"`
+	UCL       float64         `json:"ucl"`         // 上控制限
+	LCL       float64         `json:"lcl"`         // 下控制限
+	OutOfSpec int             `json:"out_of_spec"` // 超出规格界限的样本数
+	Cp        float64         `json:"cp"`
+	Cpk       float64         `json:"cpk"`
+}
+
+// StepQuality 是工件在一个工站上采集的测量值
+type StepQuality struct {
+	Step         int             `json:"step"`
+	StationID    types.StationID `json:"station_id"`
+	FinishedAt   time.Time       `json:"finished_at,omitzero"`
+	Success      bool            `json:"success"`
+	Measurements []Result        `json:"measurements"`
+}
+
+// Result 是一个测量值及其是否在规格界限内
+type Result struct {
+	types.Measurement
+	InSpec bool `json:"in_spec"`
+}
+
+// ProductQuality 是单个工件的全部测量值，按步骤排列
+type ProductQuality struct {
+	ProductID string        `json:"product_id"`
+	Type      string        `json:"type"`
+	Namespace string        `json:"namespace,omitempty"`
+	InSpec    bool          `json:"in_spec"` // 所有测量值都在规格界限内
+	Steps     []StepQuality `json:"steps"`
+}
+
+// key 标识一个工站上的一个测量项
+type key struct {
+	station types.StationID
+	name    string
+}
+
+// series 是一个测量项的最近样本
+type series struct {
+	unit     string
+	lsl, usl *float64
+	values   []float64
+}
+
+// Tracker 订阅步骤完成事件，按工站和测量项保留最近的样本
+type Tracker struct {
+	mu      sync.Mutex
+	series  map[key]*series
+	metrics *metrics.Metrics
+}
+
+// NewTracker 创建一个质量追踪器
+func NewTracker(m *metrics.Metrics) *Tracker {
+	return &Tracker{series: make(map[key]*series), metrics: m}
+}
+
+// Register 订阅步骤完成事件，失败的步骤同样计入统计
+func (t *Tracker) Register(bus *event.Bus) {
+	bus.Subscribe(event.StepCompleted, func(e event.Event) {
+		for _, m := range e.Measurements {
+			t.observe(e.StationID, e.Namespace(), m)
+		}
+	})
+}
+
+// observe 记录一个测量值，超出规格界限时按命名空间计数
+func (t *Tracker) observe(id types.StationID, namespace string, m types.Measurement) {
+	t.mu.Lock()
+	k := key{station: id, name: m.Name}
+	s, ok := t.series[k]
+	if !ok {
+		s = &series{}
+		t.series[k] = s
+	}
+	s.unit, s.lsl, s.usl = m.Unit, m.LSL, m.USL
+	s.values = append(s.values, m.Value)
+	if len(s.values) > MaxSamples {
+		s.values = slices.Delete(s.values, 0, len(s.values)-MaxSamples)
+	}
+	t.mu.Unlock()
+
+	if !m.InSpec() {
+		t.metrics.QualityOutOfSpecTotal.WithLabelValues(string(id), m.Name, namespace).Inc()
+	}
+}
+
+// Stats 返回各工站各测量项的统计量，按工站和测量项名称排序，stationID 不为空时只返回该工站
+func (t *Tracker) Stats(stationID types.StationID) []Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	list := []Stats{}
+	for k, s := range t.series {
+		if stationID != "" && k.station != stationID {
+			continue
+		}
+		list = append(list, s.stats(k))
+	}
+	slices.SortFunc(list, func(a, b Stats) int {
+		return cmp.Or(cmp.Compare(a.StationID, b.StationID), cmp.Compare(a.Name, b.Name))
+	})
+	return list
+}
+
+// stats 计算样本的统计量，调用方必须持有 t.mu
+func (s *series) stats(k key) Stats {
+	st := Stats{StationID: k.station, Name: k.name, Unit: s.unit, Count: len(s.values), LSL: s.lsl, USL: s.usl}
+	if st.Count == 0 {
+		return st
+	}
+	st.Min, st.Max = slices.Min(s.values), slices.Max(s.values)
+	var sum float64
+	for _, v := range s.values {
+		sum += v
+		if !(types.Measurement{Value: v, LSL: s.lsl, USL: s.usl}).InSpec() {
+			st.OutOfSpec++
+		}
+	}
+	st.Mean = sum / float64(st.Count)
+	if st.Count > 1 {
+		var sq float64
+		for _, v := range s.values {
+			sq += (v - st.Mean) * (v - st.Mean)
+		}
+		st.StdDev = math.Sqrt(sq / float64(st.Count-1))
+	}
+	st.UCL, st.LCL = st.Mean+3*st.StdDev, st.Mean-3*st.StdDev
+	if st.StdDev == 0 {
+		return st
+	}
+	if s.lsl != nil && s.usl != nil {
+		st.Cp = (*s.usl - *s.lsl) / (6 * st.StdDev)
+	}
+	cpk := math.Inf(1)
+	if s.usl != nil {
+		cpk = min(cpk, (*s.usl-st.Mean)/(3*st.StdDev))
+	}
+	if s.lsl != nil {
+		cpk = min(cpk, (st.Mean-*s.lsl)/(3*st.StdDev))
+	}
+	if !math.IsInf(cpk, 1) {
+		st.Cpk = cpk
+	}
+	return st
+}
+
+// ForProduct 从工件的加工履历中取出测量值，没有采集测量值的步骤不包含在内
+func ForProduct(rec history.Record) ProductQuality {
+	q := ProductQuality{ProductID: rec.ProductID, Type: rec.Type, Namespace: rec.Namespace, InSpec: true, Steps: []StepQuality{}}
+	for _, step := range rec.Steps {
+		if len(step.Measurements) == 0 {
+			continue
+		}
+		sq := StepQuality{Step: step.Step, StationID: step.StationID, FinishedAt: step.FinishedAt, Success: step.Success}
+		for _, m := range step.Measurements {
+			r := Result{Measurement: m, InSpec: m.InSpec()}
+			q.InSpec = q.InSpec && r.InSpec
+			sq.Measurements = append(sq.Measurements, r)
+		}
+		q.Steps = append(q.Steps, sq)
+	}
+	return q
+}
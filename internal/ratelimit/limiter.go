@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// bucket 是单个调用方的令牌桶
+type bucket struct {
+	tokens   float64   // 当前可用令牌数
+	lastSeen time.Time // 最近一次补充令牌的时间
+}
+
+// Limiter 是按 key (API Key、IP 等) 区分的令牌桶限流器
+type Limiter struct {
+	mu        sync.Mutex
+	rate      float64            // 每秒补充的令牌数
+	burst     float64            // 桶容量，即允许的突发请求数
+	buckets   map[string]*bucket // 每个 key 一个令牌桶
+	lastSweep time.Time          // 最近一次清理空闲令牌桶的时间
+	now       func() time.Time   // 当前时间，测试时可替换
+}
+
+// idleTTL 定义令牌桶的空闲回收时间，避免大量一次性客户端导致内存增长
+const idleTTL = 10 * time.Minute
+
+// NewLimiter 创建一个新的限流器
+// rate 为每秒允许的平均请求数，burst 为允许的突发请求数
+func NewLimiter(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:      rate,
+		burst:     float64(burst),
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// Allow 尝试为 key 消耗一个令牌
+// 返回是否允许本次请求，以及被拒绝时建议的重试等待时间
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, lastSeen: now}
+		l.buckets[key] = b
+	}
+
+	// 按流逝的时间补充令牌，不超过桶容量
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.lastSeen).Seconds()*l.rate)
+	b.lastSeen = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if l.rate <= 0 {
+		return false, time.Minute
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// sweep 清理长时间未使用的令牌桶 (调用方需持有锁)
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.lastSeen) > idleTTL {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package ratelimit
+
+import (
+	"industrial-4.0-demo/internal/auth"
+	"industrial-4.0-demo/internal/metrics"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// Middleware 返回一个限流中间件，超出限额的请求返回 429 并附带 Retry-After
+// route 用于指标标签；limiter 为 nil 时表示未启用限流，请求直接放行
+func Middleware(limiter *Limiter, route string, m *metrics.Metrics, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limiter == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := clientKey(r)
+			if ok, wait := limiter.Allow(key); !ok {
+				m.RateLimitedRequestsTotal.WithLabelValues(route).Inc()
+				logger.Warn("请求被限流", "client", key, "route", route)
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientKey 返回限流使用的调用方标识
+// 已认证的请求使用调用方身份，否则使用客户端 IP
+func clientKey(r *http.Request) string {
+	if p, ok := auth.PrincipalFromContext(r.Context()); ok {
+		return p.Method + ":" + p.Subject
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
@@ -0,0 +1,253 @@
+// Package reliability 根据步骤事件和工站状态变更统计各工站的步骤失败率、平均故障间隔 (MTBF) 和平均修复时间 (MTTR)，为预测性维护提供基础数据
+//   - 失败率: 加工失败的步骤数 / 加工的步骤数
+//   - MTBF: 运行时间 / 故障次数，运行时间是窗口时长减去故障停机 (DOWN) 和维护 (MAINTENANCE) 时间，进入 DOWN 计为一次故障
+//   - MTTR: 修复时长之和 / 修复次数，离开 DOWN 计为一次修复，修复时长按整段停机计算 (包括窗口开始前的部分)
+package reliability
+
+import (
+	"cmp"
+	"context"
+	"industrial-4.0-demo/internal/event"
+	"industrial-4.0-demo/internal/fsm"
+	"industrial-4.0-demo/internal/metrics"
+	"industrial-4.0-demo/internal/types"
+	"industrial-4.0-demo/internal/windowed"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gaugeInterval 是刷新 station_step_failure_rate、station_mtbf_seconds 和 station_mttr_seconds 指标的间隔
+const gaugeInterval = 10 * time.Second
+
+// StationReliability 是一个工站在统计窗口内的可靠性指标
+type StationReliability struct {
+	StationID       types.StationID `json:"station_id"`
+	Steps           int             `json:"steps"`            // 加工的步骤数
+	FailedSteps     int             `json:"failed_steps"`     // 加工失败的步骤数
+	FailureRate     float64         `json:"failure_rate"`     // 0 ~ 1，窗口内没有加工时为 0
+	Breakdowns      int             `json:"breakdowns"`       // 进入 DOWN 的次数
+	Repairs         int             `json:"repairs"`          // 离开 DOWN 的次数
+	UptimeSeconds   float64         `json:"uptime_seconds"`   // 运行时间
+	DowntimeSeconds float64         `json:"downtime_seconds"` // 故障停机时间
+	MTBFSeconds     float64         `json:"mtbf_seconds"`     // 窗口内没有故障时为 0
+	MTTRSeconds     float64         `json:"mttr_seconds"`     // 窗口内没有修复时为 0
+}
+
+// Report 是统计窗口内所有工站的可靠性指标
+// 窗口早于追踪开始时从追踪开始时计算
+type Report struct {
+	Window   string               `json:"window"`
+	From     time.Time            `json:"from"`
+	To       time.Time            `json:"to"`
+	Stations []StationReliability `json:"stations"`
+}
+
+// transition 是一次工站状态变更
+type transition struct {
+	seq   uint64
+	at    time.Time
+	state string
+}
+
+// stepRecord 是工站上的一次加工
+type stepRecord struct {
+	at     time.Time
+	failed bool
+}
+
+// stationLog 记录保留时长内一个工站的状态变更和加工
+// 状态变更按序号排序，并保留保留时长之前的最后一次变更，用于确定窗口开始时的状态和停机的开始时间
+type stationLog struct {
+	transitions []transition
+	steps       []stepRecord
+}
+
+// Tracker 订阅事件总线，保留最近 retention 时长内的事件并按需计算可靠性指标
+type Tracker struct {
+	mu        sync.Mutex
+	retention windowed.Retention
+	stations  map[types.StationID]*stationLog
+	metrics   *metrics.Metrics
+}
+
+// NewTracker 创建一个可靠性追踪器，retention 是事件的保留时长，也是可查询的最大窗口；m 是 Run 更新的指标
+func NewTracker(retention time.Duration, m *metrics.Metrics) *Tracker {
+	return &Tracker{
+		retention: windowed.NewRetention(retention),
+		stations:  make(map[types.StationID]*stationLog),
+		metrics:   m,
+	}
+}
+
+// Register 订阅步骤完成和工站状态变更事件
+// 被停用的工站拒绝的步骤 (StepRejected) 没有加工，不计入
+func (t *Tracker) Register(bus *event.Bus) {
+	bus.Subscribe(event.StepCompleted, func(e event.Event) {
+		t.recordStep(e.StationID, e.Timestamp, e.Error != nil)
+	})
+	bus.Subscribe(event.StationStatusChanged, func(e event.Event) {
+		t.recordStatus(e.StationID, e.Seq, e.Timestamp, e.ToState)
+	})
+}
+
+// Run 定期按 window 统计可靠性指标并更新指标，直到 ctx 结束，window 超过保留时长时使用保留时长
+// 窗口内没有故障或修复的工站不导出 MTBF 或 MTTR
+func (t *Tracker) Run(ctx context.Context, window time.Duration) {
+	window = t.retention.Clamp(window)
+	ticker := time.NewTicker(gaugeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			report, _ := t.Report(window, now)
+			for _, s := range report.Stations {
+				id := string(s.StationID)
+				t.metrics.StationStepFailureRate.WithLabelValues(id).Set(s.FailureRate)
+				if s.Breakdowns > 0 {
+					t.metrics.StationMTBF.WithLabelValues(id).Set(s.MTBFSeconds)
+				} else {
+					t.metrics.StationMTBF.DeleteLabelValues(id)
+				}
+				if s.Repairs > 0 {
+					t.metrics.StationMTTR.WithLabelValues(id).Set(s.MTTRSeconds)
+				} else {
+					t.metrics.StationMTTR.DeleteLabelValues(id)
+				}
+			}
+		}
+	}
+}
+
+// recordStep 记录一次加工
+func (t *Tracker) recordStep(id types.StationID, at time.Time, failed bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	log := t.stationLocked(id)
+	log.steps = append(log.steps, stepRecord{at: at, failed: failed})
+	t.pruneLocked(log, at)
+}
+
+// recordStatus 按序号插入一次状态变更，处理器是异步执行的，变更可能乱序到达，重复的序号被忽略
+func (t *Tracker) recordStatus(id types.StationID, seq uint64, at time.Time, state string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	log := t.stationLocked(id)
+	i, found := slices.BinarySearchFunc(log.transitions, seq, func(tr transition, seq uint64) int {
+		return cmp.Compare(tr.seq, seq)
+	})
+	if found {
+		return
+	}
+	log.transitions = slices.Insert(log.transitions, i, transition{seq: seq, at: at, state: state})
+	t.pruneLocked(log, at)
+}
+
+// stationLocked 返回工站的记录，不存在时创建，调用方必须持有锁
+func (t *Tracker) stationLocked(id types.StationID) *stationLog {
+	log, ok := t.stations[id]
+	if !ok {
+		log = &stationLog{}
+		t.stations[id] = log
+	}
+	return log
+}
+
+// pruneLocked 丢弃超过保留时长的加工和状态变更，调用方必须持有锁
+func (t *Tracker) pruneLocked(log *stationLog, now time.Time) {
+	cutoff := t.retention.Cutoff(now)
+	log.steps = windowed.Prune(log.steps, cutoff, func(s stepRecord) time.Time { return s.at })
+	log.transitions = windowed.PruneKeepLast(log.transitions, cutoff, func(tr transition) time.Time { return tr.at })
+}
+
+// Report 统计截至 now 的 window 时长内各工站的可靠性指标，按工站 ID 排序
+func (t *Tracker) Report(window time.Duration, now time.Time) (Report, error) {
+	from, err := t.retention.From(window, now)
+	if err != nil {
+		return Report{}, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	report := Report{Window: window.String(), From: from, To: now, Stations: []StationReliability{}}
+	for id, log := range t.stations {
+		report.Stations = append(report.Stations, t.stationReliabilityLocked(id, log, from, now))
+	}
+	slices.SortFunc(report.Stations, func(a, b StationReliability) int {
+		return strings.Compare(string(a.StationID), string(b.StationID))
+	})
+	return report, nil
+}
+
+// stationReliabilityLocked 统计一个工站在 [from, to] 内的可靠性指标，调用方必须持有锁
+func (t *Tracker) stationReliabilityLocked(id types.StationID, log *stationLog, from, to time.Time) StationReliability {
+	s := StationReliability{StationID: id}
+
+	// 工站在第一次状态变更前处于 IDLE
+	var down, maintenance, repairTime time.Duration
+	state, since := string(fsm.StationIdle), t.retention.Started()
+	accumulate := func(until time.Time) {
+		d := overlap(since, until, from, to)
+		switch state {
+		case string(fsm.StationDown):
+			down += d
+		case string(fsm.StationMaintenance):
+			maintenance += d
+		}
+	}
+	within := func(at time.Time) bool { return !at.Before(from) && !at.After(to) }
+	for _, tr := range log.transitions {
+		accumulate(tr.at)
+		wasDown, isDown := state == string(fsm.StationDown), tr.state == string(fsm.StationDown)
+		switch {
+		case !wasDown && isDown && within(tr.at):
+			s.Breakdowns++
+		case wasDown && !isDown && within(tr.at):
+			s.Repairs++
+			repairTime += tr.at.Sub(since)
+		}
+		state, since = tr.state, tr.at
+	}
+	accumulate(to)
+
+	uptime := to.Sub(from) - down - maintenance
+	s.UptimeSeconds = uptime.Seconds()
+	s.DowntimeSeconds = down.Seconds()
+	if s.Breakdowns > 0 {
+		s.MTBFSeconds = uptime.Seconds() / float64(s.Breakdowns)
+	}
+	if s.Repairs > 0 {
+		s.MTTRSeconds = repairTime.Seconds() / float64(s.Repairs)
+	}
+
+	for _, step := range log.steps {
+		if !within(step.at) {
+			continue
+		}
+		s.Steps++
+		if step.failed {
+			s.FailedSteps++
+		}
+	}
+	if s.Steps > 0 {
+		s.FailureRate = float64(s.FailedSteps) / float64(s.Steps)
+	}
+	return s
+}
+
+// overlap 返回 [start, end) 与 [from, to) 重叠的时长
+func overlap(start, end, from, to time.Time) time.Duration {
+	if start.Before(from) {
+		start = from
+	}
+	if end.After(to) {
+		end = to
+	}
+	if !end.After(start) {
+		return 0
+	}
+	return end.Sub(start)
+}
@@ -0,0 +1,173 @@
+package reload
+
+import (
+	"errors"
+	"industrial-4.0-demo/internal/config"
+	"industrial-4.0-demo/internal/types"
+	"maps"
+	"reflect"
+	"strings"
+)
+
+// ErrNoChange 表示修改请求中没有任何配置项
+var ErrNoChange = errors.New("没有需要修改的配置项")
+
+// Patch 是运行中修改配置的请求，只包含可以直接生效的配置项，未出现的配置项保持不变
+type Patch struct {
+	Simulation    *SimulationPatch        `json:"simulation,omitempty"`
+	ResourcePools map[types.StationID]int `json:"resource_pools,omitempty"` // 按工站修改资源池容量，0 表示不再限制并发
+	WIPLimits     map[types.StationID]int `json:"wip_limits,omitempty"`     // 按工站修改在制品上限，0 表示不再限制在制品
+	Logging       *LoggingPatch           `json:"logging,omitempty"`
+}
+
+// SimulationPatch 修改模拟器的默认参数
+type SimulationPatch struct {
+	Rate  *float64       `json:"rate,omitempty"`
+	Mix   map[string]int `json:"mix,omitempty"` // 替换整个产品配比
+	Limit *int           `json:"limit,omitempty"`
+}
+
+// LoggingPatch 修改日志级别，Level 为空时保持整体级别不变，Components 中级别为空的组件取消覆盖
+type LoggingPatch struct {
+	Level      string            `json:"level,omitempty"`
+	Components map[string]string `json:"components,omitempty"`
+}
+
+// Change 是一个配置项修改前后的值
+type Change struct {
+	Key    string      `json:"key"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Effective 返回当前生效的配置，日志级别和功能开关取自运行中的设置，包括通过各自的接口所做的修改
+func (r *Reloader) Effective() config.Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.syncRuntimeLocked()
+	effective := *r.current
+	effective.ResourcePools = upperStations(effective.ResourcePools)
+	effective.WIPLimits = upperStations(effective.WIPLimits)
+	return effective
+}
+
+// Patch 修改可以直接生效的配置项并立即应用，返回实际发生变化的配置项
+// 修改后的配置未通过校验，或者无法应用到当前的工站时，返回错误且不做任何修改
+// 修改只保存在内存中，配置文件被重新加载时以配置文件为准
+func (r *Reloader) Patch(p Patch) ([]Change, error) {
+	if p.Simulation == nil && p.ResourcePools == nil && p.WIPLimits == nil && p.Logging == nil {
+		return nil, ErrNoChange
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.syncRuntimeLocked()
+
+	next := *r.current
+	if s := p.Simulation; s != nil {
+		if s.Rate != nil {
+			next.Simulation.Rate = *s.Rate
+		}
+		if s.Mix != nil {
+			next.Simulation.Mix = maps.Clone(s.Mix)
+		}
+		if s.Limit != nil {
+			next.Simulation.Limit = *s.Limit
+		}
+	}
+	if p.ResourcePools != nil {
+		next.ResourcePools = patchStations(r.current.ResourcePools, p.ResourcePools)
+	}
+	if p.WIPLimits != nil {
+		next.WIPLimits = patchStations(r.current.WIPLimits, p.WIPLimits)
+	}
+	if l := p.Logging; l != nil {
+		if l.Level != "" {
+			next.Logging.Level = strings.ToLower(l.Level)
+		}
+		next.Logging.Components = maps.Clone(r.current.Logging.Components)
+		for c, level := range l.Components {
+			c = strings.ToLower(c)
+			if level == "" {
+				delete(next.Logging.Components, c)
+				continue
+			}
+			next.Logging.Components[c] = strings.ToLower(level)
+		}
+	}
+
+	changed := diff(reflect.ValueOf(*r.current), reflect.ValueOf(next), "")
+	if len(changed) == 0 {
+		return nil, nil
+	}
+	if err := next.Validate(); err != nil {
+		return nil, err
+	}
+	if err := r.check(&next, changed); err != nil {
+		return nil, err
+	}
+	changes := make([]Change, 0, len(changed))
+	for _, key := range changed {
+		changes = append(changes, Change{Key: key, Before: value(r.current, key), After: value(&next, key)})
+	}
+	r.apply(&next, changed)
+	for _, c := range changes {
+		r.logger.Info("配置已通过接口修改", "key", c.Key, "before", c.Before, "after", c.After)
+	}
+	return changes, nil
+}
+
+// patchStations 将按工站的修改合并到当前配置中，值为 0 的工站从配置中删除
+// viper 读出的工站 ID 为小写，与配置文件重新加载的结果保持一致
+func patchStations(current, patch map[types.StationID]int) map[types.StationID]int {
+	next := make(map[types.StationID]int, len(current))
+	for id, n := range current {
+		next[types.StationID(strings.ToLower(string(id)))] = n
+	}
+	for id, n := range patch {
+		key := types.StationID(strings.ToLower(string(id)))
+		if n == 0 {
+			delete(next, key)
+			continue
+		}
+		next[key] = n
+	}
+	return next
+}
+
+// upperStations 返回工站 ID 还原为大写的副本
+func upperStations(m map[types.StationID]int) map[types.StationID]int {
+	upper := make(map[types.StationID]int, len(m))
+	for id, n := range m {
+		upper[stationID(id)] = n
+	}
+	return upper
+}
+
+// syncRuntimeLocked 用运行中的日志级别和功能开关更新当前生效的配置，调用方必须持有 r.mu
+func (r *Reloader) syncRuntimeLocked() {
+	r.current.Features = r.flags.Values()
+	// 运行中的级别为 slog 的大写名称，配置文件中使用小写
+	state := r.levels.State()
+	r.current.Logging.Level = strings.ToLower(state.Level)
+	r.current.Logging.Components = make(map[string]string, len(state.Components))
+	for c, level := range state.Components {
+		r.current.Logging.Components[c] = strings.ToLower(level)
+	}
+}
+
+// value 按配置项名称 (例如 simulation.rate) 读取配置的值，资源池和在制品上限的工站 ID 还原为大写
+func value(cfg *config.Config, key string) interface{} {
+	v := reflect.ValueOf(*cfg)
+	for _, name := range strings.Split(key, ".") {
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).Tag.Get("mapstructure") == name {
+				v = v.Field(i)
+				break
+			}
+		}
+	}
+	if stations, ok := v.Interface().(map[types.StationID]int); ok {
+		return upperStations(stations)
+	}
+	return v.Interface()
+}
@@ -0,0 +1,537 @@
+// Package reload 在运行中重新加载配置文件：收到 SIGHUP 或配置文件被修改时，先校验新配置，全部通过后再一并生效
+// 工作线程数、工作流、资源池容量、优先级策略、日历、模拟器参数、日志级别和功能开关可以直接生效，监听地址、WAL 路径等其余配置项只报告为需要重启
+package reload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"industrial-4.0-demo/internal/calendar"
+	"industrial-4.0-demo/internal/config"
+	"industrial-4.0-demo/internal/engine"
+	"industrial-4.0-demo/internal/features"
+	"industrial-4.0-demo/internal/logging"
+	"industrial-4.0-demo/internal/maintenance"
+	"industrial-4.0-demo/internal/oee"
+	"industrial-4.0-demo/internal/planner"
+	"industrial-4.0-demo/internal/simulator"
+	"industrial-4.0-demo/internal/types"
+	"log/slog"
+	"maps"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// debounce 是配置文件变更后等待写入完成的时间，编辑器保存一次文件通常会触发多个事件
+const debounce = 200 * time.Millisecond
+
+// hotKeys 是可以在运行中生效的配置项，其余配置项修改后需要重启
+var hotKeys = []string{
+	"max_workers",
+	"namespace_quotas",
+	"workflows",
+	"resource_pools",
+	"wip_limits",
+	"planner.changeovers",
+	"planner.makespan_weight",
+	"planner.tardiness_weight",
+	"planner.max_iterations",
+	"priority_policy.enabled",
+	"priority_policy.default",
+	"priority_policy.types",
+	"priority_policy.boosts",
+	"maintenance.rules",
+	"calendar.timezone",
+	"calendar.shifts",
+	"calendar.breaks",
+	"calendar.downtime",
+	"simulation.scenario",
+	"simulation.rate",
+	"simulation.mix",
+	"simulation.limit",
+	"simulation.scenarios_dir",
+	"logging.level",
+	"logging.components",
+	"features",
+}
+
+// Result 是一次重新加载的结果
+type Result struct {
+	Applied         []string `json:"applied"`          // 已生效的配置项
+	RestartRequired []string `json:"restart_required"` // 已修改但需要重启才能生效的配置项
+}
+
+// Reloader 保存当前生效的配置，重新加载时与配置文件比较并应用变化
+type Reloader struct {
+	mu        sync.Mutex
+	current   *config.Config // 当前生效的配置，需要重启的配置项保持启动时的值
+	scheduler *engine.Scheduler
+	sim       *simulator.Simulator
+	levels    *logging.Levels
+	flags     *features.Flags
+	oee       *oee.Tracker // OEE 追踪器，为 nil 时日历只影响派发
+	maint     *maintenance.Tracker
+	logger    *slog.Logger
+}
+
+// New 创建一个重新加载器，current 是启动时加载的配置
+func New(current *config.Config, scheduler *engine.Scheduler, sim *simulator.Simulator, levels *logging.Levels, flags *features.Flags, logger *slog.Logger) *Reloader {
+	effective := *current
+	return &Reloader{
+		current:   &effective,
+		scheduler: scheduler,
+		sim:       sim,
+		levels:    levels,
+		flags:     flags,
+		logger:    logger.With("component", "reload"),
+	}
+}
+
+// SetOEE 设置 OEE 追踪器，日历修改后同时用于区分计划停机和故障停机
+func (r *Reloader) SetOEE(t *oee.Tracker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.oee = t
+}
+
+// SetMaintenance 设置维护追踪器，维护规则修改后替换追踪器的规则
+func (r *Reloader) SetMaintenance(t *maintenance.Tracker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.maint = t
+}
+
+// Reload 重新读取配置文件并应用可以直接生效的变化
+// 新配置未通过校验，或者无法应用到当前的工站和工作流时，返回错误且不做任何修改
+func (r *Reloader) Reload() (Result, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// 沿用启动时的配置集，配置集修改后需要重启
+	overrides := r.current.Overrides()
+	if overrides == nil {
+		overrides = config.Overrides{}
+	}
+	overrides["profile"] = r.current.Profile
+	next, err := config.LoadConfig(r.current.File(), overrides)
+	if err != nil {
+		return Result{}, err
+	}
+	if err := next.Validate(); err != nil {
+		return Result{}, err
+	}
+	changed := diff(reflect.ValueOf(*r.current), reflect.ValueOf(*next), "")
+	var result Result
+	for _, key := range changed {
+		if slices.Contains(hotKeys, key) {
+			result.Applied = append(result.Applied, key)
+		} else {
+			result.RestartRequired = append(result.RestartRequired, key)
+		}
+	}
+	if err := r.check(next, result.Applied); err != nil {
+		return Result{}, err
+	}
+	r.apply(next, result.Applied)
+	return result, nil
+}
+
+// check 确认新配置可以应用到运行中的组件，在修改任何状态之前调用
+func (r *Reloader) check(next *config.Config, applied []string) error {
+	wf := r.scheduler.Engine()
+	if slices.Contains(applied, "workflows") {
+		for _, name := range slices.Sorted(maps.Keys(next.Workflows)) {
+			if err := wf.ValidateWorkflow(name, next.Workflows[name]); err != nil {
+				return fmt.Errorf("workflows.%s: %w", name, err)
+			}
+		}
+		fallback := wf.Workflows().Fallback()
+		for name := range r.current.Workflows {
+			if _, ok := next.Workflows[name]; !ok && fallback != "" && strings.EqualFold(name, fallback) {
+				return fmt.Errorf("workflows.%s: %w", name, engine.ErrWorkflowProtected)
+			}
+		}
+	}
+	if slices.Contains(applied, "resource_pools") {
+		for id := range next.ResourcePools {
+			if _, ok := wf.Stations().Get(stationID(id)); !ok {
+				return fmt.Errorf("resource_pools.%s: %w", id, engine.ErrStationNotFound)
+			}
+		}
+	}
+	if slices.Contains(applied, "wip_limits") {
+		for id := range next.WIPLimits {
+			if _, ok := wf.Stations().Get(stationID(id)); !ok {
+				return fmt.Errorf("wip_limits.%s: %w", id, engine.ErrStationNotFound)
+			}
+		}
+	}
+	if slices.ContainsFunc(applied, isPriorityPolicyKey) {
+		if _, err := PriorityPolicy(next); err != nil {
+			return fmt.Errorf("priority_policy: %w", err)
+		}
+	}
+	if slices.ContainsFunc(applied, isCalendarKey) {
+		if _, err := calendar.New(next.Calendar); err != nil {
+			return fmt.Errorf("calendar: %w", err)
+		}
+	}
+	if slices.ContainsFunc(applied, isSimulationKey) {
+		if err := simulator.CheckSettings(simulationSettings(next)); err != nil {
+			return fmt.Errorf("simulation: %w", err)
+		}
+	}
+	return nil
+}
+
+// apply 应用已通过检查的变化，并更新当前生效的配置
+func (r *Reloader) apply(next *config.Config, applied []string) {
+	wf := r.scheduler.Engine()
+	for _, key := range applied {
+		switch key {
+		case "max_workers":
+			if err := r.scheduler.SetMaxWorkers(next.MaxWorkers); err != nil {
+				r.logger.Error("调整工作线程数失败", "error", err)
+			}
+			r.current.MaxWorkers = next.MaxWorkers
+		case "namespace_quotas":
+			if err := r.scheduler.SetNamespaceQuotas(next.NamespaceQuotas); err != nil {
+				r.logger.Error("调整命名空间配额失败", "error", err)
+			}
+			r.current.NamespaceQuotas = next.NamespaceQuotas
+		case "workflows":
+			r.applyWorkflows(wf, next.Workflows)
+			r.current.Workflows = next.Workflows
+		case "resource_pools":
+			// 配置中不再出现的工站不再限制并发
+			sizes := make(map[types.StationID]int, len(next.ResourcePools))
+			for id, size := range next.ResourcePools {
+				sizes[stationID(id)] = size
+			}
+			for _, info := range wf.Stations().List() {
+				if size := sizes[info.ID]; size != info.PoolSize {
+					if _, err := wf.Stations().ResizePool(info.ID, size); err != nil {
+						r.logger.Error("调整资源池容量失败", "station_id", info.ID, "error", err)
+						continue
+					}
+					r.logger.Info("资源池容量已调整", "station_id", info.ID, "from", info.PoolSize, "to", size)
+				}
+			}
+			r.current.ResourcePools = next.ResourcePools
+		case "wip_limits":
+			// 配置中不再出现的工站不再限制在制品
+			wf.Stations().SetWIPLimits(next.WIPLimits)
+			r.logger.Info("在制品上限已调整", "wip_limits", next.WIPLimits)
+			r.current.WIPLimits = next.WIPLimits
+		case "maintenance.rules":
+			if r.maint != nil {
+				r.maint.SetRules(MaintenanceRules(next))
+			}
+			r.current.Maintenance = next.Maintenance
+		case "features":
+			if err := r.flags.Update(next.Features); err != nil {
+				r.logger.Error("调整功能开关失败", "error", err)
+			}
+			r.current.Features = next.Features
+		}
+	}
+	if slices.Contains(applied, "logging.level") || slices.Contains(applied, "logging.components") {
+		// 配置中不再出现的组件取消覆盖，恢复使用整体级别
+		components := make(map[string]string, len(logging.Components))
+		for _, c := range logging.Components {
+			components[c] = ""
+		}
+		for c, v := range next.Logging.Components {
+			components[strings.ToLower(c)] = v
+		}
+		if err := r.levels.Update(next.Logging.Level, components); err != nil {
+			r.logger.Error("调整日志级别失败", "error", err)
+		}
+		r.current.Logging.Level = next.Logging.Level
+		r.current.Logging.Components = next.Logging.Components
+	}
+	if slices.ContainsFunc(applied, isPriorityPolicyKey) {
+		policy, err := PriorityPolicy(next)
+		if err != nil {
+			r.logger.Error("调整优先级策略失败", "error", err)
+		}
+		r.scheduler.SetPriorityPolicy(policy)
+		r.current.PriorityPolicy = next.PriorityPolicy
+	}
+	if slices.ContainsFunc(applied, isPlannerKey) {
+		// 加工时间等其余参数沿用当前生效的配置
+		r.current.Planner = next.Planner
+		r.scheduler.SetPlanning(Planning(r.current))
+		r.logger.Info("派工计划的排产参数已调整")
+	}
+	if slices.ContainsFunc(applied, isCalendarKey) {
+		cal, err := calendar.New(next.Calendar)
+		if err != nil {
+			r.logger.Error("调整日历失败", "error", err)
+		}
+		wf.Stations().SetCalendar(cal)
+		wf.Operators().SetCalendar(cal)
+		if r.oee != nil {
+			r.oee.SetCalendar(cal)
+		}
+		r.current.Calendar = next.Calendar
+	}
+	if slices.ContainsFunc(applied, isSimulationKey) {
+		if err := r.sim.SetDefaults(simulationSettings(next)); err != nil {
+			r.logger.Error("调整模拟器参数失败", "error", err)
+		}
+		r.sim.SetScriptsDir(next.ScenariosPath())
+		autostart := r.current.Simulation.Autostart
+		r.current.Simulation = next.Simulation
+		r.current.Simulation.Autostart = autostart
+	}
+}
+
+// applyWorkflows 为配置中新增或修改的工作流发布新版本，删除配置中不再出现的工作流
+// 运行中通过接口创建、且从未出现在配置文件中的工作流保持不变
+func (r *Reloader) applyWorkflows(wf *engine.WorkflowEngine, next map[string][]types.WorkflowStep) {
+	for _, name := range slices.Sorted(maps.Keys(next)) {
+		steps := next[name]
+		if prev, ok := r.current.Workflows[name]; ok && reflect.DeepEqual(prev, steps) {
+			continue
+		}
+		def, err := wf.UpdateWorkflow(name, steps)
+		if errors.Is(err, engine.ErrWorkflowNotFound) {
+			def, err = wf.CreateWorkflow(name, steps)
+		}
+		if err != nil {
+			r.logger.Error("更新工作流失败", "workflow", name, "error", err)
+			continue
+		}
+		r.logger.Info("工作流已更新", "workflow", def.Name, "version", def.Version)
+	}
+	for name := range r.current.Workflows {
+		if _, ok := next[name]; ok {
+			continue
+		}
+		if err := wf.Workflows().Delete(name); err != nil && !errors.Is(err, engine.ErrWorkflowNotFound) {
+			r.logger.Error("删除工作流失败", "workflow", name, "error", err)
+			continue
+		}
+		r.logger.Info("工作流已删除", "workflow", name)
+	}
+}
+
+// Run 在收到 SIGHUP、配置文件被修改或工作流目录中的文件被增删改时重新加载配置，直到 ctx 结束
+// 监听配置文件所在的目录，编辑器以替换文件的方式保存时同样可以收到通知
+func (r *Reloader) Run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var fileEvents <-chan fsnotify.Event
+	var watchErrors <-chan error
+	file, _ := filepath.Abs(r.current.File())
+	var workflowsDir string
+	if dir := r.current.WorkflowsPath(); dir != "" {
+		workflowsDir, _ = filepath.Abs(dir)
+	}
+	if watcher, err := fsnotify.NewWatcher(); err != nil {
+		r.logger.Warn("无法监听配置文件，只能通过 SIGHUP 重新加载", "error", err)
+	} else if err := watcher.Add(filepath.Dir(file)); err != nil {
+		watcher.Close()
+		r.logger.Warn("无法监听配置文件，只能通过 SIGHUP 重新加载", "error", err, "path", file)
+	} else {
+		defer watcher.Close()
+		fileEvents, watchErrors = watcher.Events, watcher.Errors
+		if workflowsDir != "" && workflowsDir != filepath.Dir(file) {
+			if err := watcher.Add(workflowsDir); err != nil {
+				r.logger.Warn("无法监听工作流目录，修改后需要通过 SIGHUP 重新加载", "error", err, "path", workflowsDir)
+			}
+		}
+	}
+
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.reloadAndLog("signal")
+		case ev := <-fileEvents:
+			name := filepath.Clean(ev.Name)
+			switch {
+			case name == file && (ev.Has(fsnotify.Write) || ev.Has(fsnotify.Create)):
+				timer.Reset(debounce)
+			case workflowsDir != "" && filepath.Dir(name) == workflowsDir && config.IsWorkflowFile(name):
+				// 工作流文件的新增、修改、删除和重命名都需要重新加载
+				timer.Reset(debounce)
+			}
+		case err := <-watchErrors:
+			r.logger.Warn("监听配置文件出错", "error", err)
+		case <-timer.C:
+			r.reloadAndLog("file")
+		}
+	}
+}
+
+// reloadAndLog 重新加载配置并记录结果，trigger 是触发重新加载的原因
+func (r *Reloader) reloadAndLog(trigger string) {
+	result, err := r.Reload()
+	if err != nil {
+		r.logger.Error("重新加载配置失败，继续使用当前配置", "trigger", trigger, "error", err)
+		return
+	}
+	r.logger.Info("配置已重新加载", "trigger", trigger, "applied", result.Applied)
+	if len(result.RestartRequired) > 0 {
+		r.logger.Warn("部分配置项需要重启才能生效", "keys", result.RestartRequired)
+	}
+}
+
+// diff 按 mapstructure 标签比较两份配置，返回不同的配置项；结构体逐层展开 (例如 server.addr)，map 和切片整体比较
+func diff(a, b reflect.Value, prefix string) []string {
+	var keys []string
+	for i := 0; i < a.NumField(); i++ {
+		field := a.Type().Field(i)
+		tag := field.Tag.Get("mapstructure")
+		if !field.IsExported() || tag == "" {
+			continue
+		}
+		key := prefix + tag
+		if field.Type.Kind() == reflect.Struct {
+			keys = append(keys, diff(a.Field(i), b.Field(i), key+".")...)
+			continue
+		}
+		if !equal(a.Field(i), b.Field(i)) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// equal 比较两个配置值，空的和 nil 的 map 或切片视为相同
+func equal(a, b reflect.Value) bool {
+	if (a.Kind() == reflect.Map || a.Kind() == reflect.Slice) && a.Len() == 0 && b.Len() == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a.Interface(), b.Interface())
+}
+
+// isSimulationKey 判断是否为模拟器参数
+func isSimulationKey(key string) bool {
+	return strings.HasPrefix(key, "simulation.")
+}
+
+// simulationSettings 返回配置中模拟器的默认参数
+func simulationSettings(cfg *config.Config) simulator.Settings {
+	return simulator.Settings{
+		Scenario: cfg.Simulation.Scenario,
+		Rate:     cfg.Simulation.Rate,
+		Mix:      cfg.Simulation.Mix,
+		Limit:    cfg.Simulation.Limit,
+	}
+}
+
+// isCalendarKey 判断是否为日历的配置项
+func isCalendarKey(key string) bool {
+	return strings.HasPrefix(key, "calendar.")
+}
+
+// isPlannerKey 判断是否为派工计划的配置项
+func isPlannerKey(key string) bool {
+	return strings.HasPrefix(key, "planner.")
+}
+
+// isPriorityPolicyKey 判断是否为优先级策略的配置项
+func isPriorityPolicyKey(key string) bool {
+	return strings.HasPrefix(key, "priority_policy.")
+}
+
+// PriorityPolicy 按配置创建优先级策略，未启用时返回 nil，调度器使用客户端提交的优先级
+func PriorityPolicy(cfg *config.Config) (*engine.PriorityPolicy, error) {
+	pc := cfg.PriorityPolicy
+	if !pc.Enabled {
+		return nil, nil
+	}
+	boosts := make([]engine.PriorityBoost, 0, len(pc.Boosts))
+	for _, b := range pc.Boosts {
+		boosts = append(boosts, engine.PriorityBoost{Rule: b.Rule, Boost: b.Boost})
+	}
+	return engine.NewPriorityPolicy(pc.Default, pc.Types, boosts)
+}
+
+// MaintenanceRules 按配置创建维护规则，工站 ID 还原为大写
+func MaintenanceRules(cfg *config.Config) []maintenance.Rule {
+	rules := make([]maintenance.Rule, 0, len(cfg.Maintenance.Rules))
+	for _, rc := range cfg.Maintenance.Rules {
+		rule := maintenance.Rule{
+			Name:        rc.Name,
+			Window:      time.Duration(rc.WindowSeconds) * time.Second,
+			Anomalies:   rc.Anomalies,
+			FailureRate: rc.FailureRate,
+			MinSteps:    rc.MinSteps,
+			Maintenance: rc.EnterMaintenance,
+		}
+		for _, id := range rc.Stations {
+			rule.Stations = append(rule.Stations, stationID(id))
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// Planning 按配置生成派工计划的排产参数，工站的加工时间取理想节拍，换型矩阵中的工站 ID 还原为大写
+func Planning(cfg *config.Config) planner.Options {
+	changeovers := make([]planner.Changeover, 0, len(cfg.Planner.Changeovers))
+	for _, c := range cfg.Planner.Changeovers {
+		stations := make([]types.StationID, 0, len(c.Stations))
+		for _, id := range c.Stations {
+			stations = append(stations, stationID(id))
+		}
+		c.Stations = stations
+		changeovers = append(changeovers, c)
+	}
+	return planner.Options{
+		Durations:       IdealCycles(cfg),
+		DefaultDuration: time.Duration(cfg.StationDelayMs) * time.Millisecond,
+		Move:            time.Duration(cfg.StepDelayMs) * time.Millisecond,
+		Changeovers:     changeovers,
+		MakespanWeight:  cfg.Planner.MakespanWeight,
+		TardinessWeight: cfg.Planner.TardinessWeight,
+		MaxIterations:   cfg.Planner.MaxIterations,
+	}
+}
+
+// IdealCycles 返回单独配置了理想节拍或处理延时的工站的节拍，oee.ideal_cycle_ms 优先
+func IdealCycles(cfg *config.Config) map[types.StationID]time.Duration {
+	cycles := make(map[types.StationID]time.Duration, len(cfg.OEE.IdealCycleMs)+len(cfg.Stations))
+	for id, sc := range cfg.Stations {
+		if sc.DelayMs > 0 {
+			cycles[stationID(id)] = time.Duration(sc.DelayMs) * time.Millisecond
+		}
+	}
+	for id, ms := range cfg.OEE.IdealCycleMs {
+		cycles[stationID(id)] = time.Duration(ms) * time.Millisecond
+	}
+	return cycles
+}
+
+// Operators 按配置创建操作员花名册，操作员和工站需要的技能不支持热更新
+func Operators(cfg *config.Config) []engine.Operator {
+	operators := make([]engine.Operator, 0, len(cfg.Operators.Roster))
+	for _, oc := range cfg.Operators.Roster {
+		operators = append(operators, engine.Operator{ID: oc.ID, Name: oc.Name, Skills: oc.Skills, Shift: oc.Shift})
+	}
+	return operators
+}
+
+// stationID 将 viper 读出的小写工站 ID 还原为大写
+func stationID(id types.StationID) types.StationID {
+	return types.StationID(strings.ToUpper(string(id)))
+}
@@ -0,0 +1,389 @@
+// Package replay 将一次生产 (任务的提交和取消、工站加工和补偿的结果与耗时) 录制到回放文件，并按文件确定性地重放
+// 回放时工站不真正加工，而是按工件和工站依次返回录制的结果和耗时，演示中观察到的问题可以在测试中精确复现
+package replay
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"industrial-4.0-demo/internal/event"
+	"industrial-4.0-demo/internal/types"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// 回放文件中的记录种类
+const (
+	KindSubmit     = "submit"     // 提交任务
+	KindCancel     = "cancel"     // 取消任务
+	KindStep       = "step"       // 工站的一次加工 (或因停用而拒绝加工)
+	KindCompensate = "compensate" // 工站的一次补偿
+)
+
+// Entry 是回放文件中的一行
+type Entry struct {
+	Kind         string              `json:"kind"`
+	AtMs         float64             `json:"at_ms"`             // 距离录制开始的毫秒数
+	Product      *types.Product      `json:"product,omitempty"` // 提交的任务 (submit)
+	ProductID    string              `json:"product_id,omitempty"`
+	StationID    types.StationID     `json:"station_id,omitempty"`
+	Step         int                 `json:"step,omitempty"`
+	Success      bool                `json:"success,omitempty"`
+	Error        string              `json:"error,omitempty"` // 加工或补偿失败的原因
+	Defect       *types.Defect       `json:"defect,omitempty"`
+	Measurements []types.Measurement `json:"measurements,omitempty"`
+	Provenance   *types.Provenance   `json:"provenance,omitempty"`
+	DurationMs   float64             `json:"duration_ms,omitempty"` // 加工耗时
+}
+
+// Recorder 将生产过程逐条追加写入回放文件，每条记录立即写入，进程异常退出时已发生的部分仍可回放
+// 提交和取消由调度器同步调用，加工和补偿的结果订阅事件总线获得
+type Recorder struct {
+	mu      sync.Mutex
+	file    *os.File
+	enc     *json.Encoder
+	start   time.Time
+	entries int
+	logger  *slog.Logger
+}
+
+// Create 创建 (或覆盖) 回放文件并开始录制
+func Create(path string, logger *slog.Logger) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("开始录制生产过程", "file", path)
+	return &Recorder{file: f, enc: json.NewEncoder(f), start: time.Now(), logger: logger}, nil
+}
+
+// Register 订阅加工和补偿事件
+func (r *Recorder) Register(bus *event.Bus) {
+	step := func(e event.Event) {
+		entry := Entry{Kind: KindStep, ProductID: e.ProductID, StationID: e.StationID, Step: e.Step, Success: e.Error == nil, Defect: e.Defect, Measurements: e.Measurements, Provenance: e.Provenance}
+		if e.Error != nil {
+			entry.Error = e.Error.Error()
+		}
+		if e.Product != nil {
+			if d, ok := e.Product.Attrs["duration"].(float64); ok {
+				entry.DurationMs = d * 1000
+			}
+		}
+		r.write(e.Timestamp, entry)
+	}
+	bus.Subscribe(event.StepCompleted, step)
+	bus.Subscribe(event.StepRejected, step)
+	bus.Subscribe(event.StepCompensated, func(e event.Event) {
+		r.write(e.Timestamp, Entry{Kind: KindCompensate, ProductID: e.ProductID, StationID: e.StationID, Success: true})
+	})
+	bus.Subscribe(event.CompensationFailed, func(e event.Event) {
+		entry := Entry{Kind: KindCompensate, ProductID: e.ProductID, StationID: e.StationID}
+		if e.Error != nil {
+			entry.Error = e.Error.Error()
+		}
+		r.write(e.Timestamp, entry)
+	})
+}
+
+// RecordSubmit 记录提交的任务，只保留提交时的字段
+func (r *Recorder) RecordSubmit(p types.Product) {
+	submitted := types.Product{ID: p.ID, Type: p.Type, Priority: p.Priority, Attrs: p.Attrs, RetryOf: p.RetryOf, Namespace: p.Namespace, Lot: p.Lot, DueAt: p.DueAt}
+	r.write(time.Now(), Entry{Kind: KindSubmit, ProductID: p.ID, Product: &submitted})
+}
+
+// RecordCancel 记录取消的任务
+func (r *Recorder) RecordCancel(id string) {
+	r.write(time.Now(), Entry{Kind: KindCancel, ProductID: id})
+}
+
+// write 追加一条记录，录制已结束时忽略
+func (r *Recorder) write(at time.Time, e Entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return
+	}
+	e.AtMs = float64(at.Sub(r.start).Microseconds()) / 1000
+	if err := r.enc.Encode(e); err != nil {
+		r.logger.Error("写入回放文件失败", "error", err)
+		return
+	}
+	r.entries++
+}
+
+// Close 结束录制并关闭回放文件
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.logger.Info("已结束录制", "file", r.file.Name(), "entries", r.entries)
+	r.file = nil
+	return err
+}
+
+// Load 读取回放文件，记录按时间排序；文件中有无法解析的行时返回错误
+func Load(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		switch e.Kind {
+		case KindSubmit:
+			if e.Product == nil || e.Product.ID == "" {
+				return nil, fmt.Errorf("%s:%d: submit without product", path, line)
+			}
+		case KindCancel, KindStep, KindCompensate:
+		default:
+			return nil, fmt.Errorf("%s:%d: unknown kind %q", path, line, e.Kind)
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(entries, func(a, b Entry) int { return cmp.Compare(a.AtMs, b.AtMs) })
+	return entries, nil
+}
+
+// Target 是回放提交和取消任务的调度器
+type Target interface {
+	SubmitTask(p *types.Product)
+	Cancel(id string) error
+}
+
+// Divergence 是回放与录制不一致的地方
+type Divergence struct {
+	ProductID string          `json:"product_id"`
+	StationID types.StationID `json:"station_id,omitempty"`
+	Reason    string          `json:"reason"`
+}
+
+// Status 是回放的进度
+type Status struct {
+	File        string       `json:"file"`
+	Speed       float64      `json:"speed"`
+	Running     bool         `json:"running"`     // 仍在按时间线提交或取消任务
+	Total       int          `json:"total"`       // 录制中提交的任务数
+	Submitted   int          `json:"submitted"`   // 已重新提交的任务数
+	Cancelled   int          `json:"cancelled"`   // 已重新取消的任务数
+	Steps       int          `json:"steps"`       // 已回放的加工结果数
+	Remaining   int          `json:"remaining"`   // 尚未被回放的加工结果数
+	Divergences []Divergence `json:"divergences"` // 录制中没有对应结果的加工，或取消失败的任务
+}
+
+// key 标识一个工件在一个工站上的加工或补偿
+type key struct {
+	product string
+	station types.StationID
+}
+
+// Replayer 按回放文件重新提交和取消任务，并通过 Station 返回录制的加工和补偿结果
+// 加工结果按工件和工站依次取出，与 worker 的调度顺序无关
+type Replayer struct {
+	mu            sync.Mutex
+	file          string
+	speed         float64
+	timeline      []Entry         // 提交和取消，按时间排序
+	steps         map[key][]Entry // 尚未回放的加工结果
+	compensations map[key][]Entry // 尚未回放的补偿结果
+	status        Status
+	logger        *slog.Logger
+}
+
+// New 按回放文件中的记录创建回放器，speed 为回放速度的倍数，<= 0 时按录制时的速度回放
+func New(file string, entries []Entry, speed float64, logger *slog.Logger) *Replayer {
+	if speed <= 0 {
+		speed = 1
+	}
+	r := &Replayer{
+		file:          file,
+		speed:         speed,
+		steps:         make(map[key][]Entry),
+		compensations: make(map[key][]Entry),
+		logger:        logger,
+	}
+	r.status = Status{File: file, Speed: speed, Divergences: []Divergence{}}
+	for _, e := range entries {
+		k := key{e.ProductID, e.StationID}
+		switch e.Kind {
+		case KindSubmit:
+			r.status.Total++
+			r.timeline = append(r.timeline, e)
+		case KindCancel:
+			r.timeline = append(r.timeline, e)
+		case KindStep:
+			r.steps[k] = append(r.steps[k], e)
+			r.status.Remaining++
+		case KindCompensate:
+			r.compensations[k] = append(r.compensations[k], e)
+		}
+	}
+	return r
+}
+
+// Run 按录制时的时间间隔 (除以回放速度) 重新提交和取消任务，时间线执行完毕或 ctx 结束时返回
+func (r *Replayer) Run(ctx context.Context, target Target) {
+	r.mu.Lock()
+	r.status.Running = true
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		r.status.Running = false
+		r.mu.Unlock()
+	}()
+	r.logger.Info("开始回放", "file", r.file, "speed", r.speed, "entries", len(r.timeline))
+	start := time.Now()
+	for _, e := range r.timeline {
+		if err := r.sleep(ctx, start.Add(r.scale(e.AtMs)).Sub(time.Now())); err != nil {
+			return
+		}
+		switch e.Kind {
+		case KindSubmit:
+			p := *e.Product
+			target.SubmitTask(&p)
+			r.mu.Lock()
+			r.status.Submitted++
+			r.mu.Unlock()
+		case KindCancel:
+			err := target.Cancel(e.ProductID)
+			r.mu.Lock()
+			if err != nil {
+				r.diverge(e.ProductID, "", "cancel: "+err.Error())
+			} else {
+				r.status.Cancelled++
+			}
+			r.mu.Unlock()
+		}
+	}
+	r.logger.Info("回放时间线执行完毕", "file", r.file)
+}
+
+// Status 返回回放的进度
+func (r *Replayer) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.status
+	s.Divergences = slices.Clone(s.Divergences)
+	return s
+}
+
+// Station 返回按录制结果加工的工站
+func (r *Replayer) Station(id types.StationID) *Station {
+	return &Station{id: id, replayer: r}
+}
+
+// next 取出工件在工站上的下一个录制结果
+func (r *Replayer) next(records map[key][]Entry, productID string, id types.StationID) (Entry, bool) {
+	k := key{productID, id}
+	queue := records[k]
+	if len(queue) == 0 {
+		return Entry{}, false
+	}
+	if len(queue) == 1 {
+		delete(records, k)
+	} else {
+		records[k] = queue[1:]
+	}
+	return queue[0], true
+}
+
+// diverge 记录一处不一致，调用方必须持有 r.mu
+func (r *Replayer) diverge(productID string, id types.StationID, reason string) {
+	r.logger.Warn("回放与录制不一致", "product_id", productID, "station_id", id, "reason", reason)
+	r.status.Divergences = append(r.status.Divergences, Divergence{ProductID: productID, StationID: id, Reason: reason})
+}
+
+// scale 将录制的毫秒数按回放速度换算为时长
+func (r *Replayer) scale(ms float64) time.Duration {
+	return time.Duration(ms / r.speed * float64(time.Millisecond))
+}
+
+// sleep 等待 d，ctx 结束时返回错误
+func (r *Replayer) sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Station 是回放时使用的工站，按工件依次返回录制的加工和补偿结果，并等待录制的加工耗时
+type Station struct {
+	id       types.StationID
+	replayer *Replayer
+}
+
+func (s *Station) GetID() types.StationID {
+	return s.id
+}
+
+// Execute 返回工件在本工站的下一个录制结果；录制中没有对应的结果时记录不一致并使加工失败
+func (s *Station) Execute(ctx context.Context, p *types.Product) types.Result {
+	r := s.replayer
+	r.mu.Lock()
+	e, ok := r.next(r.steps, p.ID, s.id)
+	if ok {
+		r.status.Steps++
+		r.status.Remaining--
+	} else {
+		r.diverge(p.ID, s.id, "no recorded outcome")
+	}
+	r.mu.Unlock()
+	if !ok {
+		return types.Result{ProductID: p.ID, Success: false, Error: fmt.Errorf("replay: no recorded outcome for %s at %s", p.ID, s.id)}
+	}
+
+	r.sleep(ctx, r.scale(e.DurationMs))
+	res := types.Result{ProductID: p.ID, Success: e.Success, Defect: e.Defect, Measurements: e.Measurements}
+	if e.Provenance != nil {
+		res.Provenance = *e.Provenance
+	}
+	if !e.Success {
+		res.Error = errors.New(e.Error)
+		return res
+	}
+	// 并行步骤中的回放工站共享同一个工件，追加加工历史时持有 r.mu
+	r.mu.Lock()
+	p.History = append(p.History, string(s.id))
+	r.mu.Unlock()
+	return res
+}
+
+// Compensate 返回工件在本工站的下一个录制的补偿结果，录制中没有对应的补偿时视为成功
+func (s *Station) Compensate(ctx context.Context, p *types.Product) error {
+	r := s.replayer
+	r.mu.Lock()
+	e, ok := r.next(r.compensations, p.ID, s.id)
+	r.mu.Unlock()
+	if ok && e.Error != "" {
+		return errors.New(e.Error)
+	}
+	return nil
+}
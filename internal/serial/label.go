@@ -0,0 +1,52 @@
+package serial
+
+import (
+	"fmt"
+	"strings"
+)
+
+// gs 是 GS1 元素串中可变长度字段之后的分隔符 (ASCII 29)
+const gs = "\x1d"
+
+// Label 是工件标签上的标识内容
+type Label struct {
+	ProductID string  `json:"product_id"`
+	Serial    string  `json:"serial"`
+	Type      string  `json:"type"`
+	Lot       string  `json:"lot,omitempty"`
+	Barcode   Barcode `json:"barcode"`
+	QR        QR      `json:"qr"`
+}
+
+// Barcode 是一维条码的内容
+type Barcode struct {
+	Symbology string `json:"symbology"` // code128
+	Data      string `json:"data"`
+}
+
+// QR 是二维码的内容，使用 GS1 应用标识符：(21) 序列号、(240) 产品类型、(10) 批次
+type QR struct {
+	Data string `json:"data"` // GS1 元素串，可变长度字段之间以 GS (ASCII 29) 分隔，编码时使用 FNC1 模式
+	Text string `json:"text"` // 人工可读的形式，例如 (21)L1-251017-00001(240)PCB_PROTOTYPE
+}
+
+// NewLabel 生成工件标签的条码和二维码内容
+func NewLabel(productID, serial, productType, lot string) Label {
+	fields := [][2]string{{"21", serial}, {"240", productType}}
+	if lot != "" {
+		fields = append(fields, [2]string{"10", lot})
+	}
+	var data, text []string
+	for _, f := range fields {
+		data = append(data, f[0]+f[1])
+		text = append(text, fmt.Sprintf("(%s)%s", f[0], f[1]))
+	}
+	return Label{
+		ProductID: productID,
+		Serial:    serial,
+		Type:      productType,
+		Lot:       lot,
+		Barcode:   Barcode{Symbology: "code128", Data: serial},
+		QR:        QR{Data: strings.Join(data, gs), Text: strings.Join(text, "")},
+	}
+}
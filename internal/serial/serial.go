@@ -0,0 +1,167 @@
+// Package serial 在工件开始生产时按配置的格式分配序列号，并生成标签上的条码 (Code 128) 和二维码 (GS1) 内容
+// 格式由字面文本和 {date:布局} / {line} / {seq:位数} 段组成，序列号在其他段相同的范围内递增，日期变化后从 1 重新开始
+// 序号只保存在内存中，重启后从 1 开始
+package serial
+
+import (
+	"fmt"
+	"industrial-4.0-demo/internal/types"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDateLayout 是 {date} 段未指定布局时使用的布局
+const DefaultDateLayout = "20060102"
+
+// DefaultSeqWidth 是 {seq} 段未指定位数时的位数
+const DefaultSeqWidth = 6
+
+// Spec 是配置文件中的序列号规则
+type Spec struct {
+	Format string            `mapstructure:"format"` // 例如 "{line}-{date:060102}-{seq:5}"，为空时不分配序列号
+	Lines  map[string]string `mapstructure:"lines"`  // 命名空间到产线代码的映射，未配置的命名空间使用大写的命名空间名称
+}
+
+// segment 是格式中的一段
+type segment struct {
+	kind  string // literal / date / line / seq
+	value string // 字面文本或日期布局
+	width int    // 序号的位数
+}
+
+// Generator 按格式分配序列号，nil 的 *Generator 表示不分配序列号
+type Generator struct {
+	segments []segment
+	lines    map[string]string
+	mu       sync.Mutex
+	seq      map[string]int // 序号，Key 为除序号外的各段拼接结果
+}
+
+// New 解析序列号规则，格式为空时返回 nil
+func New(spec Spec) (*Generator, error) {
+	if spec.Format == "" {
+		return nil, nil
+	}
+	segments, err := parse(spec.Format)
+	if err != nil {
+		return nil, err
+	}
+	g := &Generator{segments: segments, lines: make(map[string]string, len(spec.Lines)), seq: make(map[string]int)}
+	for ns, code := range spec.Lines {
+		if !printable(code) {
+			return nil, fmt.Errorf("lines.%s: 产线代码 %q 只能包含可打印的 ASCII 字符", ns, code)
+		}
+		g.lines[strings.ToLower(ns)] = code
+	}
+	return g, nil
+}
+
+// parse 解析格式，格式中必须有且只有一个 {seq} 段
+func parse(format string) ([]segment, error) {
+	var segments []segment
+	seqs := 0
+	rest := format
+	for rest != "" {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			open = len(rest)
+		}
+		if open > 0 {
+			if !printable(rest[:open]) || strings.Contains(rest[:open], "}") {
+				return nil, fmt.Errorf("format: 字面文本 %q 只能包含可打印的 ASCII 字符且不能包含 }", rest[:open])
+			}
+			segments = append(segments, segment{kind: "literal", value: rest[:open]})
+			rest = rest[open:]
+			continue
+		}
+		end := strings.IndexByte(rest, '}')
+		if end < 0 {
+			return nil, fmt.Errorf("format: %q 缺少 }", rest)
+		}
+		name, arg, _ := strings.Cut(rest[1:end], ":")
+		rest = rest[end+1:]
+		switch name {
+		case "date":
+			if arg == "" {
+				arg = DefaultDateLayout
+			}
+			segments = append(segments, segment{kind: "date", value: arg})
+		case "line":
+			segments = append(segments, segment{kind: "line"})
+		case "seq":
+			width := DefaultSeqWidth
+			if arg != "" {
+				n, err := strconv.Atoi(arg)
+				if err != nil || n < 1 || n > 12 {
+					return nil, fmt.Errorf("format: {seq:%s} 的位数必须在 1 ~ 12 之间", arg)
+				}
+				width = n
+			}
+			seqs++
+			segments = append(segments, segment{kind: "seq", width: width})
+		default:
+			return nil, fmt.Errorf("format: 未知的段 {%s}，可选 {date:布局} / {line} / {seq:位数}", name)
+		}
+	}
+	if seqs != 1 {
+		return nil, fmt.Errorf("format: 必须有且只有一个 {seq} 段")
+	}
+	return segments, nil
+}
+
+// printable 判断文本是否只包含可打印的 ASCII 字符，保证序列号可以编码为 Code 128
+func printable(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] > 0x7E {
+			return false
+		}
+	}
+	return true
+}
+
+// Next 为工件分配下一个序列号，日期使用 at 所在的本地时区
+func (g *Generator) Next(p *types.Product, at time.Time) string {
+	if g == nil {
+		return ""
+	}
+	// 先渲染除序号外的各段，作为序号的范围
+	parts := make([]string, len(g.segments))
+	var key strings.Builder
+	for i, seg := range g.segments {
+		switch seg.kind {
+		case "literal":
+			parts[i] = seg.value
+		case "date":
+			parts[i] = at.Format(seg.value)
+		case "line":
+			parts[i] = g.line(p.Namespace)
+		}
+		key.WriteString(parts[i])
+		key.WriteByte(0)
+	}
+
+	g.mu.Lock()
+	g.seq[key.String()]++
+	n := g.seq[key.String()]
+	g.mu.Unlock()
+
+	for i, seg := range g.segments {
+		if seg.kind == "seq" {
+			parts[i] = fmt.Sprintf("%0*d", seg.width, n)
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// line 返回命名空间的产线代码
+func (g *Generator) line(namespace string) string {
+	if namespace == "" {
+		namespace = types.DefaultNamespace
+	}
+	if code, ok := g.lines[namespace]; ok {
+		return code
+	}
+	return strings.ToUpper(namespace)
+}
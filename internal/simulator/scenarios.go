@@ -0,0 +1,98 @@
+package simulator
+
+import (
+	"industrial-4.0-demo/internal/types"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// 内置的演示场景
+const (
+	ScenarioDemo       = "demo"       // 依次提交 6 个固定的演示订单
+	ScenarioSteady     = "steady"     // 按常规配比持续下单
+	ScenarioBottleneck = "bottleneck" // 以多层板为主的高速下单，持续占满飞针电测的资源池
+	ScenarioRush       = "rush"       // 打样加急单密集到达，演示优先级调度
+)
+
+// 产品类型
+const (
+	productDouble    = "PCB_DOUBLE_LAYER"
+	productMulti     = "PCB_MULTILAYER"
+	productPrototype = "PCB_PROTOTYPE"
+)
+
+// Order 是固定订单场景中的一个订单
+type Order struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Priority int    `json:"priority"`
+	Layers   int    `json:"layers"`
+}
+
+// Scenario 是一组预设的模拟参数
+type Scenario struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Rate        float64        `json:"rate"`             // 默认的每分钟提交数
+	Mix         map[string]int `json:"mix,omitempty"`    // 默认的产品配比
+	Orders      []Order        `json:"orders,omitempty"` // 固定订单，设置后按顺序提交，忽略产品配比
+}
+
+// scenarios 是所有内置场景，按名称索引
+var scenarios = map[string]Scenario{
+	ScenarioDemo: {
+		Name:        ScenarioDemo,
+		Description: "依次提交 6 个固定的演示订单，提交完毕后自动停止",
+		Rate:        6,
+		Orders: []Order{
+			{ID: "PCB_Double_001", Type: productDouble, Priority: 0, Layers: 2},
+			{ID: "PCB_Multi_4L_001", Type: productMulti, Priority: 1, Layers: 4},
+			{ID: "PCB_Proto_Fast", Type: productPrototype, Priority: 2, Layers: 2},
+			{ID: "PCB_Double_002", Type: productDouble, Priority: 0, Layers: 2},
+			{ID: "PCB_Multi_8L_001", Type: productMulti, Priority: 1, Layers: 8},
+			{ID: "PCB_Double_003", Type: productDouble, Priority: 0, Layers: 2},
+		},
+	},
+	ScenarioSteady: {
+		Name:        ScenarioSteady,
+		Description: "按常规配比持续下单",
+		Rate:        6,
+		Mix:         map[string]int{productDouble: 3, productMulti: 2, productPrototype: 1},
+	},
+	ScenarioBottleneck: {
+		Name:        ScenarioBottleneck,
+		Description: "以多层板为主的高速下单，持续占满飞针电测的资源池",
+		Rate:        20,
+		Mix:         map[string]int{productMulti: 4, productDouble: 1},
+	},
+	ScenarioRush: {
+		Name:        ScenarioRush,
+		Description: "打样加急单密集到达，演示优先级调度",
+		Rate:        12,
+		Mix:         map[string]int{productPrototype: 3, productDouble: 2, productMulti: 1},
+	},
+}
+
+// List 返回所有内置场景，按名称排序
+func List() []Scenario {
+	list := make([]Scenario, 0, len(scenarios))
+	for _, s := range scenarios {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// newProduct 生成一个随机订单：多层板随机 4/6/8 层，打样板为加急单，多层板优先级略高于双层板
+func newProduct(productType, id string, r *rand.Rand) *types.Product {
+	p := &types.Product{ID: id, Type: productType, Attrs: map[string]interface{}{"layers": 2}}
+	switch strings.ToUpper(productType) {
+	case productMulti:
+		p.Priority = 1
+		p.Attrs["layers"] = []int{4, 6, 8}[r.Intn(3)]
+	case productPrototype:
+		p.Priority = 2
+	}
+	return p
+}
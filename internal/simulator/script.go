@@ -0,0 +1,498 @@
+package simulator
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"industrial-4.0-demo/internal/event"
+	"industrial-4.0-demo/internal/types"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 场景脚本运行的状态
+const (
+	RunRunning = "running" // 正在执行时间线或等待工件结束
+	RunPassed  = "passed"  // 所有预期都已满足
+	RunFailed  = "failed"  // 有预期未满足，或超时仍有工件未结束
+	RunStopped = "stopped" // 被手动停止
+)
+
+// 工件的结果
+const (
+	OutcomeCompleted = "completed"
+	OutcomeFailed    = "failed"
+	OutcomeCancelled = "cancelled"
+	OutcomePending   = "pending" // 运行结束时仍未结束
+)
+
+// defaultScriptTimeout 是场景脚本未配置 expect.timeout 时等待工件结束的时长
+const defaultScriptTimeout = 5 * time.Minute
+
+// 运行场景脚本时可能返回的错误
+var (
+	ErrScriptNotFound = errors.New("scenario script not found") // 场景目录中没有该场景
+	ErrInvalidScript  = errors.New("invalid scenario script")   // 场景文件格式错误或引用了不存在的工站、产品类型
+)
+
+// Script 是一个场景文件：按时间线提交订单、注入失败和安排维护，并在所有工件结束后检查预期结果
+type Script struct {
+	Name        string      `yaml:"name" json:"name"` // 为空时使用文件名
+	Description string      `yaml:"description" json:"description"`
+	Timeline    []Action    `yaml:"timeline" json:"timeline"`
+	Expect      Expectation `yaml:"expect" json:"expect"`
+}
+
+// Action 是时间线上的一个动作，At 是相对运行开始的时间，Submit、Fail 和 Maintenance 只能设置一个
+// 同一时间的动作按文件中的顺序执行
+type Action struct {
+	At          time.Duration `yaml:"at" json:"at"`
+	Submit      *ScriptOrder  `yaml:"submit,omitempty" json:"submit,omitempty"`
+	Fail        *Injection    `yaml:"fail,omitempty" json:"fail,omitempty"`
+	Maintenance *Maintenance  `yaml:"maintenance,omitempty" json:"maintenance,omitempty"`
+}
+
+// ScriptOrder 是提交的订单，Count 大于 1 时提交多个订单，ID 依次加上 _1、_2 等后缀
+type ScriptOrder struct {
+	ID       string                 `yaml:"id" json:"id"`
+	Type     string                 `yaml:"type" json:"type"`
+	Priority int                    `yaml:"priority" json:"priority"`
+	Attrs    map[string]interface{} `yaml:"attrs,omitempty" json:"attrs,omitempty"`
+	Count    int                    `yaml:"count,omitempty" json:"count,omitempty"`
+}
+
+// Injection 让工站接下来的 Count 次加工失败，Count 为 0 时注入一次
+type Injection struct {
+	Station types.StationID `yaml:"station" json:"station"`
+	Count   int             `yaml:"count,omitempty" json:"count,omitempty"`
+}
+
+// Maintenance 停用工站 Duration 时长，到达的工件直接失败并触发补偿，结束后重新启用
+type Maintenance struct {
+	Station  types.StationID `yaml:"station" json:"station"`
+	Duration time.Duration   `yaml:"duration" json:"duration"`
+}
+
+// Expectation 是运行的预期结果，未设置的计数不检查；Products 按场景中的订单 ID 指定结果
+type Expectation struct {
+	Timeout   time.Duration     `yaml:"timeout,omitempty" json:"timeout,omitempty"` // 等待所有工件结束的最长时间，从时间线执行完毕开始计算
+	Completed *int              `yaml:"completed,omitempty" json:"completed,omitempty"`
+	Failed    *int              `yaml:"failed,omitempty" json:"failed,omitempty"`
+	Cancelled *int              `yaml:"cancelled,omitempty" json:"cancelled,omitempty"`
+	Products  map[string]string `yaml:"products,omitempty" json:"products,omitempty"` // completed / failed / cancelled
+}
+
+// Run 是一次场景脚本运行的报告
+type Run struct {
+	ID         int               `json:"id"`
+	Scenario   string            `json:"scenario"`
+	Status     string            `json:"status"` // running / passed / failed / stopped
+	StartedAt  time.Time         `json:"started_at"`
+	FinishedAt time.Time         `json:"finished_at,omitzero"`
+	Outcomes   map[string]string `json:"outcomes"`           // 场景中的订单 ID 到结果的映射
+	Counts     map[string]int    `json:"counts"`             // 按结果统计的工件数
+	Failures   []string          `json:"failures,omitempty"` // 未满足的预期
+}
+
+// scriptRun 是正在进行的场景脚本运行
+type scriptRun struct {
+	report  Run
+	expect  Expectation
+	ids     map[string]string // 实际提交的工件 ID 到场景中订单 ID 的映射
+	changed chan struct{}     // 有工件结束时通知等待循环，容量为 1
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// scripts 保存场景目录和运行记录，与随机下单的运行相互独立
+type scripts struct {
+	mu   sync.Mutex
+	dir  string
+	runs int
+	last *scriptRun
+}
+
+// isScriptFile 判断文件是否为场景文件 (.yaml / .yml)
+func isScriptFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// SetScriptsDir 设置场景文件目录，每个 YAML 文件描述一个场景，运行时按名称读取
+func (s *Simulator) SetScriptsDir(dir string) {
+	s.scripts.mu.Lock()
+	defer s.scripts.mu.Unlock()
+	s.scripts.dir = dir
+}
+
+// Register 订阅工件结束事件，用于统计场景脚本运行的结果
+func (s *Simulator) Register(bus *event.Bus) {
+	bus.Subscribe(event.ProductCompleted, func(e event.Event) { s.recordOutcome(e.ProductID, OutcomeCompleted) })
+	bus.Subscribe(event.ProductFailed, func(e event.Event) { s.recordOutcome(e.ProductID, OutcomeFailed) })
+	bus.Subscribe(event.ProductCancelled, func(e event.Event) { s.recordOutcome(e.ProductID, OutcomeCancelled) })
+}
+
+// Scripts 读取场景目录中的所有场景，按名称排序，未设置目录或目录不存在时返回空列表
+func (s *Simulator) Scripts() ([]Script, error) {
+	s.scripts.mu.Lock()
+	dir := s.scripts.dir
+	s.scripts.mu.Unlock()
+	if dir == "" {
+		return []Script{}, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []Script{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	list := []Script{}
+	for _, entry := range entries {
+		if entry.IsDir() || !isScriptFile(entry.Name()) {
+			continue
+		}
+		script, err := readScript(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, script)
+	}
+	slices.SortFunc(list, func(a, b Script) int { return strings.Compare(a.Name, b.Name) })
+	return list, nil
+}
+
+// LoadScript 按名称读取场景，名称为文件名 (不含扩展名) 或文件中的 name
+func (s *Simulator) LoadScript(name string) (Script, error) {
+	list, err := s.Scripts()
+	if err != nil {
+		return Script{}, err
+	}
+	for _, script := range list {
+		if strings.EqualFold(script.Name, name) {
+			return script, nil
+		}
+	}
+	return Script{}, fmt.Errorf("%w: %q", ErrScriptNotFound, name)
+}
+
+// readScript 读取并解析一个场景文件，未指定名称时使用文件名
+func readScript(path string) (Script, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Script{}, err
+	}
+	var script Script
+	if err := yaml.Unmarshal(data, &script); err != nil {
+		return Script{}, fmt.Errorf("%w: %s: %v", ErrInvalidScript, filepath.Base(path), err)
+	}
+	if script.Name == "" {
+		script.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return script, nil
+}
+
+// check 检查场景中的动作、工站、产品类型和预期结果
+func (s *Simulator) check(script Script) error {
+	stations := s.scheduler.Engine().Stations()
+	for i, a := range script.Timeline {
+		set := 0
+		for _, ok := range []bool{a.Submit != nil, a.Fail != nil, a.Maintenance != nil} {
+			if ok {
+				set++
+			}
+		}
+		if set != 1 || a.At < 0 {
+			return fmt.Errorf("%w: timeline[%d] must set exactly one of submit, fail, maintenance with a non-negative at", ErrInvalidScript, i)
+		}
+		var station types.StationID
+		switch {
+		case a.Submit != nil:
+			if err := s.scheduler.Engine().Workflows().CheckProductType(a.Submit.Type); err != nil {
+				return fmt.Errorf("%w: timeline[%d]: %v", ErrInvalidScript, i, err)
+			}
+		case a.Fail != nil:
+			station = a.Fail.Station
+		case a.Maintenance != nil:
+			station = a.Maintenance.Station
+			if a.Maintenance.Duration <= 0 {
+				return fmt.Errorf("%w: timeline[%d]: maintenance duration must be positive", ErrInvalidScript, i)
+			}
+		}
+		if _, ok := stations.Get(types.StationID(strings.ToUpper(string(station)))); station != "" && !ok {
+			return fmt.Errorf("%w: timeline[%d]: unknown station %s", ErrInvalidScript, i, station)
+		}
+	}
+	for id, outcome := range script.Expect.Products {
+		if !slices.Contains([]string{OutcomeCompleted, OutcomeFailed, OutcomeCancelled}, outcome) {
+			return fmt.Errorf("%w: expect.products.%s: unknown outcome %q", ErrInvalidScript, id, outcome)
+		}
+	}
+	return nil
+}
+
+// RunScript 按名称运行场景，返回运行开始时的报告；上一次运行尚未结束时返回 ErrRunning
+func (s *Simulator) RunScript(name string) (Run, error) {
+	script, err := s.LoadScript(name)
+	if err != nil {
+		return Run{}, err
+	}
+	if err := s.check(script); err != nil {
+		return Run{}, err
+	}
+
+	s.scripts.mu.Lock()
+	defer s.scripts.mu.Unlock()
+	if last := s.scripts.last; last != nil && last.report.Status == RunRunning {
+		return last.report, ErrRunning
+	}
+	// 运行的生命周期独立于发起运行的请求
+	ctx, cancel := context.WithCancel(context.Background())
+	s.scripts.runs++
+	run := &scriptRun{
+		report: Run{
+			ID:        s.scripts.runs,
+			Scenario:  script.Name,
+			Status:    RunRunning,
+			StartedAt: time.Now(),
+			Outcomes:  make(map[string]string),
+			Counts:    make(map[string]int),
+		},
+		expect:  script.Expect,
+		ids:     make(map[string]string),
+		changed: make(chan struct{}, 1),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	s.scripts.last = run
+	go s.runScript(ctx, script, run)
+	s.logger.Info("开始运行场景", "scenario", script.Name, "run", run.report.ID)
+	return copyRun(run.report), nil
+}
+
+// LastRun 返回最近一次场景脚本运行的报告，从未运行时返回 false
+func (s *Simulator) LastRun() (Run, bool) {
+	s.scripts.mu.Lock()
+	defer s.scripts.mu.Unlock()
+	if s.scripts.last == nil {
+		return Run{}, false
+	}
+	return copyRun(s.scripts.last.report), true
+}
+
+// WaitRun 等待最近一次运行结束并返回报告，ctx 结束时返回当时的报告
+func (s *Simulator) WaitRun(ctx context.Context) (Run, bool) {
+	s.scripts.mu.Lock()
+	last := s.scripts.last
+	s.scripts.mu.Unlock()
+	if last == nil {
+		return Run{}, false
+	}
+	select {
+	case <-last.done:
+	case <-ctx.Done():
+	}
+	return s.LastRun()
+}
+
+// StopScript 停止正在进行的运行并等待其结束，已提交的工件不受影响
+func (s *Simulator) StopScript() (Run, bool) {
+	s.scripts.mu.Lock()
+	last := s.scripts.last
+	s.scripts.mu.Unlock()
+	if last == nil {
+		return Run{}, false
+	}
+	last.cancel()
+	<-last.done
+	return s.LastRun()
+}
+
+// copyRun 复制报告，避免调用方与运行中的更新共享 map
+func copyRun(r Run) Run {
+	r.Outcomes = maps.Clone(r.Outcomes)
+	r.Counts = maps.Clone(r.Counts)
+	r.Failures = slices.Clone(r.Failures)
+	return r
+}
+
+// recordOutcome 记录属于当前运行的工件的结果，同一工件只记录第一次结果
+func (s *Simulator) recordOutcome(productID, outcome string) {
+	s.scripts.mu.Lock()
+	defer s.scripts.mu.Unlock()
+	run := s.scripts.last
+	if run == nil || run.report.Status != RunRunning {
+		return
+	}
+	id, ok := run.ids[productID]
+	if !ok || run.report.Outcomes[id] != OutcomePending {
+		return
+	}
+	run.report.Outcomes[id] = outcome
+	select {
+	case run.changed <- struct{}{}:
+	default:
+	}
+}
+
+// runScript 按时间线执行动作，然后等待所有工件结束并检查预期结果
+func (s *Simulator) runScript(ctx context.Context, script Script, run *scriptRun) {
+	defer close(run.done)
+	stations := s.scheduler.Engine().Stations()
+	var maintenance sync.WaitGroup
+	defer maintenance.Wait()
+
+	timeline := slices.Clone(script.Timeline)
+	slices.SortStableFunc(timeline, func(a, b Action) int { return cmp.Compare(a.At, b.At) })
+	start := run.report.StartedAt
+	for _, a := range timeline {
+		if !s.sleepUntil(ctx, start.Add(a.At)) {
+			s.finishScript(run, RunStopped, nil)
+			return
+		}
+		switch {
+		case a.Submit != nil:
+			s.submitScriptOrder(*a.Submit, run)
+		case a.Fail != nil:
+			id := types.StationID(strings.ToUpper(string(a.Fail.Station)))
+			stations.InjectFailures(id, max(a.Fail.Count, 1))
+			s.logger.Info("场景注入加工失败", "station_id", id, "count", max(a.Fail.Count, 1))
+		case a.Maintenance != nil:
+			id := types.StationID(strings.ToUpper(string(a.Maintenance.Station)))
+			stations.Disable(id)
+			s.logger.Info("场景开始维护工站", "station_id", id, "duration", a.Maintenance.Duration)
+			maintenance.Add(1)
+			go func(d time.Duration) {
+				defer maintenance.Done()
+				// 运行被停止时立即结束维护，恢复工站
+				timer := time.NewTimer(d)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+				}
+				stations.Enable(id)
+				s.logger.Info("场景结束维护工站", "station_id", id)
+			}(a.Maintenance.Duration)
+		}
+	}
+
+	timeout := script.Expect.Timeout
+	if timeout <= 0 {
+		timeout = defaultScriptTimeout
+	}
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for !s.allFinished(run) {
+		select {
+		case <-ctx.Done():
+			s.finishScript(run, RunStopped, nil)
+			return
+		case <-deadline.C:
+			s.finishScript(run, RunFailed, []string{fmt.Sprintf("timeout after %s waiting for products to finish", timeout)})
+			return
+		case <-run.changed:
+		}
+	}
+	s.finishScript(run, RunPassed, nil)
+}
+
+// sleepUntil 等待到 at 时刻，ctx 结束时返回 false
+func (s *Simulator) sleepUntil(ctx context.Context, at time.Time) bool {
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// submitScriptOrder 提交场景中的订单，重复运行同一场景时为工件 ID 加上运行编号，避免与之前的工件冲突
+func (s *Simulator) submitScriptOrder(order ScriptOrder, run *scriptRun) {
+	count := max(order.Count, 1)
+	for i := 1; i <= count; i++ {
+		s.scripts.mu.Lock()
+		id := order.ID
+		if id == "" {
+			id = fmt.Sprintf("SCN_%s_%d", strings.ToUpper(run.report.Scenario), len(run.ids)+1)
+		}
+		if count > 1 {
+			id = fmt.Sprintf("%s_%d", id, i)
+		}
+		productID := id
+		if run.report.ID > 1 {
+			productID = fmt.Sprintf("%s_R%d", id, run.report.ID)
+		}
+		run.ids[productID] = id
+		run.report.Outcomes[id] = OutcomePending
+		s.scripts.mu.Unlock()
+
+		p := &types.Product{ID: productID, Type: order.Type, Priority: order.Priority, Attrs: maps.Clone(order.Attrs)}
+		if p.Attrs == nil {
+			p.Attrs = make(map[string]interface{})
+		}
+		s.scheduler.SubmitTask(p)
+	}
+}
+
+// allFinished 判断运行中提交的工件是否都已结束
+func (s *Simulator) allFinished(run *scriptRun) bool {
+	s.scripts.mu.Lock()
+	defer s.scripts.mu.Unlock()
+	for _, outcome := range run.report.Outcomes {
+		if outcome == OutcomePending {
+			return false
+		}
+	}
+	return true
+}
+
+// finishScript 统计结果并结束运行，运行正常结束时检查预期结果
+func (s *Simulator) finishScript(run *scriptRun, status string, failures []string) {
+	s.scripts.mu.Lock()
+	defer s.scripts.mu.Unlock()
+	r := &run.report
+	for _, outcome := range r.Outcomes {
+		r.Counts[outcome]++
+	}
+	r.Failures = failures
+	if status == RunPassed {
+		r.Failures = unmet(run.expect, *r)
+		if len(r.Failures) > 0 {
+			status = RunFailed
+		}
+	}
+	r.Status = status
+	r.FinishedAt = time.Now()
+	s.logger.Info("场景运行结束", "scenario", r.Scenario, "run", r.ID, "status", status, "counts", r.Counts, "failures", r.Failures)
+}
+
+// unmet 返回运行结果中未满足的预期
+func unmet(expect Expectation, r Run) []string {
+	var failures []string
+	check := func(name string, want *int) {
+		if want != nil && r.Counts[name] != *want {
+			failures = append(failures, fmt.Sprintf("expected %d %s products, got %d", *want, name, r.Counts[name]))
+		}
+	}
+	check(OutcomeCompleted, expect.Completed)
+	check(OutcomeFailed, expect.Failed)
+	check(OutcomeCancelled, expect.Cancelled)
+	for _, id := range slices.Sorted(maps.Keys(expect.Products)) {
+		if got := r.Outcomes[id]; got != expect.Products[id] {
+			failures = append(failures, fmt.Sprintf("expected %s to be %s, got %q", id, expect.Products[id], got))
+		}
+	}
+	return failures
+}
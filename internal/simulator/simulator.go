@@ -0,0 +1,349 @@
+// Package simulator 按场景自动提交模拟订单，用于驱动演示
+package simulator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"industrial-4.0-demo/internal/engine"
+	"industrial-4.0-demo/internal/types"
+	"log/slog"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 模拟器运行状态
+const (
+	StatusStopped = "stopped"
+	StatusRunning = "running"
+)
+
+// 操作模拟器时可能返回的错误
+var (
+	ErrRunning         = errors.New("simulator already running") // 模拟器已在运行
+	ErrNotRunning      = errors.New("simulator not running")     // 模拟器未在运行
+	ErrUnknownScenario = errors.New("unknown scenario")          // 场景不存在
+	ErrInvalidSettings = errors.New("invalid settings")          // 提交速率或产品配比无效
+)
+
+// Settings 是模拟器的运行参数，零值字段使用场景的默认值
+type Settings struct {
+	Scenario string         `json:"scenario"`
+	Rate     float64        `json:"rate"`            // 每分钟提交的订单数
+	Mix      map[string]int `json:"mix,omitempty"`   // 产品类型到权重的映射，按权重随机选择产品类型
+	Limit    int            `json:"limit,omitempty"` // 本次运行最多提交的订单数，0 表示不限制
+}
+
+// Status 是模拟器的当前状态
+type Status struct {
+	Settings
+	Status    string     `json:"status"`              // running / stopped
+	Submitted int        `json:"submitted"`           // 本次运行已提交的订单数
+	StartedAt time.Time  `json:"started_at,omitzero"` // 本次运行开始的时间
+	Scenarios []Scenario `json:"scenarios"`           // 可选的场景
+}
+
+// Simulator 按照所选场景、提交速率和产品配比向调度器提交订单，可以在运行中调整速率和配比
+type Simulator struct {
+	scheduler *engine.Scheduler
+	defaults  Settings // 启动时未指定场景所使用的参数
+	logger    *slog.Logger
+
+	mu        sync.Mutex
+	settings  Settings
+	running   bool
+	submitted int
+	startedAt time.Time
+	runs      int                // 运行次数，用于区分多次运行固定订单场景时的订单 ID
+	cancel    context.CancelFunc // 停止本次运行
+	done      chan struct{}      // 本次运行结束时关闭
+	changed   chan struct{}      // 运行中调整了参数，提交循环按新速率重新计时
+	rand      *rand.Rand
+
+	scripts scripts // 场景文件的目录和运行记录
+}
+
+// New 创建一个模拟器，defaults 是启动时未指定场景所使用的参数
+func New(scheduler *engine.Scheduler, defaults Settings, logger *slog.Logger) *Simulator {
+	if defaults.Scenario == "" {
+		defaults.Scenario = ScenarioDemo
+	}
+	return &Simulator{
+		scheduler: scheduler,
+		defaults:  defaults,
+		logger:    logger.With("component", "simulator"),
+		rand:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// resolve 以场景的默认值补全参数，并校验速率和配比
+func resolve(settings Settings) (Settings, error) {
+	scenario, ok := scenarios[settings.Scenario]
+	if !ok {
+		return Settings{}, fmt.Errorf("%w: %q", ErrUnknownScenario, settings.Scenario)
+	}
+	if settings.Rate == 0 {
+		settings.Rate = scenario.Rate
+	}
+	if len(settings.Mix) == 0 {
+		settings.Mix = scenario.Mix
+	}
+	settings.Mix = normalizeMix(settings.Mix)
+	if settings.Limit == 0 {
+		settings.Limit = len(scenario.Orders)
+	}
+	return settings, validate(settings)
+}
+
+// normalizeMix 将产品类型统一为大写，Viper 加载配置时会将 map 的 key 转为小写
+func normalizeMix(mix map[string]int) map[string]int {
+	if mix == nil {
+		return nil
+	}
+	normalized := make(map[string]int, len(mix))
+	for productType, weight := range mix {
+		normalized[strings.ToUpper(productType)] += weight
+	}
+	return normalized
+}
+
+// validate 校验速率、配比和提交上限
+func validate(settings Settings) error {
+	if settings.Rate <= 0 {
+		return fmt.Errorf("%w: rate must be positive", ErrInvalidSettings)
+	}
+	if settings.Limit < 0 {
+		return fmt.Errorf("%w: limit must not be negative", ErrInvalidSettings)
+	}
+	total := 0
+	for productType, weight := range settings.Mix {
+		if weight < 0 {
+			return fmt.Errorf("%w: negative weight for %s", ErrInvalidSettings, productType)
+		}
+		total += weight
+	}
+	if len(settings.Mix) > 0 && total == 0 {
+		return fmt.Errorf("%w: mix weights sum to zero", ErrInvalidSettings)
+	}
+	return nil
+}
+
+// Start 按 settings 开始提交订单，未指定场景时使用默认参数，直到调用 Stop 或达到提交上限
+// 模拟器已在运行时返回 ErrRunning
+func (s *Simulator) Start(settings Settings) (Status, error) {
+	if settings.Scenario == "" {
+		settings = s.defaults
+	}
+	settings, err := resolve(settings)
+	if err != nil {
+		return Status{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		return s.statusLocked(), ErrRunning
+	}
+	// 提交循环的生命周期独立于发起启动的请求
+	ctx, cancel := context.WithCancel(context.Background())
+	s.settings = settings
+	s.running = true
+	s.submitted = 0
+	s.startedAt = time.Now()
+	s.runs++
+	s.cancel = cancel
+	s.done = make(chan struct{})
+	s.changed = make(chan struct{}, 1)
+	go s.run(ctx, s.runs, s.done, s.changed)
+
+	s.logger.Info("模拟器启动", "scenario", settings.Scenario, "rate", settings.Rate, "mix", settings.Mix, "limit", settings.Limit)
+	return s.statusLocked(), nil
+}
+
+// Stop 停止提交订单并等待提交循环退出，模拟器未在运行时直接返回当前状态
+func (s *Simulator) Stop() Status {
+	s.mu.Lock()
+	cancel, done := s.cancel, s.done
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+	return s.Status()
+}
+
+// Update 调整运行中的提交速率、产品配比和提交上限，零值字段保持不变，不能切换场景
+// 模拟器未在运行时返回 ErrNotRunning
+func (s *Simulator) Update(settings Settings) (Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.running {
+		return s.statusLocked(), ErrNotRunning
+	}
+	if settings.Scenario != "" && settings.Scenario != s.settings.Scenario {
+		return s.statusLocked(), fmt.Errorf("%w: stop the simulator to switch scenario", ErrInvalidSettings)
+	}
+	next := s.settings
+	if settings.Rate != 0 {
+		next.Rate = settings.Rate
+	}
+	if len(settings.Mix) > 0 {
+		next.Mix = normalizeMix(settings.Mix)
+	}
+	if settings.Limit != 0 {
+		next.Limit = settings.Limit
+	}
+	if err := validate(next); err != nil {
+		return s.statusLocked(), err
+	}
+	s.settings = next
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+	s.logger.Info("模拟器参数已调整", "rate", next.Rate, "mix", next.Mix, "limit", next.Limit)
+	return s.statusLocked(), nil
+}
+
+// CheckSettings 校验默认参数，未指定场景时按 demo 场景校验
+func CheckSettings(defaults Settings) error {
+	if defaults.Scenario == "" {
+		defaults.Scenario = ScenarioDemo
+	}
+	_, err := resolve(defaults)
+	return err
+}
+
+// SetDefaults 校验并替换启动时未指定场景所使用的参数
+// 模拟器正在运行同一场景时，按新的参数调整提交速率、产品配比和提交上限
+func (s *Simulator) SetDefaults(defaults Settings) error {
+	if defaults.Scenario == "" {
+		defaults.Scenario = ScenarioDemo
+	}
+	resolved, err := resolve(defaults)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.defaults = defaults
+	if !s.running || s.settings.Scenario != resolved.Scenario {
+		return nil
+	}
+	s.settings = resolved
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+	s.logger.Info("模拟器参数已调整", "rate", resolved.Rate, "mix", resolved.Mix, "limit", resolved.Limit)
+	return nil
+}
+
+// Status 返回模拟器的当前状态
+func (s *Simulator) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.statusLocked()
+}
+
+// statusLocked 生成模拟器的当前状态，调用方必须持有 s.mu
+func (s *Simulator) statusLocked() Status {
+	status := Status{Settings: s.settings, Status: StatusStopped, Submitted: s.submitted, Scenarios: List()}
+	if s.running {
+		status.Status = StatusRunning
+		status.StartedAt = s.startedAt
+	}
+	if status.Scenario == "" {
+		status.Settings = s.defaults
+	}
+	return status
+}
+
+// run 是提交循环：每隔 1/Rate 分钟提交一个订单，参数调整后按新速率重新计时
+func (s *Simulator) run(ctx context.Context, run int, done chan struct{}, changed <-chan struct{}) {
+	defer func() {
+		s.mu.Lock()
+		s.running = false
+		s.cancel = nil
+		s.mu.Unlock()
+		close(done)
+		s.logger.Info("模拟器停止")
+	}()
+
+	for {
+		timer := time.NewTimer(s.interval())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-changed:
+			timer.Stop()
+			continue
+		case <-timer.C:
+		}
+
+		p, last := s.next(run)
+		if p == nil {
+			return
+		}
+		s.scheduler.SubmitTask(p)
+		if last {
+			return
+		}
+	}
+}
+
+// interval 返回按当前速率两次提交之间的间隔
+func (s *Simulator) interval() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return time.Duration(float64(time.Minute) / s.settings.Rate)
+}
+
+// next 生成下一个订单并计入已提交数，last 表示达到了提交上限；已达到上限时返回 nil
+func (s *Simulator) next(run int) (p *types.Product, last bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.settings.Limit > 0 && s.submitted >= s.settings.Limit {
+		return nil, true
+	}
+	scenario := scenarios[s.settings.Scenario]
+	if len(scenario.Orders) > 0 {
+		order := scenario.Orders[s.submitted%len(scenario.Orders)]
+		p = &types.Product{ID: order.ID, Type: order.Type, Priority: order.Priority, Attrs: map[string]interface{}{"layers": order.Layers}}
+		if run > 1 || s.submitted >= len(scenario.Orders) {
+			// 重复运行固定订单场景时为订单 ID 加上后缀，避免与之前提交的订单冲突
+			p.ID = fmt.Sprintf("%s_R%d_%d", order.ID, run, s.submitted/len(scenario.Orders)+1)
+		}
+	} else {
+		p = newProduct(s.pickType(), fmt.Sprintf("SIM_%s_%04d", s.startedAt.Format("150405"), s.submitted+1), s.rand)
+	}
+	s.submitted++
+	return p, s.settings.Limit > 0 && s.submitted >= s.settings.Limit
+}
+
+// pickType 按配比的权重随机选择产品类型，调用方必须持有 s.mu
+func (s *Simulator) pickType() string {
+	names := make([]string, 0, len(s.settings.Mix))
+	total := 0
+	for productType, weight := range s.settings.Mix {
+		if weight > 0 {
+			names = append(names, productType)
+			total += weight
+		}
+	}
+	// 按名称排序，保证相同的随机数得到相同的结果
+	sort.Strings(names)
+	n := s.rand.Intn(total)
+	for _, productType := range names {
+		if n < s.settings.Mix[productType] {
+			return productType
+		}
+		n -= s.settings.Mix[productType]
+	}
+	return names[len(names)-1]
+}
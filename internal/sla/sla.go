@@ -0,0 +1,371 @@
+// Package sla 跟踪工件的交期，持续预测完工时间并统计准时交付率
+//   - 工件的交期取自提交时的 due_at，未指定时按产品类型的默认交期从提交时算起，两者都没有的工件不跟踪
+//   - 预计完工时间 = 当前时间 + 剩余步骤的预计耗时，步骤耗时按工站的指数加权均值 (EWMA) 估计，并行步骤取最慢的工站
+//   - 预计完工晚于交期时发布一次 SLABreachPredicted，超过交期仍未完成 (或完成时已超过交期) 时发布一次 SLABreached
+//   - 准时交付率 = 按期完成的工件数 / 完成的工件数，只统计有交期的工件
+package sla
+
+import (
+	"context"
+	"industrial-4.0-demo/internal/event"
+	"industrial-4.0-demo/internal/metrics"
+	"industrial-4.0-demo/internal/types"
+	"industrial-4.0-demo/internal/windowed"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gaugeInterval 是刷新 sla_on_time_delivery_ratio 指标的间隔
+const gaugeInterval = 10 * time.Second
+
+// alpha 是步骤耗时 EWMA 的平滑系数
+const alpha = 0.2
+
+// Routes 返回产品类型当前使用的工作流步骤，没有可用的工作流时返回 nil
+type Routes func(productType string) []types.WorkflowStep
+
+// Estimates 是预测完工时间的参数
+type Estimates struct {
+	Step time.Duration            // 工站还没有加工记录时使用的步骤耗时
+	Move time.Duration            // 工件在相邻步骤之间移动的耗时
+	Due  map[string]time.Duration // 各产品类型的默认交期 (从提交时算起)，产品类型不区分大小写
+}
+
+// TypeDelivery 是一种产品类型在统计窗口内的交付情况
+type TypeDelivery struct {
+	Type           string  `json:"type"`
+	Delivered      int     `json:"delivered"`        // 完成的工件数
+	OnTime         int     `json:"on_time"`          // 按期完成的工件数
+	Late           int     `json:"late"`             // 超过交期完成的工件数
+	OnTimeRatio    float64 `json:"on_time_ratio"`    // 0 ~ 1，窗口内没有完成的工件时为 0
+	AvgLateSeconds float64 `json:"avg_late_seconds"` // 延期完成的工件平均超出交期的时长
+}
+
+// Order 是一个尚未完成、已预测会延期或已超过交期的工件
+type Order struct {
+	ProductID       string    `json:"product_id"`
+	Type            string    `json:"type"`
+	Namespace       string    `json:"namespace,omitempty"`
+	DueAt           time.Time `json:"due_at"`
+	ProjectedAt     time.Time `json:"projected_at"`     // 预计完工时间
+	LatenessSeconds float64   `json:"lateness_seconds"` // 预计完工时间超出交期的时长
+	Breached        bool      `json:"breached"`         // 已超过交期
+}
+
+// Report 是统计窗口内的交付报告
+// 窗口早于追踪开始时从追踪开始时计算
+type Report struct {
+	Window      string         `json:"window"`
+	From        time.Time      `json:"from"`
+	To          time.Time      `json:"to"`
+	Delivered   int            `json:"delivered"`
+	OnTime      int            `json:"on_time"`
+	OnTimeRatio float64        `json:"on_time_ratio"`
+	Products    []TypeDelivery `json:"products"`
+	AtRisk      []Order        `json:"at_risk"` // 当前预测会延期或已超过交期的工件，按交期从早到晚排列，不受窗口限制
+}
+
+// order 是跟踪中的工件
+type order struct {
+	productType string
+	namespace   string
+	dueAt       time.Time
+	step        int // 最近完成的步骤下标，尚未完成任何步骤时为 -1
+	projected   time.Time
+	predicted   bool // 已发布 SLABreachPredicted (超过交期时同样视为已预测)
+	breached    bool // 已发布 SLABreached
+}
+
+// delivery 是一个完成的工件
+type delivery struct {
+	at          time.Time
+	productType string
+	late        time.Duration // 超出交期的时长，按期完成时为 0
+}
+
+// Tracker 订阅事件总线，跟踪工件的交期，保留最近 retention 时长内的交付记录并按需生成报告
+type Tracker struct {
+	mu         sync.Mutex
+	routes     Routes
+	estimates  Estimates
+	retention  windowed.Retention
+	orders     map[string]*order
+	durations  map[types.StationID]float64 // 各工站步骤耗时的 EWMA (秒)
+	deliveries []delivery
+	bus        *event.Bus
+	metrics    *metrics.Metrics
+}
+
+// NewTracker 创建一个交期追踪器
+// routes 用于计算工件的剩余步骤；retention 是交付记录的保留时长，也是可查询的最大窗口；m 是违约计数和 Run 更新的指标
+func NewTracker(routes Routes, estimates Estimates, retention time.Duration, m *metrics.Metrics) *Tracker {
+	due := make(map[string]time.Duration, len(estimates.Due))
+	for productType, d := range estimates.Due {
+		due[strings.ToUpper(productType)] = d
+	}
+	estimates.Due = due
+	return &Tracker{
+		routes:    routes,
+		estimates: estimates,
+		retention: windowed.NewRetention(retention),
+		orders:    make(map[string]*order),
+		durations: make(map[types.StationID]float64),
+		metrics:   m,
+	}
+}
+
+// Register 订阅工件入队、步骤完成和工件结束事件，预测会延期或超过交期时在同一事件总线上发布 SLA 事件
+// 失败和取消的工件不再跟踪，也不计入交付
+func (t *Tracker) Register(bus *event.Bus) {
+	t.mu.Lock()
+	t.bus = bus
+	t.mu.Unlock()
+	bus.Subscribe(event.ProductQueued, func(e event.Event) {
+		t.recordQueued(e.Product, e.Timestamp)
+	})
+	bus.Subscribe(event.StepCompleted, func(e event.Event) {
+		duration, _ := e.Product.Attrs["duration"].(float64)
+		t.recordStep(e.ProductID, e.StationID, e.Step, duration, e.Error == nil, e.Timestamp)
+	})
+	bus.Subscribe(event.ProductCompleted, func(e event.Event) {
+		t.recordCompleted(e.ProductID, e.Timestamp)
+	})
+	for _, typ := range []event.EventType{event.ProductFailed, event.ProductCancelled} {
+		bus.Subscribe(typ, func(e event.Event) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			delete(t.orders, e.ProductID)
+			t.updateAtRiskLocked()
+		})
+	}
+}
+
+// Run 每隔 interval 重新预测所有跟踪中的工件，并定期按 window 统计准时交付率、更新 sla_on_time_delivery_ratio 指标，直到 ctx 结束
+// window 超过保留时长时使用保留时长，窗口内没有完成工件的产品类型不更新
+func (t *Tracker) Run(ctx context.Context, interval, window time.Duration) {
+	window = t.retention.Clamp(window)
+	check := time.NewTicker(interval)
+	defer check.Stop()
+	gauges := time.NewTicker(gaugeInterval)
+	defer gauges.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-check.C:
+			t.Check(now)
+		case now := <-gauges.C:
+			report, _ := t.Report(window, now)
+			for _, p := range report.Products {
+				if p.Delivered > 0 {
+					t.metrics.SLAOnTimeDeliveryRatio.WithLabelValues(p.Type).Set(p.OnTimeRatio)
+				}
+			}
+		}
+	}
+}
+
+// Check 按 now 重新预测所有跟踪中的工件，发布新出现的预测延期和交期违约
+func (t *Tracker) Check(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id, o := range t.orders {
+		t.evaluateLocked(id, o, now)
+	}
+	t.updateAtRiskLocked()
+}
+
+// recordQueued 开始跟踪有交期的工件
+func (t *Tracker) recordQueued(p *types.Product, at time.Time) {
+	dueAt := p.DueAt
+	if dueAt.IsZero() {
+		d, ok := t.estimates.Due[strings.ToUpper(p.Type)]
+		if !ok {
+			return
+		}
+		dueAt = at.Add(d)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	o := &order{productType: p.Type, namespace: p.Namespace, dueAt: dueAt, step: -1}
+	t.orders[p.ID] = o
+	t.evaluateLocked(p.ID, o, at)
+	t.updateAtRiskLocked()
+}
+
+// recordStep 用加工成功的步骤更新工站的耗时估计，并重新预测该工件
+func (t *Tracker) recordStep(productID string, id types.StationID, step int, duration float64, good bool, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if good && duration > 0 {
+		if mean, ok := t.durations[id]; ok {
+			t.durations[id] = alpha*duration + (1-alpha)*mean
+		} else {
+			t.durations[id] = duration
+		}
+	}
+	o, ok := t.orders[productID]
+	if !ok {
+		return
+	}
+	// 并行步骤的多个工站完成事件可能乱序到达
+	o.step = max(o.step, step)
+	t.evaluateLocked(productID, o, at)
+	t.updateAtRiskLocked()
+}
+
+// recordCompleted 记录一次交付，完成时已超过交期但尚未发布违约的工件补发 SLABreached
+func (t *Tracker) recordCompleted(productID string, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	o, ok := t.orders[productID]
+	if !ok {
+		return
+	}
+	delete(t.orders, productID)
+	late := max(at.Sub(o.dueAt), 0)
+	if late > 0 && !o.breached {
+		o.projected = at
+		t.publishLocked(event.SLABreached, productID, o, at)
+	}
+	t.deliveries = append(t.deliveries, delivery{at: at, productType: o.productType, late: late})
+	t.pruneLocked(at)
+	t.updateAtRiskLocked()
+}
+
+// evaluateLocked 重新预测工件的完工时间，预测延期或超过交期时各发布一次事件，调用方必须持有锁
+func (t *Tracker) evaluateLocked(id string, o *order, now time.Time) {
+	o.projected = now.Add(t.remainingLocked(o))
+	if now.After(o.dueAt) {
+		if !o.breached {
+			o.breached, o.predicted = true, true
+			t.publishLocked(event.SLABreached, id, o, now)
+		}
+		return
+	}
+	if o.projected.After(o.dueAt) && !o.predicted {
+		o.predicted = true
+		t.publishLocked(event.SLABreachPredicted, id, o, now)
+	}
+}
+
+// remainingLocked 估计工件剩余步骤的耗时，正在加工的步骤按完整耗时计算，调用方必须持有锁
+func (t *Tracker) remainingLocked(o *order) time.Duration {
+	var remaining time.Duration
+	steps := t.routes(o.productType)
+	for i := o.step + 1; i < len(steps); i++ {
+		var slowest time.Duration
+		for _, id := range steps[i].StationIDs {
+			d := t.estimates.Step
+			if mean, ok := t.durations[id]; ok {
+				d = time.Duration(mean * float64(time.Second))
+			}
+			slowest = max(slowest, d)
+		}
+		remaining += slowest
+		if i > 0 {
+			remaining += t.estimates.Move
+		}
+	}
+	return remaining
+}
+
+// publishLocked 发布工件的 SLA 事件并计数，调用方必须持有锁
+func (t *Tracker) publishLocked(typ event.EventType, id string, o *order, now time.Time) {
+	kind := "predicted"
+	if typ == event.SLABreached {
+		kind = "breached"
+	}
+	t.metrics.SLABreachesTotal.WithLabelValues(o.productType, kind, o.namespace).Inc()
+	if t.bus == nil {
+		return
+	}
+	t.bus.Publish(event.Event{
+		Type:      typ,
+		ProductID: id,
+		Product:   &types.Product{ID: id, Type: o.productType, Namespace: o.namespace, DueAt: o.dueAt},
+		SLA:       &event.SLAStatus{DueAt: o.dueAt, ProjectedAt: o.projected},
+		Timestamp: now,
+	})
+}
+
+// updateAtRiskLocked 更新预测会延期或已超过交期的在制工件数，调用方必须持有锁
+func (t *Tracker) updateAtRiskLocked() {
+	n := 0
+	for _, o := range t.orders {
+		if o.predicted {
+			n++
+		}
+	}
+	t.metrics.SLAAtRiskProducts.Set(float64(n))
+}
+
+// pruneLocked 丢弃超过保留时长的交付记录，调用方必须持有锁
+func (t *Tracker) pruneLocked(now time.Time) {
+	cutoff := t.retention.Cutoff(now)
+	t.deliveries = slices.DeleteFunc(t.deliveries, func(d delivery) bool { return d.at.Before(cutoff) })
+}
+
+// Report 统计截至 now 的 window 时长内各产品类型的准时交付率，并列出当前预测会延期或已超过交期的工件
+func (t *Tracker) Report(window time.Duration, now time.Time) (Report, error) {
+	from, err := t.retention.From(window, now)
+	if err != nil {
+		return Report{}, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pruneLocked(now)
+
+	report := Report{Window: window.String(), From: from, To: now, Products: []TypeDelivery{}, AtRisk: []Order{}}
+	byType := make(map[string]*TypeDelivery)
+	late := make(map[string]time.Duration)
+	for _, d := range t.deliveries {
+		if d.at.Before(from) || d.at.After(now) {
+			continue
+		}
+		p, ok := byType[d.productType]
+		if !ok {
+			p = &TypeDelivery{Type: d.productType}
+			byType[d.productType] = p
+		}
+		p.Delivered++
+		if d.late > 0 {
+			p.Late++
+			late[d.productType] += d.late
+		} else {
+			p.OnTime++
+		}
+	}
+	for _, p := range byType {
+		p.OnTimeRatio = float64(p.OnTime) / float64(p.Delivered)
+		if p.Late > 0 {
+			p.AvgLateSeconds = late[p.Type].Seconds() / float64(p.Late)
+		}
+		report.Delivered += p.Delivered
+		report.OnTime += p.OnTime
+		report.Products = append(report.Products, *p)
+	}
+	if report.Delivered > 0 {
+		report.OnTimeRatio = float64(report.OnTime) / float64(report.Delivered)
+	}
+	slices.SortFunc(report.Products, func(a, b TypeDelivery) int { return strings.Compare(a.Type, b.Type) })
+
+	for id, o := range t.orders {
+		if !o.predicted {
+			continue
+		}
+		report.AtRisk = append(report.AtRisk, Order{
+			ProductID:       id,
+			Type:            o.productType,
+			Namespace:       o.namespace,
+			DueAt:           o.dueAt,
+			ProjectedAt:     o.projected,
+			LatenessSeconds: max(o.projected.Sub(o.dueAt), 0).Seconds(),
+			Breached:        o.breached,
+		})
+	}
+	slices.SortFunc(report.AtRisk, func(a, b Order) int { return a.DueAt.Compare(b.DueAt) })
+	return report, nil
+}
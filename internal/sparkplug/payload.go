@@ -0,0 +1,226 @@
+package sparkplug
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// DataType 是 Sparkplug B 的指标数据类型
+type DataType uint32
+
+// 本包使用的数据类型，编号与 Sparkplug B 规范的 DataType 枚举一致
+const (
+	Int32   DataType = 3
+	Int64   DataType = 4
+	UInt64  DataType = 8
+	Double  DataType = 10
+	Boolean DataType = 11
+	String  DataType = 12
+)
+
+// ErrMalformedPayload 表示无法解析的 Sparkplug B 载荷
+var ErrMalformedPayload = errors.New("malformed sparkplug payload")
+
+// Metric 是载荷中的一个指标，Value 的 Go 类型决定数据类型：
+// int32 / int64 / uint64 / float64 / bool / string
+type Metric struct {
+	Name      string
+	Timestamp uint64 // 毫秒时间戳
+	Value     any
+}
+
+// Payload 是 Sparkplug B 载荷 (org.eclipse.tahu.protobuf.Payload) 的子集
+type Payload struct {
+	Timestamp uint64 // 毫秒时间戳
+	Metrics   []Metric
+	Seq       uint64 // 消息序号，0 ~ 255 循环，NDEATH 没有序号
+	HasSeq    bool
+}
+
+// Metric 返回指定名称的指标
+func (p Payload) Metric(name string) (Metric, bool) {
+	for _, m := range p.Metrics {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return Metric{}, false
+}
+
+// dataTypeOf 返回指标值对应的数据类型
+func dataTypeOf(v any) (DataType, error) {
+	switch v.(type) {
+	case int32:
+		return Int32, nil
+	case int64:
+		return Int64, nil
+	case uint64:
+		return UInt64, nil
+	case float64:
+		return Double, nil
+	case bool:
+		return Boolean, nil
+	case string:
+		return String, nil
+	}
+	return 0, fmt.Errorf("unsupported metric value type %T", v)
+}
+
+// Marshal 按 protobuf 编码载荷，指标值的类型不受支持时返回错误
+func (p Payload) Marshal() ([]byte, error) {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, p.Timestamp)
+	for _, m := range p.Metrics {
+		mb, err := m.marshal()
+		if err != nil {
+			return nil, fmt.Errorf("metric %s: %w", m.Name, err)
+		}
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, mb)
+	}
+	if p.HasSeq {
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		b = protowire.AppendVarint(b, p.Seq)
+	}
+	return b, nil
+}
+
+// marshal 按 protobuf 编码指标 (org.eclipse.tahu.protobuf.Payload.Metric)
+func (m Metric) marshal() ([]byte, error) {
+	dt, err := dataTypeOf(m.Value)
+	if err != nil {
+		return nil, err
+	}
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, m.Name)
+	b = protowire.AppendTag(b, 3, protowire.VarintType)
+	b = protowire.AppendVarint(b, m.Timestamp)
+	b = protowire.AppendTag(b, 4, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(dt))
+	switch v := m.Value.(type) {
+	case int32:
+		// 有符号整数按补码存入 uint32 字段
+		b = protowire.AppendTag(b, 10, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(uint32(v)))
+	case int64:
+		b = protowire.AppendTag(b, 11, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(v))
+	case uint64:
+		b = protowire.AppendTag(b, 11, protowire.VarintType)
+		b = protowire.AppendVarint(b, v)
+	case float64:
+		b = protowire.AppendTag(b, 13, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(v))
+	case bool:
+		b = protowire.AppendTag(b, 14, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(v))
+	case string:
+		b = protowire.AppendTag(b, 15, protowire.BytesType)
+		b = protowire.AppendString(b, v)
+	}
+	return b, nil
+}
+
+// Unmarshal 解析 protobuf 编码的载荷，忽略本包不使用的字段
+func Unmarshal(b []byte) (Payload, error) {
+	var p Payload
+	err := walk(b, func(num protowire.Number, typ protowire.Type, v uint64, raw []byte) error {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			p.Timestamp = v
+		case num == 2 && typ == protowire.BytesType:
+			m, err := unmarshalMetric(raw)
+			if err != nil {
+				return err
+			}
+			p.Metrics = append(p.Metrics, m)
+		case num == 3 && typ == protowire.VarintType:
+			p.Seq, p.HasSeq = v, true
+		}
+		return nil
+	})
+	return p, err
+}
+
+// unmarshalMetric 解析一个指标，按数据类型还原值的 Go 类型
+func unmarshalMetric(b []byte) (Metric, error) {
+	var m Metric
+	var dt DataType
+	var varint, fixed uint64
+	var str string
+	err := walk(b, func(num protowire.Number, typ protowire.Type, v uint64, raw []byte) error {
+		switch num {
+		case 1:
+			m.Name = string(raw)
+		case 3:
+			m.Timestamp = v
+		case 4:
+			dt = DataType(v)
+		case 10, 11, 14:
+			varint = v
+		case 12, 13:
+			fixed = v
+		case 15:
+			str = string(raw)
+		}
+		return nil
+	})
+	if err != nil {
+		return m, err
+	}
+	switch dt {
+	case Int32:
+		m.Value = int32(uint32(varint))
+	case Int64:
+		m.Value = int64(varint)
+	case UInt64:
+		m.Value = varint
+	case Double:
+		m.Value = math.Float64frombits(fixed)
+	case Boolean:
+		m.Value = protowire.DecodeBool(varint)
+	case String:
+		m.Value = str
+	}
+	return m, nil
+}
+
+// walk 依次解析 b 中的字段，varint 和定长字段的值通过 v 传入，长度前缀字段的内容通过 raw 传入
+func walk(b []byte, fn func(num protowire.Number, typ protowire.Type, v uint64, raw []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return fmt.Errorf("%w: %v", ErrMalformedPayload, protowire.ParseError(n))
+		}
+		b = b[n:]
+		var v uint64
+		var raw []byte
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed32Type:
+			var v32 uint32
+			v32, n = protowire.ConsumeFixed32(b)
+			v = uint64(v32)
+		case protowire.Fixed64Type:
+			v, n = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			raw, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return fmt.Errorf("%w: %v", ErrMalformedPayload, protowire.ParseError(n))
+		}
+		b = b[n:]
+		if err := fn(num, typ, v, raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,384 @@
+// Package sparkplug 按 Sparkplug B 规范将产线状态发布到 MQTT Broker，Ignition 等 IIoT 平台无需额外配置即可接入演示工厂
+//
+// 编排器是一个边缘节点 (edge node)，每个工站是它下面的一个设备 (device)：
+// 连接后发布 NBIRTH 和各工站的 DBIRTH，之后按间隔只发布变化的指标 (NDATA / DDATA)；
+// 工站故障停机时发布 DDEATH，恢复后重新发布 DBIRTH；编排器异常断开时由 Broker 代为发布遗嘱 NDEATH，
+// 收到 NCMD 的 Node Control/Rebirth 时重新发布所有出生证书
+package sparkplug
+
+import (
+	"context"
+	"industrial-4.0-demo/internal/event"
+	"industrial-4.0-demo/internal/fsm"
+	"industrial-4.0-demo/internal/metrics"
+	"industrial-4.0-demo/internal/types"
+	"industrial-4.0-demo/internal/web"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Sparkplug B 的消息类型
+const (
+	NBirth = "NBIRTH"
+	NDeath = "NDEATH"
+	NData  = "NDATA"
+	NCmd   = "NCMD"
+	DBirth = "DBIRTH"
+	DDeath = "DDEATH"
+	DData  = "DDATA"
+)
+
+// 边缘节点的控制指标
+const (
+	MetricBdSeq   = "bdSeq"                // 出生/死亡证书序号，NBIRTH 与对应的 NDEATH 相同
+	MetricRebirth = "Node Control/Rebirth" // 写入 true 要求重新发布所有出生证书
+)
+
+const (
+	connectTimeout = 10 * time.Second
+	publishTimeout = 5 * time.Second
+	maxBackoff     = 30 * time.Second
+)
+
+// Options 定义 Broker 连接和 Sparkplug 的拓扑名称
+type Options struct {
+	Broker     string `mapstructure:"broker"`    // Broker 地址，例如 tcp://mosquitto:1883，为空时不发布
+	ClientID   string `mapstructure:"client_id"` // MQTT 客户端 ID
+	Username   string `mapstructure:"username"`  // 为空时不认证
+	Password   string `mapstructure:"password"`
+	GroupID    string `mapstructure:"group_id"`     // Sparkplug 组 ID
+	EdgeNodeID string `mapstructure:"edge_node_id"` // 编排器作为边缘节点的 ID
+	IntervalMs int    `mapstructure:"interval_ms"`  // 检查指标变化的间隔
+}
+
+// stepCounts 是工站加工的步骤数
+type stepCounts struct {
+	processed int64
+	failed    int64
+}
+
+// Publisher 将实时状态发布为 Sparkplug B 消息
+type Publisher struct {
+	opts         Options
+	stateTracker *web.StateTracker
+	metrics      *metrics.Metrics
+	logger       *slog.Logger
+	rebirth      chan struct{}
+
+	mu     sync.Mutex
+	counts map[types.StationID]*stepCounts
+
+	// 以下字段只在 Run 的 goroutine 中访问
+	client  mqtt.Client
+	bdSeq   uint64
+	seq     uint64
+	node    map[string]any                     // 最近一次发布的节点指标
+	devices map[types.StationID]map[string]any // 在线的工站最近一次发布的指标
+}
+
+// New 创建一个发布器，调用 Run 后开始连接和发布
+func New(opts Options, st *web.StateTracker, m *metrics.Metrics, logger *slog.Logger) *Publisher {
+	return &Publisher{
+		opts:         opts,
+		stateTracker: st,
+		metrics:      m,
+		logger:       logger.With("component", "sparkplug"),
+		rebirth:      make(chan struct{}, 1),
+		counts:       make(map[types.StationID]*stepCounts),
+	}
+}
+
+// Register 订阅步骤完成事件，统计每个工站加工和失败的步骤数
+func (p *Publisher) Register(bus *event.Bus) {
+	bus.Subscribe(event.StepCompleted, func(e event.Event) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		c, ok := p.counts[e.StationID]
+		if !ok {
+			c = &stepCounts{}
+			p.counts[e.StationID] = c
+		}
+		c.processed++
+		if e.Error != nil {
+			c.failed++
+		}
+	})
+}
+
+// Run 连接 Broker 并发布状态，连接断开后退避重连，ctx 结束时发布 NDEATH 并断开连接
+func (p *Publisher) Run(ctx context.Context) {
+	interval := time.Duration(p.opts.IntervalMs) * time.Millisecond
+	for {
+		lost := make(chan error, 1)
+		if !p.connect(ctx, lost) {
+			return
+		}
+		p.birth(time.Now())
+		ticker := time.NewTicker(interval)
+	session:
+		for {
+			select {
+			case <-ctx.Done():
+				ticker.Stop()
+				p.publish(p.topic(NDeath, ""), 1, p.deathPayload(), NDeath)
+				p.client.Disconnect(uint(publishTimeout / time.Millisecond))
+				p.logger.Info("已断开 MQTT Broker")
+				return
+			case err := <-lost:
+				p.logger.Warn("与 MQTT Broker 的连接已断开", "error", err)
+				break session
+			case <-p.rebirth:
+				p.logger.Info("收到 Rebirth 请求，重新发布出生证书")
+				p.birth(time.Now())
+			case now := <-ticker.C:
+				p.update(now)
+			}
+		}
+		ticker.Stop()
+		p.bdSeq = (p.bdSeq + 1) % 256
+	}
+}
+
+// connect 以当前 bdSeq 的 NDEATH 作为遗嘱连接 Broker，失败时退避重试，ctx 结束时返回 false
+func (p *Publisher) connect(ctx context.Context, lost chan<- error) bool {
+	opts := mqtt.NewClientOptions().
+		AddBroker(p.opts.Broker).
+		SetClientID(p.opts.ClientID).
+		SetUsername(p.opts.Username).
+		SetPassword(p.opts.Password).
+		SetCleanSession(true).
+		SetAutoReconnect(false).
+		SetConnectTimeout(connectTimeout).
+		SetBinaryWill(p.topic(NDeath, ""), p.deathPayload(), 1, false).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			select {
+			case lost <- err:
+			default:
+			}
+		})
+	backoff := time.Second
+	for {
+		client := mqtt.NewClient(opts)
+		token := client.Connect()
+		token.WaitTimeout(connectTimeout)
+		err := token.Error()
+		if err == nil && client.IsConnected() {
+			cmd := client.Subscribe(p.topic(NCmd, ""), 1, p.handleCommand)
+			if cmd.WaitTimeout(publishTimeout) && cmd.Error() == nil {
+				p.client = client
+				p.logger.Info("已连接 MQTT Broker", "broker", p.opts.Broker, "group_id", p.opts.GroupID,
+					"edge_node_id", p.opts.EdgeNodeID, "bd_seq", p.bdSeq)
+				return true
+			}
+			err = cmd.Error()
+			client.Disconnect(0)
+		}
+		p.logger.Warn("连接 MQTT Broker 失败，稍后重试", "broker", p.opts.Broker, "error", err, "backoff", backoff)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// handleCommand 处理 NCMD，Node Control/Rebirth 为 true 时通知 Run 重新发布出生证书
+func (p *Publisher) handleCommand(_ mqtt.Client, msg mqtt.Message) {
+	payload, err := Unmarshal(msg.Payload())
+	if err != nil {
+		p.logger.Warn("无法解析 NCMD", "error", err)
+		return
+	}
+	if m, ok := payload.Metric(MetricRebirth); ok && m.Value == true {
+		select {
+		case p.rebirth <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// birth 发布 NBIRTH 和所有在线工站的 DBIRTH，序号从 0 重新开始
+func (p *Publisher) birth(now time.Time) {
+	state := p.stateTracker.GetStateSnapshot()
+	p.node = nodeMetrics(state)
+	p.devices = make(map[types.StationID]map[string]any)
+	p.seq = 0
+
+	birth := p.payload(now, p.node)
+	birth.HasSeq = true
+	birth.Metrics = append([]Metric{
+		{Name: MetricBdSeq, Timestamp: birth.Timestamp, Value: p.bdSeq},
+		{Name: MetricRebirth, Timestamp: birth.Timestamp, Value: false},
+	}, birth.Metrics...)
+	p.publishPayload(p.topic(NBirth, ""), birth, NBirth)
+
+	for _, id := range sortedStations(state.Stations) {
+		p.station(now, id, state.Stations[id])
+	}
+}
+
+// update 发布变化的节点指标，并按工站的状态发布 DBIRTH、DDEATH 或变化的指标
+func (p *Publisher) update(now time.Time) {
+	state := p.stateTracker.GetStateSnapshot()
+	current := nodeMetrics(state)
+	if changed := diff(p.node, current); len(changed) > 0 {
+		p.node = current
+		p.publishPayload(p.topic(NData, ""), p.nextPayload(now, changed), NData)
+	}
+	for _, id := range sortedStations(state.Stations) {
+		p.station(now, id, state.Stations[id])
+	}
+}
+
+// station 根据工站的当前状态发布 DBIRTH、DDEATH 或 DDATA
+func (p *Publisher) station(now time.Time, id types.StationID, st web.StationStatus) {
+	last, alive := p.devices[id]
+	if st.Status == string(fsm.StationDown) {
+		if alive {
+			delete(p.devices, id)
+			p.publishPayload(p.topic(DDeath, string(id)), p.nextPayload(now, nil), DDeath)
+		}
+		return
+	}
+	current := p.deviceMetrics(id, st)
+	if !alive {
+		p.devices[id] = current
+		p.publishPayload(p.topic(DBirth, string(id)), p.nextPayload(now, current), DBirth)
+		return
+	}
+	if changed := diff(last, current); len(changed) > 0 {
+		p.devices[id] = current
+		p.publishPayload(p.topic(DData, string(id)), p.nextPayload(now, changed), DData)
+	}
+}
+
+// nodeMetrics 返回边缘节点的指标：调度器状态和按状态统计的工件数
+func nodeMetrics(state web.GlobalState) map[string]any {
+	m := map[string]any{
+		"Scheduler/Status":      "",
+		"Scheduler/QueueLength": int32(0),
+		"Scheduler/BusyWorkers": int32(0),
+	}
+	if s := state.Scheduler; s != nil {
+		m["Scheduler/Status"] = s.Status
+		m["Scheduler/QueueLength"] = int32(len(s.Queue))
+		m["Scheduler/BusyWorkers"] = int32(s.BusyWorkers)
+	}
+	var inProgress, completed, compensated, cancelled int32
+	for _, product := range state.Products {
+		switch fsm.State(product.Status) {
+		case fsm.StateCompleted:
+			completed++
+		case fsm.StateCompensated:
+			compensated++
+		case fsm.StateCancelled:
+			cancelled++
+		default:
+			inProgress++
+		}
+	}
+	m["Products/InProgress"] = inProgress
+	m["Products/Completed"] = completed
+	m["Products/Compensated"] = compensated
+	m["Products/Cancelled"] = cancelled
+	return m
+}
+
+// deviceMetrics 返回工站的指标
+func (p *Publisher) deviceMetrics(id types.StationID, st web.StationStatus) map[string]any {
+	var c stepCounts
+	p.mu.Lock()
+	if counts, ok := p.counts[id]; ok {
+		c = *counts
+	}
+	p.mu.Unlock()
+	return map[string]any{
+		"Status":             st.Status,
+		"Health":             st.Health,
+		"Utilization":        st.Utilization,
+		"ActiveProducts":     int32(len(st.Products)),
+		"QueueLength":        int32(st.QueueLength),
+		"Products/Processed": c.processed,
+		"Products/Failed":    c.failed,
+	}
+}
+
+// diff 返回 current 中与 last 不同的指标
+func diff(last, current map[string]any) map[string]any {
+	changed := make(map[string]any)
+	for name, v := range current {
+		if last[name] != v {
+			changed[name] = v
+		}
+	}
+	return changed
+}
+
+// sortedStations 返回按 ID 排序的工站
+func sortedStations(stations map[types.StationID]web.StationStatus) []types.StationID {
+	return slices.Sorted(maps.Keys(stations))
+}
+
+// topic 返回消息的主题 spBv1.0/<组>/<消息类型>/<边缘节点>[/<设备>]，device 为空时是节点级消息
+func (p *Publisher) topic(msgType, device string) string {
+	topic := "spBv1.0/" + p.opts.GroupID + "/" + msgType + "/" + p.opts.EdgeNodeID
+	if device != "" {
+		topic += "/" + device
+	}
+	return topic
+}
+
+// payload 生成包含 metrics 的载荷，指标按名称排序
+func (p *Publisher) payload(now time.Time, metrics map[string]any) Payload {
+	ts := uint64(now.UnixMilli())
+	payload := Payload{Timestamp: ts}
+	for _, name := range slices.Sorted(maps.Keys(metrics)) {
+		payload.Metrics = append(payload.Metrics, Metric{Name: name, Timestamp: ts, Value: metrics[name]})
+	}
+	return payload
+}
+
+// nextPayload 生成带下一个序号的载荷，序号在 NBIRTH 之后从 1 开始，255 之后回到 0
+func (p *Publisher) nextPayload(now time.Time, metrics map[string]any) Payload {
+	payload := p.payload(now, metrics)
+	p.seq = (p.seq + 1) % 256
+	payload.Seq, payload.HasSeq = p.seq, true
+	return payload
+}
+
+// deathPayload 生成当前 bdSeq 的 NDEATH 载荷，NDEATH 没有序号
+func (p *Publisher) deathPayload() []byte {
+	ts := uint64(time.Now().UnixMilli())
+	b, _ := Payload{Timestamp: ts, Metrics: []Metric{{Name: MetricBdSeq, Timestamp: ts, Value: p.bdSeq}}}.Marshal()
+	return b
+}
+
+// publishPayload 编码并发布载荷
+func (p *Publisher) publishPayload(topic string, payload Payload, msgType string) {
+	b, err := payload.Marshal()
+	if err != nil {
+		p.logger.Error("无法编码 Sparkplug 载荷", "topic", topic, "error", err)
+		return
+	}
+	p.publish(topic, 0, b, msgType)
+}
+
+// publish 发布消息，Sparkplug 只有 NDEATH 使用 QoS 1，其他消息使用 QoS 0
+func (p *Publisher) publish(topic string, qos byte, b []byte, msgType string) {
+	token := p.client.Publish(topic, qos, false, b)
+	if !token.WaitTimeout(publishTimeout) {
+		p.logger.Warn("发布 Sparkplug 消息超时", "topic", topic)
+		return
+	}
+	if err := token.Error(); err != nil {
+		p.logger.Warn("发布 Sparkplug 消息失败", "topic", topic, "error", err)
+		return
+	}
+	p.metrics.SparkplugMessagesPublishedTotal.WithLabelValues(msgType).Inc()
+}
@@ -0,0 +1,203 @@
+package station
+
+import (
+	"context"
+	"fmt"
+	"industrial-4.0-demo/internal/defect"
+	"industrial-4.0-demo/internal/station/stationv1"
+	"industrial-4.0-demo/internal/types"
+	"industrial-4.0-demo/internal/util"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCStation 代表一个通过 gRPC 调用的远程工站客户端，协议定义在 proto/station/v1/station.proto
+// 与 RemoteStation 相比复用长连接并使用强类型的 protobuf 消息，适合高吞吐的工站集成；只支持同步加工
+type GRPCStation struct {
+	ID       types.StationID // 工站 ID，随请求发送，一个服务可以提供多个工站
+	Target   string          // 远程服务的地址 (host:port)
+	conn     *grpc.ClientConn
+	client   stationv1.StationClient
+	health   healthpb.HealthClient
+	options  RemoteOptions
+	logger   *slog.Logger
+	declared types.Provenance // 配置中声明的设备、固件和物料，远程服务在响应中返回时以响应为准
+}
+
+// NewGRPCStation 创建一个新的 gRPC 远程工站实例，连接在第一次调用时建立，断开后自动重连
+// opts.TLS 为 nil 时使用明文连接；Async、PollInterval 和 HTTP Basic 认证对 gRPC 不生效
+func NewGRPCStation(id types.StationID, target string, opts RemoteOptions, logger *slog.Logger) (*GRPCStation, error) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultRemoteTimeout
+	}
+	creds := insecure.NewCredentials()
+	if opts.TLS != nil {
+		creds = credentials.NewTLS(opts.TLS)
+	}
+	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+	return &GRPCStation{
+		ID:      id,
+		Target:  target,
+		conn:    conn,
+		client:  stationv1.NewStationClient(conn),
+		health:  healthpb.NewHealthClient(conn),
+		options: opts,
+		logger:  logger.With("station_id", id, "remote", true, "protocol", "grpc"),
+	}, nil
+}
+
+func (s *GRPCStation) GetID() types.StationID {
+	return s.ID
+}
+
+// SetProvenance 设置配置中声明的设备实例、固件版本和每件消耗的物料，需要在注册工站之前调用
+func (s *GRPCStation) SetProvenance(p types.Provenance) {
+	s.declared = p
+}
+
+// Close 关闭到远程服务的连接
+func (s *GRPCStation) Close() error {
+	return s.conn.Close()
+}
+
+// Execute 调用远程工站的 Execute 方法，调用失败时返回设备缺陷
+func (s *GRPCStation) Execute(ctx context.Context, p *types.Product) types.Result {
+	logger := s.logger
+	if traceID, ok := util.TraceIDFromContext(ctx); ok {
+		logger = logger.With("trace_id", traceID)
+	}
+	logger.Info("请求处理工件", "product_id", p.ID)
+
+	var resp *stationv1.ExecuteResponse
+	err := s.call(ctx, "Execute", p, logger, func(ctx context.Context) error {
+		var err error
+		resp, err = s.client.Execute(ctx, &stationv1.ExecuteRequest{StationId: string(s.ID), ProductId: p.ID, Serial: p.Serial})
+		return err
+	})
+	if err != nil {
+		logger.Error("远程调用失败", "error", err, "product_id", p.ID)
+		d := callDefect(err)
+		return types.Result{ProductID: p.ID, Success: false, Error: d, Defect: d}
+	}
+	rResp := fromProto(resp)
+	return remoteResult(s.ID, p, rResp, mergeProvenance(s.declared, rResp, s.Target), logger)
+}
+
+// Compensate 调用远程工站的 Compensate 方法，调用失败时返回错误
+func (s *GRPCStation) Compensate(ctx context.Context, p *types.Product) error {
+	logger := s.logger
+	if traceID, ok := util.TraceIDFromContext(ctx); ok {
+		logger = logger.With("trace_id", traceID)
+	}
+	logger.Warn("请求补偿", "product_id", p.ID)
+
+	err := s.call(ctx, "Compensate", p, logger, func(ctx context.Context) error {
+		_, err := s.client.Compensate(ctx, &stationv1.CompensateRequest{StationId: string(s.ID), ProductId: p.ID, Serial: p.Serial})
+		return err
+	})
+	if err != nil {
+		logger.Error("远程补偿调用失败", "error", err, "product_id", p.ID)
+		return fmt.Errorf("远程补偿调用失败: %v", err)
+	}
+	return nil
+}
+
+// Ping 通过 grpc.health.v1.Health 查询工站的状态，远程服务不可达或工站不是 SERVING 时返回错误
+func (s *GRPCStation) Ping(ctx context.Context) error {
+	resp, err := s.health.Check(s.outgoing(ctx), &healthpb.HealthCheckRequest{Service: string(s.ID)})
+	if err != nil {
+		return err
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("健康检查返回状态: %s", resp.GetStatus())
+	}
+	return nil
+}
+
+// call 以单次调用的超时执行 invoke，工站不可达或停机 (Unavailable) 和加工位已满 (ResourceExhausted) 按重试策略重试
+// 其余错误表示远程工站已经处理了请求，直接返回，避免重复加工
+func (s *GRPCStation) call(ctx context.Context, method string, p *types.Product, logger *slog.Logger, invoke func(context.Context) error) error {
+	backoff := s.options.Backoff
+	for attempt := 1; ; attempt++ {
+		callCtx, cancel := context.WithTimeout(s.outgoing(ctx), s.options.Timeout)
+		err := invoke(callCtx)
+		cancel()
+		if err == nil || attempt >= s.options.MaxAttempts || !retryableCode(err) || ctx.Err() != nil {
+			return err
+		}
+		logger.Warn("远程调用失败，准备重试", "method", method, "attempt", attempt, "backoff", backoff, "error", err, "product_id", p.ID)
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// outgoing 将 Trace ID 和令牌放入调用的元数据：x-trace-id 供远程工站记录日志，
+// traceparent (W3C Trace Context) 供追踪系统关联调用，每次调用使用新的 Span ID
+func (s *GRPCStation) outgoing(ctx context.Context) context.Context {
+	var kv []string
+	if traceID, ok := util.TraceIDFromContext(ctx); ok {
+		kv = append(kv, "x-trace-id", traceID)
+		if tp := util.Traceparent(traceID, util.NewSpanID()); tp != "" {
+			kv = append(kv, "traceparent", tp)
+		}
+	}
+	if s.options.BearerToken != "" {
+		kv = append(kv, "authorization", "Bearer "+s.options.BearerToken)
+	}
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
+
+// retryableCode 判断一次 gRPC 调用的失败是否可以重试
+func retryableCode(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
+
+// callDefect 将调用失败转换为设备缺陷：不可达和超时归为通信故障，其余为远程服务错误
+func callDefect(err error) *types.Defect {
+	st := status.Convert(err)
+	switch st.Code() {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Canceled:
+		return defect.Equipment("EQ-COMM", fmt.Sprintf("远程调用失败: %s", st.Message()))
+	}
+	return defect.Equipment("EQ-REMOTE", fmt.Sprintf("远程服务错误: %s: %s", st.Code(), st.Message()))
+}
+
+// fromProto 将 gRPC 响应转换为与 HTTP 协议相同的加工结果
+func fromProto(r *stationv1.ExecuteResponse) remoteResponse {
+	resp := remoteResponse{
+		ProductID: r.GetProductId(),
+		Success:   r.GetSuccess(),
+		Error:     r.GetError(),
+		Machine:   r.GetMachine(),
+		Firmware:  r.GetFirmware(),
+	}
+	if d := r.GetDefect(); d != nil {
+		resp.Defect = &types.Defect{Category: d.GetCategory(), Code: d.GetCode(), Description: d.GetDescription(), Disposition: d.GetDisposition()}
+	}
+	for _, m := range r.GetMeasurements() {
+		resp.Measurements = append(resp.Measurements, types.Measurement{Name: m.GetName(), Value: m.GetValue(), Unit: m.GetUnit(), LSL: m.Lsl, USL: m.Usl})
+	}
+	for _, m := range r.GetMaterials() {
+		resp.Materials = append(resp.Materials, types.MaterialUsage{Name: m.GetName(), Lot: m.GetLot(), Quantity: m.GetQuantity(), Unit: m.GetUnit()})
+	}
+	return resp
+}
@@ -3,30 +3,96 @@ package station
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"industrial-4.0-demo/internal/defect"
 	"industrial-4.0-demo/internal/types"
 	"industrial-4.0-demo/internal/util"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 )
 
+// DefaultRemoteTimeout 是远程调用的默认超时
+const DefaultRemoteTimeout = 20 * time.Second
+
+// DefaultPollInterval 是异步模式下查询作业状态的默认间隔
+const DefaultPollInterval = 500 * time.Millisecond
+
+// RemoteOptions 定义远程工站的连接参数，零值字段使用默认值
+type RemoteOptions struct {
+	Timeout     time.Duration // 单次调用的超时，0 表示使用 DefaultRemoteTimeout
+	MaxAttempts int           // 调用失败时最多尝试的次数 (含第一次)，<= 1 表示不重试
+	Backoff     time.Duration // 第一次重试前的等待时间，之后每次翻倍
+	TLS         *tls.Config   // HTTPS 连接的 TLS 配置 (CA、客户端证书)，为 nil 时使用系统默认配置
+	BearerToken string        // 不为空时携带 Authorization: Bearer 请求头
+	Username    string        // 不为空时使用 HTTP Basic 认证
+	Password    string
+	// Async 为 true 时以 Prefer: respond-async 提交加工，远程工站返回 202 和作业后轮询 /jobs/{id} 直到作业结束，
+	// 加工耗时不再受单次调用超时的限制；远程工站不支持异步时仍按同步响应处理
+	Async        bool
+	PollInterval time.Duration // 查询作业状态的间隔，0 表示使用 DefaultPollInterval
+}
+
+// Remote 是通过网络调用的远程工站，编排器定期调用 Ping 做健康检查，RemoteStation 和 GRPCStation 都实现了该接口
+type Remote interface {
+	Station
+	Ping(ctx context.Context) error
+	SetProvenance(p types.Provenance)
+}
+
+var (
+	_ Remote = (*RemoteStation)(nil)
+	_ Remote = (*GRPCStation)(nil)
+)
+
+// NewRemote 按 endpoint 的协议创建远程工站：grpc://host:port 和 grpcs://host:port 使用 gRPC (grpcs 使用 TLS)，
+// http(s) 地址使用 HTTP+JSON
+func NewRemote(id types.StationID, endpoint string, opts RemoteOptions, logger *slog.Logger) (Remote, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "grpc" && u.Scheme != "grpcs") {
+		return NewRemoteStation(id, endpoint, opts, logger), nil
+	}
+	if u.Scheme == "grpcs" && opts.TLS == nil {
+		opts.TLS = &tls.Config{}
+	}
+	return NewGRPCStation(id, u.Host, opts, logger)
+}
+
 // RemoteStation 代表一个通过 HTTP 调用的远程工站客户端
 // 它实现了 Station 接口，使得引擎层可以像对待本地工站一样对待它
 type RemoteStation struct {
 	ID       types.StationID // 工站 ID
 	Endpoint string          // 远程服务的地址 (e.g., http://localhost:9090)
 	Client   *http.Client    // HTTP 客户端
-	logger   *slog.Logger    // 日志记录器
+	options  RemoteOptions
+	logger   *slog.Logger     // 日志记录器
+	declared types.Provenance // 配置中声明的设备、固件和物料，远程服务在响应中返回时以响应为准
 }
 
 // NewRemoteStation 创建一个新的远程工站实例
-func NewRemoteStation(id types.StationID, endpoint string, logger *slog.Logger) Station {
+func NewRemoteStation(id types.StationID, endpoint string, opts RemoteOptions, logger *slog.Logger) *RemoteStation {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultRemoteTimeout
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	client := &http.Client{Timeout: opts.Timeout}
+	if opts.TLS != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = opts.TLS
+		client.Transport = transport
+	}
 	return &RemoteStation{
 		ID:       id,
-		Endpoint: endpoint,
-		Client:   &http.Client{Timeout: 20 * time.Second}, // BUG FIX: 增加超时时间到 20 秒
+		Endpoint: strings.TrimSuffix(endpoint, "/"),
+		Client:   client,
+		options:  opts,
 		logger:   logger.With("station_id", id, "remote", true),
 	}
 }
@@ -35,19 +101,58 @@ func (s *RemoteStation) GetID() types.StationID {
 	return s.ID
 }
 
+// SetProvenance 设置配置中声明的设备实例、固件版本和每件消耗的物料，需要在注册工站之前调用
+func (s *RemoteStation) SetProvenance(p types.Provenance) {
+	s.declared = p
+}
+
+// mergeProvenance 合并配置声明和远程服务返回的追溯信息，设备实例都为空时使用远程服务的地址
+func mergeProvenance(declared types.Provenance, r remoteResponse, endpoint string) types.Provenance {
+	p := declared
+	if r.Machine != "" {
+		p.Machine = r.Machine
+	}
+	if r.Firmware != "" {
+		p.Firmware = r.Firmware
+	}
+	if len(r.Materials) > 0 {
+		p.Materials = r.Materials
+	}
+	if p.Machine == "" {
+		p.Machine = endpoint
+	}
+	return p
+}
+
 // remoteRequest 定义了发送到远程服务的请求体
 type remoteRequest struct {
-	ID string `json:"id"`
+	ID     string `json:"id"`
+	Serial string `json:"serial,omitempty"` // 工件标签上的序列号，远程工站可用于核对扫描到的条码
 }
 
 // remoteResponse 定义了从远程服务接收的响应体
 type remoteResponse struct {
-	ProductID string `json:"product_id"`
-	Success   bool   `json:"success"`
-	Error     string `json:"error,omitempty"`
+	ProductID    string                `json:"product_id"`
+	Success      bool                  `json:"success"`
+	Error        string                `json:"error,omitempty"`
+	Defect       *types.Defect         `json:"defect,omitempty"`       // 失败时远程工站判定的缺陷
+	Measurements []types.Measurement   `json:"measurements,omitempty"` // 远程工站采集的测量值
+	Machine      string                `json:"machine,omitempty"`      // 执行加工的设备实例
+	Firmware     string                `json:"firmware,omitempty"`     // 设备的固件版本
+	Materials    []types.MaterialUsage `json:"materials,omitempty"`    // 消耗的物料
 }
 
-// Execute 通过 HTTP POST 请求调用远程工站的 /execute 端点
+// remoteJob 是异步模式下远程工站返回的作业
+type remoteJob struct {
+	ID     string          `json:"id"`
+	Status string          `json:"status"` // running / completed
+	Result *remoteResponse `json:"result,omitempty"`
+}
+
+// jobCompleted 是远程作业结束时的状态
+const jobCompleted = "completed"
+
+// Execute 通过 HTTP POST 请求调用远程工站的 /execute 端点，异步模式下等待远程作业结束
 func (s *RemoteStation) Execute(ctx context.Context, p *types.Product) types.Result {
 	logger := s.logger
 	if traceID, ok := util.TraceIDFromContext(ctx); ok {
@@ -55,59 +160,215 @@ func (s *RemoteStation) Execute(ctx context.Context, p *types.Product) types.Res
 	}
 	logger.Info("请求处理工件", "product_id", p.ID)
 
-	reqBody, _ := json.Marshal(remoteRequest{ID: p.ID})
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", s.Endpoint+"/execute", bytes.NewBuffer(reqBody))
-	if err != nil {
-		logger.Error("创建远程请求失败", "error", err, "product_id", p.ID)
-		return types.Result{ProductID: p.ID, Success: false, Error: err}
+	rResp, d := s.execute(ctx, p, logger)
+	if d != nil {
+		return types.Result{ProductID: p.ID, Success: false, Error: d, Defect: d}
 	}
-	httpReq.Header.Set("Content-Type", "application/json")
-	// 将 Trace ID 放入 HTTP Header 中，实现跨服务追踪
-	if traceID, ok := util.TraceIDFromContext(ctx); ok {
-		httpReq.Header.Set("X-Trace-ID", traceID)
+	return remoteResult(s.ID, p, rResp, mergeProvenance(s.declared, rResp, s.Endpoint), logger)
+}
+
+// remoteResult 将远程工站返回的加工结果转换为工站任务的结果，HTTP 和 gRPC 协议共用
+func remoteResult(id types.StationID, p *types.Product, rResp remoteResponse, provenance types.Provenance, logger *slog.Logger) types.Result {
+	if !rResp.Success {
+		// 远程工站没有返回缺陷代码时按错误信息归为未分类
+		d := rResp.Defect
+		if d == nil {
+			d = defect.Classify(errors.New(rResp.Error))
+		}
+		logger.Warn("远程工件处理失败", "remote_error", rResp.Error, "defect_code", d.Code, "product_id", p.ID)
+		return types.Result{ProductID: p.ID, Success: false, Error: d, Defect: d, Measurements: rResp.Measurements, Provenance: provenance}
 	}
 
-	resp, err := s.Client.Do(httpReq)
+	p.History = append(p.History, string(id)+"(Remote)")
+	logger.Info("远程工件处理成功", "product_id", p.ID)
+	return types.Result{ProductID: p.ID, Success: true, Measurements: rResp.Measurements, Provenance: provenance}
+}
+
+// execute 调用远程工站的 /execute 端点并返回加工结果，调用失败时返回设备缺陷
+func (s *RemoteStation) execute(ctx context.Context, p *types.Product, logger *slog.Logger) (remoteResponse, *types.Defect) {
+	resp, err := s.post(ctx, "/execute", p, logger)
 	if err != nil {
 		logger.Error("远程调用失败", "error", err, "product_id", p.ID)
-		return types.Result{ProductID: p.ID, Success: false, Error: fmt.Errorf("远程调用失败: %v", err)}
+		return remoteResponse{}, defect.Equipment("EQ-COMM", fmt.Sprintf("远程调用失败: %v", err))
 	}
 	defer resp.Body.Close()
 
+	if s.options.Async && resp.StatusCode == http.StatusAccepted {
+		var job remoteJob
+		if err := json.NewDecoder(resp.Body).Decode(&job); err != nil || job.ID == "" {
+			logger.Error("解析远程作业失败", "error", err, "product_id", p.ID)
+			return remoteResponse{}, defect.Equipment("EQ-PROTOCOL", fmt.Sprintf("解析作业失败: %v", err))
+		}
+		return s.await(ctx, p, job, logger)
+	}
 	if resp.StatusCode != http.StatusOK {
 		logger.Error("远程服务返回错误状态", "status", resp.Status, "product_id", p.ID)
-		return types.Result{ProductID: p.ID, Success: false, Error: fmt.Errorf("远程服务错误: %s", resp.Status)}
+		return remoteResponse{}, defect.Equipment("EQ-REMOTE", fmt.Sprintf("远程服务错误: %s", resp.Status))
 	}
 
 	var rResp remoteResponse
 	if err := json.NewDecoder(resp.Body).Decode(&rResp); err != nil {
 		logger.Error("解析远程响应失败", "error", err, "product_id", p.ID)
-		return types.Result{ProductID: p.ID, Success: false, Error: fmt.Errorf("解析响应失败: %v", err)}
+		return remoteResponse{}, defect.Equipment("EQ-PROTOCOL", fmt.Sprintf("解析响应失败: %v", err))
 	}
+	return rResp, nil
+}
 
-	if !rResp.Success {
-		logger.Warn("远程工件处理失败", "remote_error", rResp.Error, "product_id", p.ID)
-		return types.Result{ProductID: p.ID, Success: false, Error: fmt.Errorf(rResp.Error)}
+// await 每隔 PollInterval 查询一次远程作业，直到作业结束或 ctx 结束
+// 网络错误和可重试的状态码继续轮询，作业不存在 (远程工站重启或已清理) 时返回缺陷
+func (s *RemoteStation) await(ctx context.Context, p *types.Product, job remoteJob, logger *slog.Logger) (remoteResponse, *types.Defect) {
+	logger = logger.With("job_id", job.ID)
+	logger.Info("远程工站已接受作业", "product_id", p.ID)
+	ticker := time.NewTicker(s.options.PollInterval)
+	defer ticker.Stop()
+	for job.Status != jobCompleted {
+		select {
+		case <-ctx.Done():
+			logger.Error("等待远程作业时取消", "error", ctx.Err(), "product_id", p.ID)
+			return remoteResponse{}, defect.Equipment("EQ-COMM", fmt.Sprintf("等待远程作业失败: %v", ctx.Err()))
+		case <-ticker.C:
+		}
+		httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, s.Endpoint+"/jobs/"+job.ID, nil)
+		if err != nil {
+			return remoteResponse{}, defect.Equipment("EQ-COMM", fmt.Sprintf("查询远程作业失败: %v", err))
+		}
+		setTrace(ctx, httpReq)
+		s.authorize(httpReq)
+		resp, err := s.Client.Do(httpReq)
+		if err != nil || retryable(resp, nil) {
+			if err == nil {
+				resp.Body.Close()
+				err = errors.New(resp.Status)
+			}
+			logger.Warn("查询远程作业失败，继续轮询", "error", err, "product_id", p.ID)
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			logger.Error("查询远程作业返回错误状态", "status", resp.Status, "product_id", p.ID)
+			if resp.StatusCode == http.StatusNotFound {
+				return remoteResponse{}, defect.Equipment("EQ-REMOTE", "远程作业不存在: "+job.ID)
+			}
+			return remoteResponse{}, defect.Equipment("EQ-REMOTE", fmt.Sprintf("远程服务错误: %s", resp.Status))
+		}
+		err = json.NewDecoder(resp.Body).Decode(&job)
+		resp.Body.Close()
+		if err != nil {
+			logger.Error("解析远程作业失败", "error", err, "product_id", p.ID)
+			return remoteResponse{}, defect.Equipment("EQ-PROTOCOL", fmt.Sprintf("解析作业失败: %v", err))
+		}
 	}
-
-	p.History = append(p.History, string(s.ID)+"(Remote)")
-	logger.Info("远程工件处理成功", "product_id", p.ID)
-	return types.Result{ProductID: p.ID, Success: true}
+	if job.Result == nil {
+		return remoteResponse{}, defect.Equipment("EQ-PROTOCOL", "远程作业缺少结果: "+job.ID)
+	}
+	return *job.Result, nil
 }
 
-// Compensate 通过 HTTP POST 请求调用远程工站的 /compensate 端点
-func (s *RemoteStation) Compensate(ctx context.Context, p *types.Product) {
+// Compensate 通过 HTTP POST 请求调用远程工站的 /compensate 端点，调用失败或远程服务返回错误状态时返回错误
+func (s *RemoteStation) Compensate(ctx context.Context, p *types.Product) error {
 	logger := s.logger
 	if traceID, ok := util.TraceIDFromContext(ctx); ok {
 		logger = logger.With("trace_id", traceID)
 	}
 	logger.Warn("请求补偿", "product_id", p.ID)
 
-	reqBody, _ := json.Marshal(remoteRequest{ID: p.ID})
-	httpReq, _ := http.NewRequestWithContext(ctx, "POST", s.Endpoint+"/compensate", bytes.NewBuffer(reqBody))
-	httpReq.Header.Set("Content-Type", "application/json")
-	if traceID, ok := util.TraceIDFromContext(ctx); ok {
-		httpReq.Header.Set("X-Trace-ID", traceID)
+	resp, err := s.post(ctx, "/compensate", p, logger)
+	if err != nil {
+		logger.Error("远程补偿调用失败", "error", err, "product_id", p.ID)
+		return fmt.Errorf("远程补偿调用失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		logger.Error("远程补偿返回错误状态", "status", resp.Status, "product_id", p.ID)
+		return fmt.Errorf("远程补偿错误: %s", resp.Status)
+	}
+	return nil
+}
+
+// Ping 调用远程工站的 /healthz 端点，远程服务不可达或返回非 200 状态时返回错误
+func (s *RemoteStation) Ping(ctx context.Context) error {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, s.Endpoint+"/healthz", nil)
+	if err != nil {
+		return err
+	}
+	s.authorize(httpReq)
+	resp, err := s.Client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("健康检查返回错误状态: %s", resp.Status)
+	}
+	return nil
+}
+
+// post 向远程工站发送一个工件请求，网络错误、加工位已满和网关类错误 (429 / 502 / 503 / 504) 按重试策略重试
+// 其余状态码 (包括 500) 表示远程工站已经处理了请求，直接返回给调用方，避免重复加工
+func (s *RemoteStation) post(ctx context.Context, path string, p *types.Product, logger *slog.Logger) (*http.Response, error) {
+	reqBody, _ := json.Marshal(remoteRequest{ID: p.ID, Serial: p.Serial})
+	backoff := s.options.Backoff
+	for attempt := 1; ; attempt++ {
+		httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, s.Endpoint+path, bytes.NewReader(reqBody))
+		if err != nil {
+			return nil, err
+		}
+		httpReq.Header.Set("Content-Type", "application/json")
+		if s.options.Async && path == "/execute" {
+			httpReq.Header.Set("Prefer", "respond-async")
+		}
+		setTrace(ctx, httpReq)
+		s.authorize(httpReq)
+
+		resp, err := s.Client.Do(httpReq)
+		if attempt >= s.options.MaxAttempts || !retryable(resp, err) || ctx.Err() != nil {
+			return resp, err
+		}
+		if err == nil {
+			resp.Body.Close()
+			err = errors.New(resp.Status)
+		}
+		logger.Warn("远程调用失败，准备重试", "path", path, "attempt", attempt, "backoff", backoff, "error", err, "product_id", p.ID)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// setTrace 将 Trace ID 放入请求头，实现跨服务追踪：X-Trace-ID 供远程工站记录日志，
+// traceparent (W3C Trace Context) 供 OpenTelemetry 等追踪系统关联调用，每次调用使用新的 Span ID
+func setTrace(ctx context.Context, req *http.Request) {
+	traceID, ok := util.TraceIDFromContext(ctx)
+	if !ok {
+		return
+	}
+	req.Header.Set("X-Trace-ID", traceID)
+	if tp := util.Traceparent(traceID, util.NewSpanID()); tp != "" {
+		req.Header.Set("traceparent", tp)
+	}
+}
+
+// authorize 按配置为请求添加认证信息
+func (s *RemoteStation) authorize(req *http.Request) {
+	switch {
+	case s.options.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+s.options.BearerToken)
+	case s.options.Username != "":
+		req.SetBasicAuth(s.options.Username, s.options.Password)
+	}
+}
+
+// retryable 判断一次调用的失败是否可以重试
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
 	}
-	_, _ = s.Client.Do(httpReq)
+	return false
 }
@@ -2,7 +2,7 @@ package station
 
 import (
 	"context"
-	"fmt"
+	"industrial-4.0-demo/internal/defect"
 	"industrial-4.0-demo/internal/types"
 	"industrial-4.0-demo/internal/util"
 	"log/slog"
@@ -14,22 +14,26 @@ import (
 type Station interface {
 	GetID() types.StationID
 	Execute(ctx context.Context, p *types.Product) types.Result
-	Compensate(ctx context.Context, p *types.Product)
+	Compensate(ctx context.Context, p *types.Product) error // 返回错误表示补偿未能完成，工件在该工站上可能残留状态
 }
 
 // LocalStation 代表一个在本地模拟的工站
 type LocalStation struct {
-	ID      types.StationID
-	logger  *slog.Logger
-	delayMs int
+	ID          types.StationID
+	logger      *slog.Logger
+	delayMs     int
+	failureRate float64 // 随机加工失败的概率 (0 ~ 1)，模拟检测不通过
+	specs       []types.MeasurementSpec
+	provenance  types.Provenance // 每次加工记录的设备、固件和消耗的物料
 }
 
-// NewStation 创建一个新的本地工站实例
-func NewStation(id types.StationID, logger *slog.Logger, delayMs int) Station {
+// NewStation 创建一个新的本地工站实例，failureRate 为 0 时工站总是加工成功
+func NewStation(id types.StationID, logger *slog.Logger, delayMs int, failureRate float64) *LocalStation {
 	return &LocalStation{
-		ID:      id,
-		logger:  logger.With("station_id", id),
-		delayMs: delayMs,
+		ID:          id,
+		logger:      logger.With("station_id", id),
+		delayMs:     delayMs,
+		failureRate: failureRate,
 	}
 }
 
@@ -37,6 +41,36 @@ func (s *LocalStation) GetID() types.StationID {
 	return s.ID
 }
 
+// SetMeasurements 设置工站每次加工采集的测量项，需要在注册工站之前调用
+func (s *LocalStation) SetMeasurements(specs []types.MeasurementSpec) {
+	s.specs = specs
+}
+
+// SetProvenance 设置工站每次加工记录的设备实例、固件版本和每件消耗的物料，需要在注册工站之前调用
+// 设备实例为空时使用工站 ID
+func (s *LocalStation) SetProvenance(p types.Provenance) {
+	s.provenance = p
+}
+
+// Measure 按测量项模拟一次测量：以目标值为中心、规格宽度的 1/8 为标准差的正态分布，对应过程能力 Cp ≈ 1.33
+func Measure(specs []types.MeasurementSpec) []types.Measurement {
+	if len(specs) == 0 {
+		return nil
+	}
+	measurements := make([]types.Measurement, len(specs))
+	for i, spec := range specs {
+		lsl, usl := spec.LSL, spec.USL
+		measurements[i] = types.Measurement{
+			Name:  spec.Name,
+			Value: spec.Nominal + rand.NormFloat64()*(usl-lsl)/8,
+			Unit:  spec.Unit,
+			LSL:   &lsl,
+			USL:   &usl,
+		}
+	}
+	return measurements
+}
+
 // Execute 模拟物理工站的动作执行
 func (s *LocalStation) Execute(ctx context.Context, p *types.Product) types.Result {
 	logger := s.logger
@@ -53,21 +87,26 @@ func (s *LocalStation) Execute(ctx context.Context, p *types.Product) types.Resu
 		processTime = time.Duration(s.delayMs+rand.Intn(s.delayMs/2)) * time.Millisecond
 	}
 	time.Sleep(processTime)
+	measurements := Measure(s.specs)
+	provenance := s.provenance
+	if provenance.Machine == "" {
+		provenance.Machine = string(s.ID)
+	}
 
-	if s.ID == types.StationETest {
-		if rand.Float32() < 0.05 {
-			logger.Warn("工件电测失败", "product_id", p.ID)
-			return types.Result{ProductID: p.ID, Success: false, Error: fmt.Errorf("电测未通过")}
-		}
+	// 随机失败时从工站的缺陷目录中判定一个缺陷
+	if s.failureRate > 0 && rand.Float64() < s.failureRate {
+		d := defect.Random(s.ID)
+		logger.Warn("工件加工失败", "product_id", p.ID, "defect_code", d.Code, "category", d.Category)
+		return types.Result{ProductID: p.ID, Success: false, Error: d, Defect: d, Measurements: measurements, Provenance: provenance}
 	}
 
 	p.History = append(p.History, string(s.ID))
 	logger.Info("工件处理完成", "product_id", p.ID, "duration", processTime.Seconds())
-	return types.Result{ProductID: p.ID, Success: true}
+	return types.Result{ProductID: p.ID, Success: true, Measurements: measurements, Provenance: provenance}
 }
 
 // Compensate 模拟补偿逻辑（回滚动作）
-func (s *LocalStation) Compensate(ctx context.Context, p *types.Product) {
+func (s *LocalStation) Compensate(ctx context.Context, p *types.Product) error {
 	logger := s.logger
 	if traceID, ok := util.TraceIDFromContext(ctx); ok {
 		logger = logger.With("trace_id", traceID)
@@ -82,4 +121,5 @@ func (s *LocalStation) Compensate(ctx context.Context, p *types.Product) {
 		compensateTime = 1500 * time.Millisecond // 生产演示时保持 1.5s
 	}
 	time.Sleep(compensateTime)
+	return nil
 }
@@ -0,0 +1,611 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: station/v1/station.proto
+
+// 远程工站的 gRPC 协议，与 HTTP+JSON 协议的 /execute 和 /compensate 一一对应
+// Trace ID 通过 x-trace-id 和 traceparent 元数据传递，令牌通过 authorization: Bearer <token> 元数据传递；
+// 工站的在线状态通过标准的 grpc.health.v1.Health 服务查询，服务名为工站 ID
+
+package stationv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ExecuteRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	StationId     string                 `protobuf:"bytes,1,opt,name=station_id,json=stationId,proto3" json:"station_id,omitempty"` // 工站 ID，一个服务提供多个工站时据此区分，为空时使用服务的默认工站
+	ProductId     string                 `protobuf:"bytes,2,opt,name=product_id,json=productId,proto3" json:"product_id,omitempty"`
+	Serial        string                 `protobuf:"bytes,3,opt,name=serial,proto3" json:"serial,omitempty"` // 工件标签上的序列号，远程工站可用于核对扫描到的条码
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExecuteRequest) Reset() {
+	*x = ExecuteRequest{}
+	mi := &file_station_v1_station_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExecuteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExecuteRequest) ProtoMessage() {}
+
+func (x *ExecuteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_station_v1_station_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExecuteRequest.ProtoReflect.Descriptor instead.
+func (*ExecuteRequest) Descriptor() ([]byte, []int) {
+	return file_station_v1_station_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ExecuteRequest) GetStationId() string {
+	if x != nil {
+		return x.StationId
+	}
+	return ""
+}
+
+func (x *ExecuteRequest) GetProductId() string {
+	if x != nil {
+		return x.ProductId
+	}
+	return ""
+}
+
+func (x *ExecuteRequest) GetSerial() string {
+	if x != nil {
+		return x.Serial
+	}
+	return ""
+}
+
+// Defect 是工站判定的缺陷
+type Defect struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Category      string                 `protobuf:"bytes,1,opt,name=category,proto3" json:"category,omitempty"` // 缺陷类别，例如 electrical / drilling / equipment
+	Code          string                 `protobuf:"bytes,2,opt,name=code,proto3" json:"code,omitempty"`         // 缺陷代码，例如 ET-OPEN
+	Description   string                 `protobuf:"bytes,3,opt,name=description,proto3" json:"description,omitempty"`
+	Disposition   string                 `protobuf:"bytes,4,opt,name=disposition,proto3" json:"disposition,omitempty"` // scrap / rework / hold
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Defect) Reset() {
+	*x = Defect{}
+	mi := &file_station_v1_station_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Defect) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Defect) ProtoMessage() {}
+
+func (x *Defect) ProtoReflect() protoreflect.Message {
+	mi := &file_station_v1_station_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Defect.ProtoReflect.Descriptor instead.
+func (*Defect) Descriptor() ([]byte, []int) {
+	return file_station_v1_station_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Defect) GetCategory() string {
+	if x != nil {
+		return x.Category
+	}
+	return ""
+}
+
+func (x *Defect) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *Defect) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *Defect) GetDisposition() string {
+	if x != nil {
+		return x.Disposition
+	}
+	return ""
+}
+
+// Measurement 是工站加工时采集的一项质量测量值
+type Measurement struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Value         float64                `protobuf:"fixed64,2,opt,name=value,proto3" json:"value,omitempty"`
+	Unit          string                 `protobuf:"bytes,3,opt,name=unit,proto3" json:"unit,omitempty"`
+	Lsl           *float64               `protobuf:"fixed64,4,opt,name=lsl,proto3,oneof" json:"lsl,omitempty"` // 规格下限，未设置时不检查
+	Usl           *float64               `protobuf:"fixed64,5,opt,name=usl,proto3,oneof" json:"usl,omitempty"` // 规格上限，未设置时不检查
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Measurement) Reset() {
+	*x = Measurement{}
+	mi := &file_station_v1_station_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Measurement) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Measurement) ProtoMessage() {}
+
+func (x *Measurement) ProtoReflect() protoreflect.Message {
+	mi := &file_station_v1_station_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Measurement.ProtoReflect.Descriptor instead.
+func (*Measurement) Descriptor() ([]byte, []int) {
+	return file_station_v1_station_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Measurement) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Measurement) GetValue() float64 {
+	if x != nil {
+		return x.Value
+	}
+	return 0
+}
+
+func (x *Measurement) GetUnit() string {
+	if x != nil {
+		return x.Unit
+	}
+	return ""
+}
+
+func (x *Measurement) GetLsl() float64 {
+	if x != nil && x.Lsl != nil {
+		return *x.Lsl
+	}
+	return 0
+}
+
+func (x *Measurement) GetUsl() float64 {
+	if x != nil && x.Usl != nil {
+		return *x.Usl
+	}
+	return 0
+}
+
+// MaterialUsage 是加工一件工件消耗的物料
+type MaterialUsage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Lot           string                 `protobuf:"bytes,2,opt,name=lot,proto3" json:"lot,omitempty"` // 物料批号
+	Quantity      float64                `protobuf:"fixed64,3,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	Unit          string                 `protobuf:"bytes,4,opt,name=unit,proto3" json:"unit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MaterialUsage) Reset() {
+	*x = MaterialUsage{}
+	mi := &file_station_v1_station_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MaterialUsage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MaterialUsage) ProtoMessage() {}
+
+func (x *MaterialUsage) ProtoReflect() protoreflect.Message {
+	mi := &file_station_v1_station_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MaterialUsage.ProtoReflect.Descriptor instead.
+func (*MaterialUsage) Descriptor() ([]byte, []int) {
+	return file_station_v1_station_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *MaterialUsage) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *MaterialUsage) GetLot() string {
+	if x != nil {
+		return x.Lot
+	}
+	return ""
+}
+
+func (x *MaterialUsage) GetQuantity() float64 {
+	if x != nil {
+		return x.Quantity
+	}
+	return 0
+}
+
+func (x *MaterialUsage) GetUnit() string {
+	if x != nil {
+		return x.Unit
+	}
+	return ""
+}
+
+type ExecuteResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ProductId     string                 `protobuf:"bytes,1,opt,name=product_id,json=productId,proto3" json:"product_id,omitempty"`
+	Success       bool                   `protobuf:"varint,2,opt,name=success,proto3" json:"success,omitempty"`
+	Error         string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`               // 失败原因
+	Defect        *Defect                `protobuf:"bytes,4,opt,name=defect,proto3" json:"defect,omitempty"`             // 失败时判定的缺陷
+	Measurements  []*Measurement         `protobuf:"bytes,5,rep,name=measurements,proto3" json:"measurements,omitempty"` // 采集的测量值
+	Machine       string                 `protobuf:"bytes,6,opt,name=machine,proto3" json:"machine,omitempty"`           // 执行加工的设备实例
+	Firmware      string                 `protobuf:"bytes,7,opt,name=firmware,proto3" json:"firmware,omitempty"`         // 设备的固件版本
+	Materials     []*MaterialUsage       `protobuf:"bytes,8,rep,name=materials,proto3" json:"materials,omitempty"`       // 消耗的物料
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExecuteResponse) Reset() {
+	*x = ExecuteResponse{}
+	mi := &file_station_v1_station_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExecuteResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExecuteResponse) ProtoMessage() {}
+
+func (x *ExecuteResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_station_v1_station_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExecuteResponse.ProtoReflect.Descriptor instead.
+func (*ExecuteResponse) Descriptor() ([]byte, []int) {
+	return file_station_v1_station_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ExecuteResponse) GetProductId() string {
+	if x != nil {
+		return x.ProductId
+	}
+	return ""
+}
+
+func (x *ExecuteResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *ExecuteResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *ExecuteResponse) GetDefect() *Defect {
+	if x != nil {
+		return x.Defect
+	}
+	return nil
+}
+
+func (x *ExecuteResponse) GetMeasurements() []*Measurement {
+	if x != nil {
+		return x.Measurements
+	}
+	return nil
+}
+
+func (x *ExecuteResponse) GetMachine() string {
+	if x != nil {
+		return x.Machine
+	}
+	return ""
+}
+
+func (x *ExecuteResponse) GetFirmware() string {
+	if x != nil {
+		return x.Firmware
+	}
+	return ""
+}
+
+func (x *ExecuteResponse) GetMaterials() []*MaterialUsage {
+	if x != nil {
+		return x.Materials
+	}
+	return nil
+}
+
+type CompensateRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	StationId     string                 `protobuf:"bytes,1,opt,name=station_id,json=stationId,proto3" json:"station_id,omitempty"` // 工站 ID，为空时使用服务的默认工站
+	ProductId     string                 `protobuf:"bytes,2,opt,name=product_id,json=productId,proto3" json:"product_id,omitempty"`
+	Serial        string                 `protobuf:"bytes,3,opt,name=serial,proto3" json:"serial,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CompensateRequest) Reset() {
+	*x = CompensateRequest{}
+	mi := &file_station_v1_station_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CompensateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CompensateRequest) ProtoMessage() {}
+
+func (x *CompensateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_station_v1_station_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CompensateRequest.ProtoReflect.Descriptor instead.
+func (*CompensateRequest) Descriptor() ([]byte, []int) {
+	return file_station_v1_station_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *CompensateRequest) GetStationId() string {
+	if x != nil {
+		return x.StationId
+	}
+	return ""
+}
+
+func (x *CompensateRequest) GetProductId() string {
+	if x != nil {
+		return x.ProductId
+	}
+	return ""
+}
+
+func (x *CompensateRequest) GetSerial() string {
+	if x != nil {
+		return x.Serial
+	}
+	return ""
+}
+
+type CompensateResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CompensateResponse) Reset() {
+	*x = CompensateResponse{}
+	mi := &file_station_v1_station_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CompensateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CompensateResponse) ProtoMessage() {}
+
+func (x *CompensateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_station_v1_station_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CompensateResponse.ProtoReflect.Descriptor instead.
+func (*CompensateResponse) Descriptor() ([]byte, []int) {
+	return file_station_v1_station_proto_rawDescGZIP(), []int{6}
+}
+
+var File_station_v1_station_proto protoreflect.FileDescriptor
+
+const file_station_v1_station_proto_rawDesc = "" +
+	"\n" +
+	"\x18station/v1/station.proto\x12\n" +
+	"station.v1\"f\n" +
+	"\x0eExecuteRequest\x12\x1d\n" +
+	"\n" +
+	"station_id\x18\x01 \x01(\tR\tstationId\x12\x1d\n" +
+	"\n" +
+	"product_id\x18\x02 \x01(\tR\tproductId\x12\x16\n" +
+	"\x06serial\x18\x03 \x01(\tR\x06serial\"|\n" +
+	"\x06Defect\x12\x1a\n" +
+	"\bcategory\x18\x01 \x01(\tR\bcategory\x12\x12\n" +
+	"\x04code\x18\x02 \x01(\tR\x04code\x12 \n" +
+	"\vdescription\x18\x03 \x01(\tR\vdescription\x12 \n" +
+	"\vdisposition\x18\x04 \x01(\tR\vdisposition\"\x89\x01\n" +
+	"\vMeasurement\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x01R\x05value\x12\x12\n" +
+	"\x04unit\x18\x03 \x01(\tR\x04unit\x12\x15\n" +
+	"\x03lsl\x18\x04 \x01(\x01H\x00R\x03lsl\x88\x01\x01\x12\x15\n" +
+	"\x03usl\x18\x05 \x01(\x01H\x01R\x03usl\x88\x01\x01B\x06\n" +
+	"\x04_lslB\x06\n" +
+	"\x04_usl\"e\n" +
+	"\rMaterialUsage\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x10\n" +
+	"\x03lot\x18\x02 \x01(\tR\x03lot\x12\x1a\n" +
+	"\bquantity\x18\x03 \x01(\x01R\bquantity\x12\x12\n" +
+	"\x04unit\x18\x04 \x01(\tR\x04unit\"\xb8\x02\n" +
+	"\x0fExecuteResponse\x12\x1d\n" +
+	"\n" +
+	"product_id\x18\x01 \x01(\tR\tproductId\x12\x18\n" +
+	"\asuccess\x18\x02 \x01(\bR\asuccess\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\x12*\n" +
+	"\x06defect\x18\x04 \x01(\v2\x12.station.v1.DefectR\x06defect\x12;\n" +
+	"\fmeasurements\x18\x05 \x03(\v2\x17.station.v1.MeasurementR\fmeasurements\x12\x18\n" +
+	"\amachine\x18\x06 \x01(\tR\amachine\x12\x1a\n" +
+	"\bfirmware\x18\a \x01(\tR\bfirmware\x127\n" +
+	"\tmaterials\x18\b \x03(\v2\x19.station.v1.MaterialUsageR\tmaterials\"i\n" +
+	"\x11CompensateRequest\x12\x1d\n" +
+	"\n" +
+	"station_id\x18\x01 \x01(\tR\tstationId\x12\x1d\n" +
+	"\n" +
+	"product_id\x18\x02 \x01(\tR\tproductId\x12\x16\n" +
+	"\x06serial\x18\x03 \x01(\tR\x06serial\"\x14\n" +
+	"\x12CompensateResponse2\x9a\x01\n" +
+	"\aStation\x12B\n" +
+	"\aExecute\x12\x1a.station.v1.ExecuteRequest\x1a\x1b.station.v1.ExecuteResponse\x12K\n" +
+	"\n" +
+	"Compensate\x12\x1d.station.v1.CompensateRequest\x1a\x1e.station.v1.CompensateResponseB:Z8industrial-4.0-demo/internal/station/stationv1;stationv1b\x06proto3"
+
+var (
+	file_station_v1_station_proto_rawDescOnce sync.Once
+	file_station_v1_station_proto_rawDescData []byte
+)
+
+func file_station_v1_station_proto_rawDescGZIP() []byte {
+	file_station_v1_station_proto_rawDescOnce.Do(func() {
+		file_station_v1_station_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_station_v1_station_proto_rawDesc), len(file_station_v1_station_proto_rawDesc)))
+	})
+	return file_station_v1_station_proto_rawDescData
+}
+
+var file_station_v1_station_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_station_v1_station_proto_goTypes = []any{
+	(*ExecuteRequest)(nil),     // 0: station.v1.ExecuteRequest
+	(*Defect)(nil),             // 1: station.v1.Defect
+	(*Measurement)(nil),        // 2: station.v1.Measurement
+	(*MaterialUsage)(nil),      // 3: station.v1.MaterialUsage
+	(*ExecuteResponse)(nil),    // 4: station.v1.ExecuteResponse
+	(*CompensateRequest)(nil),  // 5: station.v1.CompensateRequest
+	(*CompensateResponse)(nil), // 6: station.v1.CompensateResponse
+}
+var file_station_v1_station_proto_depIdxs = []int32{
+	1, // 0: station.v1.ExecuteResponse.defect:type_name -> station.v1.Defect
+	2, // 1: station.v1.ExecuteResponse.measurements:type_name -> station.v1.Measurement
+	3, // 2: station.v1.ExecuteResponse.materials:type_name -> station.v1.MaterialUsage
+	0, // 3: station.v1.Station.Execute:input_type -> station.v1.ExecuteRequest
+	5, // 4: station.v1.Station.Compensate:input_type -> station.v1.CompensateRequest
+	4, // 5: station.v1.Station.Execute:output_type -> station.v1.ExecuteResponse
+	6, // 6: station.v1.Station.Compensate:output_type -> station.v1.CompensateResponse
+	5, // [5:7] is the sub-list for method output_type
+	3, // [3:5] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_station_v1_station_proto_init() }
+func file_station_v1_station_proto_init() {
+	if File_station_v1_station_proto != nil {
+		return
+	}
+	file_station_v1_station_proto_msgTypes[2].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_station_v1_station_proto_rawDesc), len(file_station_v1_station_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   7,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_station_v1_station_proto_goTypes,
+		DependencyIndexes: file_station_v1_station_proto_depIdxs,
+		MessageInfos:      file_station_v1_station_proto_msgTypes,
+	}.Build()
+	File_station_v1_station_proto = out.File
+	file_station_v1_station_proto_goTypes = nil
+	file_station_v1_station_proto_depIdxs = nil
+}
@@ -0,0 +1,131 @@
+package stationsim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"industrial-4.0-demo/internal/types"
+	"net/http"
+)
+
+// errStationDown 是工站被设置为宕机时加工、补偿和健康检查返回的错误
+var errStationDown = errors.New("station is down")
+
+// Fault 是运行时对一个工站行为的覆盖，通过管理接口设置，重启后失效；零值表示按 profile 运行
+type Fault struct {
+	FailureRate    *float64 `json:"failure_rate,omitempty"`     // 覆盖 profile 的失败率 (0 ~ 1)
+	LatencyMs      *int     `json:"latency_ms,omitempty"`       // 固定的加工耗时，覆盖 delay_ms 和 jitter_ms
+	ExtraLatencyMs int      `json:"extra_latency_ms,omitempty"` // 在加工和补偿耗时之上增加的延迟
+	Down           bool     `json:"down,omitempty"`             // 模拟宕机：加工、补偿和健康检查都返回 503
+}
+
+// validate 检查覆盖的取值范围
+func (f Fault) validate() error {
+	switch {
+	case f.FailureRate != nil && (*f.FailureRate < 0 || *f.FailureRate > 1):
+		return errors.New("failure_rate must be between 0 and 1")
+	case f.LatencyMs != nil && *f.LatencyMs < 0:
+		return errors.New("latency_ms must not be negative")
+	case f.ExtraLatencyMs < 0:
+		return errors.New("extra_latency_ms must not be negative")
+	}
+	return nil
+}
+
+// SetFault 设置工站的运行时覆盖，替换之前的覆盖；零值等同于 ClearFault
+func (s *Server) SetFault(id types.StationID, f Fault) error {
+	if _, ok := s.stations[id]; !ok {
+		return fmt.Errorf("unknown station: %s", id)
+	}
+	if err := f.validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f == (Fault{}) {
+		delete(s.faults, id)
+	} else {
+		s.faults[id] = f
+	}
+	return nil
+}
+
+// ClearFault 清除工站的运行时覆盖，id 为空时清除所有工站的覆盖
+func (s *Server) ClearFault(id types.StationID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id == "" {
+		clear(s.faults)
+		return
+	}
+	delete(s.faults, id)
+}
+
+// effective 返回应用运行时覆盖后的 profile，以及工站是否被设置为宕机
+func (s *Server) effective(id types.StationID) (Profile, bool) {
+	profile := s.stations[id]
+	s.mu.Lock()
+	f, ok := s.faults[id]
+	s.mu.Unlock()
+	if !ok {
+		return profile, false
+	}
+	if f.FailureRate != nil {
+		profile.FailureRate = *f.FailureRate
+	}
+	if f.LatencyMs != nil {
+		profile.DelayMs, profile.JitterMs = *f.LatencyMs, 0
+	}
+	profile.DelayMs += f.ExtraLatencyMs
+	profile.CompensateMs += f.ExtraLatencyMs
+	return profile, f.Down
+}
+
+// down 判断工站是否被设置为宕机，宕机时写入 503 并返回 true
+func (s *Server) down(w http.ResponseWriter, id types.StationID) bool {
+	if _, down := s.effective(id); !down {
+		return false
+	}
+	w.Header().Set("Retry-After", "5")
+	http.Error(w, errStationDown.Error(), http.StatusServiceUnavailable)
+	return true
+}
+
+// handleAdmin 注册管理接口：查询工站及其覆盖，设置和清除覆盖
+func (s *Server) handleAdmin(mux *http.ServeMux) {
+	mux.HandleFunc("GET /admin/stations", s.requireToken(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.Stations())
+	}))
+	mux.HandleFunc("PUT /admin/stations/{id}/fault", s.requireToken(s.byPath(s.putFault)))
+	mux.HandleFunc("DELETE /admin/stations/{id}/fault", s.requireToken(s.byPath(func(w http.ResponseWriter, r *http.Request, id types.StationID) {
+		s.ClearFault(id)
+		s.logger.Info("已清除工站的运行时覆盖", "station_id", id)
+		w.WriteHeader(http.StatusNoContent)
+	})))
+	mux.HandleFunc("DELETE /admin/faults", s.requireToken(func(w http.ResponseWriter, r *http.Request) {
+		s.ClearFault("")
+		s.logger.Info("已清除所有工站的运行时覆盖")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+// putFault 设置工站的运行时覆盖并返回工站
+func (s *Server) putFault(w http.ResponseWriter, r *http.Request, id types.StationID) {
+	var f Fault
+	if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.SetFault(id, f); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body, _ := json.Marshal(f)
+	s.logger.Info("已设置工站的运行时覆盖", "station_id", id, "fault", string(body))
+	for _, info := range s.Stations() {
+		if info.ID == id {
+			writeJSON(w, http.StatusOK, info)
+			return
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package stationsim
+
+import (
+	"context"
+	"crypto/subtle"
+	"industrial-4.0-demo/internal/station/stationv1"
+	"industrial-4.0-demo/internal/types"
+	"log/slog"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// RegisterGRPC 在 gRPC 服务上注册工站服务 (station.v1.Station) 和健康检查服务 (grpc.health.v1.Health)
+// gRPC 与 HTTP 共用加工位、运行时覆盖、停机和指标；gRPC 只支持同步加工，不创建作业
+func (s *Server) RegisterGRPC(registrar grpc.ServiceRegistrar) {
+	stationv1.RegisterStationServer(registrar, &grpcStation{s: s})
+	healthpb.RegisterHealthServer(registrar, &grpcHealth{s: s})
+}
+
+// grpcStation 实现 station.v1.Station
+type grpcStation struct {
+	stationv1.UnimplementedStationServer
+	s *Server
+}
+
+// Execute 占用一个加工位后同步加工并返回结果
+func (g *grpcStation) Execute(ctx context.Context, in *stationv1.ExecuteRequest) (*stationv1.ExecuteResponse, error) {
+	s := g.s
+	id, err := s.resolveGRPC(ctx, in.GetStationId())
+	if err != nil {
+		return nil, err
+	}
+	req := Request{ID: in.GetProductId(), Serial: in.GetSerial()}
+	logger, traceID := s.grpcLogger(ctx, id, req)
+	if _, down := s.effective(id); down {
+		logger.Warn("工站已设置为宕机，拒绝任务")
+		s.metrics.rejected.WithLabelValues(string(id), rejectDown).Inc()
+		return nil, status.Error(codes.Unavailable, errStationDown.Error())
+	}
+	switch err := s.reserve(id); err {
+	case errAtCapacity:
+		s.metrics.rejected.WithLabelValues(string(id), rejectCapacity).Inc()
+		logger.Warn("加工位已满，拒绝任务", "capacity", s.stations[id].Capacity)
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	case errDraining:
+		s.metrics.rejected.WithLabelValues(string(id), rejectDraining).Inc()
+		logger.Warn("服务正在停机，拒绝任务")
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	logger.Info("接收到任务", "protocol", "grpc")
+	defer s.inflight.Done()
+	defer s.release(id)
+	resp, ok := s.process(ctx, id, req, traceID, logger)
+	if !ok {
+		logger.Warn("调用方已断开，放弃加工")
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+	return toProto(resp), nil
+}
+
+// Compensate 按 profile 等待补偿耗时
+func (g *grpcStation) Compensate(ctx context.Context, in *stationv1.CompensateRequest) (*stationv1.CompensateResponse, error) {
+	s := g.s
+	id, err := s.resolveGRPC(ctx, in.GetStationId())
+	if err != nil {
+		return nil, err
+	}
+	logger, _ := s.grpcLogger(ctx, id, Request{ID: in.GetProductId(), Serial: in.GetSerial()})
+	profile, down := s.effective(id)
+	if down {
+		logger.Warn("工站已设置为宕机，拒绝补偿")
+		return nil, status.Error(codes.Unavailable, errStationDown.Error())
+	}
+	logger.Warn("执行补偿", "protocol", "grpc")
+	if !sleep(ctx, time.Duration(profile.CompensateMs)*time.Millisecond) {
+		logger.Warn("调用方已断开，补偿未完成")
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+	s.metrics.compensations.WithLabelValues(string(id)).Inc()
+	return &stationv1.CompensateResponse{}, nil
+}
+
+// resolveGRPC 校验调用的令牌并返回请求的工站，为空时使用默认工站
+func (s *Server) resolveGRPC(ctx context.Context, stationID string) (types.StationID, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	got := strings.TrimPrefix(first(md, "authorization"), "Bearer ")
+	if s.token != "" && subtle.ConstantTimeCompare([]byte(got), []byte(s.token)) != 1 {
+		return "", status.Error(codes.Unauthenticated, "unauthorized")
+	}
+	id := types.StationID(strings.ToUpper(stationID))
+	if id == "" {
+		id = s.opts.DefaultStation
+	}
+	if _, ok := s.stations[id]; !ok {
+		return "", status.Errorf(codes.NotFound, "unknown station: %s", id)
+	}
+	return id, nil
+}
+
+// grpcLogger 按元数据中的 traceparent 和 x-trace-id 返回日志记录器和 Trace ID
+func (s *Server) grpcLogger(ctx context.Context, id types.StationID, req Request) (*slog.Logger, string) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return s.traceLogger(id, req, first(md, "traceparent"), first(md, "x-trace-id"))
+}
+
+// first 返回元数据中键的第一个值
+func first(md metadata.MD, key string) string {
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// toProto 将加工结果转换为 gRPC 响应
+func toProto(resp Response) *stationv1.ExecuteResponse {
+	out := &stationv1.ExecuteResponse{
+		ProductId: resp.ProductID,
+		Success:   resp.Success,
+		Error:     resp.Error,
+		Machine:   resp.Machine,
+		Firmware:  resp.Firmware,
+	}
+	if d := resp.Defect; d != nil {
+		out.Defect = &stationv1.Defect{Category: d.Category, Code: d.Code, Description: d.Description, Disposition: d.Disposition}
+	}
+	for _, m := range resp.Measurements {
+		out.Measurements = append(out.Measurements, &stationv1.Measurement{Name: m.Name, Value: m.Value, Unit: m.Unit, Lsl: m.LSL, Usl: m.USL})
+	}
+	for _, m := range resp.Materials {
+		out.Materials = append(out.Materials, &stationv1.MaterialUsage{Name: m.Name, Lot: m.Lot, Quantity: m.Quantity, Unit: m.Unit})
+	}
+	return out
+}
+
+// grpcHealth 实现 grpc.health.v1.Health：服务名为空时返回整个服务的状态，停机期间为 NOT_SERVING；
+// 服务名为工站 ID 时返回工站的状态，工站宕机时为 NOT_SERVING，不是模拟的工站返回 NotFound
+type grpcHealth struct {
+	healthpb.UnimplementedHealthServer
+	s *Server
+}
+
+// Check 返回服务或工站的健康状态
+func (g *grpcHealth) Check(ctx context.Context, in *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	h := g.s.Health()
+	serving := h.Status == "ok"
+	if in.GetService() != "" {
+		id := types.StationID(strings.ToUpper(in.GetService()))
+		up, ok := h.Stations[id]
+		if !ok {
+			return nil, status.Errorf(codes.NotFound, "unknown station: %s", id)
+		}
+		serving = serving && up == "up"
+	}
+	if !serving {
+		return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_NOT_SERVING}, nil
+	}
+	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+}
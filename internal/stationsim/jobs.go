@@ -0,0 +1,218 @@
+package stationsim
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"industrial-4.0-demo/internal/types"
+	"industrial-4.0-demo/internal/util"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// 作业的状态
+const (
+	JobRunning   = "running"   // 正在加工
+	JobCompleted = "completed" // 加工结束，结果在 Result 中，Result.Success 表示是否加工成功
+)
+
+// 作业的保留和回调参数
+const (
+	maxFinishedJobs  = 1000            // 保留的已结束作业数，超出时丢弃最早结束的作业
+	callbackAttempts = 3               // 回调最多尝试的次数
+	callbackBackoff  = time.Second     // 回调失败后的重试间隔
+	callbackTimeout  = 5 * time.Second // 单次回调的超时
+)
+
+// Job 是一次异步加工，由 POST /execute (Prefer: respond-async) 创建，通过 GET /jobs/{id} 查询
+type Job struct {
+	ID          string          `json:"id"`
+	StationID   types.StationID `json:"station_id"`
+	ProductID   string          `json:"product_id"`
+	Serial      string          `json:"serial,omitempty"`
+	TraceID     string          `json:"trace_id,omitempty"`
+	CallbackURL string          `json:"callback_url,omitempty"` // 加工结束后以 POST 发送作业的地址
+	Status      string          `json:"status"`                 // running / completed
+	Result      *Response       `json:"result,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	FinishedAt  time.Time       `json:"finished_at,omitzero"`
+	// Recovered 表示作业在服务重启后从状态文件中恢复，进行中的作业重启后重新加工
+	Recovered bool `json:"recovered,omitempty"`
+	// CallbackDelivered 表示回调已成功发送，重启时重新发送未成功的回调
+	CallbackDelivered bool `json:"callback_delivered,omitempty"`
+}
+
+// 占用加工位失败的原因
+var (
+	errAtCapacity = errors.New("station is at capacity")
+	errDraining   = errors.New("station server is shutting down")
+)
+
+// Job 返回作业，作业不存在或已被清理时返回 false
+func (s *Server) Job(id string) (Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// Jobs 返回保留的作业，按创建时间从新到旧排列
+func (s *Server) Jobs() []Job {
+	s.mu.Lock()
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, *job)
+	}
+	s.mu.Unlock()
+	slices.SortFunc(jobs, func(a, b Job) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	return jobs
+}
+
+// reserve 为工站占用一个加工位并登记一个进行中的加工，工站已达到 capacity 或服务正在停机时返回错误
+// 加工结束后调用方需要调用 release 释放加工位，并调用 s.inflight.Done
+func (s *Server) reserve(id types.StationID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.draining {
+		return errDraining
+	}
+	if capacity := s.stations[id].Capacity; capacity > 0 && s.busy[id] >= capacity {
+		return errAtCapacity
+	}
+	s.busy[id]++
+	s.inflight.Add(1)
+	s.metrics.inFlight.WithLabelValues(string(id)).Inc()
+	return nil
+}
+
+// release 释放工站的一个加工位
+func (s *Server) release(id types.StationID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.busy[id]--
+	s.metrics.inFlight.WithLabelValues(string(id)).Dec()
+}
+
+// startJob 创建作业并在后台加工，作业结束时释放加工位；调用方需要先占用加工位
+func (s *Server) startJob(id types.StationID, req Request, traceID string, logger *slog.Logger) Job {
+	job := &Job{
+		ID:          newJobID(),
+		StationID:   id,
+		ProductID:   req.ID,
+		Serial:      req.Serial,
+		TraceID:     traceID,
+		CallbackURL: req.CallbackURL,
+		Status:      JobRunning,
+		CreatedAt:   time.Now(),
+	}
+	s.mu.Lock()
+	s.jobs[job.ID] = job
+	snapshot := *job
+	s.mu.Unlock()
+	s.save()
+
+	go s.run(job, req, logger.With("job_id", job.ID))
+	return snapshot
+}
+
+// run 在后台加工作业，结束后释放加工位并发送回调
+// 停机超时时加工被取消，作业保持 running 状态保存在状态文件中，重启后重新加工
+func (s *Server) run(job *Job, req Request, logger *slog.Logger) {
+	defer s.inflight.Done()
+	resp, ok := s.process(s.base, job.StationID, req, job.TraceID, logger)
+	if !ok {
+		s.release(job.StationID)
+		logger.Warn("停机时作业未完成，重启后恢复")
+		return
+	}
+	snapshot := s.finish(job, resp)
+	s.release(job.StationID)
+	if snapshot.CallbackURL != "" {
+		s.callback(job, snapshot, logger)
+	}
+}
+
+// finish 记录作业的结果，清理多余的已结束作业，返回结束后的作业
+func (s *Server) finish(job *Job, resp Response) Job {
+	s.mu.Lock()
+	job.Status, job.Result, job.FinishedAt = JobCompleted, &resp, time.Now()
+	snapshot := *job
+	s.finished = append(s.finished, job.ID)
+	if n := len(s.finished) - maxFinishedJobs; n > 0 {
+		for _, id := range s.finished[:n] {
+			delete(s.jobs, id)
+		}
+		s.finished = slices.Delete(s.finished, 0, n)
+	}
+	s.mu.Unlock()
+	s.save()
+	return snapshot
+}
+
+// callback 以 POST 将结束的作业发送到回调地址，网络错误和非 2xx 响应时重试，成功后记录到作业
+// 停机时放弃重试，未成功的回调在重启后重新发送
+func (s *Server) callback(job *Job, snapshot Job, logger *slog.Logger) {
+	body, _ := json.Marshal(snapshot)
+	client := &http.Client{Timeout: callbackTimeout}
+	for attempt := 1; ; attempt++ {
+		err := postCallback(s.base, client, snapshot, body)
+		if err == nil {
+			logger.Info("已回调作业结果", "callback_url", snapshot.CallbackURL)
+			s.metrics.callbacks.WithLabelValues(resultSuccess).Inc()
+			s.mu.Lock()
+			job.CallbackDelivered = true
+			s.mu.Unlock()
+			s.save()
+			return
+		}
+		if attempt >= callbackAttempts {
+			logger.Warn("回调作业结果失败", "callback_url", snapshot.CallbackURL, "error", err)
+			s.metrics.callbacks.WithLabelValues(resultFailed).Inc()
+			return
+		}
+		if !sleep(s.base, callbackBackoff) {
+			logger.Warn("停机时回调未完成，重启后重新发送", "callback_url", snapshot.CallbackURL)
+			return
+		}
+	}
+}
+
+// postCallback 发送一次回调
+func postCallback(ctx context.Context, client *http.Client, job Job, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, job.CallbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if job.TraceID != "" {
+		req.Header.Set("X-Trace-ID", job.TraceID)
+		if tp := util.Traceparent(job.TraceID, util.NewSpanID()); tp != "" {
+			req.Header.Set("traceparent", tp)
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("callback returned %s", resp.Status)
+	}
+	return nil
+}
+
+// newJobID 生成随机的作业 ID
+func newJobID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "job-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,105 @@
+package stationsim
+
+import (
+	"industrial-4.0-demo/internal/metrics"
+	"industrial-4.0-demo/internal/types"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// 加工结果，用于 remote_station_executions_total 的 result 标签
+const (
+	resultSuccess = "success" // 加工成功
+	resultFailed  = "failed"  // 判定缺陷
+	resultAborted = "aborted" // 调用方断开或停机时加工未完成
+)
+
+// 拒绝加工的原因，用于 remote_station_rejected_total 的 reason 标签
+const (
+	rejectCapacity = "capacity" // 加工位已满
+	rejectDraining = "draining" // 服务正在停机
+	rejectDown     = "down"     // 工站被设置为宕机
+)
+
+// serverMetrics 是模拟服务的 Prometheus 指标，注册在每个 Server 自己的注册表上，同一进程中的多个 Server (例如测试) 互不影响
+type serverMetrics struct {
+	registry *prometheus.Registry
+
+	// executions 计数器：结束的加工次数，按工站和结果 (success / failed / aborted) 分类
+	executions *prometheus.CounterVec
+	// failures 计数器：判定缺陷的加工次数，按工站和缺陷代码分类
+	failures *prometheus.CounterVec
+	// duration 直方图：加工耗时分布，附带 trace_id 和 product_id 作为 exemplar
+	duration *prometheus.HistogramVec
+	// inFlight 仪表盘：正在加工的工件数 (同步和异步合计)，与 capacity 对比可以看出加工位的占用
+	inFlight *prometheus.GaugeVec
+	// rejected 计数器：被拒绝的加工请求，按工站和原因 (capacity / draining / down) 分类
+	rejected *prometheus.CounterVec
+	// compensations 计数器：完成的补偿次数
+	compensations *prometheus.CounterVec
+	// callbacks 计数器：作业回调的结果 (success / failed)
+	callbacks *prometheus.CounterVec
+}
+
+// newServerMetrics 创建指标并注册到新的注册表，同时注册 Go 运行时和进程指标
+func newServerMetrics() *serverMetrics {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	f := promauto.With(reg)
+	return &serverMetrics{
+		registry: reg,
+		executions: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "remote_station_executions_total",
+			Help: "The total number of finished executions by station and result",
+		}, []string{"station_id", "result"}),
+		failures: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "remote_station_failures_total",
+			Help: "The total number of executions that found a defect, by station and defect code",
+		}, []string{"station_id", "defect_code"}),
+		duration: f.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "remote_station_processing_duration_seconds",
+			Help:    "Time spent processing a product in the simulated station",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"station_id"}),
+		inFlight: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "remote_station_in_flight",
+			Help: "The number of products currently being processed",
+		}, []string{"station_id"}),
+		rejected: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "remote_station_rejected_total",
+			Help: "The total number of rejected execute requests by station and reason",
+		}, []string{"station_id", "reason"}),
+		compensations: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "remote_station_compensations_total",
+			Help: "The total number of completed compensations",
+		}, []string{"station_id"}),
+		callbacks: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "remote_station_job_callbacks_total",
+			Help: "The total number of job callback deliveries by result",
+		}, []string{"result"}),
+	}
+}
+
+// observe 记录一次结束的加工
+func (m *serverMetrics) observe(station types.StationID, resp Response, seconds float64, traceID string) {
+	id := string(station)
+	switch {
+	case resp.Success:
+		m.executions.WithLabelValues(id, resultSuccess).Inc()
+	default:
+		m.executions.WithLabelValues(id, resultFailed).Inc()
+		if resp.Defect != nil {
+			m.failures.WithLabelValues(id, resp.Defect.Code).Inc()
+		}
+	}
+	metrics.ObserveWithTrace(m.duration.WithLabelValues(id), seconds, traceID, resp.ProductID)
+}
+
+// handler 返回 Prometheus 指标接口，抓取方协商 OpenMetrics 格式时输出直方图的 exemplar (Trace ID)
+func (m *serverMetrics) handler() http.Handler {
+	return promhttp.InstrumentMetricHandler(m.registry, promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{EnableOpenMetrics: true}))
+}
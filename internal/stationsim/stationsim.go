@@ -0,0 +1,422 @@
+// Package stationsim 实现远程工站模拟服务 (cmd/station-server)：一个进程按配置中的 profile 模拟多个远程工站，
+// 协议与 station.RemoteStation 一致。每个工站以 /stations/{id}/ 为前缀提供 execute、compensate、jobs 和 healthz，
+// 也可以在 profile 中配置单独的监听地址，以不带前缀的路径提供服务
+//
+// 加工请求默认同步返回结果；请求带有 Prefer: respond-async 时立即返回 202 和作业，
+// 调用方轮询 GET /jobs/{id}，或者在请求中给出 callback_url，加工结束后由服务回调。
+// 每个工站同时加工的工件数受 capacity 限制，加工位已满时返回 429
+//
+// /admin 下的管理接口在运行时覆盖工站的失败率和加工耗时，或者将工站设置为宕机，无需重启即可编排容错演示
+//
+// 配置了 grpc_addr 时同时以 gRPC 协议 (proto/station/v1/station.proto) 提供所有工站，与 station.GRPCStation 对应
+package stationsim
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"industrial-4.0-demo/internal/defect"
+	"industrial-4.0-demo/internal/station"
+	"industrial-4.0-demo/internal/types"
+	"industrial-4.0-demo/internal/util"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options 定义模拟服务和模拟的工站
+type Options struct {
+	Addr           string                      `mapstructure:"addr"`            // 监听地址
+	GRPCAddr       string                      `mapstructure:"grpc_addr"`       // gRPC 服务的监听地址，为空时不提供 gRPC 协议
+	DefaultStation types.StationID             `mapstructure:"default_station"` // 不带前缀的 /execute 和 /compensate 对应的工站，兼容只模拟 AOI 的旧部署
+	Stations       map[types.StationID]Profile `mapstructure:"stations"`        // 模拟的工站及其行为
+	// 保存异步作业的状态文件，重启后恢复作业，为空时不保存
+	StateFile              string `mapstructure:"state_file"`
+	ShutdownTimeoutSeconds int    `mapstructure:"shutdown_timeout_seconds"` // 停机时等待进行中的加工和回调结束的最长时间
+}
+
+// Profile 定义一个模拟工站的行为
+type Profile struct {
+	Addr         string                  `mapstructure:"addr"`          // 不为空时额外在该地址以不带前缀的路径单独提供这个工站
+	Capacity     int                     `mapstructure:"capacity"`      // 同时加工的工件数上限，加工位已满时返回 429，0 表示不限
+	DelayMs      int                     `mapstructure:"delay_ms"`      // 加工耗时的下限
+	JitterMs     int                     `mapstructure:"jitter_ms"`     // 在 delay_ms 之上随机增加的耗时上限
+	FailureRate  float64                 `mapstructure:"failure_rate"`  // 随机加工失败的概率，失败时从工站的缺陷目录中判定缺陷
+	CompensateMs int                     `mapstructure:"compensate_ms"` // 补偿耗时
+	Machine      string                  `mapstructure:"machine"`       // 设备实例，为空时使用服务的默认设备实例
+	Firmware     string                  `mapstructure:"firmware"`      // 固件版本
+	Materials    []types.MaterialUsage   `mapstructure:"materials"`     // 每件消耗的物料
+	Measurements []types.MeasurementSpec `mapstructure:"measurements"`  // 每次加工返回的测量项
+}
+
+// Request 是加工和补偿的请求体
+type Request struct {
+	ID          string `json:"id"`
+	Serial      string `json:"serial,omitempty"`       // 工件标签上的序列号，与扫描到的条码核对
+	CallbackURL string `json:"callback_url,omitempty"` // 异步加工结束后以 POST 发送作业的地址
+}
+
+// Response 是加工的响应体
+type Response struct {
+	ProductID    string                `json:"product_id"`
+	Success      bool                  `json:"success"`
+	Error        string                `json:"error,omitempty"`
+	Defect       *types.Defect         `json:"defect,omitempty"`       // 失败时判定的缺陷
+	Measurements []types.Measurement   `json:"measurements,omitempty"` // 采集的测量值
+	Machine      string                `json:"machine,omitempty"`      // 执行加工的设备实例，编排器记录到工件的追溯文档
+	Firmware     string                `json:"firmware,omitempty"`     // 设备的固件版本
+	Materials    []types.MaterialUsage `json:"materials,omitempty"`    // 消耗的物料
+}
+
+// StationInfo 是 GET /stations 返回的一个模拟工站
+type StationInfo struct {
+	ID      types.StationID `json:"id"`
+	Profile Profile         `json:"profile"`         // 配置的 profile
+	Fault   *Fault          `json:"fault,omitempty"` // 运行时覆盖，未设置时为空
+	Busy    int             `json:"busy"`            // 正在加工的工件数
+}
+
+// Server 是远程工站模拟服务
+type Server struct {
+	opts     Options
+	token    string
+	stations map[types.StationID]Profile
+	logger   *slog.Logger
+
+	mu       sync.Mutex
+	jobs     map[string]*Job
+	finished []string                // 已结束的作业，按结束顺序排列，用于清理
+	busy     map[types.StationID]int // 每个工站正在加工的工件数
+	faults   map[types.StationID]Fault
+	metrics  *serverMetrics
+	draining bool // 正在停机，拒绝新的加工请求
+
+	inflight sync.WaitGroup     // 进行中的加工和回调
+	base     context.Context    // 异步作业的加工和回调使用的 context，停机超时时取消
+	stop     context.CancelFunc // 取消 base
+	saveMu   sync.Mutex         // 串行写入状态文件
+}
+
+// New 创建模拟服务，machine 是没有配置设备实例的工站使用的设备实例 (默认为主机名)
+// token 不为空时加工和补偿请求需要携带 Authorization: Bearer <token>
+func New(opts Options, machine, token string, logger *slog.Logger) *Server {
+	if machine == "" {
+		machine, _ = os.Hostname()
+	}
+	stations := make(map[types.StationID]Profile, len(opts.Stations))
+	for id, profile := range opts.Stations {
+		if profile.Machine == "" {
+			profile.Machine = machine
+		}
+		stations[id] = profile
+	}
+	base, stop := context.WithCancel(context.Background())
+	return &Server{
+		opts:     opts,
+		token:    token,
+		stations: stations,
+		logger:   logger,
+		jobs:     make(map[string]*Job),
+		busy:     make(map[types.StationID]int),
+		faults:   make(map[types.StationID]Fault),
+		metrics:  newServerMetrics(),
+		base:     base,
+		stop:     stop,
+	}
+}
+
+// Stations 返回模拟的工站及其运行时覆盖，按 ID 排序
+func (s *Server) Stations() []StationInfo {
+	s.mu.Lock()
+	infos := make([]StationInfo, 0, len(s.stations))
+	for id, profile := range s.stations {
+		info := StationInfo{ID: id, Profile: profile, Busy: s.busy[id]}
+		if f, ok := s.faults[id]; ok {
+			info.Fault = &f
+		}
+		infos = append(infos, info)
+	}
+	s.mu.Unlock()
+	slices.SortFunc(infos, func(a, b StationInfo) int { return strings.Compare(string(a.ID), string(b.ID)) })
+	return infos
+}
+
+// Handler 返回主监听地址上的路由：所有工站的 /stations/{id}/ 前缀路径、工站列表，以及默认工站的不带前缀路径
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /stations", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.Stations())
+	})
+	mux.HandleFunc("POST /stations/{id}/execute", s.requireToken(s.byPath(s.execute)))
+	mux.HandleFunc("POST /stations/{id}/compensate", s.requireToken(s.byPath(s.compensate)))
+	mux.HandleFunc("GET /stations/{id}/jobs/{job}", s.requireToken(s.byPath(s.getJob)))
+	mux.HandleFunc("GET /stations/{id}/healthz", s.byPath(s.healthz))
+	mux.HandleFunc("GET /jobs", s.requireToken(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.Jobs())
+	}))
+	mux.HandleFunc("GET /jobs/{job}", s.requireToken(func(w http.ResponseWriter, r *http.Request) { s.getJob(w, r, "") }))
+	s.handleAdmin(mux)
+	mux.Handle("GET /metrics", s.metrics.handler())
+	mux.HandleFunc("GET /healthz", s.serverHealthz)
+	if _, ok := s.stations[s.opts.DefaultStation]; ok {
+		s.handleStation(mux, s.opts.DefaultStation)
+	}
+	return mux
+}
+
+// StationHandler 返回单个工站的路由，不带前缀的 /execute、/compensate 和 /healthz 都对应该工站
+func (s *Server) StationHandler(id types.StationID) http.Handler {
+	mux := http.NewServeMux()
+	s.handleStation(mux, id)
+	mux.HandleFunc("GET /jobs/{job}", s.requireToken(func(w http.ResponseWriter, r *http.Request) { s.getJob(w, r, id) }))
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) { s.healthz(w, r, id) })
+	return mux
+}
+
+// handleStation 以不带前缀的路径注册一个工站的加工和补偿
+func (s *Server) handleStation(mux *http.ServeMux, id types.StationID) {
+	mux.HandleFunc("POST /execute", s.requireToken(func(w http.ResponseWriter, r *http.Request) { s.execute(w, r, id) }))
+	mux.HandleFunc("POST /compensate", s.requireToken(func(w http.ResponseWriter, r *http.Request) { s.compensate(w, r, id) }))
+}
+
+// byPath 从路径中取出工站 ID，不是模拟的工站时返回 404
+func (s *Server) byPath(next func(http.ResponseWriter, *http.Request, types.StationID)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := types.StationID(strings.ToUpper(r.PathValue("id")))
+		if _, ok := s.stations[id]; !ok {
+			http.Error(w, "unknown station: "+string(id), http.StatusNotFound)
+			return
+		}
+		next(w, r, id)
+	}
+}
+
+// execute 处理加工请求：占用一个加工位后同步加工并返回结果，或者创建异步作业并返回 202
+func (s *Server) execute(w http.ResponseWriter, r *http.Request, id types.StationID) {
+	var req Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.logger.Warn("解析请求失败", "station_id", id, "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.CallbackURL != "" {
+		if u, err := url.Parse(req.CallbackURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			http.Error(w, "invalid callback_url: "+req.CallbackURL, http.StatusBadRequest)
+			return
+		}
+	}
+	logger, traceID := s.requestLogger(r, id, req)
+	if s.down(w, id) {
+		logger.Warn("工站已设置为宕机，拒绝任务")
+		s.metrics.rejected.WithLabelValues(string(id), rejectDown).Inc()
+		return
+	}
+	switch err := s.reserve(id); err {
+	case errAtCapacity:
+		s.metrics.rejected.WithLabelValues(string(id), rejectCapacity).Inc()
+		logger.Warn("加工位已满，拒绝任务", "capacity", s.stations[id].Capacity)
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	case errDraining:
+		s.metrics.rejected.WithLabelValues(string(id), rejectDraining).Inc()
+		logger.Warn("服务正在停机，拒绝任务")
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	logger.Info("接收到任务")
+
+	if strings.Contains(r.Header.Get("Prefer"), "respond-async") {
+		job := s.startJob(id, req, traceID, logger)
+		w.Header().Set("Location", "/jobs/"+job.ID)
+		writeJSON(w, http.StatusAccepted, job)
+		return
+	}
+	defer s.inflight.Done()
+	defer s.release(id)
+	resp, ok := s.process(r.Context(), id, req, traceID, logger)
+	if !ok {
+		logger.Warn("调用方已断开，放弃加工")
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// process 模拟一次加工：按 profile 等待加工耗时，按失败概率从工站的缺陷目录中判定缺陷，并记录指标；ctx 先结束时返回 false
+func (s *Server) process(ctx context.Context, id types.StationID, req Request, traceID string, logger *slog.Logger) (Response, bool) {
+	profile, _ := s.effective(id)
+	processTime := time.Duration(profile.DelayMs) * time.Millisecond
+	if profile.JitterMs > 0 {
+		processTime += time.Duration(rand.Intn(profile.JitterMs+1)) * time.Millisecond
+	}
+	if !sleep(ctx, processTime) {
+		s.metrics.executions.WithLabelValues(string(id), resultAborted).Inc()
+		return Response{}, false
+	}
+
+	resp := Response{
+		ProductID:    req.ID,
+		Success:      true,
+		Measurements: station.Measure(profile.Measurements),
+		Machine:      profile.Machine,
+		Firmware:     profile.Firmware,
+		Materials:    profile.Materials,
+	}
+	if profile.FailureRate > 0 && rand.Float64() < profile.FailureRate {
+		d := defect.Random(id)
+		resp.Success = false
+		resp.Error = "检测发现缺陷: " + d.Description
+		resp.Defect = d
+		logger.Warn("任务失败", "error", resp.Error, "defect_code", d.Code)
+	} else {
+		logger.Info("任务完成", "duration", processTime.Seconds())
+	}
+	s.metrics.observe(id, resp, processTime.Seconds(), traceID)
+	return resp, true
+}
+
+// getJob 返回作业；id 不为空时作业必须属于该工站，否则返回 404
+func (s *Server) getJob(w http.ResponseWriter, r *http.Request, id types.StationID) {
+	job, ok := s.Job(r.PathValue("job"))
+	if !ok || (id != "" && job.StationID != id) {
+		http.Error(w, "unknown job: "+r.PathValue("job"), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// compensate 模拟补偿，按 profile 等待补偿耗时
+func (s *Server) compensate(w http.ResponseWriter, r *http.Request, id types.StationID) {
+	var req Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	logger, _ := s.requestLogger(r, id, req)
+	if s.down(w, id) {
+		logger.Warn("工站已设置为宕机，拒绝补偿")
+		return
+	}
+	logger.Warn("执行补偿")
+	profile, _ := s.effective(id)
+	if !sleep(r.Context(), time.Duration(profile.CompensateMs)*time.Millisecond) {
+		logger.Warn("调用方已断开，补偿未完成")
+		return
+	}
+	s.metrics.compensations.WithLabelValues(string(id)).Inc()
+}
+
+// Health 是 GET /healthz 返回的服务健康状态
+type Health struct {
+	Status   string                     `json:"status"`    // ok / draining
+	InFlight int                        `json:"in_flight"` // 正在加工的工件数
+	Jobs     int                        `json:"jobs"`      // 保留的作业数
+	Stations map[types.StationID]string `json:"stations"`  // 每个工站的状态: up / down
+}
+
+// Health 返回服务的健康状态
+func (s *Server) Health() Health {
+	h := Health{Status: "ok", Stations: make(map[types.StationID]string, len(s.stations))}
+	s.mu.Lock()
+	if s.draining {
+		h.Status = "draining"
+	}
+	for id := range s.stations {
+		h.InFlight += s.busy[id]
+		h.Stations[id] = "up"
+		if s.faults[id].Down {
+			h.Stations[id] = "down"
+		}
+	}
+	h.Jobs = len(s.jobs)
+	s.mu.Unlock()
+	return h
+}
+
+// serverHealthz 返回服务的健康状态，停机期间返回 503，负载均衡据此摘除实例
+func (s *Server) serverHealthz(w http.ResponseWriter, r *http.Request) {
+	h := s.Health()
+	status := http.StatusOK
+	if h.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, h)
+}
+
+// healthz 返回工站的健康状态，编排器定期探测以导出工站的心跳和在线状态；工站宕机时返回 503
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request, id types.StationID) {
+	if s.down(w, id) {
+		return
+	}
+	s.mu.Lock()
+	busy := s.busy[id]
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{"status": "ok", "station_id": id, "in_flight": busy, "capacity": s.stations[id].Capacity})
+}
+
+// requestLogger 返回带有工站、工件和追踪信息的日志记录器，以及请求的 Trace ID
+func (s *Server) requestLogger(r *http.Request, id types.StationID, req Request) (*slog.Logger, string) {
+	return s.traceLogger(id, req, r.Header.Get("traceparent"), r.Header.Get("X-Trace-ID"))
+}
+
+// traceLogger 按请求携带的追踪信息返回日志记录器和 Trace ID，HTTP 请求头和 gRPC 元数据共用
+// Trace ID 优先取自 traceparent (W3C Trace Context)，其次取自 X-Trace-ID；每次处理生成新的 Span ID，上游的 Span ID 记为 parent_span_id
+func (s *Server) traceLogger(id types.StationID, req Request, traceparent, xTraceID string) (*slog.Logger, string) {
+	logger := s.logger.With("station_id", id, "product_id", req.ID)
+	if req.Serial != "" {
+		logger = logger.With("serial", req.Serial)
+	}
+	traceID, parentSpanID, ok := util.ParseTraceparent(traceparent)
+	if !ok {
+		traceID = xTraceID
+	}
+	if traceID == "" {
+		return logger, ""
+	}
+	logger = logger.With("trace_id", traceID, "span_id", util.NewSpanID())
+	if parentSpanID != "" {
+		logger = logger.With("parent_span_id", parentSpanID)
+	}
+	return logger, traceID
+}
+
+// requireToken 在 token 不为空时校验请求的 Bearer 令牌，不匹配时返回 401
+func (s *Server) requireToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if s.token != "" && subtle.ConstantTimeCompare([]byte(got), []byte(s.token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// sleep 等待 d，ctx 先结束时返回 false
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// writeJSON 以指定状态码输出 JSON 响应
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
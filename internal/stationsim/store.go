@@ -0,0 +1,177 @@
+package stationsim
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// save 将所有保留的作业写入状态文件，先写临时文件再替换，避免停机或崩溃时留下不完整的文件
+// 未配置状态文件时不保存，写入失败只记录日志
+func (s *Server) save() {
+	if s.opts.StateFile == "" {
+		return
+	}
+	// saveMu 保证按修改的先后顺序写入，较旧的快照不会覆盖较新的快照
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	s.mu.Lock()
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, *job)
+	}
+	s.mu.Unlock()
+
+	if err := writeState(s.opts.StateFile, jobs); err != nil {
+		s.logger.Error("保存作业状态失败", "path", s.opts.StateFile, "error", err)
+	}
+}
+
+// writeState 以临时文件加重命名的方式写入状态文件
+func writeState(path string, jobs []Job) error {
+	data, err := json.Marshal(jobs)
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	tmp.Close()
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// RestoreResult 是从状态文件中恢复作业的结果
+type RestoreResult struct {
+	Jobs      int `json:"jobs"`      // 恢复的作业数
+	Resumed   int `json:"resumed"`   // 停机时未完成、重新加工的作业数
+	Callbacks int `json:"callbacks"` // 重新发送的回调数
+}
+
+// Restore 从状态文件中恢复作业，需要在提供服务之前调用：已结束的作业可以继续查询，
+// 停机时未完成的作业重新加工 (不受 capacity 限制)，未成功发送的回调重新发送。恢复的作业标记为 recovered
+// 未配置状态文件或文件不存在时不恢复任何作业；不是模拟的工站的作业被丢弃
+func (s *Server) Restore() (RestoreResult, error) {
+	var result RestoreResult
+	if s.opts.StateFile == "" {
+		return result, nil
+	}
+	data, err := os.ReadFile(s.opts.StateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+	var jobs []Job
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return result, fmt.Errorf("%s: %w", s.opts.StateFile, err)
+	}
+	slices.SortFunc(jobs, func(a, b Job) int { return a.FinishedAt.Compare(b.FinishedAt) })
+
+	type resume struct {
+		job      *Job
+		callback bool
+	}
+	var pending []resume
+	s.mu.Lock()
+	for _, j := range jobs {
+		if _, ok := s.stations[j.StationID]; !ok {
+			s.logger.Warn("丢弃不是模拟的工站的作业", "job_id", j.ID, "station_id", j.StationID)
+			continue
+		}
+		job := j
+		job.Recovered = true
+		s.jobs[job.ID] = &job
+		result.Jobs++
+		switch {
+		case job.Status != JobCompleted:
+			s.busy[job.StationID]++
+			s.inflight.Add(1)
+			s.metrics.inFlight.WithLabelValues(string(job.StationID)).Inc()
+			pending = append(pending, resume{job: &job})
+			result.Resumed++
+		case job.CallbackURL != "" && !job.CallbackDelivered:
+			s.finished = append(s.finished, job.ID)
+			s.inflight.Add(1)
+			pending = append(pending, resume{job: &job, callback: true})
+			result.Callbacks++
+		default:
+			s.finished = append(s.finished, job.ID)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, p := range pending {
+		job := *p.job
+		logger := s.logger.With("station_id", job.StationID, "product_id", job.ProductID, "job_id", job.ID)
+		if job.TraceID != "" {
+			logger = logger.With("trace_id", job.TraceID)
+		}
+		if p.callback {
+			go func() {
+				defer s.inflight.Done()
+				s.callback(p.job, job, logger)
+			}()
+			continue
+		}
+		logger.Info("重新加工停机时未完成的作业")
+		go s.run(p.job, Request{ID: job.ProductID, Serial: job.Serial, CallbackURL: job.CallbackURL}, logger)
+	}
+	s.save()
+	return result, nil
+}
+
+// Shutdown 停止接收新的加工请求 (返回 503)，等待进行中的加工和回调结束；
+// ctx 结束时取消仍在进行的异步作业，作业以 running 状态保存，重启后由 Restore 恢复。作业查询在停机期间照常提供
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.draining = true
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		s.logInterrupted()
+	}
+	// 取消仍在进行的异步加工和回调重试，同步请求的加工随 HTTP 服务停机结束
+	s.stop()
+	s.save()
+	return err
+}
+
+// logInterrupted 记录停机超时时仍未完成的作业
+func (s *Server) logInterrupted() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range s.jobs {
+		if job.Status != JobCompleted {
+			s.logger.Warn("停机超时，作业保存为进行中", "job_id", job.ID, "station_id", job.StationID, "product_id", job.ProductID)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+// Package throughput 根据工件完成事件和步骤排队事件统计产线的产出速率、滚动节拍和瓶颈工站
+package throughput
+
+import (
+	"context"
+	"fmt"
+	"industrial-4.0-demo/internal/event"
+	"industrial-4.0-demo/internal/metrics"
+	"industrial-4.0-demo/internal/types"
+	"industrial-4.0-demo/internal/windowed"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gaugeInterval 是刷新产出和瓶颈指标的间隔
+const gaugeInterval = 10 * time.Second
+
+// TypeThroughput 是一种产品类型在统计窗口内的产出
+type TypeThroughput struct {
+	Type         string  `json:"type"`
+	Completed    int     `json:"completed"`
+	UnitsPerHour float64 `json:"units_per_hour"`
+	TaktSeconds  float64 `json:"takt_seconds"` // 滚动节拍：窗口内相邻两个完成工件的平均间隔，少于两件时为 0
+}
+
+// StationQueue 是一个工站在统计窗口内的排队时间
+type StationQueue struct {
+	StationID    types.StationID `json:"station_id"`
+	QueueSeconds float64         `json:"queue_seconds"` // 工件等待工站资源的时间之和
+	Share        float64         `json:"share"`         // 占所有工站排队时间的比例，0 ~ 1
+}
+
+// Report 是统计窗口内的产出报告
+// 窗口早于追踪开始时从追踪开始时计算
+type Report struct {
+	Window       string           `json:"window"`
+	From         time.Time        `json:"from"`
+	To           time.Time        `json:"to"`
+	Completed    int              `json:"completed"`
+	UnitsPerHour float64          `json:"units_per_hour"`
+	TaktSeconds  float64          `json:"takt_seconds"`
+	Types        []TypeThroughput `json:"types"`
+	Stations     []StationQueue   `json:"stations"`
+	Bottleneck   types.StationID  `json:"bottleneck,omitempty"` // 排队时间占比最高的工站，窗口内没有排队时为空
+}
+
+// completion 是一个完成的工件
+type completion struct {
+	at          time.Time
+	productType string
+}
+
+// wait 是工件在工站上的一次排队
+type wait struct {
+	at        time.Time // 排队结束的时间
+	stationID types.StationID
+	duration  time.Duration
+}
+
+// pendingWait 是尚未结束的排队，处理器是异步执行的，开始事件可能先于排队事件到达
+type pendingWait struct {
+	queued  time.Time
+	started time.Time
+}
+
+// Tracker 订阅事件总线，保留最近 retention 时长内的完成和排队记录并按需生成报告
+type Tracker struct {
+	mu          sync.Mutex
+	retention   windowed.Retention
+	completions []completion
+	waits       []wait
+	pending     map[string]pendingWait
+	metrics     *metrics.Metrics
+}
+
+// NewTracker 创建一个产出追踪器，retention 是事件的保留时长，也是可查询的最大窗口；m 是 Run 更新的指标
+func NewTracker(retention time.Duration, m *metrics.Metrics) *Tracker {
+	return &Tracker{
+		retention: windowed.NewRetention(retention),
+		pending:   make(map[string]pendingWait),
+		metrics:   m,
+	}
+}
+
+// Register 订阅工件完成和步骤排队、开始、拒绝事件
+// 失败、补偿和取消的工件不计入产出；被停用工站拒绝的步骤在拒绝时结束排队
+func (t *Tracker) Register(bus *event.Bus) {
+	bus.Subscribe(event.ProductCompleted, func(e event.Event) {
+		t.recordCompletion(e.Product.Type, e.Timestamp)
+	})
+	bus.Subscribe(event.StepQueued, func(e event.Event) {
+		t.recordQueue(e, true)
+	})
+	bus.Subscribe(event.StepStarted, func(e event.Event) {
+		t.recordQueue(e, false)
+	})
+	bus.Subscribe(event.StepRejected, func(e event.Event) {
+		t.recordQueue(e, false)
+	})
+}
+
+// Run 定期按 window 生成报告并更新产出和瓶颈指标，直到 ctx 结束，window 超过保留时长时使用保留时长
+func (t *Tracker) Run(ctx context.Context, window time.Duration) {
+	window = t.retention.Clamp(window)
+	ticker := time.NewTicker(gaugeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			report, _ := t.Report(window, now)
+			for _, tt := range report.Types {
+				t.metrics.ThroughputUnitsPerHour.WithLabelValues(tt.Type).Set(tt.UnitsPerHour)
+				t.metrics.TaktTimeSeconds.WithLabelValues(tt.Type).Set(tt.TaktSeconds)
+			}
+			for _, s := range report.Stations {
+				t.metrics.StationQueueTimeShare.WithLabelValues(string(s.StationID)).Set(s.Share)
+			}
+		}
+	}
+}
+
+// recordCompletion 记录一个完成的工件
+func (t *Tracker) recordCompletion(productType string, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.completions = append(t.completions, completion{at: at, productType: productType})
+	t.pruneLocked(at)
+}
+
+// recordQueue 记录排队的开始 (queued 为 true) 或结束，两端都到达后得到一次排队时长
+func (t *Tracker) recordQueue(e event.Event, queued bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := fmt.Sprintf("%s#%d#%s", e.ProductID, e.Step, e.StationID)
+	p := t.pending[key]
+	if queued {
+		p.queued = e.Timestamp
+	} else {
+		p.started = e.Timestamp
+	}
+	if p.queued.IsZero() || p.started.IsZero() {
+		t.pending[key] = p
+		return
+	}
+	delete(t.pending, key)
+	t.waits = append(t.waits, wait{at: p.started, stationID: e.StationID, duration: max(0, p.started.Sub(p.queued))})
+	t.pruneLocked(e.Timestamp)
+}
+
+// pruneLocked 丢弃超过保留时长的记录，调用方必须持有锁
+func (t *Tracker) pruneLocked(now time.Time) {
+	cutoff := t.retention.Cutoff(now)
+	t.completions = windowed.Prune(t.completions, cutoff, func(c completion) time.Time { return c.at })
+	t.waits = windowed.Prune(t.waits, cutoff, func(w wait) time.Time { return w.at })
+}
+
+// Report 统计截至 now 的 window 时长内的产出、滚动节拍和各工站的排队时间占比
+func (t *Tracker) Report(window time.Duration, now time.Time) (Report, error) {
+	from, err := t.retention.From(window, now)
+	if err != nil {
+		return Report{}, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	hours := now.Sub(from).Hours()
+	report := Report{Window: window.String(), From: from, To: now, Types: []TypeThroughput{}, Stations: []StationQueue{}}
+
+	var all []time.Time
+	byType := make(map[string][]time.Time)
+	for _, c := range t.completions {
+		if c.at.Before(from) || c.at.After(now) {
+			continue
+		}
+		all = append(all, c.at)
+		byType[c.productType] = append(byType[c.productType], c.at)
+	}
+	report.Completed = len(all)
+	report.UnitsPerHour = perHour(len(all), hours)
+	report.TaktSeconds = takt(all)
+	for productType, times := range byType {
+		report.Types = append(report.Types, TypeThroughput{
+			Type:         productType,
+			Completed:    len(times),
+			UnitsPerHour: perHour(len(times), hours),
+			TaktSeconds:  takt(times),
+		})
+	}
+	slices.SortFunc(report.Types, func(a, b TypeThroughput) int { return strings.Compare(a.Type, b.Type) })
+
+	var total time.Duration
+	byStation := make(map[types.StationID]time.Duration)
+	for _, w := range t.waits {
+		if w.at.Before(from) || w.at.After(now) {
+			continue
+		}
+		byStation[w.stationID] += w.duration
+		total += w.duration
+	}
+	var longest time.Duration
+	for id, d := range byStation {
+		q := StationQueue{StationID: id, QueueSeconds: d.Seconds()}
+		if total > 0 {
+			q.Share = float64(d) / float64(total)
+		}
+		report.Stations = append(report.Stations, q)
+		if d > longest {
+			longest, report.Bottleneck = d, id
+		}
+	}
+	slices.SortFunc(report.Stations, func(a, b StationQueue) int { return strings.Compare(string(a.StationID), string(b.StationID)) })
+	return report, nil
+}
+
+// perHour 将窗口内的数量换算为每小时的速率
+func perHour(n int, hours float64) float64 {
+	if hours <= 0 {
+		return 0
+	}
+	return float64(n) / hours
+}
+
+// takt 返回相邻两个完成时间的平均间隔 (秒)，少于两个时为 0
+func takt(times []time.Time) float64 {
+	if len(times) < 2 {
+		return 0
+	}
+	first, last := slices.MinFunc(times, time.Time.Compare), slices.MaxFunc(times, time.Time.Compare)
+	return last.Sub(first).Seconds() / float64(len(times)-1)
+}
@@ -0,0 +1,191 @@
+package traceability
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// PDF 版面 (单位 pt)
+const (
+	pageWidth  = 595.0 // A4
+	pageHeight = 842.0
+	margin     = 40.0
+	fontSize   = 9.0
+	lineHeight = 13.0
+	lineWidth  = 110 // 每行的最大宽度，以半角字符计，全角字符计为 2
+	perPage    = 56  // 每页的行数，(pageHeight - 2*margin) / lineHeight 后留出页脚
+)
+
+// pdfTime 是 PDF 中时间的格式
+const pdfTime = "2006-01-02 15:04:05.000"
+
+// WritePDF 将追溯文档导出为 PDF
+// 使用阅读器内置的 STSong-Light 中文字体 (Adobe-GB1)，不嵌入字体文件；超出基本多文种平面的字符显示为 ?
+func WritePDF(w io.Writer, doc Document) error {
+	var lines []string
+	for _, l := range doc.textLines() {
+		lines = append(lines, wrap(l, lineWidth)...)
+	}
+	var pages [][]string
+	for len(lines) > perPage {
+		pages = append(pages, lines[:perPage])
+		lines = lines[perPage:]
+	}
+	pages = append(pages, lines)
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"", // 页面树，页面对象编号确定后填写
+		"<< /Type /Font /Subtype /Type0 /BaseFont /STSong-Light /Encoding /UniGB-UCS2-H /DescendantFonts [4 0 R] >>",
+		"<< /Type /Font /Subtype /CIDFontType0 /BaseFont /STSong-Light " +
+			"/CIDSystemInfo << /Registry (Adobe) /Ordering (GB1) /Supplement 4 >> /FontDescriptor 5 0 R /DW 1000 /W [1 95 500] >>",
+		"<< /Type /FontDescriptor /FontName /STSong-Light /Flags 6 /FontBBox [-25 -254 1000 880] " +
+			"/ItalicAngle 0 /Ascent 880 /Descent -120 /CapHeight 880 /StemV 93 >>",
+	}
+	var kids []string
+	for i, page := range pages {
+		var content strings.Builder
+		fmt.Fprintf(&content, "BT\n/F1 %g Tf\n%g TL\n%g %g Td\n", fontSize, lineHeight, margin, pageHeight-margin-fontSize)
+		for _, l := range page {
+			fmt.Fprintf(&content, "%s Tj T*\n", pdfString(l))
+		}
+		fmt.Fprintf(&content, "ET\nBT\n/F1 %g Tf\n%g %g Td\n%s Tj\nET\n", fontSize, margin, margin/2,
+			pdfString(fmt.Sprintf("%s  第 %d / %d 页", doc.ProductID, i+1, len(pages))))
+
+		pageNum := len(objects) + 1
+		kids = append(kids, fmt.Sprintf("%d 0 R", pageNum))
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %g %g] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+				pageWidth, pageHeight, pageNum+1),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+		)
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages))
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// pdfString 将文本编码为 UCS-2 大端序的十六进制字符串
+func pdfString(s string) string {
+	var b strings.Builder
+	b.WriteByte('<')
+	for _, r := range s {
+		if r > 0xFFFF || r == utf8.RuneError {
+			r = '?'
+		}
+		fmt.Fprintf(&b, "%04X", r)
+	}
+	b.WriteByte('>')
+	return b.String()
+}
+
+// wrap 按显示宽度折行，续行缩进四个空格
+func wrap(s string, width int) []string {
+	var lines []string
+	var cur strings.Builder
+	n := 0
+	for _, r := range s {
+		w := 1
+		if r > 0x7F {
+			w = 2
+		}
+		if n+w > width {
+			lines = append(lines, cur.String())
+			cur.Reset()
+			cur.WriteString("    ")
+			n = 4
+		}
+		cur.WriteRune(r)
+		n += w
+	}
+	return append(lines, cur.String())
+}
+
+// textLines 返回 PDF 中逐行排列的文档内容
+func (doc Document) textLines() []string {
+	lines := []string{
+		"工件追溯文档 " + doc.ProductID,
+		"",
+		fmt.Sprintf("类型: %s    命名空间: %s    批次: %s    序列号: %s", orDash(doc.Type), orDash(doc.Namespace), orDash(doc.Lot), orDash(doc.Serial)),
+		fmt.Sprintf("结果: %s    Trace ID: %s", orDash(doc.Outcome), orDash(doc.TraceID)),
+	}
+	if doc.Failure != "" {
+		lines = append(lines, "失败原因: "+doc.Failure)
+	}
+	if len(doc.RetryChain) > 0 {
+		lines = append(lines, "重试来源: "+strings.Join(doc.RetryChain, " <- "))
+	}
+	lines = append(lines,
+		fmt.Sprintf("入队: %s    开始: %s    结束: %s", pdfClock(doc.QueuedAt), pdfClock(doc.StartedAt), pdfClock(doc.FinishedAt)),
+		"生成时间: "+pdfClock(doc.GeneratedAt),
+		"",
+		"加工步骤",
+	)
+	for _, s := range doc.Steps {
+		result := "成功"
+		if !s.Success {
+			result = "失败"
+			if s.Defect != nil {
+				result += " " + s.Defect.Error()
+			} else if s.Error != "" {
+				result += " " + s.Error
+			}
+		}
+		operator := orDash(s.Operator)
+		if s.OperatorName != "" {
+			operator += " (" + s.OperatorName + ")"
+		}
+		lines = append(lines,
+			fmt.Sprintf("[%d] 工站 %s    设备: %s    固件: %s    操作员: %s", s.Step, s.StationID, orDash(s.Machine), orDash(s.Firmware), operator),
+			fmt.Sprintf("    排队: %s    开始: %s    结束: %s    耗时: %.3fs", pdfClock(s.QueuedAt), pdfClock(s.StartedAt), pdfClock(s.FinishedAt), s.DurationSeconds),
+			"    结果: "+result,
+		)
+		if len(s.Measurements) > 0 {
+			lines = append(lines, "    测量: "+formatMeasurements(s.Measurements))
+		}
+		if len(s.Materials) > 0 {
+			lines = append(lines, "    物料: "+formatMaterials(s.Materials))
+		}
+	}
+	if len(doc.Materials) > 0 {
+		lines = append(lines, "", "物料汇总: "+formatMaterials(doc.Materials))
+	}
+	if len(doc.Compensations) > 0 {
+		lines = append(lines, "", "补偿")
+		for _, c := range doc.Compensations {
+			lines = append(lines, fmt.Sprintf("    工站 %s    %s", c.StationID, pdfClock(c.At)))
+		}
+	}
+	return lines
+}
+
+// pdfClock 格式化 PDF 中的时间，零值显示为 -
+func pdfClock(t time.Time) string {
+	return orDash(formatTime(t, pdfTime))
+}
+
+// orDash 将空字符串显示为 -
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
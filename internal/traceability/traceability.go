@@ -0,0 +1,200 @@
+// Package traceability 根据加工履历生成工件的追溯文档：经过的每个工站的时间、设备实例、固件版本、操作员、测量值和消耗的物料
+// 文档可以导出为 JSON、CSV 和 PDF
+package traceability
+
+import (
+	"cmp"
+	"encoding/csv"
+	"fmt"
+	"industrial-4.0-demo/internal/history"
+	"industrial-4.0-demo/internal/quality"
+	"industrial-4.0-demo/internal/types"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRetryChain 是追溯重试来源的最大深度
+const maxRetryChain = 32
+
+// Document 是单个工件的追溯文档
+type Document struct {
+	ProductID     string                       `json:"product_id"`
+	Type          string                       `json:"type"`
+	Namespace     string                       `json:"namespace,omitempty"`
+	Lot           string                       `json:"lot,omitempty"`
+	Serial        string                       `json:"serial,omitempty"`
+	TraceID       string                       `json:"trace_id,omitempty"`
+	RetryChain    []string                     `json:"retry_chain,omitempty"` // 重试来源的工件 ID，由近及远
+	Outcome       string                       `json:"outcome,omitempty"`
+	Failure       string                       `json:"failure,omitempty"`
+	QueuedAt      time.Time                    `json:"queued_at,omitzero"`
+	StartedAt     time.Time                    `json:"started_at,omitzero"`
+	FinishedAt    time.Time                    `json:"finished_at,omitzero"`
+	Steps         []Step                       `json:"steps"`
+	Materials     []types.MaterialUsage        `json:"materials"` // 所有成功步骤消耗的物料，按名称、批号和单位汇总
+	Compensations []history.CompensationRecord `json:"compensations,omitempty"`
+	GeneratedAt   time.Time                    `json:"generated_at"`
+}
+
+// Step 是工件在一个工站上的一次加工
+type Step struct {
+	Step            int                   `json:"step"`
+	StationID       types.StationID       `json:"station_id"`
+	Machine         string                `json:"machine,omitempty"`
+	Firmware        string                `json:"firmware,omitempty"`
+	Operator        string                `json:"operator,omitempty"`
+	OperatorName    string                `json:"operator_name,omitempty"`
+	QueuedAt        time.Time             `json:"queued_at,omitzero"`
+	StartedAt       time.Time             `json:"started_at,omitzero"`
+	FinishedAt      time.Time             `json:"finished_at,omitzero"`
+	DurationSeconds float64               `json:"duration_seconds"`
+	Success         bool                  `json:"success"`
+	Error           string                `json:"error,omitempty"`
+	Defect          *types.Defect         `json:"defect,omitempty"`
+	Measurements    []quality.Result      `json:"measurements,omitempty"`
+	Materials       []types.MaterialUsage `json:"materials,omitempty"`
+}
+
+// Build 根据加工履历生成追溯文档，lookup 用于沿重试来源向前追溯
+func Build(rec history.Record, lookup func(id string) (history.Record, bool), now time.Time) Document {
+	doc := Document{
+		ProductID:     rec.ProductID,
+		Type:          rec.Type,
+		Namespace:     rec.Namespace,
+		Lot:           rec.Lot,
+		Serial:        rec.Serial,
+		TraceID:       rec.TraceID,
+		Outcome:       rec.Outcome,
+		Failure:       rec.Failure,
+		QueuedAt:      rec.QueuedAt,
+		StartedAt:     rec.StartedAt,
+		FinishedAt:    rec.FinishedAt,
+		Steps:         []Step{},
+		Materials:     []types.MaterialUsage{},
+		Compensations: rec.Compensations,
+		GeneratedAt:   now,
+	}
+	for id := rec.RetryOf; id != "" && len(doc.RetryChain) < maxRetryChain && !slices.Contains(doc.RetryChain, id); {
+		doc.RetryChain = append(doc.RetryChain, id)
+		parent, ok := lookup(id)
+		if !ok {
+			break
+		}
+		id = parent.RetryOf
+	}
+
+	for _, s := range rec.Steps {
+		step := Step{
+			Step:            s.Step,
+			StationID:       s.StationID,
+			QueuedAt:        s.QueuedAt,
+			StartedAt:       s.StartedAt,
+			FinishedAt:      s.FinishedAt,
+			DurationSeconds: s.DurationSeconds,
+			Success:         s.Success,
+			Error:           s.Error,
+			Defect:          s.Defect,
+		}
+		if p := s.Provenance; p != nil {
+			step.Machine, step.Firmware = p.Machine, p.Firmware
+			step.Operator, step.OperatorName = p.Operator, p.OperatorName
+			step.Materials = p.Materials
+		}
+		for _, m := range s.Measurements {
+			step.Measurements = append(step.Measurements, quality.Result{Measurement: m, InSpec: m.InSpec()})
+		}
+		if s.Success {
+			doc.Materials = addMaterials(doc.Materials, step.Materials)
+		}
+		doc.Steps = append(doc.Steps, step)
+	}
+	slices.SortFunc(doc.Materials, func(a, b types.MaterialUsage) int {
+		return cmp.Or(strings.Compare(a.Name, b.Name), strings.Compare(a.Lot, b.Lot), strings.Compare(a.Unit, b.Unit))
+	})
+	return doc
+}
+
+// addMaterials 将物料累加到汇总中，名称、批号和单位都相同的物料合并数量
+func addMaterials(total, used []types.MaterialUsage) []types.MaterialUsage {
+	for _, m := range used {
+		i := slices.IndexFunc(total, func(t types.MaterialUsage) bool {
+			return t.Name == m.Name && t.Lot == m.Lot && t.Unit == m.Unit
+		})
+		if i < 0 {
+			total = append(total, m)
+			continue
+		}
+		total[i].Quantity += m.Quantity
+	}
+	return total
+}
+
+// csvHeader 是 CSV 导出的列，每个步骤一行
+var csvHeader = []string{
+	"product_id", "type", "lot", "serial", "outcome", "step", "station_id", "machine", "firmware", "operator",
+	"queued_at", "started_at", "finished_at", "duration_seconds", "success", "defect_code", "error",
+	"measurements", "materials",
+}
+
+// WriteCSV 将追溯文档导出为 CSV，每个步骤一行；测量值和物料以 "; " 分隔写在同一列
+func WriteCSV(w io.Writer, doc Document) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, s := range doc.Steps {
+		var defectCode string
+		if s.Defect != nil {
+			defectCode = s.Defect.Code
+		}
+		row := []string{
+			doc.ProductID, doc.Type, doc.Lot, doc.Serial, doc.Outcome, strconv.Itoa(s.Step), string(s.StationID),
+			s.Machine, s.Firmware, s.Operator,
+			formatTime(s.QueuedAt, time.RFC3339Nano), formatTime(s.StartedAt, time.RFC3339Nano), formatTime(s.FinishedAt, time.RFC3339Nano),
+			strconv.FormatFloat(s.DurationSeconds, 'f', 3, 64), strconv.FormatBool(s.Success), defectCode, s.Error,
+			formatMeasurements(s.Measurements), formatMaterials(s.Materials),
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// formatTime 格式化时间，零值返回空字符串
+func formatTime(t time.Time, layout string) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(layout)
+}
+
+// formatMeasurements 将测量值格式化为 "名称=值单位"，超出规格界限的测量值标记 (OOS)
+func formatMeasurements(ms []quality.Result) string {
+	parts := make([]string, 0, len(ms))
+	for _, m := range ms {
+		part := fmt.Sprintf("%s=%.4g%s", m.Name, m.Value, m.Unit)
+		if !m.InSpec {
+			part += " (OOS)"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// formatMaterials 将物料格式化为 "名称[批号] 数量单位"
+func formatMaterials(ms []types.MaterialUsage) string {
+	parts := make([]string, 0, len(ms))
+	for _, m := range ms {
+		name := m.Name
+		if m.Lot != "" {
+			name += "[" + m.Lot + "]"
+		}
+		parts = append(parts, fmt.Sprintf("%s %g%s", name, m.Quantity, m.Unit))
+	}
+	return strings.Join(parts, "; ")
+}
@@ -1,5 +1,12 @@
 package types
 
+import (
+	"cmp"
+	"regexp"
+	"slices"
+	"time"
+)
+
 // StationID 定义工站 ID
 // 使用字符串类型，方便在日志和配置中直接使用
 type StationID string
@@ -17,28 +24,163 @@ const (
 	StationPack  StationID = "STATION_PACK"   // 包装机 (出口)：负责最终包装
 )
 
+// BuiltinStations 是编排器内置的工站，未配置远程地址的内置工站在进程内模拟
+var BuiltinStations = []StationID{
+	StationCAM,
+	StationDrill,
+	StationLami,
+	StationEtch,
+	StationMask,
+	StationSilk,
+	StationAOI,
+	StationETest,
+	StationPack,
+}
+
 // WorkflowStep 定义工作流中的一个步骤
 // 一个步骤可以包含一个或多个工站（并行执行），也可以包含执行规则
 type WorkflowStep struct {
-	StationIDs []StationID `mapstructure:"station_ids"`    // 该步骤包含的工站 ID 列表，多个 ID 表示并行执行
-	Rule       string      `mapstructure:"rule,omitempty"` // 执行该步骤的规则表达式 (expr 语法)，为空则默认执行
+	StationIDs []StationID `mapstructure:"station_ids" json:"station_ids"`       // 该步骤包含的工站 ID 列表，多个 ID 表示并行执行
+	Rule       string      `mapstructure:"rule,omitempty" json:"rule,omitempty"` // 执行该步骤的规则表达式 (expr 语法)，为空则默认执行
 }
 
 // Product 表示生产线上的工件 (PCB 板)
 type Product struct {
-	ID       string                 // 工件唯一标识
-	Type     string                 // 产品类型: PCB_DOUBLE_LAYER, PCB_MULTILAYER, PCB_PROTOTYPE
-	Priority int                    // 优先级：数值越大优先级越高
-	Step     int                    // 当前步骤索引，用于流程控制
-	History  []string               // 加工历史记录，存储经过的工站 ID
-	Status   string                 // 当前状态，由 FSM 管理 (e.g., PROCESSING, COMPLETED)
-	FSM      interface{}            `json:"-"`               // 运行时绑定的 FSM 实例，不参与 JSON 序列化
-	Attrs    map[string]interface{} `json:"attrs,omitempty"` // 动态属性，用于规则引擎决策 (e.g., layers: 4, is_fragile: true)
+	ID        string                 // 工件唯一标识
+	Type      string                 // 产品类型: PCB_DOUBLE_LAYER, PCB_MULTILAYER, PCB_PROTOTYPE
+	Priority  int                    // 优先级：数值越大优先级越高
+	Step      int                    // 当前步骤索引，用于流程控制
+	History   []string               // 加工历史记录，存储经过的工站 ID
+	Status    string                 // 当前状态，由 FSM 管理 (e.g., PROCESSING, COMPLETED)
+	FSM       interface{}            `json:"-"`                   // 运行时绑定的 FSM 实例，不参与 JSON 序列化
+	Attrs     map[string]interface{} `json:"attrs,omitempty"`     // 动态属性，用于规则引擎决策 (e.g., layers: 4, is_fragile: true)
+	RetryOf   string                 `json:"retry_of,omitempty"`  // 重试来源的工件 ID，首次生产时为空
+	Namespace string                 `json:"namespace,omitempty"` // 所属的命名空间 (产线)，提交时为空则归入 DefaultNamespace
+	Lot       string                 `json:"lot,omitempty"`       // 所属批次的 ID，按数量拆分的订单中的每块拼板属于同一批次
+	Serial    string                 `json:"serial,omitempty"`    // 开始生产时分配的序列号，印在工件标签上
+	DueAt     time.Time              `json:"due_at,omitzero"`     // 交期，为空时按 sla.due_seconds 中产品类型的默认交期跟踪
+	Resume    *Checkpoint            `json:"resume,omitempty"`    // 从 WAL 恢复的工件最近完成的步骤，为空时从第一个步骤开始生产
+}
+
+// Checkpoint 是工件最近完成的一个步骤，每完成一个步骤写入 WAL，崩溃重启后工件从下一个步骤继续
+type Checkpoint struct {
+	Step     int         `json:"step"`              // 最近完成的步骤索引
+	Workflow string      `json:"workflow"`          // 执行的工作流名称
+	Version  int         `json:"workflow_version"`  // 执行的工作流版本，恢复后继续使用该版本
+	Stations []StationID `json:"stations"`          // 已执行的工站，恢复后失败时按逆序补偿
+	History  []string    `json:"history,omitempty"` // 完成该步骤时的加工历史
+	Serial   string      `json:"serial,omitempty"`  // 已分配的序列号
+}
+
+// Snapshot 返回工件当前状态的副本，发布事件时使用：事件处理器在各自的 goroutine 中读取副本，不与引擎对工件的修改竞争
+// FSM、Attrs 和 Resume 与原工件共享，生产过程中不会被替换
+func (p *Product) Snapshot() *Product {
+	c := *p
+	c.History = slices.Clone(p.History)
+	return &c
+}
+
+// DefaultNamespace 是未指定命名空间的工件所属的命名空间
+const DefaultNamespace = "default"
+
+// namespacePattern 限定命名空间为小写字母、数字、- 和 _，便于用作指标标签和 URL 参数
+var namespacePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// IsValidNamespace 判断命名空间名称是否合法
+func IsValidNamespace(ns string) bool {
+	return namespacePattern.MatchString(ns)
 }
 
 // Result 表示工站任务执行的结果
 type Result struct {
-	ProductID string // 关联的工件 ID
-	Success   bool   // 是否执行成功
-	Error     error  // 如果失败，存储错误信息
+	ProductID    string        // 关联的工件 ID
+	Success      bool          // 是否执行成功
+	Error        error         // 如果失败，存储错误信息
+	Defect       *Defect       // 失败时工站判定的缺陷，为空时由引擎按错误归类
+	Measurements []Measurement // 加工时采集的质量测量值
+	Provenance   Provenance    // 执行加工的设备、固件、操作员和消耗的物料
+}
+
+// Provenance 是一次加工的追溯信息
+type Provenance struct {
+	Machine      string          `json:"machine,omitempty"`       // 执行加工的设备实例
+	Firmware     string          `json:"firmware,omitempty"`      // 设备的固件版本
+	Operator     string          `json:"operator,omitempty"`      // 操作员 ID，由引擎在分配操作员后填写
+	OperatorName string          `json:"operator_name,omitempty"` // 操作员姓名
+	Materials    []MaterialUsage `json:"materials,omitempty"`     // 消耗的物料
+}
+
+// MaterialUsage 是一次加工消耗的物料
+type MaterialUsage struct {
+	Name     string  `mapstructure:"name" json:"name"`
+	Lot      string  `mapstructure:"lot" json:"lot,omitempty"` // 物料批号
+	Quantity float64 `mapstructure:"quantity" json:"quantity"`
+	Unit     string  `mapstructure:"unit" json:"unit,omitempty"`
+}
+
+// Cost 是加工成本的分项
+type Cost struct {
+	Currency     string  `json:"currency"`      // 金额的货币
+	EnergyKWh    float64 `json:"energy_kwh"`    // 耗电量
+	LaborSeconds float64 `json:"labor_seconds"` // 操作员工时 (秒)
+	Energy       float64 `json:"energy"`        // 电费
+	Material     float64 `json:"material"`      // 物料费
+	Labor        float64 `json:"labor"`         // 人工费
+	Total        float64 `json:"total"`
+}
+
+// Add 返回两项成本逐项相加的结果
+func (c Cost) Add(o Cost) Cost {
+	return Cost{
+		Currency:     cmp.Or(c.Currency, o.Currency),
+		EnergyKWh:    c.EnergyKWh + o.EnergyKWh,
+		LaborSeconds: c.LaborSeconds + o.LaborSeconds,
+		Energy:       c.Energy + o.Energy,
+		Material:     c.Material + o.Material,
+		Labor:        c.Labor + o.Labor,
+		Total:        c.Total + o.Total,
+	}
+}
+
+// 缺陷的处置方式
+const (
+	DispositionScrap  = "scrap"  // 报废
+	DispositionRework = "rework" // 返工后重新加工
+	DispositionHold   = "hold"   // 隔离，等待评审判定
+)
+
+// Defect 是结构化的缺陷代码，同时作为加工失败的错误
+type Defect struct {
+	Category    string `json:"category"`    // 缺陷类别，例如 electrical / drilling / equipment
+	Code        string `json:"code"`        // 缺陷代码，例如 ET-OPEN
+	Description string `json:"description"` // 缺陷描述
+	Disposition string `json:"disposition"` // scrap / rework / hold
+}
+
+// Error 返回缺陷代码和描述
+func (d *Defect) Error() string {
+	return d.Code + ": " + d.Description
+}
+
+// Measurement 是工站加工时采集的一项质量测量值，例如孔径、铜厚或测试覆盖率
+type Measurement struct {
+	Name  string   `json:"name"`
+	Value float64  `json:"value"`
+	Unit  string   `json:"unit,omitempty"`
+	LSL   *float64 `json:"lsl,omitempty"` // 规格下限，为空时不检查
+	USL   *float64 `json:"usl,omitempty"` // 规格上限，为空时不检查
+}
+
+// InSpec 判断测量值是否在规格界限内
+func (m Measurement) InSpec() bool {
+	return (m.LSL == nil || m.Value >= *m.LSL) && (m.USL == nil || m.Value <= *m.USL)
+}
+
+// MeasurementSpec 定义工站采集的一项测量及其规格界限
+type MeasurementSpec struct {
+	Name    string  `mapstructure:"name" json:"name"`
+	Unit    string  `mapstructure:"unit" json:"unit,omitempty"`
+	Nominal float64 `mapstructure:"nominal" json:"nominal"` // 目标值，本地工站以此为中心模拟测量
+	LSL     float64 `mapstructure:"lsl" json:"lsl"`         // 规格下限
+	USL     float64 `mapstructure:"usl" json:"usl"`         // 规格上限
 }
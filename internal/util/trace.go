@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"strings"
 )
 
 // contextKey 是一个私有类型，用于避免 context key 的冲突
@@ -32,3 +33,41 @@ func TraceIDFromContext(ctx context.Context) (string, bool) {
 	traceID, ok := ctx.Value(traceIDKey).(string)
 	return traceID, ok
 }
+
+// NewSpanID 生成一个随机的 Span ID (16 位十六进制)，标识一次跨服务调用
+func NewSpanID() string {
+	bytes := make([]byte, 8)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
+
+// Traceparent 按 W3C Trace Context 格式生成 traceparent 请求头，OpenTelemetry 等追踪系统据此把跨服务的调用关联到同一个 trace
+// traceID 不是 32 位十六进制时 (例如调用方传入的自定义 Trace ID) 返回空字符串，只通过 X-Trace-ID 传递
+func Traceparent(traceID, spanID string) string {
+	if !isHexID(traceID, 32) || !isHexID(spanID, 16) {
+		return ""
+	}
+	return "00-" + traceID + "-" + spanID + "-01"
+}
+
+// ParseTraceparent 解析 traceparent 请求头，返回 Trace ID 和上游的 Span ID
+func ParseTraceparent(v string) (traceID, spanID string, ok bool) {
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || !isHexID(parts[1], 32) || !isHexID(parts[2], 16) {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+// isHexID 判断 id 是否为 n 位小写十六进制且不全为 0
+func isHexID(id string, n int) bool {
+	if len(id) != n || strings.Trim(id, "0") == "" {
+		return false
+	}
+	for _, c := range id {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,262 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"industrial-4.0-demo/internal/fsm"
+	"industrial-4.0-demo/internal/types"
+	"slices"
+	"time"
+)
+
+// 告警级别
+const (
+	SeverityWarning  = "warning"  // 需要关注，产线仍在运转 (例如单个工件失败、队列积压)
+	SeverityCritical = "critical" // 需要立即处理 (例如工站停机、补偿失败)
+)
+
+// 告警类型
+const (
+	AlertProductFailed      = "product_failed"      // 工件生产失败
+	AlertCompensationFailed = "compensation_failed" // 工站补偿失败，工件可能处于不一致状态
+	AlertStationDown        = "station_down"        // 工站故障停机
+	AlertQueueBacklog       = "queue_backlog"       // 调度队列积压超过阈值
+	AlertStationAnomaly     = "station_anomaly"     // 工站步骤耗时偏离基线
+	AlertMaintenanceDue     = "maintenance_due"     // 工站触发维护规则，已创建维护工单
+	AlertWIPBlocked         = "wip_blocked"         // 工站在制品达到上限，上游工件被阻塞
+	AlertSLAAtRisk          = "sla_at_risk"         // 工件的预计完工时间晚于交期
+	AlertSLABreached        = "sla_breached"        // 工件超过交期仍未完成或延期完成
+)
+
+// maxAlerts 是看板保留的告警条数，超出时先丢弃最早的已解决告警，没有已解决的告警时才丢弃最早的告警
+const maxAlerts = 200
+
+// ErrAlertNotFound 表示告警不存在或已被丢弃
+var ErrAlertNotFound = errors.New("alert not found")
+
+// ErrAlertTransition 表示告警当前的状态不允许该操作，例如确认或指派已解决的告警
+var ErrAlertTransition = errors.New("invalid alert transition")
+
+// Alert 是推送给看板 (安灯板) 的告警
+type Alert struct {
+	ID         string          `json:"id"`
+	Kind       string          `json:"kind"`     // 告警类型: product_failed / compensation_failed / station_down / queue_backlog / station_anomaly / maintenance_due / wip_blocked / sla_at_risk / sla_breached
+	Severity   string          `json:"severity"` // 告警级别: warning / critical
+	Message    string          `json:"message"`
+	ProductID  string          `json:"product_id,omitempty"` // 关联的工件
+	StationID  types.StationID `json:"station_id,omitempty"` // 关联的工站
+	Namespace  string          `json:"namespace,omitempty"`  // 关联工件所属的命名空间，工站和队列告警属于整个车间，为空
+	State      fsm.AlertState  `json:"state"`                // 处理状态: OPEN / ACKNOWLEDGED / RESOLVED
+	Revision   uint64          `json:"revision"`             // 每次变更加 1，看板据此丢弃乱序到达的旧状态
+	RaisedAt   time.Time       `json:"raised_at"`
+	AckedAt    time.Time       `json:"acked_at,omitzero"` // 确认时间，未确认时为空
+	AckedBy    string          `json:"acked_by,omitempty"`
+	Assignee   string          `json:"assignee,omitempty"` // 负责处理的人员
+	AssignedAt time.Time       `json:"assigned_at,omitzero"`
+	ResolvedAt time.Time       `json:"resolved_at,omitzero"` // 解决时间，未解决时为空
+	ResolvedBy string          `json:"resolved_by,omitempty"`
+	Resolution string          `json:"resolution,omitempty"` // 处理结果说明
+}
+
+// Acked 判断告警是否已被确认
+func (a Alert) Acked() bool {
+	return !a.AckedAt.IsZero()
+}
+
+// Resolved 判断告警是否已解决
+func (a Alert) Resolved() bool {
+	return a.State == fsm.AlertResolved
+}
+
+// alertBoard 是 StateTracker 内部记录的告警，按产生顺序排列
+type alertBoard struct {
+	alerts         []Alert
+	machines       map[string]*fsm.AlertFSM // 各告警的处理状态机，按告警 ID 索引
+	nextID         uint64
+	queueThreshold int  // 队列积压告警的阈值，0 表示不检查
+	queueOver      bool // 队列当前是否超过阈值，回落到阈值以下后才会再次告警
+}
+
+// SetQueueAlertThreshold 设置队列积压告警的阈值，队列长度超过 n 时产生一条告警，n <= 0 时不检查
+func (st *StateTracker) SetQueueAlertThreshold(n int) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.alerts.queueThreshold = n
+}
+
+// RaiseAlert 产生一条告警并广播，返回带有 ID 和产生时间的告警
+func (st *StateTracker) RaiseAlert(a Alert) Alert {
+	st.mu.Lock()
+	msg := st.raiseAlertLocked(a)
+	st.mu.Unlock()
+
+	st.hub.Broadcast(msg)
+	return *msg.Alert
+}
+
+// raiseAlertLocked 记录告警并生成对应的推送消息，调用方必须持有写锁
+func (st *StateTracker) raiseAlertLocked(a Alert) Message {
+	st.alerts.nextID++
+	a.ID = fmt.Sprintf("ALERT_%d", st.alerts.nextID)
+	if a.RaisedAt.IsZero() {
+		a.RaisedAt = time.Now()
+	}
+	if st.alerts.machines == nil {
+		st.alerts.machines = make(map[string]*fsm.AlertFSM)
+	}
+	machine := fsm.NewAlertFSM(a.ID)
+	st.alerts.machines[a.ID] = machine
+	a.State = machine.State()
+	a.Revision = 1
+	st.alerts.alerts = append(st.alerts.alerts, a)
+	st.evictAlertsLocked()
+	st.hub.metrics.AlertsRaisedTotal.WithLabelValues(a.Kind, a.Severity).Inc()
+	st.hub.metrics.AlertsUnresolved.WithLabelValues(a.Severity).Inc()
+	st.seq++
+	return Message{Type: MessageAlert, Seq: st.seq, Alert: &a}
+}
+
+// evictAlertsLocked 丢弃超出 maxAlerts 的告警，调用方必须持有写锁
+// 未解决的告警一直保留在看板上，只有全部是未解决的告警时才丢弃最早的一条
+func (st *StateTracker) evictAlertsLocked() {
+	for len(st.alerts.alerts) > maxAlerts {
+		i := slices.IndexFunc(st.alerts.alerts, Alert.Resolved)
+		if i < 0 {
+			i = 0
+			st.hub.metrics.AlertsUnresolved.WithLabelValues(st.alerts.alerts[i].Severity).Dec()
+		}
+		delete(st.alerts.machines, st.alerts.alerts[i].ID)
+		st.alerts.alerts = slices.Delete(st.alerts.alerts, i, i+1)
+	}
+}
+
+// updateAlert 对一条告警执行 change 并广播变更后的告警
+// change 返回 false 表示告警没有变化 (例如重复确认)，此时不广播，直接返回当前的告警
+// visible 判断调用方能否看到该告警，看不到的告警视同不存在
+func (st *StateTracker) updateAlert(id string, visible func(Alert) bool, change func(a *Alert, machine *fsm.AlertFSM) (bool, error)) (Alert, error) {
+	st.mu.Lock()
+	i := st.alertIndexLocked(id)
+	if i < 0 || !visible(st.alerts.alerts[i]) {
+		st.mu.Unlock()
+		return Alert{}, ErrAlertNotFound
+	}
+	a := &st.alerts.alerts[i]
+	changed, err := change(a, st.alerts.machines[id])
+	if err != nil || !changed {
+		current := *a
+		st.mu.Unlock()
+		return current, err
+	}
+	a.Revision++
+	updated := *a
+	st.seq++
+	msg := Message{Type: MessageAlert, Seq: st.seq, Alert: &updated}
+	st.mu.Unlock()
+
+	st.hub.Broadcast(msg)
+	return updated, nil
+}
+
+// fireAlert 触发告警状态机的事件并同步告警的状态
+func fireAlert(a *Alert, machine *fsm.AlertFSM, ev fsm.AlertEvent) error {
+	if err := machine.Fire(ev); err != nil {
+		return fmt.Errorf("%w: %s 状态的告警不能 %s", ErrAlertTransition, a.State, ev)
+	}
+	a.State = machine.State()
+	return nil
+}
+
+// AckAlert 确认一条告警并广播，重复确认时保留第一次确认的时间和确认人；没有确认就已解决的告警不能再确认
+func (st *StateTracker) AckAlert(id, by string, visible func(Alert) bool) (Alert, error) {
+	return st.updateAlert(id, visible, func(a *Alert, machine *fsm.AlertFSM) (bool, error) {
+		if a.Acked() {
+			return false, nil
+		}
+		if err := fireAlert(a, machine, fsm.AlertEventAck); err != nil {
+			return false, err
+		}
+		a.AckedAt = time.Now()
+		a.AckedBy = by
+		return true, nil
+	})
+}
+
+// AssignAlert 将未解决的告警指派给 assignee 并广播，可以重新指派
+func (st *StateTracker) AssignAlert(id, assignee string, visible func(Alert) bool) (Alert, error) {
+	return st.updateAlert(id, visible, func(a *Alert, _ *fsm.AlertFSM) (bool, error) {
+		if a.Resolved() {
+			return false, fmt.Errorf("%w: 已解决的告警不能指派", ErrAlertTransition)
+		}
+		if a.Assignee == assignee {
+			return false, nil
+		}
+		a.Assignee = assignee
+		a.AssignedAt = time.Now()
+		return true, nil
+	})
+}
+
+// ResolveAlert 解决一条告警并广播，重复解决时保留第一次解决的结果
+func (st *StateTracker) ResolveAlert(id, by, resolution string, visible func(Alert) bool) (Alert, error) {
+	return st.updateAlert(id, visible, func(a *Alert, machine *fsm.AlertFSM) (bool, error) {
+		if a.Resolved() {
+			return false, nil
+		}
+		if err := fireAlert(a, machine, fsm.AlertEventResolve); err != nil {
+			return false, err
+		}
+		a.ResolvedAt = time.Now()
+		a.ResolvedBy = by
+		a.Resolution = resolution
+		st.hub.metrics.AlertsUnresolved.WithLabelValues(a.Severity).Dec()
+		return true, nil
+	})
+}
+
+// alertIndexLocked 返回告警在列表中的位置，不存在时返回 -1，调用方必须持有读锁
+func (st *StateTracker) alertIndexLocked(id string) int {
+	for i, a := range st.alerts.alerts {
+		if a.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Alerts 返回保留的告警，最新的在前
+func (st *StateTracker) Alerts() []Alert {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	return st.alertViewsLocked()
+}
+
+// alertViewsLocked 复制保留的告警，最新的在前，调用方必须持有读锁
+func (st *StateTracker) alertViewsLocked() []Alert {
+	alerts := make([]Alert, 0, len(st.alerts.alerts))
+	alerts = append(alerts, st.alerts.alerts...)
+	slices.Reverse(alerts)
+	return alerts
+}
+
+// checkQueueLocked 在队列长度越过阈值时产生一条积压告警，回落到阈值以下后重新布防
+// 返回 nil 表示无需告警，调用方必须持有写锁
+func (st *StateTracker) checkQueueLocked(length int) *Message {
+	threshold := st.alerts.queueThreshold
+	if threshold <= 0 {
+		return nil
+	}
+	if length <= threshold {
+		st.alerts.queueOver = false
+		return nil
+	}
+	if st.alerts.queueOver {
+		return nil
+	}
+	st.alerts.queueOver = true
+	msg := st.raiseAlertLocked(Alert{
+		Kind:     AlertQueueBacklog,
+		Severity: SeverityWarning,
+		Message:  fmt.Sprintf("调度队列积压 %d 个任务，超过阈值 %d", length, threshold),
+	})
+	return &msg
+}
@@ -0,0 +1,163 @@
+package web
+
+import (
+	"context"
+	"industrial-4.0-demo/internal/types"
+	"slices"
+)
+
+// Filter 定义了客户端的订阅条件
+// 各条件之间为"与"关系，同一条件内的多个取值为"或"关系，空条件表示不限制
+type Filter struct {
+	ProductIDs   []string          `json:"product_ids,omitempty"`   // 只关注指定的工件
+	ProductTypes []string          `json:"product_types,omitempty"` // 只关注指定类型的工件
+	Stations     []types.StationID `json:"stations,omitempty"`      // 只关注位于指定工站的工件
+	Namespaces   []string          `json:"namespaces,omitempty"`    // 只关注指定命名空间 (产线) 的工件
+}
+
+// IsEmpty 判断过滤条件是否为空 (即订阅全部工件)
+func (f Filter) IsEmpty() bool {
+	return len(f.Namespaces) == 0 && !f.selectsProducts()
+}
+
+// selectsProducts 判断是否按工件 ID、类型或工站设置了过滤条件
+// 只按命名空间过滤的客户端看到的仍是整条产线，因此照常接收全部工站和资源池的视图
+func (f Filter) selectsProducts() bool {
+	return len(f.ProductIDs) > 0 || len(f.ProductTypes) > 0 || len(f.Stations) > 0
+}
+
+// Restrict 将过滤条件限制在 scope 中的命名空间内，scope 为空表示不限制
+// 过滤条件中不在 scope 内的命名空间被忽略，全部被忽略时使用 scope 中的全部命名空间
+func (f Filter) Restrict(scope []string) Filter {
+	if len(scope) == 0 {
+		return f
+	}
+	var allowed []string
+	for _, ns := range f.Namespaces {
+		if slices.Contains(scope, ns) {
+			allowed = append(allowed, ns)
+		}
+	}
+	if len(allowed) == 0 {
+		allowed = slices.Clone(scope)
+	}
+	f.Namespaces = allowed
+	return f
+}
+
+// Matches 判断工件当前的状态是否符合过滤条件
+func (f Filter) Matches(p ProductState) bool {
+	if len(f.ProductIDs) > 0 && !slices.Contains(f.ProductIDs, p.ID) {
+		return false
+	}
+	if len(f.ProductTypes) > 0 && !slices.Contains(f.ProductTypes, p.Type) {
+		return false
+	}
+	if len(f.Stations) > 0 && !slices.Contains(f.Stations, p.Station) {
+		return false
+	}
+	if len(f.Namespaces) > 0 && !slices.Contains(f.Namespaces, p.Namespace) {
+		return false
+	}
+	return true
+}
+
+// MatchesStation 判断工站视图是否符合过滤条件
+// 只订阅了工件 (ID 或类型) 的客户端不接收工站视图，订阅了工站的客户端只接收这些工站的视图
+func (f Filter) MatchesStation(id types.StationID) bool {
+	return !f.selectsProducts() || slices.Contains(f.Stations, id)
+}
+
+// trimStation 按命名空间过滤时，从工站视图中去掉客户端看不到的工件，不泄露其他产线的工件 ID
+func (f Filter) trimStation(s StationStatus, visible func(id string) bool) StationStatus {
+	if len(f.Namespaces) == 0 {
+		return s
+	}
+	products := make([]string, 0, len(s.Products))
+	for _, id := range s.Products {
+		if visible(id) {
+			products = append(products, id)
+		}
+	}
+	s.Products = products
+	return s
+}
+
+// MatchesAlert 判断告警是否需要推送给客户端，visible 判断工件当前是否对客户端可见
+// 按工件设置了过滤条件的客户端接收这些工件的告警，以及订阅的工站上的告警 (例如工站宕机)；
+// 其余客户端按命名空间过滤，工站和队列告警属于整个车间，总是推送
+func (f Filter) MatchesAlert(a Alert, visible func(id string) bool) bool {
+	inNamespace := a.Namespace == "" || len(f.Namespaces) == 0 || slices.Contains(f.Namespaces, a.Namespace)
+	if f.selectsProducts() {
+		if a.ProductID != "" && visible(a.ProductID) {
+			return true
+		}
+		return a.StationID != "" && slices.Contains(f.Stations, a.StationID) && inNamespace
+	}
+	return inNamespace
+}
+
+// Apply 返回只包含符合过滤条件的工件、工站、资源池、在制品和告警的状态副本，操作员的负荷不过滤
+// 按工件设置了过滤条件时不包含调度器状态，只按命名空间过滤时调度器状态只包含这些命名空间的任务
+func (f Filter) Apply(state GlobalState) GlobalState {
+	if f.IsEmpty() {
+		return state
+	}
+	filtered := GlobalState{Products: make(map[string]ProductState), Stations: state.Stations, Pools: state.Pools, WIP: state.WIP, Operators: state.Operators, Alerts: []Alert{}}
+	if state.Scheduler != nil && !f.selectsProducts() {
+		scheduler := state.Scheduler.Scoped(f.Namespaces)
+		filtered.Scheduler = &scheduler
+	}
+	for id, p := range state.Products {
+		if f.Matches(p) {
+			filtered.Products[id] = p
+		}
+	}
+	if state.Stations != nil {
+		filtered.Stations = make(map[types.StationID]StationStatus)
+		for id, s := range state.Stations {
+			if f.MatchesStation(id) {
+				filtered.Stations[id] = f.trimStation(s, func(id string) bool {
+					_, ok := filtered.Products[id]
+					return ok
+				})
+			}
+		}
+	}
+	for _, a := range state.Alerts {
+		if f.MatchesAlert(a, func(id string) bool { _, ok := filtered.Products[id]; return ok }) {
+			filtered.Alerts = append(filtered.Alerts, a)
+		}
+	}
+	if state.Pools != nil {
+		filtered.Pools = make(map[types.StationID]PoolStatus)
+		for id, p := range state.Pools {
+			if f.MatchesStation(id) {
+				filtered.Pools[id] = p
+			}
+		}
+	}
+	if state.WIP != nil {
+		filtered.WIP = make(map[types.StationID]WIPStatus)
+		for id, w := range state.WIP {
+			if f.MatchesStation(id) {
+				filtered.WIP[id] = w
+			}
+		}
+	}
+	return filtered
+}
+
+// scopeKey 是 Context 中连接可以访问的命名空间的 key
+type scopeKey struct{}
+
+// WithScope 将连接可以访问的命名空间注入到 Context 中，ServeWs 和 ServeSSE 据此限制客户端的订阅条件
+func WithScope(ctx context.Context, namespaces []string) context.Context {
+	return context.WithValue(ctx, scopeKey{}, namespaces)
+}
+
+// ScopeFromContext 返回 Context 中连接可以访问的命名空间，为空时不限制
+func ScopeFromContext(ctx context.Context) []string {
+	scope, _ := ctx.Value(scopeKey{}).([]string)
+	return scope
+}
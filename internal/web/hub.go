@@ -3,68 +3,331 @@ package web
 import (
 	"encoding/json"
 	"github.com/gorilla/websocket"
+	"industrial-4.0-demo/internal/metrics"
 	"log/slog"
 	"net/http"
 	"sync"
+	"time"
 )
 
-// Hub 负责管理所有的 WebSocket 客户端连接，并向它们广播消息
+// WebSocket 连接的保活参数
+const (
+	writeWait      = 10 * time.Second  // 单次写入 (包括 ping 和关闭帧) 的超时时间
+	pongWait       = 60 * time.Second  // 等待客户端 pong 的最长时间，超时即视为连接已断开
+	pingPeriod     = pongWait * 9 / 10 // 发送 ping 的间隔，必须小于 pongWait
+	maxMessageSize = 4096              // 客户端消息 (订阅请求) 的最大字节数
+	sendBufferSize = 256               // 每个连接的发送缓冲区大小，写满时视为慢速客户端并断开
+)
+
+// client 代表一个订阅了状态推送的客户端及其订阅条件，与具体的传输方式 (WebSocket/SSE) 无关
+// filter 和 visible 只在 Hub 的主循环中访问
+type client struct {
+	remote  string      // 客户端地址，用于日志
+	send    chan []byte // 待发送的消息，由 Hub 关闭以通知传输层退出
+	filter  Filter
+	scope   []string        // 连接可以访问的命名空间，订阅条件总是被限制在其中，为空时不限制
+	visible map[string]bool // 已推送给该客户端且仍符合过滤条件的工件
+}
+
+// accepts 判断一条补丁是否需要推送给该客户端
+// 工件离开订阅范围时 (例如移出订阅的工站) 仍会推送最后一次补丁，以便客户端移除它
+func (c *client) accepts(msg Message) bool {
+	if c.filter.IsEmpty() {
+		return true
+	}
+	if msg.Type == MessageScheduler {
+		// 调度器状态属于全局视图，不推送给按工件设置了过滤条件的客户端
+		return !c.filter.selectsProducts()
+	}
+	if msg.Type == MessageStation {
+		return c.filter.MatchesStation(msg.Station.ID)
+	}
+	if msg.Type == MessagePool {
+		return c.filter.MatchesStation(msg.Pool.ID)
+	}
+	if msg.Type == MessageWIP {
+		return c.filter.MatchesStation(msg.WIP.ID)
+	}
+	if msg.Type == MessageAlert {
+		return c.filter.MatchesAlert(*msg.Alert, func(id string) bool { return c.visible[id] })
+	}
+	if msg.Type == MessageRemove {
+		// 只通知客户端移除它能看到的工件
+		wasVisible := c.visible[msg.ProductID]
+		delete(c.visible, msg.ProductID)
+		return wasVisible
+	}
+	if msg.Product == nil {
+		return true
+	}
+	id := msg.Product.ID
+	wasVisible := c.visible[id]
+	if c.filter.Matches(*msg.Product) {
+		c.visible[id] = true
+		return true
+	}
+	delete(c.visible, id)
+	return wasVisible
+}
+
+// scopedView 按命名空间过滤的客户端收到的工站和调度器消息只包含它能看到的工件，需要单独序列化
+// 返回 false 表示消息无需改写，可以与其他客户端共用序列化结果
+func (c *client) scopedView(msg Message) (Message, bool) {
+	if len(c.filter.Namespaces) == 0 {
+		return msg, false
+	}
+	switch {
+	case msg.Type == MessageStation && msg.Station != nil:
+		station := c.filter.trimStation(*msg.Station, func(id string) bool { return c.visible[id] })
+		msg.Station = &station
+		return msg, true
+	case msg.Type == MessageScheduler && msg.Scheduler != nil:
+		scheduler := msg.Scheduler.Scoped(c.filter.Namespaces)
+		msg.Scheduler = &scheduler
+		return msg, true
+	}
+	return msg, false
+}
+
+// resetView 按当前订阅条件过滤快照，并重置该客户端可见的工件集合
+func (c *client) resetView(msg Message) Message {
+	c.visible = make(map[string]bool)
+	if msg.State == nil || c.filter.IsEmpty() {
+		return msg
+	}
+	state := c.filter.Apply(*msg.State)
+	for id := range state.Products {
+		c.visible[id] = true
+	}
+	msg.State = &state
+	return msg
+}
+
+// newClient 创建一个带发送缓冲区的客户端，订阅条件被限制在 scope 中的命名空间内
+func newClient(remote string, filter Filter, scope []string) *client {
+	return &client{remote: remote, send: make(chan []byte, sendBufferSize), filter: filter.Restrict(scope), scope: scope}
+}
+
+// subscription 是客户端更新订阅条件的请求
+type subscription struct {
+	client *client
+	filter Filter
+}
+
+// Hub 负责管理所有订阅了状态推送的客户端 (WebSocket 和 SSE)，并向它们广播消息
 type Hub struct {
-	clients    map[*websocket.Conn]bool // 存储所有活跃的客户端连接
-	broadcast  chan []byte              // 广播通道，用于接收需要发送给所有客户端的消息
-	register   chan *websocket.Conn     // 注册通道，用于接收新连接
-	unregister chan *websocket.Conn     // 注销通道，用于处理断开的连接
-	mu         sync.Mutex               // 互斥锁，保护 clients 映射的并发访问
+	clients    map[*client]bool                     // 存储所有活跃的客户端连接
+	broadcast  chan Message                         // 广播通道，用于接收需要发送给客户端的消息
+	register   chan *client                         // 注册通道，用于接收新连接
+	unregister chan *client                         // 注销通道，用于处理断开的连接
+	subscribe  chan subscription                    // 订阅通道，用于更新客户端的订阅条件
+	mu         sync.Mutex                           // 互斥锁，保护 clients 映射的并发访问
+	snapshot   func(namespaces []string) Message    // 新客户端连接时发送的首条消息，参数为客户端订阅的命名空间，为 nil 时不发送
+	verify     func(token string) ([]string, error) // 校验 WebSocket 连接令牌并返回连接可以访问的命名空间，为 nil 时不校验
+	done       chan struct{}                        // 停机信号，关闭后 Hub 不再接收新连接和广播
+	closeOnce  sync.Once                            // 保证 Close 只执行一次
+	metrics    *metrics.Metrics
 }
 
-// NewHub 创建一个新的 Hub 实例
-func NewHub() *Hub {
+// NewHub 创建一个新的 Hub 实例，连接数、广播耗时等指标记录到 m
+func NewHub(m *metrics.Metrics) *Hub {
 	return &Hub{
-		broadcast:  make(chan []byte),
-		register:   make(chan *websocket.Conn),
-		unregister: make(chan *websocket.Conn),
-		clients:    make(map[*websocket.Conn]bool),
+		metrics:    m,
+		broadcast:  make(chan Message),
+		register:   make(chan *client),
+		unregister: make(chan *client),
+		subscribe:  make(chan subscription),
+		clients:    make(map[*client]bool),
+		done:       make(chan struct{}),
 	}
 }
 
 // Run 启动 Hub 的主循环，监听并处理来自各个通道的事件
+// 主循环只把消息放入各连接的发送缓冲区，实际写入由每个连接的 writePump 完成，
+// 因此单个慢速或已断开的客户端不会阻塞对其他客户端的广播
 func (h *Hub) Run() {
 	for {
 		select {
-		case conn := <-h.register:
+		case <-h.done:
+			return
+		case c := <-h.register:
 			h.mu.Lock()
-			h.clients[conn] = true
+			if h.isClosed() {
+				close(c.send)
+			} else {
+				h.clients[c] = true
+				h.metrics.WebSocketClients.Inc()
+				// 快照由主循环放入发送缓冲区，保证它先于该客户端之后收到的所有广播
+				h.enqueueSnapshot(c)
+			}
+			h.mu.Unlock()
+		case c := <-h.unregister:
+			h.mu.Lock()
+			h.removeLocked(c)
 			h.mu.Unlock()
-		case conn := <-h.unregister:
+		case sub := <-h.subscribe:
 			h.mu.Lock()
-			if _, ok := h.clients[conn]; ok {
-				delete(h.clients, conn)
-				conn.Close()
+			if _, ok := h.clients[sub.client]; ok {
+				sub.client.filter = sub.filter.Restrict(sub.client.scope)
+				// 订阅条件变化后重新发送过滤后的快照，客户端以此重置本地状态
+				h.enqueueSnapshot(sub.client)
 			}
 			h.mu.Unlock()
-		case message := <-h.broadcast:
+		case msg := <-h.broadcast:
+			start := time.Now()
 			h.mu.Lock()
-			// 向所有连接的客户端广播消息
-			for conn := range h.clients {
-				if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
-					slog.Warn("写入 WebSocket 失败", "error", err)
-					conn.Close()
-					delete(h.clients, conn)
+			var data []byte
+			for c := range h.clients {
+				if !c.accepts(msg) {
+					continue
 				}
+				if view, ok := c.scopedView(msg); ok {
+					h.enqueueMessage(c, view)
+					continue
+				}
+				if data == nil {
+					var err error
+					if data, err = json.Marshal(msg); err != nil {
+						slog.Error("序列化消息失败", "error", err)
+						h.metrics.HubDroppedMessagesTotal.WithLabelValues("marshal_error").Inc()
+						break
+					}
+				}
+				h.enqueue(c, data)
 			}
 			h.mu.Unlock()
+			h.metrics.HubBroadcastDuration.Observe(time.Since(start).Seconds())
 		}
 	}
 }
 
-// BroadcastState 将状态序列化为 JSON 并发送到广播通道
-func (h *Hub) BroadcastState(state interface{}) {
-	message, err := json.Marshal(state)
+// SetSnapshotFunc 设置新客户端连接时发送的首条消息的生成函数，namespaces 为空时生成全部命名空间的快照
+// fn 在 Hub 的主循环中调用，不能反过来阻塞在 Hub 的广播上
+func (h *Hub) SetSnapshotFunc(fn func(namespaces []string) Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.snapshot = fn
+}
+
+// SetTokenVerifier 设置 WebSocket 连接令牌的校验函数，设置后 ServeWs 在升级连接前校验 token 查询参数
+// fn 返回令牌持有者可以访问的命名空间，为空时不限制
+func (h *Hub) SetTokenVerifier(fn func(token string) ([]string, error)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.verify = fn
+}
+
+// enqueueSnapshot 按客户端的订阅条件生成全量快照并放入发送缓冲区
+// 调用方必须持有 h.mu
+func (h *Hub) enqueueSnapshot(c *client) {
+	if h.snapshot == nil {
+		c.visible = make(map[string]bool)
+		return
+	}
+	h.enqueueMessage(c, c.resetView(h.snapshot(c.filter.Namespaces)))
+}
+
+// enqueueMessage 序列化一条只发给该客户端的消息并放入发送缓冲区
+// 调用方必须持有 h.mu
+func (h *Hub) enqueueMessage(c *client, msg Message) {
+	data, err := json.Marshal(msg)
 	if err != nil {
-		slog.Error("序列化状态失败", "error", err)
+		slog.Error("序列化消息失败", "error", err)
+		h.metrics.HubDroppedMessagesTotal.WithLabelValues("marshal_error").Inc()
 		return
 	}
-	h.broadcast <- message
+	h.enqueue(c, data)
+}
+
+// enqueue 将消息放入客户端的发送缓冲区，缓冲区已满时断开该客户端
+// 调用方必须持有 h.mu
+func (h *Hub) enqueue(c *client, data []byte) {
+	select {
+	case c.send <- data:
+	default:
+		slog.Warn("推送客户端消费过慢，断开连接", "remote_addr", c.remote)
+		h.metrics.HubDroppedMessagesTotal.WithLabelValues("slow_client").Inc()
+		h.removeLocked(c)
+	}
+}
+
+// removeLocked 移除客户端并关闭其发送通道，传输层随后会关闭连接
+// 调用方必须持有 h.mu
+func (h *Hub) removeLocked(c *client) {
+	if _, ok := h.clients[c]; ok {
+		delete(h.clients, c)
+		close(c.send)
+		h.metrics.WebSocketClients.Dec()
+	}
+}
+
+// isClosed 判断 Hub 是否已经停机
+func (h *Hub) isClosed() bool {
+	select {
+	case <-h.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// attach 注册一个新的客户端，Hub 已停机时返回 false
+// 客户端的发送通道中的第一条消息是按 filter 过滤后的全量快照
+func (h *Hub) attach(c *client) bool {
+	select {
+	case h.register <- c:
+		return true
+	case <-h.done:
+		return false
+	}
+}
+
+// detach 注销一个客户端，可以对已被移除的客户端重复调用
+func (h *Hub) detach(c *client) {
+	select {
+	case h.unregister <- c:
+	case <-h.done:
+	}
+}
+
+// Subscribe 注册一个进程内的订阅者，用于 gRPC 等不经过 HTTP 的推送方式，Hub 已停机时返回 false
+// 订阅者不能在订阅后修改订阅条件，调用方负责将 filter 限制在调用方可以访问的命名空间内
+// 返回的通道中是与 WebSocket 相同的 JSON 消息，第一条为过滤后的快照；通道被关闭表示订阅者已被 Hub 移除 (停机或消费过慢)
+// 订阅者退出时必须调用 cancel 注销
+func (h *Hub) Subscribe(remote string, filter Filter) (<-chan []byte, func(), bool) {
+	c := newClient(remote, filter, nil)
+	if !h.attach(c) {
+		return nil, nil, false
+	}
+	return c.send, func() { h.detach(c) }, true
+}
+
+// Broadcast 将消息发送到广播通道，由主循环按各客户端的订阅条件推送
+func (h *Hub) Broadcast(msg Message) {
+	select {
+	case h.broadcast <- msg:
+	case <-h.done:
+	}
+}
+
+// Close 停止 Hub 的主循环，并让所有客户端在发送完缓冲区中的消息后收到 1001 (Going Away) 关闭帧
+// 可以安全地多次调用，通常注册为 http.Server 的 RegisterOnShutdown 回调
+func (h *Hub) Close() {
+	h.closeOnce.Do(func() {
+		close(h.done)
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		for c := range h.clients {
+			h.removeLocked(c)
+		}
+	})
+}
+
+// closeGoingAway 发送 1001 (Going Away) 关闭帧并断开连接，用于停机或断开慢速客户端
+func closeGoingAway(conn *websocket.Conn) {
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "")
+	conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(writeWait))
+	conn.Close()
 }
 
 // upgrader 将普通的 HTTP 连接升级为 WebSocket 连接
@@ -77,13 +340,100 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-// ServeWs 处理来自客户端的 WebSocket 请求
+// ServeWs 处理来自客户端的 WebSocket 请求，设置了令牌校验函数时，令牌缺失或无效的请求在升级前以 401 拒绝
 func (h *Hub) ServeWs(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	verify := h.verify
+	h.mu.Unlock()
+	scope := ScopeFromContext(r.Context())
+	if verify != nil {
+		token := r.URL.Query().Get("token")
+		var err error
+		if scope, err = verify(token); err != nil {
+			reason := "invalid"
+			if token == "" {
+				reason = "missing"
+			}
+			h.metrics.AuthFailuresTotal.WithLabelValues(reason).Inc()
+			slog.Warn("WebSocket 令牌校验失败", "error", err, "remote_addr", r.RemoteAddr)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+	}
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		slog.Error("升级 WebSocket 失败", "error", err)
 		return
 	}
-	h.register <- conn
-	// 注意：这里没有启动 read pump，因为我们只关心从服务器到客户端的单向通信
+	c := newClient(r.RemoteAddr, Filter{}, scope)
+	if !h.attach(c) {
+		// 服务正在停机，直接关闭新连接
+		closeGoingAway(conn)
+		return
+	}
+	go h.writePump(conn, c)
+	go h.readPump(conn, c)
+}
+
+// readPump 读取客户端发来的订阅消息和 pong 帧，连接断开或超时未响应 ping 时将客户端注销
+func (h *Hub) readPump(conn *websocket.Conn, c *client) {
+	defer h.detach(c)
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		var msg ClientMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			if _, ok := err.(*json.SyntaxError); ok {
+				slog.Warn("忽略无法解析的 WebSocket 消息", "error", err)
+				continue
+			}
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				slog.Warn("WebSocket 连接异常断开", "error", err)
+			}
+			return
+		}
+		switch msg.Type {
+		case ClientMessageSubscribe:
+			select {
+			case h.subscribe <- subscription{client: c, filter: msg.Filter}:
+			case <-h.done:
+				return
+			}
+		default:
+			slog.Warn("忽略未知类型的 WebSocket 消息", "type", msg.Type)
+		}
+	}
+}
+
+// writePump 将发送缓冲区中的消息写入连接，并定期发送 ping 以探测连接是否存活
+// 发送通道被关闭 (客户端注销或 Hub 停机) 时发送关闭帧并关闭连接，readPump 随之退出
+func (h *Hub) writePump(conn *websocket.Conn, c *client) {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		conn.Close()
+	}()
+	for {
+		select {
+		case data, ok := <-c.send:
+			if !ok {
+				closeGoingAway(conn)
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				slog.Warn("写入 WebSocket 失败", "error", err)
+				h.metrics.PushWriteErrorsTotal.WithLabelValues("websocket").Inc()
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				h.metrics.PushWriteErrorsTotal.WithLabelValues("websocket").Inc()
+				return
+			}
+		}
+	}
 }
@@ -0,0 +1,51 @@
+package web
+
+import "industrial-4.0-demo/internal/types"
+
+// OperatorStatus 是操作员的当前分配和累计负荷，用于在看板上展示人员的工作量
+type OperatorStatus struct {
+	ID          string          `json:"id"`
+	Name        string          `json:"name"`
+	Busy        bool            `json:"busy"`
+	StationID   types.StationID `json:"station_id,omitempty"` // 正在操作的工站
+	ProductID   string          `json:"product_id,omitempty"` // 正在加工的工件
+	Assignments int             `json:"assignments"`          // 累计分配的加工次数
+	BusySeconds float64         `json:"busy_seconds"`         // 累计加工时长，不含进行中的分配
+}
+
+// operatorEntry 是 StateTracker 内部记录的操作员状态
+type operatorEntry struct {
+	status OperatorStatus
+	seq    uint64 // 最近一次应用的变化序号
+}
+
+// ApplyOperator 更新操作员的分配和负荷，并广播
+// seq 不大于已应用序号的变化会被视为旧事件丢弃
+func (st *StateTracker) ApplyOperator(status OperatorStatus, seq uint64) {
+	st.mu.Lock()
+	entry, ok := st.operators[status.ID]
+	if !ok {
+		entry = &operatorEntry{}
+		st.operators[status.ID] = entry
+	}
+	if seq <= entry.seq {
+		st.mu.Unlock()
+		return
+	}
+	entry.status = status
+	entry.seq = seq
+	st.seq++
+	msg := Message{Type: MessageOperator, Seq: st.seq, Operator: &status}
+	st.mu.Unlock()
+
+	st.hub.Broadcast(msg)
+}
+
+// operatorViewsLocked 返回所有操作员的状态，调用方必须持有读锁
+func (st *StateTracker) operatorViewsLocked() map[string]OperatorStatus {
+	views := make(map[string]OperatorStatus, len(st.operators))
+	for id, e := range st.operators {
+		views[id] = e.status
+	}
+	return views
+}
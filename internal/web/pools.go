@@ -0,0 +1,48 @@
+package web
+
+import "industrial-4.0-demo/internal/types"
+
+// PoolStatus 是工站资源池的占用情况，用于在看板上展示产线的瓶颈
+type PoolStatus struct {
+	ID       types.StationID `json:"id"`       // 资源池所属的工站
+	Capacity int             `json:"capacity"` // 资源池容量
+	InUse    int             `json:"in_use"`   // 已占用的资源凭证数
+	Waiting  int             `json:"waiting"`  // 等待资源凭证的工件数
+}
+
+// poolEntry 是 StateTracker 内部记录的资源池状态
+type poolEntry struct {
+	status PoolStatus
+	seq    uint64 // 最近一次应用的占用变化序号
+}
+
+// ApplyPoolUsage 更新资源池的占用情况，并广播
+// seq 不大于已应用序号的变化会被视为旧事件丢弃；seq 为 0 表示工站注册时发布的初始状态
+func (st *StateTracker) ApplyPoolUsage(status PoolStatus, seq uint64) {
+	st.mu.Lock()
+	entry, ok := st.pools[status.ID]
+	if !ok {
+		entry = &poolEntry{}
+		st.pools[status.ID] = entry
+	}
+	if seq != 0 && seq <= entry.seq {
+		st.mu.Unlock()
+		return
+	}
+	entry.status = status
+	entry.seq = seq
+	st.seq++
+	msg := Message{Type: MessagePool, Seq: st.seq, Pool: &status}
+	st.mu.Unlock()
+
+	st.hub.Broadcast(msg)
+}
+
+// poolViewsLocked 返回所有资源池的占用情况，调用方必须持有读锁
+func (st *StateTracker) poolViewsLocked() map[types.StationID]PoolStatus {
+	views := make(map[types.StationID]PoolStatus, len(st.pools))
+	for id, e := range st.pools {
+		views[id] = e.status
+	}
+	return views
+}
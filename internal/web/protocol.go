@@ -0,0 +1,53 @@
+package web
+
+// MessageType 定义了 WebSocket 推送消息的类型
+type MessageType string
+
+const (
+	// MessageSnapshot 是客户端连接或更新订阅后收到的第一条消息，包含 (过滤后的) 全量状态
+	MessageSnapshot MessageType = "snapshot"
+	// MessagePatch 表示单个工件的状态发生了变化，携带该工件的完整最新状态
+	MessagePatch MessageType = "patch"
+	// MessageRemove 表示已结束的工件超过保留时间，已从实时状态中移除
+	MessageRemove MessageType = "remove"
+	// MessageStation 表示单个工站的状态发生了变化，携带该工站的完整最新状态
+	MessageStation MessageType = "station"
+	// MessageScheduler 表示调度器的队列或 worker 占用发生了变化，携带调度器的完整最新状态
+	MessageScheduler MessageType = "scheduler"
+	// MessagePool 表示单个资源池的占用发生了变化，携带该资源池的完整最新状态
+	MessagePool MessageType = "pool"
+	// MessageWIP 表示单个工站的在制品发生了变化，携带该工站的完整最新在制品情况
+	MessageWIP MessageType = "wip"
+	// MessageAlert 表示产生了一条新告警或告警被确认，携带该告警的完整最新状态
+	MessageAlert MessageType = "alert"
+	// MessageOperator 表示单个操作员的分配或负荷发生了变化，携带该操作员的完整最新状态
+	MessageOperator MessageType = "operator"
+)
+
+// Message 是服务端推送给 WebSocket 客户端的消息
+//
+// 每次状态变化都会分配一个单调递增的 Seq。由于广播在锁外进行，客户端收到的补丁可能乱序，
+// 客户端应按工件记录已应用的 Seq（初始为快照的 Seq），丢弃 Seq 不大于该值的补丁。
+type Message struct {
+	Type      MessageType     `json:"type"`
+	Seq       uint64          `json:"seq"`
+	State     *GlobalState    `json:"state,omitempty"`      // 仅 snapshot 消息携带
+	Product   *ProductState   `json:"product,omitempty"`    // 仅 patch 消息携带
+	ProductID string          `json:"product_id,omitempty"` // 仅 remove 消息携带
+	Station   *StationStatus  `json:"station,omitempty"`    // 仅 station 消息携带
+	Scheduler *SchedulerState `json:"scheduler,omitempty"`  // 仅 scheduler 消息携带
+	Pool      *PoolStatus     `json:"pool,omitempty"`       // 仅 pool 消息携带
+	WIP       *WIPStatus      `json:"wip,omitempty"`        // 仅 wip 消息携带
+	Alert     *Alert          `json:"alert,omitempty"`      // 仅 alert 消息携带
+	Operator  *OperatorStatus `json:"operator,omitempty"`   // 仅 operator 消息携带
+}
+
+// ClientMessageSubscribe 是客户端更新订阅条件的消息类型
+const ClientMessageSubscribe = "subscribe"
+
+// ClientMessage 是客户端发送给服务端的消息
+// 例如 {"type": "subscribe", "stations": ["STATION_LAMI"]}，发送空条件可恢复订阅全部工件
+type ClientMessage struct {
+	Type string `json:"type"`
+	Filter
+}
@@ -0,0 +1,102 @@
+package web
+
+import (
+	"slices"
+	"time"
+)
+
+// 调度器运行状态
+const (
+	SchedulerRunning  = "running"  // 正常调度
+	SchedulerDraining = "draining" // 已停止出队，等待执行中的任务结束
+	SchedulerPaused   = "paused"   // 已暂停出队，队列中的任务保持等待
+	SchedulerStandby  = "standby"  // 集群中的跟随者，成为领导者之前不出队
+)
+
+// 调度器的出队方式
+const (
+	DispatchPriority = "priority" // 按优先级和入队顺序出队
+	DispatchPlanned  = "planned"  // 按派工计划出队，计划之后提交的任务排在计划之后
+)
+
+// SchedulerState 是调度器的实时状态，由调度器在每次变化时推送给 StateTracker
+type SchedulerState struct {
+	Status      string           `json:"status"`                     // running / draining / paused / standby
+	Dispatch    string           `json:"dispatch"`                   // 出队方式: priority / planned
+	Workers     int              `json:"workers"`                    // worker 池大小
+	BusyWorkers int              `json:"busy_workers"`               // 正在执行任务的 worker 数
+	Occupancy   float64          `json:"occupancy"`                  // worker 占用率 (%)
+	Queue       []QueueEntry     `json:"queue"`                      // 按出队顺序排列的待处理任务
+	Dispatching string           `json:"dispatching,omitempty"`      // 已出队、正在等待空闲 worker 的任务
+	InFlight    []WorkerState    `json:"in_flight"`                  // 每个 worker 上正在执行的任务
+	Quotas      []NamespaceQuota `json:"namespace_quotas,omitempty"` // 配置了 worker 配额的命名空间及其占用
+}
+
+// NamespaceQuota 是一个命名空间的 worker 配额及其占用
+type NamespaceQuota struct {
+	Namespace string `json:"namespace"`
+	Workers   int    `json:"workers"` // 可以同时占用的 worker 数上限
+	Active    int    `json:"active"`  // 已出队 (等待 worker 或执行中) 的任务数
+}
+
+// QueueEntry 是待处理队列中的一个任务
+type QueueEntry struct {
+	Position  int    `json:"position"` // 出队顺序，从 1 开始
+	ProductID string `json:"product_id"`
+	Type      string `json:"type"`
+	Priority  int    `json:"priority"`
+	Namespace string `json:"namespace"`
+	Planned   bool   `json:"planned,omitempty"` // 按派工计划出队
+}
+
+// WorkerState 是单个 worker 的执行状态
+type WorkerState struct {
+	Worker    int       `json:"worker"`               // worker 编号，从 0 开始
+	ProductID string    `json:"product_id,omitempty"` // 正在执行的任务，空闲时为空
+	StartedAt time.Time `json:"started_at,omitzero"`  // 任务开始执行的时间
+	Namespace string    `json:"namespace,omitempty"`  // 正在执行的任务所属的命名空间
+}
+
+// Scoped 返回只包含 scope 中命名空间的任务的调度器状态副本，scope 为空时原样返回
+// 队列位置保持为在整个共享队列中的位置；执行其他命名空间任务的 worker 只保留开始时间，不显示任务 ID，只保留 scope 中命名空间的配额
+func (s SchedulerState) Scoped(scope []string) SchedulerState {
+	if len(scope) == 0 {
+		return s
+	}
+	queue := make([]QueueEntry, 0, len(s.Queue))
+	for _, e := range s.Queue {
+		if slices.Contains(scope, e.Namespace) {
+			queue = append(queue, e)
+		}
+	}
+	inFlight := make([]WorkerState, len(s.InFlight))
+	for i, w := range s.InFlight {
+		if w.ProductID != "" && !slices.Contains(scope, w.Namespace) {
+			w.ProductID, w.Namespace = "", ""
+		}
+		inFlight[i] = w
+	}
+	var quotas []NamespaceQuota
+	for _, q := range s.Quotas {
+		if slices.Contains(scope, q.Namespace) {
+			quotas = append(quotas, q)
+		}
+	}
+	s.Queue, s.InFlight, s.Quotas = queue, inFlight, quotas
+	return s
+}
+
+// SetSchedulerState 更新调度器状态，并广播；队列长度越过告警阈值时同时广播一条积压告警
+func (st *StateTracker) SetSchedulerState(state SchedulerState) {
+	st.mu.Lock()
+	st.scheduler = &state
+	st.seq++
+	msg := Message{Type: MessageScheduler, Seq: st.seq, Scheduler: &state}
+	alert := st.checkQueueLocked(len(state.Queue))
+	st.mu.Unlock()
+
+	st.hub.Broadcast(msg)
+	if alert != nil {
+		st.hub.Broadcast(*alert)
+	}
+}
@@ -0,0 +1,92 @@
+package web
+
+import (
+	"fmt"
+	"industrial-4.0-demo/internal/types"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ServeSSE 以 Server-Sent Events 的形式推送状态更新，用于无法使用 WebSocket 的环境 (例如被代理拦截)
+// 推送的消息与 WebSocket 完全相同：先是一条快照，之后是增量补丁。
+// 订阅条件通过查询参数传入，例如 ?stations=STATION_LAMI,STATION_DRILL&types=PCB_MULTILAYER&ids=PCB_001&namespaces=line-a
+func (h *Hub) ServeSSE(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	c := newClient(r.RemoteAddr, FilterFromQuery(r.URL.Query()), ScopeFromContext(r.Context()))
+	if !h.attach(c) {
+		http.Error(w, "server shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	defer h.detach(c)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // 禁止 Nginx 等反向代理缓冲事件流
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		slog.Error("SSE 不支持刷新响应", "error", err)
+		return
+	}
+
+	// write 写入一个事件并立即刷新，写入超时视为客户端已断开
+	write := func(event string) bool {
+		rc.SetWriteDeadline(time.Now().Add(writeWait))
+		if _, err := fmt.Fprint(w, event); err != nil {
+			h.metrics.PushWriteErrorsTotal.WithLabelValues("sse").Inc()
+			return false
+		}
+		if err := rc.Flush(); err != nil {
+			h.metrics.PushWriteErrorsTotal.WithLabelValues("sse").Inc()
+			return false
+		}
+		return true
+	}
+
+	// 定期发送注释行作为心跳，避免空闲连接被代理断开，同时及时发现已断开的客户端
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case data, ok := <-c.send:
+			if !ok {
+				// 客户端被 Hub 移除 (停机或消费过慢)，浏览器的 EventSource 会自动重连
+				return
+			}
+			if !write("data: " + string(data) + "\n\n") {
+				return
+			}
+		case <-ticker.C:
+			if !write(": ping\n\n") {
+				return
+			}
+		}
+	}
+}
+
+// FilterFromQuery 从逗号分隔的 ids、types、stations、namespaces 查询参数中解析订阅条件
+func FilterFromQuery(q url.Values) Filter {
+	var f Filter
+	f.ProductIDs = splitList(q.Get("ids"))
+	f.ProductTypes = splitList(q.Get("types"))
+	f.Namespaces = splitList(q.Get("namespaces"))
+	for _, s := range splitList(q.Get("stations")) {
+		f.Stations = append(f.Stations, types.StationID(s))
+	}
+	return f
+}
+
+// splitList 拆分逗号分隔的列表，忽略空项
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -1,82 +1,323 @@
 package web
 
 import (
+	"context"
+	"industrial-4.0-demo/internal/fsm"
 	"industrial-4.0-demo/internal/types"
 	"sync"
+	"time"
 )
 
 // ProductState 定义了用于 UI 展示的工件状态
 // 这是一个简化的视图，只包含前端需要的数据
 type ProductState struct {
-	ID       string                 `json:"id"`
-	Type     string                 `json:"type"`
-	Priority int                    `json:"priority"`
-	Station  types.StationID        `json:"station"`
-	Status   string                 `json:"status"`
-	Attrs    map[string]interface{} `json:"attrs,omitempty"`
+	ID         string                 `json:"id"`
+	Type       string                 `json:"type"`
+	Priority   int                    `json:"priority"`
+	Station    types.StationID        `json:"station"`
+	Status     string                 `json:"status"`
+	Lifecycle  string                 `json:"lifecycle,omitempty"`
+	RetryOf    string                 `json:"retry_of,omitempty"`
+	Lot        string                 `json:"lot,omitempty"`       // 所属批次
+	Serial     string                 `json:"serial,omitempty"`    // 开始生产时分配的序列号
+	Namespace  string                 `json:"namespace,omitempty"` // 所属的命名空间 (产线)
+	Attrs      map[string]interface{} `json:"attrs,omitempty"`
+	Seq        uint64                 `json:"-"` // 最近一次应用的状态转移序号
+	FinishedAt time.Time              `json:"-"` // 进入结束状态的时间，用于保留策略
+}
+
+// isFinished 判断工件是否已结束，结束的工件不会再有状态变化
+func (p ProductState) isFinished() bool {
+	switch fsm.State(p.Status) {
+	case fsm.StateCompleted, fsm.StateCompensated, fsm.StateCancelled:
+		return true
+	}
+	return false
 }
 
 // GlobalState 代表整个工厂车间的实时状态快照
 type GlobalState struct {
-	Products map[string]ProductState `json:"products"`
+	Products  map[string]ProductState           `json:"products"`
+	Stations  map[types.StationID]StationStatus `json:"stations"`
+	Pools     map[types.StationID]PoolStatus    `json:"pools"`               // 按工站 ID 索引的资源池占用情况
+	WIP       map[types.StationID]WIPStatus     `json:"wip"`                 // 按工站 ID 索引的在制品情况
+	Operators map[string]OperatorStatus         `json:"operators"`           // 按操作员 ID 索引的分配和负荷
+	Scheduler *SchedulerState                   `json:"scheduler,omitempty"` // 调度器尚未上报状态时为空
+	Alerts    []Alert                           `json:"alerts"`              // 安灯板上保留的告警，最新的在前
 }
 
-// StateTracker 负责追踪所有工件的实时状态，并通知前端更新
+// StateTracker 负责追踪所有工件的实时状态，并以增量补丁的形式通知前端更新
 type StateTracker struct {
-	mu    sync.RWMutex
-	state GlobalState
-	hub   *Hub
+	mu        sync.RWMutex
+	state     GlobalState
+	seq       uint64                            // 广播序号，每次状态变化递增
+	stations  map[types.StationID]*stationEntry // 工站状态，快照时生成展示视图
+	pools     map[types.StationID]*poolEntry    // 资源池占用情况
+	wip       map[types.StationID]*wipEntry     // 在制品情况
+	operators map[string]*operatorEntry         // 操作员的分配和负荷
+	scheduler *SchedulerState                   // 调度器最近一次上报的状态，上报后不再修改
+	alerts    alertBoard                        // 安灯板上的告警
+	hub       *Hub
+
+	// partitions 按命名空间索引的工件 ID，绑定了命名空间的快照只复制这些命名空间的工件
+	partitions map[string]map[string]struct{}
 }
 
-// NewStateTracker 创建一个新的 StateTracker 实例
+// NewStateTracker 创建一个新的 StateTracker 实例，并向 Hub 注册连接时的全量快照
 func NewStateTracker(hub *Hub) *StateTracker {
-	return &StateTracker{
-		state: GlobalState{Products: make(map[string]ProductState)},
-		hub:   hub,
+	st := &StateTracker{
+		state:      GlobalState{Products: make(map[string]ProductState)},
+		stations:   make(map[types.StationID]*stationEntry),
+		pools:      make(map[types.StationID]*poolEntry),
+		wip:        make(map[types.StationID]*wipEntry),
+		operators:  make(map[string]*operatorEntry),
+		hub:        hub,
+		partitions: make(map[string]map[string]struct{}),
+	}
+	hub.SetSnapshotFunc(st.snapshotMessage)
+	return st
+}
+
+// update 在锁内对已存在的工件应用 fn，fn 返回 true 时分配新的序号并广播该工件的补丁
+// 广播在锁外进行，避免状态更新阻塞在慢速的 WebSocket 客户端上
+func (st *StateTracker) update(id string, fn func(p *ProductState) bool) {
+	st.mu.Lock()
+	product, ok := st.state.Products[id]
+	if !ok || !fn(&product) {
+		st.mu.Unlock()
+		return
+	}
+	msg := st.commitLocked(product)
+	st.mu.Unlock()
+
+	st.hub.Broadcast(msg)
+}
+
+// commitLocked 保存工件状态并生成对应的补丁消息，调用方必须持有写锁
+func (st *StateTracker) commitLocked(product ProductState) Message {
+	if product.isFinished() && product.FinishedAt.IsZero() {
+		product.FinishedAt = time.Now()
 	}
+	st.state.Products[product.ID] = product
+	partition, ok := st.partitions[product.Namespace]
+	if !ok {
+		partition = make(map[string]struct{})
+		st.partitions[product.Namespace] = partition
+	}
+	partition[product.ID] = struct{}{}
+	st.seq++
+	return Message{Type: MessagePatch, Seq: st.seq, Product: &product}
 }
 
-// UpdateProductState 更新单个工件的状态，并向所有客户端广播最新的全局状态
+// UpdateProductState 更新单个工件的工站和状态，并广播
+// 注意：如果工件不存在，这里不会创建。新工件通过 AddProduct 添加。
 func (st *StateTracker) UpdateProductState(id string, station types.StationID, status string) {
+	st.update(id, func(p *ProductState) bool {
+		p.Station = station
+		p.Status = status
+		return true
+	})
+}
+
+// UpdateProductStation 更新工件当前所在的工站，并广播
+func (st *StateTracker) UpdateProductStation(id string, station types.StationID) {
+	st.update(id, func(p *ProductState) bool {
+		p.Station = station
+		return true
+	})
+}
+
+// ApplyStateChange 将 FSM 的状态变更投影到工件的 UI 状态上，并广播
+// 事件处理器是异步执行的，seq 不大于已应用序号的变更会被视为旧事件丢弃；
+// station 不为 nil 时同时更新工件所在的工站
+func (st *StateTracker) ApplyStateChange(id string, status string, seq uint64, station *types.StationID) {
+	st.update(id, func(p *ProductState) bool {
+		if seq <= p.Seq {
+			return false
+		}
+		p.Status = status
+		p.Seq = seq
+		if station != nil {
+			p.Station = *station
+		}
+		return true
+	})
+}
+
+// SetLifecycle 记录工件所使用的生命周期变体
+// 不会触发广播，变更会随下一次补丁一起推送给客户端
+func (st *StateTracker) SetLifecycle(id string, lifecycle string) {
 	st.mu.Lock()
 	defer st.mu.Unlock()
 
 	if product, ok := st.state.Products[id]; ok {
-		product.Station = station
-		product.Status = status
+		product.Lifecycle = lifecycle
 		st.state.Products[id] = product
 	}
-	// 注意：如果工件不存在，这里不会创建。新工件通过 AddProduct 添加。
+}
+
+// SetSerial 记录工件开始生产时分配的序列号
+// 不会触发广播，变更会随下一次补丁一起推送给客户端
+func (st *StateTracker) SetSerial(id string, serial string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
 
-	st.hub.BroadcastState(st.state)
+	if product, ok := st.state.Products[id]; ok {
+		product.Serial = serial
+		st.state.Products[id] = product
+	}
 }
 
 // AddProduct 将一个新产品添加到状态追踪器中，并广播
 func (st *StateTracker) AddProduct(p *types.Product) {
 	st.mu.Lock()
-	defer st.mu.Unlock()
+	msg := st.commitLocked(ProductState{
+		ID:        p.ID,
+		Type:      p.Type,
+		Priority:  p.Priority,
+		Station:   "", // 初始状态在队列中，不在任何工站
+		Status:    "QUEUED",
+		RetryOf:   p.RetryOf,
+		Lot:       p.Lot,
+		Serial:    p.Serial,
+		Namespace: p.Namespace,
+		Attrs:     p.Attrs,
+	})
+	st.mu.Unlock()
 
-	st.state.Products[p.ID] = ProductState{
-		ID:       p.ID,
-		Type:     p.Type,
-		Priority: p.Priority,
-		Station:  "", // 初始状态在队列中，不在任何工站
-		Status:   "QUEUED",
-		Attrs:    p.Attrs,
+	st.hub.Broadcast(msg)
+}
+
+// EvictFinished 移除在 before 之前结束的工件，并为每个工件广播一条移除消息
+// 返回被移除的工件，调用方负责将它们转存到加工履历
+func (st *StateTracker) EvictFinished(before time.Time) []ProductState {
+	st.mu.Lock()
+	var evicted []ProductState
+	var msgs []Message
+	for id, p := range st.state.Products {
+		if p.FinishedAt.IsZero() || !p.FinishedAt.Before(before) {
+			continue
+		}
+		delete(st.state.Products, id)
+		st.removePartitionLocked(p)
+		st.seq++
+		evicted = append(evicted, p)
+		msgs = append(msgs, Message{Type: MessageRemove, Seq: st.seq, ProductID: id})
 	}
-	st.hub.BroadcastState(st.state)
+	st.mu.Unlock()
+
+	for _, msg := range msgs {
+		st.hub.Broadcast(msg)
+	}
+	return evicted
+}
+
+// removePartitionLocked 从命名空间索引中移除工件，命名空间没有工件后删除其索引，调用方必须持有写锁
+func (st *StateTracker) removePartitionLocked(p ProductState) {
+	partition := st.partitions[p.Namespace]
+	delete(partition, p.ID)
+	if len(partition) == 0 {
+		delete(st.partitions, p.Namespace)
+	}
+}
+
+// RunRetention 定期移除结束超过 ttl 的工件，并通过 archive 转存，直到 ctx 被取消
+func (st *StateTracker) RunRetention(ctx context.Context, ttl time.Duration, archive func(ProductState)) {
+	interval := max(ttl/10, time.Second)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, p := range st.EvictFinished(now.Add(-ttl)) {
+				archive(p)
+			}
+		}
+	}
+}
+
+// GetProduct 返回单个工件的当前状态
+func (st *StateTracker) GetProduct(id string) (ProductState, bool) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	product, ok := st.state.Products[id]
+	return product, ok
 }
 
 // GetStateSnapshot 返回当前全局状态的一个深拷贝副本
-// 用于新客户端连接时获取一次全量数据
 func (st *StateTracker) GetStateSnapshot() GlobalState {
 	st.mu.RLock()
 	defer st.mu.RUnlock()
 
+	return st.copyLocked()
+}
+
+// GetNamespaceSnapshot 返回只包含 scope 中命名空间的工件的全局状态副本，scope 为空时等同于 GetStateSnapshot
+// 工件按命名空间索引，快照不复制其他命名空间的工件；工站、资源池等车间视图仍是完整的，需要时由 Filter.Apply 过滤
+func (st *StateTracker) GetNamespaceSnapshot(scope []string) GlobalState {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	return st.namespaceCopyLocked(scope)
+}
+
+// namespaceCopyLocked 复制 scope 中命名空间的工件和完整的车间视图，scope 为空时复制全部工件，调用方必须持有读锁
+func (st *StateTracker) namespaceCopyLocked(scope []string) GlobalState {
+	if len(scope) == 0 {
+		return st.copyLocked()
+	}
+	state := st.viewsLocked(0)
+	for _, ns := range scope {
+		for id := range st.partitions[ns] {
+			state.Products[id] = st.state.Products[id]
+		}
+	}
+	return state
+}
+
+// NamespaceCounts 返回各命名空间中追踪的工件数
+func (st *StateTracker) NamespaceCounts() map[string]int {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	counts := make(map[string]int, len(st.partitions))
+	for ns, partition := range st.partitions {
+		counts[ns] = len(partition)
+	}
+	return counts
+}
+
+// snapshotMessage 生成新客户端连接时发送的全量快照消息，只复制客户端订阅的命名空间中的工件
+func (st *StateTracker) snapshotMessage(namespaces []string) Message {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	state := st.namespaceCopyLocked(namespaces)
+	return Message{Type: MessageSnapshot, Seq: st.seq, State: &state}
+}
+
+// copyLocked 复制当前全局状态，调用方必须持有读锁
+func (st *StateTracker) copyLocked() GlobalState {
 	// 创建深拷贝以避免并发问题
-	newState := GlobalState{Products: make(map[string]ProductState)}
+	newState := st.viewsLocked(len(st.state.Products))
 	for id, p := range st.state.Products {
 		newState.Products[id] = p
 	}
 	return newState
 }
+
+// viewsLocked 生成不含工件的全局状态副本，size 是预留的工件数，调用方必须持有读锁
+func (st *StateTracker) viewsLocked(size int) GlobalState {
+	return GlobalState{
+		Products:  make(map[string]ProductState, size),
+		Stations:  st.stationViewsLocked(time.Now()),
+		Pools:     st.poolViewsLocked(),
+		WIP:       st.wipViewsLocked(),
+		Operators: st.operatorViewsLocked(),
+		Scheduler: st.scheduler,
+		Alerts:    st.alertViewsLocked(),
+	}
+}
@@ -0,0 +1,210 @@
+package web
+
+import (
+	"fmt"
+	"industrial-4.0-demo/internal/fsm"
+	"industrial-4.0-demo/internal/types"
+	"sort"
+	"time"
+)
+
+// 工站健康状态
+const (
+	HealthHealthy   = "healthy"   // 最近的加工均成功
+	HealthDegraded  = "degraded"  // 最近出现了加工失败
+	HealthUnhealthy = "unhealthy" // 连续多次加工失败
+	HealthDown      = "down"      // 工站故障停机或维护中
+)
+
+// unhealthyFailures 是判定工站不健康的连续失败次数
+const unhealthyFailures = 3
+
+// StationStatus 定义了用于 UI 展示的工站状态 (车间的设备视图)
+type StationStatus struct {
+	ID          types.StationID `json:"id"`
+	Status      string          `json:"status"`       // 工站状态机的当前状态: IDLE / BUSY / DOWN / MAINTENANCE
+	Products    []string        `json:"products"`     // 正在加工的工件
+	QueueLength int             `json:"queue_length"` // 等待工站资源的工件数
+	Utilization float64         `json:"utilization"`  // 自开始追踪以来处于 BUSY 状态的时间占比 (%)
+	Health      string          `json:"health"`
+}
+
+// stationEntry 是 StateTracker 内部记录的工站状态
+// 步骤事件是异步投递的，结束事件可能先于开始事件到达，因此加工中和排队中的工件使用计数记录：
+// 开始 +1、结束 -1，计数为 0 时删除，先到的结束事件留下的 -1 会被随后到达的开始事件抵消
+type stationEntry struct {
+	status    string
+	seq       uint64         // 最近一次应用的工站状态转移序号
+	active    map[string]int // 加工中的工件步骤
+	waiting   map[string]int // 等待资源的工件步骤
+	failures  int            // 连续失败次数
+	since     time.Time      // 开始追踪的时间
+	busy      time.Duration  // 累计 BUSY 时长 (不含当前这段)
+	busySince time.Time      // 本次进入 BUSY 的时间
+}
+
+// newStationEntry 创建一个处于 IDLE 状态的工站记录
+func newStationEntry(now time.Time) *stationEntry {
+	return &stationEntry{
+		status:  string(fsm.StationIdle),
+		active:  make(map[string]int),
+		waiting: make(map[string]int),
+		since:   now,
+	}
+}
+
+// setStatus 切换工站状态并累计 BUSY 时长
+func (e *stationEntry) setStatus(status string, now time.Time) {
+	if e.status == string(fsm.StationBusy) && status != e.status {
+		e.busy += now.Sub(e.busySince)
+	}
+	if status == string(fsm.StationBusy) && status != e.status {
+		e.busySince = now
+	}
+	e.status = status
+}
+
+// view 生成工站在 now 时刻的展示状态
+func (e *stationEntry) view(id types.StationID, now time.Time) StationStatus {
+	v := StationStatus{ID: id, Status: e.status, Products: []string{}, Health: HealthHealthy}
+	seen := make(map[string]bool)
+	for key, n := range e.active {
+		if n > 0 {
+			productID := productOfStepKey(key)
+			if !seen[productID] {
+				seen[productID] = true
+				v.Products = append(v.Products, productID)
+			}
+		}
+	}
+	sort.Strings(v.Products)
+	for _, n := range e.waiting {
+		if n > 0 {
+			v.QueueLength++
+		}
+	}
+
+	busy := e.busy
+	if e.status == string(fsm.StationBusy) {
+		busy += now.Sub(e.busySince)
+	}
+	if elapsed := now.Sub(e.since); elapsed > 0 {
+		v.Utilization = float64(busy) / float64(elapsed) * 100
+	}
+
+	switch {
+	case e.status == string(fsm.StationDown) || e.status == string(fsm.StationMaintenance):
+		v.Health = HealthDown
+	case e.failures >= unhealthyFailures:
+		v.Health = HealthUnhealthy
+	case e.failures > 0:
+		v.Health = HealthDegraded
+	}
+	return v
+}
+
+// adjust 调整计数，计数为 0 时删除
+func adjust(counts map[string]int, key string, delta int) {
+	if counts[key] += delta; counts[key] == 0 {
+		delete(counts, key)
+	}
+}
+
+// stepKey 返回工件某个步骤的唯一标识
+func stepKey(productID string, step int) string {
+	return fmt.Sprintf("%s#%d", productID, step)
+}
+
+// productOfStepKey 从步骤标识中取出工件 ID
+func productOfStepKey(key string) string {
+	for i := len(key) - 1; i >= 0; i-- {
+		if key[i] == '#' {
+			return key[:i]
+		}
+	}
+	return key
+}
+
+// updateStation 在锁内对工站记录应用 fn (不存在时创建)，fn 返回 true 时广播该工站的最新状态
+func (st *StateTracker) updateStation(id types.StationID, fn func(e *stationEntry, now time.Time) bool) {
+	now := time.Now()
+	st.mu.Lock()
+	entry, ok := st.stations[id]
+	if !ok {
+		entry = newStationEntry(now)
+		st.stations[id] = entry
+	}
+	if !fn(entry, now) && ok {
+		st.mu.Unlock()
+		return
+	}
+	view := entry.view(id, now)
+	st.seq++
+	msg := Message{Type: MessageStation, Seq: st.seq, Station: &view}
+	st.mu.Unlock()
+
+	st.hub.Broadcast(msg)
+}
+
+// ApplyStationStatus 将工站状态机的状态变更投影到工站视图上，并广播
+// seq 不大于已应用序号的变更会被视为旧事件丢弃；seq 为 0 表示工站注册时发布的初始状态
+func (st *StateTracker) ApplyStationStatus(id types.StationID, status string, seq uint64) {
+	st.updateStation(id, func(e *stationEntry, now time.Time) bool {
+		if seq != 0 && seq <= e.seq {
+			return false
+		}
+		if seq != 0 {
+			e.seq = seq
+		}
+		e.setStatus(status, now)
+		return true
+	})
+}
+
+// StationStepQueued 记录工件开始等待工站资源
+func (st *StateTracker) StationStepQueued(id types.StationID, productID string, step int) {
+	st.updateStation(id, func(e *stationEntry, _ time.Time) bool {
+		adjust(e.waiting, stepKey(productID, step), 1)
+		return true
+	})
+}
+
+// StationStepStarted 记录工件开始在工站上加工
+func (st *StateTracker) StationStepStarted(id types.StationID, productID string, step int) {
+	st.updateStation(id, func(e *stationEntry, _ time.Time) bool {
+		key := stepKey(productID, step)
+		adjust(e.waiting, key, -1)
+		adjust(e.active, key, 1)
+		return true
+	})
+}
+
+// StationStepRejected 记录工件因工站停用而离开等待队列，不计入工站的失败次数
+func (st *StateTracker) StationStepRejected(id types.StationID, productID string, step int) {
+	st.updateStation(id, func(e *stationEntry, _ time.Time) bool {
+		adjust(e.waiting, stepKey(productID, step), -1)
+		return true
+	})
+}
+
+// StationStepCompleted 记录工件在工站上的加工结果，连续失败会降低工站的健康状态
+func (st *StateTracker) StationStepCompleted(id types.StationID, productID string, step int, success bool) {
+	st.updateStation(id, func(e *stationEntry, _ time.Time) bool {
+		adjust(e.active, stepKey(productID, step), -1)
+		if success {
+			e.failures = 0
+		} else {
+			e.failures++
+		}
+		return true
+	})
+}
+
+// stationViewsLocked 生成所有工站的展示状态，调用方必须持有读锁
+func (st *StateTracker) stationViewsLocked(now time.Time) map[types.StationID]StationStatus {
+	views := make(map[types.StationID]StationStatus, len(st.stations))
+	for id, e := range st.stations {
+		views[id] = e.view(id, now)
+	}
+	return views
+}
@@ -0,0 +1,62 @@
+package web
+
+import (
+	"fmt"
+	"industrial-4.0-demo/internal/types"
+)
+
+// WIPStatus 是工站的在制品情况，用于在看板上展示拉动式生产的看板占用和阻塞
+type WIPStatus struct {
+	ID      types.StationID `json:"id"`      // 所属的工站
+	Limit   int             `json:"limit"`   // 在制品上限，0 表示不限制
+	InUse   int             `json:"in_use"`  // 占用看板的工件数
+	Blocked int             `json:"blocked"` // 因在制品达到上限而停留在上游的工件数
+}
+
+// wipEntry 是 StateTracker 内部记录的在制品状态
+type wipEntry struct {
+	status WIPStatus
+	seq    uint64 // 最近一次应用的在制品变化序号
+}
+
+// ApplyWIPUsage 更新工站的在制品情况，并广播
+// seq 不大于已应用序号的变化会被视为旧事件丢弃；工站从没有阻塞变为有工件被阻塞时产生一条告警
+func (st *StateTracker) ApplyWIPUsage(status WIPStatus, seq uint64) {
+	st.mu.Lock()
+	entry, ok := st.wip[status.ID]
+	if !ok {
+		entry = &wipEntry{}
+		st.wip[status.ID] = entry
+	}
+	if seq != 0 && seq <= entry.seq {
+		st.mu.Unlock()
+		return
+	}
+	wasBlocked := entry.status.Blocked > 0
+	entry.status = status
+	entry.seq = seq
+	st.seq++
+	msgs := []Message{{Type: MessageWIP, Seq: st.seq, WIP: &status}}
+	if status.Blocked > 0 && !wasBlocked {
+		msgs = append(msgs, st.raiseAlertLocked(Alert{
+			Kind:      AlertWIPBlocked,
+			Severity:  SeverityWarning,
+			Message:   fmt.Sprintf("工站 %s 在制品已达上限 %d，上游工件等待看板", status.ID, status.Limit),
+			StationID: status.ID,
+		}))
+	}
+	st.mu.Unlock()
+
+	for _, msg := range msgs {
+		st.hub.Broadcast(msg)
+	}
+}
+
+// wipViewsLocked 返回所有工站的在制品情况，调用方必须持有读锁
+func (st *StateTracker) wipViewsLocked() map[types.StationID]WIPStatus {
+	views := make(map[types.StationID]WIPStatus, len(st.wip))
+	for id, e := range st.wip {
+		views[id] = e.status
+	}
+	return views
+}
@@ -0,0 +1,577 @@
+// Package whatif 在虚拟时钟上对产线做确定性的离散事件仿真，用于回答 "如果……会怎样" 的问题
+// 例如增加一台飞针电测设备后交付周期会缩短多少。仿真不真正等待，使用固定种子的随机数，
+// 相同的基线、场景和种子总是得到相同的结果，一次仿真通常只需几毫秒
+package whatif
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"industrial-4.0-demo/internal/simulator"
+	"industrial-4.0-demo/internal/types"
+	"maps"
+	"math/rand"
+	"slices"
+	"strings"
+	"time"
+)
+
+// 仿真规模的上限
+const (
+	MaxOrders    = 100000 // 单个场景最多仿真的订单数
+	MaxScenarios = 10     // 一次请求最多比较的场景数
+
+	defaultOrders = 100 // 场景未指定订单数时仿真的订单数
+)
+
+// ErrInvalidScenario 表示场景的参数无效
+var ErrInvalidScenario = errors.New("invalid scenario")
+
+// Baseline 是仿真使用的产线基线，场景中的覆盖项在此基础上修改
+type Baseline struct {
+	Workers      int                               // 同时执行的任务数
+	Machines     map[types.StationID]int           // 各工站的设备数 (资源池容量)，未配置或为 0 时不限制并发
+	Cycles       map[types.StationID]time.Duration // 各工站的加工时间
+	DefaultCycle time.Duration                     // 未单独配置的工站的加工时间
+	Move         time.Duration                     // 相邻步骤之间的移动时间
+	FailureRates map[types.StationID]float64       // 各工站随机加工失败的概率
+	Routes       func(productType string) []types.WorkflowStep
+}
+
+// Scenario 是一次仿真的输入，零值字段沿用基线或预设场景
+type Scenario struct {
+	Name         string                      `json:"name"`
+	Preset       string                      `json:"preset,omitempty"`        // 使用订单模拟器的内置场景的到达速率和产品配比，例如 bottleneck
+	Seed         int64                       `json:"seed"`                    // 随机数种子，相同的种子得到相同的到达序列和失败序列
+	Rate         float64                     `json:"rate,omitempty"`          // 每分钟平均到达的订单数 (泊松到达)
+	Mix          map[string]int              `json:"mix,omitempty"`           // 产品类型到权重的映射
+	Priorities   map[string]int              `json:"priorities,omitempty"`    // 各产品类型的优先级，默认 0
+	Orders       int                         `json:"orders,omitempty"`        // 仿真的订单数，默认 100
+	Workers      int                         `json:"workers,omitempty"`       // 覆盖 worker 数
+	Machines     map[types.StationID]int     `json:"machines,omitempty"`      // 覆盖工站的设备数，例如 {"STATION_E_TEST": 2}
+	CycleMs      map[types.StationID]int     `json:"cycle_ms,omitempty"`      // 覆盖工站的加工时间 (毫秒)
+	FailureRates map[types.StationID]float64 `json:"failure_rates,omitempty"` // 覆盖工站的失败率
+}
+
+// Stats 是一组时长样本的统计 (秒)
+type Stats struct {
+	Avg float64 `json:"avg"`
+	P50 float64 `json:"p50"`
+	P95 float64 `json:"p95"`
+	Max float64 `json:"max"`
+}
+
+// Queue 是一个队列的统计
+type Queue struct {
+	Wait      Stats   `json:"wait_seconds"` // 排队等待时长
+	AvgLength float64 `json:"avg_length"`   // 按时间加权的平均队列长度
+	MaxLength int     `json:"max_length"`
+}
+
+// StationResult 是单个工站的仿真结果
+type StationResult struct {
+	ID          types.StationID `json:"id"`
+	Machines    int             `json:"machines"`              // 设备数，0 表示不限制并发
+	Processed   int             `json:"processed"`             // 完成的加工次数 (含失败)
+	Failed      int             `json:"failed"`                // 失败的加工次数
+	AvgBusy     float64         `json:"avg_busy"`              // 平均同时加工的工件数
+	Utilization float64         `json:"utilization,omitempty"` // 设备利用率 = 平均同时加工数 / 设备数，不限制并发时为空
+	Queue       Queue           `json:"queue"`                 // 等待设备的队列
+}
+
+// Result 是一个场景的仿真结果，时间均为虚拟时间
+type Result struct {
+	Scenario          string          `json:"scenario"`
+	Seed              int64           `json:"seed"`
+	Orders            int             `json:"orders"`
+	Completed         int             `json:"completed"`
+	Failed            int             `json:"failed"`
+	SimulatedSeconds  float64         `json:"simulated_seconds"`   // 从第一个订单到达到最后一个订单结束
+	ThroughputPerHour float64         `json:"throughput_per_hour"` // 每小时完成的订单数
+	LeadTime          Stats           `json:"lead_time_seconds"`   // 完成的订单从到达到完成的时长
+	Scheduler         Queue           `json:"scheduler_queue"`     // 等待 worker 的调度队列
+	WorkerUtilization float64         `json:"worker_utilization"`
+	Stations          []StationResult `json:"stations"` // 按工站 ID 排序
+}
+
+// Run 在 base 上应用场景的覆盖项并仿真，返回各项统计
+func Run(base Baseline, sc Scenario) (Result, error) {
+	if err := resolve(&sc); err != nil {
+		return Result{}, err
+	}
+	s := newSim(base, sc)
+	for _, productType := range s.kinds {
+		if len(s.route(productType)) == 0 {
+			return Result{}, fmt.Errorf("%w: no workflow for product type %s", ErrInvalidScenario, productType)
+		}
+	}
+	s.run()
+	return s.result(), nil
+}
+
+// resolve 以预设场景补全到达速率和产品配比，并校验参数
+func resolve(sc *Scenario) error {
+	if sc.Preset != "" {
+		i := slices.IndexFunc(simulator.List(), func(p simulator.Scenario) bool { return p.Name == sc.Preset })
+		if i < 0 {
+			return fmt.Errorf("%w: unknown preset %q", ErrInvalidScenario, sc.Preset)
+		}
+		preset := simulator.List()[i]
+		if sc.Rate == 0 {
+			sc.Rate = preset.Rate
+		}
+		if len(sc.Mix) == 0 {
+			sc.Mix = preset.Mix
+		}
+		if len(sc.Mix) == 0 {
+			// 固定订单的场景按订单的产品类型计算配比
+			sc.Mix = make(map[string]int)
+			for _, o := range preset.Orders {
+				sc.Mix[o.Type]++
+			}
+		}
+	}
+	if sc.Orders == 0 {
+		sc.Orders = defaultOrders
+	}
+	// 产品类型和工站 ID 统一为大写，与配置和工作流保持一致
+	sc.Mix = upperKeys(sc.Mix)
+	sc.Priorities = upperKeys(sc.Priorities)
+	sc.Machines = upperKeys(sc.Machines)
+	sc.CycleMs = upperKeys(sc.CycleMs)
+	sc.FailureRates = upperKeys(sc.FailureRates)
+	switch {
+	case sc.Rate <= 0:
+		return fmt.Errorf("%w: rate must be positive", ErrInvalidScenario)
+	case sc.Orders < 0 || sc.Orders > MaxOrders:
+		return fmt.Errorf("%w: orders must be between 1 and %d", ErrInvalidScenario, MaxOrders)
+	case sc.Workers < 0:
+		return fmt.Errorf("%w: workers must not be negative", ErrInvalidScenario)
+	}
+	total := 0
+	for productType, w := range sc.Mix {
+		if w < 0 {
+			return fmt.Errorf("%w: mix weight of %s must not be negative", ErrInvalidScenario, productType)
+		}
+		total += w
+	}
+	if total == 0 {
+		return fmt.Errorf("%w: mix must contain a positive weight", ErrInvalidScenario)
+	}
+	for id, n := range sc.Machines {
+		if n < 0 {
+			return fmt.Errorf("%w: machines of %s must not be negative", ErrInvalidScenario, id)
+		}
+	}
+	for id, ms := range sc.CycleMs {
+		if ms < 0 {
+			return fmt.Errorf("%w: cycle_ms of %s must not be negative", ErrInvalidScenario, id)
+		}
+	}
+	for id, rate := range sc.FailureRates {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("%w: failure rate of %s must be between 0 and 1", ErrInvalidScenario, id)
+		}
+	}
+	return nil
+}
+
+// upperKeys 返回 key 统一为大写的副本，同名的 key 以后出现的为准
+func upperKeys[K ~string, V any](m map[K]V) map[K]V {
+	out := make(map[K]V, len(m))
+	for k, v := range m {
+		out[K(strings.ToUpper(string(k)))] = v
+	}
+	return out
+}
+
+// order 是仿真中的一个订单
+type order struct {
+	priority int
+	steps    []types.WorkflowStep
+	arrived  time.Duration
+	step     int  // 当前步骤
+	pending  int  // 当前步骤中尚未完成的工站数
+	failed   bool // 当前步骤有工站加工失败
+}
+
+// request 是订单对一台设备的占用请求
+type request struct {
+	o  *order
+	at time.Duration // 开始等待的时间
+}
+
+// queueStats 记录一个队列的长度随时间的变化和等待时长
+type queueStats struct {
+	length  int
+	max     int
+	area    float64 // 队列长度对时间的积分 (秒)
+	changed time.Duration
+	waits   []float64
+}
+
+// resize 在 now 时刻将队列长度调整 delta
+func (q *queueStats) resize(now time.Duration, delta int) {
+	q.area += float64(q.length) * (now - q.changed).Seconds()
+	q.changed = now
+	q.length += delta
+	q.max = max(q.max, q.length)
+}
+
+// summary 返回到 end 时刻为止的队列统计
+func (q *queueStats) summary(end time.Duration) Queue {
+	q.resize(end, 0)
+	out := Queue{Wait: stats(q.waits), MaxLength: q.max}
+	if end > 0 {
+		out.AvgLength = q.area / end.Seconds()
+	}
+	return out
+}
+
+// station 是仿真中的一个工站
+type station struct {
+	id        types.StationID
+	machines  int
+	cycle     time.Duration
+	failRate  float64
+	busy      int
+	busyArea  float64
+	changed   time.Duration
+	waiting   []request
+	queue     queueStats
+	processed int
+	failed    int
+}
+
+// setBusy 在 now 时刻将正在加工的工件数调整 delta
+func (st *station) setBusy(now time.Duration, delta int) {
+	st.busyArea += float64(st.busy) * (now - st.changed).Seconds()
+	st.changed = now
+	st.busy += delta
+}
+
+// 事件类型
+const (
+	evArrive = iota // 订单到达
+	evFinish        // 工站完成一次加工
+	evMoved         // 订单移动到下一个步骤
+)
+
+// simEvent 是虚拟时钟上的一个事件，同一时刻按产生的顺序处理
+type simEvent struct {
+	at      time.Duration
+	seq     int
+	kind    int
+	order   *order
+	station *station
+}
+
+// events 是按时间排序的事件堆
+type events []simEvent
+
+func (e events) Len() int { return len(e) }
+func (e events) Less(i, j int) bool {
+	if e[i].at != e[j].at {
+		return e[i].at < e[j].at
+	}
+	return e[i].seq < e[j].seq
+}
+func (e events) Swap(i, j int)       { e[i], e[j] = e[j], e[i] }
+func (e *events) Push(x interface{}) { *e = append(*e, x.(simEvent)) }
+func (e *events) Pop() interface{} {
+	old := *e
+	ev := old[len(old)-1]
+	*e = old[:len(old)-1]
+	return ev
+}
+
+// sim 是一次仿真的状态
+type sim struct {
+	sc       Scenario
+	base     Baseline
+	routes   map[string][]types.WorkflowStep
+	stations map[types.StationID]*station
+	workers  int
+	idle     int
+	busyArea float64 // 忙碌 worker 数对时间的积分
+	changed  time.Duration
+
+	now      time.Duration
+	seq      int
+	events   events
+	ready    []*order // 等待 worker 的订单，按优先级和到达顺序出队
+	sched    queueStats
+	arrivals *rand.Rand // 到达间隔和产品类型，与失败序列分开，调整产能不会改变到达序列
+	failures *rand.Rand
+	kinds    []string // 按名称排序的产品类型，保证按权重抽样的结果确定
+	weights  []int
+	total    int
+
+	last      time.Duration // 最后一个订单结束的时间
+	completed int
+	failed    int
+	leadTimes []float64
+}
+
+// newSim 按基线和场景创建仿真
+func newSim(base Baseline, sc Scenario) *sim {
+	s := &sim{
+		sc:       sc,
+		base:     base,
+		routes:   make(map[string][]types.WorkflowStep),
+		stations: make(map[types.StationID]*station),
+		workers:  max(base.Workers, 1),
+		arrivals: rand.New(rand.NewSource(sc.Seed)),
+		failures: rand.New(rand.NewSource(sc.Seed + 1)),
+	}
+	if sc.Workers > 0 {
+		s.workers = sc.Workers
+	}
+	s.idle = s.workers
+	for _, productType := range slices.Sorted(maps.Keys(sc.Mix)) {
+		if w := sc.Mix[productType]; w > 0 {
+			s.kinds = append(s.kinds, productType)
+			s.weights = append(s.weights, w)
+			s.total += w
+		}
+	}
+	return s
+}
+
+// station 返回工站的仿真状态，首次使用时按基线和场景的覆盖项创建
+func (s *sim) station(id types.StationID) *station {
+	if st, ok := s.stations[id]; ok {
+		return st
+	}
+	st := &station{id: id, machines: s.base.Machines[id], cycle: s.base.DefaultCycle, failRate: s.base.FailureRates[id]}
+	if d, ok := s.base.Cycles[id]; ok {
+		st.cycle = d
+	}
+	if n, ok := s.sc.Machines[id]; ok {
+		st.machines = n
+	}
+	if ms, ok := s.sc.CycleMs[id]; ok {
+		st.cycle = time.Duration(ms) * time.Millisecond
+	}
+	if rate, ok := s.sc.FailureRates[id]; ok {
+		st.failRate = rate
+	}
+	s.stations[id] = st
+	return st
+}
+
+// route 返回产品类型的工艺路线
+func (s *sim) route(productType string) []types.WorkflowStep {
+	steps, ok := s.routes[productType]
+	if !ok {
+		if s.base.Routes != nil {
+			steps = s.base.Routes(productType)
+		}
+		s.routes[productType] = steps
+	}
+	return steps
+}
+
+// schedule 在 at 时刻安排一个事件
+func (s *sim) schedule(ev simEvent) {
+	s.seq++
+	ev.seq = s.seq
+	heap.Push(&s.events, ev)
+}
+
+// run 生成所有订单的到达事件并推进虚拟时钟，直到没有待处理的事件
+func (s *sim) run() {
+	perSecond := s.sc.Rate / 60
+	at := time.Duration(0)
+	for i := 0; i < s.sc.Orders; i++ {
+		if i > 0 {
+			at += time.Duration(s.arrivals.ExpFloat64() / perSecond * float64(time.Second))
+		}
+		typ := s.pick()
+		o := &order{priority: s.sc.Priorities[typ], steps: s.route(typ), arrived: at}
+		s.schedule(simEvent{at: at, kind: evArrive, order: o})
+	}
+	for s.events.Len() > 0 {
+		ev := heap.Pop(&s.events).(simEvent)
+		s.now = ev.at
+		switch ev.kind {
+		case evArrive:
+			s.arrive(ev.order)
+		case evFinish:
+			s.finish(ev.station, ev.order)
+		case evMoved:
+			s.startStep(ev.order)
+		}
+	}
+}
+
+// pick 按配比的权重随机选择产品类型
+func (s *sim) pick() string {
+	n := s.arrivals.Intn(s.total)
+	for i, w := range s.weights {
+		if n < w {
+			return s.kinds[i]
+		}
+		n -= w
+	}
+	return s.kinds[len(s.kinds)-1]
+}
+
+// arrive 订单进入调度队列
+func (s *sim) arrive(o *order) {
+	s.ready = append(s.ready, o)
+	s.sched.resize(s.now, 1)
+	s.dispatch()
+}
+
+// dispatch 在有空闲 worker 时按优先级 (相同时先到先出) 出队
+func (s *sim) dispatch() {
+	for s.idle > 0 && len(s.ready) > 0 {
+		best := 0
+		for i, o := range s.ready {
+			if o.priority > s.ready[best].priority {
+				best = i
+			}
+		}
+		o := s.ready[best]
+		s.ready = slices.Delete(s.ready, best, best+1)
+		s.sched.resize(s.now, -1)
+		s.sched.waits = append(s.sched.waits, (s.now - o.arrived).Seconds())
+		s.setIdle(-1)
+		s.startStep(o)
+	}
+}
+
+// setIdle 在当前时刻将空闲 worker 数调整 delta
+func (s *sim) setIdle(delta int) {
+	s.busyArea += float64(s.workers-s.idle) * (s.now - s.changed).Seconds()
+	s.changed = s.now
+	s.idle += delta
+}
+
+// startStep 开始订单的当前步骤，并行步骤的所有工站同时申请设备
+func (s *sim) startStep(o *order) {
+	if o.step >= len(o.steps) {
+		s.done(o, true)
+		return
+	}
+	ids := o.steps[o.step].StationIDs
+	if len(ids) == 0 {
+		o.step++
+		s.startStep(o)
+		return
+	}
+	o.pending, o.failed = len(ids), false
+	for _, id := range ids {
+		st := s.station(id)
+		if st.machines == 0 || st.busy < st.machines {
+			s.begin(st, request{o: o, at: s.now})
+			continue
+		}
+		st.waiting = append(st.waiting, request{o: o, at: s.now})
+		st.queue.resize(s.now, 1)
+	}
+}
+
+// begin 订单占用工站的一台设备开始加工
+func (s *sim) begin(st *station, req request) {
+	st.queue.waits = append(st.queue.waits, (s.now - req.at).Seconds())
+	st.setBusy(s.now, 1)
+	s.schedule(simEvent{at: s.now + st.cycle, kind: evFinish, order: req.o, station: st})
+}
+
+// finish 工站完成一次加工，释放设备给等待的订单
+func (s *sim) finish(st *station, o *order) {
+	st.setBusy(s.now, -1)
+	st.processed++
+	if st.failRate > 0 && s.failures.Float64() < st.failRate {
+		st.failed++
+		o.failed = true
+	}
+	if len(st.waiting) > 0 {
+		next := st.waiting[0]
+		st.waiting = st.waiting[1:]
+		st.queue.resize(s.now, -1)
+		s.begin(st, next)
+	}
+
+	o.pending--
+	if o.pending > 0 {
+		return
+	}
+	if o.failed {
+		s.done(o, false)
+		return
+	}
+	o.step++
+	if o.step < len(o.steps) && s.base.Move > 0 {
+		s.schedule(simEvent{at: s.now + s.base.Move, kind: evMoved, order: o})
+		return
+	}
+	s.startStep(o)
+}
+
+// done 订单完成或失败，释放 worker
+func (s *sim) done(o *order, ok bool) {
+	if ok {
+		s.completed++
+		s.leadTimes = append(s.leadTimes, (s.now - o.arrived).Seconds())
+	} else {
+		s.failed++
+	}
+	s.last = max(s.last, s.now)
+	s.setIdle(1)
+	s.dispatch()
+}
+
+// result 汇总仿真结果
+func (s *sim) result() Result {
+	end := s.last
+	r := Result{
+		Scenario:         s.sc.Name,
+		Seed:             s.sc.Seed,
+		Orders:           s.sc.Orders,
+		Completed:        s.completed,
+		Failed:           s.failed,
+		SimulatedSeconds: end.Seconds(),
+		LeadTime:         stats(s.leadTimes),
+		Scheduler:        s.sched.summary(end),
+		Stations:         make([]StationResult, 0, len(s.stations)),
+	}
+	s.now = end
+	s.setIdle(0)
+	if end > 0 {
+		r.ThroughputPerHour = float64(s.completed) / end.Hours()
+		r.WorkerUtilization = s.busyArea / end.Seconds() / float64(s.workers)
+	}
+	for _, id := range slices.Sorted(maps.Keys(s.stations)) {
+		st := s.stations[id]
+		st.setBusy(end, 0)
+		sr := StationResult{ID: id, Machines: st.machines, Processed: st.processed, Failed: st.failed, Queue: st.queue.summary(end)}
+		if end > 0 {
+			sr.AvgBusy = st.busyArea / end.Seconds()
+			if st.machines > 0 {
+				sr.Utilization = sr.AvgBusy / float64(st.machines)
+			}
+		}
+		r.Stations = append(r.Stations, sr)
+	}
+	return r
+}
+
+// stats 计算样本的均值、中位数、P95 和最大值
+func stats(samples []float64) Stats {
+	if len(samples) == 0 {
+		return Stats{}
+	}
+	sorted := slices.Clone(samples)
+	slices.Sort(sorted)
+	sum := 0.0
+	for _, v := range sorted {
+		sum += v
+	}
+	at := func(q float64) float64 {
+		return sorted[int(q*float64(len(sorted)-1))]
+	}
+	return Stats{Avg: sum / float64(len(sorted)), P50: at(0.5), P95: at(0.95), Max: sorted[len(sorted)-1]}
+}
@@ -0,0 +1,76 @@
+// Package windowed 提供按时间窗口统计的追踪器 (OEE、产出、可靠性、缺陷、良率和交期) 共用的记录保留和统计窗口
+// 追踪器只保留最近一段时间 (保留时长) 的记录，可查询的最大窗口等于保留时长，窗口的起点不早于追踪器开始记录的时间
+package windowed
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+// ErrTooLarge 表示统计窗口超过了记录的保留时长
+var ErrTooLarge = errors.New("window exceeds retention")
+
+// Retention 是追踪器的记录保留时长和开始记录的时间
+type Retention struct {
+	period  time.Duration
+	started time.Time
+}
+
+// NewRetention 创建一个从现在开始记录、保留 period 时长的保留策略
+func NewRetention(period time.Duration) Retention {
+	return Retention{period: period, started: time.Now()}
+}
+
+// Period 返回记录的保留时长，也是可查询的最大窗口
+func (r Retention) Period() time.Duration {
+	return r.period
+}
+
+// Started 返回开始记录的时间，此前没有任何记录
+func (r Retention) Started() time.Time {
+	return r.started
+}
+
+// Clamp 返回不超过保留时长的窗口，用于定期按固定窗口更新指标
+func (r Retention) Clamp(window time.Duration) time.Duration {
+	return min(window, r.period)
+}
+
+// From 返回截至 now 的 window 时长的统计起点，早于开始记录的时间时从开始记录时算起
+// window 超过保留时长时返回 ErrTooLarge
+func (r Retention) From(window time.Duration, now time.Time) (time.Time, error) {
+	if window > r.period {
+		return time.Time{}, ErrTooLarge
+	}
+	from := now.Add(-window)
+	if from.Before(r.started) {
+		from = r.started
+	}
+	return from, nil
+}
+
+// Cutoff 返回截至 now 需要保留的最早时间，更早的记录可以丢弃
+func (r Retention) Cutoff(now time.Time) time.Time {
+	return now.Add(-r.period)
+}
+
+// Prune 丢弃按时间排序的 records 中早于 cutoff 的记录，at 返回记录的时间
+func Prune[T any](records []T, cutoff time.Time, at func(T) time.Time) []T {
+	i := slices.IndexFunc(records, func(r T) bool { return !at(r).Before(cutoff) })
+	if i < 0 {
+		i = len(records)
+	}
+	return slices.Delete(records, 0, i)
+}
+
+// PruneKeepLast 与 Prune 相同，但保留早于 cutoff 的最后一条记录，用于确定窗口开始时的状态 (例如工站状态变更)
+func PruneKeepLast[T any](records []T, cutoff time.Time, at func(T) time.Time) []T {
+	keep := 0
+	for i, r := range records {
+		if at(r).Before(cutoff) {
+			keep = i
+		}
+	}
+	return slices.Delete(records, 0, keep)
+}
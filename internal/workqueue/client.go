@@ -0,0 +1,132 @@
+package workqueue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"industrial-4.0-demo/internal/types"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// FetchWait 是 worker 拉取任务时长轮询的最长等待时间，需要小于编排器的 server.write_timeout_seconds
+const FetchWait = 20 * time.Second
+
+// Client 是 worker 访问编排器工作队列接口的客户端
+type Client struct {
+	server string // 编排器地址，例如 http://localhost:8080
+	apiKey string // 通过 X-API-Key 传递的 API Key
+	worker string // 本 worker 的 ID
+	http   *http.Client
+}
+
+// NewClient 创建工作队列客户端
+func NewClient(server, apiKey, worker string) *Client {
+	return &Client{
+		server: strings.TrimRight(server, "/"),
+		apiKey: apiKey,
+		worker: worker,
+		http:   &http.Client{Timeout: FetchWait + 10*time.Second},
+	}
+}
+
+var _ Broker = (*Client)(nil)
+
+// Worker 返回本 worker 的 ID
+func (c *Client) Worker() string {
+	return c.worker
+}
+
+// Endpoint 返回编排器地址
+func (c *Client) Endpoint() string {
+	return c.server
+}
+
+// publishRequest 是转发事件的请求体
+type publishRequest struct {
+	Worker string  `json:"worker"`
+	Events []Event `json:"events"`
+}
+
+// ackRequest 是续期和确认的请求体
+type ackRequest struct {
+	Worker     string            `json:"worker"`
+	Product    *types.Product    `json:"product,omitempty"`    // 执行后的工件 (仅确认)
+	Checkpoint *types.Checkpoint `json:"checkpoint,omitempty"` // 最近完成的步骤 (仅续期)
+}
+
+// Fetch 长轮询拉取一个任务，FetchWait 内没有任务时返回 false
+func (c *Client) Fetch(ctx context.Context) (Message, bool, error) {
+	var msg Message
+	query := url.Values{"worker": {c.worker}, "wait": {FetchWait.String()}}
+	status, err := c.do(ctx, "/queue/fetch?"+query.Encode(), nil, &msg)
+	if err != nil || status == http.StatusNoContent {
+		return Message{}, false, err
+	}
+	return msg, true, nil
+}
+
+// Extend 延长投递的确认期限并上报最近完成的步骤 (cp 可以为空)，返回的消息中 Cancelled 表示任务已被取消；
+// 投递已失效时返回 ErrUnknownDelivery
+func (c *Client) Extend(ctx context.Context, id string, cp *types.Checkpoint) (Message, error) {
+	var msg Message
+	_, err := c.do(ctx, "/queue/deliveries/"+url.PathEscape(id)+"/extend", ackRequest{Worker: c.worker, Checkpoint: cp}, &msg)
+	return msg, err
+}
+
+// Ack 确认投递执行结束；投递已失效时返回 ErrUnknownDelivery
+func (c *Client) Ack(ctx context.Context, id string, p *types.Product) error {
+	_, err := c.do(ctx, "/queue/deliveries/"+url.PathEscape(id)+"/ack", ackRequest{Worker: c.worker, Product: p}, nil)
+	return err
+}
+
+// Publish 将事件转发给编排器
+func (c *Client) Publish(ctx context.Context, events []Event) error {
+	_, err := c.do(ctx, "/queue/events", publishRequest{Worker: c.worker, Events: events}, nil)
+	return err
+}
+
+// do 以 POST 发送 JSON 请求并将响应解析到 out，out 为 nil 或响应为 204 时忽略响应体
+// body 为 nil 时不发送请求体，编排器才能在 worker 断开时及时结束长轮询；
+// 集群中的跟随者以 307 重定向到领导者，http.Client 会携带请求体重新发送
+func (c *Client) do(ctx context.Context, path string, body, out any) (int, error) {
+	var reader io.Reader = http.NoBody
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.server+"/api/v1"+path, reader)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound && strings.HasPrefix(path, "/queue/deliveries/"):
+		return resp.StatusCode, ErrUnknownDelivery
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return resp.StatusCode, fmt.Errorf("%s: %d %s", path, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	if out != nil && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, fmt.Errorf("decode response: %w", err)
+		}
+	}
+	return resp.StatusCode, nil
+}
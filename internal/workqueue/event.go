@@ -0,0 +1,85 @@
+package workqueue
+
+import (
+	"errors"
+	"industrial-4.0-demo/internal/event"
+	"industrial-4.0-demo/internal/fsm"
+	"slices"
+)
+
+// Forwarded 是 worker 转发给编排器的事件类型：只包含工件和步骤的事件，
+// 工站状态、资源池、在制品和操作员事件描述的是 worker 本地的资源，不转发
+var Forwarded = []event.EventType{
+	event.ProductStarted,
+	event.ProductCompleted,
+	event.ProductFailed,
+	event.ProductCompensated,
+	event.ProductCancelled,
+	event.StepQueued,
+	event.StepStarted,
+	event.StepCompleted,
+	event.StepCompensated,
+	event.StepRejected,
+	event.StepBlocked,
+	event.StepUnblocked,
+	event.CompensationFailed,
+	event.StateChanged,
+}
+
+// withProduct 是引擎发布时总是附带工件快照的事件类型，编排器的处理器会读取其中的工件
+var withProduct = []event.EventType{
+	event.ProductStarted,
+	event.ProductCompleted,
+	event.ProductFailed,
+	event.ProductCompensated,
+	event.ProductCancelled,
+	event.StepCompleted,
+	event.CompensationFailed,
+}
+
+// Event 是事件在 worker 与编排器之间传输的形式，错误以文本传输
+type Event struct {
+	event.Event
+	Error     string `json:"error,omitempty"`
+	Lifecycle string `json:"lifecycle,omitempty"` // 工件的生命周期变体 (仅开始生产事件)
+}
+
+// Encode 将事件转换为传输形式
+func Encode(e event.Event) Event {
+	out := Event{Event: e}
+	if e.Error != nil {
+		// 内嵌事件的 error 会被编码为 {}，解码时无法还原，只以文本传输
+		out.Error, out.Event.Error = e.Error.Error(), nil
+	}
+	if e.Product != nil {
+		// 引擎发布的是事件发生时的工件快照，处理器之间共享，这里只读取不修改
+		if productFSM, ok := e.Product.FSM.(*fsm.ProductFSM); ok {
+			out.Lifecycle = productFSM.Name()
+		}
+	}
+	return out
+}
+
+// Valid 判断 worker 转发的事件能否发布到编排器的事件总线：类型必须是转发的类型，处理器需要读取工件的事件必须附带工件，
+// 附带的工件带有 ID 时必须与事件的工件 ID 一致 (步骤完成事件只附带类型、命名空间和耗时)
+func (e Event) Valid() bool {
+	if e.ProductID == "" || !slices.Contains(Forwarded, e.Type) {
+		return false
+	}
+	if e.Product == nil {
+		return !slices.Contains(withProduct, e.Type)
+	}
+	return e.Product.ID == "" || e.Product.ID == e.ProductID
+}
+
+// Decode 将传输形式还原为事件，开始生产事件的工件按生命周期变体重新绑定一个状态机，供看板显示生命周期
+func (e Event) Decode() event.Event {
+	out := e.Event
+	if e.Error != "" {
+		out.Error = errors.New(e.Error)
+	}
+	if out.Product != nil && e.Lifecycle != "" {
+		out.Product.FSM = fsm.NewFSMWithVariant(out.ProductID, fsm.Variant(e.Lifecycle))
+	}
+	return out
+}
@@ -0,0 +1,489 @@
+// Package workqueue 将任务的派发与执行拆分到不同的进程：调度器把出队的任务发布到共享的工作队列，
+// 无状态的 worker 进程 (cmd/worker) 拉取任务、用自己的工作流引擎执行，并把产生的事件转发回编排器后确认
+//
+// 队列的语义与 NATS JetStream 的拉取消费者一致：每次投递有确认期限 (ack_wait)，worker 执行期间定期续期，
+// 超过期限未续期或确认的任务重新投递给其他 worker，超过最大投递次数 (max_deliver) 的任务视为失败。
+// 任务只有在 worker 确认后才在 WAL 中标记结束，编排器停机时仍未确认的任务保留在 WAL 中，重启后重新投递，因此任务至少执行一次
+//
+// 队列有两种实现 (queue.backend)：
+//   - memory: Queue，队列保存在编排器 (集群中为领导者) 的内存中，worker 通过编排器的 HTTP API 访问 (Client)，
+//     不需要部署中间件；队列的吞吐受领导者一个进程限制，领导者切换时执行中的投递失效，任务重新执行
+//   - redis: StreamQueue，任务和投递保存在 Redis Streams 中，worker 直接访问 Redis (StreamClient)，
+//     编排器重启或领导者切换后接管 Redis 中仍在等待和执行的投递
+package workqueue
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"industrial-4.0-demo/internal/engine"
+	"industrial-4.0-demo/internal/event"
+	"industrial-4.0-demo/internal/fsm"
+	"industrial-4.0-demo/internal/metrics"
+	"industrial-4.0-demo/internal/serial"
+	"industrial-4.0-demo/internal/types"
+	"industrial-4.0-demo/internal/util"
+	"industrial-4.0-demo/internal/web"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrUnknownDelivery 表示投递不存在：任务已确认、已取消，或者确认期限已过并重新投递给了其他 worker
+var ErrUnknownDelivery = errors.New("unknown delivery")
+
+// DefaultWorkerIdle 是 worker 从队列状态中移除前的默认空闲时间，需要大于长轮询拉取的最长等待时间，否则等待任务的 worker 会被移除
+const DefaultWorkerIdle = time.Minute
+
+// 投递的结果，用于 work_queue_deliveries_total 指标
+const (
+	ResultAcked       = "acked"       // worker 确认执行结束
+	ResultRedelivered = "redelivered" // 确认期限已过，重新投递
+	ResultDead        = "dead"        // 超过最大投递次数，任务失败
+)
+
+// Options 定义工作队列和 worker 进程
+type Options struct {
+	Enabled      bool `mapstructure:"enabled"`        // 启用后调度器不在本进程执行任务，而是发布到队列由 worker 进程执行
+	AckWaitMs    int  `mapstructure:"ack_wait_ms"`    // 投递的确认期限，worker 在期限内没有续期或确认时重新投递
+	MaxDeliver   int  `mapstructure:"max_deliver"`    // 任务的最大投递次数，超过后视为失败，0 表示不限
+	WorkerIdleMs int  `mapstructure:"worker_idle_ms"` // worker 超过该时间没有任何请求时从队列状态中移除，为 0 时使用 DefaultWorkerIdle
+
+	Backend string       `mapstructure:"backend"` // 队列的实现: memory (编排器内存，worker 通过 HTTP API 访问) / redis (Redis Streams)
+	Redis   RedisOptions `mapstructure:"redis"`   // backend 为 redis 时编排器和 worker 连接的 Redis
+
+	// 以下是 worker 进程的配置
+	URL         string   `mapstructure:"url"`         // worker 连接的编排器地址 (memory)
+	APIKey      string   `mapstructure:"api_key"`     // 编排器启用认证时 worker 使用的 API Key，需要 worker 角色 (memory)
+	Namespaces  []string `mapstructure:"namespaces"`  // worker 拉取的命名空间，为空时拉取所有命名空间 (redis；memory 由 API Key 绑定的命名空间决定)
+	WorkerID    string   `mapstructure:"worker_id"`   // 为空时使用主机名和进程号
+	Concurrency int      `mapstructure:"concurrency"` // 每个 worker 进程同时执行的任务数
+}
+
+// 队列的实现
+const (
+	BackendMemory = "memory"
+	BackendRedis  = "redis"
+)
+
+// RedisOptions 定义 Redis Streams 队列的连接
+type RedisOptions struct {
+	Addr     string `mapstructure:"addr"`     // Redis 地址，例如 localhost:6379
+	Username string `mapstructure:"username"` // ACL 用户名，为空时使用 default 用户
+	Password string `mapstructure:"password"`
+	DB       int    `mapstructure:"db"`
+	Prefix   string `mapstructure:"prefix"` // 队列使用的键名前缀，多套系统共用一个 Redis 时区分
+}
+
+// Message 是投递给 worker 的任务
+type Message struct {
+	ID        string        `json:"id"`          // 投递 ID，同一个任务每次投递都不同，续期和确认时使用
+	Product   types.Product `json:"product"`     // 要执行的工件
+	TraceID   string        `json:"trace_id"`    // 调度器出队时生成的 Trace ID
+	Delivery  int           `json:"delivery"`    // 第几次投递，从 1 开始
+	AckWaitMs int           `json:"ack_wait_ms"` // 确认期限，worker 应在期限内续期
+	Cancelled bool          `json:"cancelled"`   // 任务已被取消，worker 应立即停止执行 (续期的响应中使用)
+}
+
+// Lease 是一个正在执行的投递
+type Lease struct {
+	ID        string    `json:"id"`
+	ProductID string    `json:"product_id"`
+	Worker    string    `json:"worker"`
+	Delivery  int       `json:"delivery"`
+	Deadline  time.Time `json:"deadline"`
+	Completed int       `json:"completed_steps"` // worker 上报已完成的步骤数，重新投递时从下一个步骤继续
+}
+
+// Status 是队列的状态，由 GET /api/v1/queue 返回
+type Status struct {
+	Pending     []string             `json:"pending"`     // 等待 worker 拉取的工件，按投递顺序排列
+	Leased      []Lease              `json:"leased"`      // 正在执行的投递
+	Workers     map[string]time.Time `json:"workers"`     // 最近 worker_idle_ms 内拉取、续期、确认或转发过事件的 worker 及其最后一次活动时间
+	Acked       int                  `json:"acked"`       // 累计确认的任务数
+	Redelivered int                  `json:"redelivered"` // 累计重新投递的次数
+	Dead        int                  `json:"dead"`        // 累计因超过最大投递次数而失败的任务数
+	AckWaitMs   int                  `json:"ack_wait_ms"` // 确认期限
+	MaxDeliver  int                  `json:"max_deliver"` // 最大投递次数
+}
+
+// entry 是队列中的一个任务
+type entry struct {
+	product    *types.Product
+	traceID    string
+	delivery   string            // 当前投递的 ID，等待拉取时为空
+	worker     string            // 执行当前投递的 worker
+	deliveries int               // 已投递的次数
+	deadline   time.Time         // 当前投递的确认期限
+	cancelled  bool              // 操作员取消了正在执行的任务，等待 worker 停止后确认
+	checkpoint *types.Checkpoint // worker 最近上报的完成步骤，重新投递时随消息下发
+	done       chan struct{}
+}
+
+// ackedDelivery 是刚确认的投递：worker 异步转发事件，确认后到达的事件在确认期限内仍然接受
+type ackedDelivery struct {
+	worker string
+	until  time.Time
+}
+
+// Queue 是编排器中的共享工作队列，实现 engine.Executor
+type Queue struct {
+	ackWait      time.Duration
+	maxDeliver   int
+	workerIdle   time.Duration
+	bus          *event.Bus
+	stateTracker *web.StateTracker
+	serials      *serial.Generator // 在编排器中分配序列号，保证多个 worker 之间不重复，为 nil 时不分配
+	metrics      *metrics.Metrics
+	logger       *slog.Logger
+	checkpoint   func(p *types.Product, cp types.Checkpoint) // 记录 worker 上报的检查点，为 nil 时不记录
+
+	mu       sync.Mutex
+	pending  []*entry                 // 等待拉取的任务，按投递顺序排列
+	leased   map[string]*entry        // 投递 ID 到正在执行的任务
+	products map[string]*entry        // 工件 ID 到队列中 (等待或执行中) 的任务
+	acked    map[string]ackedDelivery // 工件 ID 到刚确认的投递
+	workers  map[string]time.Time
+	notify   chan struct{} // 有新任务可拉取时关闭并替换，唤醒等待中的 Fetch
+	stats    Status
+	sequence uint64 // 投递序号，用于生成投递 ID
+}
+
+// New 创建一个工作队列
+func New(opts Options, bus *event.Bus, st *web.StateTracker, serials *serial.Generator, m *metrics.Metrics, logger *slog.Logger) *Queue {
+	workerIdle := time.Duration(opts.WorkerIdleMs) * time.Millisecond
+	if workerIdle <= 0 {
+		workerIdle = DefaultWorkerIdle
+	}
+	return &Queue{
+		ackWait:      time.Duration(opts.AckWaitMs) * time.Millisecond,
+		maxDeliver:   opts.MaxDeliver,
+		workerIdle:   workerIdle,
+		bus:          bus,
+		stateTracker: st,
+		serials:      serials,
+		metrics:      m,
+		logger:       logger.With("component", "workqueue"),
+		leased:       make(map[string]*entry),
+		products:     make(map[string]*entry),
+		acked:        make(map[string]ackedDelivery),
+		workers:      make(map[string]time.Time),
+		notify:       make(chan struct{}),
+	}
+}
+
+var _ engine.Executor = (*Queue)(nil)
+
+// SetCheckpointer 设置记录 worker 上报检查点的函数，调度器启用 WAL 时设置为写入编排器的 WAL
+// worker 进程没有 WAL，检查点随续期上报，编排器重启后恢复的任务和重新投递的任务都从下一个步骤继续
+func (q *Queue) SetCheckpointer(fn func(p *types.Product, cp types.Checkpoint)) {
+	q.checkpoint = fn
+}
+
+// Execute 将任务发布到队列并等待 worker 确认，实现 engine.Executor
+// 操作员取消时：任务仍在队列中则直接取消，正在执行则通知 worker 停止并等待确认；
+// 编排器停机时不再等待，返回 false，任务保留在 WAL 中
+func (q *Queue) Execute(ctx context.Context, p *types.Product) bool {
+	if p.Serial == "" {
+		p.Serial = q.serials.Next(p, time.Now())
+	}
+	traceID, _ := util.TraceIDFromContext(ctx)
+	e := &entry{product: p, traceID: traceID, done: make(chan struct{})}
+	q.mu.Lock()
+	q.pending = append(q.pending, e)
+	q.products[p.ID] = e
+	delete(q.acked, p.ID)
+	q.wakeLocked()
+	q.mu.Unlock()
+
+	select {
+	case <-e.done:
+		return true
+	case <-ctx.Done():
+	}
+
+	q.mu.Lock()
+	if !errors.Is(context.Cause(ctx), engine.ErrTaskCancelled) {
+		// 停机：不再投递，worker 之后的续期和确认都会失败
+		q.removeLocked(e)
+		q.mu.Unlock()
+		return false
+	}
+	if e.delivery == "" && q.removeLocked(e) {
+		q.mu.Unlock()
+		finishCancelled(q.bus, q.stateTracker, p, traceID)
+		q.logger.Info("已从工作队列中取消工件", "product_id", p.ID)
+		return true
+	}
+	e.cancelled = true
+	q.mu.Unlock()
+	<-e.done
+	return true
+}
+
+// Fetch 为 worker 取出 namespaces 中的下一个任务 (namespaces 为空时不限制)，没有可取的任务时最多等待 wait，期间没有任务时返回 false
+func (q *Queue) Fetch(ctx context.Context, worker string, namespaces []string, wait time.Duration) (Message, bool) {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		now := time.Now()
+		q.mu.Lock()
+		q.workers[worker] = now
+		q.expireLocked(now)
+		if i := slices.IndexFunc(q.pending, func(e *entry) bool { return inScope(e.product, namespaces) }); i >= 0 {
+			e := q.pending[i]
+			q.pending = slices.Delete(q.pending, i, i+1)
+			q.sequence++
+			e.delivery = fmt.Sprintf("%s-%d", e.product.ID, q.sequence)
+			e.worker = worker
+			e.deliveries++
+			e.deadline = now.Add(q.ackWait)
+			q.leased[e.delivery] = e
+			msg := q.messageLocked(e)
+			q.observeLocked()
+			q.mu.Unlock()
+			q.logger.Debug("任务已投递", "product_id", e.product.ID, "worker", worker, "delivery", e.deliveries)
+			return msg, true
+		}
+		notify := q.notify
+		q.mu.Unlock()
+
+		select {
+		case <-notify:
+		case <-timer.C:
+			return Message{}, false
+		case <-ctx.Done():
+			return Message{}, false
+		}
+	}
+}
+
+// Extend 将投递的确认期限延长一个 ack_wait，返回的消息中 Cancelled 表示任务已被取消
+// cp 不为空时是 worker 最近完成的步骤：记录到 WAL，任务重新投递时从下一个步骤继续
+func (q *Queue) Extend(id, worker string, cp *types.Checkpoint) (Message, error) {
+	now := time.Now()
+	q.mu.Lock()
+	q.workers[worker] = now
+	q.expireLocked(now)
+	e, ok := q.leased[id]
+	if !ok || e.worker != worker {
+		q.mu.Unlock()
+		return Message{}, ErrUnknownDelivery
+	}
+	e.deadline = now.Add(q.ackWait)
+	if cp != nil {
+		e.checkpoint = cp
+	}
+	msg := q.messageLocked(e)
+	q.mu.Unlock()
+
+	if cp != nil && q.checkpoint != nil {
+		q.checkpoint(e.product, *cp)
+	}
+	return msg, nil
+}
+
+// Ack 确认投递执行结束，result 是 worker 执行后的工件
+// 编排器中的工件由事件处理器共享读取，不写回 worker 的结果；工件的状态、步骤和加工历史已经随转发的事件更新
+func (q *Queue) Ack(id, worker string, result types.Product) error {
+	now := time.Now()
+	q.mu.Lock()
+	q.workers[worker] = now
+	e, ok := q.leased[id]
+	if !ok || e.worker != worker {
+		q.mu.Unlock()
+		return ErrUnknownDelivery
+	}
+	delete(q.leased, id)
+	delete(q.products, e.product.ID)
+	q.acked[e.product.ID] = ackedDelivery{worker: worker, until: now.Add(q.ackWait)}
+	q.stats.Acked++
+	q.observeLocked()
+	q.mu.Unlock()
+
+	q.logger.Debug("任务已确认", "product_id", e.product.ID, "worker", worker, "status", result.Status, "step", result.Step)
+	q.metrics.WorkQueueDeliveriesTotal.WithLabelValues(ResultAcked).Inc()
+	close(e.done)
+	return nil
+}
+
+// Publish 将 worker 转发的事件发布到编排器的事件总线，看板、指标和追踪器与本进程执行时一样更新
+// 只接受当前租给该 worker 的工件的事件，以及该 worker 在确认期限内刚确认的工件的事件 (事件是异步转发的，可能晚于确认到达)；
+// 工件已确认、过期、重新投递给其他 worker 或超过最大投递次数后，失效的执行转发的事件被丢弃，不存在的工件的事件同样丢弃
+func (q *Queue) Publish(worker string, events []Event) {
+	now := time.Now()
+	q.mu.Lock()
+	q.workers[worker] = now
+	accepted := events[:0:0]
+	for _, e := range events {
+		if !e.Valid() || !q.holdsLocked(worker, e.ProductID, now) {
+			continue
+		}
+		accepted = append(accepted, e)
+	}
+	q.mu.Unlock()
+	if dropped := len(events) - len(accepted); dropped > 0 {
+		q.logger.Debug("丢弃失效投递的事件", "worker", worker, "events", dropped)
+	}
+	for _, e := range accepted {
+		q.bus.Publish(e.Decode())
+	}
+}
+
+// Run 定期检查确认期限，没有 worker 拉取时也能及时重新投递或使任务失败，直到 ctx 结束
+func (q *Queue) Run(ctx context.Context) {
+	ticker := time.NewTicker(q.ackWait / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			q.mu.Lock()
+			q.expireLocked(now)
+			q.mu.Unlock()
+		}
+	}
+}
+
+// Status 返回队列中等待和执行中的任务以及累计的投递结果
+func (q *Queue) Status() Status {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	status := q.stats
+	status.AckWaitMs = int(q.ackWait / time.Millisecond)
+	status.MaxDeliver = q.maxDeliver
+	status.Pending = make([]string, 0, len(q.pending))
+	for _, e := range q.pending {
+		status.Pending = append(status.Pending, e.product.ID)
+	}
+	status.Leased = make([]Lease, 0, len(q.leased))
+	for id, e := range q.leased {
+		lease := Lease{ID: id, ProductID: e.product.ID, Worker: e.worker, Delivery: e.deliveries, Deadline: e.deadline}
+		if e.checkpoint != nil {
+			lease.Completed = e.checkpoint.Step + 1
+		}
+		status.Leased = append(status.Leased, lease)
+	}
+	slices.SortFunc(status.Leased, func(a, b Lease) int { return a.Deadline.Compare(b.Deadline) })
+	status.Workers = make(map[string]time.Time, len(q.workers))
+	for worker, seen := range q.workers {
+		status.Workers[worker] = seen
+	}
+	return status
+}
+
+// holdsLocked 判断工件当前是否租给 worker，或者刚被 worker 确认且仍在确认期限内，调用方必须持有 q.mu
+func (q *Queue) holdsLocked(worker, productID string, now time.Time) bool {
+	if e, ok := q.products[productID]; ok {
+		return e.delivery != "" && e.worker == worker
+	}
+	a, ok := q.acked[productID]
+	return ok && a.worker == worker && now.Before(a.until)
+}
+
+// inScope 判断工件是否属于 namespaces 中的命名空间，namespaces 为空时不限制
+func inScope(p *types.Product, namespaces []string) bool {
+	return len(namespaces) == 0 || slices.Contains(namespaces, cmp.Or(p.Namespace, types.DefaultNamespace))
+}
+
+// expireLocked 移除空闲的 worker 和超过确认期限的已确认投递，并处理超过确认期限的投递：取消的任务直接结束，未达到最大投递次数的放回队首重新投递，否则使任务失败
+// 调用方必须持有 q.mu
+func (q *Queue) expireLocked(now time.Time) {
+	for id, a := range q.acked {
+		if !now.Before(a.until) {
+			delete(q.acked, id)
+		}
+	}
+	for worker, seen := range q.workers {
+		if now.Sub(seen) > q.workerIdle {
+			delete(q.workers, worker)
+		}
+	}
+	for id, e := range q.leased {
+		if now.Before(e.deadline) {
+			continue
+		}
+		delete(q.leased, id)
+		e.delivery, e.worker = "", ""
+		switch {
+		case e.cancelled:
+			delete(q.products, e.product.ID)
+			finishCancelled(q.bus, q.stateTracker, e.product, e.traceID)
+			close(e.done)
+		case q.maxDeliver > 0 && e.deliveries >= q.maxDeliver:
+			delete(q.products, e.product.ID)
+			q.stats.Dead++
+			q.metrics.WorkQueueDeliveriesTotal.WithLabelValues(ResultDead).Inc()
+			q.logger.Error("任务超过最大投递次数", "product_id", e.product.ID, "deliveries", e.deliveries)
+			finishDead(q.bus, q.stateTracker, e.product, e.traceID, e.deliveries)
+			close(e.done)
+		default:
+			q.stats.Redelivered++
+			q.metrics.WorkQueueDeliveriesTotal.WithLabelValues(ResultRedelivered).Inc()
+			q.logger.Warn("确认期限已过，重新投递任务", "product_id", e.product.ID, "deliveries", e.deliveries)
+			q.pending = append([]*entry{e}, q.pending...)
+			q.wakeLocked()
+		}
+	}
+	q.observeLocked()
+}
+
+// finishCancelled 结束在队列中被取消、worker 还没有开始执行或没有确认的任务
+func finishCancelled(bus *event.Bus, st *web.StateTracker, p *types.Product, traceID string) {
+	st.UpdateProductState(p.ID, "", string(fsm.StateCancelled))
+	bus.Publish(event.Event{Type: event.ProductCancelled, ProductID: p.ID, Product: p.Snapshot(), TraceID: traceID})
+}
+
+// finishDead 使超过最大投递次数仍没有 worker 确认的任务失败
+func finishDead(bus *event.Bus, st *web.StateTracker, p *types.Product, traceID string, deliveries int) {
+	st.UpdateProductState(p.ID, "", string(fsm.StateFailed))
+	bus.Publish(event.Event{Type: event.ProductFailed, ProductID: p.ID, Product: p.Snapshot(), TraceID: traceID,
+		Error: fmt.Errorf("no worker acknowledged the task after %d deliveries", deliveries)})
+}
+
+// removeLocked 从队列中移除任务，返回任务是否仍在等待拉取；调用方必须持有 q.mu
+func (q *Queue) removeLocked(e *entry) bool {
+	if q.products[e.product.ID] == e {
+		delete(q.products, e.product.ID)
+	}
+	if e.delivery != "" {
+		delete(q.leased, e.delivery)
+		q.observeLocked()
+		return false
+	}
+	n := len(q.pending)
+	q.pending = slices.DeleteFunc(q.pending, func(p *entry) bool { return p == e })
+	q.observeLocked()
+	return len(q.pending) < n
+}
+
+// messageLocked 生成任务当前投递的消息，worker 上报过检查点时消息中的工件从检查点继续，调用方必须持有 q.mu
+func (q *Queue) messageLocked(e *entry) Message {
+	product := *e.product
+	if e.checkpoint != nil {
+		product.Resume = e.checkpoint
+	}
+	return Message{
+		ID:        e.delivery,
+		Product:   product,
+		TraceID:   e.traceID,
+		Delivery:  e.deliveries,
+		AckWaitMs: int(q.ackWait / time.Millisecond),
+		Cancelled: e.cancelled,
+	}
+}
+
+// wakeLocked 唤醒等待任务的 Fetch，调用方必须持有 q.mu
+func (q *Queue) wakeLocked() {
+	close(q.notify)
+	q.notify = make(chan struct{})
+}
+
+// observeLocked 更新队列长度指标，调用方必须持有 q.mu
+func (q *Queue) observeLocked() {
+	q.metrics.WorkQueuePending.Set(float64(len(q.pending)))
+	q.metrics.WorkQueueLeased.Set(float64(len(q.leased)))
+}
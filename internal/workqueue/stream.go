@@ -0,0 +1,680 @@
+package workqueue
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"industrial-4.0-demo/internal/engine"
+	"industrial-4.0-demo/internal/event"
+	"industrial-4.0-demo/internal/metrics"
+	"industrial-4.0-demo/internal/serial"
+	"industrial-4.0-demo/internal/types"
+	"industrial-4.0-demo/internal/util"
+	"industrial-4.0-demo/internal/web"
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis Streams 队列的布局：
+//   - <prefix>:tasks:<namespace> 每个命名空间一个任务流，worker 以消费者组 workers 拉取 (XREADGROUP)；
+//     消费者组的待确认列表 (PEL) 记录每个投递由哪个 worker 执行、空闲了多久，续期即把投递重新认领给自己 (XCLAIM)
+//   - <prefix>:events 事件流，worker 的拉取、检查点、确认和转发的事件写入其中，编排器以消费者组 orchestrator 读取
+//   - <prefix>:messages 工件 ID 到当前投递的消息 ID，编排器重启后据此接管仍在等待或执行的投递
+//   - <prefix>:cancelled 已取消的执行中投递，worker 续期时得知任务已取消
+//   - <prefix>:namespaces 有任务流的命名空间，不限制命名空间的 worker 从这些任务流拉取
+//   - <prefix>:workers worker 到最近一次活动的时间
+//
+// 编排器负责任务的生命周期：发布任务、取消、投递超过确认期限时带上最近的检查点重新发布或使任务失败；
+// 续期、确认和重新发布由 Lua 脚本检查待确认列表后原子地完成，过期的投递不能再续期或确认
+const (
+	workerGroup          = "workers"      // worker 拉取任务流的消费者组
+	orchestratorGroup    = "orchestrator" // 编排器读取事件流的消费者组
+	orchestratorConsumer = "orchestrator" // 固定的消费者名称，新的领导者接管上一任读取但未处理完的记录
+	streamBlock          = 2 * time.Second
+	streamBatch          = 100  // 编排器每次读取的事件流记录数
+	pelBatch             = 1000 // 每次检查的待确认投递数上限
+)
+
+// 事件流中的记录类型
+const (
+	recordFetched    = "fetched"    // worker 拉取了投递
+	recordCheckpoint = "checkpoint" // worker 完成了一个步骤
+	recordAck        = "ack"        // worker 确认了投递
+	recordEvents     = "events"     // worker 转发的一批事件
+)
+
+// streamKeys 生成队列在 Redis 中使用的键名
+type streamKeys string
+
+func (k streamKeys) tasks(namespace string) string { return string(k) + ":tasks:" + namespace }
+func (k streamKeys) events() string                { return string(k) + ":events" }
+func (k streamKeys) messages() string              { return string(k) + ":messages" }
+func (k streamKeys) cancelled() string             { return string(k) + ":cancelled" }
+func (k streamKeys) namespaces() string            { return string(k) + ":namespaces" }
+func (k streamKeys) workers() string               { return string(k) + ":workers" }
+
+// streamField 是 Lua 脚本中读取消息字段的函数
+const streamField = `
+local function field(values, name)
+  for i = 1, #values, 2 do
+    if values[i] == name then return values[i + 1] end
+  end
+  return ''
+end
+`
+
+// extendScript 延长投递的确认期限：投递必须仍由该 worker 持有且没有过期；有检查点时写入事件流
+// 返回 -1 表示投递已失效，1 表示任务已取消，0 表示继续执行
+// KEYS: 任务流、已取消的投递、事件流；ARGV: 消息 ID、worker、确认期限 (毫秒)、检查点 (可以为空)
+var extendScript = redis.NewScript(streamField + `
+local p = redis.call('XPENDING', KEYS[1], 'workers', ARGV[1], ARGV[1], 1)
+if #p == 0 or p[1][2] ~= ARGV[2] or p[1][3] >= tonumber(ARGV[3]) then return -1 end
+redis.call('XCLAIM', KEYS[1], 'workers', ARGV[2], 0, ARGV[1], 'JUSTID')
+if ARGV[4] ~= '' then
+  local m = redis.call('XRANGE', KEYS[1], ARGV[1], ARGV[1])
+  redis.call('XADD', KEYS[3], '*', 'type', 'checkpoint', 'worker', ARGV[2], 'product_id', field(m[1][2], 'product_id'), 'message', ARGV[1], 'data', ARGV[4])
+end
+return redis.call('SISMEMBER', KEYS[2], ARGV[1])
+`)
+
+// ackScript 确认投递执行结束：投递必须仍由该 worker 持有；从任务流中删除投递并把确认写入事件流
+// 返回 -1 表示投递已失效，1 表示已确认
+// KEYS: 任务流、已取消的投递、事件流、工件的当前投递；ARGV: 消息 ID、worker、执行后的工件
+var ackScript = redis.NewScript(streamField + `
+local p = redis.call('XPENDING', KEYS[1], 'workers', ARGV[1], ARGV[1], 1)
+if #p == 0 or p[1][2] ~= ARGV[2] then return -1 end
+local m = redis.call('XRANGE', KEYS[1], ARGV[1], ARGV[1])
+if #m == 0 then return -1 end
+local id = field(m[1][2], 'product_id')
+redis.call('XACK', KEYS[1], 'workers', ARGV[1])
+redis.call('XDEL', KEYS[1], ARGV[1])
+redis.call('SREM', KEYS[2], ARGV[1])
+if redis.call('HGET', KEYS[4], id) == ARGV[1] then redis.call('HDEL', KEYS[4], id) end
+redis.call('XADD', KEYS[3], '*', 'type', 'ack', 'worker', ARGV[2], 'product_id', id, 'message', ARGV[1], 'data', ARGV[3])
+return 1
+`)
+
+// cancelScript 取消投递：还没有被拉取的投递直接删除，执行中的投递标记为已取消，由 worker 在续期时得知
+// 返回 1 表示已删除，0 表示已标记，-1 表示投递已经确认或重新发布
+// KEYS: 任务流、已取消的投递、工件的当前投递；ARGV: 消息 ID、工件 ID
+var cancelScript = redis.NewScript(`
+if #redis.call('XPENDING', KEYS[1], 'workers', ARGV[1], ARGV[1], 1) > 0 then
+  redis.call('SADD', KEYS[2], ARGV[1])
+  return 0
+end
+if redis.call('XDEL', KEYS[1], ARGV[1]) == 0 then return -1 end
+if redis.call('HGET', KEYS[3], ARGV[2]) == ARGV[1] then redis.call('HDEL', KEYS[3], ARGV[2]) end
+return 1
+`)
+
+// redeliverScript 结束超过确认期限的投递，消息不为空时作为新的投递重新发布
+// 返回 0 表示投递已续期或确认，不再处理；否则返回新投递的消息 ID，没有重新发布时为空
+// KEYS: 任务流、已取消的投递、工件的当前投递；ARGV: 消息 ID、确认期限 (毫秒)、工件 ID、新的消息
+var redeliverScript = redis.NewScript(`
+local p = redis.call('XPENDING', KEYS[1], 'workers', ARGV[1], ARGV[1], 1)
+if #p == 0 or p[1][3] < tonumber(ARGV[2]) then return 0 end
+redis.call('XACK', KEYS[1], 'workers', ARGV[1])
+redis.call('XDEL', KEYS[1], ARGV[1])
+redis.call('SREM', KEYS[2], ARGV[1])
+if ARGV[4] == '' then
+  redis.call('HDEL', KEYS[3], ARGV[3])
+  return ''
+end
+local id = redis.call('XADD', KEYS[1], '*', 'product_id', ARGV[3], 'data', ARGV[4])
+redis.call('HSET', KEYS[3], ARGV[3], id)
+return id
+`)
+
+// newRedisClient 按配置创建 Redis 客户端
+func newRedisClient(opts RedisOptions) *redis.Client {
+	return redis.NewClient(&redis.Options{Addr: opts.Addr, Username: opts.Username, Password: opts.Password, DB: opts.DB})
+}
+
+// deliveryID 生成 worker 续期和确认时使用的投递 ID: <命名空间>/<消息 ID>
+func deliveryID(namespace, message string) string {
+	return namespace + "/" + message
+}
+
+// parseDelivery 解析投递 ID，返回命名空间和消息 ID
+func parseDelivery(id string) (string, string, bool) {
+	namespace, message, ok := strings.Cut(id, "/")
+	return namespace, message, ok && types.IsValidNamespace(namespace) && message != ""
+}
+
+// compareStreamID 按先后顺序比较两个消息 ID (<毫秒>-<序号>)
+func compareStreamID(a, b string) int {
+	parse := func(id string) (uint64, uint64) {
+		ms, seq, _ := strings.Cut(id, "-")
+		m, _ := strconv.ParseUint(ms, 10, 64)
+		s, _ := strconv.ParseUint(seq, 10, 64)
+		return m, s
+	}
+	am, as := parse(a)
+	bm, bs := parse(b)
+	return cmp.Or(cmp.Compare(am, bm), cmp.Compare(as, bs))
+}
+
+// ensureGroup 创建消费者组 (以及不存在的流)，消费者组已存在时忽略
+func ensureGroup(ctx context.Context, rdb *redis.Client, stream, group string) error {
+	err := rdb.XGroupCreateMkStream(ctx, stream, group, "0").Err()
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+	return err
+}
+
+// streamEntry 是编排器跟踪的一个任务
+type streamEntry struct {
+	product    *types.Product
+	traceID    string
+	namespace  string
+	message    string            // 当前投递在任务流中的消息 ID
+	worker     string            // 拉取了当前投递的 worker，没有被拉取时为空
+	deliveries int               // 已投递的次数
+	cancelled  bool              // 操作员取消了正在执行的任务，等待 worker 停止后确认
+	checkpoint *types.Checkpoint // worker 最近上报的完成步骤，重新发布时随消息下发
+	done       chan struct{}
+}
+
+// StreamQueue 是保存在 Redis Streams 中的共享工作队列，实现 engine.Executor
+type StreamQueue struct {
+	rdb          *redis.Client
+	keys         streamKeys
+	ackWait      time.Duration
+	maxDeliver   int
+	workerIdle   time.Duration
+	bus          *event.Bus
+	stateTracker *web.StateTracker
+	serials      *serial.Generator // 在编排器中分配序列号，保证多个 worker 之间不重复，为 nil 时不分配
+	metrics      *metrics.Metrics
+	logger       *slog.Logger
+	checkpoint   func(p *types.Product, cp types.Checkpoint) // 记录 worker 上报的检查点，为 nil 时不记录
+
+	mu       sync.Mutex
+	products map[string]*streamEntry  // 工件 ID 到等待或执行中的任务
+	acked    map[string]ackedDelivery // 工件 ID 到刚确认的投递
+	groups   map[string]bool          // 已创建消费者组的任务流
+	stats    Status
+}
+
+// NewStream 创建 Redis Streams 工作队列，连接 opts.Redis
+func NewStream(opts Options, bus *event.Bus, st *web.StateTracker, serials *serial.Generator, m *metrics.Metrics, logger *slog.Logger) *StreamQueue {
+	workerIdle := time.Duration(opts.WorkerIdleMs) * time.Millisecond
+	if workerIdle <= 0 {
+		workerIdle = DefaultWorkerIdle
+	}
+	return &StreamQueue{
+		rdb:          newRedisClient(opts.Redis),
+		keys:         streamKeys(opts.Redis.Prefix),
+		ackWait:      time.Duration(opts.AckWaitMs) * time.Millisecond,
+		maxDeliver:   opts.MaxDeliver,
+		workerIdle:   workerIdle,
+		bus:          bus,
+		stateTracker: st,
+		serials:      serials,
+		metrics:      m,
+		logger:       logger.With("component", "workqueue", "backend", BackendRedis),
+		products:     make(map[string]*streamEntry),
+		acked:        make(map[string]ackedDelivery),
+		groups:       make(map[string]bool),
+	}
+}
+
+var _ engine.Executor = (*StreamQueue)(nil)
+
+// SetCheckpointer 设置记录 worker 上报检查点的函数，调度器启用 WAL 时设置为写入编排器的 WAL
+func (q *StreamQueue) SetCheckpointer(fn func(p *types.Product, cp types.Checkpoint)) {
+	q.checkpoint = fn
+}
+
+// Close 关闭 Redis 连接
+func (q *StreamQueue) Close() error {
+	return q.rdb.Close()
+}
+
+// Execute 将任务发布到所属命名空间的任务流并等待 worker 确认，实现 engine.Executor
+// Redis 中已有该工件的投递 (编排器重启或领导者切换前发布的) 时接管它，不重复发布；Redis 不可用时重试直到 ctx 结束
+// 操作员取消时：任务还没有被拉取则直接取消，正在执行则通知 worker 停止并等待确认；
+// 编排器停机时不再等待，返回 false，投递保留在 Redis 中，任务保留在 WAL 中
+func (q *StreamQueue) Execute(ctx context.Context, p *types.Product) bool {
+	if p.Serial == "" {
+		p.Serial = q.serials.Next(p, time.Now())
+	}
+	traceID, _ := util.TraceIDFromContext(ctx)
+	e := &streamEntry{product: p, traceID: traceID, namespace: cmp.Or(p.Namespace, types.DefaultNamespace), done: make(chan struct{})}
+	for {
+		err := q.enqueue(ctx, e)
+		if err == nil {
+			break
+		}
+		q.logger.Warn("发布任务失败", "product_id", p.ID, "error", err)
+		select {
+		case <-ctx.Done():
+			if !errors.Is(context.Cause(ctx), engine.ErrTaskCancelled) {
+				return false
+			}
+			finishCancelled(q.bus, q.stateTracker, p, traceID)
+			return true
+		case <-time.After(retryDelay):
+		}
+	}
+
+	select {
+	case <-e.done:
+		return true
+	case <-ctx.Done():
+	}
+
+	q.mu.Lock()
+	if !errors.Is(context.Cause(ctx), engine.ErrTaskCancelled) {
+		// 停机：不再跟踪，投递留在 Redis 中由重启后的编排器或新的领导者接管
+		q.removeLocked(e)
+		q.mu.Unlock()
+		return false
+	}
+	stream := q.keys.tasks(e.namespace)
+	removed, err := cancelScript.Run(context.Background(), q.rdb, []string{stream, q.keys.cancelled(), q.keys.messages()}, e.message, p.ID).Int()
+	if err != nil {
+		q.logger.Warn("取消投递失败，等待确认期限后结束", "product_id", p.ID, "error", err)
+	}
+	if err == nil && removed == 1 {
+		q.removeLocked(e)
+		q.mu.Unlock()
+		finishCancelled(q.bus, q.stateTracker, p, traceID)
+		q.logger.Info("已从工作队列中取消工件", "product_id", p.ID)
+		return true
+	}
+	e.cancelled = true
+	q.mu.Unlock()
+	<-e.done
+	return true
+}
+
+// enqueue 接管 Redis 中该工件仍在等待或执行的投递，没有时发布新的投递，之后开始跟踪任务
+func (q *StreamQueue) enqueue(ctx context.Context, e *streamEntry) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stream := q.keys.tasks(e.namespace)
+	adopted, err := q.adoptLocked(ctx, e, stream)
+	if err != nil {
+		return err
+	}
+	if !adopted {
+		if !q.groups[stream] {
+			if err := ensureGroup(ctx, q.rdb, stream, workerGroup); err != nil {
+				return err
+			}
+			if err := q.rdb.SAdd(ctx, q.keys.namespaces(), e.namespace).Err(); err != nil {
+				return err
+			}
+			q.groups[stream] = true
+		}
+		e.deliveries = 1
+		data, err := json.Marshal(q.messageLocked(e))
+		if err != nil {
+			return err
+		}
+		id, err := q.rdb.XAdd(ctx, &redis.XAddArgs{Stream: stream, Values: []any{"product_id", e.product.ID, "data", data}}).Result()
+		if err != nil {
+			return err
+		}
+		if err := q.rdb.HSet(ctx, q.keys.messages(), e.product.ID, id).Err(); err != nil {
+			return err
+		}
+		e.message = id
+	}
+	q.products[e.product.ID] = e
+	delete(q.acked, e.product.ID)
+	return nil
+}
+
+// adoptLocked 查找 Redis 中该工件仍在等待或执行的投递，找到时接管它的投递次数、检查点和执行的 worker
+// 调用方必须持有 q.mu
+func (q *StreamQueue) adoptLocked(ctx context.Context, e *streamEntry, stream string) (bool, error) {
+	id, err := q.rdb.HGet(ctx, q.keys.messages(), e.product.ID).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	messages, err := q.rdb.XRange(ctx, stream, id, id).Result()
+	if err != nil || len(messages) == 0 {
+		return false, err
+	}
+	var msg Message
+	if data, _ := messages[0].Values["data"].(string); json.Unmarshal([]byte(data), &msg) != nil {
+		return false, nil
+	}
+	pending, err := q.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{Stream: stream, Group: workerGroup, Start: id, End: id, Count: 1}).Result()
+	if err != nil {
+		return false, err
+	}
+	e.message, e.deliveries, e.checkpoint = id, msg.Delivery, msg.Product.Resume
+	if len(pending) > 0 {
+		e.worker = pending[0].Consumer
+	}
+	q.logger.Info("接管 Redis 中未完成的投递", "product_id", e.product.ID, "delivery", e.deliveries, "worker", e.worker)
+	return true, nil
+}
+
+// Run 读取 worker 写入事件流的记录，并定期检查确认期限，直到 ctx 结束
+// 集群中只有领导者运行，否则跟随者会读走领导者跟踪的任务的记录
+func (q *StreamQueue) Run(ctx context.Context) {
+	go q.consume(ctx)
+	ticker := time.NewTicker(q.ackWait / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			q.expire(ctx)
+		}
+	}
+}
+
+// consume 循环读取事件流，先处理上次停机前读取但没有处理完的记录，处理后删除
+func (q *StreamQueue) consume(ctx context.Context) {
+	start := "0"
+	for ctx.Err() == nil {
+		err := ensureGroup(ctx, q.rdb, q.keys.events(), orchestratorGroup)
+		var streams []redis.XStream
+		if err == nil {
+			streams, err = q.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+				Group: orchestratorGroup, Consumer: orchestratorConsumer,
+				Streams: []string{q.keys.events(), start}, Count: streamBatch, Block: streamBlock,
+			}).Result()
+		}
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			q.logger.Warn("读取事件流失败", "error", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(retryDelay):
+			}
+			continue
+		}
+		records := streams[0].Messages
+		if len(records) < streamBatch {
+			start = ">"
+		}
+		ids := make([]string, 0, len(records))
+		for _, record := range records {
+			q.handle(record)
+			ids = append(ids, record.ID)
+		}
+		if len(ids) > 0 {
+			if _, err := q.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.XAck(ctx, q.keys.events(), orchestratorGroup, ids...)
+				pipe.XDel(ctx, q.keys.events(), ids...)
+				return nil
+			}); err != nil {
+				q.logger.Warn("删除已处理的事件流记录失败", "error", err)
+			}
+		}
+	}
+}
+
+// handle 处理事件流中的一条记录，只处理当前投递的记录
+func (q *StreamQueue) handle(record redis.XMessage) {
+	field := func(name string) string {
+		s, _ := record.Values[name].(string)
+		return s
+	}
+	worker, productID, message := field("worker"), field("product_id"), field("message")
+	switch field("type") {
+	case recordFetched:
+		q.mu.Lock()
+		if e, ok := q.products[productID]; ok && e.message == message {
+			e.worker = worker
+		}
+		q.mu.Unlock()
+		q.logger.Debug("任务已投递", "product_id", productID, "worker", worker)
+	case recordCheckpoint:
+		var cp types.Checkpoint
+		if err := json.Unmarshal([]byte(field("data")), &cp); err != nil {
+			q.logger.Warn("无法解析检查点", "product_id", productID, "error", err)
+			return
+		}
+		q.mu.Lock()
+		e, ok := q.products[productID]
+		ok = ok && e.message == message && e.worker == worker
+		if ok {
+			e.checkpoint = &cp
+		}
+		q.mu.Unlock()
+		if ok && q.checkpoint != nil {
+			q.checkpoint(e.product, cp)
+		}
+	case recordAck:
+		q.mu.Lock()
+		e, ok := q.products[productID]
+		if !ok || e.message != message {
+			q.mu.Unlock()
+			return
+		}
+		delete(q.products, productID)
+		q.acked[productID] = ackedDelivery{worker: worker, until: time.Now().Add(q.ackWait)}
+		q.stats.Acked++
+		q.mu.Unlock()
+		q.logger.Debug("任务已确认", "product_id", productID, "worker", worker)
+		q.metrics.WorkQueueDeliveriesTotal.WithLabelValues(ResultAcked).Inc()
+		close(e.done)
+	case recordEvents:
+		var events []Event
+		if err := json.Unmarshal([]byte(field("data")), &events); err != nil {
+			q.logger.Warn("无法解析转发的事件", "worker", worker, "error", err)
+			return
+		}
+		q.publish(worker, events)
+	}
+}
+
+// publish 将 worker 转发的事件发布到编排器的事件总线，与 Queue.Publish 一样只接受租约持有者的事件
+func (q *StreamQueue) publish(worker string, events []Event) {
+	now := time.Now()
+	q.mu.Lock()
+	accepted := events[:0:0]
+	for _, e := range events {
+		if !e.Valid() || !q.holdsLocked(worker, e.ProductID, now) {
+			continue
+		}
+		accepted = append(accepted, e)
+	}
+	q.mu.Unlock()
+	if dropped := len(events) - len(accepted); dropped > 0 {
+		q.logger.Debug("丢弃失效投递的事件", "worker", worker, "events", dropped)
+	}
+	for _, e := range accepted {
+		q.bus.Publish(e.Decode())
+	}
+}
+
+// holdsLocked 判断工件当前是否由 worker 执行，或者刚被 worker 确认且仍在确认期限内，调用方必须持有 q.mu
+func (q *StreamQueue) holdsLocked(worker, productID string, now time.Time) bool {
+	if e, ok := q.products[productID]; ok {
+		return e.worker != "" && e.worker == worker
+	}
+	a, ok := q.acked[productID]
+	return ok && a.worker == worker && now.Before(a.until)
+}
+
+// pendingLocked 返回跟踪中的任务所在任务流的待确认投递，按消息 ID 索引；调用方必须持有 q.mu
+func (q *StreamQueue) pendingLocked(ctx context.Context) (map[string]redis.XPendingExt, error) {
+	namespaces := make(map[string]bool)
+	for _, e := range q.products {
+		namespaces[e.namespace] = true
+	}
+	pending := make(map[string]redis.XPendingExt)
+	for _, ns := range slices.Sorted(maps.Keys(namespaces)) {
+		entries, err := q.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{Stream: q.keys.tasks(ns), Group: workerGroup, Start: "-", End: "+", Count: pelBatch}).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, pe := range entries {
+			pending[pe.ID] = pe
+		}
+	}
+	return pending, nil
+}
+
+// expire 移除空闲的 worker 和超过确认期限的已确认投递，并处理超过确认期限的投递：
+// 取消的任务直接结束，未达到最大投递次数的带上最近的检查点重新发布，否则使任务失败
+func (q *StreamQueue) expire(ctx context.Context) {
+	now := time.Now()
+	if workers, err := q.rdb.HGetAll(ctx, q.keys.workers()).Result(); err == nil {
+		for worker, seen := range workers {
+			if ms, _ := strconv.ParseInt(seen, 10, 64); now.Sub(time.UnixMilli(ms)) > q.workerIdle {
+				q.rdb.HDel(ctx, q.keys.workers(), worker)
+			}
+		}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for id, a := range q.acked {
+		if !now.Before(a.until) {
+			delete(q.acked, id)
+		}
+	}
+	pending, err := q.pendingLocked(ctx)
+	if err != nil {
+		q.logger.Warn("读取待确认的投递失败", "error", err)
+		return
+	}
+	for _, e := range q.products {
+		if pe, ok := pending[e.message]; ok && pe.Idle >= q.ackWait {
+			q.expireLocked(ctx, e)
+		}
+	}
+	leased := 0
+	for _, e := range q.products {
+		if _, ok := pending[e.message]; ok {
+			leased++
+		}
+	}
+	q.metrics.WorkQueuePending.Set(float64(len(q.products) - leased))
+	q.metrics.WorkQueueLeased.Set(float64(leased))
+}
+
+// expireLocked 结束超过确认期限的投递，投递在检查之后已续期或确认时不处理；调用方必须持有 q.mu
+func (q *StreamQueue) expireLocked(ctx context.Context, e *streamEntry) {
+	var data []byte
+	redeliver := !e.cancelled && (q.maxDeliver <= 0 || e.deliveries < q.maxDeliver)
+	if redeliver {
+		e.deliveries++
+		data, _ = json.Marshal(q.messageLocked(e))
+		e.deliveries--
+	}
+	keys := []string{q.keys.tasks(e.namespace), q.keys.cancelled(), q.keys.messages()}
+	result, err := redeliverScript.Run(ctx, q.rdb, keys, e.message, q.ackWait.Milliseconds(), e.product.ID, data).Result()
+	if err != nil {
+		q.logger.Warn("重新发布投递失败", "product_id", e.product.ID, "error", err)
+		return
+	}
+	id, ok := result.(string)
+	if !ok {
+		return
+	}
+	e.worker = ""
+	switch {
+	case redeliver:
+		e.message = id
+		e.deliveries++
+		q.stats.Redelivered++
+		q.metrics.WorkQueueDeliveriesTotal.WithLabelValues(ResultRedelivered).Inc()
+		q.logger.Warn("确认期限已过，重新投递任务", "product_id", e.product.ID, "deliveries", e.deliveries-1)
+	case e.cancelled:
+		q.removeLocked(e)
+		finishCancelled(q.bus, q.stateTracker, e.product, e.traceID)
+		close(e.done)
+	default:
+		q.removeLocked(e)
+		q.stats.Dead++
+		q.metrics.WorkQueueDeliveriesTotal.WithLabelValues(ResultDead).Inc()
+		q.logger.Error("任务超过最大投递次数", "product_id", e.product.ID, "deliveries", e.deliveries)
+		finishDead(q.bus, q.stateTracker, e.product, e.traceID, e.deliveries)
+		close(e.done)
+	}
+}
+
+// removeLocked 停止跟踪任务，调用方必须持有 q.mu
+func (q *StreamQueue) removeLocked(e *streamEntry) {
+	if q.products[e.product.ID] == e {
+		delete(q.products, e.product.ID)
+	}
+}
+
+// messageLocked 生成任务当前投递的消息，worker 上报过检查点时消息中的工件从检查点继续，调用方必须持有 q.mu
+func (q *StreamQueue) messageLocked(e *streamEntry) Message {
+	product := *e.product
+	if e.checkpoint != nil {
+		product.Resume = e.checkpoint
+	}
+	return Message{
+		Product:   product,
+		TraceID:   e.traceID,
+		Delivery:  e.deliveries,
+		AckWaitMs: int(q.ackWait / time.Millisecond),
+	}
+}
+
+// Status 返回队列中等待和执行中的任务以及累计的投递结果，Redis 不可用时只返回累计的投递结果
+func (q *StreamQueue) Status() Status {
+	ctx := context.Background()
+	now := time.Now()
+	status := Status{Pending: []string{}, Leased: []Lease{}, Workers: map[string]time.Time{}}
+	if workers, err := q.rdb.HGetAll(ctx, q.keys.workers()).Result(); err == nil {
+		for worker, seen := range workers {
+			if ms, _ := strconv.ParseInt(seen, 10, 64); now.Sub(time.UnixMilli(ms)) <= q.workerIdle {
+				status.Workers[worker] = time.UnixMilli(ms)
+			}
+		}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	status.Acked, status.Redelivered, status.Dead = q.stats.Acked, q.stats.Redelivered, q.stats.Dead
+	status.AckWaitMs = int(q.ackWait / time.Millisecond)
+	status.MaxDeliver = q.maxDeliver
+	pending, err := q.pendingLocked(ctx)
+	if err != nil {
+		q.logger.Warn("读取待确认的投递失败", "error", err)
+		return status
+	}
+	entries := slices.SortedFunc(maps.Values(q.products), func(a, b *streamEntry) int { return compareStreamID(a.message, b.message) })
+	for _, e := range entries {
+		pe, ok := pending[e.message]
+		if !ok {
+			status.Pending = append(status.Pending, e.product.ID)
+			continue
+		}
+		lease := Lease{
+			ID:        deliveryID(e.namespace, e.message),
+			ProductID: e.product.ID,
+			Worker:    pe.Consumer,
+			Delivery:  e.deliveries,
+			Deadline:  now.Add(q.ackWait - pe.Idle),
+		}
+		if e.checkpoint != nil {
+			lease.Completed = e.checkpoint.Step + 1
+		}
+		status.Leased = append(status.Leased, lease)
+	}
+	slices.SortFunc(status.Leased, func(a, b Lease) int { return a.Deadline.Compare(b.Deadline) })
+	return status
+}
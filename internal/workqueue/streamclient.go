@@ -0,0 +1,183 @@
+package workqueue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"industrial-4.0-demo/internal/types"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// StreamClient 是 worker 直接访问 Redis Streams 工作队列的客户端 (queue.backend: redis)，不经过编排器
+type StreamClient struct {
+	rdb        *redis.Client
+	keys       streamKeys
+	worker     string        // 本 worker 的 ID，同时是任务流消费者组中的消费者名称
+	namespaces []string      // 拉取的命名空间，为空时拉取所有有任务流的命名空间
+	ackWait    time.Duration // 与编排器相同的确认期限，空闲超过期限的投递不能再续期
+	groups     bool          // 是否已为 namespaces 创建消费者组
+}
+
+// NewStreamClient 创建 Redis Streams 工作队列客户端，连接 opts.Redis
+func NewStreamClient(opts Options, worker string) *StreamClient {
+	return &StreamClient{
+		rdb:        newRedisClient(opts.Redis),
+		keys:       streamKeys(opts.Redis.Prefix),
+		worker:     worker,
+		namespaces: opts.Namespaces,
+		ackWait:    time.Duration(opts.AckWaitMs) * time.Millisecond,
+	}
+}
+
+var _ Broker = (*StreamClient)(nil)
+
+// Worker 返回本 worker 的 ID
+func (c *StreamClient) Worker() string {
+	return c.worker
+}
+
+// Endpoint 返回 Redis 地址
+func (c *StreamClient) Endpoint() string {
+	return "redis://" + c.rdb.Options().Addr
+}
+
+// Close 关闭 Redis 连接
+func (c *StreamClient) Close() error {
+	return c.rdb.Close()
+}
+
+// touch 记录 worker 的活动时间，编排器的队列状态据此列出在线的 worker
+func (c *StreamClient) touch(ctx context.Context) error {
+	return c.rdb.HSet(ctx, c.keys.workers(), c.worker, time.Now().UnixMilli()).Err()
+}
+
+// Fetch 从命名空间的任务流拉取一个任务，streamBlock 内没有任务时返回 false
+// 指定了命名空间时为它们创建消费者组，编排器还没有发布过任务的命名空间也可以等待
+func (c *StreamClient) Fetch(ctx context.Context) (Message, bool, error) {
+	if err := c.touch(ctx); err != nil {
+		return Message{}, false, err
+	}
+	namespaces := c.namespaces
+	if len(namespaces) == 0 {
+		all, err := c.rdb.SMembers(ctx, c.keys.namespaces()).Result()
+		if err != nil {
+			return Message{}, false, err
+		}
+		slices.Sort(all)
+		namespaces = all
+	} else if !c.groups {
+		for _, ns := range namespaces {
+			if err := ensureGroup(ctx, c.rdb, c.keys.tasks(ns), workerGroup); err != nil {
+				return Message{}, false, err
+			}
+		}
+		c.groups = true
+	}
+	if len(namespaces) == 0 {
+		select {
+		case <-ctx.Done():
+		case <-time.After(streamBlock):
+		}
+		return Message{}, false, nil
+	}
+
+	streams := make([]string, 0, 2*len(namespaces))
+	for _, ns := range namespaces {
+		streams = append(streams, c.keys.tasks(ns))
+	}
+	for range namespaces {
+		streams = append(streams, ">")
+	}
+	res, err := c.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{Group: workerGroup, Consumer: c.worker, Streams: streams, Count: 1, Block: streamBlock}).Result()
+	if errors.Is(err, redis.Nil) {
+		return Message{}, false, nil
+	}
+	if err != nil {
+		return Message{}, false, err
+	}
+	for _, stream := range res {
+		for _, m := range stream.Messages {
+			ns := strings.TrimPrefix(stream.Stream, c.keys.tasks(""))
+			var msg Message
+			data, _ := m.Values["data"].(string)
+			if err := json.Unmarshal([]byte(data), &msg); err != nil {
+				return Message{}, false, fmt.Errorf("decode message %s: %w", m.ID, err)
+			}
+			msg.ID = deliveryID(ns, m.ID)
+			err := c.rdb.XAdd(ctx, &redis.XAddArgs{Stream: c.keys.events(), Values: []any{
+				"type", recordFetched, "worker", c.worker, "product_id", msg.Product.ID, "message", m.ID,
+			}}).Err()
+			return msg, true, err
+		}
+	}
+	return Message{}, false, nil
+}
+
+// Extend 延长投递的确认期限并上报最近完成的步骤 (cp 可以为空)，返回的消息中 Cancelled 表示任务已被取消；
+// 投递已失效时返回 ErrUnknownDelivery
+func (c *StreamClient) Extend(ctx context.Context, id string, cp *types.Checkpoint) (Message, error) {
+	ns, message, ok := parseDelivery(id)
+	if !ok {
+		return Message{}, ErrUnknownDelivery
+	}
+	var data []byte
+	if cp != nil {
+		var err error
+		if data, err = json.Marshal(cp); err != nil {
+			return Message{}, err
+		}
+	}
+	if err := c.touch(ctx); err != nil {
+		return Message{}, err
+	}
+	keys := []string{c.keys.tasks(ns), c.keys.cancelled(), c.keys.events()}
+	result, err := extendScript.Run(ctx, c.rdb, keys, message, c.worker, c.ackWait.Milliseconds(), data).Int()
+	switch {
+	case err != nil:
+		return Message{}, err
+	case result < 0:
+		return Message{}, ErrUnknownDelivery
+	}
+	return Message{ID: id, Cancelled: result == 1}, nil
+}
+
+// Ack 确认投递执行结束；投递已失效时返回 ErrUnknownDelivery
+func (c *StreamClient) Ack(ctx context.Context, id string, p *types.Product) error {
+	ns, message, ok := parseDelivery(id)
+	if !ok {
+		return ErrUnknownDelivery
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	if err := c.touch(ctx); err != nil {
+		return err
+	}
+	keys := []string{c.keys.tasks(ns), c.keys.cancelled(), c.keys.events(), c.keys.messages()}
+	result, err := ackScript.Run(ctx, c.rdb, keys, message, c.worker, data).Int()
+	switch {
+	case err != nil:
+		return err
+	case result < 0:
+		return ErrUnknownDelivery
+	}
+	return nil
+}
+
+// Publish 将事件写入事件流，由编排器发布到它的事件总线
+func (c *StreamClient) Publish(ctx context.Context, events []Event) error {
+	data, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	if err := c.touch(ctx); err != nil {
+		return err
+	}
+	return c.rdb.XAdd(ctx, &redis.XAddArgs{Stream: c.keys.events(), Values: []any{"type", recordEvents, "worker", c.worker, "data", data}}).Err()
+}
@@ -0,0 +1,249 @@
+package workqueue
+
+import (
+	"context"
+	"errors"
+	"industrial-4.0-demo/internal/engine"
+	"industrial-4.0-demo/internal/event"
+	"industrial-4.0-demo/internal/types"
+	"industrial-4.0-demo/internal/util"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 事件转发的参数
+const (
+	forwardInterval = 100 * time.Millisecond // 批量转发事件的间隔
+	forwardBatch    = 200                    // 每批最多转发的事件数，受编排器 server.max_body_bytes 限制
+	forwardBuffer   = 4096                   // 等待转发的事件数上限，编排器不可用时超出的事件被丢弃
+	retryDelay      = time.Second            // 拉取任务失败后的重试间隔
+)
+
+// Broker 是 worker 访问工作队列的客户端：Client 通过编排器的 HTTP API (memory)，StreamClient 直接访问 Redis Streams (redis)
+type Broker interface {
+	Fetch(ctx context.Context) (Message, bool, error)
+	Extend(ctx context.Context, id string, cp *types.Checkpoint) (Message, error)
+	Ack(ctx context.Context, id string, p *types.Product) error
+	Publish(ctx context.Context, events []Event) error
+	Worker() string   // 本 worker 的 ID
+	Endpoint() string // 队列的地址，用于日志
+}
+
+// Worker 从共享工作队列拉取任务，用本进程的工作流引擎执行，并把工件和步骤事件转发回编排器
+type Worker struct {
+	client      Broker
+	engine      *engine.WorkflowEngine
+	concurrency int
+	logger      *slog.Logger
+
+	events  chan Event   // 等待转发的事件
+	dropped atomic.Int64 // 因缓冲区已满而丢弃的事件数
+
+	mu          sync.Mutex
+	checkpoints map[string]chan types.Checkpoint // 工件 ID 到执行中投递的检查点，由续期上报给编排器
+}
+
+// NewWorker 创建一个 worker，bus 是 wf 发布事件的事件总线
+func NewWorker(client Broker, wf *engine.WorkflowEngine, bus *event.Bus, concurrency int, logger *slog.Logger) *Worker {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	w := &Worker{
+		client:      client,
+		engine:      wf,
+		concurrency: concurrency,
+		logger:      logger.With("component", "worker", "worker_id", client.Worker()),
+		events:      make(chan Event, forwardBuffer),
+		checkpoints: make(map[string]chan types.Checkpoint),
+	}
+	wf.SetCheckpointer(w.checkpoint)
+	for _, eventType := range Forwarded {
+		bus.Subscribe(eventType, func(e event.Event) {
+			select {
+			case w.events <- Encode(e):
+			default:
+				w.dropped.Add(1)
+			}
+		})
+	}
+	return w
+}
+
+// Run 启动 concurrency 个消费者拉取并执行任务，直到 ctx 结束
+// ctx 结束后不再拉取新任务，等待执行中的任务结束、确认并转发剩余的事件后返回
+func (w *Worker) Run(ctx context.Context) {
+	w.logger.Info("worker 启动", "queue", w.client.Endpoint(), "concurrency", w.concurrency)
+	forwardCtx, stopForward := context.WithCancel(context.Background())
+	forwarded := make(chan struct{})
+	go func() {
+		defer close(forwarded)
+		w.forward(forwardCtx)
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < w.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.consume(ctx)
+		}()
+	}
+	wg.Wait()
+	stopForward()
+	<-forwarded
+	w.logger.Info("worker 已停止")
+}
+
+// consume 循环拉取并执行任务，直到 ctx 结束
+func (w *Worker) consume(ctx context.Context) {
+	for ctx.Err() == nil {
+		msg, ok, err := w.client.Fetch(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			w.logger.Warn("拉取任务失败", "error", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(retryDelay):
+			}
+			continue
+		}
+		if ok {
+			w.execute(msg)
+		}
+	}
+}
+
+// checkpoint 记录执行中的工件完成的步骤，只保留最近一个，由 execute 的续期上报给编排器
+func (w *Worker) checkpoint(p *types.Product, cp types.Checkpoint) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	ch, ok := w.checkpoints[p.ID]
+	if !ok {
+		return
+	}
+	select {
+	case <-ch:
+	default:
+	}
+	ch <- cp
+}
+
+// execute 执行一次投递：执行期间每隔三分之一确认期限续期一次，每完成一个步骤立即续期并上报检查点；
+// 任务被取消或投递失效 (已重新投递给其他 worker) 时以取消原因结束引擎的 Context，引擎在当前步骤结束后停止；
+// 投递失效时不再确认。消息中的工件带有检查点时从下一个步骤继续
+func (w *Worker) execute(msg Message) {
+	p := msg.Product
+	logger := w.logger.With("product_id", p.ID, "delivery", msg.Delivery)
+	checkpoints := make(chan types.Checkpoint, 1)
+	w.mu.Lock()
+	w.checkpoints[p.ID] = checkpoints
+	w.mu.Unlock()
+	defer func() {
+		w.mu.Lock()
+		delete(w.checkpoints, p.ID)
+		w.mu.Unlock()
+	}()
+	ctx := context.Background()
+	if msg.TraceID != "" {
+		ctx = util.ContextWithTraceID(ctx, msg.TraceID)
+	}
+	taskCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	if msg.Cancelled {
+		cancel(engine.ErrTaskCancelled)
+	}
+
+	var lost atomic.Bool
+	stop := make(chan struct{})
+	heartbeat := make(chan struct{})
+	go func() {
+		defer close(heartbeat)
+		ticker := time.NewTicker(time.Duration(msg.AckWaitMs) * time.Millisecond / 3)
+		defer ticker.Stop()
+		var pending *types.Checkpoint // 尚未上报成功的检查点，续期失败时下次重试
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			case cp := <-checkpoints:
+				pending = &cp
+			}
+			current, err := w.client.Extend(context.Background(), msg.ID, pending)
+			if err == nil {
+				pending = nil
+			}
+			switch {
+			case errors.Is(err, ErrUnknownDelivery):
+				logger.Warn("投递已失效，停止执行")
+				lost.Store(true)
+				cancel(engine.ErrTaskCancelled)
+				return
+			case err != nil:
+				logger.Warn("续期失败", "error", err)
+			case current.Cancelled:
+				cancel(engine.ErrTaskCancelled)
+			}
+		}
+	}()
+
+	logger.Info("开始执行任务")
+	w.engine.Process(taskCtx, &p)
+	close(stop)
+	<-heartbeat
+	if lost.Load() {
+		return
+	}
+	if err := w.client.Ack(context.Background(), msg.ID, &p); err != nil {
+		logger.Warn("确认任务失败", "error", err)
+		return
+	}
+	logger.Info("任务已确认", "status", p.Status)
+}
+
+// forward 每隔 forwardInterval 批量转发事件，ctx 结束时转发剩余的事件后返回
+func (w *Worker) forward(ctx context.Context) {
+	ticker := time.NewTicker(forwardInterval)
+	defer ticker.Stop()
+	var batch []Event
+	flush := func() {
+		if n := w.dropped.Swap(0); n > 0 {
+			w.logger.Warn("事件缓冲区已满，部分事件未转发", "dropped", n)
+		}
+		if len(batch) == 0 {
+			return
+		}
+		if err := w.client.Publish(context.Background(), batch); err != nil {
+			w.logger.Warn("转发事件失败", "error", err, "events", len(batch))
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case e := <-w.events:
+			batch = append(batch, e)
+			if len(batch) >= forwardBatch {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-ctx.Done():
+			for {
+				select {
+				case e := <-w.events:
+					batch = append(batch, e)
+					if len(batch) >= forwardBatch {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,433 @@
+// Package yield 统计报废和最终良率，把 Saga 补偿和返工重试对应到业务指标
+//   - 失败工件的缺陷处置为 scrap，或者所属谱系 (工件及其重试) 的重试次数已达到返工上限时报废
+//   - 其余失败的工件等待返工 (重试) 或评审，重试完成后计为返工良品
+//   - 报废成本 = 产品类型的物料成本 + 谱系中每次加工的工站成本，归因到导致报废的工站和缺陷代码
+//   - 最终良率 = 完成的工件数 / (完成的工件数 + 报废的工件数)，工站良率 = 加工成功的步骤数 / 加工的步骤数
+package yield
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"industrial-4.0-demo/internal/defect"
+	"industrial-4.0-demo/internal/event"
+	"industrial-4.0-demo/internal/metrics"
+	"industrial-4.0-demo/internal/types"
+	"industrial-4.0-demo/internal/windowed"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gaugeInterval 是刷新 product_final_yield 和 station_yield 指标的间隔
+const gaugeInterval = 10 * time.Second
+
+// Costs 是报废成本的计算参数，产品类型和工站 ID 不区分大小写
+type Costs struct {
+	Unit    map[string]float64          // 各产品类型的物料成本
+	Station map[types.StationID]float64 // 各工站每次加工的成本
+}
+
+// ProductYield 是一种产品类型在统计窗口内的最终良率和报废成本
+type ProductYield struct {
+	Type          string  `json:"type"`
+	Completed     int     `json:"completed"`      // 完成的工件数
+	Reworked      int     `json:"reworked"`       // 其中经过返工 (重试) 才完成的工件数
+	Scrapped      int     `json:"scrapped"`       // 报废的工件数
+	Yield         float64 `json:"yield"`          // 0 ~ 1，窗口内没有完成或报废的工件时为 0
+	ScrapCost     float64 `json:"scrap_cost"`     // 报废成本
+	PendingRework int     `json:"pending_rework"` // 当前失败后等待返工或评审的工件数，不受窗口限制
+}
+
+// StationYield 是一个工站在统计窗口内的良率和归因到该工站的报废
+type StationYield struct {
+	StationID types.StationID `json:"station_id"`
+	Steps     int             `json:"steps"`      // 加工的步骤数
+	Good      int             `json:"good"`       // 加工成功的步骤数
+	Yield     float64         `json:"yield"`      // 0 ~ 1，窗口内没有加工时为 0
+	Scrapped  int             `json:"scrapped"`   // 在该工站判定报废的工件数
+	ScrapCost float64         `json:"scrap_cost"` // 归因到该工站的报废成本
+}
+
+// Scrap 是一个报废的工件
+type Scrap struct {
+	ProductID   string          `json:"product_id"`
+	Lineage     string          `json:"lineage"` // 谱系中最初的工件 ID
+	Type        string          `json:"type"`
+	Namespace   string          `json:"namespace,omitempty"` // 所属的命名空间 (产线)
+	StationID   types.StationID `json:"station_id"`          // 判定报废的工站，流程在工站之外失败时为空
+	Reason      string          `json:"reason"`              // 缺陷代码
+	Category    string          `json:"category"`
+	Description string          `json:"description"`
+	Disposition string          `json:"disposition"` // 缺陷的处置方式，rework / hold 表示返工次数已用完
+	Attempts    int             `json:"attempts"`    // 谱系中生产的次数 (含首次)
+	Cost        float64         `json:"cost"`
+	At          time.Time       `json:"at"`
+}
+
+// ReasonCost 是一个报废原因在统计窗口内的次数和成本
+type ReasonCost struct {
+	Reason      string  `json:"reason"`
+	Category    string  `json:"category"`
+	Description string  `json:"description"`
+	Count       int     `json:"count"`
+	Cost        float64 `json:"cost"`
+}
+
+// Report 是统计窗口内的良率和报废报告
+// 窗口早于追踪开始时从追踪开始时计算
+type Report struct {
+	Window    string         `json:"window"`
+	From      time.Time      `json:"from"`
+	To        time.Time      `json:"to"`
+	MaxRework int            `json:"max_rework"`
+	ScrapCost float64        `json:"scrap_cost"` // 窗口内的报废总成本
+	Products  []ProductYield `json:"products"`
+	Stations  []StationYield `json:"stations"`
+	Reasons   []ReasonCost   `json:"reasons"` // 按成本从高到低排列
+	Scraps    []Scrap        `json:"scraps"`  // 窗口内报废的工件，按时间从新到旧排列
+}
+
+// lineage 是一个工件及其重试组成的谱系
+type lineage struct {
+	productType string
+	attempts    int     // 生产的次数
+	cost        float64 // 已结束的生产发生的工站加工成本
+	pending     bool    // 最近一次生产失败，等待返工或评审
+	at          time.Time
+}
+
+// run 是生产中的工件已发生的加工成本
+// 成功的步骤在步骤完成时计入，失败的步骤在工件失败时计入，避免异步到达的步骤完成事件晚于工件失败事件时漏计
+type run struct {
+	cost float64
+	at   time.Time
+}
+
+// finish 是一个完成的工件
+type finish struct {
+	at          time.Time
+	productType string
+	reworked    bool
+}
+
+// stepRecord 是工站上的一次加工
+type stepRecord struct {
+	at   time.Time
+	good bool
+}
+
+// Tracker 订阅事件总线，保留最近 retention 时长内的记录并按需计算良率和报废
+type Tracker struct {
+	mu        sync.Mutex
+	maxRework int
+	costs     Costs
+	retention windowed.Retention
+	roots     map[string]string   // 工件 ID 到所属谱系 (最初的工件 ID)
+	lineages  map[string]*lineage // 按最初的工件 ID 索引
+	runs      map[string]*run     // 按工件 ID 索引
+	finishes  []finish
+	scraps    []Scrap
+	steps     map[types.StationID][]stepRecord
+	metrics   *metrics.Metrics
+}
+
+// NewTracker 创建一个良率追踪器
+// maxRework 是可返工的缺陷允许的最多重试次数；retention 是记录的保留时长，也是可查询的最大窗口；m 是报废计数和 Run 更新的指标
+func NewTracker(maxRework int, costs Costs, retention time.Duration, m *metrics.Metrics) *Tracker {
+	normalized := Costs{Unit: make(map[string]float64, len(costs.Unit)), Station: make(map[types.StationID]float64, len(costs.Station))}
+	for productType, cost := range costs.Unit {
+		normalized.Unit[strings.ToLower(productType)] = cost
+	}
+	for id, cost := range costs.Station {
+		normalized.Station[types.StationID(strings.ToUpper(string(id)))] = cost
+	}
+	return &Tracker{
+		maxRework: maxRework,
+		costs:     normalized,
+		retention: windowed.NewRetention(retention),
+		roots:     make(map[string]string),
+		lineages:  make(map[string]*lineage),
+		runs:      make(map[string]*run),
+		steps:     make(map[types.StationID][]stepRecord),
+		metrics:   m,
+	}
+}
+
+// Register 订阅工件开始、步骤完成和工件结束事件
+// 取消的工件既不计入良率也不计入报废
+func (t *Tracker) Register(bus *event.Bus) {
+	bus.Subscribe(event.ProductStarted, func(e event.Event) {
+		t.recordStart(e.Product, e.Timestamp)
+	})
+	bus.Subscribe(event.StepCompleted, func(e event.Event) {
+		t.recordStep(e.ProductID, e.StationID, e.Timestamp, e.Error == nil)
+	})
+	bus.Subscribe(event.ProductCompleted, func(e event.Event) {
+		t.recordCompleted(e.Product, e.Timestamp)
+	})
+	bus.Subscribe(event.ProductFailed, func(e event.Event) {
+		t.recordFailed(e.Product, e.StationID, e.Defect, e.Error, e.Timestamp)
+	})
+}
+
+// Run 定期按 window 统计良率并更新 product_final_yield 和 station_yield 指标，直到 ctx 结束，window 超过保留时长时使用保留时长
+// 窗口内没有完成或报废的产品类型和没有加工的工站不更新
+func (t *Tracker) Run(ctx context.Context, window time.Duration) {
+	window = t.retention.Clamp(window)
+	ticker := time.NewTicker(gaugeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			report, _ := t.Report(window, now)
+			for _, p := range report.Products {
+				if p.Completed+p.Scrapped > 0 {
+					t.metrics.ProductFinalYield.WithLabelValues(p.Type).Set(p.Yield)
+				}
+			}
+			for _, s := range report.Stations {
+				if s.Steps > 0 {
+					t.metrics.StationYield.WithLabelValues(string(s.StationID)).Set(s.Yield)
+				}
+			}
+		}
+	}
+}
+
+// lineageLocked 返回工件所属的谱系，不存在时创建，调用方必须持有锁
+func (t *Tracker) lineageLocked(p *types.Product) (string, *lineage) {
+	root, ok := t.roots[p.ID]
+	if !ok {
+		root = p.ID
+		if p.RetryOf != "" {
+			root = cmp.Or(t.roots[p.RetryOf], p.RetryOf)
+		}
+		t.roots[p.ID] = root
+	}
+	l, ok := t.lineages[root]
+	if !ok {
+		l = &lineage{productType: p.Type}
+		t.lineages[root] = l
+	}
+	return root, l
+}
+
+// recordStart 记录一次生产，重试开始后谱系不再等待返工
+func (t *Tracker) recordStart(p *types.Product, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, l := t.lineageLocked(p)
+	l.attempts++
+	l.pending = false
+	l.at = at
+	t.pruneLocked(at)
+}
+
+// recordStep 记录一次加工的结果，成功时计入工件的加工成本
+func (t *Tracker) recordStep(productID string, id types.StationID, at time.Time, good bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.steps[id] = append(t.steps[id], stepRecord{at: at, good: good})
+	if good {
+		t.runLocked(productID, at).cost += t.costs.Station[id]
+	}
+}
+
+// runLocked 返回生产中的工件的加工成本，不存在时创建，调用方必须持有锁
+func (t *Tracker) runLocked(productID string, at time.Time) *run {
+	r, ok := t.runs[productID]
+	if !ok {
+		r = &run{}
+		t.runs[productID] = r
+	}
+	r.at = at
+	return r
+}
+
+// recordCompleted 记录一个完成的工件，谱系随之结束
+func (t *Tracker) recordCompleted(p *types.Product, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	root, l := t.lineageLocked(p)
+	t.finishes = append(t.finishes, finish{at: at, productType: p.Type, reworked: l.attempts > 1})
+	delete(t.lineages, root)
+	delete(t.runs, p.ID)
+}
+
+// recordFailed 计入失败工站的加工成本，并判定失败的工件报废还是等待返工
+// 工件在工站之外失败 (例如没有可用的工作流) 时没有工站，缺陷按错误归类
+func (t *Tracker) recordFailed(p *types.Product, id types.StationID, d *types.Defect, err error, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	root, l := t.lineageLocked(p)
+	if r, ok := t.runs[p.ID]; ok {
+		l.cost += r.cost
+		delete(t.runs, p.ID)
+	}
+	if id != "" {
+		l.cost += t.costs.Station[id]
+	}
+	if d == nil {
+		d = defect.Classify(cmp.Or(err, errors.New("unknown failure")))
+	}
+	l.at = at
+	if d.Disposition != types.DispositionScrap && l.attempts-1 < t.maxRework {
+		l.pending = true
+		return
+	}
+
+	s := Scrap{
+		ProductID:   p.ID,
+		Lineage:     root,
+		Type:        p.Type,
+		Namespace:   p.Namespace,
+		StationID:   id,
+		Reason:      d.Code,
+		Category:    d.Category,
+		Description: d.Description,
+		Disposition: d.Disposition,
+		Attempts:    l.attempts,
+		Cost:        t.costs.Unit[strings.ToLower(p.Type)] + l.cost,
+		At:          at,
+	}
+	t.scraps = append(t.scraps, s)
+	delete(t.lineages, root)
+	t.metrics.ScrappedProductsTotal.WithLabelValues(s.Type, string(s.StationID), s.Reason, s.Namespace).Inc()
+	t.metrics.ScrapCostTotal.WithLabelValues(s.Type, string(s.StationID), s.Namespace).Add(s.Cost)
+}
+
+// pruneLocked 丢弃超过保留时长的记录和不再活动的谱系，调用方必须持有锁
+func (t *Tracker) pruneLocked(now time.Time) {
+	cutoff := t.retention.Cutoff(now)
+	before := func(at time.Time) bool { return at.Before(cutoff) }
+	t.finishes = slices.DeleteFunc(t.finishes, func(f finish) bool { return before(f.at) })
+	t.scraps = slices.DeleteFunc(t.scraps, func(s Scrap) bool { return before(s.At) })
+	for id, steps := range t.steps {
+		t.steps[id] = slices.DeleteFunc(steps, func(s stepRecord) bool { return before(s.at) })
+	}
+	for root, l := range t.lineages {
+		if before(l.at) {
+			delete(t.lineages, root)
+		}
+	}
+	for id, r := range t.runs {
+		if before(r.at) {
+			delete(t.runs, id)
+		}
+	}
+	for id, root := range t.roots {
+		if _, ok := t.lineages[root]; !ok {
+			delete(t.roots, id)
+		}
+	}
+}
+
+// Report 统计截至 now 的 window 时长内的良率和报废，产品类型和工站按名称排序
+func (t *Tracker) Report(window time.Duration, now time.Time) (Report, error) {
+	from, err := t.retention.From(window, now)
+	if err != nil {
+		return Report{}, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	within := func(at time.Time) bool { return !at.Before(from) && !at.After(now) }
+	report := Report{Window: window.String(), From: from, To: now, MaxRework: t.maxRework,
+		Products: []ProductYield{}, Stations: []StationYield{}, Reasons: []ReasonCost{}, Scraps: []Scrap{}}
+
+	products := make(map[string]*ProductYield)
+	product := func(productType string) *ProductYield {
+		p, ok := products[productType]
+		if !ok {
+			p = &ProductYield{Type: productType}
+			products[productType] = p
+		}
+		return p
+	}
+	stations := make(map[types.StationID]*StationYield)
+	station := func(id types.StationID) *StationYield {
+		s, ok := stations[id]
+		if !ok {
+			s = &StationYield{StationID: id}
+			stations[id] = s
+		}
+		return s
+	}
+	reasons := make(map[string]*ReasonCost)
+
+	for _, f := range t.finishes {
+		if within(f.at) {
+			p := product(f.productType)
+			p.Completed++
+			if f.reworked {
+				p.Reworked++
+			}
+		}
+	}
+	for _, s := range t.scraps {
+		if !within(s.At) {
+			continue
+		}
+		p := product(s.Type)
+		p.Scrapped++
+		p.ScrapCost += s.Cost
+		if s.StationID != "" {
+			st := station(s.StationID)
+			st.Scrapped++
+			st.ScrapCost += s.Cost
+		}
+		r, ok := reasons[s.Reason]
+		if !ok {
+			r = &ReasonCost{Reason: s.Reason, Category: s.Category, Description: s.Description}
+			reasons[s.Reason] = r
+		}
+		r.Count++
+		r.Cost += s.Cost
+		report.ScrapCost += s.Cost
+		report.Scraps = append(report.Scraps, s)
+	}
+	for _, l := range t.lineages {
+		if l.pending {
+			product(l.productType).PendingRework++
+		}
+	}
+	for id, steps := range t.steps {
+		for _, s := range steps {
+			if !within(s.at) {
+				continue
+			}
+			st := station(id)
+			st.Steps++
+			if s.good {
+				st.Good++
+			}
+		}
+	}
+
+	for _, p := range products {
+		if resolved := p.Completed + p.Scrapped; resolved > 0 {
+			p.Yield = float64(p.Completed) / float64(resolved)
+		}
+		report.Products = append(report.Products, *p)
+	}
+	for _, s := range stations {
+		if s.Steps > 0 {
+			s.Yield = float64(s.Good) / float64(s.Steps)
+		}
+		report.Stations = append(report.Stations, *s)
+	}
+	for _, r := range reasons {
+		report.Reasons = append(report.Reasons, *r)
+	}
+	slices.SortFunc(report.Products, func(a, b ProductYield) int { return strings.Compare(a.Type, b.Type) })
+	slices.SortFunc(report.Stations, func(a, b StationYield) int { return strings.Compare(string(a.StationID), string(b.StationID)) })
+	slices.SortFunc(report.Reasons, func(a, b ReasonCost) int {
+		return cmp.Or(cmp.Compare(b.Cost, a.Cost), cmp.Compare(b.Count, a.Count), strings.Compare(a.Reason, b.Reason))
+	})
+	slices.SortFunc(report.Scraps, func(a, b Scrap) int { return b.At.Compare(a.At) })
+	return report, nil
+}
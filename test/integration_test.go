@@ -1,31 +1,137 @@
 package test
 
 import (
+	"bufio"
 	"bytes"
+	"cmp"
+	"compress/gzip"
 	"context"
+	"encoding/csv"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"industrial-4.0-demo/internal/anomaly"
+	"industrial-4.0-demo/internal/api"
+	"industrial-4.0-demo/internal/audit"
+	"industrial-4.0-demo/internal/auth"
+	"industrial-4.0-demo/internal/b2mml"
+	"industrial-4.0-demo/internal/buildinfo"
+	"industrial-4.0-demo/internal/calendar"
+	"industrial-4.0-demo/internal/chaos"
+	"industrial-4.0-demo/internal/cli"
+	"industrial-4.0-demo/internal/cluster"
 	"industrial-4.0-demo/internal/config"
+	"industrial-4.0-demo/internal/costing"
+	"industrial-4.0-demo/internal/defect"
 	"industrial-4.0-demo/internal/engine"
+	"industrial-4.0-demo/internal/erp"
 	"industrial-4.0-demo/internal/event"
+	"industrial-4.0-demo/internal/features"
+	"industrial-4.0-demo/internal/fsm"
+	"industrial-4.0-demo/internal/gantt"
+	"industrial-4.0-demo/internal/grpcapi"
+	"industrial-4.0-demo/internal/grpcapi/orchestratorv1"
 	"industrial-4.0-demo/internal/handlers"
+	"industrial-4.0-demo/internal/health"
+	"industrial-4.0-demo/internal/history"
+	"industrial-4.0-demo/internal/logging"
+	"industrial-4.0-demo/internal/lot"
+	"industrial-4.0-demo/internal/maintenance"
+	"industrial-4.0-demo/internal/metrics"
+	"industrial-4.0-demo/internal/notify"
+	"industrial-4.0-demo/internal/oee"
+	"industrial-4.0-demo/internal/opcua"
 	"industrial-4.0-demo/internal/persistence"
+	"industrial-4.0-demo/internal/planner"
+	"industrial-4.0-demo/internal/quality"
+	"industrial-4.0-demo/internal/ratelimit"
+	"industrial-4.0-demo/internal/reliability"
+	"industrial-4.0-demo/internal/reload"
+	"industrial-4.0-demo/internal/replay"
+	"industrial-4.0-demo/internal/serial"
+	"industrial-4.0-demo/internal/simulator"
+	"industrial-4.0-demo/internal/sla"
+	"industrial-4.0-demo/internal/sparkplug"
 	"industrial-4.0-demo/internal/station"
+	"industrial-4.0-demo/internal/station/stationv1"
+	"industrial-4.0-demo/internal/stationsim"
+	"industrial-4.0-demo/internal/throughput"
+	"industrial-4.0-demo/internal/traceability"
 	"industrial-4.0-demo/internal/types"
+	"industrial-4.0-demo/internal/util"
 	"industrial-4.0-demo/internal/web"
+	"industrial-4.0-demo/internal/whatif"
+	"industrial-4.0-demo/internal/windowed"
+	"industrial-4.0-demo/internal/workqueue"
+	"industrial-4.0-demo/internal/yield"
+	"io"
 	"log/slog"
+	"maps"
+	"math"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
 	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/alicebob/miniredis/v2"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	uaclient "github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/ua"
+	"github.com/gorilla/websocket"
+	mochi "github.com/mochi-mqtt/server/v2"
+	mochiauth "github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/xuri/excelize/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
+// testApp 是一个完整的测试应用实例
+type testApp struct {
+	scheduler    *engine.Scheduler
+	stateTracker *web.StateTracker
+	hub          *web.Hub
+	history      *history.Store
+	simulator    *simulator.Simulator
+	server       *httptest.Server
+	metrics      *metrics.Metrics
+	logLevels    *logging.Levels
+	flags        *features.Flags
+	maintenance  *maintenance.Tracker
+	bus          *event.Bus
+	b2mml        *b2mml.Importer
+	logger       *slog.Logger
+}
+
 // setupTestApp 启动一个完整的应用实例以进行测试
 func setupTestApp(t *testing.T, remoteShouldFail bool) (*engine.Scheduler, *web.StateTracker, *httptest.Server) {
+	app := newTestApp(t, remoteShouldFail)
+	return app.scheduler, app.stateTracker, app.server
+}
+
+// newTestApp 启动一个完整的应用实例，并返回其内部组件，供需要直接访问 Hub 或履历的测试使用
+func newTestApp(t *testing.T, remoteShouldFail bool) *testApp {
+	// config.yaml 从工作目录读取，前端资源已编译进二进制，不依赖工作目录
 	_, filename, _, _ := runtime.Caller(0)
 	dir := filepath.Join(filepath.Dir(filename), "..")
 	err := os.Chdir(dir)
@@ -33,11 +139,15 @@ func setupTestApp(t *testing.T, remoteShouldFail bool) (*engine.Scheduler, *web.
 		t.Fatalf("无法切换目录: %v", err)
 	}
 
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
-	hub := web.NewHub()
+	logLevels := logging.New(slog.NewJSONHandler(os.Stdout, nil), slog.LevelDebug)
+	logger := logLevels.Logger("")
+	// 每个实例使用独立的注册表，同一进程中可以创建多个实例
+	m := metrics.New(metrics.NewRegistry())
+	hub := web.NewHub(m)
 	go hub.Run()
 	stateTracker := web.NewStateTracker(hub)
 	eventBus := event.NewBus()
+	historyStore := history.NewStore()
 
 	tmpDir := t.TempDir()
 	walPath := filepath.Join(tmpDir, "test.wal")
@@ -47,18 +157,40 @@ func setupTestApp(t *testing.T, remoteShouldFail bool) (*engine.Scheduler, *web.
 	}
 	t.Cleanup(func() { wal.Close() })
 
-	cfg, err := config.LoadConfig()
+	cfg, err := config.LoadConfig("", config.Overrides{"profile": config.ProfileTest})
 	if err != nil {
 		t.Fatalf("加载配置失败: %v", err)
 	}
-	cfg.StepDelayMs = 1
-	cfg.StationDelayMs = 1
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("仓库中的 config.yaml 未通过校验: %v", err)
+	}
+	buildinfo.SetConfigHash(cfg.Hash())
+	buildinfo.Observe(m)
 
-	handlers.RegisterEventHandlers(eventBus, stateTracker, logger)
+	handlers.RegisterEventHandlers(eventBus, stateTracker, historyStore, m, logger)
+	stateTracker.SetQueueAlertThreshold(cfg.Alerts.QueueThreshold)
+	oeeTracker := oee.NewTracker(time.Duration(cfg.StationDelayMs)*time.Millisecond, nil, 24*time.Hour, m)
+	oeeTracker.Register(eventBus)
+	throughputTracker := throughput.NewTracker(24*time.Hour, m)
+	throughputTracker.Register(eventBus)
+	lotTracker := lot.NewTracker(logger)
+	lotTracker.Register(eventBus)
+	qualityTracker := quality.NewTracker(m)
+	qualityTracker.Register(eventBus)
+	defectTracker := defect.NewTracker(24*time.Hour, m)
+	defectTracker.Register(eventBus)
+	reliabilityTracker := reliability.NewTracker(24*time.Hour, m)
+	reliabilityTracker.Register(eventBus)
+	yieldTracker := yield.NewTracker(2, yield.Costs{}, 24*time.Hour, m)
+	yieldTracker.Register(eventBus)
 
-	wf := engine.NewWorkflowEngine(cfg.Workflows, cfg.ResourcePools, logger, eventBus, cfg.StepDelayMs)
+	wf := engine.NewWorkflowEngine(cfg.Workflows, cfg.ResourcePools, cfg.Lifecycles, logger, eventBus, cfg.StepDelayMs)
+	slaTracker := sla.NewTracker(wf.Workflows().Route, sla.Estimates{}, 24*time.Hour, m)
+	slaTracker.Register(eventBus)
 
 	registerStations(wf, logger, cfg.StationDelayMs)
+	injector := chaos.NewInjector(logger, m)
+	wf.Stations().SetChaos(injector)
 
 	remoteServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if remoteShouldFail {
@@ -70,40 +202,62 @@ func setupTestApp(t *testing.T, remoteShouldFail bool) (*engine.Scheduler, *web.
 		}
 	}))
 	t.Cleanup(remoteServer.Close)
-	wf.RegisterStation(station.NewRemoteStation(types.StationAOI, remoteServer.URL, logger))
+	wf.RegisterStation(station.NewRemoteStation(types.StationAOI, remoteServer.URL, station.RemoteOptions{}, logger))
 
-	scheduler := engine.NewScheduler(wf, cfg.MaxWorkers, wal, stateTracker, logger)
+	scheduler := engine.NewScheduler(wf, cfg.MaxWorkers, wal, stateTracker, m, logger)
+	scheduler.SetPlanning(reload.Planning(cfg))
 
-	mux := http.NewServeMux()
-	mux.Handle("/metrics", promhttp.Handler())
-	mux.HandleFunc("/ws", hub.ServeWs)
-	mux.HandleFunc("/api/state", func(w http.ResponseWriter, r *http.Request) {
-		json.NewEncoder(w).Encode(stateTracker.GetStateSnapshot())
-	})
-	mux.HandleFunc("/api/tasks", func(w http.ResponseWriter, r *http.Request) {
-		var p types.Product
-		json.NewDecoder(r.Body).Decode(&p)
-		scheduler.SubmitTask(&p)
-		w.WriteHeader(http.StatusAccepted)
-	})
+	apiServer := api.NewServer(scheduler, hub, stateTracker, historyStore, "", nil, nil, m, logger)
+	sim := simulator.New(scheduler, simulator.Settings{}, logger)
+	t.Cleanup(func() { sim.Stop() })
+	sim.Register(eventBus)
+	apiServer.SetSimulator(sim)
+	apiServer.SetOEE(oeeTracker)
+	apiServer.SetThroughput(throughputTracker)
+	apiServer.SetLots(lotTracker)
+	importer := b2mml.New(cfg.B2MML, scheduler, stateTracker, lotTracker, m, logger)
+	apiServer.SetB2MML(importer)
+	apiServer.SetQuality(qualityTracker)
+	apiServer.SetDefects(defectTracker)
+	maintenanceTracker := maintenance.NewTracker(nil, wf.Stations(), m, logger)
+	maintenanceTracker.Register(eventBus)
+	apiServer.SetMaintenance(maintenanceTracker)
+	apiServer.SetReliability(reliabilityTracker)
+	apiServer.SetYield(yieldTracker)
+	apiServer.SetSLA(slaTracker)
+	apiServer.SetWhatIf(whatif.Baseline{DefaultCycle: time.Duration(cfg.StationDelayMs) * time.Millisecond})
+	apiServer.SetChaos(injector)
+	auditLog, err := audit.Open(filepath.Join(tmpDir, "audit.jsonl"))
+	if err != nil {
+		t.Fatalf("无法打开审计日志: %v", err)
+	}
+	t.Cleanup(func() { auditLog.Close() })
+	apiServer.SetAuditLog(auditLog)
+	apiServer.SetLogLevels(logLevels)
+	flags, err := features.New(cfg.Features, m)
+	if err != nil {
+		t.Fatalf("无法初始化功能开关: %v", err)
+	}
+	apiServer.SetReloader(reload.New(cfg, scheduler, sim, logLevels, flags, logger))
+	apiServer.SetFeatures(flags)
 
-	server := httptest.NewServer(mux)
+	server := httptest.NewServer(apiServer.Handler())
 	t.Cleanup(server.Close)
 
 	go scheduler.Start(context.Background())
 
-	return scheduler, stateTracker, server
+	return &testApp{scheduler: scheduler, stateTracker: stateTracker, hub: hub, history: historyStore, simulator: sim, server: server, metrics: m, logLevels: logLevels, flags: flags, maintenance: maintenanceTracker, bus: eventBus, b2mml: importer, logger: logger}
 }
 
 func registerStations(wf *engine.WorkflowEngine, logger *slog.Logger, delayMs int) {
-	wf.RegisterStation(station.NewStation(types.StationCAM, logger, delayMs))
-	wf.RegisterStation(station.NewStation(types.StationDrill, logger, delayMs))
-	wf.RegisterStation(station.NewStation(types.StationLami, logger, delayMs))
-	wf.RegisterStation(station.NewStation(types.StationEtch, logger, delayMs))
-	wf.RegisterStation(station.NewStation(types.StationMask, logger, delayMs))
-	wf.RegisterStation(station.NewStation(types.StationSilk, logger, delayMs))
-	wf.RegisterStation(station.NewStation(types.StationETest, logger, delayMs))
-	wf.RegisterStation(station.NewStation(types.StationPack, logger, delayMs))
+	wf.RegisterStation(station.NewStation(types.StationCAM, logger, delayMs, 0))
+	wf.RegisterStation(station.NewStation(types.StationDrill, logger, delayMs, 0))
+	wf.RegisterStation(station.NewStation(types.StationLami, logger, delayMs, 0))
+	wf.RegisterStation(station.NewStation(types.StationEtch, logger, delayMs, 0))
+	wf.RegisterStation(station.NewStation(types.StationMask, logger, delayMs, 0))
+	wf.RegisterStation(station.NewStation(types.StationSilk, logger, delayMs, 0))
+	wf.RegisterStation(station.NewStation(types.StationETest, logger, delayMs, 0))
+	wf.RegisterStation(station.NewStation(types.StationPack, logger, delayMs, 0))
 }
 
 func TestHappyPath_MultiLayer(t *testing.T) {
@@ -150,6 +304,397 @@ func TestHappyPath_MultiLayer(t *testing.T) {
 	t.Log("测试通过，但历史记录断言被跳过。请在日志中确认 'station_id: STATION_LAMI' 是否存在。")
 }
 
+// scrapeMetrics 返回 /metrics 的文本格式输出
+func scrapeMetrics(t *testing.T, serverURL string) string {
+	t.Helper()
+	resp, err := http.Get(serverURL + "/metrics")
+	if err != nil {
+		t.Fatalf("请求 /metrics 失败: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+// completeMultiLayer 启动一个测试应用，通过 /api/tasks 提交一块 4 层板并等待它完成，返回服务地址
+func completeMultiLayer(t *testing.T, id string) string {
+	t.Helper()
+	_, stateTracker, server := setupTestApp(t, false)
+	body, _ := json.Marshal(types.Product{ID: id, Type: "PCB_MULTILAYER", Attrs: map[string]interface{}{"layers": 4}})
+	resp, err := http.Post(server.URL+"/api/tasks", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("提交任务失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("预期状态码 202, 得到 %d", resp.StatusCode)
+	}
+	for i := 0; ; i++ {
+		if s, ok := stateTracker.GetStateSnapshot().Products[id]; ok && s.Status == "COMPLETED" {
+			return server.URL
+		}
+		if i == 100 {
+			t.Fatalf("任务 %s 未在规定时间内完成", id)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// waitForMetric 等待 /metrics 中出现 series 并返回抓取到的文本，指标处理器是异步执行的，结束时的指标在状态变更后不久才被观测
+func waitForMetric(t *testing.T, serverURL, series string) string {
+	t.Helper()
+	for i := 0; ; i++ {
+		if text := scrapeMetrics(t, serverURL); strings.Contains(text, series) {
+			return text
+		}
+		if i == 20 {
+			t.Fatalf("/metrics 中缺少 %s", series)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestMetrics_LeadTimeByProductType(t *testing.T) {
+	serverURL := completeMultiLayer(t, "Test_LeadTime_01")
+	waitForMetric(t, serverURL, `product_lead_time_seconds_count{namespace="default",status="success",type="PCB_MULTILAYER"}`)
+}
+
+func TestMetrics_StepDurationByWorkflowVersion(t *testing.T) {
+	serverURL := completeMultiLayer(t, "Test_StepDuration_01")
+
+	stepDuration := `workflow_step_duration_seconds_count{namespace="default",station_id="STATION_LAMI",type="PCB_MULTILAYER",workflow_version="1"}`
+	if !strings.Contains(scrapeMetrics(t, serverURL), stepDuration) {
+		t.Errorf("/metrics 中缺少 %s", stepDuration)
+	}
+}
+
+func TestMetrics_APIRequestsByRoute(t *testing.T) {
+	serverURL := completeMultiLayer(t, "Test_APIRequests_01")
+
+	// 旧路径转发到 /api/v1 后按当前版本的路由模式记录
+	apiRequests := `api_requests_total{route="/api/v1/tasks",status="202"}`
+	if !strings.Contains(scrapeMetrics(t, serverURL), apiRequests) {
+		t.Errorf("/metrics 中缺少 %s", apiRequests)
+	}
+}
+
+func TestMetrics_SchedulerAndWALTimings(t *testing.T) {
+	serverURL := completeMultiLayer(t, "Test_Timings_01")
+	metricsText := scrapeMetrics(t, serverURL)
+
+	// 提交、入堆、出堆、WAL 写入和提交到分派的延迟分别计时
+	for _, timing := range []string{
+		"scheduler_submit_duration_seconds_count 1",
+		`scheduler_dispatch_latency_seconds_count{namespace="default"} 1`,
+		`scheduler_queue_operation_duration_seconds_count{op="push"} 1`,
+		`scheduler_queue_operation_duration_seconds_count{op="pop"} 1`,
+		`wal_operation_duration_seconds_count{op="append"} 1`,
+	} {
+		if !strings.Contains(metricsText, timing) {
+			t.Errorf("/metrics 中缺少 %s", timing)
+		}
+	}
+}
+
+func TestMetrics_LeadTimeExemplar(t *testing.T) {
+	serverURL := completeMultiLayer(t, "Test_Exemplar_01")
+	waitForMetric(t, serverURL, `product_lead_time_seconds_count{namespace="default",status="success",type="PCB_MULTILAYER"}`)
+
+	// 以 OpenMetrics 格式抓取时，交期直方图附带该工件的 exemplar
+	req, _ := http.NewRequest(http.MethodGet, serverURL+"/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("请求 /metrics 失败: %v", err)
+	}
+	openMetrics, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	exemplar := regexp.MustCompile(`product_lead_time_seconds_bucket\{namespace="default",status="success",type="PCB_MULTILAYER",le="[^"]+"\} \d+ # \{[^}]*product_id="Test_Exemplar_01"[^}]*\}`)
+	if !exemplar.Match(openMetrics) {
+		t.Error("交期直方图中缺少工件 Test_Exemplar_01 的 exemplar")
+	}
+}
+
+// fsmTransition 是状态转移表中的一条规则
+type fsmTransition[S ~string, E ~string] struct {
+	from S
+	ev   E
+	to   S
+}
+
+// checkTransitionTable 从每个状态触发每个事件：表中的转移成功并到达目标状态，其余事件被拒绝且状态不变
+// reach 返回一个已到达指定状态的新状态机
+func checkTransitionTable[S ~string, E ~string](t *testing.T, name string, states []S, events []E, table []fsmTransition[S, E], reach func(S) *fsm.FSM[S, E]) {
+	t.Helper()
+	for _, from := range states {
+		for _, ev := range events {
+			want, permitted := from, false
+			for _, tr := range table {
+				if tr.from == from && tr.ev == ev {
+					want, permitted = tr.to, true
+				}
+			}
+			f := reach(from)
+			if f.State() != from {
+				t.Fatalf("%s: 无法到达 %s, 停在 %s", name, from, f.State())
+			}
+			if f.Can(ev) != permitted {
+				t.Errorf("%s: %s 状态下 Can(%s) 应为 %v", name, from, ev, permitted)
+			}
+			err := f.Fire(ev)
+			if permitted && err != nil {
+				t.Errorf("%s: %s --%s--> %s 应被允许, 得到 %v", name, from, ev, want, err)
+			}
+			if !permitted && (err == nil || !strings.Contains(err.Error(), string(ev)) || !strings.Contains(err.Error(), string(from))) {
+				t.Errorf("%s: %s 状态下的 %s 应被拒绝并说明事件和状态, 得到 %v", name, from, ev, err)
+			}
+			if f.State() != want {
+				t.Errorf("%s: %s --%s--> 预期 %s, 得到 %s", name, from, ev, want, f.State())
+			}
+		}
+	}
+}
+
+func TestProductFSM_TransitionTables(t *testing.T) {
+	states := []fsm.State{fsm.StateCreated, fsm.StateProcessing, fsm.StateQualityCheck, fsm.StateLaminationInspection,
+		fsm.StateCompleted, fsm.StateFailed, fsm.StateCompensating, fsm.StateCompensated, fsm.StateCancelled}
+	events := []fsm.Event{fsm.EventStart, fsm.EventEnterQC, fsm.EventPassQC, fsm.EventFinish, fsm.EventFail, fsm.EventCompensate,
+		fsm.EventRollback, fsm.EventCancel, fsm.EventEnterLamiInspection, fsm.EventPassLamiInspection}
+	type tr = fsmTransition[fsm.State, fsm.Event]
+	base := []tr{
+		{fsm.StateCreated, fsm.EventStart, fsm.StateProcessing},
+		{fsm.StateCreated, fsm.EventCancel, fsm.StateCancelled},
+		{fsm.StateProcessing, fsm.EventFinish, fsm.StateCompleted},
+		{fsm.StateProcessing, fsm.EventFail, fsm.StateFailed},
+		{fsm.StateProcessing, fsm.EventCancel, fsm.StateCancelled},
+		{fsm.StateFailed, fsm.EventCompensate, fsm.StateCompensating},
+		{fsm.StateCompensating, fsm.EventRollback, fsm.StateCompensated},
+	}
+	qc := []tr{
+		{fsm.StateProcessing, fsm.EventEnterQC, fsm.StateQualityCheck},
+		{fsm.StateQualityCheck, fsm.EventPassQC, fsm.StateProcessing},
+		{fsm.StateQualityCheck, fsm.EventFinish, fsm.StateCompleted},
+		{fsm.StateQualityCheck, fsm.EventFail, fsm.StateFailed},
+		{fsm.StateQualityCheck, fsm.EventCancel, fsm.StateCancelled},
+	}
+	lamination := []tr{
+		{fsm.StateProcessing, fsm.EventEnterLamiInspection, fsm.StateLaminationInspection},
+		{fsm.StateLaminationInspection, fsm.EventPassLamiInspection, fsm.StateProcessing},
+		{fsm.StateLaminationInspection, fsm.EventFail, fsm.StateFailed},
+		{fsm.StateLaminationInspection, fsm.EventCancel, fsm.StateCancelled},
+	}
+	// 到达各状态的事件序列，变体中不存在的状态用标准流程的状态机代替 (只用于检查该状态下的事件全部被拒绝)
+	paths := map[fsm.State][]fsm.Event{
+		fsm.StateCreated:              nil,
+		fsm.StateProcessing:           {fsm.EventStart},
+		fsm.StateQualityCheck:         {fsm.EventStart, fsm.EventEnterQC},
+		fsm.StateLaminationInspection: {fsm.EventStart, fsm.EventEnterLamiInspection},
+		fsm.StateCompleted:            {fsm.EventStart, fsm.EventFinish},
+		fsm.StateFailed:               {fsm.EventStart, fsm.EventFail},
+		fsm.StateCompensating:         {fsm.EventStart, fsm.EventFail, fsm.EventCompensate},
+		fsm.StateCompensated:          {fsm.EventStart, fsm.EventFail, fsm.EventCompensate, fsm.EventRollback},
+		fsm.StateCancelled:            {fsm.EventCancel},
+	}
+
+	cases := []struct {
+		variant fsm.Variant
+		table   []tr
+	}{
+		{fsm.VariantStandard, slices.Concat(base, qc)},
+		{fsm.VariantPrototype, base},
+		{fsm.VariantMultilayer, slices.Concat(base, qc, lamination)},
+	}
+	for _, c := range cases {
+		reachable := map[fsm.State]bool{fsm.StateCreated: true}
+		for _, r := range c.table {
+			reachable[r.to] = true
+		}
+		var variantStates []fsm.State
+		for _, s := range states {
+			if reachable[s] {
+				variantStates = append(variantStates, s)
+			}
+		}
+		checkTransitionTable(t, string(c.variant), variantStates, events, c.table, func(s fsm.State) *fsm.ProductFSM {
+			f := fsm.NewFSMWithVariant("FSM_TABLE", c.variant)
+			for _, ev := range paths[s] {
+				if err := f.Fire(ev); err != nil {
+					t.Fatalf("%s: 到达 %s 失败: %v", c.variant, s, err)
+				}
+			}
+			return f
+		})
+		if f := fsm.NewFSMWithVariant("FSM_TABLE", c.variant); f.Name() != string(c.variant) || f.State() != fsm.StateCreated {
+			t.Errorf("%s: 状态机应以 CREATED 开始, 得到 %s %s", c.variant, f.Name(), f.State())
+		}
+	}
+
+	if f := fsm.NewFSMWithVariant("FSM_UNKNOWN", fsm.Variant("unknown")); f.Name() != string(fsm.VariantStandard) {
+		t.Errorf("未知变体应回退到标准流程, 得到 %s", f.Name())
+	}
+}
+
+func TestStationFSM_TransitionTable(t *testing.T) {
+	type tr = fsmTransition[fsm.StationState, fsm.StationEvent]
+	table := []tr{
+		{fsm.StationIdle, fsm.StationEventAcquire, fsm.StationBusy},
+		{fsm.StationIdle, fsm.StationEventBreakdown, fsm.StationDown},
+		{fsm.StationIdle, fsm.StationEventStartService, fsm.StationMaintenance},
+		{fsm.StationBusy, fsm.StationEventRelease, fsm.StationIdle},
+		{fsm.StationBusy, fsm.StationEventBreakdown, fsm.StationDown},
+		{fsm.StationDown, fsm.StationEventRepair, fsm.StationIdle},
+		{fsm.StationDown, fsm.StationEventStartService, fsm.StationMaintenance},
+		{fsm.StationMaintenance, fsm.StationEventEndService, fsm.StationIdle},
+	}
+	paths := map[fsm.StationState][]fsm.StationEvent{
+		fsm.StationIdle:        nil,
+		fsm.StationBusy:        {fsm.StationEventAcquire},
+		fsm.StationDown:        {fsm.StationEventBreakdown},
+		fsm.StationMaintenance: {fsm.StationEventStartService},
+	}
+	states := []fsm.StationState{fsm.StationIdle, fsm.StationBusy, fsm.StationDown, fsm.StationMaintenance}
+	events := []fsm.StationEvent{fsm.StationEventAcquire, fsm.StationEventRelease, fsm.StationEventBreakdown,
+		fsm.StationEventRepair, fsm.StationEventStartService, fsm.StationEventEndService}
+	checkTransitionTable(t, "station", states, events, table, func(s fsm.StationState) *fsm.StationFSM {
+		f := fsm.NewStationFSM(string(types.StationDrill))
+		for _, ev := range paths[s] {
+			if err := f.Fire(ev); err != nil {
+				t.Fatalf("到达 %s 失败: %v", s, err)
+			}
+		}
+		return f
+	})
+
+	// 工站的状态变更以 StationStatusChanged 发布，带有工站 ID、触发事件和序号
+	bus := event.NewBus()
+	changes := make(chan event.Event, 4)
+	bus.Subscribe(event.StationStatusChanged, func(e event.Event) { changes <- e })
+	bus.Subscribe(event.StateChanged, func(e event.Event) { t.Errorf("工站状态机不应发布工件状态变更: %+v", e) })
+	f := fsm.NewStationFSM(string(types.StationDrill))
+	f.SetEventBus(bus)
+	f.Fire(fsm.StationEventAcquire)
+	f.Fire(fsm.StationEventAcquire) // 被拒绝的事件不发布
+	f.Fire(fsm.StationEventRelease)
+	got := map[uint64]event.Event{}
+	for i := 0; i < 2; i++ {
+		select {
+		case e := <-changes:
+			got[e.Seq] = e
+		case <-time.After(time.Second):
+			t.Fatalf("预期 2 条工站状态变更, 得到 %d 条", len(got))
+		}
+	}
+	if e := got[1]; e.StationID != types.StationDrill || e.FromState != "IDLE" || e.ToState != "BUSY" || e.Trigger != "ACQUIRE" {
+		t.Errorf("第一条状态变更不正确: %+v", e)
+	}
+	if e := got[2]; e.FromState != "BUSY" || e.ToState != "IDLE" || e.Trigger != "RELEASE" {
+		t.Errorf("第二条状态变更不正确: %+v", e)
+	}
+	select {
+	case e := <-changes:
+		t.Errorf("被拒绝的事件不应发布状态变更: %+v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestFSM_HookOrderingAndFailures(t *testing.T) {
+	def := fsm.NewBuilder[string, string]("hooks", "A").
+		Permit("A", "go", "B").
+		Permit("B", "back", "A").
+		Build()
+	f := def.New("HOOK_1")
+	var calls []string
+	record := func(name string) fsm.Action[string] {
+		return func(targetID, ev string) {
+			// 动作在持有锁时同步执行，直接读取 Current 确认动作执行时的状态
+			calls = append(calls, fmt.Sprintf("%s(%s,%s)@%s", name, targetID, ev, f.Current))
+		}
+	}
+	f.OnExit("A", record("exit-A-1"))
+	f.OnExit("A", record("exit-A-2"))
+	f.OnEnter("B", record("enter-B-1"))
+	f.OnEnter("B", record("enter-B-2"))
+	f.OnExit("B", record("exit-B"))
+	f.RegisterCallback("A", func(targetID string) { calls = append(calls, "callback-A("+targetID+")") })
+
+	// 先按注册顺序执行离开旧状态的动作，切换状态后再按注册顺序执行进入新状态的动作
+	if err := f.Fire("go"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"exit-A-1(HOOK_1,go)@A", "exit-A-2(HOOK_1,go)@A", "enter-B-1(HOOK_1,go)@B", "enter-B-2(HOOK_1,go)@B"}
+	if !slices.Equal(calls, want) {
+		t.Errorf("动作的执行顺序不正确:\n得到 %v\n预期 %v", calls, want)
+	}
+
+	// 被拒绝的事件不执行任何动作，状态不变
+	calls = nil
+	if err := f.Fire("go"); err == nil || f.State() != "B" || len(calls) != 0 {
+		t.Errorf("被拒绝的事件不应执行动作或改变状态: %v %s %v", err, f.State(), calls)
+	}
+	if err := f.Fire("back"); err != nil || !slices.Equal(calls, []string{"exit-B(HOOK_1,back)@B", "callback-A(HOOK_1)"}) {
+		t.Errorf("返回 A 时的动作不正确: %v %v", err, calls)
+	}
+
+	// 动作没有返回值，不能否决转移；动作 panic 时 Fire 随之 panic 并释放锁：
+	// 离开动作 panic 时状态不变，进入动作 panic 时状态已经切换
+	fire := func(f *fsm.FSM[string, string], ev string) (recovered any) {
+		defer func() { recovered = recover() }()
+		f.Fire(ev)
+		return nil
+	}
+	exitFails := def.New("HOOK_2")
+	failed := false
+	exitFails.OnExit("A", func(string, string) {
+		if !failed {
+			failed = true
+			panic("exit failed")
+		}
+	})
+	if r := fire(exitFails, "go"); r != "exit failed" || exitFails.State() != "A" {
+		t.Errorf("离开动作 panic 时状态应保持 A: %v %s", r, exitFails.State())
+	}
+	if err := exitFails.Fire("go"); err != nil || exitFails.State() != "B" {
+		t.Errorf("离开动作 panic 后状态机应仍可使用: %v %s", err, exitFails.State())
+	}
+
+	enterFails := def.New("HOOK_3")
+	enterFails.OnEnter("B", func(string, string) { panic("enter failed") })
+	if r := fire(enterFails, "go"); r != "enter failed" || enterFails.State() != "B" {
+		t.Errorf("进入动作 panic 时状态应已切换到 B: %v %s", r, enterFails.State())
+	}
+	if err := enterFails.Fire("back"); err != nil || enterFails.State() != "A" {
+		t.Errorf("进入动作 panic 后状态机应仍可使用: %v %s", err, enterFails.State())
+	}
+}
+
+func TestMetrics_IsolatedPerApp(t *testing.T) {
+	a := newTestApp(t, false)
+	b := newTestApp(t, false)
+
+	body, _ := json.Marshal(types.Product{ID: "Test_Metrics_Isolated", Type: "PCB_SINGLE"})
+	resp, err := http.Post(a.server.URL+"/api/v1/tasks", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("提交任务失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("预期状态码 202, 得到 %d", resp.StatusCode)
+	}
+
+	submitted := `api_requests_total{route="/api/v1/tasks",status="202"} 1`
+	if text := scrapeMetrics(t, a.server.URL); !strings.Contains(text, submitted) {
+		t.Errorf("实例 A 的 /metrics 中缺少 %s", submitted)
+	}
+	// 两个实例的指标互不影响，各自的注册表仍然包含 Go 运行时指标
+	text := scrapeMetrics(t, b.server.URL)
+	if strings.Contains(text, `api_requests_total{route="/api/v1/tasks"`) {
+		t.Errorf("实例 B 的 /metrics 不应包含实例 A 的请求")
+	}
+	if !strings.Contains(text, "go_goroutines") {
+		t.Errorf("实例 B 的 /metrics 中缺少 go_goroutines")
+	}
+}
+
 func TestSagaRollback_OnRemoteFailure(t *testing.T) {
 	_, stateTracker, server := setupTestApp(t, true)
 
@@ -188,4 +733,6862 @@ func TestSagaRollback_OnRemoteFailure(t *testing.T) {
 	if finalState.Status != "COMPENSATED" {
 		t.Errorf("预期最终状态为 COMPENSATED, 得到 %s", finalState.Status)
 	}
+
+	// 已补偿的任务可以重试，新任务通过 retry_of 关联原任务
+	resp, err = http.Post(server.URL+"/api/tasks/"+task.ID+"/retry", "application/json", bytes.NewBufferString(`{"attrs":{"rework":true}}`))
+	if err != nil {
+		t.Fatalf("重试任务失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("预期重试返回 202, 得到 %d", resp.StatusCode)
+	}
+	var retry map[string]string
+	json.NewDecoder(resp.Body).Decode(&retry)
+	if retry["retry_of"] != task.ID {
+		t.Errorf("预期 retry_of 为 %s, 得到 %q", task.ID, retry["retry_of"])
+	}
+	if s, ok := stateTracker.GetProduct(retry["id"]); !ok || s.RetryOf != task.ID {
+		t.Errorf("预期重试任务 %s 出现在状态快照中并关联原任务", retry["id"])
+	}
+}
+
+func TestTaskDetail_IncludesHistoryAndTraceID(t *testing.T) {
+	_, stateTracker, server := setupTestApp(t, false)
+
+	task := types.Product{
+		ID:   "Test_Detail_01",
+		Type: "PCB_PROTOTYPE",
+	}
+	body, _ := json.Marshal(task)
+	resp, err := http.Post(server.URL+"/api/tasks", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("提交任务失败: %v", err)
+	}
+	resp.Body.Close()
+
+	finished := false
+	for i := 0; i < 10; i++ {
+		time.Sleep(500 * time.Millisecond)
+		// 电测工站有随机失败，补偿完成同样视为任务已结束
+		if s, ok := stateTracker.GetProduct(task.ID); ok && (s.Status == "COMPLETED" || s.Status == "COMPENSATED") {
+			finished = true
+			break
+		}
+	}
+	if !finished {
+		t.Fatalf("任务 %s 未在规定时间内结束", task.ID)
+	}
+
+	resp, err = http.Get(server.URL + "/api/tasks/" + task.ID)
+	if err != nil {
+		t.Fatalf("查询任务详情失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("预期状态码 200, 得到 %d", resp.StatusCode)
+	}
+
+	var detail api.TaskDetail
+	if err := json.NewDecoder(resp.Body).Decode(&detail); err != nil {
+		t.Fatalf("解析任务详情失败: %v", err)
+	}
+	if detail.TraceID == "" {
+		t.Errorf("预期任务详情包含 trace_id")
+	}
+	if detail.Lifecycle != "prototype" {
+		t.Errorf("预期生命周期为 prototype, 得到 %q", detail.Lifecycle)
+	}
+	if detail.History == nil || len(detail.History.Steps) == 0 {
+		t.Fatalf("预期任务详情包含步骤履历")
+	}
+	if first := detail.History.Steps[0]; first.StationID != types.StationCAM {
+		t.Errorf("预期第一个步骤为 %s, 得到 %s", types.StationCAM, first.StationID)
+	}
+
+	resp, err = http.Get(server.URL + "/api/tasks/Unknown_Task")
+	if err != nil {
+		t.Fatalf("查询任务详情失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("预期不存在的任务返回 404, 得到 %d", resp.StatusCode)
+	}
+}
+
+func TestCancelTask_FinishedReturnsConflict(t *testing.T) {
+	_, stateTracker, server := setupTestApp(t, false)
+
+	task := types.Product{ID: "Test_Cancel_01", Type: "PCB_PROTOTYPE"}
+	body, _ := json.Marshal(task)
+	resp, err := http.Post(server.URL+"/api/tasks", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("提交任务失败: %v", err)
+	}
+	resp.Body.Close()
+
+	finished := false
+	for i := 0; i < 10; i++ {
+		time.Sleep(500 * time.Millisecond)
+		// 电测工站有随机失败，补偿完成同样视为任务已结束
+		if s, ok := stateTracker.GetProduct(task.ID); ok && (s.Status == "COMPLETED" || s.Status == "COMPENSATED") {
+			finished = true
+			break
+		}
+	}
+	if !finished {
+		t.Fatalf("任务 %s 未在规定时间内结束", task.ID)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, server.URL+"/api/tasks/"+task.ID, nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("取消任务失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("预期已结束的任务返回 409, 得到 %d", resp.StatusCode)
+	}
+
+	req, _ = http.NewRequest(http.MethodDelete, server.URL+"/api/tasks/Unknown_Task", nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("取消任务失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("预期不存在的任务返回 404, 得到 %d", resp.StatusCode)
+	}
+}
+
+func TestScheduler_FinishedTasksEvictedAfterTTL(t *testing.T) {
+	app := newTestApp(t, false)
+	app.scheduler.SetFinishedTTL(200 * time.Millisecond)
+	app.scheduler.Pause()
+
+	// 暂停期间任务留在队列中，取消后记为已结束；保留时间内再次取消返回已结束
+	app.scheduler.SubmitTask(&types.Product{ID: "TTL_1", Type: "PCB_PROTOTYPE"})
+	if err := app.scheduler.Cancel("TTL_1"); err != nil {
+		t.Fatalf("取消队列中的任务失败: %v", err)
+	}
+	if err := app.scheduler.Cancel("TTL_1"); !errors.Is(err, engine.ErrTaskFinished) {
+		t.Fatalf("预期保留时间内返回 ErrTaskFinished, 得到 %v", err)
+	}
+
+	// 超过保留时间后记录被淘汰，与从未提交过的任务一样
+	time.Sleep(250 * time.Millisecond)
+	app.scheduler.SubmitTask(&types.Product{ID: "TTL_2", Type: "PCB_PROTOTYPE"})
+	if err := app.scheduler.Cancel("TTL_2"); err != nil {
+		t.Fatalf("取消队列中的任务失败: %v", err)
+	}
+	if err := app.scheduler.Cancel("TTL_1"); !errors.Is(err, engine.ErrTaskNotFound) {
+		t.Errorf("预期超过保留时间后返回 ErrTaskNotFound, 得到 %v", err)
+	}
+	if err := app.scheduler.Cancel("TTL_2"); !errors.Is(err, engine.ErrTaskFinished) {
+		t.Errorf("预期未超过保留时间的任务返回 ErrTaskFinished, 得到 %v", err)
+	}
+}
+
+func TestAuth_APIKeyJWTAndRoles(t *testing.T) {
+	cfg := config.AuthConfig{
+		Enabled: true,
+		APIKeys: []config.APIKeyConfig{
+			{Name: "dashboard", Key: "test-key", Roles: []string{"viewer"}},
+			{Name: "planner", Key: "operator-key", Roles: []string{"operator"}},
+		},
+		JWT: config.JWTConfig{Secret: "test-secret", Audience: "factory"},
+	}
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	m := metrics.New(metrics.NewRegistry())
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := auth.PrincipalFromContext(r.Context())
+		w.Write([]byte(p.Subject))
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/api/state", auth.RequireRole(auth.RoleViewer, m, logger)(ok))
+	mux.Handle("/api/tasks", auth.RequireRole(auth.RoleOperator, m, logger)(ok))
+	server := httptest.NewServer(auth.Middleware(auth.New(cfg), m, logger)(mux))
+	t.Cleanup(server.Close)
+
+	signer := auth.NewJWTAuthenticator(cfg.JWT, nil)
+	validToken, _ := signer.Sign(auth.Claims{Subject: "operator", Audience: auth.Audience{"factory"}, ExpiresAt: time.Now().Add(time.Hour).Unix(), Roles: []string{"operator"}})
+	expiredToken, _ := signer.Sign(auth.Claims{Subject: "operator", Audience: auth.Audience{"factory"}, ExpiresAt: time.Now().Add(-time.Hour).Unix()})
+	otherAudience, _ := signer.Sign(auth.Claims{Subject: "operator", Audience: auth.Audience{"other"}, ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	noExpiry, _ := signer.Sign(auth.Claims{Subject: "operator", Audience: auth.Audience{"factory"}, Roles: []string{"operator"}})
+
+	cases := []struct {
+		name   string
+		path   string
+		header string
+		value  string
+		want   int
+	}{
+		{"缺少凭证", "/api/state", "", "", http.StatusUnauthorized},
+		{"有效 API Key", "/api/state", "X-API-Key", "test-key", http.StatusOK},
+		{"无效 API Key", "/api/state", "X-API-Key", "wrong-key", http.StatusUnauthorized},
+		{"有效 JWT", "/api/state", "Authorization", "Bearer " + validToken, http.StatusOK},
+		{"过期 JWT", "/api/state", "Authorization", "Bearer " + expiredToken, http.StatusUnauthorized},
+		{"没有 exp 的 JWT", "/api/tasks", "Authorization", "Bearer " + noExpiry, http.StatusUnauthorized},
+		{"受众不匹配的 JWT", "/api/state", "Authorization", "Bearer " + otherAudience, http.StatusForbidden},
+		{"查看者提交任务", "/api/tasks", "X-API-Key", "test-key", http.StatusForbidden},
+		{"操作员提交任务", "/api/tasks", "X-API-Key", "operator-key", http.StatusOK},
+		{"JWT 角色提交任务", "/api/tasks", "Authorization", "Bearer " + validToken, http.StatusOK},
+	}
+	for _, c := range cases {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+c.path, nil)
+		if c.header != "" {
+			req.Header.Set(c.header, c.value)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: 请求失败: %v", c.name, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != c.want {
+			t.Errorf("%s: 预期状态码 %d, 得到 %d", c.name, c.want, resp.StatusCode)
+		}
+	}
+}
+
+func TestRateLimit_PerClientBurst(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	limiter := ratelimit.NewLimiter(0.001, 2)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	server := httptest.NewServer(ratelimit.Middleware(limiter, "/api/tasks", metrics.New(metrics.NewRegistry()), logger)(ok))
+	t.Cleanup(server.Close)
+
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		resp, err := http.Post(server.URL, "application/json", nil)
+		if err != nil {
+			t.Fatalf("请求失败: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Fatalf("第 %d 个请求: 预期状态码 %d, 得到 %d", i+1, want, resp.StatusCode)
+		}
+		if want == http.StatusTooManyRequests && resp.Header.Get("Retry-After") == "" {
+			t.Error("429 响应缺少 Retry-After 头")
+		}
+	}
+}
+
+func TestHubClose_SendsGoingAway(t *testing.T) {
+	hub := web.NewHub(metrics.New(metrics.NewRegistry()))
+	go hub.Run()
+	server := httptest.NewServer(http.HandlerFunc(hub.ServeWs))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("连接 WebSocket 失败: %v", err)
+	}
+	defer conn.Close()
+	time.Sleep(50 * time.Millisecond) // 等待 Hub 完成注册
+
+	hub.Close()
+	hub.Broadcast(web.Message{Type: web.MessagePatch}) // 停机后广播不应阻塞
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err = conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Fatalf("预期收到 1001 关闭帧, 得到: %v", err)
+	}
+}
+
+func TestWebSocket_SnapshotThenPatches(t *testing.T) {
+	scheduler, _, server := setupTestApp(t, false)
+	scheduler.SubmitTask(&types.Product{ID: "WS_Before", Type: "PCB_PROTOTYPE", Attrs: map[string]interface{}{"layers": 2}})
+	time.Sleep(50 * time.Millisecond)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("连接 WebSocket 失败: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var first web.Message
+	if err := conn.ReadJSON(&first); err != nil {
+		t.Fatalf("读取快照失败: %v", err)
+	}
+	if first.Type != web.MessageSnapshot || first.State == nil {
+		t.Fatalf("首条消息应为快照, 得到 %s", first.Type)
+	}
+	if _, ok := first.State.Products["WS_Before"]; !ok {
+		t.Error("快照中缺少连接前提交的工件")
+	}
+
+	scheduler.SubmitTask(&types.Product{ID: "WS_After", Type: "PCB_PROTOTYPE", Attrs: map[string]interface{}{"layers": 2}})
+	for {
+		var msg web.Message
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("未收到新工件的补丁: %v", err)
+		}
+		if msg.Type != web.MessagePatch || msg.Product == nil {
+			t.Fatalf("后续消息应为单个工件的补丁, 得到 %s", msg.Type)
+		}
+		if msg.Product.ID == "WS_After" {
+			if msg.Seq <= first.Seq {
+				t.Fatalf("补丁序号 %d 应大于快照序号 %d", msg.Seq, first.Seq)
+			}
+			return
+		}
+	}
+}
+
+func TestWebSocket_SubscribeFiltersPatches(t *testing.T) {
+	scheduler, _, server := setupTestApp(t, false)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("连接 WebSocket 失败: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var msg web.Message
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != web.MessageSnapshot {
+		t.Fatalf("首条消息应为快照: %v", err)
+	}
+	conn.WriteJSON(web.ClientMessage{Type: web.ClientMessageSubscribe, Filter: web.Filter{ProductIDs: []string{"WS_Watched"}}})
+	// 订阅生效前已发出的广播 (例如启动时的工站状态) 可能先于过滤后的快照到达
+	for msg.Type = ""; msg.Type != web.MessageSnapshot; {
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("订阅后应收到过滤后的快照: %v", err)
+		}
+	}
+
+	scheduler.SubmitTask(&types.Product{ID: "WS_Ignored", Type: "PCB_PROTOTYPE", Attrs: map[string]interface{}{"layers": 2}})
+	scheduler.SubmitTask(&types.Product{ID: "WS_Watched", Type: "PCB_PROTOTYPE", Attrs: map[string]interface{}{"layers": 2}})
+	for {
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("未收到订阅工件的补丁: %v", err)
+		}
+		if msg.Type == web.MessageAlert && msg.Alert.ProductID == "WS_Watched" {
+			continue // 电测随机失败时会收到该工件的告警
+		}
+		if msg.Product == nil || msg.Product.ID != "WS_Watched" {
+			t.Fatalf("收到了未订阅的消息: %+v", msg)
+		}
+		if msg.Product.Status == "COMPLETED" || msg.Product.Status == "COMPENSATED" {
+			return
+		}
+	}
+}
+
+func TestWebSocket_ShortLivedTokens(t *testing.T) {
+	app := newTestApp(t, false)
+	cfg := config.AuthConfig{Enabled: true, APIKeys: []config.APIKeyConfig{{Name: "dashboard", Key: "test-key", Roles: []string{"viewer"}}}}
+	issuer, err := auth.NewWSTokenIssuer(cfg.WSToken)
+	if err != nil {
+		t.Fatalf("创建令牌签发器失败: %v", err)
+	}
+	apiServer := api.NewServer(app.scheduler, app.hub, app.stateTracker, app.history, "", auth.New(cfg), nil, app.metrics, app.logger)
+	apiServer.SetWSTokens(issuer)
+	server := httptest.NewServer(apiServer.Handler())
+	t.Cleanup(server.Close)
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+
+	fetchToken := func(path, key string) (int, api.WSToken) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("获取令牌失败: %v", err)
+		}
+		defer resp.Body.Close()
+		var token api.WSToken
+		json.NewDecoder(resp.Body).Decode(&token)
+		return resp.StatusCode, token
+	}
+	if code, _ := fetchToken("/api/v1/ws-token", ""); code != http.StatusUnauthorized {
+		t.Errorf("未认证时获取令牌应返回 401, 得到 %d", code)
+	}
+	code, token := fetchToken("/api/ws-token", "test-key")
+	if code != http.StatusOK || token.Token == "" || time.Until(token.ExpiresAt) > time.Minute {
+		t.Fatalf("获取短期令牌失败: %d %+v", code, token)
+	}
+
+	// 未携带令牌、使用长期 API Key 或其他实例签发的令牌都在升级前被拒绝
+	other, _ := auth.NewWSTokenIssuer(config.WSTokenConfig{})
+	foreign, _, _ := other.Issue(&auth.Principal{Subject: "dashboard", Roles: []auth.Role{auth.RoleViewer}})
+	for name, query := range map[string]string{"缺少令牌": "", "API Key": "?api_key=test-key", "其他实例的令牌": "?token=" + foreign} {
+		_, resp, err := websocket.DefaultDialer.Dial(wsURL+query, nil)
+		if err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s: WebSocket 握手应返回 401, 得到 %v", name, err)
+		}
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL+"?token="+url.QueryEscape(token.Token), nil)
+	if err != nil {
+		t.Fatalf("使用令牌连接 WebSocket 失败: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg web.Message
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != web.MessageSnapshot {
+		t.Fatalf("首条消息应为快照: %v", err)
+	}
+}
+
+func TestNamespaces_KeysPartitionSubmissionsStateAndStreams(t *testing.T) {
+	app := newTestApp(t, false)
+	cfg := config.AuthConfig{Enabled: true, APIKeys: []config.APIKeyConfig{
+		{Name: "line-a", Key: "key-a", Roles: []string{"operator"}, Namespaces: []string{"line-a"}},
+		{Name: "ops", Key: "key-ops", Roles: []string{"admin"}},
+	}}
+	issuer, _ := auth.NewWSTokenIssuer(cfg.WSToken)
+	apiServer := api.NewServer(app.scheduler, app.hub, app.stateTracker, app.history, "", auth.New(cfg), nil, app.metrics, app.logger)
+	apiServer.SetWSTokens(issuer)
+	server := httptest.NewServer(apiServer.Handler())
+	t.Cleanup(server.Close)
+
+	call := func(method, path, key string, body interface{}, out interface{}) int {
+		t.Helper()
+		data, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, server.URL+path, bytes.NewReader(data))
+		req.Header.Set("X-API-Key", key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("请求 %s 失败: %v", path, err)
+		}
+		defer resp.Body.Close()
+		if out != nil {
+			json.NewDecoder(resp.Body).Decode(out)
+		}
+		return resp.StatusCode
+	}
+
+	// 绑定了命名空间的 Key 提交的任务默认归入它的命名空间，不能提交到其他命名空间
+	var accepted map[string]string
+	if code := call(http.MethodPost, "/api/v1/tasks", "key-a", map[string]interface{}{"id": "NS_A_1", "type": "PCB_PROTOTYPE"}, &accepted); code != http.StatusAccepted || accepted["namespace"] != "line-a" {
+		t.Fatalf("提交到绑定的命名空间失败: %d %v", code, accepted)
+	}
+	if code := call(http.MethodPost, "/api/v1/tasks", "key-a", map[string]interface{}{"id": "NS_B_X", "type": "PCB_PROTOTYPE", "namespace": "line-b"}, nil); code != http.StatusForbidden {
+		t.Errorf("提交到未绑定的命名空间应返回 403, 得到 %d", code)
+	}
+	if code := call(http.MethodPost, "/api/v1/tasks", "key-ops", map[string]interface{}{"id": "NS_BAD", "type": "PCB_PROTOTYPE", "namespace": "Line B"}, nil); code != http.StatusBadRequest {
+		t.Errorf("不合法的命名空间应返回 400, 得到 %d", code)
+	}
+	if code := call(http.MethodPost, "/api/v1/tasks", "key-ops", map[string]interface{}{"id": "NS_B_1", "type": "PCB_PROTOTYPE", "namespace": "line-b"}, nil); code != http.StatusAccepted {
+		t.Fatalf("不受限制的 Key 提交到 line-b 失败: %d", code)
+	}
+
+	// 状态快照和任务详情只包含调用方可以访问的命名空间
+	var state web.GlobalState
+	call(http.MethodGet, "/api/v1/state", "key-a", nil, &state)
+	if _, ok := state.Products["NS_A_1"]; !ok || len(state.Products) != 1 || state.Products["NS_A_1"].Namespace != "line-a" {
+		t.Errorf("line-a 的状态快照应只包含 NS_A_1, 得到 %v", state.Products)
+	}
+	state = web.GlobalState{}
+	call(http.MethodGet, "/api/v1/state?namespaces=line-b", "key-ops", nil, &state)
+	if _, ok := state.Products["NS_B_1"]; !ok || len(state.Products) != 1 {
+		t.Errorf("按命名空间过滤的状态快照应只包含 NS_B_1, 得到 %v", state.Products)
+	}
+	if code := call(http.MethodGet, "/api/v1/tasks/NS_B_1", "key-a", nil, nil); code != http.StatusNotFound {
+		t.Errorf("其他命名空间的任务应返回 404, 得到 %d", code)
+	}
+	if code := call(http.MethodDelete, "/api/v1/tasks/NS_B_1", "key-a", nil, nil); code != http.StatusNotFound {
+		t.Errorf("取消其他命名空间的任务应返回 404, 得到 %d", code)
+	}
+
+	// WebSocket 令牌携带命名空间，推送的快照被限制在其中
+	var token api.WSToken
+	call(http.MethodGet, "/api/v1/ws-token", "key-a", nil, &token)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws?token="+url.QueryEscape(token.Token), nil)
+	if err != nil {
+		t.Fatalf("连接 WebSocket 失败: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg web.Message
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != web.MessageSnapshot {
+		t.Fatalf("首条消息应为快照: %v", err)
+	}
+	for id, p := range msg.State.Products {
+		if p.Namespace != "line-a" {
+			t.Errorf("line-a 的推送中出现了其他命名空间的工件 %s (%s)", id, p.Namespace)
+		}
+	}
+	// 订阅其他命名空间时仍被限制在令牌的命名空间内
+	msg = web.Message{}
+	conn.WriteJSON(web.ClientMessage{Type: web.ClientMessageSubscribe, Filter: web.Filter{Namespaces: []string{"line-b"}}})
+	for msg.Type != web.MessageSnapshot || msg.State == nil {
+		msg = web.Message{}
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("订阅后应收到快照: %v", err)
+		}
+		if msg.Product != nil && msg.Product.Namespace != "line-a" {
+			t.Errorf("line-a 的推送中出现了其他命名空间的补丁 %s", msg.Product.ID)
+		}
+	}
+	if _, ok := msg.State.Products["NS_B_1"]; ok {
+		t.Error("订阅未绑定的命名空间不应看到其中的工件")
+	}
+
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("请求 /metrics 失败: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), `scheduler_tasks_in_queue{namespace="line-a"}`) {
+		t.Error("队列指标缺少 namespace 标签")
+	}
+}
+
+func TestAlerts_PushedOverWebSocketAndAcked(t *testing.T) {
+	app := newTestApp(t, true)
+	app.stateTracker.SetQueueAlertThreshold(1)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(app.server.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("连接 WebSocket 失败: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	var msg web.Message
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != web.MessageSnapshot || msg.State.Alerts == nil {
+		t.Fatalf("首条消息应为带告警列表的快照: %v", err)
+	}
+	waitAlert := func(match func(a web.Alert) bool) web.Alert {
+		t.Helper()
+		for {
+			var msg web.Message
+			if err := conn.ReadJSON(&msg); err != nil {
+				t.Fatalf("未收到预期的告警: %v", err)
+			}
+			if msg.Type == web.MessageAlert && match(*msg.Alert) {
+				return *msg.Alert
+			}
+		}
+	}
+
+	// 暂停期间队列超过阈值，只产生一条积压告警
+	app.scheduler.Pause()
+	for _, id := range []string{"Alert_Queue_1", "Alert_Queue_2", "Alert_Queue_3"} {
+		app.scheduler.SubmitTask(&types.Product{ID: id, Type: "PCB_PROTOTYPE"})
+	}
+	backlog := waitAlert(func(a web.Alert) bool { return a.Kind == web.AlertQueueBacklog })
+	if backlog.Severity != web.SeverityWarning || backlog.ID == "" {
+		t.Errorf("积压告警应为 warning 并带有 ID, 得到 %+v", backlog)
+	}
+	for _, id := range []string{"Alert_Queue_1", "Alert_Queue_2", "Alert_Queue_3"} {
+		app.scheduler.Cancel(id)
+	}
+	app.scheduler.Resume()
+
+	// 远程 AOI 工站失败，工件失败产生告警
+	app.scheduler.SubmitTask(&types.Product{ID: "Alert_Failed", Type: "PCB_DOUBLE_LAYER", Namespace: "line-a"})
+	failed := waitAlert(func(a web.Alert) bool { return a.Kind == web.AlertProductFailed })
+	if failed.ProductID != "Alert_Failed" || failed.Namespace != "line-a" || failed.Acked() {
+		t.Errorf("工件失败告警不符合预期: %+v", failed)
+	}
+
+	resp, err := http.Post(app.server.URL+"/api/alerts/"+failed.ID+"/ack", "application/json", nil)
+	if err != nil {
+		t.Fatalf("确认告警失败: %v", err)
+	}
+	var acked web.Alert
+	json.NewDecoder(resp.Body).Decode(&acked)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !acked.Acked() {
+		t.Fatalf("预期确认返回 200 和已确认的告警, 得到 %d %+v", resp.StatusCode, acked)
+	}
+	if pushed := waitAlert(func(a web.Alert) bool { return a.ID == failed.ID }); !pushed.Acked() {
+		t.Errorf("确认结果应推送给看板, 得到 %+v", pushed)
+	}
+
+	resp, err = http.Get(app.server.URL + "/api/v1/alerts?unacked=true")
+	if err != nil {
+		t.Fatalf("查询告警失败: %v", err)
+	}
+	var unacked []web.Alert
+	json.NewDecoder(resp.Body).Decode(&unacked)
+	resp.Body.Close()
+	for _, a := range unacked {
+		if a.ID == failed.ID {
+			t.Errorf("已确认的告警不应出现在 unacked 列表中")
+		}
+	}
+
+	resp, err = http.Post(app.server.URL+"/api/v1/alerts/ALERT_404/ack", "application/json", nil)
+	if err != nil {
+		t.Fatalf("确认告警失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("确认不存在的告警应返回 404, 得到 %d", resp.StatusCode)
+	}
+
+	// 指派、解决后告警进入 RESOLVED，解决后不能再指派或确认
+	post := func(path, body string) (int, web.Alert) {
+		t.Helper()
+		resp, err := http.Post(app.server.URL+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("请求 %s 失败: %v", path, err)
+		}
+		defer resp.Body.Close()
+		var a web.Alert
+		json.NewDecoder(resp.Body).Decode(&a)
+		return resp.StatusCode, a
+	}
+	if code, a := post("/api/v1/alerts/"+failed.ID+"/assign", `{"assignee":"张工"}`); code != http.StatusOK || a.Assignee != "张工" || a.State != fsm.AlertAcknowledged {
+		t.Errorf("预期指派成功, 得到 %d %+v", code, a)
+	}
+	if code, _ := post("/api/v1/alerts/"+failed.ID+"/assign", `{}`); code != http.StatusBadRequest {
+		t.Errorf("未启用认证时指派需要指定负责人, 得到 %d", code)
+	}
+	code, resolved := post("/api/v1/alerts/"+failed.ID+"/resolve", `{"resolution":"重新校准 AOI 光源"}`)
+	if code != http.StatusOK || !resolved.Resolved() || resolved.ResolvedAt.IsZero() || resolved.Resolution != "重新校准 AOI 光源" {
+		t.Errorf("预期解决成功, 得到 %d %+v", code, resolved)
+	}
+	if pushed := waitAlert(func(a web.Alert) bool { return a.ID == failed.ID && a.Resolved() }); pushed.Revision <= acked.Revision {
+		t.Errorf("每次变更应递增告警的版本, 确认时为 %d, 解决时为 %d", acked.Revision, pushed.Revision)
+	}
+	if code, again := post("/api/v1/alerts/"+failed.ID+"/resolve", ""); code != http.StatusOK || !again.ResolvedAt.Equal(resolved.ResolvedAt) {
+		t.Errorf("重复解决应返回第一次解决的结果, 得到 %d %+v", code, again)
+	}
+	if code, _ := post("/api/v1/alerts/"+failed.ID+"/assign", `{"assignee":"李工"}`); code != http.StatusConflict {
+		t.Errorf("指派已解决的告警应返回 409, 得到 %d", code)
+	}
+	if code, _ := post("/api/v1/alerts/"+backlog.ID+"/resolve", ""); code != http.StatusOK {
+		t.Errorf("未确认的告警可以直接解决, 得到 %d", code)
+	}
+	if code, _ := post("/api/v1/alerts/"+backlog.ID+"/ack", ""); code != http.StatusConflict {
+		t.Errorf("确认未经确认就已解决的告警应返回 409, 得到 %d", code)
+	}
+
+	resp, err = http.Get(app.server.URL + "/api/v1/alerts?state=resolved")
+	if err != nil {
+		t.Fatalf("查询告警失败: %v", err)
+	}
+	var list []web.Alert
+	json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if len(list) != 2 || !list[0].Resolved() || !list[1].Resolved() {
+		t.Errorf("预期 2 条已解决的告警, 得到 %+v", list)
+	}
+	if got := scrapeMetrics(t, app.server.URL); !strings.Contains(got, `alerts_unresolved{severity="warning"}`) {
+		t.Errorf("预期导出 alerts_unresolved 指标")
+	}
+}
+
+func TestAlerts_StationFilterReceivesStationDown(t *testing.T) {
+	app := newTestApp(t, false)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(app.server.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("连接 WebSocket 失败: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg web.Message
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != web.MessageSnapshot {
+		t.Fatalf("首条消息应为快照: %v", err)
+	}
+	conn.WriteJSON(web.ClientMessage{Type: web.ClientMessageSubscribe, Filter: web.Filter{Stations: []types.StationID{types.StationAOI}}})
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != web.MessageSnapshot {
+		t.Fatalf("订阅后应收到过滤后的快照: %v", err)
+	}
+
+	// 订阅了工站的看板接收该工站的停机告警，不接收其他工站的
+	app.stateTracker.RaiseAlert(web.Alert{Kind: web.AlertStationDown, Severity: web.SeverityCritical, StationID: types.StationDrill, RaisedAt: time.Now()})
+	app.stateTracker.RaiseAlert(web.Alert{Kind: web.AlertStationDown, Severity: web.SeverityCritical, StationID: types.StationAOI, RaisedAt: time.Now()})
+	for {
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("未收到订阅工站的停机告警: %v", err)
+		}
+		if msg.Type != web.MessageAlert {
+			continue
+		}
+		if msg.Alert.StationID != types.StationAOI || msg.Alert.Kind != web.AlertStationDown {
+			t.Fatalf("收到了未订阅工站的告警: %+v", msg.Alert)
+		}
+		break
+	}
+
+	// 重新订阅时的快照同样包含该工站的告警
+	conn.WriteJSON(web.ClientMessage{Type: web.ClientMessageSubscribe, Filter: web.Filter{Stations: []types.StationID{types.StationAOI}}})
+	for {
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("未收到订阅后的快照: %v", err)
+		}
+		if msg.Type == web.MessageSnapshot {
+			break
+		}
+	}
+	if len(msg.State.Alerts) != 1 || msg.State.Alerts[0].StationID != types.StationAOI {
+		t.Errorf("过滤后的快照应只包含 STATION_AOI 的告警, 得到 %+v", msg.State.Alerts)
+	}
+}
+
+func TestSSE_StreamsSnapshotAndFilteredPatches(t *testing.T) {
+	scheduler, _, server := setupTestApp(t, false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/state/stream?ids=SSE_Watched", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("连接 SSE 失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("预期 Content-Type 为 text/event-stream, 得到 %q", ct)
+	}
+
+	scheduler.SubmitTask(&types.Product{ID: "SSE_Ignored", Type: "PCB_PROTOTYPE", Attrs: map[string]interface{}{"layers": 2}})
+	scheduler.SubmitTask(&types.Product{ID: "SSE_Watched", Type: "PCB_PROTOTYPE", Attrs: map[string]interface{}{"layers": 2}})
+
+	scanner := bufio.NewScanner(resp.Body)
+	first := true
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var msg web.Message
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			t.Fatalf("无法解析 SSE 消息: %v", err)
+		}
+		if first {
+			if msg.Type != web.MessageSnapshot {
+				t.Fatalf("首条消息应为快照, 得到 %s", msg.Type)
+			}
+			first = false
+			continue
+		}
+		if msg.Type == web.MessageAlert && msg.Alert.ProductID == "SSE_Watched" {
+			continue // 电测随机失败时会收到该工件的告警
+		}
+		if msg.Product == nil || msg.Product.ID != "SSE_Watched" {
+			t.Fatalf("收到了未订阅的消息: %+v", msg)
+		}
+		if msg.Product.Status == "COMPLETED" || msg.Product.Status == "COMPENSATED" {
+			return
+		}
+	}
+	t.Fatalf("SSE 流提前结束: %v", scanner.Err())
+}
+
+func TestStateTracker_EvictsFinishedProducts(t *testing.T) {
+	hub := web.NewHub(metrics.New(metrics.NewRegistry()))
+	go hub.Run()
+	t.Cleanup(hub.Close)
+	st := web.NewStateTracker(hub)
+
+	st.AddProduct(&types.Product{ID: "Done", Type: "PCB_PROTOTYPE"})
+	st.AddProduct(&types.Product{ID: "Running", Type: "PCB_PROTOTYPE"})
+	st.UpdateProductState("Done", types.StationPack, "COMPLETED")
+	st.UpdateProductState("Running", types.StationDrill, "PROCESSING")
+
+	if evicted := st.EvictFinished(time.Now().Add(-time.Minute)); len(evicted) != 0 {
+		t.Fatalf("未过期的工件不应被移除, 移除了 %d 个", len(evicted))
+	}
+	evicted := st.EvictFinished(time.Now().Add(time.Second))
+	if len(evicted) != 1 || evicted[0].ID != "Done" {
+		t.Fatalf("预期只移除已完成的工件, 得到 %+v", evicted)
+	}
+	snapshot := st.GetStateSnapshot()
+	if _, ok := snapshot.Products["Done"]; ok {
+		t.Error("已移除的工件仍出现在快照中")
+	}
+	if _, ok := snapshot.Products["Running"]; !ok {
+		t.Error("执行中的工件不应被移除")
+	}
+}
+
+func TestStateSnapshot_IncludesStationView(t *testing.T) {
+	scheduler, stateTracker, _ := setupTestApp(t, false)
+	scheduler.SubmitTask(&types.Product{ID: "Station_View_01", Type: "PCB_PROTOTYPE", Attrs: map[string]interface{}{"layers": 2}})
+
+	for i := 0; i < 20; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if s, ok := stateTracker.GetProduct("Station_View_01"); ok && (s.Status == "COMPLETED" || s.Status == "COMPENSATED") {
+			break
+		}
+	}
+	time.Sleep(50 * time.Millisecond) // 等待异步的步骤事件处理完毕
+
+	cam, ok := stateTracker.GetStateSnapshot().Stations[types.StationCAM]
+	if !ok {
+		t.Fatal("快照中缺少 CAM 工站")
+	}
+	if cam.Status != "IDLE" || len(cam.Products) != 0 || cam.QueueLength != 0 {
+		t.Errorf("工件完成后 CAM 工站应空闲, 得到 %+v", cam)
+	}
+	if cam.Utilization <= 0 {
+		t.Errorf("CAM 工站加工过工件, 利用率应大于 0, 得到 %.2f", cam.Utilization)
+	}
+	if cam.Health != web.HealthHealthy {
+		t.Errorf("预期 CAM 工站健康, 得到 %s", cam.Health)
+	}
+}
+
+func TestStateSnapshot_IncludesOrderedSchedulerQueue(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	hub := web.NewHub(metrics.New(metrics.NewRegistry()))
+	go hub.Run()
+	t.Cleanup(hub.Close)
+	stateTracker := web.NewStateTracker(hub)
+	wf := engine.NewWorkflowEngine(nil, nil, nil, logger, event.NewBus(), 1)
+	scheduler := engine.NewScheduler(wf, 2, nil, stateTracker, metrics.New(metrics.NewRegistry()), logger)
+
+	// 调度器未启动，任务全部停留在队列中
+	scheduler.SubmitTask(&types.Product{ID: "Low_1", Type: "PCB_DOUBLE_LAYER", Priority: 0})
+	scheduler.SubmitTask(&types.Product{ID: "High", Type: "PCB_DOUBLE_LAYER", Priority: 2})
+	scheduler.SubmitTask(&types.Product{ID: "Low_2", Type: "PCB_DOUBLE_LAYER", Priority: 0})
+
+	state := stateTracker.GetStateSnapshot().Scheduler
+	if state == nil {
+		t.Fatal("快照中缺少调度器状态")
+	}
+	var order []string
+	for _, entry := range state.Queue {
+		order = append(order, entry.ProductID)
+	}
+	if strings.Join(order, ",") != "High,Low_1,Low_2" {
+		t.Errorf("队列应按优先级排序、同优先级先入先出, 得到 %v", order)
+	}
+	if state.Workers != 2 || state.BusyWorkers != 0 || len(state.InFlight) != 2 {
+		t.Errorf("预期 2 个空闲 worker, 得到 %+v", state)
+	}
+}
+
+// gatedStation 是在 gate 关闭之前一直阻塞加工的测试工站
+type gatedStation struct {
+	id   types.StationID
+	gate chan struct{}
+}
+
+func (s *gatedStation) GetID() types.StationID { return s.id }
+
+func (s *gatedStation) Execute(ctx context.Context, p *types.Product) types.Result {
+	<-s.gate
+	return types.Result{ProductID: p.ID, Success: true}
+}
+
+func (s *gatedStation) Compensate(ctx context.Context, p *types.Product) error { return nil }
+
+func TestStateSnapshot_IncludesPoolOccupancy(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	m := metrics.New(metrics.NewRegistry())
+	hub := web.NewHub(m)
+	go hub.Run()
+	t.Cleanup(hub.Close)
+	stateTracker := web.NewStateTracker(hub)
+	bus := event.NewBus()
+	handlers.RegisterEventHandlers(bus, stateTracker, history.NewStore(), m, logger)
+
+	workflows := map[string][]types.WorkflowStep{"PCB_GATED": {{StationIDs: []types.StationID{types.StationETest}}}}
+	wf := engine.NewWorkflowEngine(workflows, map[types.StationID]int{types.StationETest: 1}, nil, logger, bus, 1)
+	gate := make(chan struct{})
+	wf.RegisterStation(&gatedStation{id: types.StationETest, gate: gate})
+	scheduler := engine.NewScheduler(wf, 3, nil, stateTracker, m, logger)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go scheduler.Start(ctx)
+
+	waitPool := func(want web.PoolStatus) {
+		t.Helper()
+		var got web.PoolStatus
+		for i := 0; i < 100; i++ {
+			if got = stateTracker.GetStateSnapshot().Pools[types.StationETest]; got == want {
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		t.Fatalf("预期资源池状态 %+v, 得到 %+v", want, got)
+	}
+
+	// 注册工站时即上报空闲的资源池
+	waitPool(web.PoolStatus{ID: types.StationETest, Capacity: 1})
+
+	for i := 1; i <= 3; i++ {
+		scheduler.SubmitTask(&types.Product{ID: "Pool_" + strconv.Itoa(i), Type: "PCB_GATED"})
+	}
+	// 一个工件占用唯一的资源凭证，其余两个排队等待
+	waitPool(web.PoolStatus{ID: types.StationETest, Capacity: 1, InUse: 1, Waiting: 2})
+
+	close(gate)
+	waitPool(web.PoolStatus{ID: types.StationETest, Capacity: 1})
+}
+
+func TestResizePool_CountsInFlightAndCancelsWaiters(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	workflows := map[string][]types.WorkflowStep{"PCB_GATED": {{StationIDs: []types.StationID{types.StationETest}}}}
+	wf := engine.NewWorkflowEngine(workflows, nil, nil, logger, event.NewBus(), 1)
+	gate := make(chan struct{})
+	wf.RegisterStation(&gatedStation{id: types.StationETest, gate: gate})
+	waitStation := func(desc string, ok func(engine.StationInfo) bool) {
+		t.Helper()
+		var info engine.StationInfo
+		for i := 0; i < 100; i++ {
+			if info, _ = wf.Stations().Get(types.StationETest); ok(info) {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("%s, 得到 %+v", desc, info)
+	}
+	process := func(ctx context.Context, id string) (*types.Product, chan struct{}) {
+		p := &types.Product{ID: id, Type: "PCB_GATED"}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			wf.Process(ctx, p)
+		}()
+		return p, done
+	}
+
+	// 未启用资源池时两个工件同时加工，启用容量为 1 的资源池后它们计入已占用的凭证
+	first, firstDone := process(context.Background(), "POOL_A")
+	second, secondDone := process(context.Background(), "POOL_B")
+	waitStation("预期两个工件同时加工", func(info engine.StationInfo) bool { return info.Active == 2 })
+	info, err := wf.Stations().ResizePool(types.StationETest, 1)
+	if err != nil || info.PoolSize != 1 || info.PoolUsed != 2 {
+		t.Fatalf("启用资源池时应计入加工中的工件: %+v %v", info, err)
+	}
+
+	// 超出容量期间新工件等待凭证；等待可以随 Context 取消
+	ctx, cancel := context.WithCancelCause(context.Background())
+	_, cancelledDone := process(ctx, "POOL_C")
+	waitStation("预期新工件等待资源凭证", func(info engine.StationInfo) bool { return info.PoolWait == 1 })
+	cancel(engine.ErrTaskCancelled)
+	select {
+	case <-cancelledDone:
+	case <-time.After(2 * time.Second):
+		t.Fatal("取消后工件应停止等待资源凭证")
+	}
+	waitStation("预期取消后不再等待", func(info engine.StationInfo) bool { return info.PoolWait == 0 && info.Active == 2 })
+
+	// 加工中的工件结束后释放计入的凭证，等待的工件依次获得凭证
+	last, lastDone := process(context.Background(), "POOL_D")
+	waitStation("预期新工件等待资源凭证", func(info engine.StationInfo) bool { return info.PoolWait == 1 })
+	close(gate)
+	for _, done := range []chan struct{}{firstDone, secondDone, lastDone} {
+		<-done
+	}
+	waitStation("预期全部凭证已释放", func(info engine.StationInfo) bool { return info.PoolUsed == 0 && info.PoolWait == 0 && info.Active == 0 })
+	for _, p := range []*types.Product{first, second, last} {
+		if p.Status != "COMPLETED" {
+			t.Errorf("%s 应完成, 实际为 %s", p.ID, p.Status)
+		}
+	}
+}
+
+func TestNamespaceIsolation_QuotasWALAndPartitions(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	m := metrics.New(metrics.NewRegistry())
+	hub := web.NewHub(m)
+	go hub.Run()
+	t.Cleanup(hub.Close)
+	stateTracker := web.NewStateTracker(hub)
+	bus := event.NewBus()
+	handlers.RegisterEventHandlers(bus, stateTracker, history.NewStore(), m, logger)
+
+	workflows := map[string][]types.WorkflowStep{"PCB_GATED": {{StationIDs: []types.StationID{types.StationETest}}}}
+	wf := engine.NewWorkflowEngine(workflows, nil, nil, logger, bus, 1)
+	gate := make(chan struct{})
+	wf.RegisterStation(&gatedStation{id: types.StationETest, gate: gate})
+
+	// 每条产线的任务写入各自的 WAL 文件，默认命名空间使用配置的路径
+	walPath := filepath.Join(t.TempDir(), "tasks.wal")
+	submitted, err := persistence.NewNamespacedWAL(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []*types.Product{
+		{ID: "NS_A1", Type: "PCB_GATED", Priority: 5, Namespace: "line-a"},
+		{ID: "NS_A2", Type: "PCB_GATED", Priority: 5, Namespace: "line-a"},
+		{ID: "NS_B1", Type: "PCB_GATED", Namespace: "line-b"},
+		{ID: "NS_D1", Type: "PCB_GATED"},
+	} {
+		if err := submitted.Append(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	submitted.Close()
+	for _, ns := range []string{"line-a", "line-b"} {
+		if _, err := os.Stat(submitted.NamespacePath(ns)); err != nil {
+			t.Errorf("预期命名空间 %s 的 WAL 文件存在: %v", ns, err)
+		}
+	}
+	if path := submitted.NamespacePath("line-a"); filepath.Base(path) != "tasks.line-a.wal" {
+		t.Errorf("命名空间的 WAL 文件名不正确: %s", path)
+	}
+
+	wal, err := persistence.NewNamespacedWAL(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { wal.Close() })
+	scheduler := engine.NewScheduler(wf, 3, wal, stateTracker, m, logger)
+	if err := scheduler.SetNamespaceQuotas(map[string]int{"line-a": 0}); !errors.Is(err, engine.ErrInvalidQuota) {
+		t.Errorf("预期配额为 0 时返回 ErrInvalidQuota, 得到 %v", err)
+	}
+	if err := scheduler.SetNamespaceQuotas(map[string]int{"line-a": 1}); err != nil {
+		t.Fatal(err)
+	}
+	// 恢复时读取所有命名空间的日志
+	if err := scheduler.RecoverTasks(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(scheduler.State().Queue); n != 4 {
+		t.Fatalf("预期从各命名空间的 WAL 恢复 4 个任务, 得到 %d", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go scheduler.Start(ctx)
+
+	// line-a 的配额为 1：第二个 line-a 任务优先级更高，但留在队列中，空闲的 worker 先派发其他命名空间的任务
+	var state web.SchedulerState
+	for i := 0; i < 100; i++ {
+		if state = scheduler.State(); state.BusyWorkers == 3 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if state.BusyWorkers != 3 || len(state.Queue) != 1 || state.Queue[0].ProductID != "NS_A2" {
+		t.Fatalf("预期 line-a 的第二个任务因配额留在队列中, 得到 %+v", state)
+	}
+	if len(state.Quotas) != 1 || state.Quotas[0] != (web.NamespaceQuota{Namespace: "line-a", Workers: 1, Active: 1}) {
+		t.Errorf("调度器状态中的配额占用不正确: %+v", state.Quotas)
+	}
+	if got := testutil.ToFloat64(m.NamespaceActiveTasks.WithLabelValues("line-a")); got != 1 {
+		t.Errorf("预期 line-a 有 1 个已出队的任务, 得到 %v", got)
+	}
+	if scoped := state.Scoped([]string{"line-b"}); len(scoped.Quotas) != 0 {
+		t.Errorf("限定命名空间的调度器状态不应包含其他命名空间的配额: %+v", scoped.Quotas)
+	}
+
+	// 绑定命名空间的快照只包含这些命名空间的工件
+	snapshot := stateTracker.GetNamespaceSnapshot([]string{"line-b"})
+	if _, ok := snapshot.Products["NS_B1"]; !ok || len(snapshot.Products) != 1 {
+		t.Errorf("line-b 的快照应只包含 NS_B1, 得到 %v", snapshot.Products)
+	}
+	if counts := stateTracker.NamespaceCounts(); counts["line-a"] != 2 || counts["line-b"] != 1 || counts["default"] != 1 {
+		t.Errorf("各命名空间的工件数不正确: %v", counts)
+	}
+
+	close(gate)
+	for i := 0; i < 100; i++ {
+		if state = scheduler.State(); state.BusyWorkers == 0 && len(state.Queue) == 0 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if state.BusyWorkers != 0 || len(state.Queue) != 0 {
+		t.Fatalf("预期所有任务执行完毕, 得到 %+v", state)
+	}
+	// 完成标记写入任务所属命名空间的日志，压缩后不再保留任何任务
+	var result persistence.CompactResult
+	for i := 0; i < 50; i++ {
+		if result, err = scheduler.CompactWAL(); err != nil || result.Pending == 0 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil || result.Pending != 0 || result.BytesAfter != 0 {
+		t.Errorf("预期压缩后各命名空间的 WAL 为空, 得到 %+v, %v", result, err)
+	}
+}
+
+// countingStation 是记录每个工件加工和补偿次数的测试工站，fail 中的工件加工失败
+type countingStation struct {
+	id          types.StationID
+	fail        map[string]bool
+	mu          sync.Mutex
+	executed    map[string]int
+	compensated map[string]int
+	products    map[string]*types.Product
+}
+
+func newCountingStation(id types.StationID, fail ...string) *countingStation {
+	s := &countingStation{id: id, fail: map[string]bool{}, executed: map[string]int{}, compensated: map[string]int{}, products: map[string]*types.Product{}}
+	for _, productID := range fail {
+		s.fail[productID] = true
+	}
+	return s
+}
+
+func (s *countingStation) GetID() types.StationID { return s.id }
+
+func (s *countingStation) Execute(ctx context.Context, p *types.Product) types.Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.executed[p.ID]++
+	s.products[p.ID] = p
+	if s.fail[p.ID] {
+		return types.Result{ProductID: p.ID, Success: false, Error: errors.New("injected failure")}
+	}
+	p.History = append(p.History, string(s.id))
+	return types.Result{ProductID: p.ID, Success: true}
+}
+
+func (s *countingStation) Compensate(ctx context.Context, p *types.Product) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.compensated[p.ID]++
+	return nil
+}
+
+func (s *countingStation) counts(productID string) (executed, compensated int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.executed[productID], s.compensated[productID]
+}
+
+func TestWALCheckpoint_ResumeFromLastCompletedStep(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	m := metrics.New(metrics.NewRegistry())
+	hub := web.NewHub(m)
+	go hub.Run()
+	t.Cleanup(hub.Close)
+	stateTracker := web.NewStateTracker(hub)
+	workflows := map[string][]types.WorkflowStep{"PCB_CKPT": {
+		{StationIDs: []types.StationID{types.StationDrill}},
+		{StationIDs: []types.StationID{types.StationETest}},
+		{StationIDs: []types.StationID{types.StationAOI}},
+	}}
+	dir := t.TempDir()
+
+	// run 用新的引擎和调度器恢复 WAL 中的任务并执行到结束，模拟进程重启
+	run := func(walPath string, stations ...*countingStation) {
+		t.Helper()
+		wf := engine.NewWorkflowEngine(workflows, nil, nil, logger, event.NewBus(), 1)
+		for _, s := range stations {
+			wf.RegisterStation(s)
+		}
+		wal, err := persistence.NewWAL(walPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer wal.Close()
+		scheduler := engine.NewScheduler(wf, 3, wal, stateTracker, m, logger)
+		if err := scheduler.RecoverTasks(); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go scheduler.Start(ctx)
+		for i := 0; i < 100; i++ {
+			if result, err := scheduler.CompactWAL(); err == nil && result.Pending == 0 {
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		t.Fatalf("预期 WAL 中的任务全部执行完毕, 得到 %+v", scheduler.State())
+	}
+
+	// 每完成一个步骤写入一条检查点记录，包含步骤索引和已执行的工站
+	livePath := filepath.Join(dir, "live.wal")
+	var entries []persistence.LogEntry
+	wf := engine.NewWorkflowEngine(workflows, nil, nil, logger, event.NewBus(), 1)
+	drill, etest, aoi := newCountingStation(types.StationDrill), newCountingStation(types.StationETest), newCountingStation(types.StationAOI)
+	for _, s := range []*countingStation{drill, etest, aoi} {
+		wf.RegisterStation(s)
+	}
+	wal, err := persistence.NewWAL(livePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduler := engine.NewScheduler(wf, 1, wal, stateTracker, m, logger)
+	ctx, cancel := context.WithCancel(context.Background())
+	go scheduler.Start(ctx)
+	scheduler.SubmitTask(&types.Product{ID: "CK1", Type: "PCB_CKPT"})
+	for i := 0; i < 100 && (len(entries) == 0 || entries[len(entries)-1].Type != "COMPLETE"); i++ {
+		time.Sleep(20 * time.Millisecond)
+		data, _ := os.ReadFile(livePath)
+		entries = entries[:0]
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			var entry persistence.LogEntry
+			if json.Unmarshal([]byte(line), &entry) == nil {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	cancel()
+	wal.Close()
+	var steps []types.Checkpoint
+	for _, entry := range entries {
+		if entry.Type == "STEP" && entry.TaskID == "CK1" {
+			steps = append(steps, *entry.Checkpoint)
+		}
+	}
+	if len(steps) != 3 {
+		t.Fatalf("预期 3 条检查点记录, 得到 %+v", entries)
+	}
+	last := steps[2]
+	if last.Step != 2 || last.Workflow != "pcb_ckpt" || last.Version != 1 ||
+		!slices.Equal(last.Stations, []types.StationID{types.StationDrill, types.StationETest, types.StationAOI}) ||
+		!slices.Equal(last.History, []string{string(types.StationDrill), string(types.StationETest), string(types.StationAOI)}) {
+		t.Errorf("最后一条检查点不正确: %+v", last)
+	}
+
+	// 崩溃前 CK2 和 CK3 完成了钻孔，CK4 的检查点指向不存在的工作流版本；压缩后检查点并入任务记录
+	crashPath := filepath.Join(dir, "crash.wal")
+	crashed, err := persistence.NewWAL(crashPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drilled := types.Checkpoint{Workflow: "pcb_ckpt", Version: 1, Stations: []types.StationID{types.StationDrill}, History: []string{string(types.StationDrill)}}
+	for _, id := range []string{"CK2", "CK3", "CK4"} {
+		if err := crashed.Append(&types.Product{ID: id, Type: "PCB_CKPT"}); err != nil {
+			t.Fatal(err)
+		}
+		cp := drilled
+		cp.Serial = "SN-" + id
+		if id == "CK4" {
+			cp.Version = 9
+		}
+		if err := crashed.Checkpoint(id, cp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if result, err := crashed.Compact(); err != nil || result.Pending != 3 {
+		t.Fatalf("预期压缩后保留 3 个任务, 得到 %+v, %v", result, err)
+	}
+	recovered, err := crashed.Recover()
+	crashed.Close()
+	if err != nil || len(recovered) != 3 || recovered[0].Resume == nil || recovered[0].Resume.Serial != "SN-CK2" {
+		t.Fatalf("预期压缩后保留检查点, 得到 %+v, %v", recovered, err)
+	}
+
+	// 重启后 CK2 和 CK3 从电测继续，不重复钻孔；CK3 在 AOI 失败时补偿崩溃前执行的钻孔；CK4 从第一个步骤重新开始
+	drill, etest, aoi = newCountingStation(types.StationDrill), newCountingStation(types.StationETest), newCountingStation(types.StationAOI, "CK3")
+	run(crashPath, drill, etest, aoi)
+	for id, want := range map[string][2]int{"CK2": {0, 0}, "CK3": {0, 1}, "CK4": {1, 0}} {
+		if executed, compensated := drill.counts(id); executed != want[0] || compensated != want[1] {
+			t.Errorf("%s 的钻孔应执行 %d 次、补偿 %d 次, 得到 %d 次、%d 次", id, want[0], want[1], executed, compensated)
+		}
+		if executed, _ := etest.counts(id); executed != 1 {
+			t.Errorf("%s 的电测应执行 1 次, 得到 %d 次", id, executed)
+		}
+	}
+	aoi.mu.Lock()
+	ck2 := aoi.products["CK2"]
+	aoi.mu.Unlock()
+	if ck2 == nil || ck2.Serial != "SN-CK2" || !slices.Equal(ck2.History, []string{string(types.StationDrill), string(types.StationETest), string(types.StationAOI)}) {
+		t.Errorf("恢复的工件应沿用序列号和加工历史, 得到 %+v", ck2)
+	}
+}
+
+func TestWIPLimits_BlockUpstreamUntilKanbanFree(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	m := metrics.New(metrics.NewRegistry())
+	hub := web.NewHub(m)
+	go hub.Run()
+	t.Cleanup(hub.Close)
+	stateTracker := web.NewStateTracker(hub)
+	bus := event.NewBus()
+	handlers.RegisterEventHandlers(bus, stateTracker, history.NewStore(), m, logger)
+	var completed atomic.Int32
+	bus.Subscribe(event.ProductCompleted, func(event.Event) { completed.Add(1) })
+
+	workflows := map[string][]types.WorkflowStep{"PCB_KANBAN": {
+		{StationIDs: []types.StationID{types.StationDrill}},
+		{StationIDs: []types.StationID{types.StationETest}},
+	}}
+	wf := engine.NewWorkflowEngine(workflows, nil, nil, logger, bus, 1)
+	wf.Stations().SetWIPLimits(map[types.StationID]int{"station_e_test": 1})
+	gate := make(chan struct{})
+	wf.RegisterStation(station.NewStation(types.StationDrill, logger, 1, 0))
+	wf.RegisterStation(&gatedStation{id: types.StationETest, gate: gate})
+	scheduler := engine.NewScheduler(wf, 3, nil, stateTracker, m, logger)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go scheduler.Start(ctx)
+
+	waitWIP := func(id types.StationID, want web.WIPStatus) {
+		t.Helper()
+		var got web.WIPStatus
+		for i := 0; i < 100; i++ {
+			if got = stateTracker.GetStateSnapshot().WIP[id]; got == want {
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		t.Fatalf("预期工站 %s 的在制品 %+v, 得到 %+v", id, want, got)
+	}
+
+	for i := 1; i <= 3; i++ {
+		scheduler.SubmitTask(&types.Product{ID: "Kanban_" + strconv.Itoa(i), Type: "PCB_KANBAN"})
+	}
+	// 一个工件占用电测唯一的看板，其余两个加工完钻孔后停留在钻孔工站上
+	waitWIP(types.StationETest, web.WIPStatus{ID: types.StationETest, Limit: 1, InUse: 1, Blocked: 2})
+	waitWIP(types.StationDrill, web.WIPStatus{ID: types.StationDrill, InUse: 2})
+	if info, _ := wf.Stations().Get(types.StationETest); info.WIPLimit != 1 || info.WIP != 1 || info.Blocked != 2 {
+		t.Errorf("预期工站信息中在制品上限 1、在制品 1、阻塞 2, 得到 %+v", info)
+	}
+	alerts := stateTracker.GetStateSnapshot().Alerts
+	if !slices.ContainsFunc(alerts, func(a web.Alert) bool { return a.Kind == web.AlertWIPBlocked && a.StationID == types.StationETest }) {
+		t.Errorf("预期电测工站产生 wip_blocked 告警, 得到 %+v", alerts)
+	}
+
+	close(gate)
+	waitWIP(types.StationETest, web.WIPStatus{ID: types.StationETest, Limit: 1})
+	waitWIP(types.StationDrill, web.WIPStatus{ID: types.StationDrill})
+	for i := 0; i < 100 && completed.Load() < 3; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if n := completed.Load(); n != 3 {
+		t.Fatalf("预期 3 个工件全部完成, 得到 %d", n)
+	}
+	if blocked := testutil.ToFloat64(m.StationBlockedSeconds.WithLabelValues(string(types.StationETest))); blocked <= 0 {
+		t.Errorf("预期累计阻塞时长大于 0, 得到 %v", blocked)
+	}
+}
+
+func TestWorkflows_DefaultWorkflowAndStrictProductTypes(t *testing.T) {
+	app := newTestApp(t, false)
+	store := app.scheduler.Engine().Workflows()
+
+	submit := func(productType string) (int, string) {
+		body, _ := json.Marshal(types.Product{Type: productType})
+		resp, err := http.Post(app.server.URL+"/api/tasks", "application/json", bytes.NewBuffer(body))
+		if err != nil {
+			t.Fatalf("提交任务失败: %v", err)
+		}
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(msg)
+	}
+
+	// 默认按配置的默认工作流处理未知的产品类型
+	if def, fellBack, err := store.Resolve("PCB_FLEX"); err != nil || !fellBack || def.Name != "pcb_double_layer" {
+		t.Fatalf("预期未知类型使用默认工作流, 得到 %s %v %v", def.Name, fellBack, err)
+	}
+	if err := store.SetFallback("PCB_PROTOTYPE"); err != nil {
+		t.Fatalf("设置默认工作流失败: %v", err)
+	}
+	if def, _, _ := store.Resolve("PCB_FLEX"); def.Name != "pcb_prototype" {
+		t.Errorf("预期使用新的默认工作流, 得到 %s", def.Name)
+	}
+	if err := store.SetFallback("PCB_MISSING"); !errors.Is(err, engine.ErrWorkflowNotFound) {
+		t.Errorf("预期不存在的默认工作流返回 ErrWorkflowNotFound, 得到 %v", err)
+	}
+	// 只有当前的默认工作流受删除保护
+	if err := store.Delete("PCB_PROTOTYPE"); !errors.Is(err, engine.ErrWorkflowProtected) {
+		t.Errorf("预期默认工作流不允许删除, 得到 %v", err)
+	}
+	if status, msg := submit("PCB_FLEX"); status != http.StatusAccepted {
+		t.Errorf("预期非严格模式接受未知类型, 得到 %d %s", status, msg)
+	}
+
+	// 严格模式在提交时拒绝未知类型，已知类型不受影响
+	store.SetStrict(true)
+	status, msg := submit("PCB_FLEX")
+	if status != http.StatusBadRequest || !strings.Contains(msg, `unknown product type "PCB_FLEX"`) || !strings.Contains(msg, "pcb_multilayer") {
+		t.Errorf("预期严格模式返回 400 并列出可选类型, 得到 %d %s", status, msg)
+	}
+	if status, msg := submit("PCB_MULTILAYER"); status != http.StatusAccepted {
+		t.Errorf("预期已知类型正常提交, 得到 %d %s", status, msg)
+	}
+	if _, _, err := store.Resolve("PCB_FLEX"); !errors.Is(err, engine.ErrUnknownProductType) {
+		t.Errorf("预期严格模式不使用默认工作流, 得到 %v", err)
+	}
+}
+
+func TestWorkflows_VersionedCRUD(t *testing.T) {
+	_, stateTracker, server := setupTestApp(t, false)
+
+	send := func(method, path string, body interface{}) *http.Response {
+		data, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, server.URL+path, bytes.NewBuffer(data))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s 失败: %v", method, path, err)
+		}
+		return resp
+	}
+	decode := func(resp *http.Response) engine.WorkflowDefinition {
+		defer resp.Body.Close()
+		var def engine.WorkflowDefinition
+		json.NewDecoder(resp.Body).Decode(&def)
+		return def
+	}
+
+	steps := []types.WorkflowStep{{StationIDs: []types.StationID{types.StationCAM}}}
+	resp := send(http.MethodPost, "/api/workflows", map[string]interface{}{"name": "PCB_FLEX", "steps": steps})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("预期创建返回 201, 得到 %d", resp.StatusCode)
+	}
+	if def := decode(resp); def.Version != 1 {
+		t.Errorf("预期版本 1, 得到 %d", def.Version)
+	}
+
+	resp = send(http.MethodPost, "/api/workflows", map[string]interface{}{"name": "PCB_FLEX", "steps": steps})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("预期重复创建返回 409, 得到 %d", resp.StatusCode)
+	}
+
+	invalid := []types.WorkflowStep{{StationIDs: []types.StationID{"STATION_UNKNOWN"}}}
+	resp = send(http.MethodPut, "/api/workflows/PCB_FLEX", map[string]interface{}{"steps": invalid})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("预期未注册的工站返回 422, 得到 %d", resp.StatusCode)
+	}
+
+	steps = append(steps, types.WorkflowStep{StationIDs: []types.StationID{types.StationPack}})
+	resp = send(http.MethodPut, "/api/workflows/PCB_FLEX", map[string]interface{}{"steps": steps})
+	if def := decode(resp); resp.StatusCode != http.StatusOK || def.Version != 2 {
+		t.Fatalf("预期更新返回 200 和版本 2, 得到 %d 和版本 %d", resp.StatusCode, def.Version)
+	}
+	resp = send(http.MethodGet, "/api/workflows/PCB_FLEX?version=1", nil)
+	if def := decode(resp); len(def.Steps) != 1 {
+		t.Errorf("预期版本 1 只有 1 个步骤, 得到 %d", len(def.Steps))
+	}
+
+	// 新提交的工件使用最新版本
+	resp = send(http.MethodPost, "/api/tasks", types.Product{ID: "Test_Flex_01", Type: "PCB_FLEX"})
+	resp.Body.Close()
+	completed := false
+	for i := 0; i < 10 && !completed; i++ {
+		time.Sleep(300 * time.Millisecond)
+		s, ok := stateTracker.GetProduct("Test_Flex_01")
+		completed = ok && s.Status == "COMPLETED"
+	}
+	if !completed {
+		t.Fatalf("使用新工作流的工件未在规定时间内完成")
+	}
+
+	resp = send(http.MethodDelete, "/api/workflows/PCB_FLEX", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("预期删除返回 204, 得到 %d", resp.StatusCode)
+	}
+	resp = send(http.MethodDelete, "/api/workflows/PCB_DOUBLE_LAYER", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("预期删除默认工作流返回 409, 得到 %d", resp.StatusCode)
+	}
+}
+
+func TestStations_ListDisableEnable(t *testing.T) {
+	_, stateTracker, server := setupTestApp(t, false)
+
+	listStations := func() map[types.StationID]api.StationDetail {
+		resp, err := http.Get(server.URL + "/api/stations")
+		if err != nil {
+			t.Fatalf("查询工站失败: %v", err)
+		}
+		defer resp.Body.Close()
+		var details []api.StationDetail
+		json.NewDecoder(resp.Body).Decode(&details)
+		byID := make(map[types.StationID]api.StationDetail)
+		for _, d := range details {
+			byID[d.ID] = d
+		}
+		return byID
+	}
+
+	stations := listStations()
+	if aoi := stations[types.StationAOI]; aoi.Driver != engine.DriverRemote || aoi.Endpoint == "" || aoi.PoolSize != 1 {
+		t.Errorf("远程工站信息不正确: %+v", aoi)
+	}
+	if cam := stations[types.StationCAM]; cam.Driver != engine.DriverLocal || !cam.Enabled {
+		t.Errorf("本地工站信息不正确: %+v", cam)
+	}
+
+	resp, err := http.Post(server.URL+"/api/stations/STATION_CAM/disable", "application/json", nil)
+	if err != nil {
+		t.Fatalf("停用工站失败: %v", err)
+	}
+	resp.Body.Close()
+	if cam := listStations()[types.StationCAM]; cam.Enabled || cam.Status != "MAINTENANCE" {
+		t.Errorf("预期工站已停用并进入维护, 得到 %+v", cam)
+	}
+
+	// 到达已停用工站的工件失败并补偿
+	task := types.Product{ID: "Test_Disabled_01", Type: "PCB_PROTOTYPE"}
+	body, _ := json.Marshal(task)
+	resp, err = http.Post(server.URL+"/api/tasks", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("提交任务失败: %v", err)
+	}
+	resp.Body.Close()
+	compensated := false
+	for i := 0; i < 10 && !compensated; i++ {
+		time.Sleep(200 * time.Millisecond)
+		s, ok := stateTracker.GetProduct(task.ID)
+		compensated = ok && s.Status == "COMPENSATED"
+	}
+	if !compensated {
+		t.Errorf("预期工件 %s 因工站停用而补偿", task.ID)
+	}
+
+	resp, err = http.Post(server.URL+"/api/stations/STATION_CAM/enable", "application/json", nil)
+	if err != nil {
+		t.Fatalf("启用工站失败: %v", err)
+	}
+	resp.Body.Close()
+	if cam := listStations()[types.StationCAM]; !cam.Enabled || cam.Status != "IDLE" {
+		t.Errorf("预期工站已启用并回到 IDLE, 得到 %+v", cam)
+	}
+
+	resp, err = http.Post(server.URL+"/api/stations/STATION_UNKNOWN/disable", "application/json", nil)
+	if err != nil {
+		t.Fatalf("停用工站失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("预期不存在的工站返回 404, 得到 %d", resp.StatusCode)
+	}
+}
+
+func TestAudit_RecordsActionsWithSnapshots(t *testing.T) {
+	_, _, server := setupTestApp(t, false)
+
+	body, _ := json.Marshal(types.Product{ID: "Test_Audit_01", Type: "PCB_PROTOTYPE"})
+	resp, err := http.Post(server.URL+"/api/tasks", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("提交任务失败: %v", err)
+	}
+	resp.Body.Close()
+	for _, path := range []string{"/api/stations/STATION_CAM/disable", "/api/stations/STATION_CAM/enable", "/api/admin/scheduler/pause"} {
+		resp, err := http.Post(server.URL+path, "application/json", nil)
+		if err != nil {
+			t.Fatalf("请求 %s 失败: %v", path, err)
+		}
+		resp.Body.Close()
+	}
+
+	query := func(params string) []audit.Entry {
+		resp, err := http.Get(server.URL + "/api/audit?" + params)
+		if err != nil {
+			t.Fatalf("查询审计日志失败: %v", err)
+		}
+		defer resp.Body.Close()
+		var entries []audit.Entry
+		json.NewDecoder(resp.Body).Decode(&entries)
+		return entries
+	}
+
+	// 最新的在前，action 按前缀匹配
+	entries := query("action=station")
+	if len(entries) != 2 || entries[0].Action != audit.ActionStationEnable || entries[1].Action != audit.ActionStationDisable {
+		t.Fatalf("预期按时间倒序返回停用和启用两条记录, 得到 %+v", entries)
+	}
+	disable := entries[1]
+	if disable.Actor != audit.Anonymous || disable.Source != "http" || disable.Target != string(types.StationCAM) {
+		t.Errorf("记录的调用方或操作对象不正确: %+v", disable)
+	}
+	var before, after engine.StationInfo
+	json.Unmarshal(disable.Before, &before)
+	json.Unmarshal(disable.After, &after)
+	if !before.Enabled || after.Enabled {
+		t.Errorf("预期快照记录停用前后的启用状态, 得到 before=%s after=%s", disable.Before, disable.After)
+	}
+
+	if entries := query("target=Test_Audit_01"); len(entries) != 1 || entries[0].Action != audit.ActionTaskSubmit || len(entries[0].After) == 0 {
+		t.Errorf("预期记录任务提交及提交的工件, 得到 %+v", entries)
+	}
+	if entries := query("action=scheduler.pause"); len(entries) != 1 || !strings.Contains(string(entries[0].After), "paused") {
+		t.Errorf("预期记录调度器暂停后的状态, 得到 %+v", entries)
+	}
+	if entries := query("limit=2"); len(entries) != 2 {
+		t.Errorf("预期 limit 限制返回条数, 得到 %d 条", len(entries))
+	}
+	resp, err = http.Get(server.URL + "/api/audit?since=yesterday")
+	if err != nil {
+		t.Fatalf("查询审计日志失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("预期非法的 since 返回 400, 得到 %d", resp.StatusCode)
+	}
+}
+
+func TestLoadConfig_FileAndEnvOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "line-a.yaml")
+	yaml := `
+max_workers: 2
+resource_pools:
+  STATION_E_TEST: 1
+stations:
+  STATION_DRILL:
+    delay_ms: 1500
+workflows:
+  PCB_DOUBLE_LAYER:
+    - station_ids: ["STATION_CAM"]
+server:
+  addr: ":8081"
+`
+	if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+		t.Fatalf("写入配置文件失败: %v", err)
+	}
+	t.Setenv(config.PathEnv, path)
+	t.Setenv("FACTORY_MAX_WORKERS", "8")
+	t.Setenv("FACTORY_SERVER_GRPC_ADDR", ":50052")
+	t.Setenv("FACTORY_WAL_PATH", "/data/tasks.wal")
+	t.Setenv("FACTORY_RESOURCE_POOLS_STATION_E_TEST", "3")
+	t.Setenv("FACTORY_STATIONS_STATION_AOI_ENDPOINT", "http://aoi:9090")
+
+	cfg, err := config.LoadConfig("", nil)
+	if err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	if cfg.MaxWorkers != 8 || cfg.Server.Addr != ":8081" || cfg.Server.GRPCAddr != ":50052" || cfg.WAL.Path != "/data/tasks.wal" {
+		t.Errorf("环境变量没有覆盖配置: workers=%d addr=%s grpc=%s wal=%s", cfg.MaxWorkers, cfg.Server.Addr, cfg.Server.GRPCAddr, cfg.WAL.Path)
+	}
+	if pools := cfg.ResourcePools; len(pools) != 1 || pools["station_e_test"] != 3 {
+		t.Errorf("预期电测资源池被覆盖为 3, 得到 %v", pools)
+	}
+	if len(cfg.Workflows) != 1 || cfg.StepDelayMs != 2000 {
+		t.Errorf("预期使用配置文件中的工作流和 demo 配置集的步骤延时, 得到 %d 个工作流, step_delay_ms=%d", len(cfg.Workflows), cfg.StepDelayMs)
+	}
+	if drill, aoi := cfg.Stations[types.StationDrill], cfg.Stations[types.StationAOI]; drill.DelayMs != 1500 || aoi.Endpoint != "http://aoi:9090" {
+		t.Errorf("工站配置不正确: %+v", cfg.Stations)
+	}
+
+	// 命令行参数优先于环境变量和配置文件
+	cfg, err = config.LoadConfig("", config.Overrides{"max_workers": 16, "server.addr": ":7000", "logging.format": "text"})
+	if err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	if cfg.MaxWorkers != 16 || cfg.Server.Addr != ":7000" || cfg.Server.GRPCAddr != ":50052" || cfg.Logging.Format != config.LogFormatText {
+		t.Errorf("命令行参数没有覆盖配置: workers=%d addr=%s grpc=%s format=%s", cfg.MaxWorkers, cfg.Server.Addr, cfg.Server.GRPCAddr, cfg.Logging.Format)
+	}
+	if cfg.Overrides()["max_workers"] != 16 {
+		t.Errorf("预期保留命令行参数供重新加载使用, 得到 %v", cfg.Overrides())
+	}
+
+	// 显式指定的路径优先于环境变量
+	if _, err := config.LoadConfig(filepath.Join(t.TempDir(), "missing.yaml"), nil); err == nil {
+		t.Error("预期配置文件不存在时返回错误")
+	}
+}
+
+func TestLoadConfig_Profiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profile.yaml")
+	yaml := `
+profile: production
+station_delay_ms: 3000
+wal:
+  sync: false
+`
+	if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+		t.Fatalf("写入配置文件失败: %v", err)
+	}
+
+	// 配置文件中选择的配置集，显式设置的配置项优先
+	cfg, err := config.LoadConfig(path, nil)
+	if err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	if cfg.Profile != config.ProfileProduction || !cfg.RateLimit.Enabled || cfg.Simulation.Autostart {
+		t.Errorf("预期使用 production 配置集, 得到 profile=%s rate_limit=%v autostart=%v", cfg.Profile, cfg.RateLimit.Enabled, cfg.Simulation.Autostart)
+	}
+	if cfg.StepDelayMs != 2000 || cfg.StationDelayMs != 3000 || cfg.WAL.Sync {
+		t.Errorf("预期显式设置的值覆盖配置集, 得到 step=%d station=%d sync=%v", cfg.StepDelayMs, cfg.StationDelayMs, cfg.WAL.Sync)
+	}
+
+	// 参数指定的配置集优先于配置文件
+	cfg, err = config.LoadConfig(path, config.Overrides{"profile": "TEST"})
+	if err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	if cfg.Profile != config.ProfileTest || cfg.StepDelayMs != 1 || cfg.StationDelayMs != 3000 || cfg.Stations[types.StationETest].FailureRate != 0 {
+		t.Errorf("test 配置集不正确: profile=%s step=%d station=%d stations=%+v", cfg.Profile, cfg.StepDelayMs, cfg.StationDelayMs, cfg.Stations)
+	}
+
+	t.Setenv("FACTORY_PROFILE", "demo")
+	cfg, err = config.LoadConfig(path, nil)
+	if err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	if cfg.Profile != config.ProfileDemo || cfg.Stations[types.StationETest].FailureRate != 0.05 || !cfg.Simulation.Autostart {
+		t.Errorf("预期环境变量选择 demo 配置集, 得到 profile=%s stations=%+v", cfg.Profile, cfg.Stations)
+	}
+
+	if _, err := config.LoadConfig(path, config.Overrides{"profile": "staging"}); err == nil {
+		t.Error("预期未知的配置集返回错误")
+	}
+}
+
+func TestConfigValidate_ListsAllProblems(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.yaml")
+	yaml := `
+max_workers: 0
+default_workflow: PCB_A
+resource_pools:
+  STATION_LASER: 1
+stations:
+  STATION_XRAY:
+    delay_ms: 100
+  STATION_AOI:
+    endpoint: "aoi:9090"
+workflows:
+  PCB_A:
+    - station_ids: ["STATION_CAM"]
+  pcb_a:
+    - station_ids: ["STATION_CAM"]
+  PCB_B:
+    - station_ids: ["STATION_CAM", "STATION_LASER"]
+    - station_ids: ["STATION_DRILL"]
+      rule: "product.Attrs.layers >"
+`
+	if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+		t.Fatalf("写入配置文件失败: %v", err)
+	}
+	cfg, err := config.LoadConfig(path, nil)
+	if err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+
+	err = cfg.Validate()
+	var verr *config.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("预期返回 ValidationError, 得到 %v", err)
+	}
+	want := []string{
+		"max_workers:",
+		"stations.STATION_AOI.endpoint:",
+		"stations.STATION_XRAY: 不是内置工站",
+		"resource_pools.station_laser: 未知工站",
+		"workflows: 工作流名称重复 (不区分大小写): PCB_A, pcb_a",
+		"workflows.pcb_b[0]: 未知工站 STATION_LASER",
+		"workflows.pcb_b[1].rule:",
+	}
+	if len(verr.Problems) != len(want) {
+		t.Errorf("预期 %d 个问题, 得到 %d 个:\n%v", len(want), len(verr.Problems), err)
+	}
+	for _, w := range want {
+		if !strings.Contains(err.Error(), "\n  - "+w) {
+			t.Errorf("错误信息中缺少 %q:\n%v", w, err)
+		}
+	}
+}
+
+func TestReload_AppliesHotSettingsAndReportsRestart(t *testing.T) {
+	app := newTestApp(t, false)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	// pools 和 workflows 是资源池和工作流段的内容，extra 追加到文件末尾
+	write := func(workers int, pools, workflows, extra string) {
+		yaml := fmt.Sprintf("max_workers: %d\nresource_pools:\n%s\nworkflows:\n%s\n%s", workers, pools, workflows, extra)
+		if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+			t.Fatalf("写入配置文件失败: %v", err)
+		}
+	}
+	pools := "  STATION_E_TEST: 1\n  STATION_AOI: 1"
+	workflows := `  PCB_DOUBLE_LAYER:
+    - station_ids: ["STATION_CAM"]
+    - station_ids: ["STATION_PACK"]`
+	write(4, pools, workflows, "")
+	cfg, err := config.LoadConfig(path, nil)
+	if err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	reloader := reload.New(cfg, app.scheduler, app.simulator, app.logLevels, app.flags, app.logger)
+
+	write(3, "  STATION_E_TEST: 2", workflows+`
+    - station_ids: ["STATION_PACK"]
+  PCB_FLEX:
+    - station_ids: ["STATION_CAM"]`, `
+simulation:
+  rate: 30
+logging:
+  components:
+    engine: debug
+server:
+  addr: ":9000"
+wal:
+  path: other.wal
+`)
+	result, err := reloader.Reload()
+	if err != nil {
+		t.Fatalf("重新加载配置失败: %v", err)
+	}
+	wantApplied := []string{"max_workers", "workflows", "resource_pools", "simulation.rate", "logging.components"}
+	if !slices.Equal(result.Applied, wantApplied) || !slices.Equal(result.RestartRequired, []string{"server.addr", "wal.path"}) {
+		t.Errorf("预期生效 %v、需要重启 [server.addr wal.path], 得到 %+v", wantApplied, result)
+	}
+	if workers := app.scheduler.State().Workers; workers != 3 {
+		t.Errorf("预期 worker 数量调整为 3, 得到 %d", workers)
+	}
+	wf := app.scheduler.Engine()
+	if eTest, _ := wf.Stations().Get(types.StationETest); eTest.PoolSize != 2 {
+		t.Errorf("预期电测资源池扩容为 2, 得到 %d", eTest.PoolSize)
+	}
+	if aoi, _ := wf.Stations().Get(types.StationAOI); aoi.PoolSize != 0 {
+		t.Errorf("预期 AOI 不再限制并发, 得到资源池容量 %d", aoi.PoolSize)
+	}
+	if def, ok := wf.Workflows().Current("pcb_double_layer"); !ok || def.Version != 2 || len(def.Steps) != 3 {
+		t.Errorf("预期默认工作流发布新版本, 得到 %+v", def)
+	}
+	if _, ok := wf.Workflows().Current("pcb_flex"); !ok {
+		t.Error("预期新增 pcb_flex 工作流")
+	}
+	if _, ok := wf.Workflows().Current("pcb_multilayer"); !ok {
+		t.Error("不在当前配置中的工作流不应被删除")
+	}
+	if level := app.logLevels.State().Components["engine"]; level != "DEBUG" {
+		t.Errorf("预期 engine 组件切换到 DEBUG, 得到 %q", level)
+	}
+	if status := app.simulator.Status(); status.Rate != 30 {
+		t.Errorf("预期模拟器默认速率调整为 30, 得到 %v", status.Rate)
+	}
+
+	// 任一问题未通过校验时整份配置都不生效
+	write(5, pools, workflows+`
+  PCB_FLEX:
+    - station_ids: ["STATION_LASER"]`, "")
+	if _, err := reloader.Reload(); err == nil {
+		t.Error("预期引用未知工站的配置无法加载")
+	}
+	if workers := app.scheduler.State().Workers; workers != 3 {
+		t.Errorf("校验失败时不应调整 worker 数量, 得到 %d", workers)
+	}
+
+	// 修改配置文件后自动重新加载
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.Run(ctx)
+	time.Sleep(100 * time.Millisecond)
+	write(6, pools, workflows, "")
+	deadline := time.Now().Add(5 * time.Second)
+	for app.scheduler.State().Workers != 6 {
+		if time.Now().After(deadline) {
+			t.Fatalf("修改配置文件后没有重新加载, worker 数量为 %d", app.scheduler.State().Workers)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestWorkflowsDir_MergesFilesAndReloads(t *testing.T) {
+	app := newTestApp(t, false)
+	dir := t.TempDir()
+	flows := filepath.Join(dir, "flows")
+	if err := os.Mkdir(flows, 0755); err != nil {
+		t.Fatalf("创建工作流目录失败: %v", err)
+	}
+	writeFile := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("写入 %s 失败: %v", name, err)
+		}
+	}
+	writeFile("line.yaml", `
+workflows_dir: flows
+workflows:
+  PCB_DOUBLE_LAYER:
+    - station_ids: ["STATION_CAM"]
+`)
+	writeFile("flows/multilayer.yaml", `
+PCB_MULTILAYER:
+  - station_ids: ["STATION_LAMI"]
+PCB_FLEX:
+  - station_ids: ["STATION_CAM"]
+  - station_ids: ["STATION_PACK"]
+`)
+	writeFile("flows/prototype.yml", "PCB_PROTOTYPE:\n  - station_ids: [\"STATION_DRILL\"]\n")
+	writeFile("flows/README.txt", "不是工作流文件")
+
+	cfg, err := config.LoadConfig(filepath.Join(dir, "line.yaml"), nil)
+	if err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("配置未通过校验: %v", err)
+	}
+	names := slices.Sorted(maps.Keys(cfg.Workflows))
+	if !slices.Equal(names, []string{"pcb_double_layer", "pcb_flex", "pcb_multilayer", "pcb_prototype"}) {
+		t.Errorf("预期合并配置文件和目录中的工作流, 得到 %v", names)
+	}
+	if steps := cfg.Workflows["pcb_flex"]; len(steps) != 2 || steps[1].StationIDs[0] != types.StationPack {
+		t.Errorf("工作流文件解析不正确: %+v", steps)
+	}
+
+	// 不同文件中的重复名称 (不区分大小写) 标出所在的文件
+	writeFile("flows/dup.yaml", "pcb_flex:\n  - station_ids: [\"STATION_CAM\"]\n")
+	dup, err := config.LoadConfig(filepath.Join(dir, "line.yaml"), nil)
+	if err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	if err := dup.Validate(); err == nil || !strings.Contains(err.Error(), "工作流名称重复 (不区分大小写): pcb_flex (dup.yaml), PCB_FLEX (multilayer.yaml)") {
+		t.Errorf("预期报告不同文件中的重复名称, 得到 %v", err)
+	}
+	os.Remove(filepath.Join(flows, "dup.yaml"))
+
+	// 目录中的文件增删后自动重新加载
+	reloader := reload.New(cfg, app.scheduler, app.simulator, app.logLevels, app.flags, app.logger)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.Run(ctx)
+	time.Sleep(100 * time.Millisecond)
+	writeFile("flows/hdi.yaml", "PCB_HDI:\n  - station_ids: [\"STATION_DRILL\"]\n")
+	wf := app.scheduler.Engine()
+	waitFor := func(what string, cond func() bool) {
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("等待%s超时", what)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	waitFor("新增的工作流文件生效", func() bool {
+		_, ok := wf.Workflows().Current("pcb_hdi")
+		return ok
+	})
+	os.Remove(filepath.Join(flows, "prototype.yml"))
+	waitFor("删除的工作流文件生效", func() bool {
+		_, ok := wf.Workflows().Current("pcb_prototype")
+		return !ok
+	})
+}
+
+func TestLoadFromFile_JSONConfigAndWorkflows(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "flows"), 0755); err != nil {
+		t.Fatalf("创建工作流目录失败: %v", err)
+	}
+	writeFile := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("写入 %s 失败: %v", name, err)
+		}
+	}
+	// JSON 配置文件定义工作流、资源池、工站延时和 worker 数，目录中的 JSON 工作流同样合并
+	writeFile("line.json", `{
+  "max_workers": 6,
+  "workflows_dir": "flows",
+  "workflows": {"PCB_DOUBLE_LAYER": [{"station_ids": ["STATION_CAM"]}]},
+  "resource_pools": {"STATION_DRILL": 3},
+  "stations": {"STATION_DRILL": {"delay_ms": 250}}
+}`)
+	writeFile("flows/flex.json", `{"PCB_FLEX": [{"station_ids": ["STATION_CAM"]}, {"station_ids": ["STATION_PACK"]}]}`)
+
+	cfg, err := config.LoadFromFile(filepath.Join(dir, "line.json"))
+	if err != nil {
+		t.Fatalf("加载 JSON 配置失败: %v", err)
+	}
+	// 与 YAML 相同，资源池的键读出为小写，由使用方统一转换
+	if cfg.MaxWorkers != 6 || cfg.ResourcePools["station_drill"] != 3 || cfg.Stations[types.StationDrill].DelayMs != 250 {
+		t.Errorf("JSON 配置解析不正确: workers=%d pools=%v stations=%+v", cfg.MaxWorkers, cfg.ResourcePools, cfg.Stations)
+	}
+	if steps := cfg.Workflows["pcb_flex"]; len(steps) != 2 || steps[1].StationIDs[0] != types.StationPack {
+		t.Errorf("JSON 工作流文件解析不正确: %v", cfg.Workflows)
+	}
+
+	// 校验失败时逐条列出出错的配置项
+	writeFile("flows/bad.json", `{"PCB_BAD": [{"station_ids": ["STATION_UNKNOWN"]}]}`)
+	writeFile("line.json", `{"max_workers": 0, "workflows_dir": "flows"}`)
+	_, err = config.LoadFromFile(filepath.Join(dir, "line.json"))
+	var verr *config.ValidationError
+	if !errors.As(err, &verr) || !strings.Contains(err.Error(), "max_workers") || !strings.Contains(err.Error(), "STATION_UNKNOWN") {
+		t.Errorf("预期列出 max_workers 和未知工站, 得到 %v", err)
+	}
+}
+
+func TestLogLevel_RuntimeAndComponentOverrides(t *testing.T) {
+	_, _, server := setupTestApp(t, false)
+
+	put := func(body string) (int, logging.State) {
+		req, _ := http.NewRequest(http.MethodPut, server.URL+"/api/admin/loglevel", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("修改日志级别失败: %v", err)
+		}
+		defer resp.Body.Close()
+		var state logging.State
+		json.NewDecoder(resp.Body).Decode(&state)
+		return resp.StatusCode, state
+	}
+
+	status, state := put(`{"level":"warn","components":{"engine":"debug"}}`)
+	if status != http.StatusOK || state.Level != "WARN" || state.Components["engine"] != "DEBUG" || len(state.Components) != 1 {
+		t.Fatalf("预期整体级别为 WARN 且只有 engine 覆盖为 DEBUG, 得到 %d %+v", status, state)
+	}
+	// 无效的组件或级别不做任何修改
+	if status, _ := put(`{"level":"error","components":{"gpu":"debug"}}`); status != http.StatusBadRequest {
+		t.Errorf("预期未知组件返回 400, 得到 %d", status)
+	}
+	if status, _ := put(`{"components":{"station":"loud"}}`); status != http.StatusBadRequest {
+		t.Errorf("预期无效级别返回 400, 得到 %d", status)
+	}
+	resp, err := http.Get(server.URL + "/api/admin/loglevel")
+	if err != nil {
+		t.Fatalf("查询日志级别失败: %v", err)
+	}
+	json.NewDecoder(resp.Body).Decode(&state)
+	resp.Body.Close()
+	if state.Level != "WARN" || len(state.Components) != 1 {
+		t.Errorf("预期无效请求不修改级别, 得到 %+v", state)
+	}
+	if _, state := put(`{"components":{"engine":""}}`); len(state.Components) != 0 {
+		t.Errorf("预期级别为空时取消覆盖, 得到 %+v", state)
+	}
+
+	// 修改对已创建的 Logger 立即生效，组件的覆盖级别优先于整体级别
+	var buf bytes.Buffer
+	levels := logging.New(slog.NewJSONHandler(&buf, nil), slog.LevelInfo)
+	engineLogger := levels.Logger(logging.ComponentEngine).With("component", "engine")
+	schedulerLogger := levels.Logger(logging.ComponentScheduler).With("component", "scheduler")
+	engineLogger.Debug("engine debug")
+	if err := levels.Update("warn", map[string]string{"engine": "debug"}); err != nil {
+		t.Fatalf("修改日志级别失败: %v", err)
+	}
+	engineLogger.Debug("engine debug after update")
+	schedulerLogger.Info("scheduler info")
+	schedulerLogger.Warn("scheduler warn")
+	logs := buf.String()
+	if strings.Contains(logs, `"engine debug"`) || strings.Contains(logs, "scheduler info") {
+		t.Errorf("预期低于当前级别的日志被过滤, 得到 %s", logs)
+	}
+	if !strings.Contains(logs, "engine debug after update") || !strings.Contains(logs, "scheduler warn") {
+		t.Errorf("预期达到当前级别的日志被输出, 得到 %s", logs)
+	}
+}
+
+func TestAdminConfig_InspectAndPatch(t *testing.T) {
+	app := newTestApp(t, false)
+
+	patch := func(body string) (int, map[string]interface{}) {
+		req, _ := http.NewRequest(http.MethodPatch, app.server.URL+"/api/admin/config", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("修改配置失败: %v", err)
+		}
+		defer resp.Body.Close()
+		var out map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+
+	status, out := patch(`{"simulation":{"rate":30},"resource_pools":{"STATION_E_TEST":3},"logging":{"level":"warn"}}`)
+	if status != http.StatusOK {
+		t.Fatalf("预期修改成功, 得到 %d", status)
+	}
+	var keys []string
+	for _, c := range out["changes"].([]interface{}) {
+		keys = append(keys, c.(map[string]interface{})["key"].(string))
+	}
+	if !slices.Equal(keys, []string{"resource_pools", "simulation.rate", "logging.level"}) {
+		t.Errorf("预期三个配置项发生变化, 得到 %v", keys)
+	}
+	if info, _ := app.scheduler.Engine().Stations().Get(types.StationETest); info.PoolSize != 3 {
+		t.Errorf("预期电测资源池容量调整为 3, 得到 %d", info.PoolSize)
+	}
+	if level := app.logLevels.State().Level; level != "WARN" {
+		t.Errorf("预期日志级别修改为 WARN, 得到 %s", level)
+	}
+
+	// 不可热更新的配置项和无效的值都返回 400 且不做任何修改
+	if status, _ := patch(`{"server":{"addr":":9000"}}`); status != http.StatusBadRequest {
+		t.Errorf("预期修改监听地址返回 400, 得到 %d", status)
+	}
+	if status, _ := patch(`{"resource_pools":{"STATION_E_TEST":1,"STATION_LASER":1}}`); status != http.StatusBadRequest {
+		t.Errorf("预期未知工站返回 400, 得到 %d", status)
+	}
+	if status, _ := patch(`{"simulation":{"rate":-1},"logging":{"level":"error"}}`); status != http.StatusBadRequest {
+		t.Errorf("预期负数速率返回 400, 得到 %d", status)
+	}
+
+	resp, err := http.Get(app.server.URL + "/api/admin/config")
+	if err != nil {
+		t.Fatalf("查询配置失败: %v", err)
+	}
+	var cfg map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&cfg)
+	resp.Body.Close()
+	sim := cfg["simulation"].(map[string]interface{})
+	pools := cfg["resource_pools"].(map[string]interface{})
+	logging := cfg["logging"].(map[string]interface{})
+	if sim["rate"] != 30.0 || pools["STATION_E_TEST"] != 3.0 || logging["level"] != "warn" || cfg["profile"] != config.ProfileTest {
+		t.Errorf("预期返回修改后的生效配置, 得到 simulation=%v pools=%v logging=%v profile=%v", sim, pools, logging, cfg["profile"])
+	}
+
+	// 每个发生变化的配置项记录一条审计
+	resp, err = http.Get(app.server.URL + "/api/audit?action=config")
+	if err != nil {
+		t.Fatalf("查询审计日志失败: %v", err)
+	}
+	var entries []audit.Entry
+	json.NewDecoder(resp.Body).Decode(&entries)
+	resp.Body.Close()
+	if len(entries) != 3 || entries[2].Action != audit.ActionConfigPatch || entries[2].Target != "resource_pools" {
+		t.Fatalf("预期三条配置修改的审计记录, 得到 %+v", entries)
+	}
+	if entries[0].Target != "logging.level" || len(entries[0].Before) == 0 || string(entries[0].After) != `"warn"` {
+		t.Errorf("预期审计记录修改前后的日志级别, 得到 %s -> %s", entries[0].Before, entries[0].After)
+	}
+
+	// 密钥、令牌和密码脱敏
+	var secrets config.Config
+	secrets.Auth.JWT.Secret = "s3cret"
+	secrets.Auth.APIKeys = []config.APIKeyConfig{{Name: "mes", Key: "k-123"}}
+	secrets.Stations = map[types.StationID]config.StationConfig{types.StationAOI: {Auth: config.StationAuthConfig{Password: "pw"}}}
+	data, _ := json.Marshal(secrets.Redact())
+	for _, secret := range []string{"s3cret", "k-123", `"pw"`} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("预期 %s 被脱敏, 得到 %s", secret, data)
+		}
+	}
+	if !strings.Contains(string(data), `"name":"mes"`) {
+		t.Errorf("预期非敏感字段保留, 得到 %s", data)
+	}
+}
+
+func TestPriorityPolicy_AppliedAtSubmission(t *testing.T) {
+	app := newTestApp(t, false)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte(`
+priority_policy:
+  enabled: true
+  default: 1
+  types:
+    PCB_PROTOTYPE: 3
+  boosts:
+    - rule: attrs.rush == true
+      boost: 5
+    - rule: product.Namespace == "line-a"
+      boost: 1
+`), 0o644)
+	cfg, err := config.LoadConfig(path, config.Overrides{"profile": config.ProfileTest})
+	if err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	policy, err := reload.PriorityPolicy(cfg)
+	if err != nil || policy == nil {
+		t.Fatalf("预期创建优先级策略, 得到 %v %v", policy, err)
+	}
+	app.scheduler.SetPriorityPolicy(policy)
+
+	// 暂停出队，提交的任务都停留在队列中，客户端提交的优先级被忽略
+	app.scheduler.Pause()
+	for _, body := range []string{
+		`{"id":"Policy_Double","type":"PCB_DOUBLE_LAYER","priority":9}`,
+		`{"id":"Policy_Proto","type":"pcb_prototype"}`,
+		`{"id":"Policy_Rush","type":"PCB_DOUBLE_LAYER","attrs":{"rush":true}}`,
+		`{"id":"Policy_Line_A","type":"PCB_PROTOTYPE","namespace":"line-a","attrs":{"rush":false}}`,
+	} {
+		resp, err := http.Post(app.server.URL+"/api/tasks", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("提交任务失败: %v", err)
+		}
+		resp.Body.Close()
+	}
+	priorities := make(map[string]int)
+	for _, entry := range app.scheduler.State().Queue {
+		priorities[entry.ProductID] = entry.Priority
+	}
+	want := map[string]int{"Policy_Double": 1, "Policy_Proto": 3, "Policy_Rush": 6, "Policy_Line_A": 4}
+	if !maps.Equal(priorities, want) {
+		t.Errorf("预期按策略计算优先级 %v, 得到 %v", want, priorities)
+	}
+
+	// 取消策略后恢复使用客户端提交的优先级
+	app.scheduler.SetPriorityPolicy(nil)
+	app.scheduler.SubmitTask(&types.Product{ID: "Policy_Client", Type: "PCB_DOUBLE_LAYER", Priority: 9})
+	for _, entry := range app.scheduler.State().Queue {
+		if entry.ProductID == "Policy_Client" && entry.Priority != 9 {
+			t.Errorf("预期使用客户端提交的优先级 9, 得到 %d", entry.Priority)
+		}
+	}
+	for id := range maps.Keys(want) {
+		app.scheduler.Cancel(id)
+	}
+	app.scheduler.Cancel("Policy_Client")
+	app.scheduler.Resume()
+
+	// 无法编译的规则无法通过校验
+	cfg.PriorityPolicy.Boosts = append(cfg.PriorityPolicy.Boosts, config.PriorityBoostConfig{Rule: "attrs.rush +", Boost: 1})
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "priority_policy.boosts[2].rule") {
+		t.Errorf("预期无效的加权规则无法通过校验, 得到 %v", err)
+	}
+}
+
+func TestFeatureFlags_ToggleAtRuntime(t *testing.T) {
+	app := newTestApp(t, false)
+
+	set := func(name, body string) (int, features.Flag) {
+		req, _ := http.NewRequest(http.MethodPut, app.server.URL+"/api/admin/features/"+name, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("切换功能开关失败: %v", err)
+		}
+		defer resp.Body.Close()
+		var flag features.Flag
+		json.NewDecoder(resp.Body).Decode(&flag)
+		return resp.StatusCode, flag
+	}
+
+	// 所有开关默认关闭
+	resp, err := http.Get(app.server.URL + "/api/admin/features")
+	if err != nil {
+		t.Fatalf("查询功能开关失败: %v", err)
+	}
+	var list []features.Flag
+	json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if len(list) != len(features.Names()) {
+		t.Fatalf("预期列出所有功能开关, 得到 %+v", list)
+	}
+	for _, flag := range list {
+		if flag.Enabled || flag.Description == "" {
+			t.Errorf("预期 %s 默认关闭且带有说明, 得到 %+v", flag.Name, flag)
+		}
+	}
+
+	status, flag := set(features.WSDelta, `{"enabled":true}`)
+	if status != http.StatusOK || !flag.Enabled {
+		t.Fatalf("预期打开 ws_delta, 得到 %d %+v", status, flag)
+	}
+	if !app.flags.Enabled(features.WSDelta) {
+		t.Error("预期 ws_delta 立即生效")
+	}
+	if body := scrapeMetrics(t, app.server.URL); !strings.Contains(body, `feature_flag_enabled{flag="ws_delta"} 1`) {
+		t.Error("预期指标反映打开的开关")
+	}
+	if status, _ := set("time_travel", `{"enabled":true}`); status != http.StatusNotFound {
+		t.Errorf("预期未知开关返回 404, 得到 %d", status)
+	}
+	if status, _ := set(features.Preemption, `{}`); status != http.StatusBadRequest {
+		t.Errorf("预期缺少 enabled 返回 400, 得到 %d", status)
+	}
+
+	// 运行中切换的开关反映在生效的配置中，并记录审计
+	resp, err = http.Get(app.server.URL + "/api/admin/config")
+	if err != nil {
+		t.Fatalf("查询配置失败: %v", err)
+	}
+	var cfg map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&cfg)
+	resp.Body.Close()
+	if flags := cfg["features"].(map[string]interface{}); flags[features.WSDelta] != true {
+		t.Errorf("预期生效的配置包含打开的开关, 得到 %v", flags)
+	}
+	resp, err = http.Get(app.server.URL + "/api/audit?action=feature")
+	if err != nil {
+		t.Fatalf("查询审计日志失败: %v", err)
+	}
+	var entries []audit.Entry
+	json.NewDecoder(resp.Body).Decode(&entries)
+	resp.Body.Close()
+	if len(entries) != 1 || entries[0].Target != features.WSDelta || string(entries[0].Before) != "false" || string(entries[0].After) != "true" {
+		t.Errorf("预期一条切换开关的审计记录, 得到 %+v", entries)
+	}
+
+	// 配置文件中的未知开关无法通过校验
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte("features:\n  time_travel: true\n"), 0o644)
+	loaded, err := config.LoadConfig(path, config.Overrides{"profile": config.ProfileTest})
+	if err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	if err := loaded.Validate(); err == nil || !strings.Contains(err.Error(), "features.time_travel") {
+		t.Errorf("预期未知的功能开关无法通过校验, 得到 %v", err)
+	}
+}
+
+func TestLogFile_RotatesBySizeAndAge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "logs", "orchestrator.log")
+	file, err := logging.OpenRotatingFile(path, 512, 0, 2)
+	if err != nil {
+		t.Fatalf("打开日志文件失败: %v", err)
+	}
+	logger := slog.New(slog.NewJSONHandler(file, nil))
+	for i := 0; i < 40; i++ {
+		logger.Info("工站加工完成", "station_id", "STATION_CAM", "seq", i)
+	}
+	file.Close()
+
+	backups, _ := filepath.Glob(filepath.Join(dir, "logs", "orchestrator-*.log"))
+	if len(backups) != 2 {
+		t.Errorf("预期只保留 2 个轮转文件, 得到 %v", backups)
+	}
+	for _, p := range append(backups, path) {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatalf("读取日志文件失败: %v", err)
+		}
+		if len(data) > 512 {
+			t.Errorf("预期文件不超过 512 字节, %s 有 %d 字节", p, len(data))
+		}
+		// 每条记录完整地写入一个文件
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			if !json.Valid([]byte(line)) {
+				t.Errorf("%s 中存在不完整的记录: %s", p, line)
+			}
+		}
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), `"seq":39`) {
+		t.Errorf("预期最新的日志写入当前文件, 得到 %s", data)
+	}
+
+	// 按时长轮转
+	agePath := filepath.Join(dir, "age.log")
+	file, err = logging.OpenRotatingFile(agePath, 0, 50*time.Millisecond, 0)
+	if err != nil {
+		t.Fatalf("打开日志文件失败: %v", err)
+	}
+	defer file.Close()
+	file.Write([]byte("first\n"))
+	time.Sleep(60 * time.Millisecond)
+	file.Write([]byte("second\n"))
+	if backups, _ := filepath.Glob(filepath.Join(dir, "age-*.log")); len(backups) != 1 {
+		t.Errorf("预期打开超过时长后轮转一次, 得到 %v", backups)
+	}
+	if data, _ := os.ReadFile(agePath); string(data) != "second\n" {
+		t.Errorf("预期轮转后的新文件只包含之后的日志, 得到 %q", data)
+	}
+}
+
+func TestOEE_ReportPerStation(t *testing.T) {
+	_, stateTracker, server := setupTestApp(t, false)
+
+	task := types.Product{ID: "Test_OEE_01", Type: "PCB_PROTOTYPE"}
+	body, _ := json.Marshal(task)
+	resp, err := http.Post(server.URL+"/api/tasks", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("提交任务失败: %v", err)
+	}
+	resp.Body.Close()
+	finished := false
+	for i := 0; i < 20 && !finished; i++ {
+		time.Sleep(100 * time.Millisecond)
+		s, ok := stateTracker.GetProduct(task.ID)
+		finished = ok && (s.Status == "COMPLETED" || s.Status == "COMPENSATED")
+	}
+	if !finished {
+		t.Fatalf("任务 %s 未在规定时间内结束", task.ID)
+	}
+
+	resp, err = http.Get(server.URL + "/api/oee?window=1h")
+	if err != nil {
+		t.Fatalf("查询 OEE 失败: %v", err)
+	}
+	var report oee.Report
+	json.NewDecoder(resp.Body).Decode(&report)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("预期状态码 200, 得到 %d", resp.StatusCode)
+	}
+	var cam *oee.StationOEE
+	for i := range report.Stations {
+		if report.Stations[i].StationID == types.StationCAM {
+			cam = &report.Stations[i]
+		}
+	}
+	if cam == nil {
+		t.Fatalf("OEE 报告中缺少 %s: %+v", types.StationCAM, report)
+	}
+	if cam.Total != 1 || cam.Good != 1 || cam.Quality != 1 || cam.Availability != 1 || cam.Performance <= 0 || cam.OEE <= 0 {
+		t.Errorf("CAM 工站的 OEE 不正确: %+v", *cam)
+	}
+
+	for _, window := range []string{"abc", "-1h", "48h"} {
+		resp, err := http.Get(server.URL + "/api/oee?window=" + window)
+		if err != nil {
+			t.Fatalf("查询 OEE 失败: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("window=%s 预期返回 400, 得到 %d", window, resp.StatusCode)
+		}
+	}
+}
+
+func TestCalendar_ShiftsBreaksAndDowntime(t *testing.T) {
+	cal, err := calendar.New(calendar.Spec{
+		Timezone: "UTC",
+		Shifts: []calendar.Period{
+			{Name: "day", Start: "08:00", End: "20:00", Days: []string{"mon", "tue", "wed", "thu", "fri"}},
+			{Name: "night", Start: "22:00", End: "06:00", Stations: []types.StationID{"station_drill"}},
+		},
+		Breaks:   []calendar.Period{{Name: "lunch", Start: "12:00", End: "12:30"}},
+		Downtime: []calendar.Downtime{{Name: "保养", From: "2026-10-19T14:00:00Z", To: "2026-10-19T16:00:00Z", Stations: []types.StationID{types.StationAOI}}},
+	})
+	if err != nil {
+		t.Fatalf("解析日历失败: %v", err)
+	}
+	at := func(s string) time.Time {
+		v, _ := time.Parse(time.RFC3339, s)
+		return v
+	}
+	// 2026-10-19 是周一
+	cases := []struct {
+		station types.StationID
+		at      string
+		reason  string
+		until   string
+	}{
+		{types.StationCAM, "2026-10-19T07:00:00Z", calendar.ReasonOffShift, "2026-10-19T08:00:00Z"},
+		{types.StationCAM, "2026-10-19T10:00:00Z", "", ""},
+		{types.StationCAM, "2026-10-19T12:10:00Z", calendar.ReasonBreak, "2026-10-19T12:30:00Z"},
+		{types.StationAOI, "2026-10-19T14:30:00Z", calendar.ReasonDowntime, "2026-10-19T16:00:00Z"},
+		{types.StationCAM, "2026-10-19T14:30:00Z", "", ""},
+		{types.StationCAM, "2026-10-23T21:00:00Z", calendar.ReasonOffShift, "2026-10-26T08:00:00Z"},
+		{types.StationDrill, "2026-10-24T23:00:00Z", "", ""},
+		{types.StationDrill, "2026-10-24T07:00:00Z", calendar.ReasonOffShift, "2026-10-24T22:00:00Z"},
+	}
+	for _, c := range cases {
+		w, offline := cal.Status(c.station, at(c.at))
+		if offline != (c.reason != "") || w.Reason != c.reason || (offline && !w.To.Equal(at(c.until))) {
+			t.Errorf("%s 在 %s: 预期离线原因 %q 到 %s, 得到 %v %+v", c.station, c.at, c.reason, c.until, offline, w)
+		}
+	}
+	var off time.Duration
+	for _, w := range cal.Offline(types.StationCAM, at("2026-10-19T00:00:00Z"), at("2026-10-20T00:00:00Z")) {
+		off += w.To.Sub(w.From)
+	}
+	if off != 12*time.Hour+30*time.Minute {
+		t.Errorf("预期周一离线 12.5 小时, 得到 %v", off)
+	}
+
+	_, err = calendar.New(calendar.Spec{
+		Timezone: "Mars/Olympus",
+		Shifts:   []calendar.Period{{Start: "8am", End: "20:00", Days: []string{"someday"}}},
+		Downtime: []calendar.Downtime{{From: "2026-10-19T16:00:00Z", To: "2026-10-19T14:00:00Z"}},
+	})
+	for _, want := range []string{"timezone", "shifts[0].start", "downtime[0].to"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("预期日历错误包含 %s, 得到 %v", want, err)
+		}
+	}
+}
+
+func TestCalendar_PausesDispatchAndPlannedDowntime(t *testing.T) {
+	app := newTestApp(t, false)
+
+	// CAM 工站处于计划停机，工件在停机结束后才开始加工
+	until := time.Now().Add(500 * time.Millisecond)
+	cal, err := calendar.New(calendar.Spec{Downtime: []calendar.Downtime{{
+		Name:     "换线",
+		From:     time.Now().Add(-time.Hour).Format(time.RFC3339Nano),
+		To:       until.Format(time.RFC3339Nano),
+		Stations: []types.StationID{types.StationCAM},
+	}}})
+	if err != nil {
+		t.Fatalf("解析日历失败: %v", err)
+	}
+	app.scheduler.Engine().Stations().SetCalendar(cal)
+	app.scheduler.SubmitTask(&types.Product{ID: "Calendar_01", Type: "PCB_PROTOTYPE"})
+
+	time.Sleep(100 * time.Millisecond)
+	if s, _ := app.stateTracker.GetProduct("Calendar_01"); s.Status == "COMPLETED" {
+		t.Fatal("预期停机期间工件不会完成")
+	}
+	info, _ := app.scheduler.Engine().Stations().Get(types.StationCAM)
+	if info.Offline == nil || info.Offline.Reason != calendar.ReasonDowntime || info.Offline.Name != "换线" {
+		t.Errorf("预期工站信息中标记计划停机, 得到 %+v", info.Offline)
+	}
+	finished := false
+	for i := 0; i < 30 && !finished; i++ {
+		time.Sleep(100 * time.Millisecond)
+		s, ok := app.stateTracker.GetProduct("Calendar_01")
+		finished = ok && s.Status == "COMPLETED"
+	}
+	if !finished {
+		t.Fatal("预期停机结束后工件完成")
+	}
+	if time.Now().Before(until) {
+		t.Error("工件在停机结束前完成")
+	}
+
+	// OEE 将日历中的离线时间计为计划停机，期间的故障不计入故障停机
+	bus := event.NewBus()
+	tracker := oee.NewTracker(time.Second, nil, 24*time.Hour, metrics.New(metrics.NewRegistry()))
+	tracker.Register(bus)
+	base := time.Now()
+	cal, err = calendar.New(calendar.Spec{Downtime: []calendar.Downtime{{
+		From:     base.Add(60 * time.Minute).Format(time.RFC3339Nano),
+		To:       base.Add(120 * time.Minute).Format(time.RFC3339Nano),
+		Stations: []types.StationID{types.StationDrill},
+	}}})
+	if err != nil {
+		t.Fatalf("解析日历失败: %v", err)
+	}
+	tracker.SetCalendar(cal)
+	bus.Publish(event.Event{Type: event.StationStatusChanged, StationID: types.StationDrill, Seq: 1, Timestamp: base.Add(30 * time.Minute), ToState: string(fsm.StationDown)})
+	bus.Publish(event.Event{Type: event.StationStatusChanged, StationID: types.StationDrill, Seq: 2, Timestamp: base.Add(90 * time.Minute), ToState: string(fsm.StationIdle)})
+	time.Sleep(50 * time.Millisecond)
+	report, _ := tracker.Report(4*time.Hour, base.Add(3*time.Hour))
+	if len(report.Stations) != 1 {
+		t.Fatalf("预期一个工站的 OEE, 得到 %+v", report.Stations)
+	}
+	drill := report.Stations[0]
+	near := func(got, want float64) bool { return math.Abs(got-want) < 1 }
+	if !near(drill.PlannedDowntimeSeconds, 3600) || !near(drill.DowntimeSeconds, 1800) || !near(drill.PlannedSeconds, 7200) || math.Abs(drill.Availability-0.75) > 0.001 {
+		t.Errorf("预期计划停机 1h、故障停机 30m、可用率 0.75, 得到 %+v", drill)
+	}
+}
+
+func TestOEE_FirstPassYieldAndScrap(t *testing.T) {
+	bus := event.NewBus()
+	m := metrics.New(metrics.NewRegistry())
+	tracker := oee.NewTracker(time.Second, nil, 24*time.Hour, m)
+	tracker.Register(bus)
+
+	products := make(map[string]*types.Product)
+	product := func(id, retryOf string) *types.Product {
+		p := &types.Product{ID: id, Type: "PCB_DOUBLE_LAYER", RetryOf: retryOf, Attrs: map[string]interface{}{"duration": 1.0}}
+		products[id] = p
+		return p
+	}
+	// 处理器是异步执行的，逐个等待以保证谱系中的加工按顺序记录
+	publish := func(e event.Event) {
+		e.ProductID = e.Product.ID
+		e.Timestamp = time.Now()
+		bus.Publish(e)
+		time.Sleep(5 * time.Millisecond)
+	}
+	step := func(id string, station types.StationID, good bool) {
+		var err error
+		if !good {
+			err = errors.New("加工失败")
+		}
+		publish(event.Event{Type: event.StepCompleted, Product: products[id], StationID: station, Error: err})
+	}
+	finish := func(id string, good bool) {
+		if good {
+			publish(event.Event{Type: event.ProductCompleted, Product: products[id]})
+		} else {
+			publish(event.Event{Type: event.ProductFailed, Product: products[id], Error: errors.New("加工失败")})
+		}
+	}
+
+	// A 在钻孔失败，重试 A_R 再次经过 CAM (返工) 后完成
+	product("A", "")
+	step("A", types.StationCAM, true)
+	step("A", types.StationDrill, false)
+	finish("A", false)
+	product("A_R", "A")
+	step("A_R", types.StationCAM, true)
+	step("A_R", types.StationDrill, true)
+	finish("A_R", true)
+	// B 一次通过
+	product("B", "")
+	step("B", types.StationCAM, true)
+	step("B", types.StationDrill, true)
+	finish("B", true)
+	// C 在 CAM 失败，第一次重试仍然失败，对重试的重试才完成，三次都属于 C 的谱系
+	product("C", "")
+	step("C", types.StationCAM, false)
+	finish("C", false)
+	product("C_R1", "C")
+	step("C_R1", types.StationCAM, false)
+	finish("C_R1", false)
+	product("C_R2", "C_R1")
+	step("C_R2", types.StationCAM, true)
+	finish("C_R2", true)
+	time.Sleep(20 * time.Millisecond)
+
+	report, err := tracker.Report(time.Hour, time.Now())
+	if err != nil {
+		t.Fatalf("生成 OEE 报告失败: %v", err)
+	}
+	stations := make(map[types.StationID]oee.StationOEE)
+	for _, s := range report.Stations {
+		stations[s.StationID] = s
+	}
+	if cam := stations[types.StationCAM]; cam.FirstPass != 3 || cam.FirstPassGood != 2 || cam.Rework != 3 || math.Abs(cam.FirstPassYield-2.0/3) > 1e-9 {
+		t.Errorf("CAM 工站的直通率不正确: %+v", cam)
+	}
+	if drill := stations[types.StationDrill]; drill.FirstPass != 2 || drill.FirstPassGood != 1 || drill.Rework != 1 || drill.FirstPassYield != 0.5 {
+		t.Errorf("钻孔工站的直通率不正确: %+v", drill)
+	}
+	want := oee.ProductYield{Type: "PCB_DOUBLE_LAYER", FirstPassYield: 1.0 / 3, FirstPass: 3, FirstPassGood: 1, ReworkGood: 2, Scrap: 3}
+	if len(report.Products) != 1 || report.Products[0] != want {
+		t.Errorf("预期产品直通率 %+v, 得到 %+v", want, report.Products)
+	}
+
+	families, _ := m.Registry().Gather()
+	var scrap float64
+	for _, f := range families {
+		if f.GetName() == "scrap_total" {
+			for _, metric := range f.GetMetric() {
+				scrap += metric.GetCounter().GetValue()
+			}
+		}
+	}
+	if scrap != 3 {
+		t.Errorf("预期 scrap_total 为 3, 得到 %v", scrap)
+	}
+}
+
+func TestAnomaly_FlagsStepDurationBeyondZScore(t *testing.T) {
+	bus := event.NewBus()
+	m := metrics.New(metrics.NewRegistry())
+	anomaly.NewDetector(0.2, 3, 10, m).Register(bus)
+	anomalies := make(chan event.Event, 10)
+	bus.Subscribe(event.StationAnomaly, func(e event.Event) { anomalies <- e })
+
+	step := func(id string, duration float64) {
+		p := &types.Product{ID: id, Type: "PCB_DOUBLE_LAYER", Attrs: map[string]interface{}{"duration": duration}}
+		bus.Publish(event.Event{Type: event.StepCompleted, ProductID: id, Product: p, StationID: types.StationDrill})
+		// 处理器是异步执行的，逐个等待以保证样本按顺序进入基线
+		time.Sleep(2 * time.Millisecond)
+	}
+	// 基线约为 1 秒，波动 ±0.05 秒
+	for i := range 30 {
+		step(fmt.Sprintf("P%02d", i), 1+0.05*float64(i%3-1))
+	}
+	select {
+	case e := <-anomalies:
+		t.Fatalf("基线内的波动不应判定为异常, 得到 %+v", e.Anomaly)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	step("P_SLOW", 1.5)
+	select {
+	case e := <-anomalies:
+		if e.StationID != types.StationDrill || e.ProductID != "P_SLOW" {
+			t.Errorf("预期 STATION_DRILL 上的工件 P_SLOW, 得到 %s %s", e.StationID, e.ProductID)
+		}
+		if e.Anomaly.DurationSeconds != 1.5 || e.Anomaly.ZScore < 3 || math.Abs(e.Anomaly.MeanSeconds-1) > 0.05 {
+			t.Errorf("异常信息不符: %+v", e.Anomaly)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("未检测到耗时异常")
+	}
+
+	families, _ := m.Registry().Gather()
+	var slow float64
+	for _, f := range families {
+		if f.GetName() == "station_anomalies_total" {
+			for _, metric := range f.GetMetric() {
+				slow += metric.GetCounter().GetValue()
+			}
+		}
+	}
+	if slow != 1 {
+		t.Errorf("预期 station_anomalies_total 为 1, 得到 %v", slow)
+	}
+}
+
+func TestMaintenance_RulesRaiseWorkOrders(t *testing.T) {
+	app := newTestApp(t, false)
+	app.maintenance.SetRules([]maintenance.Rule{
+		{Name: "etest_failures", Stations: []types.StationID{types.StationETest}, Window: time.Minute, FailureRate: 0.5, MinSteps: 2, Maintenance: true},
+		{Name: "drill_drift", Stations: []types.StationID{types.StationDrill}, Window: time.Minute, Anomalies: 2},
+	})
+	due := make(chan event.Event, 4)
+	app.bus.Subscribe(event.MaintenanceDue, func(e event.Event) { due <- e })
+
+	listOrders := func(query string) []maintenance.WorkOrder {
+		t.Helper()
+		resp, err := http.Get(app.server.URL + "/api/maintenance/work-orders" + query)
+		if err != nil {
+			t.Fatalf("查询维护工单失败: %v", err)
+		}
+		defer resp.Body.Close()
+		var orders []maintenance.WorkOrder
+		json.NewDecoder(resp.Body).Decode(&orders)
+		return orders
+	}
+	waitDue := func() event.Event {
+		t.Helper()
+		select {
+		case e := <-due:
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("超时未收到 MaintenanceDue 事件")
+		}
+		return event.Event{}
+	}
+
+	// 电测连续失败两次，失败率达到 50% 且步骤数达到 2，创建工单并让电测进入维护模式
+	stations := app.scheduler.Engine().Stations()
+	stations.InjectFailures(types.StationETest, 2)
+	for _, id := range []string{"CBM_01", "CBM_02"} {
+		app.scheduler.SubmitTask(&types.Product{ID: id, Type: "PCB_PROTOTYPE", Attrs: map[string]interface{}{}})
+	}
+	if e := waitDue(); e.StationID != types.StationETest || e.WorkOrder.Reason != maintenance.ReasonFailureRate || !e.WorkOrder.Maintenance {
+		t.Fatalf("电测的维护事件错误: %s %+v", e.StationID, e.WorkOrder)
+	}
+	if info, _ := stations.Get(types.StationETest); info.Enabled {
+		t.Error("触发维护规则后电测应进入维护模式")
+	}
+
+	// 钻孔的两次耗时异常触发漂移规则，证据中附带异常的工件
+	for _, id := range []string{"SLOW_01", "SLOW_02"} {
+		app.bus.Publish(event.Event{Type: event.StationAnomaly, ProductID: id, StationID: types.StationDrill,
+			Anomaly: &event.Anomaly{DurationSeconds: 1.6, MeanSeconds: 1, StdDevSeconds: 0.1, ZScore: 6}})
+		time.Sleep(5 * time.Millisecond)
+	}
+	if e := waitDue(); e.StationID != types.StationDrill || e.WorkOrder.Reason != maintenance.ReasonDrift {
+		t.Fatalf("钻孔的维护事件错误: %s %+v", e.StationID, e.WorkOrder)
+	}
+
+	orders := listOrders("?status=open")
+	if len(orders) != 2 {
+		t.Fatalf("预期 2 张未关闭的工单, 得到 %+v", orders)
+	}
+	etest, drill := orders[0], orders[1]
+	if etest.Evidence.Steps != 2 || etest.Evidence.FailedSteps != 2 || len(etest.Evidence.FailedProducts) != 2 {
+		t.Errorf("失败率工单的证据错误: %+v", etest.Evidence)
+	}
+	if len(drill.Evidence.Anomalies) != 2 || drill.Evidence.Anomalies[1].ProductID != "SLOW_02" {
+		t.Errorf("漂移工单的证据错误: %+v", drill.Evidence)
+	}
+	alerts := app.stateTracker.Alerts()
+	if !slices.ContainsFunc(alerts, func(a web.Alert) bool { return a.Kind == web.AlertMaintenanceDue && a.StationID == types.StationETest }) {
+		t.Error("创建工单时应在安灯板上告警")
+	}
+
+	// 关闭工单后电测重新启用，再次关闭返回 409
+	closeOrder := func(id string) int {
+		t.Helper()
+		resp, err := http.Post(app.server.URL+"/api/maintenance/work-orders/"+id+"/close", "application/json", strings.NewReader(`{"note": "更换探针"}`))
+		if err != nil {
+			t.Fatalf("关闭维护工单失败: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := closeOrder(etest.ID); code != http.StatusOK {
+		t.Fatalf("关闭工单应返回 200, 得到 %d", code)
+	}
+	if info, _ := stations.Get(types.StationETest); !info.Enabled {
+		t.Error("关闭工单后电测应重新启用")
+	}
+	if code := closeOrder(etest.ID); code != http.StatusConflict {
+		t.Errorf("重复关闭应返回 409, 得到 %d", code)
+	}
+	if code := closeOrder("WO-9999"); code != http.StatusNotFound {
+		t.Errorf("不存在的工单应返回 404, 得到 %d", code)
+	}
+	if orders := listOrders("?status=closed"); len(orders) != 1 || orders[0].Note != "更换探针" {
+		t.Errorf("预期 1 张已关闭的工单, 得到 %+v", orders)
+	}
+}
+
+func TestOperators_SkillsAndShifts(t *testing.T) {
+	app := newTestApp(t, false)
+	// 夜班从两小时后开始，只用于判断操作员是否在岗，不影响工站的在线状态
+	now := time.Now().UTC()
+	cal, err := calendar.New(calendar.Spec{
+		Timezone: "UTC",
+		Shifts:   []calendar.Period{{Name: "night", Start: now.Add(2 * time.Hour).Format("15:04"), End: now.Add(3 * time.Hour).Format("15:04")}},
+	})
+	if err != nil {
+		t.Fatalf("解析日历失败: %v", err)
+	}
+	pool := engine.NewOperatorPool([]engine.Operator{
+		{ID: "OP_DAY", Name: "张工", Skills: []string{"etest"}},
+		{ID: "OP_NIGHT", Name: "李工", Skills: []string{"etest", "drill"}, Shift: "night"},
+	}, map[types.StationID]string{"station_e_test": "etest"}, app.bus)
+	pool.SetCalendar(cal)
+	app.scheduler.Engine().SetOperators(pool)
+
+	// 电测需要认证操作员，夜班的操作员不在岗，所有工件都由白班的操作员加工
+	ids := []string{"OPR_01", "OPR_02"}
+	for _, id := range ids {
+		app.scheduler.SubmitTask(&types.Product{ID: id, Type: "PCB_PROTOTYPE", Attrs: map[string]interface{}{}})
+	}
+	for _, id := range ids {
+		finished := false
+		for i := 0; i < 100 && !finished; i++ {
+			time.Sleep(100 * time.Millisecond)
+			s, ok := app.stateTracker.GetProduct(id)
+			finished = ok && s.Status == "COMPLETED"
+		}
+		if !finished {
+			t.Fatalf("预期工件 %s 完成", id)
+		}
+	}
+
+	resp, err := http.Get(app.server.URL + "/api/operators")
+	if err != nil {
+		t.Fatalf("查询操作员失败: %v", err)
+	}
+	defer resp.Body.Close()
+	var operators []engine.OperatorInfo
+	json.NewDecoder(resp.Body).Decode(&operators)
+	if len(operators) != 2 {
+		t.Fatalf("预期 2 名操作员, 得到 %+v", operators)
+	}
+	day, night := operators[0], operators[1]
+	if day.ID != "OP_DAY" || day.Status != engine.OperatorIdle || day.Assignments != len(ids) || day.BusySeconds <= 0 {
+		t.Errorf("白班操作员的状态错误: %+v", day)
+	}
+	if night.Status != engine.OperatorOffShift || night.Assignments != 0 {
+		t.Errorf("夜班操作员应不在岗且没有分配: %+v", night)
+	}
+
+	// 看板快照中的负荷与操作员池一致，事件处理器是异步的
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		status := app.stateTracker.GetStateSnapshot().Operators["OP_DAY"]
+		if status.Assignments == len(ids) && !status.Busy {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("快照中白班操作员的负荷错误: %+v", status)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestQuality_MeasurementsAndStats(t *testing.T) {
+	app := newTestApp(t, false)
+	drill := station.NewStation(types.StationDrill, app.logger, 1, 0)
+	drill.SetMeasurements([]types.MeasurementSpec{
+		{Name: "hole_diameter", Unit: "mm", Nominal: 0.3, LSL: 0.25, USL: 0.35},
+		{Name: "position_offset", Unit: "um", Nominal: 0, LSL: -50, USL: 50},
+	})
+	app.scheduler.Engine().RegisterStation(drill)
+
+	getJSON := func(path string, v any) int {
+		t.Helper()
+		resp, err := http.Get(app.server.URL + path)
+		if err != nil {
+			t.Fatalf("请求 %s 失败: %v", path, err)
+		}
+		defer resp.Body.Close()
+		json.NewDecoder(resp.Body).Decode(v)
+		return resp.StatusCode
+	}
+
+	ids := []string{"QM_01", "QM_02", "QM_03"}
+	for _, id := range ids {
+		app.scheduler.SubmitTask(&types.Product{ID: id, Type: "PCB_PROTOTYPE", Attrs: map[string]interface{}{}})
+	}
+	for _, id := range ids {
+		finished := false
+		for i := 0; i < 100 && !finished; i++ {
+			time.Sleep(100 * time.Millisecond)
+			s, ok := app.stateTracker.GetProduct(id)
+			finished = ok && s.Status == "COMPLETED"
+		}
+		if !finished {
+			t.Fatalf("预期工件 %s 完成", id)
+		}
+	}
+
+	// 履历按工件和步骤保存钻孔的测量值，其他工站没有配置测量项
+	var product quality.ProductQuality
+	deadline := time.Now().Add(2 * time.Second)
+	for len(product.Steps) == 0 && time.Now().Before(deadline) {
+		getJSON("/api/quality/QM_01", &product)
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(product.Steps) != 1 || product.Steps[0].StationID != types.StationDrill || len(product.Steps[0].Measurements) != 2 {
+		t.Fatalf("工件的测量值错误: %+v", product)
+	}
+	if m := product.Steps[0].Measurements[0]; m.Name != "hole_diameter" || m.Unit != "mm" || *m.LSL != 0.25 || *m.USL != 0.35 {
+		t.Errorf("孔径测量值错误: %+v", m)
+	}
+	if code := getJSON("/api/quality/NOT_EXIST", &product); code != http.StatusNotFound {
+		t.Errorf("不存在的工件应返回 404, 得到 %d", code)
+	}
+
+	// 按工站和测量项汇总 SPC 统计量
+	var stats []quality.Stats
+	for i := 0; i < 100; i++ {
+		getJSON("/api/quality?station=station_drill", &stats)
+		if len(stats) == 2 && stats[0].Count == len(ids) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(stats) != 2 || stats[0].Name != "hole_diameter" || stats[1].Name != "position_offset" {
+		t.Fatalf("钻孔的统计量错误: %+v", stats)
+	}
+	if hole := stats[0]; hole.Count != len(ids) || hole.Min > hole.Mean || hole.Mean > hole.Max || hole.StdDev <= 0 || hole.Cp <= 0 || hole.UCL <= hole.LCL {
+		t.Errorf("孔径的统计量错误: %+v", hole)
+	}
+
+	// 超出规格界限的测量值计入统计和指标，工件的测量结果标记为不合格
+	usl := 40.0
+	app.bus.Publish(event.Event{Type: event.StepCompleted, ProductID: "QM_01", StationID: types.StationETest, Step: 4,
+		Product:      &types.Product{Attrs: map[string]interface{}{}},
+		Measurements: []types.Measurement{{Name: "copper_thickness", Value: 42, Unit: "um", USL: &usl}}})
+	for i := 0; i < 100; i++ {
+		getJSON("/api/quality?station=STATION_E_TEST", &stats)
+		if len(stats) == 1 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(stats) != 1 || stats[0].OutOfSpec != 1 || stats[0].Cpk != 0 {
+		t.Errorf("电测的统计量错误: %+v", stats)
+	}
+	if !strings.Contains(scrapeMetrics(t, app.server.URL), `quality_out_of_spec_total{measurement="copper_thickness",namespace="",station_id="STATION_E_TEST"} 1`) {
+		t.Error("预期超出规格的测量值计入 quality_out_of_spec_total")
+	}
+	getJSON("/api/quality/QM_01", &product)
+	if product.InSpec || len(product.Steps) != 2 {
+		t.Errorf("工件应有不合格的测量值: %+v", product)
+	}
+}
+
+func TestDefects_ClassificationAndPareto(t *testing.T) {
+	app := newTestApp(t, false)
+	stations := app.scheduler.Engine().Stations()
+	stations.InjectFailures(types.StationDrill, 1)
+	stations.InjectFailures(types.StationETest, 2)
+
+	// 一个工件在钻孔失败，另外两个在电测失败
+	ids := []string{"DEF_01", "DEF_02", "DEF_03"}
+	for _, id := range ids {
+		app.scheduler.SubmitTask(&types.Product{ID: id, Type: "PCB_PROTOTYPE", Attrs: map[string]interface{}{}})
+	}
+	for _, id := range ids {
+		finished := false
+		for i := 0; i < 100 && !finished; i++ {
+			time.Sleep(100 * time.Millisecond)
+			s, ok := app.stateTracker.GetProduct(id)
+			finished = ok && s.Status == "COMPENSATED"
+		}
+		if !finished {
+			t.Fatalf("预期工件 %s 补偿完成", id)
+		}
+	}
+
+	getSummary := func(query string) (defect.Summary, int) {
+		t.Helper()
+		resp, err := http.Get(app.server.URL + "/api/defects/summary" + query)
+		if err != nil {
+			t.Fatalf("查询缺陷汇总失败: %v", err)
+		}
+		defer resp.Body.Close()
+		var summary defect.Summary
+		json.NewDecoder(resp.Body).Decode(&summary)
+		return summary, resp.StatusCode
+	}
+	summary, _ := getSummary("")
+	if summary.Total != 3 || len(summary.Codes) != 2 || len(summary.Categories) != 2 {
+		t.Fatalf("缺陷汇总错误: %+v", summary)
+	}
+	// 帕累托数据按次数从高到低排列，累计比例最终为 1
+	top, second := summary.Codes[0], summary.Codes[1]
+	if top.Code != "ET-OPEN" || top.Category != defect.CategoryElectrical || top.Count != 2 || top.Disposition != types.DispositionScrap {
+		t.Errorf("最多的缺陷应为电测开路: %+v", top)
+	}
+	if second.Code != "DR-MISSING" || second.Count != 1 || second.Cumulative != 1 {
+		t.Errorf("第二位的缺陷应为漏钻孔: %+v", second)
+	}
+	if summary.Categories[0].Category != defect.CategoryElectrical || summary.Dispositions[types.DispositionScrap] != 2 || summary.Dispositions[types.DispositionRework] != 1 {
+		t.Errorf("缺陷类别或处置方式统计错误: %+v", summary)
+	}
+	if drill, _ := getSummary("?station=station_drill"); drill.Total != 1 || drill.Codes[0].Code != "DR-MISSING" {
+		t.Errorf("按工站过滤的缺陷汇总错误: %+v", drill)
+	}
+	if _, code := getSummary("?window=48h"); code != http.StatusBadRequest {
+		t.Errorf("超过保留时长的窗口应返回 400, 得到 %d", code)
+	}
+
+	// 履历中失败的步骤记录结构化的缺陷，指标按缺陷类别统计
+	etest := 0
+	for _, id := range ids {
+		record, _ := app.history.Get(id)
+		for _, step := range record.Steps {
+			if !step.Success && (step.Defect == nil || step.Defect.Code == "") {
+				t.Errorf("工件 %s 失败的步骤缺少缺陷: %+v", id, step)
+			}
+			if step.Defect != nil && step.Defect.Category == defect.CategoryElectrical {
+				etest++
+			}
+		}
+	}
+	if etest != 2 {
+		t.Errorf("预期 2 个电测缺陷记录在履历中, 得到 %d", etest)
+	}
+	if body := scrapeMetrics(t, app.server.URL); !strings.Contains(body, `defects_total{category="electrical",disposition="scrap",namespace="default",station_id="STATION_E_TEST"} 2`) {
+		t.Error("预期 defects_total 按缺陷类别统计电测缺陷")
+	}
+}
+
+func TestTraceability_GenealogyDocument(t *testing.T) {
+	app := newTestApp(t, false)
+	wf := app.scheduler.Engine()
+	drill := station.NewStation(types.StationDrill, app.logger, 1, 0)
+	drill.SetMeasurements([]types.MeasurementSpec{{Name: "hole_diameter", Unit: "mm", Nominal: 0.3, LSL: 0.25, USL: 0.35}})
+	drill.SetProvenance(types.Provenance{Machine: "DRL-02", Firmware: "drill-ctl 4.1.7", Materials: []types.MaterialUsage{{Name: "drill_bit", Lot: "DB-1", Quantity: 0.5, Unit: "pcs"}}})
+	wf.RegisterStation(drill)
+	wf.SetOperators(engine.NewOperatorPool([]engine.Operator{{ID: "OP_1", Name: "王工", Skills: []string{"drill"}}},
+		map[types.StationID]string{types.StationDrill: "drill"}, app.bus))
+
+	// 远程蚀刻线在响应中返回设备和物料，固件使用配置中声明的版本
+	etchServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":   true,
+			"machine":   "ETCH-R1",
+			"materials": []map[string]interface{}{{"name": "etchant", "quantity": 0.15, "unit": "L"}},
+		})
+	}))
+	defer etchServer.Close()
+	etch := station.NewRemoteStation(types.StationEtch, etchServer.URL, station.RemoteOptions{}, app.logger)
+	etch.SetProvenance(types.Provenance{Firmware: "etch-plc 2.0"})
+	wf.RegisterStation(etch)
+
+	app.scheduler.SubmitTask(&types.Product{ID: "TRC_01", Type: "PCB_PROTOTYPE", Lot: "LOT_TRC", Attrs: map[string]interface{}{}})
+	finished := false
+	for i := 0; i < 100 && !finished; i++ {
+		time.Sleep(100 * time.Millisecond)
+		s, ok := app.stateTracker.GetProduct("TRC_01")
+		finished = ok && s.Status == "COMPLETED"
+	}
+	if !finished {
+		t.Fatal("预期工件 TRC_01 完成")
+	}
+
+	get := func(query string) (*http.Response, []byte) {
+		t.Helper()
+		resp, err := http.Get(app.server.URL + "/api/tasks/TRC_01/traceability" + query)
+		if err != nil {
+			t.Fatalf("请求追溯文档失败: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, body
+	}
+	// 履历由异步的事件处理器写入，等待所有步骤的结果
+	var doc traceability.Document
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		_, body := get("")
+		doc = traceability.Document{}
+		json.Unmarshal(body, &doc)
+		done := doc.Outcome == "COMPLETED" && len(doc.Steps) > 0
+		for _, s := range doc.Steps {
+			done = done && !s.FinishedAt.IsZero()
+		}
+		if done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("追溯文档不完整: %+v", doc)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if doc.Lot != "LOT_TRC" || doc.Type != "PCB_PROTOTYPE" {
+		t.Errorf("追溯文档的工件信息错误: %+v", doc)
+	}
+	var drillStep, etchStep *traceability.Step
+	for i, s := range doc.Steps {
+		switch s.StationID {
+		case types.StationDrill:
+			drillStep = &doc.Steps[i]
+		case types.StationEtch:
+			etchStep = &doc.Steps[i]
+		default:
+			if s.Machine != string(s.StationID) || s.Operator != "" {
+				t.Errorf("未配置追溯信息的本地工站应以工站 ID 作为设备实例: %+v", s)
+			}
+		}
+	}
+	if drillStep == nil || etchStep == nil {
+		t.Fatalf("追溯文档缺少钻孔或蚀刻步骤: %+v", doc.Steps)
+	}
+	if drillStep.Machine != "DRL-02" || drillStep.Firmware != "drill-ctl 4.1.7" || drillStep.Operator != "OP_1" || drillStep.OperatorName != "王工" ||
+		len(drillStep.Measurements) != 1 || drillStep.Measurements[0].Name != "hole_diameter" || len(drillStep.Materials) != 1 {
+		t.Errorf("钻孔步骤的追溯信息错误: %+v", drillStep)
+	}
+	if etchStep.Machine != "ETCH-R1" || etchStep.Firmware != "etch-plc 2.0" || len(etchStep.Materials) != 1 || etchStep.StartedAt.IsZero() {
+		t.Errorf("蚀刻步骤的追溯信息错误: %+v", etchStep)
+	}
+	if len(doc.Materials) != 2 || doc.Materials[0].Name != "drill_bit" || doc.Materials[1].Name != "etchant" {
+		t.Errorf("物料汇总错误: %+v", doc.Materials)
+	}
+
+	// CSV 每个步骤一行，PDF 是完整的文档
+	resp, body := get("?format=csv")
+	rows, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+	if err != nil || resp.Header.Get("Content-Type") != "text/csv; charset=utf-8" || len(rows) != len(doc.Steps)+1 || rows[0][0] != "product_id" {
+		t.Errorf("CSV 导出错误 (%v): %q", err, body)
+	}
+	resp, body = get("?format=pdf")
+	if resp.Header.Get("Content-Type") != "application/pdf" || !bytes.HasPrefix(body, []byte("%PDF-")) || !bytes.HasSuffix(body, []byte("%%EOF\n")) {
+		t.Errorf("PDF 导出错误: %s", resp.Header.Get("Content-Type"))
+	}
+	if resp, _ := get("?format=xml"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("未知的导出格式应返回 400, 得到 %d", resp.StatusCode)
+	}
+	resp, err = http.Get(app.server.URL + "/api/tasks/NOT_EXIST/traceability")
+	if err != nil {
+		t.Fatalf("请求追溯文档失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("不存在的工件应返回 404, 得到 %d", resp.StatusCode)
+	}
+}
+
+func TestSLA_PredictedBreachAndOnTimeDelivery(t *testing.T) {
+	// 预测：两个步骤各估计 1 小时，10 分钟后到期的工件在入队时即预测延期，到期后仍未完成则违约
+	m := metrics.New(metrics.NewRegistry())
+	bus := event.NewBus()
+	routes := func(string) []types.WorkflowStep {
+		return []types.WorkflowStep{{StationIDs: []types.StationID{types.StationCAM}}, {StationIDs: []types.StationID{types.StationDrill}}}
+	}
+	tracker := sla.NewTracker(routes, sla.Estimates{Step: time.Hour, Due: map[string]time.Duration{"pcb_slow": time.Minute}}, time.Hour, m)
+	tracker.Register(bus)
+	events := make(chan event.Event, 4)
+	for _, typ := range []event.EventType{event.SLABreachPredicted, event.SLABreached} {
+		bus.Subscribe(typ, func(e event.Event) { events <- e })
+	}
+	next := func() event.Event {
+		t.Helper()
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(2 * time.Second):
+			t.Fatal("等待 SLA 事件超时")
+			return event.Event{}
+		}
+	}
+
+	now := time.Now()
+	bus.Publish(event.Event{Type: event.ProductQueued, ProductID: "SLA_1", Product: &types.Product{ID: "SLA_1", Type: "PCB_X", DueAt: now.Add(10 * time.Minute)}, Timestamp: now})
+	e := next()
+	if e.Type != event.SLABreachPredicted || e.ProductID != "SLA_1" || e.SLA.ProjectedAt.Sub(now) != 2*time.Hour {
+		t.Fatalf("预期预测延期 2 小时后完工, 得到 %s %+v", e.Type, e.SLA)
+	}
+	tracker.Check(now.Add(11 * time.Minute))
+	if e := next(); e.Type != event.SLABreached || e.ProductID != "SLA_1" {
+		t.Fatalf("预期交期违约事件, 得到 %s", e.Type)
+	}
+	// 未指定交期的工件按产品类型的默认交期跟踪
+	bus.Publish(event.Event{Type: event.ProductQueued, ProductID: "SLA_2", Product: &types.Product{ID: "SLA_2", Type: "PCB_SLOW"}, Timestamp: now})
+	if e := next(); e.Type != event.SLABreachPredicted || !e.SLA.DueAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("预期按默认交期预测延期, 得到 %s %+v", e.Type, e.SLA)
+	}
+	report, err := tracker.Report(time.Hour, now.Add(11*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.AtRisk) != 2 || report.AtRisk[0].ProductID != "SLA_2" || !report.AtRisk[1].Breached {
+		t.Errorf("预期 2 个有风险的工件且按交期排序, 得到 %+v", report.AtRisk)
+	}
+	if got := testutil.ToFloat64(m.SLABreachesTotal.WithLabelValues("PCB_X", "breached", "")); got != 1 {
+		t.Errorf("预期 1 次交期违约, 得到 %v", got)
+	}
+	if _, err := tracker.Report(2*time.Hour, now); !errors.Is(err, windowed.ErrTooLarge) {
+		t.Errorf("窗口超过保留时长应返回 ErrTooLarge, 得到 %v", err)
+	}
+
+	// 端到端：一个工件按期完成，另一个提交时已超过交期，准时交付率为 50%
+	app := newTestApp(t, false)
+	app.scheduler.SubmitTask(&types.Product{ID: "SLA_ON_TIME", Type: "PCB_PROTOTYPE", DueAt: time.Now().Add(time.Hour), Attrs: map[string]interface{}{}})
+	app.scheduler.SubmitTask(&types.Product{ID: "SLA_LATE", Type: "PCB_PROTOTYPE", DueAt: time.Now().Add(-time.Second), Attrs: map[string]interface{}{}})
+	var delivery sla.Report
+	for i := 0; i < 100 && delivery.Delivered < 2; i++ {
+		time.Sleep(100 * time.Millisecond)
+		resp, err := http.Get(app.server.URL + "/api/v1/sla")
+		if err != nil {
+			t.Fatalf("查询准时交付报告失败: %v", err)
+		}
+		delivery = sla.Report{}
+		json.NewDecoder(resp.Body).Decode(&delivery)
+		resp.Body.Close()
+	}
+	if delivery.Delivered != 2 || delivery.OnTime != 1 || delivery.OnTimeRatio != 0.5 || len(delivery.AtRisk) != 0 {
+		t.Errorf("预期交付 2 个、按期 1 个, 得到 %+v", delivery)
+	}
+	alerts := app.stateTracker.GetStateSnapshot().Alerts
+	if !slices.ContainsFunc(alerts, func(a web.Alert) bool { return a.Kind == web.AlertSLABreached && a.ProductID == "SLA_LATE" }) {
+		t.Errorf("预期 SLA_LATE 产生 sla_breached 告警, 得到 %+v", alerts)
+	}
+}
+
+func TestCosting_PerProductRollup(t *testing.T) {
+	model, err := costing.New(costing.Spec{
+		EnergyPrice:    0.8,
+		PowerKW:        map[types.StationID]float64{"station_drill": 3600, types.StationETest: 1800},
+		MaterialPrices: []costing.MaterialPrice{{Name: "Drill_Bit", Price: 50}},
+		LaborRate:      36,
+		OperatorRates:  map[string]float64{"op_senior": 72},
+	})
+	if err != nil {
+		t.Fatalf("创建成本模型失败: %v", err)
+	}
+	// 3600 kW 加工 1 秒耗电 1 kWh；物料只计成功的加工；操作员按各自的费率计人工费
+	provenance := types.Provenance{Operator: "OP_SENIOR", Materials: []types.MaterialUsage{{Name: "drill_bit", Quantity: 0.01, Unit: "pcs"}}}
+	c := model.Step(types.StationDrill, time.Second, true, provenance)
+	if c.Currency != costing.DefaultCurrency || c.EnergyKWh != 1 || c.Energy != 0.8 || c.Material != 0.5 || c.LaborSeconds != 1 || c.Labor != 0.02 || c.Total != 1.32 {
+		t.Errorf("成功加工的成本错误: %+v", c)
+	}
+	if c := model.Step(types.StationDrill, time.Second, false, types.Provenance{Operator: "OP_2", Materials: provenance.Materials}); c.Material != 0 || c.Labor != 0.01 || c.Total != 0.81 {
+		t.Errorf("失败加工不应计物料费: %+v", c)
+	}
+	for _, spec := range []costing.Spec{{EnergyPrice: -1}, {PowerKW: map[types.StationID]float64{"X": -1}}, {MaterialPrices: []costing.MaterialPrice{{Name: "x", Price: -1}}}} {
+		if _, err := costing.New(spec); err == nil {
+			t.Errorf("负数参数应被拒绝: %+v", spec)
+		}
+	}
+
+	app := newTestApp(t, false)
+	app.scheduler.Engine().SetCosting(model)
+	app.scheduler.SubmitTask(&types.Product{ID: "COST_01", Type: "PCB_PROTOTYPE", Attrs: map[string]interface{}{}})
+	var detail api.TaskDetail
+	for i := 0; i < 100; i++ {
+		time.Sleep(100 * time.Millisecond)
+		resp, err := http.Get(app.server.URL + "/api/tasks/COST_01")
+		if err != nil {
+			t.Fatalf("查询任务详情失败: %v", err)
+		}
+		detail = api.TaskDetail{}
+		json.NewDecoder(resp.Body).Decode(&detail)
+		resp.Body.Close()
+		if detail.Status == "COMPLETED" && detail.History != nil && detail.History.Outcome == "COMPLETED" {
+			break
+		}
+	}
+	if detail.History == nil || detail.Cost == nil {
+		t.Fatalf("预期任务详情包含成本汇总: %+v", detail)
+	}
+	// 汇总等于各步骤成本之和，只有配置了功率的工站计能耗
+	var total, energy float64
+	for _, s := range detail.History.Steps {
+		if s.Cost == nil {
+			t.Fatalf("步骤 %d (%s) 缺少成本", s.Step, s.StationID)
+		}
+		if s.StationID != types.StationDrill && s.StationID != types.StationETest && s.Cost.EnergyKWh != 0 {
+			t.Errorf("未配置功率的工站不应计能耗: %s %+v", s.StationID, s.Cost)
+		}
+		total += s.Cost.Total
+		energy += s.Cost.Energy
+	}
+	if math.Abs(detail.Cost.Total-total) > 1e-5 || math.Abs(detail.Cost.Energy-energy) > 1e-5 || detail.Cost.Total <= 0 {
+		t.Errorf("成本汇总 %+v 与步骤之和 (total=%v, energy=%v) 不一致", detail.Cost, total, energy)
+	}
+	if detail.Cost.Currency != costing.DefaultCurrency {
+		t.Errorf("预期货币为 %s, 得到 %q", costing.DefaultCurrency, detail.Cost.Currency)
+	}
+}
+
+func TestSerial_AssignmentAndLabel(t *testing.T) {
+	app := newTestApp(t, false)
+	gen, err := serial.New(serial.Spec{Format: "{line}-{date:060102}-{seq:3}", Lines: map[string]string{"default": "L1"}})
+	if err != nil {
+		t.Fatalf("解析序列号格式失败: %v", err)
+	}
+	app.scheduler.Engine().SetSerials(gen)
+
+	ids := []string{"SN_01", "SN_02"}
+	for _, id := range ids {
+		app.scheduler.SubmitTask(&types.Product{ID: id, Type: "PCB_PROTOTYPE", Lot: "LOT_SN", Attrs: map[string]interface{}{}})
+	}
+	for _, id := range ids {
+		finished := false
+		for i := 0; i < 100 && !finished; i++ {
+			time.Sleep(100 * time.Millisecond)
+			s, ok := app.stateTracker.GetProduct(id)
+			finished = ok && s.Status == "COMPLETED"
+		}
+		if !finished {
+			t.Fatalf("预期工件 %s 完成", id)
+		}
+	}
+
+	// 同一产线同一天的工件按开始顺序编号
+	prefix := "L1-" + time.Now().Format("060102") + "-"
+	var serials []string
+	for _, id := range ids {
+		record, _ := app.history.Get(id)
+		serials = append(serials, record.Serial)
+	}
+	slices.Sort(serials)
+	if !slices.Equal(serials, []string{prefix + "001", prefix + "002"}) {
+		t.Fatalf("序列号错误: %v", serials)
+	}
+
+	resp, err := http.Get(app.server.URL + "/api/tasks/SN_01/label")
+	if err != nil {
+		t.Fatalf("请求标签失败: %v", err)
+	}
+	var label serial.Label
+	json.NewDecoder(resp.Body).Decode(&label)
+	resp.Body.Close()
+	record, _ := app.history.Get("SN_01")
+	if label.Serial != record.Serial || label.Barcode.Data != record.Serial || label.Barcode.Symbology != "code128" {
+		t.Errorf("标签的条码内容错误: %+v", label)
+	}
+	if want := "(21)" + record.Serial + "(240)PCB_PROTOTYPE(10)LOT_SN"; label.QR.Text != want || label.QR.Data != "21"+record.Serial+"\x1d240PCB_PROTOTYPE\x1d10LOT_SN" {
+		t.Errorf("标签的二维码内容错误: %+v", label.QR)
+	}
+
+	resp, err = http.Get(app.server.URL + "/api/tasks/SN_01/label?format=svg")
+	if err != nil {
+		t.Fatalf("请求条码图片失败: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "image/svg+xml" || !bytes.HasPrefix(body, []byte("<svg")) || !bytes.Contains(body, []byte(record.Serial)) {
+		t.Errorf("条码图片错误: %s", body)
+	}
+	resp, err = http.Get(app.server.URL + "/api/tasks/NOT_EXIST/label")
+	if err != nil {
+		t.Fatalf("请求标签失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("不存在的工件应返回 404, 得到 %d", resp.StatusCode)
+	}
+
+	// Code 128 的校验符按加权和对 103 取模：PJJ123C 的校验值为 55
+	modules, err := serial.Code128Modules("PJJ123C")
+	if err != nil || !strings.HasPrefix(modules, "211214") || !strings.HasSuffix(modules, "311321"+"2331112") || len(modules) != 9*6+7 {
+		t.Errorf("Code 128 编码错误 (%v): %s", err, modules)
+	}
+	for _, format := range []string{"{line}-{date}", "{seq}{seq}", "{serial}-{seq}", "{seq:20}"} {
+		if _, err := serial.New(serial.Spec{Format: format}); err == nil {
+			t.Errorf("格式 %q 应被拒绝", format)
+		}
+	}
+}
+
+func TestRemoteStation_RetryTimeoutAuthAndTLS(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	product := &types.Product{ID: "P1"}
+
+	// 网关类错误按重试策略重试，每次都携带凭证
+	var calls atomic.Int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer station-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+	}))
+	defer flaky.Close()
+	opts := station.RemoteOptions{MaxAttempts: 3, Backoff: time.Millisecond, BearerToken: "station-token"}
+	if res := station.NewRemoteStation(types.StationAOI, flaky.URL, opts, logger).Execute(context.Background(), product); !res.Success || calls.Load() != 3 {
+		t.Errorf("预期第 3 次调用成功, 结果 %+v, 调用 %d 次", res, calls.Load())
+	}
+
+	// 500 表示远程工站已经处理过请求，不重试
+	calls.Store(0)
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	if res := station.NewRemoteStation(types.StationAOI, failing.URL, opts, logger).Execute(context.Background(), product); res.Success || calls.Load() != 1 {
+		t.Errorf("预期 500 不重试, 结果 %+v, 调用 %d 次", res, calls.Load())
+	}
+
+	// 超过单次调用的超时时失败
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+	}))
+	defer slow.Close()
+	if res := station.NewRemoteStation(types.StationAOI, slow.URL, station.RemoteOptions{Timeout: 50 * time.Millisecond}, logger).Execute(context.Background(), product); res.Success {
+		t.Error("预期调用超时失败")
+	}
+
+	// 使用配置的 CA 证书校验 HTTPS 远程工站
+	secure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+	}))
+	defer secure.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: secure.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0644); err != nil {
+		t.Fatalf("写入 CA 证书失败: %v", err)
+	}
+	if res := station.NewRemoteStation(types.StationAOI, secure.URL, station.RemoteOptions{}, logger).Execute(context.Background(), product); res.Success {
+		t.Error("预期未配置 CA 时证书校验失败")
+	}
+	tlsConfig, err := config.StationTLSConfig{CAFile: caFile}.Load()
+	if err != nil {
+		t.Fatalf("加载 TLS 配置失败: %v", err)
+	}
+	if res := station.NewRemoteStation(types.StationAOI, secure.URL, station.RemoteOptions{TLS: tlsConfig}, logger).Execute(context.Background(), product); !res.Success {
+		t.Errorf("预期使用配置的 CA 调用成功, 得到 %+v", res)
+	}
+}
+
+func TestHealthCheck_HeartbeatAndStationUp(t *testing.T) {
+	var healthy atomic.Bool
+	healthy.Store(true)
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" || !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer remote.Close()
+
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	m := metrics.New(metrics.NewRegistry())
+	aoi := station.NewRemoteStation(types.StationAOI, remote.URL, station.RemoteOptions{}, logger)
+	checker := health.NewChecker(100*time.Millisecond, 150*time.Millisecond, m, logger)
+	checker.Watch(aoi.GetID(), aoi.Ping)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go checker.Run(ctx, 20*time.Millisecond)
+
+	// gauge 返回工站的指标值，未导出时 ok 为 false
+	gauge := func(name string) (value float64, ok bool) {
+		families, err := m.Registry().Gather()
+		if err != nil {
+			t.Fatalf("采集指标失败: %v", err)
+		}
+		for _, f := range families {
+			if f.GetName() != name {
+				continue
+			}
+			for _, metric := range f.GetMetric() {
+				for _, l := range metric.GetLabel() {
+					if l.GetName() == "station_id" && l.GetValue() == string(types.StationAOI) {
+						return metric.GetGauge().GetValue(), true
+					}
+				}
+			}
+		}
+		return 0, false
+	}
+	waitFor := func(desc string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("等待%s超时", desc)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	waitFor("工站上线", func() bool { up, _ := gauge("station_up"); return up == 1 })
+	heartbeat, ok := gauge("station_last_heartbeat_timestamp_seconds")
+	if !ok || time.Since(time.Unix(0, int64(heartbeat*1e9))) > time.Second {
+		t.Fatalf("预期导出最近的心跳时间, 得到 %v (%v)", heartbeat, ok)
+	}
+
+	// 远程服务静默宕机后，超过 stale_after 没有心跳即判定离线，心跳时间停留在最后一次成功的探测
+	healthy.Store(false)
+	waitFor("工站离线", func() bool { up, _ := gauge("station_up"); return up == 0 })
+	last, _ := gauge("station_last_heartbeat_timestamp_seconds")
+	if age := time.Since(time.Unix(0, int64(last*1e9))); age < 150*time.Millisecond {
+		t.Errorf("离线时最后一次心跳应早于 stale_after, 得到 %v 前", age)
+	}
+
+	healthy.Store(true)
+	waitFor("工站恢复", func() bool { up, _ := gauge("station_up"); return up == 1 })
+}
+
+func TestReliability_FailureRateMTBFAndMTTR(t *testing.T) {
+	bus := event.NewBus()
+	tracker := reliability.NewTracker(24*time.Hour, metrics.New(metrics.NewRegistry()))
+	tracker.Register(bus)
+
+	// 故障 2 秒后修复，再次故障 4 秒后转入维护，1 秒后维护结束
+	base := time.Now()
+	station := types.StationID("STATION_TEST")
+	for i, tr := range []struct {
+		offset time.Duration
+		state  fsm.StationState
+	}{
+		{1 * time.Second, fsm.StationDown},
+		{3 * time.Second, fsm.StationIdle},
+		{5 * time.Second, fsm.StationDown},
+		{9 * time.Second, fsm.StationMaintenance},
+		{10 * time.Second, fsm.StationIdle},
+	} {
+		bus.Publish(event.Event{Type: event.StationStatusChanged, StationID: station, Seq: uint64(i + 1), Timestamp: base.Add(tr.offset), ToState: string(tr.state)})
+	}
+	for i := 0; i < 4; i++ {
+		e := event.Event{Type: event.StepCompleted, StationID: station, Timestamp: base.Add(time.Duration(i+11) * time.Second)}
+		if i == 0 {
+			e.Error = errors.New("simulated failure")
+		}
+		bus.Publish(e)
+	}
+
+	var s reliability.StationReliability
+	for i := 0; i < 20; i++ {
+		time.Sleep(50 * time.Millisecond)
+		report, err := tracker.Report(time.Hour, base.Add(20*time.Second))
+		if err != nil {
+			t.Fatalf("统计可靠性失败: %v", err)
+		}
+		if len(report.Stations) == 1 {
+			s = report.Stations[0]
+		}
+		if s.Steps == 4 && s.Repairs == 2 {
+			break
+		}
+	}
+	if s.Steps != 4 || s.FailedSteps != 1 || s.FailureRate != 0.25 {
+		t.Errorf("步骤失败率不正确: %+v", s)
+	}
+	if s.Breakdowns != 2 || s.Repairs != 2 || s.MTTRSeconds != 3 || s.DowntimeSeconds != 6 {
+		t.Errorf("预期 2 次故障、平均修复 3 秒, 得到 %+v", s)
+	}
+	// 运行时间为窗口减去 6 秒停机和 1 秒维护
+	if s.MTBFSeconds < 6.5 || s.MTBFSeconds > 7 {
+		t.Errorf("预期 MTBF 约为 6.5 秒, 得到 %+v", s)
+	}
+	if _, err := tracker.Report(48*time.Hour, time.Now()); !errors.Is(err, windowed.ErrTooLarge) {
+		t.Errorf("预期超过保留时长的窗口返回 ErrTooLarge, 得到 %v", err)
+	}
+
+	_, _, server := setupTestApp(t, false)
+	for window, want := range map[string]int{"1h": http.StatusOK, "48h": http.StatusBadRequest, "abc": http.StatusBadRequest} {
+		resp, err := http.Get(server.URL + "/api/reliability?window=" + window)
+		if err != nil {
+			t.Fatalf("查询可靠性报告失败: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("window=%s 预期返回 %d, 得到 %d", window, want, resp.StatusCode)
+		}
+	}
+}
+
+func TestYield_ScrapAndRework(t *testing.T) {
+	bus := event.NewBus()
+	m := metrics.New(metrics.NewRegistry())
+	costs := yield.Costs{
+		Unit:    map[string]float64{"pcb_test": 10},
+		Station: map[types.StationID]float64{"station_drill": 2, types.StationETest: 3},
+	}
+	tracker := yield.NewTracker(1, costs, 24*time.Hour, m)
+	tracker.Register(bus)
+
+	// 事件总线异步分发，每个事件之后稍作等待以保持同一工件的事件顺序
+	at := time.Now()
+	publish := func(e event.Event) {
+		at = at.Add(time.Second)
+		e.Timestamp = at
+		bus.Publish(e)
+		time.Sleep(20 * time.Millisecond)
+	}
+	route := []types.StationID{types.StationDrill, types.StationETest}
+	run := func(p *types.Product, failed int) {
+		publish(event.Event{Type: event.ProductStarted, ProductID: p.ID, Product: p})
+		steps := route
+		if failed >= 0 {
+			steps = route[:failed+1]
+		}
+		for i, id := range steps {
+			e := event.Event{Type: event.StepCompleted, ProductID: p.ID, Product: p, StationID: id, Step: i}
+			if i == failed {
+				e.Error, e.Defect = errors.New("simulated failure"), defect.Primary(id)
+			}
+			publish(e)
+		}
+		if failed < 0 {
+			publish(event.Event{Type: event.ProductCompleted, ProductID: p.ID, Product: p})
+			return
+		}
+		publish(event.Event{Type: event.ProductFailed, ProductID: p.ID, Product: p, StationID: route[failed], Step: failed,
+			Error: errors.New("simulated failure"), Defect: defect.Primary(route[failed])})
+	}
+	// 电测开路直接报废；钻孔漏钻可以返工，重试一次仍失败后达到返工上限而报废；最后一件等待返工
+	run(&types.Product{ID: "Y_SCRAP", Type: "PCB_TEST"}, 1)
+	run(&types.Product{ID: "Y_REWORK", Type: "PCB_TEST"}, 0)
+	run(&types.Product{ID: "Y_REWORK_RETRY", Type: "PCB_TEST", RetryOf: "Y_REWORK"}, 0)
+	run(&types.Product{ID: "Y_GOOD", Type: "PCB_TEST"}, -1)
+	run(&types.Product{ID: "Y_PENDING", Type: "PCB_TEST"}, 0)
+
+	report, err := tracker.Report(time.Hour, at.Add(time.Second))
+	if err != nil {
+		t.Fatalf("统计良率失败: %v", err)
+	}
+	if len(report.Products) != 1 {
+		t.Fatalf("预期 1 种产品类型, 得到 %+v", report.Products)
+	}
+	p := report.Products[0]
+	if p.Completed != 1 || p.Scrapped != 2 || p.PendingRework != 1 || p.ScrapCost != 29 {
+		t.Errorf("产品良率统计不正确: %+v", p)
+	}
+	if p.Yield < 0.33 || p.Yield > 0.34 {
+		t.Errorf("预期最终良率约为 1/3, 得到 %v", p.Yield)
+	}
+	if len(report.Scraps) != 2 {
+		t.Fatalf("预期 2 个报废工件, 得到 %+v", report.Scraps)
+	}
+	// 报废按时间从新到旧排列
+	rework, scrap := report.Scraps[0], report.Scraps[1]
+	if scrap.ProductID != "Y_SCRAP" || scrap.StationID != types.StationETest || scrap.Reason != "ET-OPEN" || scrap.Attempts != 1 || scrap.Cost != 15 {
+		t.Errorf("电测报废记录不正确: %+v", scrap)
+	}
+	if rework.ProductID != "Y_REWORK_RETRY" || rework.Lineage != "Y_REWORK" || rework.StationID != types.StationDrill ||
+		rework.Reason != "DR-MISSING" || rework.Disposition != types.DispositionRework || rework.Attempts != 2 || rework.Cost != 14 {
+		t.Errorf("返工超限报废记录不正确: %+v", rework)
+	}
+	stations := make(map[types.StationID]yield.StationYield)
+	for _, s := range report.Stations {
+		stations[s.StationID] = s
+	}
+	if s := stations[types.StationDrill]; s.Steps != 5 || s.Good != 2 || s.Scrapped != 1 || s.ScrapCost != 14 {
+		t.Errorf("钻孔工站良率不正确: %+v", s)
+	}
+	if s := stations[types.StationETest]; s.Steps != 2 || s.Good != 1 || s.Yield != 0.5 || s.Scrapped != 1 || s.ScrapCost != 15 {
+		t.Errorf("电测工站良率不正确: %+v", s)
+	}
+	if len(report.Reasons) != 2 || report.Reasons[0].Reason != "ET-OPEN" || report.ScrapCost != 29 {
+		t.Errorf("报废原因应按成本从高到低排列: %+v", report.Reasons)
+	}
+	if got := testutil.ToFloat64(m.ScrappedProductsTotal.WithLabelValues("PCB_TEST", string(types.StationDrill), "DR-MISSING", "")); got != 1 {
+		t.Errorf("预期 scrapped_products_total 为 1, 得到 %v", got)
+	}
+	if got := testutil.ToFloat64(m.ScrapCostTotal.WithLabelValues("PCB_TEST", string(types.StationETest), "")); got != 15 {
+		t.Errorf("预期 scrap_cost_total 为 15, 得到 %v", got)
+	}
+	if _, err := tracker.Report(48*time.Hour, time.Now()); !errors.Is(err, windowed.ErrTooLarge) {
+		t.Errorf("预期超过保留时长的窗口返回 ErrTooLarge, 得到 %v", err)
+	}
+
+	_, _, server := setupTestApp(t, false)
+	for window, want := range map[string]int{"1h": http.StatusOK, "48h": http.StatusBadRequest, "abc": http.StatusBadRequest} {
+		resp, err := http.Get(server.URL + "/api/yield?window=" + window)
+		if err != nil {
+			t.Fatalf("查询良率报告失败: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("window=%s 预期返回 %d, 得到 %d", window, want, resp.StatusCode)
+		}
+	}
+}
+
+func TestThroughput_UnitsTaktAndBottleneck(t *testing.T) {
+	_, stateTracker, server := setupTestApp(t, false)
+
+	ids := []string{"Test_Takt_01", "Test_Takt_02", "Test_Takt_03", "Test_Takt_04"}
+	for _, id := range ids {
+		body, _ := json.Marshal(types.Product{ID: id, Type: "PCB_DOUBLE_LAYER"})
+		resp, err := http.Post(server.URL+"/api/tasks", "application/json", bytes.NewBuffer(body))
+		if err != nil {
+			t.Fatalf("提交任务失败: %v", err)
+		}
+		resp.Body.Close()
+	}
+	completed := 0
+	for i := 0; i < 50; i++ {
+		time.Sleep(100 * time.Millisecond)
+		completed = 0
+		finished := 0
+		for _, id := range ids {
+			s, ok := stateTracker.GetProduct(id)
+			if ok && s.Status == "COMPLETED" {
+				completed++
+			}
+			if ok && (s.Status == "COMPLETED" || s.Status == "COMPENSATED") {
+				finished++
+			}
+		}
+		if finished == len(ids) {
+			break
+		}
+	}
+	// 完成事件的处理器是异步执行的
+	time.Sleep(100 * time.Millisecond)
+
+	resp, err := http.Get(server.URL + "/api/throughput?window=1h")
+	if err != nil {
+		t.Fatalf("查询产出失败: %v", err)
+	}
+	var report throughput.Report
+	json.NewDecoder(resp.Body).Decode(&report)
+	resp.Body.Close()
+	if report.Completed != completed || report.UnitsPerHour <= 0 {
+		t.Fatalf("预期完成 %d 件, 得到 %+v", completed, report)
+	}
+	if len(report.Types) != 1 || report.Types[0].Type != "PCB_DOUBLE_LAYER" || report.Types[0].Completed != completed {
+		t.Errorf("按产品类型的产出不正确: %+v", report.Types)
+	}
+	if completed >= 2 && report.TaktSeconds <= 0 {
+		t.Errorf("预期滚动节拍大于 0, 得到 %+v", report)
+	}
+	// 资源池容量为 1 的电测和 AOI 工站上会出现排队
+	share, longest, highest := 0.0, 0.0, types.StationID("")
+	for _, s := range report.Stations {
+		share += s.Share
+		if s.QueueSeconds > longest {
+			longest, highest = s.QueueSeconds, s.StationID
+		}
+	}
+	if report.Bottleneck == "" || report.Bottleneck != highest || share < 0.99 || share > 1.01 {
+		t.Errorf("排队时间占比不正确: bottleneck=%s stations=%+v", report.Bottleneck, report.Stations)
+	}
+
+	resp, err = http.Get(server.URL + "/api/throughput?window=48h")
+	if err != nil {
+		t.Fatalf("查询产出失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("超过保留时长的窗口预期返回 400, 得到 %d", resp.StatusCode)
+	}
+}
+
+func TestMetricsPush_PushesToPushgateway(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []string
+		bodies   [][]byte
+	)
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		bodies = append(bodies, body)
+		// 第一次推送失败，之后的推送应当继续
+		if len(requests) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer gateway.Close()
+
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	m := metrics.New(metrics.NewRegistry())
+	m.TasksInQueue.WithLabelValues("default").Set(2)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.NewPusher(gateway.URL, "orchestrator", "edge-01", logger).Run(ctx, 50*time.Millisecond)
+		close(done)
+	}()
+	time.Sleep(175 * time.Millisecond)
+	cancel()
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	// 3 次周期推送和退出时的最后一次推送
+	if len(requests) < 3 {
+		t.Fatalf("预期失败后继续推送, 得到 %v", requests)
+	}
+	for _, req := range requests {
+		if req != "PUT /metrics/job/orchestrator/instance/edge-01" {
+			t.Errorf("预期按 job 和 instance 分组替换指标, 得到 %s", req)
+		}
+	}
+	last := bodies[len(bodies)-1]
+	for _, name := range []string{"scheduler_tasks_in_queue", "metrics_push_failures_total"} {
+		if !bytes.Contains(last, []byte(name)) {
+			t.Errorf("预期推送的指标中包含 %s", name)
+		}
+	}
+}
+
+func TestScheduler_PauseResumeAliasesRequireAdmin(t *testing.T) {
+	app := newTestApp(t, false)
+	cfg := config.AuthConfig{Enabled: true, APIKeys: []config.APIKeyConfig{
+		{Name: "planner", Key: "operator-key", Roles: []string{"operator"}},
+		{Name: "ops", Key: "admin-key", Roles: []string{"admin"}},
+	}}
+	apiServer := api.NewServer(app.scheduler, app.hub, app.stateTracker, app.history, "", auth.New(cfg), nil, app.metrics, app.logger)
+	server := httptest.NewServer(apiServer.Handler())
+	t.Cleanup(server.Close)
+
+	call := func(path, key string) (int, web.SchedulerState) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, server.URL+path, nil)
+		req.Header.Set("X-API-Key", key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("请求 %s 失败: %v", path, err)
+		}
+		defer resp.Body.Close()
+		var state web.SchedulerState
+		json.NewDecoder(resp.Body).Decode(&state)
+		return resp.StatusCode, state
+	}
+
+	// 别名与 /admin 下的接口一样只允许管理员调用，旧路径转发到当前版本
+	for _, path := range []string{"/api/scheduler/pause", "/api/v1/scheduler/resume"} {
+		if code, _ := call(path, "operator-key"); code != http.StatusForbidden {
+			t.Errorf("操作员调用 %s 应返回 403, 得到 %d", path, code)
+		}
+	}
+	if app.scheduler.State().Status != web.SchedulerRunning {
+		t.Fatalf("操作员的请求不应暂停调度器: %s", app.scheduler.State().Status)
+	}
+	if code, state := call("/api/scheduler/pause", "admin-key"); code != http.StatusOK || state.Status != web.SchedulerPaused {
+		t.Fatalf("管理员暂停调度器失败: %d %s", code, state.Status)
+	}
+	if code, state := call("/api/v1/scheduler/resume", "admin-key"); code != http.StatusOK || state.Status != web.SchedulerRunning {
+		t.Fatalf("管理员恢复调度器失败: %d %s", code, state.Status)
+	}
+}
+
+func TestAdminScheduler_PauseResizeDrainCompact(t *testing.T) {
+	_, stateTracker, server := setupTestApp(t, false)
+
+	call := func(method, path string, body interface{}, out interface{}) int {
+		data, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, server.URL+path, bytes.NewBuffer(data))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s 失败: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		if out != nil {
+			json.NewDecoder(resp.Body).Decode(out)
+		}
+		return resp.StatusCode
+	}
+
+	var state web.SchedulerState
+	call(http.MethodPost, "/api/admin/scheduler/pause", nil, &state)
+	if state.Status != web.SchedulerPaused {
+		t.Fatalf("预期调度器已暂停, 得到 %s", state.Status)
+	}
+
+	task := types.Product{ID: "Test_Admin_01", Type: "PCB_PROTOTYPE"}
+	call(http.MethodPost, "/api/tasks", task, nil)
+	time.Sleep(100 * time.Millisecond)
+	call(http.MethodGet, "/api/admin/scheduler", nil, &state)
+	if len(state.Queue) != 1 || state.BusyWorkers != 0 {
+		t.Errorf("暂停期间任务应留在队列中, 得到 %+v", state)
+	}
+
+	if status := call(http.MethodPut, "/api/admin/scheduler/workers", map[string]int{"max_workers": 0}, nil); status != http.StatusBadRequest {
+		t.Errorf("预期非法的 worker 数量返回 400, 得到 %d", status)
+	}
+	call(http.MethodPut, "/api/admin/scheduler/workers", map[string]int{"max_workers": 6}, &state)
+	if state.Workers != 6 || len(state.InFlight) != 6 {
+		t.Errorf("预期 worker 池扩容到 6, 得到 %+v", state)
+	}
+	body := scrapeMetrics(t, server.URL)
+	for _, name := range []string{"scheduler_workers_busy", "scheduler_workers_max", "scheduler_worker_busy_seconds_total", "scheduler_workers_saturated_seconds_total"} {
+		if !strings.Contains(body, "\n"+name+" ") {
+			t.Errorf("/metrics 中缺少 %s", name)
+		}
+	}
+
+	call(http.MethodPost, "/api/admin/scheduler/resume", nil, nil)
+	time.Sleep(100 * time.Millisecond)
+	if status := call(http.MethodPost, "/api/admin/scheduler/drain?timeout=5s", nil, &state); status != http.StatusOK {
+		t.Fatalf("预期排空在超时前完成, 得到 %d", status)
+	}
+	if state.Status != web.SchedulerPaused || state.BusyWorkers != 0 {
+		t.Errorf("排空完成后调度器应保持暂停且没有执行中的任务, 得到 %+v", state)
+	}
+	if s, ok := stateTracker.GetProduct(task.ID); !ok || (s.Status != "COMPLETED" && s.Status != "COMPENSATED") {
+		t.Errorf("预期排空后任务已结束, 得到 %+v", s)
+	}
+
+	var result persistence.CompactResult
+	if status := call(http.MethodPost, "/api/admin/scheduler/wal/compact", nil, &result); status != http.StatusOK {
+		t.Fatalf("压缩 WAL 失败: %d", status)
+	}
+	if result.Pending != 0 || result.BytesAfter != 0 || result.BytesBefore == 0 {
+		t.Errorf("预期压缩后 WAL 为空, 得到 %+v", result)
+	}
+}
+
+func TestTaskTimeline_OrderedEvents(t *testing.T) {
+	_, _, server := setupTestApp(t, false)
+
+	task := types.Product{ID: "Test_Timeline_01", Type: "PCB_PROTOTYPE"}
+	body, _ := json.Marshal(task)
+	resp, err := http.Post(server.URL+"/api/tasks", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("提交任务失败: %v", err)
+	}
+	resp.Body.Close()
+
+	var timeline api.TaskTimeline
+	for i := 0; i < 20; i++ {
+		time.Sleep(200 * time.Millisecond)
+		resp, err := http.Get(server.URL + "/api/tasks/" + task.ID + "/timeline")
+		if err != nil {
+			t.Fatalf("查询时间线失败: %v", err)
+		}
+		json.NewDecoder(resp.Body).Decode(&timeline)
+		resp.Body.Close()
+		if n := len(timeline.Events); n > 0 && timeline.Events[n-1].Kind == history.TimelineFinished {
+			break
+		}
+	}
+
+	events := timeline.Events
+	if len(events) < 4 || events[0].Kind != history.TimelineQueued || events[1].Kind != history.TimelineDispatched {
+		t.Fatalf("时间线应以入队和派发开始, 得到 %+v", events)
+	}
+	if last := events[len(events)-1]; last.Kind != history.TimelineFinished || last.Outcome == "" {
+		t.Errorf("时间线应以结束事件收尾, 得到 %+v", last)
+	}
+	camStarted := false
+	for i, e := range events {
+		if i > 0 && e.At.Before(events[i-1].At) {
+			t.Errorf("事件未按时间排序: %+v 早于 %+v", e, events[i-1])
+		}
+		if e.Kind == history.TimelineStepStarted && e.StationID == types.StationCAM {
+			camStarted = true
+		}
+	}
+	if !camStarted {
+		t.Errorf("时间线中缺少 CAM 工站的开始事件")
+	}
+
+	resp, err = http.Get(server.URL + "/api/tasks/Unknown_Task/timeline")
+	if err != nil {
+		t.Fatalf("查询时间线失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("预期不存在的任务返回 404, 得到 %d", resp.StatusCode)
+	}
+}
+
+func TestCompressionAndStaticCaching(t *testing.T) {
+	_, _, server := setupTestApp(t, false)
+
+	// 手动设置 Accept-Encoding 时 http.Client 不会自动解压，可以直接检查压缩后的响应
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/state", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("查询状态失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("预期状态快照使用 gzip 压缩, 得到 Content-Encoding=%q", resp.Header.Get("Content-Encoding"))
+	}
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatalf("解压响应失败: %v", err)
+	}
+	var state web.GlobalState
+	if err := json.NewDecoder(gz).Decode(&state); err != nil || len(state.Stations) == 0 {
+		t.Errorf("解压后的状态快照无效: %v", err)
+	}
+
+	resp, err = http.Get(server.URL + "/")
+	if err != nil {
+		t.Fatalf("请求首页失败: %v", err)
+	}
+	resp.Body.Close()
+	etag := resp.Header.Get("ETag")
+	if etag == "" || resp.Header.Get("Cache-Control") != "no-cache" {
+		t.Fatalf("首页缺少缓存响应头: ETag=%q Cache-Control=%q", etag, resp.Header.Get("Cache-Control"))
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, server.URL+"/", nil)
+	req.Header.Set("If-None-Match", etag)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("请求首页失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("预期 ETag 未变化时返回 304, 得到 %d", resp.StatusCode)
+	}
+}
+
+func TestAPIVersioning_LegacyPathsAndBodyLimit(t *testing.T) {
+	_, _, server := setupTestApp(t, false)
+
+	resp, err := http.Get(server.URL + "/api/versions")
+	if err != nil {
+		t.Fatalf("查询 API 版本失败: %v", err)
+	}
+	var versions api.VersionInfo
+	json.NewDecoder(resp.Body).Decode(&versions)
+	resp.Body.Close()
+	if versions.Current != "v1" || versions.Prefix != "/api/v1" {
+		t.Errorf("版本协商结果不正确: %+v", versions)
+	}
+
+	resp, err = http.Get(server.URL + "/api/version")
+	if err != nil {
+		t.Fatalf("查询构建信息失败: %v", err)
+	}
+	var build buildinfo.Info
+	json.NewDecoder(resp.Body).Decode(&build)
+	resp.Body.Close()
+	if build.Version == "" || build.Commit == "" || build.GoVersion != runtime.Version() || len(build.ConfigHash) != 12 || build.StartedAt.IsZero() {
+		t.Errorf("构建信息不完整: %+v", build)
+	}
+	metricsText := scrapeMetrics(t, server.URL)
+	for _, want := range []string{
+		fmt.Sprintf(`build_info{commit=%q,go_version=%q,version=%q} 1`, build.Commit, build.GoVersion, build.Version),
+		fmt.Sprintf(`config_info{hash=%q} 1`, build.ConfigHash),
+		"process_uptime_seconds ",
+	} {
+		if !strings.Contains(metricsText, want) {
+			t.Errorf("预期指标中包含 %s", want)
+		}
+	}
+
+	resp, err = http.Get(server.URL + "/api/v1/state")
+	if err != nil {
+		t.Fatalf("查询状态失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Deprecation") != "" {
+		t.Errorf("预期 v1 路径正常返回且不带 Deprecation 头, 得到 %d %q", resp.StatusCode, resp.Header.Get("Deprecation"))
+	}
+
+	resp, err = http.Get(server.URL + "/api/state")
+	if err != nil {
+		t.Fatalf("查询状态失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Deprecation") != "true" || !strings.Contains(resp.Header.Get("Link"), "/api/v1/state") {
+		t.Errorf("预期旧路径转发到 v1 并提示迁移, 得到 %d Deprecation=%q Link=%q", resp.StatusCode, resp.Header.Get("Deprecation"), resp.Header.Get("Link"))
+	}
+
+	large := bytes.Repeat([]byte("x"), 2<<20)
+	body, _ := json.Marshal(types.Product{ID: "Test_Large_01", Type: "PCB_PROTOTYPE", Attrs: map[string]interface{}{"blob": string(large)}})
+	resp, err = http.Post(server.URL+"/api/v1/tasks", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("提交任务失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("预期超过大小限制的请求体返回 413, 得到 %d", resp.StatusCode)
+	}
+}
+
+func TestGraphQL_NestedQuery(t *testing.T) {
+	_, _, server := setupTestApp(t, false)
+
+	task := types.Product{ID: "Test_GraphQL_01", Type: "PCB_PROTOTYPE"}
+	body, _ := json.Marshal(task)
+	resp, err := http.Post(server.URL+"/api/v1/tasks", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("提交任务失败: %v", err)
+	}
+	resp.Body.Close()
+
+	query := `query($id: ID!) {
+		product(id: $id) {
+			id status
+			history { outcome steps { stationId station { id driver } success } }
+			events { kind }
+			workflow { name version }
+		}
+		stations { id poolSize products { id } }
+		workflow(name: "pcb_prototype") { steps { stations { id } } }
+		metrics { products byStatus { status count } }
+	}`
+	type graphqlResult struct {
+		Data struct {
+			Product *struct {
+				ID      string `json:"id"`
+				Status  string `json:"status"`
+				History *struct {
+					Outcome string `json:"outcome"`
+					Steps   []struct {
+						StationID string `json:"stationId"`
+						Station   *struct {
+							ID     string `json:"id"`
+							Driver string `json:"driver"`
+						} `json:"station"`
+					} `json:"steps"`
+				} `json:"history"`
+				Events []struct {
+					Kind string `json:"kind"`
+				} `json:"events"`
+				Workflow *struct {
+					Name string `json:"name"`
+				} `json:"workflow"`
+			} `json:"product"`
+			Stations []struct {
+				ID string `json:"id"`
+			} `json:"stations"`
+			Workflow *struct {
+				Steps []struct {
+					Stations []struct {
+						ID string `json:"id"`
+					} `json:"stations"`
+				} `json:"steps"`
+			} `json:"workflow"`
+			Metrics struct {
+				Products int `json:"products"`
+			} `json:"metrics"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+
+	var result graphqlResult
+	for i := 0; i < 20; i++ {
+		time.Sleep(200 * time.Millisecond)
+		reqBody, _ := json.Marshal(map[string]interface{}{"query": query, "variables": map[string]string{"id": task.ID}})
+		resp, err := http.Post(server.URL+"/api/v1/graphql", "application/json", bytes.NewBuffer(reqBody))
+		if err != nil {
+			t.Fatalf("GraphQL 查询失败: %v", err)
+		}
+		result = graphqlResult{}
+		json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if len(result.Errors) > 0 {
+			t.Fatalf("GraphQL 查询返回错误: %+v", result.Errors)
+		}
+		if p := result.Data.Product; p != nil && p.History != nil && p.History.Outcome != "" {
+			break
+		}
+	}
+
+	p := result.Data.Product
+	if p == nil || p.ID != task.ID || p.History == nil || p.History.Outcome == "" {
+		t.Fatalf("预期查询到已结束的工件及其履历, 得到 %+v", p)
+	}
+	if len(p.History.Steps) == 0 || p.History.Steps[0].Station == nil || p.History.Steps[0].Station.ID != p.History.Steps[0].StationID {
+		t.Errorf("预期步骤可以嵌套查询所在工站, 得到 %+v", p.History.Steps)
+	}
+	if len(p.Events) == 0 || p.Events[0].Kind != history.TimelineQueued {
+		t.Errorf("预期事件以入队开始, 得到 %+v", p.Events)
+	}
+	if p.Workflow == nil || p.Workflow.Name != "pcb_prototype" {
+		t.Errorf("预期工件关联到 pcb_prototype 工作流, 得到 %+v", p.Workflow)
+	}
+	if len(result.Data.Stations) == 0 {
+		t.Errorf("预期返回已注册的工站")
+	}
+	if wf := result.Data.Workflow; wf == nil || len(wf.Steps) == 0 || len(wf.Steps[0].Stations) == 0 {
+		t.Errorf("预期工作流步骤可以嵌套查询工站, 得到 %+v", wf)
+	}
+	if result.Data.Metrics.Products == 0 {
+		t.Errorf("预期指标汇总包含工件数量")
+	}
+
+	// GET 请求同样可用，语法错误通过 errors 字段返回
+	resp, err = http.Get(server.URL + "/api/v1/graphql?query=" + url.QueryEscape("{ stations { unknownField } }"))
+	if err != nil {
+		t.Fatalf("GraphQL 查询失败: %v", err)
+	}
+	var invalid graphqlResult
+	json.NewDecoder(resp.Body).Decode(&invalid)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(invalid.Errors) == 0 {
+		t.Errorf("预期未知字段返回 GraphQL 错误, 得到 %d %+v", resp.StatusCode, invalid)
+	}
+}
+
+func TestGRPC_SubmitStreamGetCancel(t *testing.T) {
+	app := newTestApp(t, false)
+
+	grpcServer := grpcapi.NewServer(app.scheduler, app.hub, app.stateTracker, app.history, nil, nil, app.metrics, app.logger).GRPCServer()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("gRPC 监听失败: %v", err)
+	}
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("创建 gRPC 客户端失败: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	client := orchestratorv1.NewOrchestratorClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// 先订阅，再提交任务，订阅流中应先收到快照，再收到该工件的更新
+	stream, err := client.StreamState(ctx, &orchestratorv1.StreamStateRequest{ProductIds: []string{"Test_GRPC_01"}})
+	if err != nil {
+		t.Fatalf("订阅状态失败: %v", err)
+	}
+	first, err := stream.Recv()
+	if err != nil || first.GetSnapshot() == nil {
+		t.Fatalf("预期第一条消息为快照, 得到 %v, err=%v", first, err)
+	}
+
+	attrs, _ := structpb.NewStruct(map[string]interface{}{"layers": 2})
+	resp, err := client.SubmitTask(ctx, &orchestratorv1.SubmitTaskRequest{Product: &orchestratorv1.Product{Id: "Test_GRPC_01", Type: "PCB_PROTOTYPE", Attrs: attrs}})
+	if err != nil || resp.GetId() != "Test_GRPC_01" {
+		t.Fatalf("提交任务失败: %v, err=%v", resp, err)
+	}
+
+	for {
+		update, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("接收状态更新失败: %v", err)
+		}
+		if p := update.GetProduct(); p != nil && p.GetId() == "Test_GRPC_01" && (p.GetStatus() == "COMPLETED" || p.GetStatus() == "COMPENSATED") {
+			break
+		}
+	}
+
+	var task *orchestratorv1.Task
+	for i := 0; i < 20; i++ {
+		task, err = client.GetTask(ctx, &orchestratorv1.GetTaskRequest{Id: "Test_GRPC_01"})
+		if err != nil {
+			t.Fatalf("查询任务失败: %v", err)
+		}
+		if task.GetResult() != nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if task.GetResult() == nil || len(task.GetSteps()) == 0 || task.GetTraceId() == "" {
+		t.Fatalf("预期任务包含最终结果、步骤履历和 Trace ID, 得到 %v", task)
+	}
+	if layers := task.GetProduct().GetAttrs().AsMap()["layers"]; layers != float64(2) {
+		t.Errorf("预期属性 layers=2, 得到 %v", layers)
+	}
+
+	if _, err := client.CancelTask(ctx, &orchestratorv1.CancelTaskRequest{Id: "Test_GRPC_01"}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("预期取消已结束的任务返回 FailedPrecondition, 得到 %v", err)
+	}
+	if _, err := client.GetTask(ctx, &orchestratorv1.GetTaskRequest{Id: "Unknown_Task"}); status.Code(err) != codes.NotFound {
+		t.Errorf("预期不存在的任务返回 NotFound, 得到 %v", err)
+	}
+	queue, err := client.ListQueue(ctx, &orchestratorv1.ListQueueRequest{})
+	if err != nil || queue.GetScheduler().GetWorkers() == 0 {
+		t.Errorf("预期返回调度器状态, 得到 %v, err=%v", queue, err)
+	}
+}
+
+func TestFactoryctl_SubmitWatchListAndAdmin(t *testing.T) {
+	_, _, server := setupTestApp(t, false)
+
+	run := func(args ...string) (int, string, string) {
+		var stdout, stderr bytes.Buffer
+		code := cli.Run(append(args, "--server", server.URL), &stdout, &stderr)
+		return code, stdout.String(), stderr.String()
+	}
+
+	order := filepath.Join(t.TempDir(), "order.json")
+	os.WriteFile(order, []byte(`[{"id": "Test_CLI_01", "type": "PCB_PROTOTYPE"}, {"id": "Test_CLI_02", "type": "PCB_PROTOTYPE"}]`), 0o644)
+	code, out, errOut := run("submit", "-f", order)
+	if code != 0 || !strings.Contains(out, "Test_CLI_01") || !strings.Contains(out, "Test_CLI_02") {
+		t.Fatalf("提交任务失败: code=%d stdout=%s stderr=%s", code, out, errOut)
+	}
+
+	// watch 在任务结束时退出，成功完成时退出码为 0
+	code, out, errOut = run("tasks", "watch", "Test_CLI_01")
+	if code != 0 || !strings.Contains(out, "COMPLETED") {
+		t.Fatalf("观察任务失败: code=%d stdout=%s stderr=%s", code, out, errOut)
+	}
+
+	code, out, _ = run("tasks", "list", "--status", "COMPLETED", "-o", "json")
+	var products []web.ProductState
+	if code != 0 || json.Unmarshal([]byte(out), &products) != nil || len(products) == 0 {
+		t.Fatalf("列出任务失败: code=%d stdout=%s", code, out)
+	}
+	for _, p := range products {
+		if p.Status != "COMPLETED" {
+			t.Errorf("预期只列出 COMPLETED 的任务, 得到 %+v", p)
+		}
+	}
+
+	code, out, _ = run("tasks", "get", "Test_CLI_01")
+	if code != 0 || !strings.Contains(out, "TRACE_ID") || !strings.Contains(out, string(types.StationCAM)) {
+		t.Errorf("预期任务详情包含 Trace ID 和步骤履历, 得到 code=%d\n%s", code, out)
+	}
+
+	code, out, _ = run("stations")
+	if code != 0 || !strings.Contains(out, string(types.StationETest)) || !strings.Contains(out, "UTILIZATION") {
+		t.Errorf("预期输出工站表格, 得到 code=%d\n%s", code, out)
+	}
+
+	code, out, _ = run("scheduler", "pause", "-o", "json")
+	var state web.SchedulerState
+	if code != 0 || json.Unmarshal([]byte(out), &state) != nil || state.Status != web.SchedulerPaused {
+		t.Errorf("预期调度器已暂停, 得到 code=%d stdout=%s", code, out)
+	}
+	if code, _, _ = run("scheduler", "resume"); code != 0 {
+		t.Errorf("恢复调度器失败: code=%d", code)
+	}
+
+	if code, _, errOut = run("tasks", "get", "Unknown_Task"); code != 1 || !strings.Contains(errOut, "404") {
+		t.Errorf("预期不存在的任务以退出码 1 报告 404, 得到 code=%d stderr=%s", code, errOut)
+	}
+	if code, _, _ = run("tasks", "unknown"); code != 2 {
+		t.Errorf("预期未知命令的退出码为 2, 得到 %d", code)
+	}
+}
+
+func TestStaticAssets_EmbeddedAndDiskOverride(t *testing.T) {
+	app := newTestApp(t, false)
+
+	// 内嵌资源不依赖工作目录
+	t.Chdir(t.TempDir())
+	resp, err := http.Get(app.server.URL + "/")
+	if err != nil {
+		t.Fatalf("请求首页失败: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "<html") {
+		t.Fatalf("预期从内嵌资源返回看板首页, 得到 %d", resp.StatusCode)
+	}
+
+	// 配置了磁盘目录时直接读取磁盘上的页面
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html>dev build</html>"), 0o644)
+	devServer := httptest.NewServer(api.NewServer(app.scheduler, app.hub, app.stateTracker, app.history, dir, nil, nil, app.metrics, app.logger).Handler())
+	defer devServer.Close()
+	resp, err = http.Get(devServer.URL + "/")
+	if err != nil {
+		t.Fatalf("请求首页失败: %v", err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "<html>dev build</html>" {
+		t.Errorf("预期返回磁盘目录中的页面, 得到 %q", body)
+	}
+}
+
+func TestSimulator_StartUpdateStop(t *testing.T) {
+	app := newTestApp(t, false)
+
+	simCall := func(method, path string, body interface{}) (int, simulator.Status) {
+		t.Helper()
+		data, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, app.server.URL+"/api/v1/sim"+path, bytes.NewReader(data))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("请求模拟接口失败: %v", err)
+		}
+		defer resp.Body.Close()
+		var status simulator.Status
+		json.NewDecoder(resp.Body).Decode(&status)
+		return resp.StatusCode, status
+	}
+
+	if code, _ := simCall(http.MethodPost, "/start", map[string]interface{}{"scenario": "nope"}); code != http.StatusBadRequest {
+		t.Errorf("未知场景应返回 400, 得到 %d", code)
+	}
+	if code, _ := simCall(http.MethodPut, "", map[string]interface{}{"rate": 60}); code != http.StatusConflict {
+		t.Errorf("模拟器未运行时调整参数应返回 409, 得到 %d", code)
+	}
+
+	// 固定订单场景提交完 6 个演示订单后自动停止
+	code, status := simCall(http.MethodPost, "/start", map[string]interface{}{"scenario": "demo", "rate": 6000})
+	if code != http.StatusOK || status.Status != simulator.StatusRunning || status.Limit != 6 {
+		t.Fatalf("启动 demo 场景失败: %d %+v", code, status)
+	}
+	for i := 0; i < 50 && status.Status == simulator.StatusRunning; i++ {
+		time.Sleep(20 * time.Millisecond)
+		_, status = simCall(http.MethodGet, "", nil)
+	}
+	if status.Status != simulator.StatusStopped || status.Submitted != 6 {
+		t.Fatalf("demo 场景应提交 6 个订单后停止, 得到 %+v", status)
+	}
+	if _, ok := app.stateTracker.GetProduct("PCB_Multi_4L_001"); !ok {
+		t.Error("演示订单 PCB_Multi_4L_001 未被提交")
+	}
+
+	// 持续下单的场景可以在运行中调整速率和配比
+	code, status = simCall(http.MethodPost, "/start", map[string]interface{}{"scenario": "steady", "rate": 1})
+	if code != http.StatusOK || status.Mix["PCB_DOUBLE_LAYER"] != 3 {
+		t.Fatalf("启动 steady 场景失败: %d %+v", code, status)
+	}
+	if code, _ := simCall(http.MethodPost, "/start", nil); code != http.StatusConflict {
+		t.Errorf("重复启动应返回 409, 得到 %d", code)
+	}
+	code, status = simCall(http.MethodPut, "", map[string]interface{}{"rate": 3000, "mix": map[string]int{"pcb_prototype": 1}})
+	if code != http.StatusOK || status.Rate != 3000 || len(status.Mix) != 1 || status.Mix["PCB_PROTOTYPE"] != 1 {
+		t.Fatalf("调整参数失败: %d %+v", code, status)
+	}
+	for i := 0; i < 50 && status.Submitted < 3; i++ {
+		time.Sleep(20 * time.Millisecond)
+		_, status = simCall(http.MethodGet, "", nil)
+	}
+	if status.Submitted < 3 {
+		t.Fatalf("调高速率后应持续提交订单, 得到 %+v", status)
+	}
+
+	_, status = simCall(http.MethodPost, "/stop", nil)
+	if status.Status != simulator.StatusStopped {
+		t.Fatalf("停止后状态应为 stopped, 得到 %+v", status)
+	}
+	submitted := status.Submitted
+	time.Sleep(100 * time.Millisecond)
+	if _, status = simCall(http.MethodGet, "", nil); status.Submitted != submitted {
+		t.Errorf("停止后不应继续提交订单: %d -> %d", submitted, status.Submitted)
+	}
+	for id, p := range app.stateTracker.GetStateSnapshot().Products {
+		if strings.HasPrefix(id, "SIM_") && p.Type != "PCB_PROTOTYPE" {
+			t.Errorf("调整配比后只应提交打样板, 得到 %s: %s", id, p.Type)
+		}
+	}
+}
+
+func TestLots_SplitIntoPanels(t *testing.T) {
+	app := newTestApp(t, false)
+	finished := make(chan event.Event, 1)
+	app.bus.Subscribe(event.LotCompleted, func(e event.Event) { finished <- e })
+
+	submit := func(body string) (int, map[string]interface{}) {
+		t.Helper()
+		resp, err := http.Post(app.server.URL+"/api/tasks", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("提交订单失败: %v", err)
+		}
+		defer resp.Body.Close()
+		var result map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&result)
+		return resp.StatusCode, result
+	}
+
+	// 4 块拼板中的第一块在电测失败，其余完成
+	app.scheduler.Engine().Stations().InjectFailures(types.StationETest, 1)
+	code, result := submit(`{"id": "LOT_01", "type": "PCB_PROTOTYPE", "quantity": 4, "attrs": {"layers": 2}}`)
+	if code != http.StatusAccepted || len(result["panels"].([]interface{})) != 4 {
+		t.Fatalf("拆分批次失败: %d %v", code, result)
+	}
+	if code, _ := submit(`{"id": "LOT_01", "type": "PCB_PROTOTYPE", "quantity": 2}`); code != http.StatusBadRequest {
+		t.Errorf("重复的批次 ID 应返回 400, 得到 %d", code)
+	}
+	if code, _ := submit(`{"id": "LOT_02", "type": "PCB_PROTOTYPE", "quantity": -1}`); code != http.StatusBadRequest {
+		t.Errorf("无效的数量应返回 400, 得到 %d", code)
+	}
+
+	var e event.Event
+	select {
+	case e = <-finished:
+	case <-time.After(10 * time.Second):
+		t.Fatal("超时未收到批次结束事件")
+	}
+	if e.Lot.ID != "LOT_01" || e.Lot.Status != lot.StatusPartial || e.Lot.Completed != 3 || e.Lot.Failed != 1 {
+		t.Errorf("批次结束事件错误: %+v", e.Lot)
+	}
+
+	resp, err := http.Get(app.server.URL + "/api/lots/LOT_01")
+	if err != nil {
+		t.Fatalf("查询批次失败: %v", err)
+	}
+	var progress lot.Progress
+	json.NewDecoder(resp.Body).Decode(&progress)
+	resp.Body.Close()
+	if progress.Quantity != 4 || progress.Completed != 3 || progress.Failed != 1 || progress.InProcess+progress.Queued != 0 {
+		t.Errorf("批次进度错误: %+v", progress)
+	}
+	if progress.FirstFinishedAt.IsZero() || progress.LastFinishedAt.Before(progress.FirstFinishedAt) {
+		t.Errorf("最早和最晚结束时间错误: %v %v", progress.FirstFinishedAt, progress.LastFinishedAt)
+	}
+	if s, ok := app.stateTracker.GetProduct("LOT_01_P004"); !ok || s.Lot != "LOT_01" || s.Attrs["layers"] != float64(2) {
+		t.Errorf("拼板应继承订单的属性并标记所属批次, 得到 %+v", s)
+	}
+
+	resp, _ = http.Get(app.server.URL + "/api/lots/LOT_404")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("不存在的批次应返回 404, 得到 %d", resp.StatusCode)
+	}
+}
+
+func TestSimulator_RunScenarioFile(t *testing.T) {
+	app := newTestApp(t, false)
+	dir := t.TempDir()
+	app.simulator.SetScriptsDir(dir)
+
+	// 电测失败一次使 P1 失败，P2 在 CAM 维护期间到达而失败，P3 在维护结束后完成
+	outage := `name: outage
+timeline:
+  - at: 0s
+    fail: {station: station_e_test, count: 1}
+  - at: 0s
+    submit: {id: P1, type: PCB_PROTOTYPE}
+  - at: 300ms
+    maintenance: {station: STATION_CAM, duration: 300ms}
+  - at: 350ms
+    submit: {id: P2, type: PCB_PROTOTYPE}
+  - at: 800ms
+    submit: {id: P3, type: PCB_PROTOTYPE}
+expect:
+  timeout: 10s
+  completed: 1
+  failed: 2
+  products: {P1: failed, P2: failed, P3: completed}
+`
+	// 预期与实际结果不符的场景
+	wrong := `timeline:
+  - at: 0s
+    submit: {id: W1, type: PCB_PROTOTYPE}
+expect:
+  failed: 1
+`
+	os.WriteFile(filepath.Join(dir, "outage.yaml"), []byte(outage), 0o644)
+	os.WriteFile(filepath.Join(dir, "wrong.yml"), []byte(wrong), 0o644)
+
+	run := func(name string) (int, simulator.Run) {
+		t.Helper()
+		resp, err := http.Post(app.server.URL+"/api/sim/run/"+name+"?wait=true", "application/json", nil)
+		if err != nil {
+			t.Fatalf("运行场景失败: %v", err)
+		}
+		defer resp.Body.Close()
+		var report simulator.Run
+		json.NewDecoder(resp.Body).Decode(&report)
+		return resp.StatusCode, report
+	}
+
+	resp, err := http.Get(app.server.URL + "/api/v1/sim/scenarios")
+	if err != nil {
+		t.Fatalf("查询场景列表失败: %v", err)
+	}
+	var scripts []simulator.Script
+	json.NewDecoder(resp.Body).Decode(&scripts)
+	resp.Body.Close()
+	if len(scripts) != 2 || scripts[0].Name != "outage" || scripts[1].Name != "wrong" {
+		t.Fatalf("场景列表应包含 outage 和 wrong, 得到 %+v", scripts)
+	}
+
+	code, report := run("outage")
+	if code != http.StatusOK || report.Status != simulator.RunPassed {
+		t.Fatalf("outage 场景应通过, 得到 %d %+v", code, report)
+	}
+	if report.Counts[simulator.OutcomeCompleted] != 1 || report.Counts[simulator.OutcomeFailed] != 2 {
+		t.Errorf("结果统计错误: %+v", report.Counts)
+	}
+	if p, ok := app.stateTracker.GetProduct("P3"); !ok || p.Status != "COMPLETED" {
+		t.Errorf("P3 应已完成, 得到 %+v", p)
+	}
+
+	code, report = run("wrong")
+	if code != http.StatusOK || report.Status != simulator.RunFailed || len(report.Failures) != 1 {
+		t.Fatalf("预期不符的场景应失败并列出未满足的预期, 得到 %d %+v", code, report)
+	}
+	if report.Outcomes["W1"] != simulator.OutcomeCompleted {
+		t.Errorf("W1 应已完成, 得到 %+v", report.Outcomes)
+	}
+
+	resp, err = http.Get(app.server.URL + "/api/v1/sim/run")
+	if err != nil {
+		t.Fatalf("查询运行报告失败: %v", err)
+	}
+	json.NewDecoder(resp.Body).Decode(&report)
+	resp.Body.Close()
+	if report.Scenario != "wrong" || report.ID != 2 {
+		t.Errorf("最近一次运行应为 wrong, 得到 %+v", report)
+	}
+	if code, _ := run("missing"); code != http.StatusNotFound {
+		t.Errorf("不存在的场景应返回 404, 得到 %d", code)
+	}
+}
+
+func TestTaskUpload_CSVAndXLSX(t *testing.T) {
+	app := newTestApp(t, false)
+
+	upload := func(query, contentType string, body []byte) (int, api.UploadResult) {
+		t.Helper()
+		resp, err := http.Post(app.server.URL+"/api/v1/tasks/upload"+query, contentType, bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("上传订单清单失败: %v", err)
+		}
+		defer resp.Body.Close()
+		var result api.UploadResult
+		json.NewDecoder(resp.Body).Decode(&result)
+		return resp.StatusCode, result
+	}
+
+	// 第 3 行优先级无效，第 4 行产品类型未知，第 5 行订单 ID 重复，第 6 行不填 ID 由批次号生成
+	csvData := "\ufeffID,Type,Priority,Layers,Due Date\n" +
+		"UP_001,pcb_multilayer,5,6,2026-11-01\n" +
+		"UP_002,PCB_DOUBLE_LAYER,high,2,\n" +
+		"UP_003,PCB_UNKNOWN,1,,\n" +
+		"UP_001,PCB_PROTOTYPE,1,,\n" +
+		",PCB_PROTOTYPE,,,2026/11/02\n" +
+		",,,,\n"
+	code, result := upload("?lot=LOT_TEST", "text/csv", []byte(csvData))
+	if code != http.StatusAccepted || result.LotID != "LOT_TEST" {
+		t.Fatalf("上传 CSV 应返回 202, 得到 %d %+v", code, result)
+	}
+	if len(result.Accepted) != 2 || result.Accepted[0].ID != "UP_001" || result.Accepted[1].ID != "LOT_TEST_006" {
+		t.Errorf("通过校验的订单不符合预期: %+v", result.Accepted)
+	}
+	errRows := map[int]string{}
+	for _, e := range result.Errors {
+		errRows[e.Row] = e.Column
+	}
+	if len(result.Errors) != 3 || errRows[3] != "priority" || errRows[4] != "type" || errRows[5] != "id" {
+		t.Errorf("逐行校验错误不符合预期: %+v", result.Errors)
+	}
+	p, ok := app.stateTracker.GetProduct("UP_001")
+	if !ok || p.Type != "PCB_MULTILAYER" || p.Priority != 5 || p.Attrs["lot_id"] != "LOT_TEST" || !strings.HasPrefix(p.Attrs["due_date"].(string), "2026-11-01") {
+		t.Errorf("上传的订单未按清单提交: %+v", p)
+	}
+
+	// 再次上传相同的订单 ID 时整批被拒绝
+	if code, result := upload("", "text/csv", []byte("id,type\nUP_001,PCB_PROTOTYPE\n")); code != http.StatusUnprocessableEntity || len(result.Errors) != 1 {
+		t.Errorf("订单 ID 与已有任务重复时应返回 422, 得到 %d %+v", code, result)
+	}
+	if code, _ := upload("", "text/csv", []byte("id,priority\nUP_009,1\n")); code != http.StatusUnprocessableEntity {
+		t.Errorf("缺少 type 列时应返回 422, 得到 %d", code)
+	}
+
+	// XLSX 以 multipart 上传，交期为设置了日期格式的单元格
+	f := excelize.NewFile()
+	sheet := f.GetSheetName(0)
+	f.SetSheetRow(sheet, "A1", &[]interface{}{"order_id", "product_type", "priority", "layers", "due_date"})
+	f.SetSheetRow(sheet, "A2", &[]interface{}{"UP_XLSX_1", "PCB_DOUBLE_LAYER", 2, 2, time.Date(2026, 12, 24, 0, 0, 0, 0, time.UTC)})
+	f.SetSheetRow(sheet, "A3", &[]interface{}{"UP_XLSX_2", "PCB_DOUBLE_LAYER", 1, 0})
+	var xlsx bytes.Buffer
+	if err := f.Write(&xlsx); err != nil {
+		t.Fatalf("生成 XLSX 失败: %v", err)
+	}
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "orders.xlsx")
+	fw.Write(xlsx.Bytes())
+	mw.Close()
+
+	code, result = upload("?dry_run=true", mw.FormDataContentType(), body.Bytes())
+	if code != http.StatusAccepted || !result.DryRun || len(result.Accepted) != 1 || len(result.Errors) != 1 || result.Errors[0].Column != "layers" {
+		t.Fatalf("XLSX 试运行结果不符合预期: %d %+v", code, result)
+	}
+	if _, ok := app.stateTracker.GetProduct("UP_XLSX_1"); ok {
+		t.Error("dry_run 时不应提交订单")
+	}
+	code, _ = upload("", mw.FormDataContentType(), body.Bytes())
+	p, ok = app.stateTracker.GetProduct("UP_XLSX_1")
+	if code != http.StatusAccepted || !ok || !strings.HasPrefix(p.Attrs["due_date"].(string), "2026-12-24") {
+		t.Errorf("XLSX 订单未提交或交期不正确: %d %+v", code, p)
+	}
+}
+
+func TestB2MML_ImportScheduleViaAPIAndWatchedDir(t *testing.T) {
+	app := newTestApp(t, false)
+
+	importSchedule := func(query, body string) (int, b2mml.Result) {
+		t.Helper()
+		resp, err := http.Post(app.server.URL+"/api/v1/tasks/b2mml"+query, "application/xml", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("导入排产计划失败: %v", err)
+		}
+		defer resp.Body.Close()
+		var result b2mml.Result
+		json.NewDecoder(resp.Body).Decode(&result)
+		return resp.StatusCode, result
+	}
+
+	// PR-001 按 segment_types 映射为双面板并拆分为 3 块拼板；PR-002 的第一个段需求直接以工艺段 ID 作为产品类型，
+	// 第二个段需求的工艺段未映射；PR-003 的优先级无效
+	schedule := `<?xml version="1.0" encoding="UTF-8"?>
+<ProductionSchedule xmlns="http://www.mesa.org/xml/B2MML">
+  <ID>PS-TEST</ID>
+  <ProductionRequest>
+    <ID>B2_001</ID>
+    <Priority>4</Priority>
+    <EndTime>2026-11-01T17:00:00Z</EndTime>
+    <SegmentRequirement>
+      <ID>SR-1</ID>
+      <ProcessSegmentID>seg_pcb_2l</ProcessSegmentID>
+      <MaterialProducedRequirement>
+        <MaterialDefinitionID>PCB-2L-100</MaterialDefinitionID>
+        <Quantity><QuantityString>3</QuantityString><UnitOfMeasure>EA</UnitOfMeasure></Quantity>
+      </MaterialProducedRequirement>
+    </SegmentRequirement>
+  </ProductionRequest>
+  <ProductionRequest>
+    <ID>B2_002</ID>
+    <SegmentRequirement>
+      <ID>SR-1</ID>
+      <ProcessSegmentID>PCB_PROTOTYPE</ProcessSegmentID>
+      <LatestEndTime>2026-11-02T08:00:00Z</LatestEndTime>
+    </SegmentRequirement>
+    <SegmentRequirement>
+      <ID>SR-2</ID>
+      <ProcessSegmentID>SEG_FLEX</ProcessSegmentID>
+    </SegmentRequirement>
+  </ProductionRequest>
+  <ProductionRequest>
+    <ID>B2_003</ID>
+    <Priority>urgent</Priority>
+    <SegmentRequirement><ProcessSegmentID>PCB_PROTOTYPE</ProcessSegmentID></SegmentRequirement>
+  </ProductionRequest>
+</ProductionSchedule>`
+
+	code, result := importSchedule("?dry_run=true", schedule)
+	if code != http.StatusAccepted || !result.DryRun || len(result.Accepted) != 2 || len(result.Errors) != 2 {
+		t.Fatalf("试运行结果不符合预期: %d %+v", code, result)
+	}
+	if _, ok := app.stateTracker.GetProduct("B2_002_SR-1"); ok {
+		t.Error("dry_run 时不应提交工件")
+	}
+
+	code, result = importSchedule("", schedule)
+	if code != http.StatusAccepted || result.ScheduleID != "PS-TEST" || len(result.Accepted) != 2 {
+		t.Fatalf("导入排产计划应返回 202, 得到 %d %+v", code, result)
+	}
+	if a := result.Accepted[0]; a.ID != "B2_001" || a.Type != "PCB_DOUBLE_LAYER" || a.Quantity != 3 || len(a.Panels) != 3 {
+		t.Errorf("数量为 3 的段需求应拆分为批次, 得到 %+v", a)
+	}
+	errFields := map[string]string{}
+	for _, e := range result.Errors {
+		errFields[e.Request] = e.Field
+	}
+	if errFields["B2_002"] != "ProcessSegmentID" || errFields["B2_003"] != "Priority" {
+		t.Errorf("校验错误不符合预期: %+v", result.Errors)
+	}
+	p, ok := app.stateTracker.GetProduct("B2_001_P002")
+	if !ok || p.Lot != "B2_001" || p.Priority != 4 || p.Attrs["material"] != "PCB-2L-100" || p.Attrs["schedule_id"] != "PS-TEST" {
+		t.Errorf("拼板未继承生产请求的属性: %+v", p)
+	}
+	p, ok = app.stateTracker.GetProduct("B2_002_SR-1")
+	if !ok || p.Type != "PCB_PROTOTYPE" || !strings.HasPrefix(p.Attrs["due_date"].(string), "2026-11-02") {
+		t.Errorf("段需求应以最晚结束时间作为交期: %+v", p)
+	}
+
+	// 重复导入时所有段需求都被拒绝，不是排产计划的文件返回 422
+	if code, result := importSchedule("", schedule); code != http.StatusUnprocessableEntity || len(result.Accepted) != 0 {
+		t.Errorf("重复导入应返回 422, 得到 %d %+v", code, result)
+	}
+	if code, _ := importSchedule("", `<OperationsSchedule><ID>X</ID></OperationsSchedule>`); code != http.StatusUnprocessableEntity {
+		t.Errorf("根元素不是 ProductionSchedule 时应返回 422, 得到 %d", code)
+	}
+
+	// 监视目录：可以导入的文件移入 processed，无法解析的文件移入 failed，都附带导入结果
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "ok.xml"), []byte(`<ProductionSchedule><ProductionRequest><ID>B2_DIR</ID>
+<SegmentRequirement><ProcessSegmentID>SEG_PCB_ML</ProcessSegmentID></SegmentRequirement></ProductionRequest></ProductionSchedule>`), 0o644)
+	os.WriteFile(filepath.Join(dir, "bad.xml"), []byte("not xml"), 0o644)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go app.b2mml.Watch(ctx, dir, "line-b", 20*time.Millisecond)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, okErr := os.Stat(filepath.Join(dir, b2mml.ProcessedDir, "ok.xml.result.json"))
+		_, badErr := os.Stat(filepath.Join(dir, b2mml.FailedDir, "bad.xml.result.json"))
+		if okErr == nil && badErr == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("超时未导入监视目录中的排产计划")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ok.xml")); !os.IsNotExist(err) {
+		t.Errorf("导入后的文件应移出监视目录: %v", err)
+	}
+	p, ok = app.stateTracker.GetProduct("B2_DIR")
+	if !ok || p.Type != "PCB_MULTILAYER" || p.Namespace != "line-b" {
+		t.Errorf("目录导入的工件不符合预期: %+v", p)
+	}
+}
+
+func TestERPAdapter_PollsWithIdempotencyKeys(t *testing.T) {
+	app := newTestApp(t, false)
+	lots := lot.NewTracker(app.logger)
+	lots.Register(app.bus)
+
+	// SO-3 的产品代码未映射，修正后在下一次轮询时提交
+	var (
+		mu       sync.Mutex
+		fail     bool
+		itemCode = "FG-X"
+	)
+	erpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if fail || r.Header.Get("Authorization") != "Bearer erp-token" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"data": {"orders": [
+			{"order_no": "SO-1", "item": {"code": "fg-2l", "layers": 4}, "priority": 3, "promised_date": "2026-11-05"},
+			{"order_no": "SO-2", "item": {"code": "FG-2L"}, "qty": 2},
+			{"order_no": "SO-3", "item": {"code": %q}}
+		]}}`, itemCode)
+	}))
+	defer erpServer.Close()
+
+	opts := erp.Options{
+		URL:             erpServer.URL,
+		Headers:         map[string]string{"Authorization": "Bearer erp-token"},
+		Records:         "data.orders",
+		IntervalSeconds: 3600,
+		TimeoutSeconds:  5,
+		StateFile:       filepath.Join(t.TempDir(), "erp_keys.json"),
+		Fields:          erp.Fields{Key: "order_no", Type: "item.code", Priority: "priority", DueDate: "promised_date", Quantity: "qty", Attrs: map[string]string{"layers": "item.layers"}},
+		TypeMap:         map[string]string{"fg-2l": "PCB_DOUBLE_LAYER"},
+	}
+	adapter, err := erp.New(opts, app.scheduler, app.stateTracker, lots, app.metrics, app.logger)
+	if err != nil {
+		t.Fatalf("创建 ERP 适配器失败: %v", err)
+	}
+	apiServer := api.NewServer(app.scheduler, app.hub, app.stateTracker, app.history, "", nil, nil, app.metrics, app.logger)
+	apiServer.SetERP(adapter)
+	server := httptest.NewServer(apiServer.Handler())
+	defer server.Close()
+
+	poll := func() (int, erp.Status) {
+		t.Helper()
+		resp, err := http.Post(server.URL+"/api/v1/integrations/erp/poll", "application/json", nil)
+		if err != nil {
+			t.Fatalf("触发轮询失败: %v", err)
+		}
+		defer resp.Body.Close()
+		var status erp.Status
+		json.NewDecoder(resp.Body).Decode(&status)
+		return resp.StatusCode, status
+	}
+
+	code, status := poll()
+	if code != http.StatusOK || status.Submitted != 2 || status.Rejected != 1 || status.Keys != 2 {
+		t.Fatalf("第一次轮询结果不符合预期: %d %+v", code, status)
+	}
+	if len(status.Recent) != 3 || status.Recent[0].Key != "SO-3" || status.Recent[0].Result != erp.ResultRejected {
+		t.Errorf("最近的导入记录不符合预期: %+v", status.Recent)
+	}
+	p, ok := app.stateTracker.GetProduct("SO-1")
+	if !ok || p.Type != "PCB_DOUBLE_LAYER" || p.Priority != 3 || p.Attrs["layers"] != float64(4) || p.Attrs["erp_order"] != "SO-1" {
+		t.Errorf("订单未按字段映射转换: %+v", p)
+	}
+	if progress, ok := lots.Get("SO-2"); !ok || progress.Quantity != 2 {
+		t.Errorf("数量为 2 的订单应拆分为批次: %+v", progress)
+	}
+
+	// 再次轮询时已提交的订单被跳过，拒绝原因不变时不重复计数
+	code, status = poll()
+	if code != http.StatusOK || status.Submitted != 2 || status.Duplicates != 2 || status.Rejected != 1 {
+		t.Errorf("重复轮询不应重复提交: %d %+v", code, status)
+	}
+	mu.Lock()
+	itemCode = "FG-2L"
+	mu.Unlock()
+	if _, status = poll(); status.Submitted != 3 || status.Keys != 3 {
+		t.Errorf("修正后的订单应被提交: %+v", status)
+	}
+
+	// 重启后从 state_file 加载幂等键，不会重复提交
+	restarted, err := erp.New(opts, app.scheduler, app.stateTracker, lots, app.metrics, app.logger)
+	if err != nil {
+		t.Fatalf("重新创建 ERP 适配器失败: %v", err)
+	}
+	if err := restarted.Poll(context.Background()); err != nil {
+		t.Fatalf("轮询失败: %v", err)
+	}
+	if s := restarted.Status(); s.Keys != 3 || s.Submitted != 0 || s.Duplicates != 3 {
+		t.Errorf("重启后不应重复提交: %+v", s)
+	}
+
+	mu.Lock()
+	fail = true
+	mu.Unlock()
+	code, status = poll()
+	if code != http.StatusBadGateway || status.LastError == "" || status.Polls != 4 {
+		t.Errorf("ERP 不可用时应返回 502 并记录错误, 得到 %d %+v", code, status)
+	}
+	resp, err := http.Get(server.URL + "/api/v1/integrations/erp")
+	if err != nil {
+		t.Fatalf("查询导入状态失败: %v", err)
+	}
+	json.NewDecoder(resp.Body).Decode(&status)
+	resp.Body.Close()
+	if status.Source != erpServer.URL || status.LastSuccessAt.IsZero() || !status.LastPollAt.After(status.LastSuccessAt) {
+		t.Errorf("导入状态不符合预期: %+v", status)
+	}
+
+	// 投递目录中的 CSV 使用默认字段映射，无法解析的文件移入 failed
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "orders.csv"), []byte("id,type,priority\nSO-CSV-1,PCB_PROTOTYPE,2\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0o644)
+	dropped, err := erp.New(erp.Options{Dir: dir, Fields: erp.Fields{Key: "id", Type: "type", Priority: "priority"}}, app.scheduler, app.stateTracker, lots, app.metrics, app.logger)
+	if err != nil {
+		t.Fatalf("创建 ERP 适配器失败: %v", err)
+	}
+	if err := dropped.Poll(context.Background()); err == nil {
+		t.Error("无法解析的文件应返回错误")
+	}
+	if p, ok := app.stateTracker.GetProduct("SO-CSV-1"); !ok || p.Priority != 2 {
+		t.Errorf("CSV 订单未提交: %+v", p)
+	}
+	if _, err := os.Stat(filepath.Join(dir, erp.FailedDir, "broken.json")); err != nil {
+		t.Errorf("无法解析的文件应移入 failed: %v", err)
+	}
+}
+
+// fakeSMTP 是只支持收信的最小 SMTP 服务器，收到的每封邮件 (DATA 内容) 写入 mails
+func fakeSMTP(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	mails := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				fmt.Fprint(conn, "220 fake ESMTP\r\n")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+					case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+						fmt.Fprint(conn, "250 fake\r\n")
+					case cmd == "DATA":
+						fmt.Fprint(conn, "354 go ahead\r\n")
+						var body strings.Builder
+						for {
+							l, err := r.ReadString('\n')
+							if err != nil || l == ".\r\n" {
+								break
+							}
+							body.WriteString(l)
+						}
+						mails <- body.String()
+						fmt.Fprint(conn, "250 queued\r\n")
+					case cmd == "QUIT":
+						fmt.Fprint(conn, "221 bye\r\n")
+						return
+					default:
+						fmt.Fprint(conn, "250 ok\r\n")
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), mails
+}
+
+func TestNotifier_ChannelsTemplatesAndRateLimit(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	m := metrics.New(metrics.NewRegistry())
+
+	var (
+		mu       sync.Mutex
+		webhooks []notify.Notification
+		slack    []string
+	)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n notify.Notification
+		json.NewDecoder(r.Body).Decode(&n)
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer hook" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		webhooks = append(webhooks, n)
+	}))
+	defer webhook.Close()
+	slackServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ Text string }
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		defer mu.Unlock()
+		slack = append(slack, body.Text)
+	}))
+	defer slackServer.Close()
+	smtpAddr, mails := fakeSMTP(t)
+
+	// 配置校验：未知的事件和无法解析的模板都被拒绝
+	if err := (notify.Channel{Name: "x", Type: notify.ChannelSlack, URL: slackServer.URL, Events: []string{"product_done"}}).Validate(); err == nil {
+		t.Error("预期未知事件的通道校验失败")
+	}
+	if err := (notify.Channel{Name: "x", Type: notify.ChannelWebhook, URL: webhook.URL, Template: "{{.Summary"}).Validate(); err == nil {
+		t.Error("预期模板无法解析的通道校验失败")
+	}
+
+	opts := notify.Options{QueueSize: 10, TimeoutSeconds: 5, Channels: []notify.Channel{
+		{Name: "hook", Type: notify.ChannelWebhook, URL: webhook.URL, Headers: map[string]string{"Authorization": "Bearer hook"}},
+		// 每分钟 1 条、突发 1 条：第二个事件被限流
+		{Name: "oncall", Type: notify.ChannelSlack, URL: slackServer.URL, Events: []string{notify.EventStationDown, notify.EventProductFailed},
+			Template: "{{.Event}} {{.StationID}} {{.ProductID}}", RatePerMinute: 1, Burst: 1},
+		{Name: "mail", Type: notify.ChannelSMTP, Events: []string{notify.EventCompensationFailed}, Subject: "补偿失败 {{.ProductID}}",
+			SMTP: notify.SMTPOptions{Addr: smtpAddr, From: "factory@example.com", To: []string{"qa@example.com"}}},
+	}}
+	notifier, err := notify.New(opts, m, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus := event.NewBus()
+	notifier.Register(bus)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go notifier.Run(ctx)
+
+	// 事件处理器是异步执行的，逐个发布并等待投递，保证限流作用在第二个事件上
+	delivered := func(n int) {
+		t.Helper()
+		for i := 0; i < 100; i++ {
+			if len(notifier.Status().Recent) >= n {
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		t.Fatalf("等待第 %d 条投递记录超时: %+v", n, notifier.Status().Recent)
+	}
+	product := &types.Product{ID: "NT_1", Type: "PCB_TEST", Namespace: "line-a"}
+	bus.Publish(event.Event{Type: event.StationStatusChanged, StationID: types.StationDrill, ToState: string(fsm.StationIdle)})
+	bus.Publish(event.Event{Type: event.StationStatusChanged, StationID: types.StationDrill, ToState: string(fsm.StationDown)})
+	delivered(2)
+	bus.Publish(event.Event{Type: event.ProductFailed, ProductID: product.ID, Product: product, StationID: types.StationETest, Error: errors.New("open circuit"), TraceID: "trace-nt"})
+	delivered(4)
+	bus.Publish(event.Event{Type: event.CompensationFailed, ProductID: product.ID, Product: product, StationID: types.StationDrill, Error: errors.New("compensate timeout")})
+	delivered(6)
+
+	select {
+	case mail := <-mails:
+		if !strings.Contains(mail, "Subject: =?utf-8?q?") || !strings.Contains(mail, "To: qa@example.com") ||
+			!strings.Contains(mail, "工件 NT_1 在工站 STATION_DRILL 补偿失败") {
+			t.Errorf("邮件内容不正确:\n%s", mail)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("等待邮件超时")
+	}
+	// webhook 收到 3 条通知，IDLE 不通知；slack 只收到停机通知，失败通知被限流
+	status := notifier.Status()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(webhooks) != 3 || webhooks[0].Event != notify.EventStationDown || webhooks[1].Event != notify.EventProductFailed {
+		t.Fatalf("webhook 收到的通知不正确: %+v", webhooks)
+	}
+	if failed := webhooks[1]; failed.Severity != notify.SeverityCritical || failed.Namespace != "line-a" || failed.TraceID != "trace-nt" ||
+		failed.Text != "[critical] 工件 NT_1 (PCB_TEST) 生产失败，失败工站 STATION_E_TEST [line-a]: open circuit" {
+		t.Errorf("失败通知的内容不正确: %+v", failed)
+	}
+	if len(slack) != 1 || slack[0] != "station_down STATION_DRILL " {
+		t.Errorf("slack 应只收到停机通知, 得到 %q", slack)
+	}
+	channels := make(map[string]notify.ChannelStatus)
+	for _, c := range status.Channels {
+		channels[c.Name] = c
+	}
+	if c := channels["oncall"]; c.Sent != 1 || c.RateLimited != 1 {
+		t.Errorf("slack 通道的统计不正确: %+v", c)
+	}
+	if got := testutil.ToFloat64(m.NotificationsTotal.WithLabelValues("oncall", notify.EventProductFailed, notify.ResultRateLimited)); got != 1 {
+		t.Errorf("预期 1 条限流的失败通知, 得到 %v", got)
+	}
+	if got := testutil.ToFloat64(m.NotificationsTotal.WithLabelValues("mail", notify.EventCompensationFailed, notify.ResultSent)); got != 1 {
+		t.Errorf("预期 1 封补偿失败邮件, 得到 %v", got)
+	}
+}
+
+func TestSchedulerPlan_BatchesChangeoversAndFollowsPlan(t *testing.T) {
+	app := newTestApp(t, false)
+	app.scheduler.Pause()
+	if err := app.scheduler.SetMaxWorkers(1); err != nil {
+		t.Fatalf("调整 worker 数量失败: %v", err)
+	}
+	// 换型代价高、拖期权重大：计划应先做有交期的任务，再把同类型的任务排在一起
+	app.scheduler.SetPlanning(planner.Options{
+		DefaultDuration: 100 * time.Millisecond,
+		Changeovers:     []planner.Changeover{{Seconds: 10}},
+		MakespanWeight:  1,
+		TardinessWeight: 100,
+	})
+	for _, p := range []types.Product{
+		{ID: "Plan_A1", Type: "PCB_PROTOTYPE", Priority: 1},
+		{ID: "Plan_B1", Type: "PCB_DOUBLE_LAYER", Priority: 1},
+		{ID: "Plan_A2", Type: "PCB_PROTOTYPE", Priority: 1},
+		{ID: "Plan_B2", Type: "PCB_DOUBLE_LAYER", Priority: 1},
+		{ID: "Plan_Urgent", Type: "PCB_PROTOTYPE", DueAt: time.Now()},
+	} {
+		app.scheduler.SubmitTask(&p)
+	}
+
+	post := func(path string) planner.Plan {
+		t.Helper()
+		resp, err := http.Post(app.server.URL+path, "application/json", nil)
+		if err != nil {
+			t.Fatalf("生成派工计划失败: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("预期 200, 得到 %d", resp.StatusCode)
+		}
+		var plan planner.Plan
+		json.NewDecoder(resp.Body).Decode(&plan)
+		return plan
+	}
+
+	plan := post("/api/v1/admin/scheduler/plan?dry_run=true")
+	if len(plan.Jobs) != 5 || plan.Jobs[0].ProductID != "Plan_Urgent" {
+		t.Fatalf("有交期的任务应排在第一位, 得到 %+v", plan.Jobs)
+	}
+	if plan.Changeovers >= plan.Baseline.Changeovers || plan.Objective >= plan.Baseline.Objective {
+		t.Errorf("计划应减少换型并优于原顺序, 得到 %+v, 原顺序 %+v", plan.Score, plan.Baseline)
+	}
+	if state := app.scheduler.State(); state.Dispatch != web.DispatchPriority {
+		t.Errorf("dry_run 不应切换出队方式, 得到 %s", state.Dispatch)
+	}
+
+	plan = post("/api/v1/admin/scheduler/plan")
+	app.scheduler.SubmitTask(&types.Product{ID: "Plan_After", Type: "PCB_PROTOTYPE", Priority: 9})
+	state := app.scheduler.State()
+	if state.Dispatch != web.DispatchPlanned || len(state.Queue) != 6 {
+		t.Fatalf("预期按计划出队, 得到 %+v", state)
+	}
+	for i, a := range plan.Jobs {
+		if e := state.Queue[i]; e.ProductID != a.ProductID || !e.Planned {
+			t.Errorf("队列第 %d 位应为计划中的 %s, 得到 %+v", i+1, a.ProductID, e)
+		}
+	}
+	if last := state.Queue[5]; last.ProductID != "Plan_After" || last.Planned {
+		t.Errorf("计划之后提交的任务应排在计划之后, 得到 %+v", last)
+	}
+
+	// 计划内的任务全部出队后恢复按优先级出队
+	app.scheduler.Resume()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		state = app.scheduler.State()
+		if state.Dispatch == web.DispatchPriority && len(state.Queue) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("计划未执行完毕: %+v", state)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	resp, err := http.Get(app.server.URL + "/api/v1/admin/scheduler/plan")
+	if err != nil {
+		t.Fatalf("查询派工计划失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("计划执行完毕后应返回 404, 得到 %d", resp.StatusCode)
+	}
+}
+
+func TestGantt_PlannedVersusActualBars(t *testing.T) {
+	app := newTestApp(t, false)
+	app.scheduler.Pause()
+	if err := app.scheduler.SetMaxWorkers(1); err != nil {
+		t.Fatalf("调整 worker 数量失败: %v", err)
+	}
+	ids := []string{"Gantt_1", "Gantt_2"}
+	for _, id := range ids {
+		app.scheduler.SubmitTask(&types.Product{ID: id, Type: "PCB_PROTOTYPE"})
+	}
+
+	get := func() gantt.Chart {
+		t.Helper()
+		resp, err := http.Get(app.server.URL + "/api/v1/schedule/gantt?window=1h")
+		if err != nil {
+			t.Fatalf("查询甘特图失败: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("预期 200, 得到 %d", resp.StatusCode)
+		}
+		var chart gantt.Chart
+		json.NewDecoder(resp.Body).Decode(&chart)
+		return chart
+	}
+	bars := func(chart gantt.Chart, actual bool) int {
+		n := 0
+		for _, row := range chart.Stations {
+			if actual {
+				n += len(row.Actual)
+			} else {
+				n += len(row.Planned)
+			}
+		}
+		return n
+	}
+
+	// 没有派工计划时按出队顺序估算
+	chart := get()
+	if chart.Source != gantt.SourceForecast || bars(chart, false) == 0 || bars(chart, true) != 0 {
+		t.Fatalf("预期只有估算的计划条, 得到 %+v", chart)
+	}
+
+	resp, err := http.Post(app.server.URL+"/api/v1/admin/scheduler/plan", "application/json", nil)
+	if err != nil {
+		t.Fatalf("生成派工计划失败: %v", err)
+	}
+	resp.Body.Close()
+	if chart = get(); chart.Source != gantt.SourcePlan {
+		t.Fatalf("预期计划条来自派工计划, 得到 %s", chart.Source)
+	}
+	planned := bars(chart, false)
+
+	app.scheduler.Resume()
+	deadline := time.Now().Add(10 * time.Second)
+	for _, id := range ids {
+		for {
+			if r, ok := app.history.Get(id); ok && r.Outcome != "" {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("工件 %s 未完成", id)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	// 计划执行完毕后保留计划条，实际条与计划一一对应，并给出完工偏差
+	chart = get()
+	if bars(chart, false) != planned || bars(chart, true) != planned {
+		t.Errorf("预期 %d 段计划和实际加工, 得到 %+v", planned, chart.Stations)
+	}
+	if len(chart.Drift) != 2 || chart.Drift[0].ProductID != "Gantt_1" || chart.Drift[1].EndDriftSeconds == nil {
+		t.Errorf("预期两个工件的计划偏差, 得到 %+v", chart.Drift)
+	}
+}
+
+func TestWhatIf_SecondMachineShortensLeadTime(t *testing.T) {
+	app := newTestApp(t, false)
+
+	run := func(body string) (int, []whatif.Result) {
+		t.Helper()
+		resp, err := http.Post(app.server.URL+"/api/v1/whatif", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("what-if 仿真失败: %v", err)
+		}
+		defer resp.Body.Close()
+		var out struct {
+			Results []whatif.Result `json:"results"`
+		}
+		json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out.Results
+	}
+
+	// 飞针电测是瓶颈：同样的到达序列下增加一台设备，交付周期和排队都应下降
+	body := `{"scenarios": [
+		{"name": "baseline", "seed": 7, "rate": 90, "mix": {"PCB_PROTOTYPE": 1}, "orders": 200, "workers": 20,
+		 "machines": {"STATION_E_TEST": 1}, "cycle_ms": {"STATION_E_TEST": 1000}},
+		{"name": "second_etest", "seed": 7, "rate": 90, "mix": {"PCB_PROTOTYPE": 1}, "orders": 200, "workers": 20,
+		 "machines": {"STATION_E_TEST": 2}, "cycle_ms": {"STATION_E_TEST": 1000}}]}`
+	status, results := run(body)
+	if status != http.StatusOK || len(results) != 2 {
+		t.Fatalf("预期 200 和两个结果, 得到 %d %+v", status, results)
+	}
+	base, more := results[0], results[1]
+	if base.Completed != 200 || more.Completed != 200 {
+		t.Fatalf("没有失败率时所有订单都应完成, 得到 %d / %d", base.Completed, more.Completed)
+	}
+	if more.LeadTime.Avg >= base.LeadTime.Avg || more.ThroughputPerHour <= base.ThroughputPerHour {
+		t.Errorf("增加设备后交付周期应缩短、吞吐量应提高, 得到 %+v 和 %+v", base, more)
+	}
+	etest := func(r whatif.Result) whatif.StationResult {
+		i := slices.IndexFunc(r.Stations, func(s whatif.StationResult) bool { return s.ID == types.StationETest })
+		if i < 0 {
+			t.Fatalf("结果中缺少飞针电测工站: %+v", r.Stations)
+		}
+		return r.Stations[i]
+	}
+	if b, m := etest(base), etest(more); b.Utilization <= m.Utilization || b.Utilization > 1 || b.Queue.MaxLength <= m.Queue.MaxLength || m.Machines != 2 {
+		t.Errorf("单台设备的利用率和队列应高于两台设备, 得到 %+v 和 %+v", b, m)
+	}
+
+	// 相同的种子和参数得到完全相同的结果
+	if _, again := run(body); !reflect.DeepEqual(again, results) {
+		t.Errorf("相同的种子应得到相同的结果")
+	}
+
+	if status, _ := run(`{"scenarios": [{"rate": 0, "mix": {"PCB_PROTOTYPE": 1}}]}`); status != http.StatusBadRequest {
+		t.Errorf("无效的场景应返回 400, 得到 %d", status)
+	}
+}
+
+func TestChaos_InjectedFailureTriggersSagaWithDroppedCompensation(t *testing.T) {
+	app := newTestApp(t, false)
+	compensationFailed := make(chan event.Event, 4)
+	app.bus.Subscribe(event.CompensationFailed, func(e event.Event) { compensationFailed <- e })
+
+	inject := func(body string) (int, chaos.Fault) {
+		t.Helper()
+		resp, err := http.Post(app.server.URL+"/api/chaos", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("注入故障失败: %v", err)
+		}
+		defer resp.Body.Close()
+		var fault chaos.Fault
+		json.NewDecoder(resp.Body).Decode(&fault)
+		return resp.StatusCode, fault
+	}
+	for _, body := range []string{
+		`{"station_id": "STATION_E_TEST", "failure_rate": 1}`,
+		`{"station_id": "STATION_E_TEST", "duration_seconds": 60}`,
+		`{"station_id": "STATION_E_TEST", "failure_rate": 1.5, "duration_seconds": 60}`,
+		`{"station_id": "STATION_404", "crash": true, "duration_seconds": 60}`,
+	} {
+		if code, _ := inject(body); code != http.StatusBadRequest {
+			t.Errorf("无效的故障 %s 应返回 400, 得到 %d", body, code)
+		}
+	}
+
+	// 电测必定失败，CAM 的补偿被丢弃
+	code, etest := inject(`{"station_id": "station_e_test", "failure_rate": 1, "duration_seconds": 60}`)
+	if code != http.StatusCreated || etest.StationID != types.StationETest || etest.ExpiresAt.Sub(etest.CreatedAt) != time.Minute {
+		t.Fatalf("注入电测故障失败: %d %+v", code, etest)
+	}
+	if code, _ := inject(`{"station_id": "STATION_CAM", "drop_compensations": true, "duration_seconds": 60}`); code != http.StatusCreated {
+		t.Fatalf("注入补偿丢弃失败: %d", code)
+	}
+
+	submit := func(id string) {
+		t.Helper()
+		resp, err := http.Post(app.server.URL+"/api/tasks", "application/json", strings.NewReader(`{"id": "`+id+`", "type": "PCB_PROTOTYPE"}`))
+		if err != nil {
+			t.Fatalf("提交任务失败: %v", err)
+		}
+		resp.Body.Close()
+	}
+	waitStatus := func(id, want string) {
+		t.Helper()
+		for range 100 {
+			if s, ok := app.stateTracker.GetProduct(id); ok && s.Status == want {
+				return
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		s, _ := app.stateTracker.GetProduct(id)
+		t.Fatalf("%s 的状态应为 %s, 得到 %s", id, want, s.Status)
+	}
+
+	submit("CHAOS_01")
+	waitStatus("CHAOS_01", "COMPENSATED")
+	select {
+	case e := <-compensationFailed:
+		if e.ProductID != "CHAOS_01" || e.StationID != types.StationCAM || !errors.Is(e.Error, chaos.ErrDropped) {
+			t.Errorf("补偿失败事件错误: %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("超时未收到补偿失败事件")
+	}
+
+	resp, err := http.Get(app.server.URL + "/api/v1/chaos")
+	if err != nil {
+		t.Fatalf("查询故障失败: %v", err)
+	}
+	var faults []chaos.Fault
+	json.NewDecoder(resp.Body).Decode(&faults)
+	resp.Body.Close()
+	if len(faults) != 2 || faults[0].Counts.Failures != 1 || faults[1].Counts.Compensations != 1 {
+		t.Errorf("故障的生效次数错误: %+v", faults)
+	}
+
+	// 结束电测故障后工件正常完成
+	remove := func(id string) int {
+		req, _ := http.NewRequest(http.MethodDelete, app.server.URL+"/api/v1/chaos/"+id, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("结束故障失败: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := remove(etest.ID); code != http.StatusOK {
+		t.Fatalf("结束故障应返回 200, 得到 %d", code)
+	}
+	if code := remove(etest.ID); code != http.StatusNotFound {
+		t.Errorf("已结束的故障应返回 404, 得到 %d", code)
+	}
+	submit("CHAOS_02")
+	waitStatus("CHAOS_02", "COMPLETED")
+}
+
+func TestReplay_RecordedRunReproducesOutcomes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.jsonl")
+	want := map[string]string{"REC_01": "COMPLETED", "REC_02": "COMPENSATED", "REC_03": "COMPLETED"}
+	waitStatus := func(app *testApp, ids ...string) {
+		t.Helper()
+		for range 200 {
+			done := true
+			for _, id := range ids {
+				if s, ok := app.stateTracker.GetProduct(id); !ok || s.Status != want[id] {
+					done = false
+				}
+			}
+			if done {
+				return
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		for _, id := range ids {
+			s, _ := app.stateTracker.GetProduct(id)
+			t.Errorf("%s 的状态应为 %s, 得到 %s", id, want[id], s.Status)
+		}
+		t.FailNow()
+	}
+
+	// 录制：REC_02 在电测注入失败
+	live := newTestApp(t, false)
+	recorder, err := replay.Create(path, live.logger)
+	if err != nil {
+		t.Fatalf("创建回放文件失败: %v", err)
+	}
+	recorder.Register(live.bus)
+	live.scheduler.SetRecorder(recorder)
+	live.scheduler.SubmitTask(&types.Product{ID: "REC_01", Type: "PCB_PROTOTYPE"})
+	waitStatus(live, "REC_01")
+	// 注入的失败只落在 REC_02 上：REC_02 结束后才提交 REC_03
+	live.scheduler.Engine().Stations().InjectFailures(types.StationETest, 1)
+	live.scheduler.SubmitTask(&types.Product{ID: "REC_02", Type: "PCB_PROTOTYPE", Attrs: map[string]interface{}{"layers": 2}})
+	waitStatus(live, "REC_02")
+	live.scheduler.SubmitTask(&types.Product{ID: "REC_03", Type: "PCB_DOUBLE_LAYER", Priority: 3})
+	waitStatus(live, "REC_03")
+	time.Sleep(100 * time.Millisecond) // 等待异步的事件处理器写完录制
+	recorder.Close()
+
+	entries, err := replay.Load(path)
+	if err != nil {
+		t.Fatalf("读取回放文件失败: %v", err)
+	}
+	submits := 0
+	for _, e := range entries {
+		if e.Kind == replay.KindSubmit {
+			submits++
+		}
+	}
+	if submits != 3 {
+		t.Fatalf("应录制 3 次提交, 得到 %d", submits)
+	}
+
+	// 回放：所有工站返回录制的结果，不再注入失败
+	replayed := newTestApp(t, false)
+	replayer := replay.New(path, entries, 10, replayed.logger)
+	for _, info := range replayed.scheduler.Engine().Stations().List() {
+		replayed.scheduler.Engine().RegisterStation(replayer.Station(info.ID))
+	}
+	replayer.Run(context.Background(), replayed.scheduler)
+	waitStatus(replayed, "REC_01", "REC_02", "REC_03")
+
+	// 并行步骤中各工站的完成顺序不固定，按步骤和工站排序后比较
+	byStepAndStation := func(a, b history.StepRecord) int {
+		return cmp.Or(cmp.Compare(a.Step, b.Step), cmp.Compare(a.StationID, b.StationID))
+	}
+	for id := range want {
+		recorded, _ := live.history.Get(id)
+		got, _ := replayed.history.Get(id)
+		slices.SortStableFunc(recorded.Steps, byStepAndStation)
+		slices.SortStableFunc(got.Steps, byStepAndStation)
+		if len(got.Steps) != len(recorded.Steps) {
+			t.Fatalf("%s 的步骤数应为 %d, 得到 %d", id, len(recorded.Steps), len(got.Steps))
+		}
+		for i := range recorded.Steps {
+			w, g := recorded.Steps[i], got.Steps[i]
+			if g.StationID != w.StationID || g.Success != w.Success || g.Error != w.Error || !reflect.DeepEqual(g.Defect, w.Defect) {
+				t.Errorf("%s 的第 %d 步回放结果不一致: 录制 %+v, 回放 %+v", id, i, w, g)
+			}
+		}
+	}
+	if s := replayer.Status(); s.Submitted != 3 || s.Remaining != 0 || len(s.Divergences) != 0 || s.Running {
+		t.Errorf("回放进度错误: %+v", s)
+	}
+}
+
+func TestOPCUA_BrowseAndReadFactoryState(t *testing.T) {
+	app := newTestApp(t, false)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("获取空闲端口失败: %v", err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	uaServer := opcua.NewServer(addr, app.stateTracker, app.logger)
+	if err := uaServer.Start(ctx); err != nil {
+		t.Fatalf("启动 OPC UA 服务失败: %v", err)
+	}
+
+	app.scheduler.SubmitTask(&types.Product{ID: "Test_OPCUA_01", Type: "PCB_PROTOTYPE"})
+	for range 100 {
+		if s, ok := app.stateTracker.GetProduct("Test_OPCUA_01"); ok && s.Status == "COMPLETED" {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	time.Sleep(1500 * time.Millisecond) // 等待地址空间刷新
+
+	client, err := uaclient.NewClient("opc.tcp://"+addr, uaclient.SecurityMode(ua.MessageSecurityModeNone))
+	if err != nil {
+		t.Fatalf("创建 OPC UA 客户端失败: %v", err)
+	}
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("连接 OPC UA 服务失败: %v", err)
+	}
+	defer client.Close(ctx)
+	ns, err := client.FindNamespace(ctx, opcua.NamespaceURI)
+	if err != nil {
+		t.Fatalf("查找命名空间失败: %v", err)
+	}
+
+	// 从 Objects 文件夹可以浏览到工厂根节点，工站文件夹下列出所有工站
+	objects := client.Node(ua.NewNumericNodeID(0, id.ObjectsFolder))
+	children, err := objects.ReferencedNodes(ctx, id.HierarchicalReferences, ua.BrowseDirectionForward, ua.NodeClassAll, true)
+	if err != nil {
+		t.Fatalf("浏览 Objects 失败: %v", err)
+	}
+	if !slices.ContainsFunc(children, func(n *uaclient.Node) bool { return n.ID.String() == ua.NewStringNodeID(ns, "Factory").String() }) {
+		t.Fatalf("Objects 下应有 Factory 节点")
+	}
+	stations, err := client.Node(ua.NewStringNodeID(ns, "Factory/Stations")).ReferencedNodes(ctx, id.HierarchicalReferences, ua.BrowseDirectionForward, ua.NodeClassAll, true)
+	if err != nil {
+		t.Fatalf("浏览工站失败: %v", err)
+	}
+	if len(stations) != len(app.scheduler.Engine().Stations().List()) {
+		t.Errorf("应浏览到 %d 个工站, 得到 %d", len(app.scheduler.Engine().Stations().List()), len(stations))
+	}
+
+	read := func(path string) interface{} {
+		t.Helper()
+		resp, err := client.Read(ctx, &ua.ReadRequest{NodesToRead: []*ua.ReadValueID{{NodeID: ua.NewStringNodeID(ns, path), AttributeID: ua.AttributeIDValue}}})
+		if err != nil {
+			t.Fatalf("读取 %s 失败: %v", path, err)
+		}
+		if resp.Results[0].Status != ua.StatusOK {
+			t.Fatalf("读取 %s 的状态码为 %v", path, resp.Results[0].Status)
+		}
+		return resp.Results[0].Value.Value()
+	}
+	if v := read("Factory/Products/Test_OPCUA_01/Status"); v != "COMPLETED" {
+		t.Errorf("工件状态应为 COMPLETED, 得到 %v", v)
+	}
+	if v := read("Factory/Products/Test_OPCUA_01/Type"); v != "PCB_PROTOTYPE" {
+		t.Errorf("工件类型应为 PCB_PROTOTYPE, 得到 %v", v)
+	}
+	if v := read("Factory/Stations/" + string(types.StationCAM) + "/Status"); v != "IDLE" {
+		t.Errorf("CAM 工站状态应为 IDLE, 得到 %v", v)
+	}
+	if v := read("Factory/KPIs/WorkInProgress"); v != int32(0) {
+		t.Errorf("在制品数应为 0, 得到 %v", v)
+	}
+
+	// 地址空间只读
+	resp, err := client.Write(ctx, &ua.WriteRequest{NodesToWrite: []*ua.WriteValue{{
+		NodeID:      ua.NewStringNodeID(ns, "Factory/Products/Test_OPCUA_01/Status"),
+		AttributeID: ua.AttributeIDValue,
+		Value:       &ua.DataValue{EncodingMask: ua.DataValueValue, Value: ua.MustVariant("CANCELLED")},
+	}}})
+	if err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if resp.Results[0] != ua.StatusBadNotWritable {
+		t.Errorf("写入应返回 BadNotWritable, 得到 %v", resp.Results[0])
+	}
+}
+
+func TestSparkplug_BirthDataDeathAndRebirth(t *testing.T) {
+	app := newTestApp(t, false)
+
+	// 进程内的 MQTT Broker
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("获取空闲端口失败: %v", err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+	broker := mochi.New(&mochi.Options{Logger: app.logger})
+	broker.AddHook(new(mochiauth.AllowHook), nil)
+	if err := broker.AddListener(listeners.NewTCP(listeners.Config{ID: "test", Address: addr})); err != nil {
+		t.Fatalf("添加 Broker 监听失败: %v", err)
+	}
+	go broker.Serve()
+	t.Cleanup(func() { broker.Close() })
+
+	// 订阅组内的所有消息
+	type message struct {
+		topic   string
+		payload sparkplug.Payload
+	}
+	messages := make(chan message, 256)
+	sub := mqtt.NewClient(mqtt.NewClientOptions().AddBroker("tcp://" + addr).SetClientID("test-subscriber"))
+	if token := sub.Connect(); !token.WaitTimeout(5*time.Second) || token.Error() != nil {
+		t.Fatalf("订阅方连接 Broker 失败: %v", token.Error())
+	}
+	defer sub.Disconnect(0)
+	if token := sub.Subscribe("spBv1.0/Demo/#", 1, func(_ mqtt.Client, msg mqtt.Message) {
+		payload, err := sparkplug.Unmarshal(msg.Payload())
+		if err != nil {
+			t.Errorf("无法解析 %s 的载荷: %v", msg.Topic(), err)
+			return
+		}
+		messages <- message{msg.Topic(), payload}
+	}); !token.WaitTimeout(5*time.Second) || token.Error() != nil {
+		t.Fatalf("订阅失败: %v", token.Error())
+	}
+	waitMessage := func(topic string, match func(sparkplug.Payload) bool) sparkplug.Payload {
+		t.Helper()
+		timeout := time.After(10 * time.Second)
+		for {
+			select {
+			case msg := <-messages:
+				if msg.topic == topic && (match == nil || match(msg.payload)) {
+					return msg.payload
+				}
+			case <-timeout:
+				t.Fatalf("没有收到 %s", topic)
+			}
+		}
+	}
+	metric := func(p sparkplug.Payload, name string) any {
+		m, _ := p.Metric(name)
+		return m.Value
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	publisher := sparkplug.New(sparkplug.Options{Broker: "tcp://" + addr, ClientID: "test-edge", GroupID: "Demo", EdgeNodeID: "Line1", IntervalMs: 50}, app.stateTracker, app.metrics, app.logger)
+	publisher.Register(app.bus)
+	done := make(chan struct{})
+	go func() {
+		publisher.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// 出生证书：NBIRTH 的序号为 0，携带 bdSeq 和 Rebirth 控制指标；每个工站一个 DBIRTH
+	birth := waitMessage("spBv1.0/Demo/NBIRTH/Line1", nil)
+	if birth.Seq != 0 || metric(birth, sparkplug.MetricBdSeq) != uint64(0) || metric(birth, sparkplug.MetricRebirth) != false {
+		t.Errorf("NBIRTH 不正确: %+v", birth)
+	}
+	cam := "spBv1.0/Demo/DBIRTH/Line1/" + string(types.StationCAM)
+	if dbirth := waitMessage(cam, nil); metric(dbirth, "Status") != "IDLE" || metric(dbirth, "Products/Processed") != int64(0) {
+		t.Errorf("CAM 的 DBIRTH 不正确: %+v", dbirth)
+	}
+
+	// 加工后只发布变化的指标：CAM 的加工数和节点的完成数，两者可能在同一轮检查中发布
+	app.scheduler.SubmitTask(&types.Product{ID: "Test_SPB_01", Type: "PCB_PROTOTYPE"})
+	processed, completed := false, false
+	for !processed || !completed {
+		select {
+		case msg := <-messages:
+			switch msg.topic {
+			case "spBv1.0/Demo/DDATA/Line1/" + string(types.StationCAM):
+				processed = processed || metric(msg.payload, "Products/Processed") == int64(1)
+			case "spBv1.0/Demo/NDATA/Line1":
+				completed = completed || metric(msg.payload, "Products/Completed") == int32(1)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("没有收到变化的指标: processed=%v completed=%v", processed, completed)
+		}
+	}
+
+	// 工站故障停机时发布 DDEATH，修复后重新发布 DBIRTH
+	app.stateTracker.ApplyStationStatus(types.StationCAM, string(fsm.StationDown), 1<<40)
+	waitMessage("spBv1.0/Demo/DDEATH/Line1/"+string(types.StationCAM), nil)
+	app.stateTracker.ApplyStationStatus(types.StationCAM, string(fsm.StationIdle), 1<<40+1)
+	waitMessage(cam, func(p sparkplug.Payload) bool { return metric(p, "Products/Processed") == int64(1) })
+
+	// Rebirth 请求：重新发布 NBIRTH，序号回到 0
+	ncmd, _ := sparkplug.Payload{Metrics: []sparkplug.Metric{{Name: sparkplug.MetricRebirth, Value: true}}}.Marshal()
+	sub.Publish("spBv1.0/Demo/NCMD/Line1", 1, false, ncmd).WaitTimeout(5 * time.Second)
+	rebirth := waitMessage("spBv1.0/Demo/NBIRTH/Line1", nil)
+	if rebirth.Seq != 0 || metric(rebirth, "Products/Completed") != int32(1) {
+		t.Errorf("重新发布的 NBIRTH 不正确: %+v", rebirth)
+	}
+
+	// 停止时发布与 NBIRTH 相同 bdSeq 的 NDEATH
+	cancel()
+	<-done
+	if death := waitMessage("spBv1.0/Demo/NDEATH/Line1", nil); metric(death, sparkplug.MetricBdSeq) != uint64(0) || death.HasSeq {
+		t.Errorf("NDEATH 不正确: %+v", death)
+	}
+	if v := testutil.ToFloat64(app.metrics.SparkplugMessagesPublishedTotal.WithLabelValues(sparkplug.NBirth)); v != 2 {
+		t.Errorf("应发布 2 次 NBIRTH, 得到 %v", v)
+	}
+}
+
+func TestCluster_LeaderElectionAndFailover(t *testing.T) {
+	app := newTestApp(t, false)
+	leaseFile := filepath.Join(t.TempDir(), "cluster.lease")
+	newNode := func(id string) *cluster.Elector {
+		opts := cluster.Options{Enabled: true, NodeID: id, AdvertiseURL: "http://" + id + ":8080", LeaseFile: leaseFile, LeaseTTLMs: 300}
+		return cluster.New(opts, metrics.New(metrics.NewRegistry()), app.logger)
+	}
+	waitFor := func(ch <-chan struct{}, what string) {
+		t.Helper()
+		select {
+		case <-ch:
+		case <-time.After(3 * time.Second):
+			t.Fatalf("%s 超时", what)
+		}
+	}
+
+	// node-a 先成为领导者，node-b 作为跟随者，调度器待命
+	nodeA, electedA := newNode("node-a"), make(chan struct{})
+	ctxA, stopA := context.WithCancel(context.Background())
+	doneA := make(chan struct{})
+	go func() {
+		defer close(doneA)
+		nodeA.Run(ctxA, func() { close(electedA) }, func() { t.Error("node-a 不应失去领导权") })
+	}()
+	waitFor(electedA, "node-a 当选")
+
+	app.scheduler.SetStandby(true)
+	nodeB, electedB := newNode("node-b"), make(chan struct{})
+	ctxB, stopB := context.WithCancel(context.Background())
+	defer stopB()
+	doneB := make(chan struct{})
+	go func() {
+		defer close(doneB)
+		nodeB.Run(ctxB, func() {
+			app.scheduler.SetStandby(false)
+			close(electedB)
+		}, nil)
+	}()
+
+	task := &types.Product{ID: "CLUSTER_1", Type: "PCB_PROTOTYPE"}
+	app.scheduler.SubmitTask(task)
+	time.Sleep(200 * time.Millisecond)
+	if nodeB.IsLeader() {
+		t.Fatal("租约有效时跟随者不应当选")
+	}
+	if state := app.scheduler.State(); state.Status != web.SchedulerStandby || len(state.Queue) != 1 {
+		t.Errorf("跟随者的调度器应待命且不出队: %+v", state)
+	}
+
+	// 跟随者把写请求重定向到领导者，读请求照常处理
+	apiServer := api.NewServer(app.scheduler, app.hub, app.stateTracker, app.history, "", nil, nil, app.metrics, app.logger)
+	apiServer.SetCluster(nodeB)
+	server := httptest.NewServer(apiServer.Handler())
+	defer server.Close()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Post(server.URL+"/api/v1/tasks", "application/json", strings.NewReader(`{"type": "PCB_PROTOTYPE"}`))
+	if err != nil {
+		t.Fatalf("提交任务失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTemporaryRedirect || resp.Header.Get("Location") != "http://node-a:8080/api/v1/tasks" {
+		t.Errorf("跟随者应以 307 重定向到领导者, 得到 %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	resp, err = client.Get(server.URL + "/api/v1/cluster")
+	if err != nil {
+		t.Fatalf("查询集群状态失败: %v", err)
+	}
+	var status cluster.Status
+	json.NewDecoder(resp.Body).Decode(&status)
+	resp.Body.Close()
+	if status.NodeID != "node-b" || status.Role != cluster.RoleFollower || status.Leader != "node-a" || status.Term != 1 {
+		t.Errorf("集群状态不符合预期: %+v", status)
+	}
+
+	// node-a 停机时释放租约，node-b 无需等待 TTL 即接管并开始出队
+	stopA()
+	<-doneA
+	released := time.Now()
+	waitFor(electedB, "node-b 接管")
+	if elapsed := time.Since(released); elapsed >= 300*time.Millisecond {
+		t.Errorf("释放租约后应立即接管, 耗时 %v", elapsed)
+	}
+	if status := nodeB.Status(); status.Role != cluster.RoleLeader || status.Leader != "node-b" || status.Term != 2 {
+		t.Errorf("接管后的集群状态不符合预期: %+v", status)
+	}
+	for i := 0; i < 20; i++ {
+		if p, ok := app.stateTracker.GetProduct(task.ID); ok && p.Status == "COMPLETED" {
+			break
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	if p, _ := app.stateTracker.GetProduct(task.ID); p.Status != "COMPLETED" {
+		t.Errorf("接管后待命期间的任务应被派发, 状态为 %s", p.Status)
+	}
+
+	// 领导者崩溃 (不释放租约) 时，其他节点在租约过期后接管
+	stopB()
+	<-doneB
+	os.WriteFile(leaseFile, []byte(fmt.Sprintf(`{"holder": "node-z", "term": 7, "expires_at": %q}`, time.Now().Add(300*time.Millisecond).Format(time.RFC3339Nano))), 0o644)
+	nodeC, electedC := newNode("node-c"), make(chan struct{})
+	ctxC, stopC := context.WithCancel(context.Background())
+	defer stopC()
+	start := time.Now()
+	go nodeC.Run(ctxC, func() { close(electedC) }, nil)
+	waitFor(electedC, "node-c 接管")
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Errorf("租约过期前不应接管, 耗时 %v", elapsed)
+	}
+	if status := nodeC.Status(); status.Term != 8 {
+		t.Errorf("接管后任期应加一: %+v", status)
+	}
+}
+
+func TestCluster_ConcurrentTakeoverElectsOneLeader(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+	// 上一任领导者崩溃：租约已过期，锁文件也留在磁盘上；多个跟随者同时接管，任何时刻最多只有一个领导者
+	// 竞争只发生在第一次接管的瞬间，重复多轮以覆盖不同的交错
+	for round := 0; round < 20; round++ {
+		leaseFile := filepath.Join(t.TempDir(), "cluster.lease")
+		expired := cluster.Lease{Holder: "crashed", Term: 1, ExpiresAt: time.Now().Add(-time.Minute)}
+		data, _ := json.Marshal(expired)
+		if err := os.WriteFile(leaseFile, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(leaseFile+".lock", nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		old := time.Now().Add(-time.Minute)
+		os.Chtimes(leaseFile+".lock", old, old)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var wg sync.WaitGroup
+		nodes := make([]*cluster.Elector, 16)
+		start := make(chan struct{})
+		for i := range nodes {
+			id := fmt.Sprintf("node-%d", i)
+			nodes[i] = cluster.New(cluster.Options{Enabled: true, NodeID: id, LeaseFile: leaseFile, LeaseTTLMs: 300}, metrics.New(metrics.NewRegistry()), logger)
+			wg.Add(1)
+			go func(e *cluster.Elector) {
+				defer wg.Done()
+				<-start
+				e.Run(ctx, nil, nil)
+			}(nodes[i])
+		}
+		close(start)
+		most, leaders := 0, 0
+		var status cluster.Status
+		for deadline := time.Now().Add(150 * time.Millisecond); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			leaders = 0
+			for _, e := range nodes {
+				if e.IsLeader() {
+					leaders++
+					status = e.Status()
+				}
+			}
+			most = max(most, leaders)
+		}
+		cancel()
+		wg.Wait()
+		if most != 1 || leaders != 1 {
+			t.Fatalf("第 %d 轮: 预期只有一个节点接管, 同时在任的领导者最多 %d 个, 结束时 %d 个", round, most, leaders)
+		}
+		if status.Term != 2 {
+			t.Fatalf("第 %d 轮: 预期只换届一次 (任期 2), 得到 %d", round, status.Term)
+		}
+	}
+}
+
+func TestWorkQueue_WorkersExecuteRedeliverAndCancel(t *testing.T) {
+	app := newTestApp(t, false)
+	serials, err := serial.New(serial.Spec{Format: "WQ-{seq:4}"})
+	if err != nil {
+		t.Fatalf("无法解析序列号格式: %v", err)
+	}
+	q := workqueue.New(workqueue.Options{AckWaitMs: 300, MaxDeliver: 2}, app.bus, app.stateTracker, serials, app.metrics, app.logger)
+	app.scheduler.SetExecutor(q)
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	go q.Run(ctx)
+	apiServer := api.NewServer(app.scheduler, app.hub, app.stateTracker, app.history, "", nil, nil, app.metrics, app.logger)
+	apiServer.SetWorkQueue(q)
+	server := httptest.NewServer(apiServer.Handler())
+	defer server.Close()
+	waitStatus := func(id, want string) {
+		t.Helper()
+		for i := 0; i < 100; i++ {
+			if p, ok := app.stateTracker.GetProduct(id); ok && p.Status == want {
+				return
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		p, _ := app.stateTracker.GetProduct(id)
+		t.Fatalf("%s 应为 %s, 实际为 %s", id, want, p.Status)
+	}
+
+	// 没有 worker 时任务停留在队列中，可以直接取消
+	app.scheduler.SubmitTask(&types.Product{ID: "WQ_CANCEL", Type: "PCB_PROTOTYPE"})
+	for i := 0; i < 50 && len(q.Status().Pending) == 0; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err := app.scheduler.Cancel("WQ_CANCEL"); err != nil {
+		t.Fatalf("取消任务失败: %v", err)
+	}
+	waitStatus("WQ_CANCEL", "CANCELLED")
+
+	// 不续期的 worker：超过确认期限后重新投递，原投递失效；超过最大投递次数后任务失败
+	app.scheduler.SubmitTask(&types.Product{ID: "WQ_STALLED", Type: "PCB_PROTOTYPE"})
+	stalled := workqueue.NewClient(server.URL, "", "stalled")
+	msg, ok, err := stalled.Fetch(ctx)
+	if err != nil || !ok || msg.Product.ID != "WQ_STALLED" || msg.Delivery != 1 || !strings.HasPrefix(msg.Product.Serial, "WQ-") {
+		t.Fatalf("拉取任务不符合预期: %+v %v %v", msg, ok, err)
+	}
+	time.Sleep(400 * time.Millisecond)
+	if _, err := stalled.Extend(ctx, msg.ID, nil); !errors.Is(err, workqueue.ErrUnknownDelivery) {
+		t.Errorf("超过确认期限后续期应失败, 得到 %v", err)
+	}
+	again, ok, err := stalled.Fetch(ctx)
+	if err != nil || !ok || again.Product.ID != "WQ_STALLED" || again.Delivery != 2 || again.Product.Serial != msg.Product.Serial {
+		t.Fatalf("应重新投递同一个任务: %+v %v %v", again, ok, err)
+	}
+	waitStatus("WQ_STALLED", "FAILED")
+	if status := q.Status(); status.Redelivered != 1 || status.Dead != 1 {
+		t.Errorf("投递统计不符合预期: %+v", status)
+	}
+
+	// worker 用自己的引擎执行，事件转发回编排器，确认后任务完成
+	cfg, err := config.LoadConfig("", config.Overrides{"profile": config.ProfileTest})
+	if err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	workerBus := event.NewBus()
+	wf := engine.NewWorkflowEngine(cfg.Workflows, cfg.ResourcePools, cfg.Lifecycles, app.logger, workerBus, cfg.StepDelayMs)
+	registerStations(wf, app.logger, cfg.StationDelayMs)
+	wf.RegisterStation(station.NewStation(types.StationAOI, app.logger, cfg.StationDelayMs, 0))
+	worker := workqueue.NewWorker(workqueue.NewClient(server.URL, "", "worker-1"), wf, workerBus, 2, app.logger)
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	workerDone := make(chan struct{})
+	go func() {
+		defer close(workerDone)
+		worker.Run(workerCtx)
+	}()
+	app.scheduler.SubmitTask(&types.Product{ID: "WQ_OK", Type: "PCB_PROTOTYPE"})
+	waitStatus("WQ_OK", "COMPLETED")
+	stopWorker()
+	<-workerDone
+	status := q.Status()
+	if status.Acked != 1 || len(status.Pending) != 0 || len(status.Leased) != 0 {
+		t.Errorf("确认后队列应为空: %+v", status)
+	}
+	if _, ok := status.Workers["worker-1"]; !ok {
+		t.Errorf("队列状态应包含 worker-1: %+v", status.Workers)
+	}
+}
+
+func TestWorkQueue_RedisStreamsExecuteRedeliverAndCancel(t *testing.T) {
+	app := newTestApp(t, false)
+	redisServer := miniredis.RunT(t)
+	opts := workqueue.Options{Backend: workqueue.BackendRedis, AckWaitMs: 300, MaxDeliver: 2,
+		Redis: workqueue.RedisOptions{Addr: redisServer.Addr(), Prefix: "test:queue"}}
+	serials, err := serial.New(serial.Spec{Format: "WQ-{seq:4}"})
+	if err != nil {
+		t.Fatalf("无法解析序列号格式: %v", err)
+	}
+	q := workqueue.NewStream(opts, app.bus, app.stateTracker, serials, app.metrics, app.logger)
+	defer q.Close()
+	app.scheduler.SetExecutor(q)
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	go q.Run(ctx)
+	waitStatus := func(id, want string) {
+		t.Helper()
+		for i := 0; i < 100; i++ {
+			if p, ok := app.stateTracker.GetProduct(id); ok && p.Status == want {
+				return
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		p, _ := app.stateTracker.GetProduct(id)
+		t.Fatalf("%s 应为 %s, 实际为 %s", id, want, p.Status)
+	}
+
+	// 没有 worker 时任务停留在任务流中，可以直接取消
+	app.scheduler.SubmitTask(&types.Product{ID: "WQ_CANCEL", Type: "PCB_PROTOTYPE"})
+	for i := 0; i < 50 && len(q.Status().Pending) == 0; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err := app.scheduler.Cancel("WQ_CANCEL"); err != nil {
+		t.Fatalf("取消任务失败: %v", err)
+	}
+	waitStatus("WQ_CANCEL", "CANCELLED")
+
+	// 不续期的 worker：超过确认期限后重新发布，原投递失效；超过最大投递次数后任务失败
+	app.scheduler.SubmitTask(&types.Product{ID: "WQ_STALLED", Type: "PCB_PROTOTYPE"})
+	stalled := workqueue.NewStreamClient(opts, "stalled")
+	defer stalled.Close()
+	msg, ok, err := stalled.Fetch(ctx)
+	if err != nil || !ok || msg.Product.ID != "WQ_STALLED" || msg.Delivery != 1 || !strings.HasPrefix(msg.Product.Serial, "WQ-") {
+		t.Fatalf("拉取任务不符合预期: %+v %v %v", msg, ok, err)
+	}
+	time.Sleep(400 * time.Millisecond)
+	if _, err := stalled.Extend(ctx, msg.ID, nil); !errors.Is(err, workqueue.ErrUnknownDelivery) {
+		t.Errorf("超过确认期限后续期应失败, 得到 %v", err)
+	}
+	again, ok, err := stalled.Fetch(ctx)
+	if err != nil || !ok || again.Product.ID != "WQ_STALLED" || again.Delivery != 2 || again.ID == msg.ID || again.Product.Serial != msg.Product.Serial {
+		t.Fatalf("应重新投递同一个任务: %+v %v %v", again, ok, err)
+	}
+	if err := stalled.Ack(ctx, msg.ID, &msg.Product); !errors.Is(err, workqueue.ErrUnknownDelivery) {
+		t.Errorf("重新投递后确认原投递应失败, 得到 %v", err)
+	}
+	waitStatus("WQ_STALLED", "FAILED")
+	if status := q.Status(); status.Redelivered != 1 || status.Dead != 1 {
+		t.Errorf("投递统计不符合预期: %+v", status)
+	}
+
+	// worker 直接从 Redis 拉取，用自己的引擎执行，事件经事件流转发回编排器，确认后任务完成
+	cfg, err := config.LoadConfig("", config.Overrides{"profile": config.ProfileTest})
+	if err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	workerBus := event.NewBus()
+	wf := engine.NewWorkflowEngine(cfg.Workflows, cfg.ResourcePools, cfg.Lifecycles, app.logger, workerBus, cfg.StepDelayMs)
+	registerStations(wf, app.logger, cfg.StationDelayMs)
+	wf.RegisterStation(station.NewStation(types.StationAOI, app.logger, cfg.StationDelayMs, 0))
+	client := workqueue.NewStreamClient(opts, "worker-1")
+	defer client.Close()
+	worker := workqueue.NewWorker(client, wf, workerBus, 2, app.logger)
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	workerDone := make(chan struct{})
+	go func() {
+		defer close(workerDone)
+		worker.Run(workerCtx)
+	}()
+	app.scheduler.SubmitTask(&types.Product{ID: "WQ_OK", Type: "PCB_PROTOTYPE"})
+	waitStatus("WQ_OK", "COMPLETED")
+	stopWorker()
+	<-workerDone
+	status := q.Status()
+	if status.Acked != 1 || len(status.Pending) != 0 || len(status.Leased) != 0 {
+		t.Errorf("确认后队列应为空: %+v", status)
+	}
+	if _, ok := status.Workers["worker-1"]; !ok {
+		t.Errorf("队列状态应包含 worker-1: %+v", status.Workers)
+	}
+}
+
+func TestWorkQueue_RedisStreamsAdoptDeliveriesAfterRestart(t *testing.T) {
+	redisServer := miniredis.RunT(t)
+	opts := workqueue.Options{Backend: workqueue.BackendRedis, AckWaitMs: 5000,
+		Redis: workqueue.RedisOptions{Addr: redisServer.Addr(), Prefix: "test:queue"}}
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	// 第一个编排器发布任务后停机，worker 已经拉取并上报了检查点
+	before := newTestApp(t, false)
+	first := workqueue.NewStream(opts, before.bus, before.stateTracker, nil, before.metrics, before.logger)
+	defer first.Close()
+	before.scheduler.SetExecutor(first)
+	before.scheduler.SubmitTask(&types.Product{ID: "WQ_ADOPT", Type: "PCB_PROTOTYPE"})
+	for i := 0; i < 50 && len(first.Status().Pending) == 0; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	holder := workqueue.NewStreamClient(opts, "holder")
+	defer holder.Close()
+	msg, ok, err := holder.Fetch(ctx)
+	if err != nil || !ok {
+		t.Fatalf("拉取任务失败: %v %v", ok, err)
+	}
+	if _, err := holder.Extend(ctx, msg.ID, &types.Checkpoint{Step: 0, Workflow: "PCB_PROTOTYPE"}); err != nil {
+		t.Fatalf("续期失败: %v", err)
+	}
+
+	// 重启后的编排器恢复同一个任务时接管执行中的投递，不重复发布；只接受持有者转发的事件
+	app := newTestApp(t, false)
+	q := workqueue.NewStream(opts, app.bus, app.stateTracker, nil, app.metrics, app.logger)
+	defer q.Close()
+	app.scheduler.SetExecutor(q)
+	go q.Run(ctx)
+	var mu sync.Mutex
+	var accepted []string
+	app.bus.Subscribe(event.StepQueued, func(e event.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		accepted = append(accepted, string(e.StationID)+": "+e.Error.Error())
+	})
+	app.scheduler.SubmitTask(&types.Product{ID: "WQ_ADOPT", Type: "PCB_PROTOTYPE"})
+	var status workqueue.Status
+	for i := 0; i < 50; i++ {
+		if status = q.Status(); len(status.Leased) == 1 && status.Leased[0].Completed == 1 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(status.Pending) != 0 || len(status.Leased) != 1 || status.Leased[0].ID != msg.ID || status.Leased[0].Worker != "holder" || status.Leased[0].Completed != 1 {
+		t.Fatalf("应接管原投递及其检查点: %+v", status)
+	}
+	other := workqueue.NewStreamClient(opts, "other")
+	defer other.Close()
+	for _, c := range []*workqueue.StreamClient{other, holder} {
+		e := workqueue.Encode(event.Event{Type: event.StepQueued, ProductID: "WQ_ADOPT", StationID: types.StationID(c.Worker()), Error: errors.New("带有错误的事件")})
+		if err := c.Publish(ctx, []workqueue.Event{e}); err != nil {
+			t.Fatalf("转发事件失败: %v", err)
+		}
+	}
+	if err := other.Ack(ctx, msg.ID, &msg.Product); !errors.Is(err, workqueue.ErrUnknownDelivery) {
+		t.Errorf("其他 worker 确认应失败, 得到 %v", err)
+	}
+	if err := holder.Ack(ctx, msg.ID, &msg.Product); err != nil {
+		t.Fatalf("确认失败: %v", err)
+	}
+	for i := 0; i < 50 && q.Status().Acked == 0; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if status := q.Status(); status.Acked != 1 || len(status.Leased) != 0 {
+		t.Errorf("确认后队列应为空: %+v", status)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Equal(accepted, []string{"holder: 带有错误的事件"}) {
+		t.Errorf("编排器应只接受持有者的事件, 得到 %v", accepted)
+	}
+}
+
+func TestWorkQueue_AcceptsEventsOnlyFromLeaseHolder(t *testing.T) {
+	app := newTestApp(t, false)
+	q := workqueue.New(workqueue.Options{AckWaitMs: 200, MaxDeliver: 1}, app.bus, app.stateTracker, nil, app.metrics, app.logger)
+	app.scheduler.SetExecutor(q)
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	go q.Run(ctx)
+	apiServer := api.NewServer(app.scheduler, app.hub, app.stateTracker, app.history, "", nil, nil, app.metrics, app.logger)
+	apiServer.SetWorkQueue(q)
+	server := httptest.NewServer(apiServer.Handler())
+	defer server.Close()
+
+	// 每次转发的事件用不同的工站 ID 标记，编排器的事件总线收到哪些标记就说明接受了哪些转发
+	var mu sync.Mutex
+	var accepted []string
+	for _, eventType := range []event.EventType{event.StepQueued, event.StepCompleted, event.StationStatusChanged} {
+		app.bus.Subscribe(eventType, func(e event.Event) {
+			if strings.HasPrefix(e.ProductID, "WQ_") {
+				mu.Lock()
+				defer mu.Unlock()
+				accepted = append(accepted, string(e.StationID))
+			}
+		})
+	}
+	publish := func(c *workqueue.Client, productID, marker string) {
+		t.Helper()
+		e := workqueue.Event{Event: event.Event{Type: event.StepQueued, ProductID: productID, StationID: types.StationID(marker), Product: &types.Product{ID: productID}}}
+		if err := c.Publish(ctx, []workqueue.Event{e}); err != nil {
+			t.Fatalf("转发事件失败: %v", err)
+		}
+	}
+	holder := workqueue.NewClient(server.URL, "", "holder")
+	other := workqueue.NewClient(server.URL, "", "other")
+
+	app.scheduler.SubmitTask(&types.Product{ID: "WQ_EVENTS", Type: "PCB_PROTOTYPE"})
+	msg, ok, err := holder.Fetch(ctx)
+	if err != nil || !ok {
+		t.Fatalf("拉取任务失败: %v %v", ok, err)
+	}
+	publish(holder, "WQ_EVENTS", "holder-leased")
+	publish(other, "WQ_EVENTS", "other-leased")
+	publish(other, "WQ_MADE_UP", "made-up")
+	// 缺少工件快照的工件事件和 worker 不转发的事件类型直接丢弃，不会到达编排器的处理器
+	invalid := []workqueue.Event{
+		{Event: event.Event{Type: event.StepCompleted, ProductID: "WQ_EVENTS", StationID: "no-product"}},
+		{Event: event.Event{Type: event.StationStatusChanged, ProductID: "WQ_EVENTS", StationID: "station-status"}},
+	}
+	if err := holder.Publish(ctx, invalid); err != nil {
+		t.Fatalf("转发事件失败: %v", err)
+	}
+
+	// 确认后原 worker 异步转发的事件在确认期限内仍然接受，其他 worker 的不接受
+	if err := holder.Ack(ctx, msg.ID, &msg.Product); err != nil {
+		t.Fatalf("确认失败: %v", err)
+	}
+	publish(holder, "WQ_EVENTS", "holder-acked")
+	publish(other, "WQ_EVENTS", "other-acked")
+	time.Sleep(300 * time.Millisecond)
+	publish(holder, "WQ_EVENTS", "holder-late")
+
+	// 超过最大投递次数的工件不再接受原 worker 的事件
+	app.scheduler.SubmitTask(&types.Product{ID: "WQ_DEAD_EVENTS", Type: "PCB_PROTOTYPE"})
+	if _, ok, err := holder.Fetch(ctx); err != nil || !ok {
+		t.Fatalf("拉取任务失败: %v %v", ok, err)
+	}
+	for i := 0; i < 50; i++ {
+		if p, ok := app.stateTracker.GetProduct("WQ_DEAD_EVENTS"); ok && p.Status == "FAILED" {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	publish(holder, "WQ_DEAD_EVENTS", "holder-dead")
+
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	slices.Sort(accepted)
+	if want := []string{"holder-acked", "holder-leased"}; !slices.Equal(accepted, want) {
+		t.Errorf("编排器应只接受租约持有者的事件 %v, 得到 %v", want, accepted)
+	}
+}
+
+func TestWorkQueue_RequiresWorkerRoleAndScopesNamespaces(t *testing.T) {
+	app := newTestApp(t, false)
+	q := workqueue.New(workqueue.Options{AckWaitMs: 5000}, app.bus, app.stateTracker, nil, app.metrics, app.logger)
+	app.scheduler.SetExecutor(q)
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	go q.Run(ctx)
+	cfg := config.AuthConfig{Enabled: true, APIKeys: []config.APIKeyConfig{
+		{Name: "ops", Key: "admin-key", Roles: []string{"admin"}},
+		{Name: "line-a", Key: "worker-a-key", Roles: []string{"worker"}, Namespaces: []string{"line-a"}},
+		{Name: "line-b", Key: "worker-b-key", Roles: []string{"worker"}, Namespaces: []string{"line-b"}},
+	}}
+	apiServer := api.NewServer(app.scheduler, app.hub, app.stateTracker, app.history, "", auth.New(cfg), nil, app.metrics, app.logger)
+	apiServer.SetWorkQueue(q)
+	server := httptest.NewServer(apiServer.Handler())
+	defer server.Close()
+
+	app.scheduler.SubmitTask(&types.Product{ID: "WQ_LINE_B", Type: "PCB_PROTOTYPE", Namespace: "line-b"})
+	app.scheduler.SubmitTask(&types.Product{ID: "WQ_LINE_A", Type: "PCB_PROTOTYPE", Namespace: "line-a"})
+	for i := 0; i < 50 && len(q.Status().Pending) < 2; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// 队列接口只允许 worker 角色调用，管理员也不能拉取任务
+	if _, _, err := workqueue.NewClient(server.URL, "admin-key", "w").Fetch(ctx); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Fatalf("管理员拉取任务应返回 403, 得到 %v", err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/v1/tasks/WQ_LINE_A", nil)
+	req.Header.Set("X-API-Key", "worker-a-key")
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("worker 角色访问其他接口应返回 403, 得到 %v %v", resp, err)
+	} else {
+		resp.Body.Close()
+	}
+
+	// worker 只拉取凭据绑定的命名空间中的任务
+	workerA := workqueue.NewClient(server.URL, "worker-a-key", "w")
+	workerB := workqueue.NewClient(server.URL, "worker-b-key", "w")
+	msgA, ok, err := workerA.Fetch(ctx)
+	if err != nil || !ok || msgA.Product.ID != "WQ_LINE_A" {
+		t.Fatalf("line-a 的 worker 应拉取到 WQ_LINE_A: %v %v %s", ok, err, msgA.Product.ID)
+	}
+	msgB, ok, err := workerB.Fetch(ctx)
+	if err != nil || !ok || msgB.Product.ID != "WQ_LINE_B" {
+		t.Fatalf("line-b 的 worker 应拉取到 WQ_LINE_B: %v %v %s", ok, err, msgB.Product.ID)
+	}
+
+	// worker 名称按凭据区分，其他凭据的同名 worker 不能续期或确认投递
+	if _, err := workerB.Extend(ctx, msgA.ID, nil); !errors.Is(err, workqueue.ErrUnknownDelivery) {
+		t.Errorf("其他凭据的 worker 续期应返回 ErrUnknownDelivery, 得到 %v", err)
+	}
+	if err := workerB.Ack(ctx, msgA.ID, &msgA.Product); !errors.Is(err, workqueue.ErrUnknownDelivery) {
+		t.Errorf("其他凭据的 worker 确认应返回 ErrUnknownDelivery, 得到 %v", err)
+	}
+	if err := workerA.Ack(ctx, msgA.ID, &msgA.Product); err != nil {
+		t.Errorf("租约持有者确认失败: %v", err)
+	}
+	if workers := q.Status().Workers; workers["line-a/w"].IsZero() || workers["line-b/w"].IsZero() {
+		t.Errorf("队列状态应按凭据记录 worker, 得到 %v", workers)
+	}
+}
+
+func TestWorkQueue_ExpiresIdleWorkers(t *testing.T) {
+	app := newTestApp(t, false)
+	q := workqueue.New(workqueue.Options{AckWaitMs: 200, WorkerIdleMs: 200}, app.bus, app.stateTracker, nil, app.metrics, app.logger)
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	go q.Run(ctx)
+
+	// worker 名称由客户端决定，空闲超过 worker_idle_ms 的 worker 从队列状态中移除
+	for i := range 3 {
+		q.Fetch(ctx, fmt.Sprintf("idle-%d", i), nil, 0)
+	}
+	if workers := q.Status().Workers; len(workers) != 3 {
+		t.Fatalf("拉取后应记录 3 个 worker, 得到 %v", workers)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(q.Status().Workers) != 1 && time.Now().Before(deadline) {
+		q.Fetch(ctx, "active", nil, 0)
+		time.Sleep(50 * time.Millisecond)
+	}
+	if workers := q.Status().Workers; len(workers) != 1 || workers["active"].IsZero() {
+		t.Errorf("空闲的 worker 应被移除，只保留活跃的 worker, 得到 %v", workers)
+	}
+}
+
+func TestWorkQueue_RedeliveryResumesFromWorkerCheckpoint(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	m := metrics.New(metrics.NewRegistry())
+	hub := web.NewHub(m)
+	go hub.Run()
+	t.Cleanup(hub.Close)
+	stateTracker := web.NewStateTracker(hub)
+	bus := event.NewBus()
+	handlers.RegisterEventHandlers(bus, stateTracker, history.NewStore(), m, logger)
+	workflows := map[string][]types.WorkflowStep{"PCB_CKPT": {
+		{StationIDs: []types.StationID{types.StationDrill}},
+		{StationIDs: []types.StationID{types.StationETest}},
+		{StationIDs: []types.StationID{types.StationAOI}},
+	}}
+
+	// 编排器：任务发布到共享队列，worker 上报的检查点写入编排器的 WAL
+	walPath := filepath.Join(t.TempDir(), "queue.wal")
+	wal, err := persistence.NewWAL(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	scheduler := engine.NewScheduler(engine.NewWorkflowEngine(workflows, nil, nil, logger, bus, 1), 1, wal, stateTracker, m, logger)
+	q := workqueue.New(workqueue.Options{AckWaitMs: 300, MaxDeliver: 3}, bus, stateTracker, nil, m, logger)
+	scheduler.SetExecutor(q)
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	go q.Run(ctx)
+	go scheduler.Start(ctx)
+	apiServer := api.NewServer(scheduler, hub, stateTracker, history.NewStore(), "", nil, nil, m, logger)
+	apiServer.SetWorkQueue(q)
+	server := httptest.NewServer(apiServer.Handler())
+	defer server.Close()
+	// 第一个 worker 经过可以断开的代理访问编排器，模拟 worker 崩溃或失联
+	var crashed atomic.Bool
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if crashed.Load() {
+			http.Error(w, "worker is gone", http.StatusServiceUnavailable)
+			return
+		}
+		apiServer.Handler().ServeHTTP(w, r)
+	}))
+	defer proxy.Close()
+
+	runWorker := func(url, id string, stations ...station.Station) (context.CancelFunc, chan struct{}) {
+		workerBus := event.NewBus()
+		wf := engine.NewWorkflowEngine(workflows, nil, nil, logger, workerBus, 1)
+		for _, s := range stations {
+			wf.RegisterStation(s)
+		}
+		worker := workqueue.NewWorker(workqueue.NewClient(url, "", id), wf, workerBus, 1, logger)
+		workerCtx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			worker.Run(workerCtx)
+		}()
+		return cancel, done
+	}
+
+	// worker-1 完成钻孔后卡在电测，完成的步骤随续期上报
+	gate := make(chan struct{})
+	drill1 := newCountingStation(types.StationDrill)
+	stop1, done1 := runWorker(proxy.URL, "worker-1", drill1, &gatedStation{id: types.StationETest, gate: gate}, newCountingStation(types.StationAOI))
+	scheduler.SubmitTask(&types.Product{ID: "WQ_RESUME", Type: "PCB_CKPT"})
+	for i := 0; i < 100; i++ {
+		if leased := q.Status().Leased; len(leased) == 1 && leased[0].Completed == 1 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if leased := q.Status().Leased; len(leased) != 1 || leased[0].Worker != "worker-1" || leased[0].Completed != 1 {
+		t.Fatalf("worker-1 应上报完成了钻孔: %+v", leased)
+	}
+	if executed, _ := drill1.counts("WQ_RESUME"); executed != 1 {
+		t.Fatalf("worker-1 应执行钻孔一次, 得到 %d", executed)
+	}
+	data, _ := os.ReadFile(walPath)
+	if !strings.Contains(string(data), `"type":"STEP","task_id":"WQ_RESUME"`) {
+		t.Errorf("worker 上报的检查点应写入编排器的 WAL: %s", data)
+	}
+
+	// worker-1 失联，确认期限过后任务重新投递给 worker-2，从电测继续，不重复钻孔
+	crashed.Store(true)
+	drill2, etest2, aoi2 := newCountingStation(types.StationDrill), newCountingStation(types.StationETest), newCountingStation(types.StationAOI)
+	stop2, done2 := runWorker(server.URL, "worker-2", drill2, etest2, aoi2)
+	for i := 0; i < 100; i++ {
+		if p, ok := stateTracker.GetProduct("WQ_RESUME"); ok && p.Status == "COMPLETED" {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if p, _ := stateTracker.GetProduct("WQ_RESUME"); p.Status != "COMPLETED" {
+		t.Fatalf("重新投递的任务应完成, 实际为 %s", p.Status)
+	}
+	drilled, _ := drill2.counts("WQ_RESUME")
+	tested, _ := etest2.counts("WQ_RESUME")
+	inspected, _ := aoi2.counts("WQ_RESUME")
+	if drilled != 0 || tested != 1 || inspected != 1 {
+		t.Errorf("worker-2 应从电测继续, 钻孔 %d 电测 %d AOI %d", drilled, tested, inspected)
+	}
+	etest2.mu.Lock()
+	history := slices.Clone(etest2.products["WQ_RESUME"].History)
+	etest2.mu.Unlock()
+	if !slices.Equal(history, []string{string(types.StationDrill), string(types.StationETest), string(types.StationAOI)}) {
+		t.Errorf("worker-2 应从检查点恢复加工历史, 得到 %v", history)
+	}
+	if status := q.Status(); status.Redelivered != 1 || status.Acked != 1 {
+		t.Errorf("投递统计不符合预期: %+v", status)
+	}
+
+	close(gate)
+	stop1()
+	stop2()
+	<-done1
+	<-done2
+}
+
+func TestStationSim_MultiStationProfiles(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	_, filename, _, _ := runtime.Caller(0)
+	cfg, err := config.LoadConfig(filepath.Join(filepath.Dir(filename), "..", "config.yaml"), config.Overrides{"profile": config.ProfileTest})
+	if err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("仓库中的 config.yaml 未通过校验: %v", err)
+	}
+	if p, ok := cfg.StationServer.Stations[types.StationAOI]; !ok || cfg.StationServer.DefaultStation != types.StationAOI || p.FailureRate != 0.1 {
+		t.Errorf("仓库中的 config.yaml 应模拟 AOI: %+v", cfg.StationServer)
+	}
+
+	sim := stationsim.New(stationsim.Options{
+		DefaultStation: types.StationDrill,
+		Stations: map[types.StationID]stationsim.Profile{
+			types.StationDrill: {DelayMs: 10, Firmware: "drill-ctl 4.1.7",
+				Measurements: []types.MeasurementSpec{{Name: "hole_diameter", Unit: "mm", Nominal: 0.3, LSL: 0.25, USL: 0.35}}},
+			types.StationETest: {FailureRate: 1, Machine: "ET-01"},
+		},
+	}, "sim-host", "secret", logger)
+	server := httptest.NewServer(sim.Handler())
+	defer server.Close()
+	ctx := context.Background()
+	remote := func(id types.StationID, endpoint string) *station.RemoteStation {
+		return station.NewRemoteStation(id, endpoint, station.RemoteOptions{BearerToken: "secret"}, logger)
+	}
+
+	// 每个工站按自己的 profile 加工：钻孔返回测量值和未配置时的默认设备实例
+	drill := remote(types.StationDrill, server.URL+"/stations/STATION_DRILL")
+	res := drill.Execute(ctx, &types.Product{ID: "SIM_1"})
+	if !res.Success || len(res.Measurements) != 1 || res.Measurements[0].Name != "hole_diameter" ||
+		res.Provenance.Machine != "sim-host" || res.Provenance.Firmware != "drill-ctl 4.1.7" {
+		t.Errorf("钻孔工站的结果不符合预期: %+v", res)
+	}
+	// 失败时从该工站的缺陷目录中判定缺陷
+	etest := remote(types.StationETest, server.URL+"/stations/station_e_test")
+	res = etest.Execute(ctx, &types.Product{ID: "SIM_2"})
+	if res.Success || res.Defect == nil || !strings.HasPrefix(res.Defect.Code, "ET-") || res.Provenance.Machine != "ET-01" {
+		t.Errorf("电测工站应按失败率判定电测缺陷: %+v", res)
+	}
+	if err := etest.Compensate(ctx, &types.Product{ID: "SIM_2"}); err != nil {
+		t.Errorf("补偿失败: %v", err)
+	}
+	if err := etest.Ping(ctx); err != nil {
+		t.Errorf("健康检查失败: %v", err)
+	}
+
+	// 默认工站兼容不带前缀的路径，未模拟的工站返回 404，令牌不匹配返回 401
+	if res := remote(types.StationDrill, server.URL).Execute(ctx, &types.Product{ID: "SIM_3"}); !res.Success {
+		t.Errorf("不带前缀的路径应对应默认工站: %+v", res)
+	}
+	if res := remote(types.StationAOI, server.URL+"/stations/STATION_AOI").Execute(ctx, &types.Product{ID: "SIM_4"}); res.Success || res.Defect.Code != "EQ-REMOTE" {
+		t.Errorf("未模拟的工站应返回错误: %+v", res)
+	}
+	unauthorized := station.NewRemoteStation(types.StationDrill, server.URL+"/stations/STATION_DRILL", station.RemoteOptions{}, logger)
+	if res := unauthorized.Execute(ctx, &types.Product{ID: "SIM_5"}); res.Success {
+		t.Error("缺少令牌时加工请求应被拒绝")
+	}
+	resp, err := http.Get(server.URL + "/stations")
+	if err != nil {
+		t.Fatalf("查询模拟工站失败: %v", err)
+	}
+	var infos []stationsim.StationInfo
+	json.NewDecoder(resp.Body).Decode(&infos)
+	resp.Body.Close()
+	if len(infos) != 2 || infos[0].ID != types.StationDrill || infos[1].ID != types.StationETest {
+		t.Errorf("模拟工站列表不符合预期: %+v", infos)
+	}
+
+	// 单独监听的工站以不带前缀的路径提供服务
+	dedicated := httptest.NewServer(sim.StationHandler(types.StationETest))
+	defer dedicated.Close()
+	if res := remote(types.StationETest, dedicated.URL).Execute(ctx, &types.Product{ID: "SIM_6"}); res.Success || res.Defect == nil {
+		t.Errorf("单独监听的工站应按自己的 profile 加工: %+v", res)
+	}
+}
+
+func TestStationSim_AsyncJobsCapacityAndCallback(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	sim := stationsim.New(stationsim.Options{
+		Stations: map[types.StationID]stationsim.Profile{
+			types.StationDrill: {DelayMs: 200, Capacity: 1},
+		},
+	}, "sim-host", "", logger)
+	server := httptest.NewServer(sim.Handler())
+	defer server.Close()
+
+	callbacks := make(chan stationsim.Job, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var job stationsim.Job
+		json.NewDecoder(r.Body).Decode(&job)
+		callbacks <- job
+	}))
+	defer receiver.Close()
+
+	submit := func(body string, async bool) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/stations/STATION_DRILL/execute", strings.NewReader(body))
+		if async {
+			req.Header.Set("Prefer", "respond-async")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("提交加工失败: %v", err)
+		}
+		return resp
+	}
+
+	// 异步提交立即返回 202 和作业，加工位已满时拒绝其他请求
+	resp := submit(`{"id":"JOB_1","callback_url":"`+receiver.URL+`"}`, true)
+	var job stationsim.Job
+	json.NewDecoder(resp.Body).Decode(&job)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted || job.Status != stationsim.JobRunning || resp.Header.Get("Location") != "/jobs/"+job.ID {
+		t.Fatalf("异步提交应返回 202 和进行中的作业: %d %+v", resp.StatusCode, job)
+	}
+	resp = submit(`{"id":"JOB_2"}`, false)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("加工位已满时应返回 429: %d", resp.StatusCode)
+	}
+	resp = submit(`{"id":"JOB_3","callback_url":"ftp://example"}`, true)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("无效的回调地址应返回 400: %d", resp.StatusCode)
+	}
+
+	// 作业结束后回调并可以查询结果，加工位随之释放
+	select {
+	case cb := <-callbacks:
+		if cb.ID != job.ID || cb.Status != stationsim.JobCompleted || cb.Result == nil || cb.Result.ProductID != "JOB_1" {
+			t.Errorf("回调的作业不符合预期: %+v", cb)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("没有收到作业回调")
+	}
+	resp, err := http.Get(server.URL + "/jobs/" + job.ID)
+	if err != nil {
+		t.Fatalf("查询作业失败: %v", err)
+	}
+	json.NewDecoder(resp.Body).Decode(&job)
+	resp.Body.Close()
+	if job.Status != stationsim.JobCompleted || !job.Result.Success {
+		t.Errorf("作业应已完成: %+v", job)
+	}
+	if resp, _ := http.Get(server.URL + "/jobs/job-unknown"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("不存在的作业应返回 404: %d", resp.StatusCode)
+	}
+
+	// 异步模式的远程工站轮询作业直到结束，加工耗时可以超过单次调用的超时
+	remote := station.NewRemoteStation(types.StationDrill, server.URL+"/stations/STATION_DRILL",
+		station.RemoteOptions{Async: true, Timeout: 100 * time.Millisecond, PollInterval: 20 * time.Millisecond}, logger)
+	if res := remote.Execute(context.Background(), &types.Product{ID: "JOB_4"}); !res.Success || res.Provenance.Machine != "sim-host" {
+		t.Errorf("异步模式的加工结果不符合预期: %+v", res)
+	}
+	if jobs := sim.Jobs(); len(jobs) != 2 || jobs[0].ProductID != "JOB_4" {
+		t.Errorf("作业列表应按创建时间从新到旧排列: %+v", jobs)
+	}
+}
+
+func TestStationSim_ShutdownPersistsAndRestoresJobs(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	var accept atomic.Bool
+	callbacks := make(chan stationsim.Job, 4)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !accept.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var job stationsim.Job
+		json.NewDecoder(r.Body).Decode(&job)
+		callbacks <- job
+	}))
+	defer receiver.Close()
+
+	opts := stationsim.Options{
+		StateFile: filepath.Join(t.TempDir(), "jobs.json"),
+		Stations: map[types.StationID]stationsim.Profile{
+			types.StationDrill: {DelayMs: 10},
+			types.StationETest: {DelayMs: 300},
+		},
+	}
+	sim := stationsim.New(opts, "sim-host", "", logger)
+	server := httptest.NewServer(sim.Handler())
+	submit := func(id types.StationID, body string) (stationsim.Job, int) {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/stations/"+string(id)+"/execute", strings.NewReader(body))
+		req.Header.Set("Prefer", "respond-async")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("提交加工失败: %v", err)
+		}
+		defer resp.Body.Close()
+		var job stationsim.Job
+		json.NewDecoder(resp.Body).Decode(&job)
+		return job, resp.StatusCode
+	}
+
+	// 钻孔作业很快结束但回调失败，电测作业在停机超时时仍在加工
+	drillJob, _ := submit(types.StationDrill, `{"id":"RS_1","callback_url":"`+receiver.URL+`"}`)
+	etestJob, _ := submit(types.StationETest, `{"id":"RS_2"}`)
+	time.Sleep(100 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := sim.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("停机应超时: %v", err)
+	}
+	if _, status := submit(types.StationDrill, `{"id":"RS_3"}`); status != http.StatusServiceUnavailable {
+		t.Errorf("停机后的加工请求应返回 503: %d", status)
+	}
+	if job, ok := sim.Job(drillJob.ID); !ok || job.Status != stationsim.JobCompleted || job.CallbackDelivered {
+		t.Errorf("钻孔作业应已完成但回调未送达: %+v", job)
+	}
+	server.Close()
+
+	// 重启后恢复：已结束的作业可以查询并重新回调，未完成的作业重新加工
+	accept.Store(true)
+	restarted := stationsim.New(opts, "sim-host", "", logger)
+	result, err := restarted.Restore()
+	if err != nil {
+		t.Fatalf("恢复作业失败: %v", err)
+	}
+	if result.Jobs != 2 || result.Resumed != 1 || result.Callbacks != 1 {
+		t.Errorf("恢复结果不符合预期: %+v", result)
+	}
+	select {
+	case job := <-callbacks:
+		if job.ID != drillJob.ID || !job.Recovered {
+			t.Errorf("重新发送的回调不符合预期: %+v", job)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("重启后没有重新发送回调")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, ok := restarted.Job(etestJob.ID)
+		if ok && job.Status == stationsim.JobCompleted {
+			if !job.Recovered || job.Result == nil || job.Result.ProductID != "RS_2" {
+				t.Errorf("重新加工的作业不符合预期: %+v", job)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("重启后作业没有重新加工: %+v", job)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err := restarted.Shutdown(context.Background()); err != nil {
+		t.Errorf("没有进行中的作业时停机应立即完成: %v", err)
+	}
+}
+
+func TestStationSim_AdminFaultOverrides(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	sim := stationsim.New(stationsim.Options{
+		Stations: map[types.StationID]stationsim.Profile{
+			types.StationDrill: {DelayMs: 5000},
+		},
+	}, "sim-host", "secret", logger)
+	server := httptest.NewServer(sim.Handler())
+	defer server.Close()
+	ctx := context.Background()
+	drill := station.NewRemoteStation(types.StationDrill, server.URL+"/stations/STATION_DRILL",
+		station.RemoteOptions{BearerToken: "secret", Timeout: time.Second}, logger)
+	admin := func(method, path, body string) *http.Response {
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("调用管理接口失败: %v", err)
+		}
+		return resp
+	}
+
+	// 固定加工耗时覆盖 profile 的 5 秒，失败率改为 100%
+	resp := admin(http.MethodPut, "/admin/stations/station_drill/fault", `{"latency_ms": 10, "failure_rate": 1}`)
+	var info stationsim.StationInfo
+	json.NewDecoder(resp.Body).Decode(&info)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || info.Fault == nil || *info.Fault.LatencyMs != 10 {
+		t.Fatalf("设置覆盖失败: %d %+v", resp.StatusCode, info)
+	}
+	if res := drill.Execute(ctx, &types.Product{ID: "ADM_1"}); res.Success || res.Defect == nil || !strings.HasPrefix(res.Defect.Code, "DR-") {
+		t.Errorf("覆盖失败率后应判定钻孔缺陷: %+v", res)
+	}
+
+	// 宕机时加工和健康检查都返回 503
+	resp = admin(http.MethodPut, "/admin/stations/STATION_DRILL/fault", `{"down": true}`)
+	resp.Body.Close()
+	if res := drill.Execute(ctx, &types.Product{ID: "ADM_2"}); res.Success || res.Defect.Code != "EQ-REMOTE" {
+		t.Errorf("宕机的工站应返回错误: %+v", res)
+	}
+	if err := drill.Ping(ctx); err == nil {
+		t.Error("宕机的工站健康检查应失败")
+	}
+
+	// 无效的覆盖和缺少令牌都被拒绝，清除后按 profile 运行
+	if resp := admin(http.MethodPut, "/admin/stations/STATION_DRILL/fault", `{"failure_rate": 2}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("无效的失败率应返回 400: %d", resp.StatusCode)
+	}
+	if resp, _ := http.Get(server.URL + "/admin/stations"); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("缺少令牌时管理接口应返回 401: %d", resp.StatusCode)
+	}
+	resp = admin(http.MethodPut, "/admin/stations/STATION_DRILL/fault", `{"latency_ms": 0}`)
+	resp.Body.Close()
+	if res := drill.Execute(ctx, &types.Product{ID: "ADM_3"}); !res.Success {
+		t.Errorf("PUT 应替换之前的覆盖: %+v", res)
+	}
+	if resp := admin(http.MethodDelete, "/admin/faults", ""); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("清除覆盖应返回 204: %d", resp.StatusCode)
+	}
+	if stations := sim.Stations(); stations[0].Fault != nil {
+		t.Errorf("清除后不应有覆盖: %+v", stations[0])
+	}
+	if res := drill.Execute(ctx, &types.Product{ID: "ADM_4"}); res.Success || res.Defect.Code != "EQ-COMM" {
+		t.Errorf("清除覆盖后应按 profile 的 5 秒加工耗时超时: %+v", res)
+	}
+}
+
+func TestStationSim_MetricsHealthAndTracePropagation(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	sim := stationsim.New(stationsim.Options{
+		Stations: map[types.StationID]stationsim.Profile{
+			types.StationDrill: {Capacity: 2},
+			types.StationETest: {FailureRate: 1},
+		},
+	}, "sim-host", "", logger)
+	var traceparents []string
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tp := r.Header.Get("traceparent"); tp != "" {
+			mu.Lock()
+			traceparents = append(traceparents, tp)
+			mu.Unlock()
+		}
+		sim.Handler().ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	// 编排器以 traceparent 传递 Trace ID，每次调用使用新的 Span ID
+	traceID := util.NewTraceID()
+	ctx := util.ContextWithTraceID(context.Background(), traceID)
+	drill := station.NewRemoteStation(types.StationDrill, server.URL+"/stations/STATION_DRILL", station.RemoteOptions{}, logger)
+	etest := station.NewRemoteStation(types.StationETest, server.URL+"/stations/STATION_E_TEST", station.RemoteOptions{}, logger)
+	drill.Execute(ctx, &types.Product{ID: "OBS_1"})
+	drill.Execute(ctx, &types.Product{ID: "OBS_2"})
+	etest.Execute(ctx, &types.Product{ID: "OBS_3"})
+	if len(traceparents) != 3 || traceparents[0] == traceparents[1] {
+		t.Fatalf("每次调用应携带新的 traceparent: %v", traceparents)
+	}
+	if got, _, ok := util.ParseTraceparent(traceparents[0]); !ok || got != traceID {
+		t.Errorf("traceparent 中的 Trace ID 不符合预期: %s", traceparents[0])
+	}
+	if _, _, ok := util.ParseTraceparent("00-" + strings.Repeat("0", 32) + "-0000000000000001-01"); ok {
+		t.Error("全 0 的 Trace ID 无效")
+	}
+	if util.Traceparent("custom-trace", util.NewSpanID()) != "" {
+		t.Error("不是 32 位十六进制的 Trace ID 不应生成 traceparent")
+	}
+
+	// 指标按工站统计加工结果、缺陷和耗时，加工结束后加工位归零
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("抓取指标失败: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	for _, want := range []string{
+		`remote_station_executions_total{result="success",station_id="STATION_DRILL"} 2`,
+		`remote_station_executions_total{result="failed",station_id="STATION_E_TEST"} 1`,
+		`remote_station_processing_duration_seconds_count{station_id="STATION_DRILL"} 2`,
+		`remote_station_in_flight{station_id="STATION_DRILL"} 0`,
+		`remote_station_failures_total{defect_code="ET-`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("指标中缺少 %s", want)
+		}
+	}
+
+	// 健康检查汇总工站状态，宕机的工站标记为 down，停机期间返回 503
+	sim.SetFault(types.StationETest, stationsim.Fault{Down: true})
+	var health stationsim.Health
+	resp, _ = http.Get(server.URL + "/healthz")
+	json.NewDecoder(resp.Body).Decode(&health)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || health.Status != "ok" || health.Stations[types.StationDrill] != "up" || health.Stations[types.StationETest] != "down" {
+		t.Errorf("健康状态不符合预期: %d %+v", resp.StatusCode, health)
+	}
+	sim.Shutdown(context.Background())
+	if resp, _ := http.Get(server.URL + "/healthz"); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("停机期间健康检查应返回 503: %d", resp.StatusCode)
+	}
+}
+
+func TestGRPCStation_ExecuteCompensateTraceAndHealth(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	sim := stationsim.New(stationsim.Options{
+		DefaultStation: types.StationDrill,
+		Stations: map[types.StationID]stationsim.Profile{
+			types.StationDrill: {DelayMs: 10, Firmware: "drill-ctl 4.1.7",
+				Measurements: []types.MeasurementSpec{{Name: "hole_diameter", Unit: "mm", Nominal: 0.3, LSL: 0.25, USL: 0.35}}},
+			types.StationETest: {FailureRate: 1, Machine: "ET-01"},
+		},
+	}, "sim-host", "secret", logger)
+
+	// 服务端拦截器记录每次调用收到的追踪元数据
+	var mu sync.Mutex
+	traces := map[string][]string{}
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		mu.Lock()
+		traces[info.FullMethod] = append(md.Get("x-trace-id"), md.Get("traceparent")...)
+		mu.Unlock()
+		return handler(ctx, req)
+	}))
+	sim.RegisterGRPC(grpcServer)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	go grpcServer.Serve(lis)
+	defer grpcServer.Stop()
+	endpoint := "grpc://" + lis.Addr().String()
+	remote := func(id types.StationID, opts station.RemoteOptions) station.Remote {
+		r, err := station.NewRemote(id, endpoint, opts, logger)
+		if err != nil {
+			t.Fatalf("创建 gRPC 工站失败: %v", err)
+		}
+		if _, ok := r.(*station.GRPCStation); !ok {
+			t.Fatalf("grpc:// 地址应创建 GRPCStation: %T", r)
+		}
+		return r
+	}
+	traceID := util.NewTraceID()
+	ctx := util.ContextWithTraceID(context.Background(), traceID)
+
+	// 加工结果、测量值和追溯信息与 HTTP 协议一致，Trace ID 通过元数据传递
+	drill := remote(types.StationDrill, station.RemoteOptions{BearerToken: "secret"})
+	res := drill.Execute(ctx, &types.Product{ID: "GS_1"})
+	if !res.Success || len(res.Measurements) != 1 || res.Measurements[0].LSL == nil || *res.Measurements[0].LSL != 0.25 ||
+		res.Provenance.Machine != "sim-host" || res.Provenance.Firmware != "drill-ctl 4.1.7" {
+		t.Errorf("钻孔工站的结果不符合预期: %+v", res)
+	}
+	mu.Lock()
+	got := traces[stationv1.Station_Execute_FullMethodName]
+	mu.Unlock()
+	if len(got) != 2 || got[0] != traceID || !strings.Contains(got[1], traceID) {
+		t.Errorf("Trace ID 应通过 x-trace-id 和 traceparent 元数据传递: %v", got)
+	}
+
+	// 检测不合格正常返回缺陷，补偿和健康检查按工站 ID 区分
+	etest := remote(types.StationETest, station.RemoteOptions{BearerToken: "secret"})
+	res = etest.Execute(ctx, &types.Product{ID: "GS_2"})
+	if res.Success || res.Defect == nil || !strings.HasPrefix(res.Defect.Code, "ET-") || res.Provenance.Machine != "ET-01" {
+		t.Errorf("电测工站应按失败率判定电测缺陷: %+v", res)
+	}
+	if err := etest.Compensate(ctx, &types.Product{ID: "GS_2"}); err != nil {
+		t.Errorf("补偿失败: %v", err)
+	}
+	if err := etest.Ping(ctx); err != nil {
+		t.Errorf("健康检查失败: %v", err)
+	}
+
+	// 工站宕机时健康检查为 NOT_SERVING，加工返回 UNAVAILABLE 并按通信故障处理
+	sim.SetFault(types.StationETest, stationsim.Fault{Down: true})
+	if err := etest.Ping(ctx); err == nil {
+		t.Error("宕机的工站健康检查应失败")
+	}
+	if res := etest.Execute(ctx, &types.Product{ID: "GS_3"}); res.Success || res.Defect == nil || res.Defect.Code != "EQ-COMM" {
+		t.Errorf("宕机的工站应按通信故障处理: %+v", res)
+	}
+	sim.ClearFault(types.StationETest)
+
+	// 令牌不匹配和未模拟的工站按远程服务错误处理
+	if res := remote(types.StationDrill, station.RemoteOptions{}).Execute(ctx, &types.Product{ID: "GS_4"}); res.Success || res.Defect.Code != "EQ-REMOTE" {
+		t.Errorf("缺少令牌时加工请求应被拒绝: %+v", res)
+	}
+	if res := remote(types.StationAOI, station.RemoteOptions{BearerToken: "secret"}).Execute(ctx, &types.Product{ID: "GS_5"}); res.Success || res.Defect.Code != "EQ-REMOTE" {
+		t.Errorf("未模拟的工站应返回错误: %+v", res)
+	}
+
+	// gRPC 工站只支持同步加工和 bearer_token
+	cfg := &config.Config{Stations: map[types.StationID]config.StationConfig{
+		types.StationAOI: {Endpoint: "grpc://aoi:9095", Async: true, Auth: config.StationAuthConfig{Username: "u"}},
+	}}
+	err = cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "stations.STATION_AOI.async") || !strings.Contains(err.Error(), "stations.STATION_AOI.auth") {
+		t.Errorf("gRPC 工站配置 async 和 Basic 认证应校验失败: %v", err)
+	}
 }
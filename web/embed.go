@@ -0,0 +1,20 @@
+// Package web 将看板的前端静态资源编译进二进制，使编排器不依赖启动时的工作目录
+package web
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed static
+var static embed.FS
+
+// Static 返回以 static 目录为根的前端资源
+func Static() fs.FS {
+	sub, err := fs.Sub(static, "static")
+	if err != nil {
+		// static 目录在编译时已确定存在，不会出错
+		panic(err)
+	}
+	return sub
+}